@@ -0,0 +1,206 @@
+package south2md
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DuplicateGroup is a set of identical asset files across the store.
+type DuplicateGroup struct {
+	Digest  string   // SHA-256 of the content
+	Size    int64    // size of one copy
+	Files   []string // paths relative to the store root; Files[0] is kept
+	Savings int64    // bytes freed by linking the copies that aren't links yet
+}
+
+// DedupeReport summarizes the duplicate assets of a store.
+type DedupeReport struct {
+	Groups  []DuplicateGroup
+	Scanned int   // asset files hashed or sized
+	Savings int64 // total of Groups[].Savings
+}
+
+// FindDuplicates scans the downloaded assets of every thread (images and
+// gofile files; metadata, markdown, raw pages and partial downloads are
+// ignored) and groups files with identical content. Files of equal size are
+// hashed only when another file has the same size.
+func (ps *PostStore) FindDuplicates() (*DedupeReport, error) {
+	tids, err := ps.threadIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	bySize := make(map[int64][]string)
+	report := &DedupeReport{}
+	for _, tid := range tids {
+		err := walkThreadAssets(ps.PostDir(tid), func(path string, size int64) {
+			rel, _ := filepath.Rel(ps.rootDir, path)
+			bySize[size] = append(bySize[size], rel)
+			report.Scanned++
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for size, files := range bySize {
+		if len(files) < 2 || size == 0 {
+			continue
+		}
+		byDigest := make(map[string][]string)
+		for _, rel := range files {
+			digest, err := fileSHA256(filepath.Join(ps.rootDir, rel))
+			if err != nil {
+				slog.Warn("Failed to hash asset", "path", rel, "error", err)
+				continue
+			}
+			byDigest[digest] = append(byDigest[digest], rel)
+		}
+		for digest, same := range byDigest {
+			if len(same) < 2 {
+				continue
+			}
+			sort.Strings(same)
+			group := DuplicateGroup{Digest: digest, Size: size, Files: same}
+			group.Savings = int64(ps.unlinkedCopies(same)) * size
+			report.Groups = append(report.Groups, group)
+			report.Savings += group.Savings
+		}
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		if report.Groups[i].Savings != report.Groups[j].Savings {
+			return report.Groups[i].Savings > report.Groups[j].Savings
+		}
+		return report.Groups[i].Digest < report.Groups[j].Digest
+	})
+	return report, nil
+}
+
+// LinkDuplicates replaces every copy in report with a hard link to the
+// group's first file and returns the number of files replaced. Threads
+// locked by another process are left alone.
+func (ps *PostStore) LinkDuplicates(report *DedupeReport) (int, error) {
+	linked := 0
+	for _, group := range report.Groups {
+		keep := filepath.Join(ps.rootDir, group.Files[0])
+		keepInfo, err := os.Stat(keep)
+		if err != nil {
+			slog.Warn("Duplicate source vanished", "path", group.Files[0], "error", err)
+			continue
+		}
+		for _, rel := range group.Files[1:] {
+			path := filepath.Join(ps.rootDir, rel)
+			if info, err := os.Stat(path); err != nil || os.SameFile(keepInfo, info) {
+				continue
+			}
+			tid := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+			lock, err := ps.lock(tid, 0)
+			if errors.Is(err, ErrStoreLocked) {
+				slog.Warn("Skipping duplicate of a thread being written", "tid", tid, "path", rel)
+				continue
+			}
+			if err != nil {
+				return linked, err
+			}
+			err = replaceWithLink(keep, path)
+			lock.Unlock()
+			if err != nil {
+				return linked, fmt.Errorf("failed to link %s: %w", rel, err)
+			}
+			linked++
+		}
+	}
+	return linked, nil
+}
+
+// unlinkedCopies counts the files beyond the first that aren't already hard
+// links to an earlier file of the group.
+func (ps *PostStore) unlinkedCopies(files []string) int {
+	var seen []os.FileInfo
+	copies := 0
+	for _, rel := range files {
+		info, err := os.Stat(filepath.Join(ps.rootDir, rel))
+		if err != nil {
+			continue
+		}
+		linked := false
+		for _, other := range seen {
+			if os.SameFile(other, info) {
+				linked = true
+				break
+			}
+		}
+		if !linked {
+			if len(seen) > 0 {
+				copies++
+			}
+			seen = append(seen, info)
+		}
+	}
+	return copies
+}
+
+// walkThreadAssets calls fn for every asset file below a thread dir: files in
+// its subdirectories except raw/, skipping partial downloads and sidecars.
+func walkThreadAssets(dir string, fn func(path string, size int64)) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && filepath.Dir(path) == dir && d.Name() == RawPageDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Dir(path) == dir || !d.Type().IsRegular() {
+			return nil
+		}
+		name := d.Name()
+		if strings.HasSuffix(name, ".part") || strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, ".digest.json") || name == GofileCacheFileName {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fn(path, info.Size())
+		return nil
+	})
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// replaceWithLink atomically replaces path with a hard link to src.
+func replaceWithLink(src, path string) error {
+	tmp := path + ".link.tmp"
+	_ = os.Remove(tmp)
+	if err := os.Link(src, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
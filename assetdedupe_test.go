@@ -0,0 +1,62 @@
+package south2md
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindAndLinkDuplicates(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, content string) {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tid := range []string{"100", "200"} {
+		write(filepath.Join(tid, metadataFileName), "tid = \""+tid+"\"\n")
+		write(filepath.Join(tid, "images", "banner.jpg"), "same banner bytes")
+	}
+	write(filepath.Join("200", "images", "other.jpg"), "different bytes!!")
+	write(filepath.Join("200", "gofile", "abc", "big.zip.part"), "same banner bytes")
+	write(filepath.Join("200", RawPageDir, "page-1.html"), "same banner bytes")
+
+	ps := NewPostStore(root)
+	report, err := ps.FindDuplicates()
+	if err != nil {
+		t.Fatalf("FindDuplicates returned error: %v", err)
+	}
+	if report.Scanned != 3 || len(report.Groups) != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	group := report.Groups[0]
+	want := []string{filepath.Join("100", "images", "banner.jpg"), filepath.Join("200", "images", "banner.jpg")}
+	if len(group.Files) != 2 || group.Files[0] != want[0] || group.Files[1] != want[1] {
+		t.Fatalf("unexpected group files: %v", group.Files)
+	}
+	if report.Savings != int64(len("same banner bytes")) {
+		t.Fatalf("unexpected savings: %d", report.Savings)
+	}
+
+	linked, err := ps.LinkDuplicates(report)
+	if err != nil || linked != 1 {
+		t.Fatalf("LinkDuplicates = %d, %v", linked, err)
+	}
+	a, _ := os.Stat(filepath.Join(root, want[0]))
+	b, _ := os.Stat(filepath.Join(root, want[1]))
+	if !os.SameFile(a, b) {
+		t.Fatal("expected duplicates to be hard-linked")
+	}
+
+	report, err = ps.FindDuplicates()
+	if err != nil {
+		t.Fatalf("FindDuplicates returned error: %v", err)
+	}
+	if len(report.Groups) != 1 || report.Savings != 0 {
+		t.Fatalf("expected linked files to report no savings, got %+v", report)
+	}
+}
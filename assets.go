@@ -0,0 +1,147 @@
+package south2md
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// AssetRegistryFile is the store-wide registry file under the store root.
+const AssetRegistryFile = "assets.toml"
+
+// AssetRecord describes one downloaded asset known to the store.
+type AssetRecord struct {
+	URL       string    `toml:"url"`        // 原始URL
+	Digest    string    `toml:"digest"`     // 内容MD5(与缓存文件名一致)
+	File      string    `toml:"file"`       // 相对存储根目录的文件路径
+	Size      int64     `toml:"size"`       // 文件大小
+	FetchedAt time.Time `toml:"fetched_at"` // 首次下载时间
+}
+
+// AssetRegistry maps asset URLs to files already downloaded into the store,
+// so images shared between threads (avatars, smileys) are fetched once.
+type AssetRegistry struct {
+	mu      sync.Mutex
+	path    string
+	rootDir string
+	assets  map[string]AssetRecord
+	dirty   bool
+}
+
+type assetRegistryFile struct {
+	Assets []AssetRecord `toml:"assets"`
+}
+
+// LoadAssetRegistry loads the registry stored at rootDir/assets.toml. A
+// missing file yields an empty registry.
+func LoadAssetRegistry(rootDir string) (*AssetRegistry, error) {
+	r := &AssetRegistry{
+		path:    filepath.Join(rootDir, AssetRegistryFile),
+		rootDir: rootDir,
+		assets:  make(map[string]AssetRecord),
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, nil
+		}
+		return nil, fmt.Errorf("failed to read asset registry: %w", err)
+	}
+
+	var file assetRegistryFile
+	if err := toml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to decode asset registry: %w", err)
+	}
+	for _, rec := range file.Assets {
+		r.assets[rec.URL] = rec
+	}
+	return r, nil
+}
+
+// Lookup returns the record for url when its file still exists in the store.
+func (r *AssetRegistry) Lookup(url string) (AssetRecord, bool) {
+	if r == nil {
+		return AssetRecord{}, false
+	}
+	r.mu.Lock()
+	rec, ok := r.assets[url]
+	r.mu.Unlock()
+	if !ok {
+		return AssetRecord{}, false
+	}
+	if _, err := os.Stat(r.filePath(rec.File)); err != nil {
+		return AssetRecord{}, false
+	}
+	return rec, true
+}
+
+// Record registers a downloaded asset. The first record of a URL wins so its
+// file stays the shared source for later threads.
+func (r *AssetRegistry) Record(rec AssetRecord) {
+	if r == nil || rec.URL == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.assets[rec.URL]; ok && existing.Digest == rec.Digest {
+		if _, err := os.Stat(r.filePath(existing.File)); err == nil {
+			return
+		}
+	}
+	r.assets[rec.URL] = rec
+	r.dirty = true
+}
+
+// Link makes rec's file available at dst, hard-linking when possible and
+// copying otherwise (e.g. across filesystems).
+func (r *AssetRegistry) Link(rec AssetRecord, dst string) error {
+	src := r.filePath(rec.File)
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	return copyFile(src, dst)
+}
+
+// filePath resolves a record's File, which starts with the TID of the thread
+// that downloaded it, to the file in that thread's current directory.
+func (r *AssetRegistry) filePath(file string) string {
+	tid, rest, _ := strings.Cut(filepath.ToSlash(file), "/")
+	return filepath.Join(threadDir(r.rootDir, tid), filepath.FromSlash(rest))
+}
+
+// Save writes the registry back to disk if it changed.
+func (r *AssetRegistry) Save() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.dirty {
+		return nil
+	}
+
+	file := assetRegistryFile{Assets: make([]AssetRecord, 0, len(r.assets))}
+	for _, rec := range r.assets {
+		file.Assets = append(file.Assets, rec)
+	}
+	sort.Slice(file.Assets, func(i, j int) bool { return file.Assets[i].URL < file.Assets[j].URL })
+
+	data, err := toml.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("failed to encode asset registry: %w", err)
+	}
+	if err := writeFileAtomic(r.path, data); err != nil {
+		return fmt.Errorf("failed to save asset registry: %w", err)
+	}
+	r.dirty = false
+	return nil
+}
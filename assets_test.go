@@ -0,0 +1,76 @@
+package south2md
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestImageHandlerReusesImagesAcrossThreads(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("smiley-bytes"))
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	registry, err := LoadAssetRegistry(root)
+	if err != nil {
+		t.Fatalf("LoadAssetRegistry returned error: %v", err)
+	}
+	h := NewImageHandler("images")
+	h.SetRootDir(root)
+	h.SetAssetRegistry(registry)
+
+	markdown := []byte("![s](" + srv.URL + "/smile.gif)")
+	for _, tid := range []string{"1", "2"} {
+		if err := os.MkdirAll(filepath.Join(root, tid, "images"), 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		post := &Post{TID: tid}
+		got, err := h.DownloadAndCacheImages(tid, markdown, post)
+		if err != nil {
+			t.Fatalf("DownloadAndCacheImages(%s) returned error: %v", tid, err)
+		}
+		if !strings.Contains(string(got), "](images/") || len(post.Images) != 1 {
+			t.Fatalf("expected localized image for thread %s, got %q (%v)", tid, got, post.Images)
+		}
+		data, err := os.ReadFile(filepath.Join(root, tid, "images", post.Images[0].Local))
+		if err != nil || string(data) != "smiley-bytes" {
+			t.Fatalf("expected image file in thread %s, got %q (%v)", tid, data, err)
+		}
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("expected one download across threads, got %d", hits.Load())
+	}
+
+	if err := registry.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	reloaded, err := LoadAssetRegistry(root)
+	if err != nil {
+		t.Fatalf("reload returned error: %v", err)
+	}
+	rec, ok := reloaded.Lookup(srv.URL + "/smile.gif")
+	if !ok || rec.File != "1/images/"+rec.Digest+".gif" {
+		t.Fatalf("unexpected persisted record: %+v (found=%v)", rec, ok)
+	}
+}
+
+func TestImageHandlerIgnoresRegistryOutsideStoreRoot(t *testing.T) {
+	registry, err := LoadAssetRegistry(t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadAssetRegistry returned error: %v", err)
+	}
+	h := NewImageHandler("images")
+	h.SetRootDir(t.TempDir())
+	h.SetAssetRegistry(registry)
+	if h.storeRegistry() != nil {
+		t.Fatal("expected registry unused for a different root")
+	}
+}
@@ -0,0 +1,201 @@
+package south2md
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// ErrAttachmentHTML reports that an attachment link answered with an HTML
+// page instead of the file, typically a login prompt or an expired key.
+var ErrAttachmentHTML = errors.New("attachment returned an HTML page (login required or expired key)")
+
+// AttachmentFetcher downloads forum attachments with the forum session.
+// Fetcher implements it.
+type AttachmentFetcher interface {
+	// FetchAttachment downloads rawURL. It fails with ErrAttachmentHTML on
+	// HTML error pages and when the file exceeds maxSize bytes (0 means no
+	// limit).
+	FetchAttachment(ctx context.Context, rawURL string, maxSize int64) ([]byte, error)
+	// RefreshAttachment fetches page of thread tid again and returns the
+	// current link of attachment id.
+	RefreshAttachment(ctx context.Context, tid string, page int, id string) (string, error)
+}
+
+// FetchAttachment downloads an attachment with the fetcher's cookies and
+// User-Agent, which job.php attachment links require.
+func (f *Fetcher) FetchAttachment(ctx context.Context, rawURL string, maxSize int64) (data []byte, err error) {
+	start := time.Now()
+	defer func() {
+		f.metrics.recordRequest(MetricsComponentFetcher, start, int64(len(data)), err)
+	}()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	resp, err := f.doRequest(rawURL, func(c *colly.Collector) {
+		// One byte over the limit tells a truncated body from a file that
+		// fits exactly.
+		c.MaxBodySize = 0
+		if maxSize > 0 {
+			c.MaxBodySize = int(maxSize) + 1
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &httpStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attachment: %w", err)
+	}
+	if maxSize > 0 && int64(len(body)) > maxSize {
+		return nil, sizeLimitError("attachment", maxSize)
+	}
+	if isHTMLPayload(resp.Header.Get("Content-Type"), body[:min(len(body), 512)]) {
+		return nil, ErrAttachmentHTML
+	}
+	return body, nil
+}
+
+// RefreshAttachment re-parses page of thread tid for the current link of
+// attachment id, whose one-time key may have expired since the page was
+// first fetched.
+func (f *Fetcher) RefreshAttachment(ctx context.Context, tid string, page int, id string) (string, error) {
+	html, err := f.fetchPage(ctx, tid, page)
+	if err != nil {
+		return "", err
+	}
+	parser := NewPostParser()
+	parser.baseURL = f.mirrors.current() + "/"
+	if err := parser.LoadFromString(html); err != nil {
+		return "", err
+	}
+	for _, att := range parser.extractAttachments(parser.FindElement("body")) {
+		if att.ID == id {
+			return att.URL, nil
+		}
+	}
+	return "", fmt.Errorf("attachment %s not found on page %d", id, page)
+}
+
+// SetAttachmentFetcher downloads the floor attachments listed in metadata
+// through fetcher, skipping files the forum labels larger than maxSize bytes
+// (0 means no limit). nil disables attachment downloads.
+func (ih *ImageHandler) SetAttachmentFetcher(fetcher AttachmentFetcher, maxSize int64) {
+	if ih == nil {
+		return
+	}
+	ih.attachments = fetcher
+	ih.attachmentMaxSize = maxSize
+}
+
+// findAttachmentImage returns the downloaded record of att, matching by URL
+// or, since attachment links carry expiring keys, by attachment ID.
+func findAttachmentImage(post *Post, att Attachment) *Image {
+	if post == nil {
+		return nil
+	}
+	for i := range post.Images {
+		img := &post.Images[i]
+		if !img.Downloaded || img.Local == "" {
+			continue
+		}
+		if img.URL == att.URL || (att.ID != "" && img.AttachmentID == att.ID) {
+			return img
+		}
+	}
+	return nil
+}
+
+// DownloadAttachments downloads the attachments of entry that have no local
+// copy yet into the thread's cache dir and records them in post.Images.
+// Failures are logged and queued for retry; only a *DiskSpaceError is
+// returned.
+func (ih *ImageHandler) DownloadAttachments(tid string, entry PostEntry, post *Post) error {
+	if ih.attachments == nil || !ih.download || post == nil {
+		return nil
+	}
+	for _, att := range entry.Attachments {
+		if img := findAttachmentImage(post, att); img != nil && !ih.dropDamagedImage(tid, *img, post) {
+			continue
+		}
+		if ih.retryOnly != nil && !ih.retryOnly[att.URL] {
+			continue
+		}
+		if ih.attachmentMaxSize > 0 && att.Size > ih.attachmentMaxSize {
+			slog.Info("Skipping attachment larger than the size limit", "url", att.URL, "size", att.Size, "limit", ih.attachmentMaxSize)
+			continue
+		}
+
+		data, err := ih.fetchAttachment(tid, entry.SourcePage, att)
+		if errors.Is(err, ErrSizeLimit) {
+			slog.Warn("Skipping attachment", "url", att.URL, "error", err)
+			continue
+		}
+		if err != nil {
+			slog.Error("Failed to download attachment", "url", att.URL, "error", err)
+			ih.pending.Add(PendingKindImage, att.URL, err)
+			continue
+		}
+		hash := md5.Sum(data)
+		filename := SanitizePathComponent(fmt.Sprintf("%x%s", hash, path.Ext(att.Filename)))
+		filePath := filepath.Join(threadDir(ih.rootDir, tid), ih.cacheDir, filename)
+		if err := ih.writeCacheFile(tid, att.URL, filePath, data); err != nil {
+			var diskErr *DiskSpaceError
+			if errors.As(err, &diskErr) {
+				return err
+			}
+			continue
+		}
+		slog.Info("Cached attachment successfully", "url", att.URL, "filename", att.Filename, "cached_path", filePath)
+		post.Images = append(post.Images, Image{
+			URL:          att.URL,
+			Local:        filename,
+			Alt:          att.Filename,
+			FileSize:     int64(len(data)),
+			Downloaded:   true,
+			AttachmentID: att.ID,
+			SHA256:       sha256Hex(data),
+		})
+	}
+	return nil
+}
+
+// fetchAttachment downloads att, retrying once with a link freshly parsed
+// from its page when the first attempt gets an HTML page back.
+func (ih *ImageHandler) fetchAttachment(tid string, page int, att Attachment) ([]byte, error) {
+	ctx := ih.traceCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	data, err := ih.attachments.FetchAttachment(ctx, att.URL, ih.attachmentMaxSize)
+	if !errors.Is(err, ErrAttachmentHTML) || att.ID == "" {
+		return data, err
+	}
+	if page <= 0 {
+		page = 1
+	}
+	fresh, refreshErr := ih.attachments.RefreshAttachment(ctx, tid, page, att.ID)
+	if refreshErr != nil {
+		return nil, fmt.Errorf("%w; refreshing the link failed: %v", err, refreshErr)
+	}
+	if fresh == att.URL {
+		return nil, err
+	}
+	slog.Info("Retrying attachment with a refreshed link", "id", att.ID, "page", page)
+	return ih.attachments.FetchAttachment(ctx, fresh, ih.attachmentMaxSize)
+}
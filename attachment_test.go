@@ -0,0 +1,154 @@
+package south2md
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtractAttachmentsResolvesLinksAndSizes(t *testing.T) {
+	parser := NewPostParser()
+	parser.baseURL = "https://south-plus.net/"
+
+	html := `<html><body><div id="read_1">
+<span id="att_11"><a href="job.php?action=download&amp;aid=11">pack.zip</a> (1.5 M)</span>
+<span id="att_12"><img src="//south-plus.net/attachment/thumb.jpg" onclick="window.open('//south-plus.net/attachment/full.jpg');"></span>
+</div></body></html>`
+	if err := parser.LoadFromString(html); err != nil {
+		t.Fatalf("load html failed: %v", err)
+	}
+
+	got := parser.extractAttachments(parser.FindElement("div[id^='read_']"))
+	want := []Attachment{
+		{ID: "11", Filename: "pack.zip", URL: "https://south-plus.net/job.php?action=download&aid=11", Size: 1572864},
+		{ID: "12", Filename: "full.jpg", URL: "https://south-plus.net/attachment/full.jpg"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d attachments, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("attachment %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestFormatAttachmentsAnnotatesDownloadStatus(t *testing.T) {
+	mf := NewMarkdownFormatter(&MarkdownOptions{})
+	entry := PostEntry{Attachments: []Attachment{
+		{ID: "1", Filename: "a.png", URL: "https://cdn.example.com/a.png"},
+		{ID: "2", Filename: "b.zip", URL: "https://cdn.example.com/b.zip", Size: 2048},
+	}}
+	post := &Post{Images: []Image{
+		{URL: "https://cdn.example.com/a.png", Local: "hash.png", Downloaded: true, FileSize: 130},
+	}}
+
+	got := mf.FormatAttachments(entry, post, "images")
+	for _, want := range []string{
+		"**Attachments**",
+		"- `a.png` · 130 B · [local](images/hash.png) · [original](https://cdn.example.com/a.png) · downloaded",
+		"- `b.zip` · 2.0 KB · [original](https://cdn.example.com/b.zip) · not downloaded",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in:\n%s", want, got)
+		}
+	}
+}
+
+func newAttachmentTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/read.php":
+			fmt.Fprint(w, `<html><body><div id="read_1"><span id="att_11"><a href="job.php?action=download&amp;aid=11&amp;verify=fresh">pack.zip</a></span></div></body></html>`)
+		case "/job.php":
+			if !strings.Contains(r.Header.Get("Cookie"), "session=ok") {
+				w.Header().Set("Content-Type", "text/html")
+				fmt.Fprint(w, "<html><body>请先登录</body></html>")
+				return
+			}
+			if r.URL.Query().Get("verify") != "fresh" {
+				fmt.Fprint(w, "<!DOCTYPE html><html><body>链接已过期</body></html>")
+				return
+			}
+			_, _ = w.Write([]byte("PK\x03\x04zip-bytes"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func newAttachmentTestFetcher(t *testing.T, srv *httptest.Server, cookie bool) *Fetcher {
+	t.Helper()
+	options := &HTTPOptions{Timeout: 5 * time.Second, MaxConcurrent: 1}
+	if cookie {
+		cookieFile := filepath.Join(t.TempDir(), "cookies.txt")
+		cm := NewCookieManager()
+		cm.AddCookie(&CookieEntry{Name: "session", Value: "ok", Domain: strings.TrimPrefix(srv.URL, "http://"), Path: "/"})
+		if err := cm.SaveToFile(cookieFile); err != nil {
+			t.Fatalf("SaveToFile returned error: %v", err)
+		}
+		options.CookieFile = cookieFile
+		options.EnableCookie = true
+	}
+	return NewFetcher(srv.Client(), options, srv.URL)
+}
+
+func TestDownloadAttachmentsRefreshesExpiredKeys(t *testing.T) {
+	srv := newAttachmentTestServer(t)
+	defer srv.Close()
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "100", "images"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	h := NewImageHandler("images")
+	h.SetRootDir(root)
+	h.SetAttachmentFetcher(newAttachmentTestFetcher(t, srv, true), 0)
+
+	att := Attachment{ID: "11", Filename: "pack.zip", URL: srv.URL + "/job.php?action=download&aid=11&verify=stale"}
+	entry := PostEntry{SourcePage: 1, Attachments: []Attachment{att}}
+	post := &Post{TID: "100"}
+	h.DownloadAttachments("100", entry, post)
+
+	if len(post.Images) != 1 || post.Images[0].AttachmentID != "11" || post.Images[0].URL != att.URL || !strings.HasSuffix(post.Images[0].Local, ".zip") {
+		t.Fatalf("unexpected attachment records: %+v", post.Images)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "100", "images", post.Images[0].Local))
+	if err != nil || string(data) != "PK\x03\x04zip-bytes" {
+		t.Fatalf("expected the zip on disk, got %q, %v", data, err)
+	}
+
+	// The next fetch sees a new key; the record still matches by ID.
+	att.URL = srv.URL + "/job.php?action=download&aid=11&verify=other"
+	got := NewMarkdownFormatter(&MarkdownOptions{}).FormatAttachments(PostEntry{Attachments: []Attachment{att}}, post, "images")
+	if !strings.Contains(got, "[local](images/"+post.Images[0].Local+")") {
+		t.Fatalf("expected the local copy to be linked, got:\n%s", got)
+	}
+}
+
+func TestFetchAttachmentRejectsHTMLAndOversizedFiles(t *testing.T) {
+	srv := newAttachmentTestServer(t)
+	defer srv.Close()
+	ctx := context.Background()
+	fresh := srv.URL + "/job.php?action=download&aid=11&verify=fresh"
+
+	if _, err := newAttachmentTestFetcher(t, srv, false).FetchAttachment(ctx, fresh, 0); !errors.Is(err, ErrAttachmentHTML) {
+		t.Fatalf("expected ErrAttachmentHTML without the session cookie, got %v", err)
+	}
+	fetcher := newAttachmentTestFetcher(t, srv, true)
+	if _, err := fetcher.FetchAttachment(ctx, fresh, 4); err == nil {
+		t.Fatal("expected a file over the size limit to be rejected")
+	}
+	data, err := fetcher.FetchAttachment(ctx, fresh, int64(len("PK\x03\x04zip-bytes")))
+	if err != nil || string(data) != "PK\x03\x04zip-bytes" {
+		t.Fatalf("FetchAttachment = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,154 @@
+package south2md
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+)
+
+// authorsFileName is the file of a thread dir holding the profile summaries
+// of its authors.
+const authorsFileName = "authors.toml"
+
+// AuthorProfile is the summary of a forum user's profile page (u.php).
+type AuthorProfile struct {
+	UID       string            `toml:"uid"`
+	Username  string            `toml:"username"`
+	URL       string            `toml:"url"`
+	Fields    map[string]string `toml:"fields,omitempty"`     // label → value rows of the profile table
+	FetchedAt time.Time         `toml:"fetched_at,omitempty"` // zero in reproducible mode
+}
+
+type authorsFile struct {
+	Authors []AuthorProfile `toml:"authors"`
+}
+
+// ProfileFetcher fetches forum user profiles with the forum session.
+// Fetcher implements it.
+type ProfileFetcher interface {
+	FetchProfile(ctx context.Context, uid string) (*AuthorProfile, error)
+}
+
+// FetchProfile fetches and summarizes the profile page of user uid.
+func (f *Fetcher) FetchProfile(ctx context.Context, uid string) (*AuthorProfile, error) {
+	profileURL := f.mirrors.current() + "/u.php?action-show-uid-" + uid + ".html"
+	html, _, err := f.fetchForumURL(ctx, profileURL)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := parseProfileFields(html)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthorProfile{UID: uid, URL: profileURL, Fields: fields}, nil
+}
+
+// parseProfileFields returns the two-cell "label: value" rows of a profile
+// page, which hold the user's registration date, post count, credits and
+// similar details.
+func parseProfileFields(html string) (map[string]string, error) {
+	parser := NewPostParser()
+	if err := parser.LoadFromString(html); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string)
+	rows := parser.FindElements("tr")
+	for i := 0; i < rows.Length(); i++ {
+		cells := rows.Eq(i).Find("th, td")
+		if cells.Length() != 2 {
+			continue
+		}
+		label := strings.TrimRight(strings.TrimSpace(cells.Eq(0).Text()), ":：")
+		value := strings.Join(strings.Fields(cells.Eq(1).Text()), " ")
+		if label == "" || value == "" || utf8.RuneCountInString(label) > 16 || utf8.RuneCountInString(value) > 200 {
+			continue
+		}
+		if _, ok := fields[label]; !ok {
+			fields[label] = value
+		}
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no profile fields found")
+	}
+	return fields, nil
+}
+
+// SetProfileFetcher makes StorePost and ExportPost save the profile
+// summaries of a thread's authors to its authors.toml, fetching each author
+// once per thread through fetcher. nil disables it.
+func (g *MarkdownGenerator) SetProfileFetcher(fetcher ProfileFetcher) {
+	if g == nil {
+		return
+	}
+	g.profiles = fetcher
+}
+
+// storeAuthorProfiles fetches the profiles of the authors of post missing
+// from the authors.toml in tidDir and rewrites it. Failed fetches are logged
+// and tried again on the next run.
+func (g *MarkdownGenerator) storeAuthorProfiles(post *Post, tidDir string) error {
+	if g.profiles == nil {
+		return nil
+	}
+	path := filepath.Join(tidDir, authorsFileName)
+	var file authorsFile
+	if data, err := os.ReadFile(path); err == nil {
+		if err := toml.Unmarshal(data, &file); err != nil {
+			slog.Warn("Failed to read author profiles, fetching them again", "path", path, "error", err)
+			file = authorsFile{}
+		}
+	}
+	known := make(map[string]bool, len(file.Authors))
+	for _, profile := range file.Authors {
+		known[profile.UID] = true
+	}
+
+	ctx := g.imageHandler.traceCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	added := 0
+	for _, entry := range append([]PostEntry{post.MainPost}, post.Replies...) {
+		uid := entry.Author.UID
+		if uid == "" || known[uid] {
+			continue
+		}
+		known[uid] = true
+		profile, err := g.profiles.FetchProfile(ctx, uid)
+		if err != nil {
+			slog.Warn("Failed to fetch author profile", "uid", uid, "error", err)
+			continue
+		}
+		profile.Username = entry.Author.Username
+		profile.FetchedAt = g.generatedAt()
+		file.Authors = append(file.Authors, *profile)
+		added++
+	}
+	if added == 0 {
+		return nil
+	}
+
+	sort.SliceStable(file.Authors, func(i, j int) bool {
+		a, b := file.Authors[i].UID, file.Authors[j].UID
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+	data, err := toml.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("生成authors.toml失败: %v", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("保存authors.toml失败: %v", err)
+	}
+	return nil
+}
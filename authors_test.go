@@ -0,0 +1,120 @@
+package south2md
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestDownloadAvatarsOncePerAuthor(t *testing.T) {
+	doer := &flakyImageDoer{}
+	h, root := newVerifyTestHandler(t, doer)
+	h.SetAvatars(true)
+
+	newPost := func() *Post {
+		return &Post{
+			MainPost: PostEntry{Author: Author{UID: "1", Avatar: "https://img.example.com/a.png"}},
+			Replies: []PostEntry{
+				{Author: Author{UID: "2", Avatar: "https://img.example.com/b.jpg"}},
+				{Author: Author{UID: "1", Avatar: "https://img.example.com/a.png"}},
+				{Author: Author{UID: "3", Avatar: "images/face/none.gif"}},
+			},
+		}
+	}
+	post := newPost()
+	if err := h.DownloadAvatars("100", post); err != nil {
+		t.Fatalf("DownloadAvatars returned error: %v", err)
+	}
+	if len(doer.urls) != 2 {
+		t.Fatalf("expected each avatar downloaded once, got %v", doer.urls)
+	}
+	local := post.MainPost.Author.AvatarLocal
+	if !strings.HasPrefix(local, "avatars/") || !strings.HasSuffix(local, ".png") || post.Replies[1].Author.AvatarLocal != local {
+		t.Fatalf("unexpected avatar paths %q and %q", local, post.Replies[1].Author.AvatarLocal)
+	}
+	if post.Replies[2].Author.AvatarLocal != "" {
+		t.Fatalf("expected no local avatar for a relative URL, got %q", post.Replies[2].Author.AvatarLocal)
+	}
+	if _, err := os.Stat(filepath.Join(root, "100", filepath.FromSlash(local))); err != nil {
+		t.Fatalf("expected the avatar on disk: %v", err)
+	}
+
+	post = newPost()
+	if err := h.DownloadAvatars("100", post); err != nil {
+		t.Fatalf("DownloadAvatars returned error: %v", err)
+	}
+	if len(doer.urls) != 2 || post.MainPost.Author.AvatarLocal != local {
+		t.Fatalf("expected the stored avatars reused, got %v", doer.urls)
+	}
+}
+
+// fakeProfileFetcher returns a profile for every uid and records the uids.
+type fakeProfileFetcher struct {
+	uids []string
+}
+
+func (f *fakeProfileFetcher) FetchProfile(_ context.Context, uid string) (*AuthorProfile, error) {
+	f.uids = append(f.uids, uid)
+	return &AuthorProfile{UID: uid, Fields: map[string]string{"发帖": uid + "0"}}, nil
+}
+
+func TestStoreAuthorProfilesFetchesUnknownAuthors(t *testing.T) {
+	dir := t.TempDir()
+	fetcher := &fakeProfileFetcher{}
+	g := NewMarkdownGenerator(&MarkdownOptions{Reproducible: true}, nil)
+	g.SetProfileFetcher(fetcher)
+
+	post := &Post{
+		MainPost: PostEntry{Author: Author{UID: "12", Username: "op"}},
+		Replies: []PostEntry{
+			{Author: Author{UID: "9", Username: "nine"}},
+			{Author: Author{UID: "12", Username: "op"}},
+		},
+	}
+	if err := g.storeAuthorProfiles(post, dir); err != nil {
+		t.Fatalf("storeAuthorProfiles returned error: %v", err)
+	}
+	post.Replies = append(post.Replies, PostEntry{Author: Author{UID: "100", Username: "late"}})
+	if err := g.storeAuthorProfiles(post, dir); err != nil {
+		t.Fatalf("storeAuthorProfiles returned error: %v", err)
+	}
+	if strings.Join(fetcher.uids, ",") != "12,9,100" {
+		t.Fatalf("expected each author fetched once, got %v", fetcher.uids)
+	}
+
+	var file authorsFile
+	if _, err := toml.DecodeFile(filepath.Join(dir, authorsFileName), &file); err != nil {
+		t.Fatalf("decode authors.toml: %v", err)
+	}
+	var got []string
+	for _, profile := range file.Authors {
+		got = append(got, profile.UID+"="+profile.Username+":"+profile.Fields["发帖"])
+	}
+	if strings.Join(got, " ") != "9=nine:90 12=op:120 100=late:1000" || !file.Authors[0].FetchedAt.IsZero() {
+		t.Fatalf("unexpected profiles %+v", file.Authors)
+	}
+}
+
+func TestParseProfileFields(t *testing.T) {
+	html := `<html><body><table>
+<tr><th colspan="2">用户资料</th></tr>
+<tr><td>注册时间：</td><td>2020-01-02</td></tr>
+<tr><td>发帖</td><td> 1234 </td></tr>
+<tr><td>签名</td><td>` + strings.Repeat("长", 300) + `</td></tr>
+</table></body></html>`
+
+	fields, err := parseProfileFields(html)
+	if err != nil {
+		t.Fatalf("parseProfileFields returned error: %v", err)
+	}
+	if len(fields) != 2 || fields["注册时间"] != "2020-01-02" || fields["发帖"] != "1234" {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+	if _, err := parseProfileFields("<html><body><p>没有该用户</p></body></html>"); err == nil {
+		t.Fatal("expected an error for a page without profile fields")
+	}
+}
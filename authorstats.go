@@ -0,0 +1,119 @@
+package south2md
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// authorStats summarizes one participant of a thread.
+type authorStats struct {
+	Author      Author
+	Floors      int
+	First, Last int // indexes of the author's first and last floor
+	Images      int
+}
+
+// collectAuthorStats groups floors by author (UID, or the username when the
+// UID is unknown) and returns the participants with the most floors first.
+// Ties keep the order of first appearance.
+func collectAuthorStats(floors []TemplateFloor) []authorStats {
+	var stats []authorStats
+	byAuthor := make(map[string]int)
+	for i, floor := range floors {
+		author := floor.Entry.Author
+		key := "uid:" + author.UID
+		if author.UID == "" {
+			if author.Username == "" {
+				continue
+			}
+			key = "name:" + author.Username
+		}
+		n, ok := byAuthor[key]
+		if !ok {
+			n = len(stats)
+			byAuthor[key] = n
+			stats = append(stats, authorStats{Author: author, First: i})
+		}
+		stats[n].Floors++
+		stats[n].Last = i
+		stats[n].Images += countPostedImages(floor.Entry.HTMLContent)
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].Floors > stats[j].Floors })
+	return stats
+}
+
+// countPostedImages counts the images of a floor's HTML outside its quote
+// blocks, so quoting an image doesn't count as posting it again.
+func countPostedImages(htmlContent string) int {
+	if !strings.Contains(htmlContent, "<img") {
+		return 0
+	}
+	root := parseFragment(htmlContent)
+	inQuote := make(map[*html.Node]bool)
+	if selector, err := compileSelector(quoteSelector); err == nil {
+		for _, n := range selector.MatchAll(root) {
+			inQuote[n] = true
+		}
+	}
+
+	count := 0
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if inQuote[n] {
+			return
+		}
+		if n.Type == html.ElementNode && n.Data == "img" {
+			count++
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return count
+}
+
+// FormatAuthorStats renders the participants appendix linking to floors in
+// the same document, or "" when AuthorStats is off.
+func (mf *MarkdownFormatter) FormatAuthorStats(floors []TemplateFloor) string {
+	return mf.formatAuthorStats(floors, func(floor TemplateFloor) string {
+		return "#pid" + floor.Entry.PostID
+	})
+}
+
+// formatAuthorStats renders the participants appendix as a table, linking
+// each first and last floor to href(floor).
+func (mf *MarkdownFormatter) formatAuthorStats(floors []TemplateFloor, href func(TemplateFloor) string) string {
+	if !mf.options.AuthorStats {
+		return ""
+	}
+	stats := collectAuthorStats(floors)
+	if len(stats) == 0 {
+		return ""
+	}
+
+	floorLink := func(floor TemplateFloor) string {
+		link := fmt.Sprintf("[%s](%s)", floor.Floor, href(floor))
+		if !floor.Entry.PostTime.IsZero() {
+			link += " " + floor.Entry.PostTime.Format("2006-01-02 15:04")
+		}
+		return link
+	}
+
+	var md strings.Builder
+	md.WriteString("**参与者统计**\n\n")
+	md.WriteString("| 作者 | 楼层数 | 首次发言 | 最后发言 | 图片数 |\n")
+	md.WriteString("| --- | ---: | --- | --- | ---: |\n")
+	for _, s := range stats {
+		name := EscapeMarkdown(s.Author.Username)
+		if s.Author.UID != "" {
+			name += " (UID:" + s.Author.UID + ")"
+		}
+		fmt.Fprintf(&md, "| %s | %d | %s | %s | %d |\n",
+			name, s.Floors, floorLink(floors[s.First]), floorLink(floors[s.Last]), s.Images)
+	}
+	return md.String()
+}
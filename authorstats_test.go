@@ -0,0 +1,70 @@
+package south2md_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/fdkevin0/south2md"
+)
+
+func authorStatsTestPost() *main.Post {
+	at := func(day int) time.Time { return time.Date(2024, 1, day, 10, 0, 0, 0, time.UTC) }
+	alice := main.Author{UID: "1", Username: "alice"}
+	bob := main.Author{UID: "2", Username: "bob_2"}
+	return &main.Post{
+		TID:      "100",
+		Title:    "stats",
+		MainPost: main.PostEntry{Floor: "GF", PostID: "tpc", Author: alice, PostTime: at(1), HTMLContent: `<p>main<img src="https://img.example.com/1.jpg"></p>`},
+		Replies: []main.PostEntry{
+			{Floor: "B1F", PostID: "201", Author: bob, PostTime: at(2), HTMLContent: "first"},
+			{Floor: "B2F", PostID: "202", Author: bob, PostTime: at(3), HTMLContent: `<blockquote class="blockquote"><img src="https://img.example.com/1.jpg"></blockquote><img src="https://img.example.com/2.jpg">`},
+			{Floor: "B3F", PostID: "203", Author: bob, PostTime: at(4), HTMLContent: "last"},
+			{Floor: "B4F", PostID: "204", Author: alice, PostTime: at(5), HTMLContent: `<img src="a.jpg"><img src="b.jpg">`},
+		},
+	}
+}
+
+func TestGenerateMarkdownAppendsAuthorStats(t *testing.T) {
+	g := main.NewMarkdownGenerator(&main.MarkdownOptions{AuthorStats: true}, nil)
+	g.SetDownloadEnabled(false)
+	md, err := g.GenerateMarkdown(authorStatsTestPost())
+	if err != nil {
+		t.Fatalf("GenerateMarkdown returned error: %v", err)
+	}
+
+	want := "**参与者统计**\n\n" +
+		"| 作者 | 楼层数 | 首次发言 | 最后发言 | 图片数 |\n" +
+		"| --- | ---: | --- | --- | ---: |\n" +
+		"| bob\\_2 (UID:2) | 3 | [B1F](#pid201) 2024-01-02 10:00 | [B3F](#pid203) 2024-01-04 10:00 | 1 |\n" +
+		"| alice (UID:1) | 2 | [0](#pidtpc) 2024-01-01 10:00 | [B4F](#pid204) 2024-01-05 10:00 | 3 |\n"
+	if !strings.Contains(md, want) {
+		t.Fatalf("expected the author table, got:\n%s", md)
+	}
+	if strings.Index(md, want) > strings.Index(md, "*本文档由 south2md 自动生成*") {
+		t.Fatalf("expected the table before the footer, got:\n%s", md)
+	}
+
+	g = main.NewMarkdownGenerator(&main.MarkdownOptions{}, nil)
+	g.SetDownloadEnabled(false)
+	if md, _ := g.GenerateMarkdown(authorStatsTestPost()); strings.Contains(md, "参与者统计") {
+		t.Fatalf("expected no table when disabled, got:\n%s", md)
+	}
+}
+
+func TestSplitPostListsAuthorStatsInIndex(t *testing.T) {
+	g := main.NewMarkdownGenerator(&main.MarkdownOptions{AuthorStats: true, SplitEvery: 2}, nil)
+	g.SetDownloadEnabled(false)
+	index, parts, err := g.GenerateMarkdownParts(authorStatsTestPost())
+	if err != nil {
+		t.Fatalf("GenerateMarkdownParts returned error: %v", err)
+	}
+	if !strings.Contains(index, "[B1F](post-001.md#pid201)") || !strings.Contains(index, "[B3F](post-002.md#pid203)") {
+		t.Fatalf("expected floor links into the parts, got:\n%s", index)
+	}
+	for _, part := range parts {
+		if strings.Contains(part.Content, "参与者统计") {
+			t.Fatalf("expected no table in %s", part.Name)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package south2md
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// avatarsDir is the directory of a thread holding its authors' avatars.
+const avatarsDir = "avatars"
+
+// SetAvatars makes DownloadAvatars download the avatars of a thread's
+// authors into its avatars dir.
+func (ih *ImageHandler) SetAvatars(enabled bool) {
+	if ih == nil {
+		return
+	}
+	ih.avatars = enabled
+}
+
+// DownloadAvatars downloads the avatar of every distinct author of post once
+// into the avatars dir of thread tid and points Author.AvatarLocal of each
+// floor at it. Avatars already on disk are reused. Failed downloads are
+// queued for retry; only a *DiskSpaceError is returned. Relative avatars,
+// the forum's built-in faces, are left alone.
+func (ih *ImageHandler) DownloadAvatars(tid string, post *Post) error {
+	if !ih.avatars || post == nil {
+		return nil
+	}
+	dir := filepath.Join(threadDir(ih.rootDir, tid), avatarsDir)
+
+	local := make(map[string]string)
+	var missing []string
+	for _, entry := range append([]PostEntry{post.MainPost}, post.Replies...) {
+		avatarURL := entry.Author.Avatar
+		if _, seen := local[avatarURL]; seen || !ih.isRemoteURL(avatarURL) {
+			continue
+		}
+		name := avatarFileName(avatarURL)
+		local[avatarURL] = ""
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.Size() > 0 {
+			local[avatarURL] = avatarsDir + "/" + name
+			continue
+		}
+		if ih.download && (ih.retryOnly == nil || ih.retryOnly[avatarURL]) {
+			missing = append(missing, avatarURL)
+		}
+	}
+
+	if len(missing) > 0 {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("创建avatars目录失败: %v", err)
+		}
+		if err := ih.downloadAvatars(tid, dir, missing, local); err != nil {
+			return err
+		}
+	}
+
+	setAvatarLocal(&post.MainPost, local)
+	for i := range post.Replies {
+		setAvatarLocal(&post.Replies[i], local)
+	}
+	return nil
+}
+
+// downloadAvatars downloads urls into dir with the image worker pool and
+// records the local path of each saved avatar in local.
+func (ih *ImageHandler) downloadAvatars(tid, dir string, urls []string, local map[string]string) error {
+	tasks := make(chan DownloadTask, len(urls))
+	results := make(chan DownloadResult, len(urls))
+	var wg sync.WaitGroup
+	for i := 0; i < min(runtime.NumCPU(), 8, len(urls)); i++ {
+		wg.Add(1)
+		go ih.downloadWorker(tasks, results, &wg)
+	}
+	for _, avatarURL := range urls {
+		tasks <- DownloadTask{URL: avatarURL}
+	}
+	close(tasks)
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var diskErr *DiskSpaceError
+	for result := range results {
+		if result.Error != nil {
+			if !errors.Is(result.Error, ErrSizeLimit) {
+				slog.Warn("Failed to download avatar", "url", result.URL, "error", result.Error)
+				ih.pending.Add(PendingKindImage, result.URL, result.Error)
+			}
+			continue
+		}
+		name := avatarFileName(result.URL)
+		if err := ih.writeCacheFile(tid, result.URL, filepath.Join(dir, name), result.ImageData); err != nil {
+			if diskErr == nil {
+				errors.As(err, &diskErr)
+			}
+			continue
+		}
+		local[result.URL] = avatarsDir + "/" + name
+	}
+	if diskErr != nil {
+		return diskErr
+	}
+	return nil
+}
+
+// avatarFileName names the cached avatar of avatarURL after the URL, so a
+// re-run finds it without downloading it again.
+func avatarFileName(avatarURL string) string {
+	return SanitizePathComponent(fmt.Sprintf("%x%s", md5.Sum([]byte(avatarURL)), imageFileExt(avatarURL)))
+}
+
+func setAvatarLocal(entry *PostEntry, local map[string]string) {
+	if path, ok := local[entry.Author.Avatar]; ok {
+		entry.Author.AvatarLocal = path
+	}
+}
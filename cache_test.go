@@ -0,0 +1,62 @@
+package south2md
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newLRUCache[string, int](2)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+	c.Add("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("expected b to be evicted")
+	}
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("expected a=1, got %v %v", v, ok)
+	}
+	if c.Len() != 2 {
+		t.Fatalf("expected 2 entries, got %d", c.Len())
+	}
+}
+
+func TestLoadMarkdownTemplateReusesUntilFileChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "layout.tmpl")
+	if err := os.WriteFile(path, []byte(`{{define "footer"}}v1{{end}}`), 0644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+
+	first, err := LoadMarkdownTemplate(path)
+	if err != nil {
+		t.Fatalf("load template: %v", err)
+	}
+	second, err := LoadMarkdownTemplate(path)
+	if err != nil {
+		t.Fatalf("load template: %v", err)
+	}
+	if first != second {
+		t.Fatal("expected cached template to be reused")
+	}
+
+	if err := os.WriteFile(path, []byte(`{{define "footer"}}v2{{end}}`), 0644); err != nil {
+		t.Fatalf("rewrite template: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("touch template: %v", err)
+	}
+	third, err := LoadMarkdownTemplate(path)
+	if err != nil {
+		t.Fatalf("load template: %v", err)
+	}
+	if third == first {
+		t.Fatal("expected changed template to be reparsed")
+	}
+}
@@ -0,0 +1,297 @@
+package south2md
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// CatalogFileName is the store's index of its threads under the store root,
+// so threads can be filtered and paged without reading every thread dir.
+const CatalogFileName = "catalog.json"
+
+// catalogVersion is bumped whenever CatalogEntry gains a field; a catalog
+// written with another version is rebuilt from the thread dirs.
+const catalogVersion = 4
+
+// catalogLockName is the store lock taken around catalog updates. It can't
+// clash with a TID.
+const catalogLockName = ".catalog"
+
+// catalogMu serializes catalog updates within the process; the catalog
+// store lock serializes them across processes.
+var catalogMu sync.Mutex
+
+// CatalogEntry summarizes one stored thread.
+type CatalogEntry struct {
+	TID          string    `json:"tid"`
+	Title        string    `json:"title"`
+	URL          string    `json:"url"`
+	Forum        string    `json:"forum,omitempty"`
+	Prefixes     []string  `json:"prefixes,omitempty"`
+	Tags         []string  `json:"tags,omitempty"`
+	Views        int       `json:"views,omitempty"`
+	ReplyCount   int       `json:"reply_count,omitempty"`
+	TotalFloors  int       `json:"total_floors"`
+	Images       int       `json:"images"`
+	MissingPages []int     `json:"missing_pages,omitempty"`
+	Pending      int       `json:"pending"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type catalogFile struct {
+	Version int            `json:"version"`
+	Threads []CatalogEntry `json:"threads"`
+}
+
+// CatalogQuery selects catalog entries. Zero fields don't filter.
+type CatalogQuery struct {
+	Forum   string    // forum section, case-insensitive
+	Tags    []string  // threads carrying every one of these tags
+	Since   time.Time // created at or after
+	Until   time.Time // created at or before
+	Pending *bool     // has downloads queued for retry (true) or none (false)
+	After   string    // cursor: only threads whose TID sorts after this one
+	Limit   int       // page size; 0 returns every match
+}
+
+// newCatalogEntry summarizes post, stored in postDir, for the catalog.
+func newCatalogEntry(post *Post, postDir string) CatalogEntry {
+	entry := CatalogEntry{
+		TID:          post.TID,
+		Title:        post.Title,
+		URL:          post.URL,
+		Forum:        post.Forum,
+		Prefixes:     post.Prefixes,
+		Tags:         post.Tags,
+		Views:        post.Views,
+		ReplyCount:   post.ReplyCount,
+		TotalFloors:  post.TotalFloors,
+		Images:       len(post.Images),
+		MissingPages: post.MissingPages,
+		CreatedAt:    post.CreatedAt,
+	}
+	if queue, err := LoadPendingQueue(postDir); err == nil {
+		entry.Pending = queue.Len()
+	}
+	return entry
+}
+
+// UpdateCatalog records post in the catalog of the store at rootDir,
+// replacing its previous entry. PostStore.Transact and UpdateTags call it
+// once a thread's metadata is written.
+func UpdateCatalog(rootDir string, post *Post) error {
+	if post == nil || post.TID == "" {
+		return fmt.Errorf("post has no tid")
+	}
+	unlock, err := lockCatalog(rootDir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	entries, err := loadCatalog(rootDir)
+	if err != nil {
+		return err
+	}
+	entry := newCatalogEntry(post, threadDir(rootDir, post.TID))
+	i, found := searchCatalog(entries, entry.TID)
+	if found {
+		entries[i] = entry
+	} else {
+		entries = slices.Insert(entries, i, entry)
+	}
+	return saveCatalog(rootDir, entries)
+}
+
+// removeFromCatalog drops the catalog entry of a deleted thread.
+func (ps *PostStore) removeFromCatalog(tid string) error {
+	unlock, err := lockCatalog(ps.rootDir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	entries, err := loadCatalog(ps.rootDir)
+	if err != nil {
+		return err
+	}
+	i, found := searchCatalog(entries, tid)
+	if !found {
+		return nil
+	}
+	return saveCatalog(ps.rootDir, slices.Delete(entries, i, i+1))
+}
+
+// refreshCatalog updates the catalog entry of tid from its committed
+// metadata. A thread without readable metadata is left out, as in a rebuild.
+func (ps *PostStore) refreshCatalog(tid string) error {
+	data, err := os.ReadFile(filepath.Join(ps.PostDir(tid), metadataFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
+	var post Post
+	if err := toml.Unmarshal(data, &post); err != nil || post.TID == "" {
+		return nil
+	}
+	return UpdateCatalog(ps.rootDir, &post)
+}
+
+// QueryCatalog returns the catalog entries of the store at rootDir matching
+// q in TID order. When q.Limit cuts the result short, next is the q.After
+// of the following page; otherwise it is empty.
+func QueryCatalog(rootDir string, q CatalogQuery) (page []CatalogEntry, next string, err error) {
+	unlock, err := lockCatalog(rootDir)
+	if err != nil {
+		return nil, "", err
+	}
+	entries, err := loadCatalog(rootDir)
+	unlock()
+	if err != nil {
+		return nil, "", err
+	}
+	start := 0
+	if q.After != "" {
+		var found bool
+		if start, found = searchCatalog(entries, q.After); found {
+			start++
+		}
+	}
+	page = []CatalogEntry{}
+	for _, entry := range entries[start:] {
+		if !q.matches(entry) {
+			continue
+		}
+		if q.Limit > 0 && len(page) == q.Limit {
+			return page, page[len(page)-1].TID, nil
+		}
+		page = append(page, entry)
+	}
+	return page, "", nil
+}
+
+func (q CatalogQuery) matches(entry CatalogEntry) bool {
+	switch {
+	case q.Forum != "" && !strings.EqualFold(entry.Forum, q.Forum):
+		return false
+	case !q.Since.IsZero() && entry.CreatedAt.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && entry.CreatedAt.After(q.Until):
+		return false
+	case q.Pending != nil && *q.Pending != (entry.Pending > 0):
+		return false
+	}
+	for _, tag := range q.Tags {
+		if tag = NormalizeTag(tag); tag != "" && !slices.Contains(entry.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// searchCatalog finds the position of tid in entries, which are in TID order.
+func searchCatalog(entries []CatalogEntry, tid string) (int, bool) {
+	return slices.BinarySearchFunc(entries, tid, func(e CatalogEntry, tid string) int {
+		return CompareTIDs(e.TID, tid)
+	})
+}
+
+// CompareTIDs orders thread IDs numerically, so "9999" sorts before
+// "10000". IDs that aren't numbers sort after numeric ones, by string.
+func CompareTIDs(a, b string) int {
+	na, errA := strconv.ParseUint(a, 10, 64)
+	nb, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		return cmp.Compare(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// lockCatalog takes the catalog of rootDir for a read-modify-write, waiting
+// for other processes that hold it.
+func lockCatalog(rootDir string) (unlock func(), err error) {
+	catalogMu.Lock()
+	lock, err := NewPostStore(rootDir).lock(catalogLockName, -1)
+	if err != nil {
+		catalogMu.Unlock()
+		return nil, err
+	}
+	return func() {
+		lock.Unlock()
+		catalogMu.Unlock()
+	}, nil
+}
+
+// loadCatalog reads the catalog of rootDir, rebuilding it from the thread
+// dirs when it is missing or was written by another catalog version.
+func loadCatalog(rootDir string) ([]CatalogEntry, error) {
+	data, err := os.ReadFile(filepath.Join(rootDir, CatalogFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return rebuildCatalog(rootDir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %w", err)
+	}
+	var file catalogFile
+	if err := json.Unmarshal(data, &file); err != nil || file.Version != catalogVersion {
+		return rebuildCatalog(rootDir)
+	}
+	return file.Threads, nil
+}
+
+// rebuildCatalog indexes every thread dir under rootDir and saves the
+// result.
+func rebuildCatalog(rootDir string) ([]CatalogEntry, error) {
+	dirs, err := os.ReadDir(rootDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store: %w", err)
+	}
+	var entries []CatalogEntry
+	for _, dir := range dirs {
+		if !dir.IsDir() || strings.HasPrefix(dir.Name(), ".") {
+			continue
+		}
+		postDir := filepath.Join(rootDir, dir.Name())
+		data, err := os.ReadFile(filepath.Join(postDir, metadataFileName))
+		if err != nil {
+			continue // not a stored thread
+		}
+		var post Post
+		if err := toml.Unmarshal(data, &post); err != nil || post.TID == "" {
+			continue
+		}
+		entries = append(entries, newCatalogEntry(&post, postDir))
+	}
+	slices.SortFunc(entries, func(a, b CatalogEntry) int { return CompareTIDs(a.TID, b.TID) })
+	if err := saveCatalog(rootDir, entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func saveCatalog(rootDir string, entries []CatalogEntry) error {
+	data, err := json.Marshal(catalogFile{Version: catalogVersion, Threads: entries})
+	if err != nil {
+		return fmt.Errorf("failed to encode catalog: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(rootDir, CatalogFileName), append(data, '\n'))
+}
@@ -0,0 +1,140 @@
+package south2md_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	main "github.com/fdkevin0/south2md"
+)
+
+func catalogTIDs(entries []main.CatalogEntry) []string {
+	tids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		tids = append(tids, entry.TID)
+	}
+	return tids
+}
+
+func TestQueryCatalogFiltersAndPagesInNumericOrder(t *testing.T) {
+	root := t.TempDir()
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	posts := []*main.Post{
+		{TID: "10000", Title: "c", Forum: "Talk", CreatedAt: day.AddDate(0, 0, 2)},
+		{TID: "9999", Title: "b", Forum: "talk", CreatedAt: day.AddDate(0, 0, 1)},
+		{TID: "123", Title: "a", Forum: "News", CreatedAt: day},
+		{TID: "20000", Title: "d", Forum: "talk", CreatedAt: day.AddDate(0, 0, 3)},
+	}
+	for _, post := range posts {
+		if err := main.UpdateCatalog(root, post); err != nil {
+			t.Fatalf("update catalog %s: %v", post.TID, err)
+		}
+	}
+	// Re-storing a thread replaces its entry instead of adding another.
+	if err := main.UpdateCatalog(root, &main.Post{TID: "9999", Title: "b2", Forum: "talk", CreatedAt: day.AddDate(0, 0, 1)}); err != nil {
+		t.Fatalf("update catalog: %v", err)
+	}
+
+	all, next, err := main.QueryCatalog(root, main.CatalogQuery{})
+	if err != nil {
+		t.Fatalf("query catalog: %v", err)
+	}
+	if got := catalogTIDs(all); !slices.Equal(got, []string{"123", "9999", "10000", "20000"}) || next != "" {
+		t.Fatalf("unexpected catalog order: %v next=%q", got, next)
+	}
+	if all[1].Title != "b2" {
+		t.Fatalf("expected replaced entry, got %+v", all[1])
+	}
+
+	q := main.CatalogQuery{Forum: "TALK", Since: day.AddDate(0, 0, 1), Limit: 2}
+	page, next, err := main.QueryCatalog(root, q)
+	if err != nil {
+		t.Fatalf("query first page: %v", err)
+	}
+	if got := catalogTIDs(page); !slices.Equal(got, []string{"9999", "10000"}) || next != "10000" {
+		t.Fatalf("unexpected first page: %v next=%q", got, next)
+	}
+	q.After = next
+	page, next, err = main.QueryCatalog(root, q)
+	if err != nil {
+		t.Fatalf("query second page: %v", err)
+	}
+	if got := catalogTIDs(page); !slices.Equal(got, []string{"20000"}) || next != "" {
+		t.Fatalf("unexpected second page: %v next=%q", got, next)
+	}
+
+	page, _, err = main.QueryCatalog(root, main.CatalogQuery{Until: day})
+	if err != nil {
+		t.Fatalf("query until: %v", err)
+	}
+	if got := catalogTIDs(page); !slices.Equal(got, []string{"123"}) {
+		t.Fatalf("unexpected until result: %v", got)
+	}
+}
+
+func TestQueryCatalogRebuildsFromThreadDirs(t *testing.T) {
+	root := t.TempDir()
+	for _, post := range []*main.Post{{TID: "10000", Title: "b"}, {TID: "9999", Title: "a"}} {
+		dir := filepath.Join(root, post.TID)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		metadata, err := toml.Marshal(post)
+		if err != nil {
+			t.Fatalf("marshal metadata: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "metadata.toml"), metadata, 0644); err != nil {
+			t.Fatalf("write metadata: %v", err)
+		}
+	}
+
+	page, _, err := main.QueryCatalog(root, main.CatalogQuery{})
+	if err != nil {
+		t.Fatalf("query catalog: %v", err)
+	}
+	if got := catalogTIDs(page); !slices.Equal(got, []string{"9999", "10000"}) {
+		t.Fatalf("unexpected rebuilt catalog: %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, main.CatalogFileName)); err != nil {
+		t.Fatalf("expected rebuilt catalog to be saved: %v", err)
+	}
+}
+
+func TestQueryCatalogFiltersByPendingDownloads(t *testing.T) {
+	root := t.TempDir()
+	queue := main.NewPendingQueue()
+	queue.Add(main.PendingKindImage, "https://example.com/a.jpg", errors.New("timeout"))
+	if err := queue.Save("2", filepath.Join(root, "2")); err != nil {
+		t.Fatalf("save pending: %v", err)
+	}
+	for _, tid := range []string{"1", "2"} {
+		if err := main.UpdateCatalog(root, &main.Post{TID: tid}); err != nil {
+			t.Fatalf("update catalog %s: %v", tid, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		pending bool
+		want    []string
+	}{{true, []string{"2"}}, {false, []string{"1"}}} {
+		page, _, err := main.QueryCatalog(root, main.CatalogQuery{Pending: &tc.pending})
+		if err != nil {
+			t.Fatalf("query catalog: %v", err)
+		}
+		if got := catalogTIDs(page); !slices.Equal(got, tc.want) {
+			t.Fatalf("pending=%v: got %v, want %v", tc.pending, got, tc.want)
+		}
+	}
+	all, _, err := main.QueryCatalog(root, main.CatalogQuery{})
+	if err != nil {
+		t.Fatalf("query catalog: %v", err)
+	}
+	if all[1].Pending != 1 {
+		t.Fatalf("expected one pending download for thread 2, got %+v", all[1])
+	}
+}
@@ -0,0 +1,182 @@
+package south2md
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+)
+
+// CloudLink is a Baidu Pan or Lanzou share link of a floor with the access
+// code (提取码) posted next to it.
+type CloudLink struct {
+	Provider string `toml:"provider"`       // 网盘分类(baidu-pan/lanzou)
+	URL      string `toml:"url"`            // 分享链接
+	Code     string `toml:"code,omitempty"` // 提取码(未找到为空)
+	Floor    string `toml:"floor"`          // 所在楼层
+	PostID   string `toml:"post_id"`        // 所在楼层的PostID
+}
+
+// cloudLinkProviders are the link categories whose shares take an access
+// code, with the names used in post.md.
+var cloudLinkProviders = map[string]string{
+	LinkCategoryBaiduPan: "百度网盘",
+	LinkCategoryLanzou:   "蓝奏云",
+}
+
+// cloudURLPattern matches share links written as plain text instead of an
+// anchor.
+var cloudURLPattern = regexp.MustCompile(`https?://[A-Za-z0-9.-]+/[^\s<>"'，。；）)]+`)
+
+// cloudCodePattern matches an access code label and its code, e.g.
+// "提取码: abcd", "密码：1x2y" or "pwd=abcd".
+var cloudCodePattern = regexp.MustCompile(`(?i)(?:提取码|提取碼|访问码|訪問碼|密码|密碼|\bpwd|\bcode)\s*[:：=]?\s*([A-Za-z0-9]{3,8})\b`)
+
+// ExtractCloudLinks returns the Baidu Pan and Lanzou links of every floor of
+// post in thread order, each at most once per floor. Links inside quotes
+// belong to the quoted floor and are skipped.
+func ExtractCloudLinks(post *Post) []CloudLink {
+	var links []CloudLink
+	for i, entry := range postFloors(post) {
+		links = append(links, floorCloudLinks(entry, floorLabel(i, entry))...)
+	}
+	return links
+}
+
+// cloudLinkSpan is a share link found in a floor's text, at [start, end).
+type cloudLinkSpan struct {
+	link       CloudLink
+	start, end int
+}
+
+// floorCloudLinks extracts the share links of one floor labelled floor. The
+// access code is taken from the link's pwd parameter, else from the text
+// after the link up to the next share link, else from the text before it
+// unless the previous link took its code from there.
+func floorCloudLinks(entry *PostEntry, floor string) []CloudLink {
+	content := strings.ToLower(entry.HTMLContent)
+	if !strings.Contains(content, "baidu") && !strings.Contains(content, "lanzou") && !strings.Contains(content, "woozooo") {
+		return nil
+	}
+	root := parseFragment(entry.HTMLContent)
+	inQuote := make(map[*html.Node]bool)
+	if selector, err := compileSelector(quoteSelector); err == nil {
+		for _, n := range selector.MatchAll(root) {
+			inQuote[n] = true
+		}
+	}
+
+	var text strings.Builder
+	var spans []cloudLinkSpan
+	seen := make(map[string]bool)
+	add := func(rawURL string, start, end int) {
+		link, ok := newCloudLink(rawURL)
+		if !ok || seen[link.URL] {
+			return
+		}
+		seen[link.URL] = true
+		link.Floor = floor
+		link.PostID = entry.PostID
+		spans = append(spans, cloudLinkSpan{link: link, start: start, end: end})
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if inQuote[n] {
+			return
+		}
+		switch {
+		case n.Type == html.ElementNode && n.Data == "a":
+			start := text.Len()
+			text.WriteString(htmlquery.InnerText(n))
+			add(htmlquery.SelectAttr(n, "href"), start, text.Len())
+			return
+		case n.Type == html.ElementNode && (n.Data == "br" || n.Data == "p" || n.Data == "div"):
+			text.WriteString("\n")
+		case n.Type == html.TextNode:
+			start := text.Len()
+			text.WriteString(n.Data)
+			for _, loc := range cloudURLPattern.FindAllStringIndex(n.Data, -1) {
+				add(n.Data[loc[0]:loc[1]], start+loc[0], start+loc[1])
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+
+	all := text.String()
+	links := make([]CloudLink, 0, len(spans))
+	consumed := false
+	for i, span := range spans {
+		before := all[:span.start]
+		if i > 0 {
+			before = all[spans[i-1].end:span.start]
+		}
+		after := all[span.end:]
+		if i+1 < len(spans) {
+			after = all[span.end:spans[i+1].start]
+		}
+		tookAfter := false
+		if span.link.Code == "" {
+			if span.link.Code = accessCode(after); span.link.Code != "" {
+				tookAfter = true
+			} else if !consumed {
+				span.link.Code = accessCode(before)
+			}
+		}
+		consumed = tookAfter
+		links = append(links, span.link)
+	}
+	return links
+}
+
+// newCloudLink returns the share link of rawURL, or false when it isn't a
+// Baidu Pan or Lanzou link.
+func newCloudLink(rawURL string) (CloudLink, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return CloudLink{}, false
+	}
+	provider := LinkCategory(u.Hostname())
+	if _, ok := cloudLinkProviders[provider]; !ok {
+		return CloudLink{}, false
+	}
+	link := CloudLink{Provider: provider, URL: u.String()}
+	if pwd := u.Query().Get("pwd"); pwd != "" {
+		link.Code = pwd
+	}
+	return link, true
+}
+
+// accessCode returns the first access code labelled in text, or "".
+func accessCode(text string) string {
+	if m := cloudCodePattern.FindStringSubmatch(text); len(m) == 2 {
+		return m[1]
+	}
+	return ""
+}
+
+// FormatCloudLinks renders the floor's Baidu Pan and Lanzou links as a list
+// with their access codes, or "" when the floor has none.
+func (mf *MarkdownFormatter) FormatCloudLinks(entry PostEntry) string {
+	links := floorCloudLinks(&entry, entry.Floor)
+	if len(links) == 0 {
+		return ""
+	}
+
+	var md strings.Builder
+	md.WriteString("**网盘链接**\n")
+	for _, link := range links {
+		code := "未找到提取码"
+		if link.Code != "" {
+			code = fmt.Sprintf("提取码: `%s`", link.Code)
+		}
+		fmt.Fprintf(&md, "\n- %s · <%s> · %s", cloudLinkProviders[link.Provider], link.URL, code)
+	}
+	return md.String()
+}
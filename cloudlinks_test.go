@@ -0,0 +1,59 @@
+package south2md_test
+
+import (
+	"strings"
+	"testing"
+
+	main "github.com/fdkevin0/south2md"
+)
+
+func cloudLinkTestPost() *main.Post {
+	return &main.Post{
+		TID:      "100",
+		Title:    "cloud",
+		MainPost: main.PostEntry{Floor: "GF", PostID: "tpc", HTMLContent: `链接：<a href="https://pan.baidu.com/s/1AbCd">https://pan.baidu.com/s/1AbCd</a> 提取码：x7k2 复制这段内容后打开百度网盘手机App<br>备用 https://wwi.lanzoux.com/iXyZ12 密码:6a3f`},
+		Replies: []main.PostEntry{
+			{Floor: "B1F", PostID: "201", HTMLContent: `https://pan.baidu.com/s/1Q9?pwd=ab12 和 <a href="https://pan.baidu.com/s/1R0">另一个</a><br>无码 https://lanzouw.com/iNone`},
+			{Floor: "B2F", PostID: "202", HTMLContent: `<blockquote class="blockquote">https://pan.baidu.com/s/1AbCd 提取码：x7k2</blockquote>谢谢 <a href="https://example.com/">blog</a> code: zzzz`},
+		},
+	}
+}
+
+func TestExtractCloudLinks(t *testing.T) {
+	var got []string
+	for _, link := range main.ExtractCloudLinks(cloudLinkTestPost()) {
+		got = append(got, link.Floor+" "+link.Provider+" "+link.URL+" "+link.Code)
+	}
+	want := []string{
+		"GF baidu-pan https://pan.baidu.com/s/1AbCd x7k2",
+		"GF lanzou https://wwi.lanzoux.com/iXyZ12 6a3f",
+		"B1F baidu-pan https://pan.baidu.com/s/1Q9?pwd=ab12 ab12",
+		"B1F baidu-pan https://pan.baidu.com/s/1R0 ",
+		"B1F lanzou https://lanzouw.com/iNone ",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected cloud links:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestGenerateMarkdownAnnotatesCloudLinks(t *testing.T) {
+	g := main.NewMarkdownGenerator(&main.MarkdownOptions{}, nil)
+	g.SetDownloadEnabled(false)
+	md, err := g.GenerateMarkdown(cloudLinkTestPost())
+	if err != nil {
+		t.Fatalf("GenerateMarkdown returned error: %v", err)
+	}
+	for _, want := range []string{
+		"**网盘链接**",
+		"- 百度网盘 · <https://pan.baidu.com/s/1AbCd> · 提取码: `x7k2`",
+		"- 蓝奏云 · <https://wwi.lanzoux.com/iXyZ12> · 提取码: `6a3f`",
+		"- 百度网盘 · <https://pan.baidu.com/s/1R0> · 未找到提取码",
+	} {
+		if !strings.Contains(md, want) {
+			t.Fatalf("expected %q in:\n%s", want, md)
+		}
+	}
+	if n := strings.Count(md, "**网盘链接**"); n != 2 {
+		t.Fatalf("expected the quoting floor without a cloud link list, got %d lists:\n%s", n, md)
+	}
+}
@@ -10,56 +10,214 @@ type Config struct {
 	TID     string `toml:"tid" mapstructure:"tid"`           // 帖子ID(用于在线抓取)
 	BaseURL string `toml:"base_url" mapstructure:"base_url"` // 论坛基础URL
 
+	Site  string                `toml:"site" mapstructure:"site"`   // 使用的站点配置名(为空时按帖子链接的主机推断)
+	Sites map[string]SiteConfig `toml:"sites" mapstructure:"sites"` // 站点配置([sites.<name>]: base_url/cookie_file/user_agent/selector_profile)
+
+	ThreadsParallel int  `toml:"threads_parallel" mapstructure:"threads_parallel"` // 批量抓取多个帖子时同时处理的帖子数
+	StreamExtract   bool `toml:"stream" mapstructure:"stream"`                     // 逐页流式提取楼层并暂存到磁盘，限制超长帖子的内存占用
+
 	// 输出配置
-	OutputFile string `toml:"output_file" mapstructure:"output_file"` // 输出Markdown文件路径
-	CacheDir   string `toml:"cache_dir" mapstructure:"cache_dir"`     // 附件缓存目录
+	OutputFile   string `toml:"output_file" mapstructure:"output_file"`       // 输出Markdown文件路径
+	OutputFormat string `toml:"format" mapstructure:"format"`                 // 导出格式(markdown/logseq/joplin/hugo/pdf)
+	HugoSection  string `toml:"hugo_section" mapstructure:"hugo_section"`     // hugo导出的内容分区(content/<section>)
+	GitCommit    bool   `toml:"git_commit" mapstructure:"git_commit"`         // 把导出目录作为git仓库，每次导出后提交帖子的改动
+	CacheDir     string `toml:"cache_dir" mapstructure:"cache_dir"`           // 附件缓存目录
+	SaveHTML     bool   `toml:"save_html" mapstructure:"save_html"`           // 是否保存原始HTML到<tid>/raw/page-N.html
+	SaveHTMLGzip bool   `toml:"save_html_gzip" mapstructure:"save_html_gzip"` // 原始HTML是否gzip压缩保存
+
+	// 解析配置
+	SelectorProfile string                     `toml:"selector_profile" mapstructure:"selector_profile"` // 使用的选择器配置名(默认south-plus)
+	Selectors       map[string]SelectorProfile `toml:"selectors" mapstructure:"selectors"`               // 自定义选择器配置([selectors.<name>])
+	Filters         []FilterRule               `toml:"filters" mapstructure:"filters"`                   // 入库前应用的内容过滤/脱敏规则([[filters]])
 
 	// HTTP请求配置
-	HTTPTimeout          time.Duration     `toml:"timeout" mapstructure:"timeout"`                     // 请求超时时间
-	HTTPUserAgent        string            `toml:"user_agent" mapstructure:"user_agent"`               // User-Agent
-	HTTPMaxRetries       int               `toml:"max_retries" mapstructure:"max_retries"`             // 最大重试次数
-	HTTPRetryDelay       time.Duration     `toml:"retry_delay" mapstructure:"retry_delay"`             // 重试间隔
-	HTTPMaxConcurrent    int               `toml:"max_concurrent" mapstructure:"max_concurrent"`       // 最大并发数
-	HTTPStrictPagination bool              `toml:"strict_pagination" mapstructure:"strict_pagination"` // 分页抓取失败是否严格报错
-	HTTPCookieFile       string            `toml:"cookie_file" mapstructure:"cookie_file"`             // Cookie文件路径
-	HTTPEnableCookie     bool              `toml:"enable_cookie" mapstructure:"enable_cookie"`         // 是否启用Cookie
-	HTTPCustomHeaders    map[string]string `toml:"custom_headers" mapstructure:"custom_headers"`       // 自定义请求头
+	HTTPTimeout             time.Duration     `toml:"timeout" mapstructure:"timeout"`                             // 请求超时时间
+	HTTPUserAgent           string            `toml:"user_agent" mapstructure:"user_agent"`                       // User-Agent
+	HTTPMaxRetries          int               `toml:"max_retries" mapstructure:"max_retries"`                     // 最大重试次数
+	HTTPRetryDelay          time.Duration     `toml:"retry_delay" mapstructure:"retry_delay"`                     // 重试间隔
+	HTTPMaxConcurrent       int               `toml:"max_concurrent" mapstructure:"max_concurrent"`               // 最大并发数(论坛页面)
+	HTTPMaxConcurrentAssets int               `toml:"max_concurrent_assets" mapstructure:"max_concurrent_assets"` // 每个图片/附件主机的最大并发数
+	HTTPMaxConcurrentGofile int               `toml:"max_concurrent_gofile" mapstructure:"max_concurrent_gofile"` // gofile主机的最大并发数
+	HTTPHostConcurrency     map[string]int    `toml:"host_concurrency" mapstructure:"host_concurrency"`           // 按主机覆盖的并发数(含子域名)
+	HTTPPoliteness          string            `toml:"politeness" mapstructure:"politeness"`                       // 礼貌抓取配置(default/polite)
+	HTTPStrictPagination    bool              `toml:"strict_pagination" mapstructure:"strict_pagination"`         // 分页抓取失败是否严格报错(否则跳过并记录到 missing_pages)
+	HTTPPagination          string            `toml:"pagination" mapstructure:"pagination"`                       // 分页发现方式(total/next)
+	HTTPCookieFile          string            `toml:"cookie_file" mapstructure:"cookie_file"`                     // Cookie文件路径
+	HTTPEnableCookie        bool              `toml:"enable_cookie" mapstructure:"enable_cookie"`                 // 是否启用Cookie
+	HTTPFollowCookieUA      bool              `toml:"follow_cookie_ua" mapstructure:"follow_cookie_ua"`           // 使用导入Cookie时记录的User-Agent
+	HTTPAllowGuest          bool              `toml:"allow_guest" mapstructure:"allow_guest"`                     // Cookie失效时仅保存游客可见内容而不报错
+	HTTPCustomHeaders       map[string]string `toml:"custom_headers" mapstructure:"custom_headers"`               // 自定义请求头
+	HTTPProxy               string            `toml:"proxy" mapstructure:"proxy"`                                 // 代理URL(http/https/socks5，direct禁用；为空时读取环境变量)
+	HTTPNoProxy             string            `toml:"no_proxy" mapstructure:"no_proxy"`                           // 不走代理的主机列表(同NO_PROXY格式)
+	HTTPProxyPool           []string          `toml:"proxy_pool" mapstructure:"proxy_pool"`                       // 轮换使用的代理列表(设置后优先于proxy)
+	HTTPProxyPoolFile       string            `toml:"proxy_pool_file" mapstructure:"proxy_pool_file"`             // 代理列表文件(每行一个)
+	HTTPProxyBanTime        time.Duration     `toml:"proxy_ban_time" mapstructure:"proxy_ban_time"`               // 代理被封禁(403/Cloudflare验证)后的停用时长
+	HTTPMirrors             []string          `toml:"mirrors" mapstructure:"mirrors"`                             // 主域名被封锁或无法访问时依次切换的镜像基础URL
+	HTTPTLSFingerprint      string            `toml:"tls_fingerprint" mapstructure:"tls_fingerprint"`             // 模仿的浏览器TLS指纹(chrome/firefox/safari/edge，为空使用Go默认握手)
 
 	// Markdown生成配置
-	MarkdownIncludeAuthorInfo bool   `toml:"include_author_info" mapstructure:"include_author_info"` // 是否包含作者详细信息
-	MarkdownIncludeImages     bool   `toml:"include_images" mapstructure:"include_images"`           // 是否包含图片
-	MarkdownImageStyle        string `toml:"image_style" mapstructure:"image_style"`                 // 图片显示方式(inline/reference)
-	MarkdownTableOfContents   bool   `toml:"table_of_contents" mapstructure:"table_of_contents"`     // 是否生成目录
-	MarkdownIncludeTOC        bool   `toml:"include_toc" mapstructure:"include_toc"`                 // 是否包含目录
-	MarkdownFloorNumbering    bool   `toml:"floor_numbering" mapstructure:"floor_numbering"`         // 是否显示楼层编号
+	MarkdownIncludeAuthorInfo bool    `toml:"include_author_info" mapstructure:"include_author_info"` // 是否包含作者详细信息
+	MarkdownIncludeImages     bool    `toml:"include_images" mapstructure:"include_images"`           // 是否包含图片
+	MarkdownImageStyle        string  `toml:"image_style" mapstructure:"image_style"`                 // 图片链接样式(inline/reference/figure)
+	MarkdownLineBreaks        string  `toml:"line_breaks" mapstructure:"line_breaks"`                 // 换行样式(collapse合并连续换行/spaces/backslash保留每个<br>)
+	MarkdownTableOfContents   bool    `toml:"table_of_contents" mapstructure:"table_of_contents"`     // 是否生成目录
+	MarkdownIncludeTOC        bool    `toml:"include_toc" mapstructure:"include_toc"`                 // 是否包含目录
+	MarkdownFloorNumbering    bool    `toml:"floor_numbering" mapstructure:"floor_numbering"`         // 是否显示楼层编号
+	MarkdownTOCDepth          int     `toml:"toc_depth" mapstructure:"toc_depth"`                     // 目录层级(按页分组时1只列页)
+	MarkdownTOCMaxEntries     int     `toml:"toc_max_entries" mapstructure:"toc_max_entries"`         // 目录最多列出的楼层数(0不限)
+	MarkdownTOCPageSize       int     `toml:"toc_page_size" mapstructure:"toc_page_size"`             // 目录按页分组的每页楼层数(0不分组)
+	MarkdownSplitEvery        int     `toml:"split_every" mapstructure:"split_every"`                 // 每N层拆分为一个post-NNN.md(0不拆分)
+	MarkdownPopularReplies    int     `toml:"popular_replies" mapstructure:"popular_replies"`         // 热门回复列出数量(0关闭)
+	MarkdownPopularStrategy   string  `toml:"popular_strategy" mapstructure:"popular_strategy"`       // 热门回复排序策略(quotes/length/combined)
+	MarkdownQuoteDedupe       float64 `toml:"dedupe_quotes" mapstructure:"dedupe_quotes"`             // 纯引用楼层折叠的相似度阈值(0关闭)
+	MarkdownTemplateFile      string  `toml:"template" mapstructure:"template"`                       // 自定义post.md模板文件(text/template)
+	MarkdownFrontMatter       bool    `toml:"front_matter" mapstructure:"front_matter"`               // 是否在post.md前添加YAML front matter
+	MarkdownAuthorStats       bool    `toml:"author_stats" mapstructure:"author_stats"`               // 是否在文末附上参与者统计(楼层数/首末发言/图片数)
+	MarkdownReproducible      bool    `toml:"reproducible" mapstructure:"reproducible"`               // 可复现输出(不写生成时间并排序元数据集合)
+	MarkdownThreaded          bool    `toml:"threaded" mapstructure:"threaded"`                       // 按引用关系把回复嵌套在被回复的楼层下
+	MarkdownMentionIndex      bool    `toml:"mention_index" mapstructure:"mention_index"`             // 是否在文末附上被提及用户索引(@提及和用户链接)
 
 	// 缓存配置
-	CacheEnableCache  bool  `toml:"enable_cache" mapstructure:"enable_cache"`   // 是否启用缓存
-	CacheCacheImages  bool  `toml:"cache_images" mapstructure:"cache_images"`   // 是否缓存图片
-	CacheCacheFiles   bool  `toml:"cache_files" mapstructure:"cache_files"`     // 是否缓存其他附件
-	CacheMaxFileSize  int64 `toml:"max_file_size" mapstructure:"max_file_size"` // 最大文件大小(字节)
-	CacheSkipExisting bool  `toml:"skip_existing" mapstructure:"skip_existing"` // 是否跳过已存在文件
+	CacheEnableCache    bool  `toml:"enable_cache" mapstructure:"enable_cache"`       // 是否启用缓存
+	CacheCacheImages    bool  `toml:"cache_images" mapstructure:"cache_images"`       // 是否缓存图片
+	CacheCacheFiles     bool  `toml:"cache_files" mapstructure:"cache_files"`         // 是否缓存其他附件
+	CacheMaxFileSize    int64 `toml:"max_file_size" mapstructure:"max_file_size"`     // 最大文件大小(字节)
+	CacheSkipExisting   bool  `toml:"skip_existing" mapstructure:"skip_existing"`     // 是否跳过已存在文件
+	CacheWayback        bool  `toml:"wayback" mapstructure:"wayback"`                 // 图片404/410时从archive.org快照下载
+	CacheAvatars        bool  `toml:"cache_avatars" mapstructure:"cache_avatars"`     // 下载作者头像到帖子的avatars/目录
+	CacheAuthorProfiles bool  `toml:"author_profiles" mapstructure:"author_profiles"` // 抓取作者资料页(u.php)摘要保存到authors.toml
+
+	// 图片分类配置
+	ImageClassifier string   `toml:"image_classifier" mapstructure:"image_classifier"` // 对每张新下载图片运行的分类命令(图片路径作为最后一个参数，输出的第一个词为标签)
+	ImageQuarantine []string `toml:"image_quarantine" mapstructure:"image_quarantine"` // 需要隔离到images/quarantine/的标签
+
+	// 图片过滤配置
+	ImageSkip      []string `toml:"image_skip" mapstructure:"image_skip"`             // 不下载(保留为远程链接)的图片URL正则，如表情、头像、徽章
+	ImageKeep      []string `toml:"image_keep" mapstructure:"image_keep"`             // 总是下载的图片URL正则(优先于image_skip和尺寸下限)
+	ImageMinWidth  int      `toml:"image_min_width" mapstructure:"image_min_width"`   // 网页标注宽度小于此值的图片不下载(0不限)
+	ImageMinHeight int      `toml:"image_min_height" mapstructure:"image_min_height"` // 网页标注高度小于此值的图片不下载(0不限)
+	ImageMinBytes  int64    `toml:"image_min_bytes" mapstructure:"image_min_bytes"`   // HEAD请求报告小于此字节数的图片不下载(0不发HEAD请求)
+	ImageMinPixels string   `toml:"image_min_pixels" mapstructure:"image_min_pixels"` // 下载后解码实际尺寸小于此值(宽x高，如64x64)的图片丢弃(空为不检查)
+	ImageSmallDir  string   `toml:"image_small_dir" mapstructure:"image_small_dir"`   // 小于image_min_pixels的图片另存到图片目录下的此子目录而非丢弃(空为丢弃)
+
+	// archive.org 存档配置
+	WaybackSave         bool          `toml:"wayback_save" mapstructure:"wayback_save"`                   // 抓取后把每页提交到archive.org保存快照
+	WaybackSaveInterval time.Duration `toml:"wayback_save_interval" mapstructure:"wayback_save_interval"` // 两次保存请求的最小间隔
 
 	// Gofile config
-	GofileEnable       bool   `toml:"gofile_enable" mapstructure:"gofile_enable"`               // Enable gofile downloads
-	GofileTool         string `toml:"gofile_tool" mapstructure:"gofile_tool"`                   // gofile-downloader script path
-	GofileDir          string `toml:"gofile_dir" mapstructure:"gofile_dir"`                     // gofile download directory
-	GofileToken        string `toml:"gofile_token" mapstructure:"gofile_token"`                 // gofile account token
-	GofileVenvDir      string `toml:"gofile_venv_dir" mapstructure:"gofile_venv_dir"`           // gofile virtualenv directory
-	GofileSkipExisting bool   `toml:"gofile_skip_existing" mapstructure:"gofile_skip_existing"` // Skip already downloaded content
+	GofileEnable       bool          `toml:"gofile_enable" mapstructure:"gofile_enable"`               // Enable gofile downloads
+	GofileTool         string        `toml:"gofile_tool" mapstructure:"gofile_tool"`                   // gofile-downloader script path
+	GofileDir          string        `toml:"gofile_dir" mapstructure:"gofile_dir"`                     // gofile download directory
+	GofileToken        string        `toml:"gofile_token" mapstructure:"gofile_token"`                 // gofile account token
+	GofileVenvDir      string        `toml:"gofile_venv_dir" mapstructure:"gofile_venv_dir"`           // gofile virtualenv directory
+	GofileSkipExisting bool          `toml:"gofile_skip_existing" mapstructure:"gofile_skip_existing"` // Skip already downloaded content
+	GofileCacheTTL     time.Duration `toml:"gofile_cache_ttl" mapstructure:"gofile_cache_ttl"`         // Lifetime of cached content API responses (0 disables)
+	GofileRateLimit    float64       `toml:"gofile_rate_limit" mapstructure:"gofile_rate_limit"`       // Gofile API/download requests per second (0 disables)
+	GofileMaxSize      int64         `toml:"gofile_max_size" mapstructure:"gofile_max_size"`           // Per-share byte cap above which only a manifest is recorded (0 disables)
+	GofileMaxFileSize  int64         `toml:"gofile_max_file_size" mapstructure:"gofile_max_file_size"` // Share files larger than this many bytes are skipped (0 disables)
+	GofileInclude      []string      `toml:"gofile_include" mapstructure:"gofile_include"`             // Glob patterns selecting which share files to download (empty means all)
+	GofileSelect       bool          `toml:"gofile_select" mapstructure:"gofile_select"`               // Prompt for the files to download from each share
+
+	// PDF export config
+	PDFChromePath string `toml:"chrome_path" mapstructure:"chrome_path"` // Chrome/Chromium executable used for --format=pdf (auto-detected when empty)
+
+	// WebDAV export config
+	WebDAVUsername string `toml:"webdav_username" mapstructure:"webdav_username"` // WebDAV basic auth username
+	WebDAVPassword string `toml:"webdav_password" mapstructure:"webdav_password"` // WebDAV basic auth password (prefer env SOUTH2MD_WEBDAV_PASSWORD)
+
+	// Translation config
+	TranslateBackend  string `toml:"translate" mapstructure:"translate"`                   // Translation backend (deepl/openai/libretranslate); empty disables
+	TranslateTarget   string `toml:"translate_target" mapstructure:"translate_target"`     // Target language code, also names post.<lang>.md
+	TranslateMode     string `toml:"translate_mode" mapstructure:"translate_mode"`         // translated or bilingual
+	TranslateEndpoint string `toml:"translate_endpoint" mapstructure:"translate_endpoint"` // API URL override (e.g. a self-hosted LibreTranslate)
+	TranslateModel    string `toml:"translate_model" mapstructure:"translate_model"`       // Chat model for the openai backend
+	TranslateAPIKey   string `toml:"translate_api_key" mapstructure:"translate_api_key"`   // API key (prefer env SOUTH2MD_TRANSLATE_API_KEY)
+
+	// Policy config
+	PolicyExternalAssetLimit int64 `toml:"external_asset_limit" mapstructure:"external_asset_limit"` // Estimated bytes of a thread's gofile shares above which they are recorded manifest-only; covers gofile only (0, the default, disables)
+
+	// Store config
+	StoreLockWait      time.Duration `toml:"lock_wait" mapstructure:"lock_wait"`             // Wait this long for a thread another process is writing (0 fails fast, negative waits forever)
+	StoreDirTemplate   string        `toml:"dir_template" mapstructure:"dir_template"`       // Thread directory name template using {tid} and {title}
+	StoreMaxThreadSize int64         `toml:"max_thread_size" mapstructure:"max_thread_size"` // Byte cap per thread directory; further downloads are skipped (0 disables)
+	StoreMinFreeSpace  int64         `toml:"min_free_space" mapstructure:"min_free_space"`   // Bytes to keep free on the store filesystem; downloads that would cut into it abort the thread
+
+	// Logging config
+	LogFile       string `toml:"log_file" mapstructure:"log_file"`               // Write logs to this file instead of stderr (empty uses stderr)
+	LogFormat     string `toml:"log_format" mapstructure:"log_format"`           // Log format: text or json
+	LogMaxSize    int64  `toml:"log_max_size" mapstructure:"log_max_size"`       // Rotate the log file when it exceeds this many MB (0 disables)
+	LogMaxBackups int    `toml:"log_max_backups" mapstructure:"log_max_backups"` // Rotated log files to keep
+	RecordHAR     string `toml:"record_har" mapstructure:"record_har"`           // Write the run's HTTP exchanges to this HAR file (empty disables)
+	FixturesDir   string `toml:"fixtures_dir" mapstructure:"fixtures_dir"`       // Replay responses from fixture files in this directory instead of the network (development)
+	JSONProgress  bool   `toml:"json_progress" mapstructure:"json_progress"`     // Write progress events as newline-delimited JSON to stdout instead of text
+
+	// Metrics config
+	MetricsAddr  string `toml:"metrics" mapstructure:"metrics"`             // Listen address for the Prometheus /metrics endpoint (empty disables)
+	OTelEndpoint string `toml:"otel_endpoint" mapstructure:"otel_endpoint"` // OTLP/HTTP endpoint traces are exported to, e.g. http://localhost:4318 (empty disables)
+
+	// API config (south2md serve)
+	APIAddr  string `toml:"api_addr" mapstructure:"api_addr"`   // Listen address of the control API
+	APIToken string `toml:"api_token" mapstructure:"api_token"` // Bearer token every API request must send (empty allows loopback addresses only)
+
+	// Telegram bot config (south2md serve)
+	TelegramToken string   `toml:"telegram_token" mapstructure:"telegram_token"` // Bot token; enables the bot (prefer env SOUTH2MD_TELEGRAM_TOKEN)
+	TelegramUsers []string `toml:"telegram_users" mapstructure:"telegram_users"` // User IDs or @usernames allowed to submit threads
+
+	// Hook config: shell commands run with SOUTH2MD_HOOK_* variables describing the thread
+	HookOnThreadArchived string `toml:"on_thread_archived" mapstructure:"on_thread_archived"` // Run after a thread is stored (and exported)
+	HookOnUpdate         string `toml:"on_update" mapstructure:"on_update"`                   // Run after a stored thread gained new floors
+	HookOnError          string `toml:"on_error" mapstructure:"on_error"`                     // Run when archiving a thread fails
 }
 
 // HTTPOptions HTTP请求配置
 type HTTPOptions struct {
-	Timeout          time.Duration     `toml:"timeout"`
-	UserAgent        string            `toml:"user_agent"`
-	MaxRetries       int               `toml:"max_retries"`
-	RetryDelay       time.Duration     `toml:"retry_delay"`
-	MaxConcurrent    int               `toml:"max_concurrent"`
-	StrictPagination bool              `toml:"strict_pagination"`
-	CookieFile       string            `toml:"cookie_file"`
-	EnableCookie     bool              `toml:"enable_cookie"`
-	CustomHeaders    map[string]string `toml:"custom_headers"`
+	Timeout       time.Duration `toml:"timeout"`
+	UserAgent     string        `toml:"user_agent"`
+	MaxRetries    int           `toml:"max_retries"`
+	RetryDelay    time.Duration `toml:"retry_delay"`
+	MaxConcurrent int           `toml:"max_concurrent"`
+	// HostLimits bounds in-flight requests per host (and its subdomains).
+	HostLimits map[string]int `toml:"host_limits"`
+	// DefaultHostLimit bounds in-flight requests to each host not in
+	// HostLimits; 0 means unlimited.
+	DefaultHostLimit int  `toml:"default_host_limit"`
+	StrictPagination bool `toml:"strict_pagination"`
+	// Pagination selects how the pages of a thread are discovered
+	// (PaginationTotal or PaginationNext); "" means PaginationTotal.
+	Pagination   string `toml:"pagination"`
+	CookieFile   string `toml:"cookie_file"`
+	EnableCookie bool   `toml:"enable_cookie"`
+	// AllowGuest archives the guest-visible content when the forum ignores
+	// the loaded login cookie instead of failing with an AuthError.
+	AllowGuest bool `toml:"allow_guest"`
+	// FollowCookieUserAgent sends the User-Agent recorded with the imported
+	// cookies instead of UserAgent; otherwise a mismatch is only logged.
+	FollowCookieUserAgent bool              `toml:"follow_cookie_user_agent"`
+	CustomHeaders         map[string]string `toml:"custom_headers"`
+	// Proxy overrides HTTP(S)_PROXY/ALL_PROXY; "direct" disables proxying.
+	Proxy string `toml:"proxy"`
+	// NoProxy overrides NO_PROXY.
+	NoProxy string `toml:"no_proxy"`
+	// ProxyPool rotates requests over these proxies instead of Proxy.
+	ProxyPool []string `toml:"proxy_pool"`
+	// ProxyBanTime is how long a pooled proxy is skipped after a ban.
+	ProxyBanTime time.Duration `toml:"proxy_ban_time"`
+	// Mirrors are base URLs of forum mirrors tried in order once the base
+	// URL (or the previous mirror) is blocked or unreachable.
+	Mirrors []string `toml:"mirrors"`
+	// TLSFingerprint imitates the TLS ClientHello of a browser (one of
+	// TLSFingerprints) on direct HTTPS connections to TLSFingerprintHosts;
+	// "" uses Go's own.
+	TLSFingerprint string `toml:"tls_fingerprint"`
+	// TLSFingerprintHosts are the forum hosts TLSFingerprint applies to.
+	// Requests to other hosts (image CDNs, gofile) keep Go's handshake.
+	TLSFingerprintHosts []string `toml:"tls_fingerprint_hosts"`
+	// HAR records every exchange of the clients built from these options;
+	// nil records nothing.
+	HAR *HARRecorder `toml:"-"`
+	// FixturesDir answers all requests from the fixture files under it (see
+	// FixturePath) instead of the network.
+	FixturesDir string `toml:"fixtures_dir"`
 }
 
 // MarkdownOptions Markdown生成选项
@@ -70,32 +228,84 @@ type MarkdownOptions struct {
 	TableOfContents   bool   `toml:"table_of_contents"`
 	IncludeTOC        bool   `toml:"include_toc"`
 	FloorNumbering    bool   `toml:"floor_numbering"`
+	// LineBreaks writes every <br> as a "spaces" or "backslash" hard break
+	// and keeps blank lines; "collapse" (or "") merges runs of them into
+	// paragraph breaks.
+	LineBreaks string `toml:"line_breaks"`
+	// TOCDepth limits TOC nesting when grouped per page (1 = pages only).
+	TOCDepth int `toml:"toc_depth"`
+	// TOCMaxEntries caps the number of floors listed in the TOC; 0 lists all.
+	TOCMaxEntries int `toml:"toc_max_entries"`
+	// TOCPageSize groups TOC floors per page of that many floors; 0 disables grouping.
+	TOCPageSize int `toml:"toc_page_size"`
+	// PopularReplies lists the top N replies after the title; 0 disables.
+	PopularReplies int `toml:"popular_replies"`
+	// PopularStrategy ranks replies by "quotes", "length" or "combined".
+	PopularStrategy string `toml:"popular_strategy"`
+	// SplitEvery writes floors into post-NNN.md files of this many floors each,
+	// with post.md as the index; 0 keeps a single file.
+	SplitEvery int `toml:"split_every"`
+	// QuoteDedupeThreshold collapses floors that only quote an earlier floor
+	// (plus a short reaction) when the quote similarity reaches it; 0 disables.
+	QuoteDedupeThreshold float64 `toml:"dedupe_quotes"`
+	// AuthorStats appends a table of the thread's participants with their
+	// floor counts, first and last floors and posted images.
+	AuthorStats bool `toml:"author_stats"`
+	// FrontMatter prepends a YAML metadata block to post.md.
+	FrontMatter bool `toml:"front_matter"`
+	// Reproducible leaves out generation timestamps and sorts the collections
+	// in metadata.toml, so identical input gives byte-identical output.
+	Reproducible bool `toml:"reproducible"`
+	// Threaded nests each reply, as a blockquote, right under the floor it
+	// quotes instead of keeping the flat floor order.
+	Threaded bool `toml:"threaded"`
+	// MentionIndex appends a table of the users floors @mention or link to,
+	// with the floors mentioning them.
+	MentionIndex bool `toml:"mention_index"`
+	// Template renders post.md; nil uses the built-in layout.
+	Template *MarkdownTemplate `toml:"-"`
 }
 
 // Default configuration values (centralized for maintainability)
 var defaultConfig = &Config{
-	BaseURL:    "https://south-plus.net/",
-	OutputFile: "post.md",
-	CacheDir:   DefaultCacheDir("south2md"),
+	BaseURL:      "https://south-plus.net/",
+	OutputFile:   "post.md",
+	OutputFormat: ExportFormatMarkdown,
+	HugoSection:  DefaultHugoSection,
+	CacheDir:     DefaultCacheDir("south2md"),
+
+	ThreadsParallel: 1,
+
+	// 解析配置
+	SelectorProfile: DefaultSelectorProfile,
 
 	// HTTP配置
-	HTTPTimeout:          30 * time.Second,
-	HTTPUserAgent:        "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/144.0.0.0 Safari/537.36",
-	HTTPMaxRetries:       3,
-	HTTPRetryDelay:       2 * time.Second,
-	HTTPMaxConcurrent:    5,
-	HTTPStrictPagination: true,
-	HTTPCookieFile:       DefaultCookieFile("south2md"),
-	HTTPEnableCookie:     true,
-	HTTPCustomHeaders:    make(map[string]string),
+	HTTPTimeout:             30 * time.Second,
+	HTTPUserAgent:           "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/144.0.0.0 Safari/537.36",
+	HTTPMaxRetries:          3,
+	HTTPRetryDelay:          2 * time.Second,
+	HTTPMaxConcurrent:       5,
+	HTTPMaxConcurrentAssets: 8,
+	HTTPMaxConcurrentGofile: 2,
+	HTTPPoliteness:          PolitenessDefault,
+	HTTPStrictPagination:    false,
+	HTTPPagination:          PaginationTotal,
+	HTTPCookieFile:          DefaultCookieFile("south2md"),
+	HTTPEnableCookie:        true,
+	HTTPFollowCookieUA:      true,
+	HTTPCustomHeaders:       make(map[string]string),
+	HTTPProxyBanTime:        DefaultProxyBanTime,
 
 	// Markdown配置
 	MarkdownIncludeAuthorInfo: true,
 	MarkdownIncludeImages:     true,
 	MarkdownImageStyle:        "inline",
+	MarkdownLineBreaks:        LineBreakCollapse,
 	MarkdownTableOfContents:   true,
 	MarkdownIncludeTOC:        true,
 	MarkdownFloorNumbering:    true,
+	MarkdownTOCDepth:          2,
+	MarkdownPopularStrategy:   PopularStrategyCombined,
 
 	// 缓存配置
 	CacheEnableCache:  true,
@@ -103,6 +313,10 @@ var defaultConfig = &Config{
 	CacheCacheFiles:   true,
 	CacheMaxFileSize:  10 * 1024 * 1024, // 10MB
 	CacheSkipExisting: true,
+	CacheWayback:      true,
+
+	// archive.org 存档配置
+	WaybackSaveInterval: 5 * time.Second,
 
 	// Gofile配置
 	GofileEnable:       true,
@@ -111,6 +325,27 @@ var defaultConfig = &Config{
 	GofileToken:        "",
 	GofileVenvDir:      "",
 	GofileSkipExisting: true,
+	GofileCacheTTL:     24 * time.Hour,
+	GofileRateLimit:    2,
+
+	// WebDAV config
+	WebDAVUsername: "",
+	WebDAVPassword: "",
+
+	// Translation config
+	TranslateTarget: "en",
+	TranslateMode:   TranslateModeTranslated,
+
+	// Store config
+	StoreDirTemplate: DefaultDirTemplate,
+
+	// Logging config
+	LogFormat:     "text",
+	LogMaxSize:    10,
+	LogMaxBackups: 3,
+
+	// API config
+	APIAddr: "127.0.0.1:8790",
 }
 
 // NewDefaultConfig 创建默认配置
@@ -124,3 +359,33 @@ func NewDefaultConfig() *Config {
 	}
 	return &config
 }
+
+// HTTPOptionsFromConfig returns the HTTP options config describes. The
+// proxy_pool_file is not read; callers append its proxies to ProxyPool.
+func HTTPOptionsFromConfig(config *Config) *HTTPOptions {
+	hostLimits, defaultHostLimit := HostConcurrencyLimits(config)
+	return &HTTPOptions{
+		Timeout:               config.HTTPTimeout,
+		UserAgent:             config.HTTPUserAgent,
+		MaxRetries:            config.HTTPMaxRetries,
+		RetryDelay:            config.HTTPRetryDelay,
+		MaxConcurrent:         config.HTTPMaxConcurrent,
+		StrictPagination:      config.HTTPStrictPagination,
+		Pagination:            config.HTTPPagination,
+		CookieFile:            config.HTTPCookieFile,
+		EnableCookie:          config.HTTPEnableCookie,
+		FollowCookieUserAgent: config.HTTPFollowCookieUA,
+		AllowGuest:            config.HTTPAllowGuest,
+		CustomHeaders:         config.HTTPCustomHeaders,
+		Proxy:                 config.HTTPProxy,
+		NoProxy:               config.HTTPNoProxy,
+		ProxyPool:             config.HTTPProxyPool,
+		ProxyBanTime:          config.HTTPProxyBanTime,
+		Mirrors:               config.HTTPMirrors,
+		TLSFingerprint:        config.HTTPTLSFingerprint,
+		TLSFingerprintHosts:   forumHosts(config),
+		FixturesDir:           config.FixturesDir,
+		HostLimits:            hostLimits,
+		DefaultHostLimit:      defaultHostLimit,
+	}
+}
@@ -16,6 +16,13 @@ import (
 const netscapeCookieHeader = "# Netscape HTTP Cookie File"
 const httpOnlyPrefix = "#HttpOnly_"
 
+// loginCookieName is the cookie the forum sets for logged-in users.
+const loginCookieName = "eb9e6_winduser"
+
+// userAgentComment records the browser User-Agent in a cookie file comment,
+// which other Netscape readers ignore.
+const userAgentComment = "# User-Agent: "
+
 // CookieManager Cookie管理器
 type CookieManager struct {
 	jar *CookieJar
@@ -51,6 +58,7 @@ func (cm *CookieManager) LoadFromFile(filepath string) error {
 	}
 
 	cm.jar.Cookies = make([]CookieEntry, 0)
+	cm.jar.UserAgent = ""
 	lines := strings.Split(string(data), "\n")
 	for _, rawLine := range lines {
 		line := strings.TrimSpace(rawLine)
@@ -58,6 +66,11 @@ func (cm *CookieManager) LoadFromFile(filepath string) error {
 			continue
 		}
 
+		if ua, ok := strings.CutPrefix(line, userAgentComment); ok {
+			cm.jar.UserAgent = strings.TrimSpace(ua)
+			continue
+		}
+
 		httpOnly := false
 		if strings.HasPrefix(line, httpOnlyPrefix) {
 			httpOnly = true
@@ -115,9 +128,9 @@ func (cm *CookieManager) LoadFromFile(filepath string) error {
 	cm.CleanExpired()
 
 	if !lo.ContainsBy(cm.jar.Cookies, func(item CookieEntry) bool {
-		return item.Name == "eb9e6_winduser"
+		return item.Name == loginCookieName
 	}) {
-		slog.Warn("User not logged in, login cookie missing", "cookie_name", "eb9e6_winduser")
+		slog.Warn("User not logged in, login cookie missing", "cookie_name", loginCookieName)
 	}
 
 	return nil
@@ -138,6 +151,9 @@ func (cm *CookieManager) SaveToFile(filepath string) error {
 	builder.WriteString(netscapeCookieHeader)
 	builder.WriteString("\n")
 	builder.WriteString("# This file was generated by south2md. Edit at your own risk.\n")
+	if cm.jar.UserAgent != "" {
+		builder.WriteString(userAgentComment + cm.jar.UserAgent + "\n")
+	}
 
 	for _, cookie := range cm.jar.Cookies {
 		if cookie.Name == "" {
@@ -193,6 +209,18 @@ func (cm *CookieManager) SaveToFile(filepath string) error {
 	return nil
 }
 
+// UserAgent returns the User-Agent of the browser the cookies were imported
+// from, or "" when unknown.
+func (cm *CookieManager) UserAgent() string {
+	return cm.jar.UserAgent
+}
+
+// SetUserAgent records the User-Agent of the browser the cookies came from.
+// Cloudflare binds cf_clearance to it, so requests must send the same one.
+func (cm *CookieManager) SetUserAgent(userAgent string) {
+	cm.jar.UserAgent = strings.TrimSpace(userAgent)
+}
+
 // AddCookie 添加Cookie
 func (cm *CookieManager) AddCookie(cookie *CookieEntry) {
 	if cookie == nil {
@@ -0,0 +1,239 @@
+package south2md
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// curlValueFlags are the curl options that consume the following argument,
+// so it isn't mistaken for the request URL.
+var curlValueFlags = map[string]bool{
+	"-X": true, "--request": true,
+	"-H": true, "--header": true,
+	"-b": true, "--cookie": true,
+	"-A": true, "--user-agent": true,
+	"-e": true, "--referer": true,
+	"-d": true, "--data": true, "--data-raw": true, "--data-binary": true, "--data-urlencode": true,
+	"-F": true, "--form": true,
+	"-u": true, "--user": true,
+	"-o": true, "--output": true,
+	"-x": true, "--proxy": true,
+	"--url": true,
+}
+
+// ParseCurlCookies extracts the cookies of a "Copy as cURL" command line, as
+// produced by browser dev tools. Cookies come from -b/--cookie and from
+// -H/--header "Cookie: ..." options and are scoped to the host of the
+// command's URL.
+func ParseCurlCookies(command string) ([]CookieEntry, error) {
+	cookies, _, err := parseCurlCommand(command)
+	return cookies, err
+}
+
+// parseCurlCommand returns the cookies and the User-Agent (from -A or a
+// User-Agent header, "" when absent) of a curl command line.
+func parseCurlCommand(command string) ([]CookieEntry, string, error) {
+	args, err := splitShellWords(command)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(args) > 0 && (args[0] == "curl" || strings.HasSuffix(args[0], "/curl") || strings.EqualFold(args[0], "curl.exe")) {
+		args = args[1:]
+	}
+
+	var rawURL, userAgent string
+	var cookieHeaders []string
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := splitCurlOption(args[i])
+		if !hasValue && curlValueFlags[name] {
+			if i+1 >= len(args) {
+				return nil, "", fmt.Errorf("curl option %s is missing its value", name)
+			}
+			i++
+			value, hasValue = args[i], true
+		}
+
+		switch {
+		case name == "-b" || name == "--cookie":
+			if !strings.Contains(value, "=") {
+				return nil, "", fmt.Errorf("curl %s %q reads a cookie file, import it with --file instead", name, value)
+			}
+			cookieHeaders = append(cookieHeaders, value)
+		case name == "-H" || name == "--header":
+			key, header, ok := strings.Cut(value, ":")
+			switch {
+			case !ok:
+			case strings.EqualFold(strings.TrimSpace(key), "cookie"):
+				cookieHeaders = append(cookieHeaders, header)
+			case strings.EqualFold(strings.TrimSpace(key), "user-agent"):
+				userAgent = strings.TrimSpace(header)
+			}
+		case name == "-A" || name == "--user-agent":
+			userAgent = value
+		case name == "--url":
+			rawURL = value
+		case !hasValue && !strings.HasPrefix(name, "-") && rawURL == "":
+			rawURL = name
+		}
+	}
+
+	if rawURL == "" {
+		return nil, "", fmt.Errorf("curl command has no URL")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return nil, "", fmt.Errorf("invalid URL in curl command: %q", rawURL)
+	}
+	if len(cookieHeaders) == 0 {
+		return nil, "", fmt.Errorf("curl command has no cookies")
+	}
+
+	var cookies []CookieEntry
+	for _, header := range cookieHeaders {
+		for _, pair := range strings.Split(header, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || strings.TrimSpace(name) == "" {
+				continue
+			}
+			cookies = append(cookies, CookieEntry{
+				Name:   strings.TrimSpace(name),
+				Value:  strings.TrimSpace(value),
+				Domain: u.Hostname(),
+				Path:   "/",
+				Secure: u.Scheme == "https",
+			})
+		}
+	}
+	return cookies, userAgent, nil
+}
+
+// LoadFromCurl adds the cookies of a curl command line (see ParseCurlCookies)
+// and records the command's User-Agent, if any.
+func (cm *CookieManager) LoadFromCurl(command string) error {
+	cookies, userAgent, err := parseCurlCommand(command)
+	if err != nil {
+		return err
+	}
+	for i := range cookies {
+		cm.AddCookie(&cookies[i])
+	}
+	if userAgent != "" {
+		cm.SetUserAgent(userAgent)
+	}
+	return nil
+}
+
+// splitCurlOption splits "--name=value" and "-Xvalue" forms. Other arguments
+// are returned as the name without a value.
+func splitCurlOption(arg string) (name, value string, hasValue bool) {
+	if strings.HasPrefix(arg, "--") {
+		if name, value, ok := strings.Cut(arg, "="); ok {
+			return name, value, true
+		}
+		return arg, "", false
+	}
+	if len(arg) > 2 && arg[0] == '-' && curlValueFlags[arg[:2]] {
+		return arg[:2], arg[2:], true
+	}
+	return arg, "", false
+}
+
+// splitShellWords splits a POSIX shell command line into words, honouring
+// single quotes, double quotes with backslash escapes, bash $'...' quoting
+// and backslash-newline continuations.
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\':
+			if i+1 >= len(runes) {
+				return nil, fmt.Errorf("unterminated escape at end of command")
+			}
+			i++
+			if runes[i] == '\n' {
+				continue
+			}
+			word.WriteRune(runes[i])
+			inWord = true
+		case r == '\'':
+			end := indexRune(runes, i+1, '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			word.WriteString(string(runes[i+1 : end]))
+			i, inWord = end, true
+		case r == '$' && i+1 < len(runes) && runes[i+1] == '\'':
+			end, err := readANSICQuoted(runes, i+2, &word)
+			if err != nil {
+				return nil, err
+			}
+			i, inWord = end, true
+		case r == '"':
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`\n", runes[i+1]) {
+					i++
+					if runes[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// readANSICQuoted decodes the body of a $'...' string starting at runes[start]
+// into word and returns the index of the closing quote.
+func readANSICQuoted(runes []rune, start int, word *strings.Builder) (int, error) {
+	escapes := map[rune]rune{'n': '\n', 't': '\t', 'r': '\r', '\\': '\\', '\'': '\'', '"': '"'}
+	for i := start; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '\'':
+			return i, nil
+		case r == '\\' && i+1 < len(runes):
+			i++
+			if decoded, ok := escapes[runes[i]]; ok {
+				word.WriteRune(decoded)
+			} else {
+				word.WriteRune('\\')
+				word.WriteRune(runes[i])
+			}
+		default:
+			word.WriteRune(r)
+		}
+	}
+	return 0, fmt.Errorf("unterminated $'...' quote")
+}
+
+func indexRune(runes []rune, from int, target rune) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == target {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,70 @@
+package south2md
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCurlCookies(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    map[string]string
+	}{
+		{
+			name: "chrome bash copy with header",
+			command: `curl 'https://south-plus.net/read.php?tid-1.html' \
+  -H 'accept: text/html' \
+  -H 'cookie: eb9e6_winduser=abc%3D; cf_clearance=x.y-z' \
+  --compressed`,
+			want: map[string]string{"eb9e6_winduser": "abc%3D", "cf_clearance": "x.y-z"},
+		},
+		{
+			name:    "long cookie option with equals and escaped quotes",
+			command: `curl --cookie="a=1; b=\"two\"" --header "X-Test: 1" --url https://south-plus.net/`,
+			want:    map[string]string{"a": "1", "b": `"two"`},
+		},
+		{
+			name:    "ansi-c quoting and attached short option",
+			command: `curl -X GET -b$'session=it\'s' -A 'Mozilla/5.0' https://south-plus.net/`,
+			want:    map[string]string{"session": "it's"},
+		},
+		{
+			name:    "data value is not the URL",
+			command: `curl --data-raw 'https://example.com' https://south-plus.net/post -H "Cookie: k=v"`,
+			want:    map[string]string{"k": "v"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cookies, err := ParseCurlCookies(tt.command)
+			if err != nil {
+				t.Fatalf("ParseCurlCookies returned error: %v", err)
+			}
+			got := make(map[string]string)
+			for _, cookie := range cookies {
+				if cookie.Domain != "south-plus.net" || cookie.Path != "/" || !cookie.Secure {
+					t.Fatalf("unexpected cookie scope: %+v", cookie)
+				}
+				got[cookie.Name] = cookie.Value
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("cookies = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCurlCookiesErrors(t *testing.T) {
+	for command, want := range map[string]string{
+		`curl https://south-plus.net/`:                   "no cookies",
+		`curl -H 'Cookie: a=1'`:                          "no URL",
+		`curl -b cookies.txt https://south-plus.net/`:    "cookie file",
+		`curl 'https://south-plus.net/ -H 'Cookie: a=1'`: "unterminated",
+	} {
+		if _, err := ParseCurlCookies(command); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseCurlCookies(%q) error = %v, want %q", command, err, want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package south2md
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+)
+
+// quoteSelector matches phpwind quote blocks inside a floor's HTML.
+const quoteSelector = "blockquote, .blockquote, .quote"
+
+// maxReactionRunes is the longest non-quoted remainder ("+1", "同求") a floor
+// may have and still be collapsed as a pure quote reaction.
+const maxReactionRunes = 20
+
+var quoteHeaderPattern = regexp.MustCompile(`^引用(第\d+楼.*?发表的[:：]?)?`)
+
+// collapseQuoteFloors finds floors that consist only of a verbatim quote of an
+// earlier floor plus a short reaction, and returns replacement markdown keyed
+// by entry index (0 is the main post). It returns nil when dedupe is disabled.
+func (g *MarkdownGenerator) collapseQuoteFloors(post *Post, entries []PostEntry) map[int]string {
+	threshold := g.formatter.options.QuoteDedupeThreshold
+	if threshold <= 0 || len(entries) < 2 {
+		return nil
+	}
+
+	plain := make([]string, len(entries))
+	collapsed := make(map[int]string)
+	for i, entry := range entries {
+		quoted, rest, hasQuote := splitQuotedHTML(entry.HTMLContent)
+		plain[i] = normalizeQuoteText(rest)
+		if !hasQuote || i == 0 || len([]rune(plain[i])) > maxReactionRunes {
+			continue
+		}
+
+		quoted = quoteHeaderPattern.ReplaceAllString(normalizeQuoteText(quoted), "")
+		best, bestScore := -1, 0.0
+		for j := 0; j < i; j++ {
+			if score := diceSimilarity(quoted, plain[j]); score > bestScore {
+				best, bestScore = j, score
+			}
+		}
+		if best < 0 || bestScore < threshold {
+			continue
+		}
+
+		target := entries[best]
+		floor := target.Floor
+		if best == 0 {
+			floor = "0"
+		}
+		ref := fmt.Sprintf("> *已折叠对 [%s](#pid%s) 的完整引用*", floor, target.PostID)
+		if reaction := strings.TrimSpace(collapseWhitespace(rest)); reaction != "" {
+			ref += "\n\n" + reaction
+		}
+		collapsed[i] = ref
+	}
+
+	if len(collapsed) > 0 {
+		g.summary.RecordDecision(PolicyDecision{
+			Policy: "quote_dedupe",
+			Scope:  post.TID,
+			Action: "collapsed",
+			Reason: fmt.Sprintf("%d floors only quoted an earlier floor (threshold %.2f)", len(collapsed), threshold),
+		})
+	}
+	return collapsed
+}
+
+// splitQuotedHTML separates the text inside quote blocks from the rest of a
+// floor. hasQuote is false when the floor contains no quote.
+func splitQuotedHTML(htmlContent string) (quoted, rest string, hasQuote bool) {
+	quotes, rest := splitQuoteNodes(htmlContent)
+	var quotedText strings.Builder
+	for _, n := range quotes {
+		quotedText.WriteString(htmlquery.InnerText(n))
+	}
+	return quotedText.String(), rest, len(quotes) > 0
+}
+
+// splitQuoteNodes parses a floor's HTML and returns its outermost quote
+// blocks, detached, and the text outside them.
+func splitQuoteNodes(htmlContent string) ([]*html.Node, string) {
+	root := parseFragment(htmlContent)
+	if !strings.Contains(htmlContent, "quote") {
+		return nil, htmlquery.InnerText(root)
+	}
+	selector, err := compileSelector(quoteSelector)
+	if err != nil {
+		return nil, htmlquery.InnerText(root)
+	}
+
+	matches := selector.MatchAll(root)
+	inQuote := make(map[*html.Node]bool, len(matches))
+	for _, n := range matches {
+		inQuote[n] = true
+	}
+	var quotes []*html.Node
+	for _, n := range matches {
+		nested := false
+		for p := n.Parent; p != nil; p = p.Parent {
+			if inQuote[p] {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			n.Parent.RemoveChild(n)
+			quotes = append(quotes, n)
+		}
+	}
+	return quotes, htmlquery.InnerText(root)
+}
+
+func parseFragment(htmlContent string) *html.Node {
+	root, err := html.Parse(strings.NewReader(htmlContent))
+	if err != nil {
+		return &html.Node{Type: html.DocumentNode}
+	}
+	return root
+}
+
+// normalizeQuoteText drops whitespace so re-wrapped quotes still compare equal.
+func normalizeQuoteText(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+func collapseWhitespace(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// diceSimilarity is the Sørensen–Dice coefficient over rune bigrams, which is
+// cheap enough for long floors and tolerant of small edits.
+func diceSimilarity(a, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	ar, br := []rune(a), []rune(b)
+	if len(ar) < 2 || len(br) < 2 {
+		return 0
+	}
+
+	bigrams := make(map[[2]rune]int, len(ar)-1)
+	for i := 0; i < len(ar)-1; i++ {
+		bigrams[[2]rune{ar[i], ar[i+1]}]++
+	}
+	overlap := 0
+	for i := 0; i < len(br)-1; i++ {
+		key := [2]rune{br[i], br[i+1]}
+		if bigrams[key] > 0 {
+			bigrams[key]--
+			overlap++
+		}
+	}
+	return 2 * float64(overlap) / float64(len(ar)-1+len(br)-1)
+}
@@ -0,0 +1,59 @@
+package south2md_test
+
+import (
+	"strings"
+	"testing"
+
+	main "github.com/fdkevin0/south2md"
+)
+
+func TestGenerateMarkdownCollapsesQuoteOnlyFloors(t *testing.T) {
+	original := "这次的汉化质量非常高，翻译和嵌字都很用心，感谢各位大佬的付出"
+	post := &main.Post{
+		TID:      "100",
+		Title:    "quotes",
+		MainPost: main.PostEntry{Floor: "GF", PostID: "tpc", HTMLContent: "<p>main post</p>"},
+		Replies: []main.PostEntry{
+			{Floor: "B1F", PostID: "201", HTMLContent: original},
+			{Floor: "B2F", PostID: "202", HTMLContent: `<blockquote class="blockquote">引用第1楼bob于2024-01-01 10:00发表的 :<br>` + original + `</blockquote>+1`},
+			{Floor: "B3F", PostID: "203", HTMLContent: `<blockquote class="blockquote">` + original + `</blockquote>我不同意这个看法，嵌字其实有不少问题，比如第三页的字体`},
+		},
+	}
+
+	g := main.NewMarkdownGenerator(&main.MarkdownOptions{QuoteDedupeThreshold: 0.9}, nil)
+	g.SetDownloadEnabled(false)
+	md, err := g.GenerateMarkdown(post)
+	if err != nil {
+		t.Fatalf("GenerateMarkdown returned error: %v", err)
+	}
+
+	if !strings.Contains(md, "> *已折叠对 [B1F](#pid201) 的完整引用*\n\n+1") {
+		t.Fatalf("expected B2F collapsed to a reference, got:\n%s", md)
+	}
+	if strings.Count(md, original) != 2 {
+		t.Fatalf("expected original text in B1F and non-reaction B3F only, got:\n%s", md)
+	}
+	if len(g.Summary().Decisions()) != 1 {
+		t.Fatalf("expected one quote_dedupe decision, got %v", g.Summary().Decisions())
+	}
+}
+
+func TestGenerateMarkdownKeepsQuotesWhenDedupeDisabled(t *testing.T) {
+	post := &main.Post{
+		TID:      "100",
+		MainPost: main.PostEntry{Floor: "GF", PostID: "tpc", HTMLContent: "<p>hello world</p>"},
+		Replies: []main.PostEntry{
+			{Floor: "B1F", PostID: "201", HTMLContent: `<blockquote>hello world</blockquote>+1`},
+		},
+	}
+
+	g := main.NewMarkdownGenerator(&main.MarkdownOptions{}, nil)
+	g.SetDownloadEnabled(false)
+	md, err := g.GenerateMarkdown(post)
+	if err != nil {
+		t.Fatalf("GenerateMarkdown returned error: %v", err)
+	}
+	if strings.Contains(md, "已折叠") {
+		t.Fatalf("expected no collapsing when disabled, got:\n%s", md)
+	}
+}
@@ -0,0 +1,95 @@
+package south2md
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DeltaFilter selects the floors of a "what's new" digest of a followed
+// thread. A floor must pass both conditions.
+type DeltaFilter struct {
+	SinceFloor int       // floors numbered above this; the main post is floor 0, negative keeps all
+	SinceDate  time.Time // floors posted after this; zero keeps all
+}
+
+// DeltaTimeFormats are the layouts ParseDeltaTime accepts, besides RFC 3339.
+var DeltaTimeFormats = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// ParseDeltaTime parses a --since-date value. Like floor post times, which
+// are the forum's wall clock, a value without offset is read as UTC.
+func ParseDeltaTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range DeltaTimeFormats {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use YYYY-MM-DD, YYYY-MM-DD HH:MM[:SS] or RFC 3339)", value)
+}
+
+// FloorNumber returns the number of a floor label: 0 for the main post (GF)
+// and n for B<n>F. ok is false for labels of another shape.
+func FloorNumber(label string) (n int, ok bool) {
+	if label == "GF" {
+		return 0, true
+	}
+	if !strings.HasPrefix(label, "B") || !strings.HasSuffix(label, "F") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(label[1 : len(label)-1])
+	return n, err == nil && n > 0
+}
+
+// Keep reports whether the floor at index i of a post, 0 being the main
+// post, passes the filter. Floors with an unusual label are numbered by
+// their position.
+func (f DeltaFilter) Keep(i int, entry PostEntry) bool {
+	number, ok := FloorNumber(entry.Floor)
+	if !ok {
+		number = i
+	}
+	if f.SinceFloor >= 0 && number <= f.SinceFloor {
+		return false
+	}
+	return f.SinceDate.IsZero() || entry.PostTime.After(f.SinceDate)
+}
+
+// GenerateDelta renders the floors of post that filter keeps as one markdown
+// document, without front matter or author appendix, and returns the number
+// of floors it holds. Local image links point into imageDir when it is set,
+// e.g. the stored thread's images directory, so the digest can be written
+// anywhere.
+func (g *MarkdownGenerator) GenerateDelta(post *Post, filter DeltaFilter, imageDir string) (string, int, error) {
+	entries, err := g.renderEntries(post)
+	if err != nil {
+		return "", 0, err
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		if filter.Keep(e.Index, e.Entry) {
+			if imageDir != "" {
+				e.Content = g.rewriteLocalImageLinks(e.Content, func(file string) string {
+					return path.Join(imageDir, file)
+				})
+			}
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) == 0 {
+		return "", 0, nil
+	}
+	kept = g.arrangeEntries(post, kept)
+
+	doc, err := g.newTemplateDocument(post, kept, false)
+	if err != nil {
+		return "", 0, err
+	}
+	markdown, err := g.formatter.FormatDocument(doc)
+	return markdown, len(kept), err
+}
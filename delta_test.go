@@ -0,0 +1,65 @@
+package south2md_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/fdkevin0/south2md"
+)
+
+func TestGenerateDelta(t *testing.T) {
+	day := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	post := &main.Post{
+		TID:      "100",
+		Title:    "followed",
+		MainPost: main.PostEntry{Floor: "GF", PostID: "tpc", HTMLContent: "<p>main</p>", PostTime: day},
+	}
+	for i, floor := range []string{"B1F", "B2F", "B3F", "B4F"} {
+		post.Replies = append(post.Replies, main.PostEntry{Floor: floor, PostID: floor, HTMLContent: "<p>reply " + floor + "</p>", PostTime: day.AddDate(0, 0, i+1)})
+	}
+	g := main.NewMarkdownGenerator(&main.MarkdownOptions{}, nil)
+	g.SetDownloadEnabled(false)
+
+	markdown, count, err := g.GenerateDelta(post, main.DeltaFilter{SinceFloor: 2}, "")
+	if err != nil {
+		t.Fatalf("GenerateDelta returned error: %v", err)
+	}
+	if count != 2 || !strings.Contains(markdown, "reply B3F") || !strings.Contains(markdown, "reply B4F") ||
+		strings.Contains(markdown, "reply B2F") || strings.Contains(markdown, "main") {
+		t.Fatalf("expected B3F and B4F only, got %d floors:\n%s", count, markdown)
+	}
+
+	since, err := main.ParseDeltaTime("2026-10-03 12:00")
+	if err != nil {
+		t.Fatalf("ParseDeltaTime returned error: %v", err)
+	}
+	_, count, err = g.GenerateDelta(post, main.DeltaFilter{SinceFloor: -1, SinceDate: since}, "")
+	if err != nil || count != 2 {
+		t.Fatalf("expected the floors posted after %s, got %d (%v)", since, count, err)
+	}
+	_, count, err = g.GenerateDelta(post, main.DeltaFilter{SinceFloor: 3, SinceDate: since}, "")
+	if err != nil || count != 1 {
+		t.Fatalf("expected both conditions to apply, got %d (%v)", count, err)
+	}
+	markdown, count, err = g.GenerateDelta(post, main.DeltaFilter{SinceFloor: 4}, "")
+	if err != nil || count != 0 || markdown != "" {
+		t.Fatalf("expected an empty digest, got %d floors %q (%v)", count, markdown, err)
+	}
+	if _, err := main.ParseDeltaTime("yesterday"); err == nil {
+		t.Fatal("expected an invalid time to be rejected")
+	}
+}
+
+func TestFloorNumber(t *testing.T) {
+	for label, want := range map[string]int{"GF": 0, "B1F": 1, "B120F": 120} {
+		if got, ok := main.FloorNumber(label); !ok || got != want {
+			t.Fatalf("FloorNumber(%q) = %d, %v; want %d", label, got, ok, want)
+		}
+	}
+	for _, label := range []string{"", "B0F", "BxF", "12"} {
+		if _, ok := main.FloorNumber(label); ok {
+			t.Fatalf("expected FloorNumber(%q) to fail", label)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !windows
+
+package south2md
+
+// Platforms without a free space query skip the disk space check.
+func diskFree(dir string) (int64, error) { return 0, errDiskFreeUnsupported }
@@ -0,0 +1,126 @@
+package south2md
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrSizeLimit reports a download skipped because it would exceed a
+// configured size cap. Such downloads are not queued for retry.
+var ErrSizeLimit = errors.New("download size limit exceeded")
+
+var errDiskFreeUnsupported = errors.New("free disk space query not supported on this platform")
+
+// DiskSpaceError reports a download refused because it would leave less than
+// the reserved free space on the destination filesystem. It aborts the
+// thread being stored instead of filling the disk with partial files.
+type DiskSpaceError struct {
+	Dir     string // Destination directory
+	Need    int64  // Bytes the download needs
+	Free    int64  // Bytes available on the filesystem
+	Reserve int64  // Bytes that must stay free
+}
+
+func (e *DiskSpaceError) Error() string {
+	return fmt.Sprintf("not enough disk space in %s: need %s, %s free, %s reserved",
+		e.Dir, FormatByteSize(e.Need), FormatByteSize(e.Free), FormatByteSize(e.Reserve))
+}
+
+// DownloadGuard enforces the per-thread size cap and the free space reserve
+// shared by image, attachment and gofile downloads. It is safe for
+// concurrent use; a nil guard allows everything.
+type DownloadGuard struct {
+	maxThreadSize int64 // bytes per thread directory; 0 means no limit
+	minFreeSpace  int64 // bytes kept free on the destination filesystem
+
+	mu   sync.Mutex
+	used map[string]int64 // bytes per thread directory, seeded from disk
+}
+
+// NewDownloadGuard creates a guard capping each thread directory at
+// maxThreadSize bytes (0 means no limit) and refusing downloads that would
+// leave less than minFreeSpace bytes free.
+func NewDownloadGuard(maxThreadSize, minFreeSpace int64) *DownloadGuard {
+	return &DownloadGuard{
+		maxThreadSize: maxThreadSize,
+		minFreeSpace:  minFreeSpace,
+		used:          make(map[string]int64),
+	}
+}
+
+// Reserve accounts size bytes about to be written into the thread directory
+// dir. It fails with ErrSizeLimit when the thread would outgrow its cap and
+// with a *DiskSpaceError when the filesystem would run short. Callers
+// Release the bytes again when the download fails.
+func (g *DownloadGuard) Reserve(dir string, size int64) error {
+	if g == nil || size <= 0 {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	used, seen := g.used[dir]
+	if !seen {
+		// Staged thread dirs link the live files, so this counts what the
+		// thread already holds.
+		used, _ = dirSize(dir)
+		g.used[dir] = used
+	}
+	if g.maxThreadSize > 0 && used+size > g.maxThreadSize {
+		return fmt.Errorf("%w: %s would grow the thread to %s, above the limit %s",
+			ErrSizeLimit, FormatByteSize(size), FormatByteSize(used+size), FormatByteSize(g.maxThreadSize))
+	}
+
+	existing := nearestExistingDir(dir)
+	if free, err := diskFree(existing); err == nil && free-size < g.minFreeSpace {
+		return &DiskSpaceError{Dir: existing, Need: size, Free: free, Reserve: g.minFreeSpace}
+	}
+	g.used[dir] = used + size
+	return nil
+}
+
+// Release returns size bytes reserved for dir after a failed download.
+func (g *DownloadGuard) Release(dir string, size int64) {
+	if g == nil || size <= 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if used, ok := g.used[dir]; ok {
+		g.used[dir] = max(0, used-size)
+	}
+}
+
+// forget drops the accounting of dir so the next Reserve measures it again,
+// e.g. after the store staged a fresh copy of the thread.
+func (g *DownloadGuard) forget(dir string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.used, dir)
+}
+
+// nearestExistingDir returns dir or its closest existing ancestor, which is
+// on the filesystem dir will be created on.
+func nearestExistingDir(dir string) string {
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// sizeLimitError reports what exceeding the per-file limit.
+func sizeLimitError(what string, limit int64) error {
+	return fmt.Errorf("%w: %s exceeds the per-file limit %s", ErrSizeLimit, what, FormatByteSize(limit))
+}
@@ -0,0 +1,137 @@
+package south2md
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadGuardThreadSizeCap(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "100")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "existing.jpg"), make([]byte, 60), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	guard := NewDownloadGuard(100, 0)
+	if err := guard.Reserve(dir, 30); err != nil {
+		t.Fatalf("Reserve within the cap: %v", err)
+	}
+	// 60 bytes on disk plus 30 reserved leave room for 10 more.
+	if err := guard.Reserve(dir, 20); !errors.Is(err, ErrSizeLimit) {
+		t.Fatalf("expected ErrSizeLimit, got %v", err)
+	}
+	guard.Release(dir, 30)
+	if err := guard.Reserve(dir, 20); err != nil {
+		t.Fatalf("Reserve after Release: %v", err)
+	}
+}
+
+func TestDownloadGuardRefusesToFillTheDisk(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing", "100")
+	if _, err := diskFree(nearestExistingDir(dir)); err != nil {
+		t.Skipf("free space query unavailable: %v", err)
+	}
+
+	err := NewDownloadGuard(0, 1<<62).Reserve(dir, 1)
+	var diskErr *DiskSpaceError
+	if !errors.As(err, &diskErr) {
+		t.Fatalf("expected a DiskSpaceError, got %v", err)
+	}
+	if diskErr.Dir == dir || !strings.Contains(err.Error(), "not enough disk space") {
+		t.Fatalf("expected the check to run on an existing ancestor, got %v", err)
+	}
+
+	var nilGuard *DownloadGuard
+	if err := nilGuard.Reserve(dir, 1<<40); err != nil {
+		t.Fatalf("a nil guard should allow everything, got %v", err)
+	}
+}
+
+func TestImageHandlerSkipsOversizedImages(t *testing.T) {
+	doer := &stubDoer{body: "image-bytes"}
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "100", "images"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	h := NewImageHandler("images")
+	h.SetRootDir(root)
+	h.SetHTTPDoer(doer)
+	h.SetDownloadLimits(4, nil)
+	h.pending = NewPendingQueue()
+
+	post := &Post{}
+	got, err := h.DownloadAndCacheImages("100", []byte("![a](https://img.example.com/a.jpg)"), post)
+	if err != nil {
+		t.Fatalf("DownloadAndCacheImages returned error: %v", err)
+	}
+	if !strings.Contains(string(got), "https://img.example.com/a.jpg") || len(post.Images) != 0 {
+		t.Fatalf("expected the oversized image to stay remote, got %q, %+v", got, post.Images)
+	}
+	if h.pending.Len() != 0 {
+		t.Fatal("expected an oversized image not to be queued for retry")
+	}
+}
+
+func TestImageHandlerAbortsWhenDiskIsFull(t *testing.T) {
+	root := t.TempDir()
+	if _, err := diskFree(root); err != nil {
+		t.Skipf("free space query unavailable: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "100", "images"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	h := NewImageHandler("images")
+	h.SetRootDir(root)
+	h.SetHTTPDoer(&stubDoer{body: "image-bytes"})
+	h.SetDownloadLimits(0, NewDownloadGuard(0, 1<<62))
+
+	_, err := h.DownloadAndCacheImages("100", []byte("![a](https://img.example.com/a.jpg)"), &Post{})
+	var diskErr *DiskSpaceError
+	if !errors.As(err, &diskErr) {
+		t.Fatalf("expected a DiskSpaceError, got %v", err)
+	}
+}
+
+func TestDownloadGofileMaxFileSizeSkipsLargeFiles(t *testing.T) {
+	var downloads []string
+	handler := newSelectionTestHandler(t, &downloads)
+	handler.maxFileSize = 100
+
+	post := &Post{TID: "42"}
+	if _, err := handler.DownloadAndAnnotateGofileLinks("42", []byte("https://gofile.io/d/share1"), post); err != nil {
+		t.Fatalf("DownloadAndAnnotateGofileLinks failed: %v", err)
+	}
+	if len(downloads) != 1 || downloads[0] != "https://store/a.zip" {
+		t.Fatalf("expected only a.zip to be downloaded, got %v", downloads)
+	}
+	if len(post.GofileFiles) != 1 || len(post.GofileFiles[0].Skipped) != 1 || post.GofileFiles[0].Skipped[0].Path != "b.txt" {
+		t.Fatalf("expected b.txt to be recorded as skipped, got %+v", post.GofileFiles)
+	}
+}
+
+func TestDownloadGofileThreadSizeCapSkipsRemainingFiles(t *testing.T) {
+	var downloads []string
+	handler := newSelectionTestHandler(t, &downloads)
+	handler.SetDownloadGuard(NewDownloadGuard(100, 0))
+
+	post := &Post{TID: "42"}
+	if _, err := handler.DownloadAndAnnotateGofileLinks("42", []byte("https://gofile.io/d/share1"), post); err != nil {
+		t.Fatalf("DownloadAndAnnotateGofileLinks failed: %v", err)
+	}
+	for _, link := range downloads {
+		if link == "https://store/b.txt" {
+			t.Fatalf("expected b.txt to exceed the thread cap, got %v", downloads)
+		}
+	}
+	if len(post.GofileFiles) != 1 || len(post.GofileFiles[0].Skipped) != 1 {
+		t.Fatalf("expected the capped file to be recorded as skipped, got %+v", post.GofileFiles)
+	}
+	if decisions := handler.summary.Decisions(); len(decisions) != 1 || decisions[0].Policy != "max_thread_size" {
+		t.Fatalf("expected a max_thread_size decision, got %+v", decisions)
+	}
+}
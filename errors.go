@@ -1,6 +1,7 @@
 package south2md
 
 import (
+	"errors"
 	"fmt"
 )
 
@@ -28,6 +29,9 @@ const (
 
 	// DownloadError represents download-related errors
 	DownloadError ErrorType = "download_error"
+
+	// MaintenanceError represents the forum serving its maintenance page
+	MaintenanceError ErrorType = "maintenance_error"
 )
 
 // AppError represents a structured application error
@@ -90,6 +94,22 @@ func NewAuthError(message string, err error) *AppError {
 	}
 }
 
+// NewMaintenanceError creates an error for a forum maintenance window
+func NewMaintenanceError(message string) *AppError {
+	return &AppError{
+		Type:    MaintenanceError,
+		Message: message,
+		Code:    "MAINT001",
+	}
+}
+
+// IsMaintenanceError reports whether err (or any error it wraps) is a
+// maintenance window error, so callers can back off instead of failing.
+func IsMaintenanceError(err error) bool {
+	var appErr *AppError
+	return errors.As(err, &appErr) && appErr.Type == MaintenanceError
+}
+
 // NewIOError creates a new I/O error
 func NewIOError(message string, err error) *AppError {
 	return &AppError{
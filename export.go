@@ -0,0 +1,201 @@
+package south2md
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Export formats supported by the CLI --format flag.
+const (
+	ExportFormatMarkdown = "markdown"
+	ExportFormatLogseq   = "logseq"
+	ExportFormatJoplin   = "joplin"
+	ExportFormatHugo     = "hugo"
+	ExportFormatPDF      = "pdf"
+)
+
+// ExportFormats lists all supported export formats.
+var ExportFormats = []string{
+	ExportFormatMarkdown,
+	ExportFormatLogseq,
+	ExportFormatJoplin,
+	ExportFormatHugo,
+	ExportFormatPDF,
+}
+
+// IsValidExportFormat reports whether format is a supported export format.
+func IsValidExportFormat(format string) bool {
+	for _, f := range ExportFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// renderedEntry is one floor rendered to markdown with localized assets.
+type renderedEntry struct {
+	Entry   PostEntry
+	Index   int
+	Floor   string
+	Header  string
+	Content string
+	Depth   int // nesting under the floor it replies to, when threaded
+}
+
+// renderEntries renders every floor of post in display order. Image links in
+// Content point to "images/<file>" relative to the post directory.
+//
+// Floors are converted to markdown concurrently, then the images of all
+// floors are downloaded as one batch before the floors are assembled in
+// order; gofile links and attachments are still handled floor by floor.
+func (g *MarkdownGenerator) renderEntries(post *Post) ([]renderedEntry, error) {
+	g.normalizePost(post)
+	g.gofileHandler.Preflight(post)
+
+	all := append([]PostEntry{post.MainPost}, post.Replies...)
+	collapsed := g.collapseQuoteFloors(post, all)
+	converted, err := convertEntries(all, collapsed, g.formatter.options.LineBreaks)
+	if err != nil {
+		return nil, err
+	}
+
+	var imageURLs []string
+	seen := make(map[string]bool)
+	for i, markdown := range converted {
+		if _, ok := collapsed[i]; ok || !hasEntryContent(all[i]) {
+			continue
+		}
+		for _, imageURL := range g.imageHandler.extractRemoteImageURLs([]byte(markdown)) {
+			if !seen[imageURL] {
+				seen[imageURL] = true
+				imageURLs = append(imageURLs, imageURL)
+			}
+		}
+	}
+	mapping, err := g.imageHandler.cacheImages(post.TID, imageURLs, post)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download and cache images: %w", err)
+	}
+
+	entries := make([]renderedEntry, 0, len(all))
+	for i, entry := range all {
+		floor := entry.Floor
+		if i == 0 {
+			floor = "0"
+		}
+		content, ok := collapsed[i]
+		if !ok {
+			content = converted[i]
+		}
+		if !ok && hasEntryContent(entry) {
+			md2 := g.imageHandler.replaceImageURLs(post.TID, []byte(content), mapping)
+			content, err = g.formatter.finishEntryContent(post.TID, entry, md2, post, g.imageHandler, g.gofileHandler)
+			if err != nil {
+				return nil, fmt.Errorf("failed to render floor %d: %w", i, err)
+			}
+		}
+		header, err := g.formatter.FormatFloorHeader(TemplateFloor{
+			Post:    post,
+			Entry:   entry,
+			Index:   i,
+			Floor:   floor,
+			Content: content,
+		})
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, renderedEntry{
+			Entry:   entry,
+			Index:   i,
+			Floor:   floor,
+			Header:  header,
+			Content: content,
+		})
+	}
+	return entries, nil
+}
+
+// convertEntries converts the HTML of entries to markdown on all CPUs,
+// skipping the floors in collapsed, with <br>s in the lineBreaks style.
+func convertEntries(entries []PostEntry, collapsed map[int]string, lineBreaks string) ([]string, error) {
+	converted := make([]string, len(entries))
+	errs := make([]error, len(entries))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.NumCPU(), len(entries)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				converted[i], errs[i] = convertEntryHTML(entries[i], lineBreaks)
+			}
+		}()
+	}
+	for i := range entries {
+		if _, ok := collapsed[i]; !ok {
+			indexes <- i
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("failed to render floor %d: %w", i, err)
+		}
+	}
+	return converted, nil
+}
+
+// rewriteLocalImageLinks rewrites markdown image targets that point into the
+// post's images directory using fn, leaving remote links untouched.
+func (g *MarkdownGenerator) rewriteLocalImageLinks(markdown string, fn func(file string) string) string {
+	prefix := g.imageHandler.cacheDir + "/"
+	return replaceImageLinks(markdown, func(link imageLink) string {
+		text := markdown[link.Start:link.End]
+		if !strings.HasPrefix(link.Dest, prefix) {
+			return text
+		}
+		return markdown[link.Start:link.DestStart] + fn(strings.TrimPrefix(link.Dest, prefix)) + markdown[link.DestEnd:link.End]
+	})
+}
+
+// stableID derives a deterministic 32-char hex id from parts, so re-exports of
+// the same thread produce the same note/block ids.
+func stableID(parts ...string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(strings.Join(parts, "\x00"))))
+}
+
+// stableUUID formats stableID as an RFC 4122 style UUID string.
+func stableUUID(parts ...string) string {
+	id := stableID(parts...)
+	return fmt.Sprintf("%s-%s-4%s-a%s-%s", id[0:8], id[8:12], id[13:16], id[17:20], id[20:32])
+}
+
+// writeFileAtomic replaces path with data through a temp file and a rename.
+// It never writes path in place, so it is safe on files PostStore.Transact
+// hard-linked into a staging dir.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	// A temp file left by a crash may itself be hard-linked.
+	if err := os.Remove(tmp); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale temp file: %w", err)
+	}
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to finalize file: %w", err)
+	}
+	return nil
+}
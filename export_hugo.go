@@ -0,0 +1,112 @@
+package south2md
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultHugoSection is the content section used when none is configured.
+const DefaultHugoSection = "posts"
+
+// hugoFrontMatter is the TOML front matter of an exported page bundle. Custom
+// fields live under [extra] so the same bundle also builds with Zola, which
+// rejects unknown top-level keys.
+type hugoFrontMatter struct {
+	Title string    `toml:"title"`
+	Date  time.Time `toml:"date"`
+	Extra hugoExtra `toml:"extra"`
+}
+
+type hugoExtra struct {
+	TID      string   `toml:"tid"`
+	Source   string   `toml:"source,omitempty"`
+	Forum    string   `toml:"forum,omitempty"`
+	Prefixes []string `toml:"prefixes,omitempty"`
+	Author   string   `toml:"author,omitempty"`
+	Floors   int      `toml:"floors"`
+	Views    int      `toml:"views,omitempty"`
+	Replies  int      `toml:"replies,omitempty"`
+	Tags     []string `toml:"tags,omitempty"`
+}
+
+// ExportHugo writes post as a Hugo/Zola leaf bundle at
+// siteDir/content/<section>/<tid>/index.md, copying its images next to it as
+// page resources. sourceRoot is the directory holding the stored <tid>/ folder.
+func (g *MarkdownGenerator) ExportHugo(post *Post, sourceRoot, siteDir, section string) (string, error) {
+	tidDir, _, err := g.preparePostDir(post, sourceRoot)
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := g.renderEntries(post)
+	if err != nil {
+		return "", fmt.Errorf("生成Markdown失败: %v", err)
+	}
+
+	section = SanitizeRelPath(strings.TrimSpace(section))
+	if section == "" {
+		section = DefaultHugoSection
+	}
+	bundleDir := threadDir(filepath.Join(siteDir, "content", filepath.FromSlash(section)), post.TID)
+	imagesDir := filepath.Join(bundleDir, g.imageHandler.cacheDir)
+
+	copied := make(map[string]struct{})
+	var copyErr error
+	relink := func(file string) string {
+		if _, ok := copied[file]; !ok && copyErr == nil {
+			copied[file] = struct{}{}
+			if err := os.MkdirAll(imagesDir, 0755); err != nil {
+				copyErr = fmt.Errorf("failed to create images dir: %w", err)
+			} else if err := copyFile(filepath.Join(tidDir, g.imageHandler.cacheDir, file), filepath.Join(imagesDir, file)); err != nil {
+				copyErr = err
+			}
+		}
+		return g.imageHandler.cacheDir + "/" + file
+	}
+
+	date := post.CreatedAt
+	if !post.MainPost.PostTime.IsZero() {
+		date = post.MainPost.PostTime
+	}
+	frontMatter, err := formatTOMLFrontMatter(hugoFrontMatter{
+		Title: post.Title,
+		Date:  date,
+		Extra: hugoExtra{
+			TID:      post.TID,
+			Source:   post.URL,
+			Forum:    post.Forum,
+			Prefixes: post.Prefixes,
+			Author:   post.MainPost.Author.Username,
+			Floors:   len(entries),
+			Views:    post.Views,
+			Replies:  post.ReplyCount,
+			Tags:     post.Tags,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var md strings.Builder
+	md.WriteString(frontMatter)
+	md.WriteString("\n")
+	for _, e := range entries {
+		md.WriteString(e.Header)
+		md.WriteString("\n\n")
+		if e.Content != "" {
+			md.WriteString(g.rewriteLocalImageLinks(e.Content, relink))
+			md.WriteString("\n\n")
+		}
+	}
+	if copyErr != nil {
+		return "", copyErr
+	}
+
+	if err := writeFileAtomic(filepath.Join(bundleDir, "index.md"), []byte(md.String())); err != nil {
+		return "", fmt.Errorf("保存index.md失败: %v", err)
+	}
+	return bundleDir, nil
+}
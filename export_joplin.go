@@ -0,0 +1,235 @@
+package south2md
+
+import (
+	"archive/tar"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Joplin item types used in the raw (JEX) serialization format.
+const (
+	joplinTypeNote     = 1
+	joplinTypeFolder   = 2
+	joplinTypeResource = 4
+	joplinTypeTag      = 5
+	joplinTypeNoteTag  = 6
+)
+
+// joplinItem is one serialized Joplin object inside a JEX archive.
+type joplinItem struct {
+	title   string
+	body    string
+	props   [][2]string
+	noTitle bool // item types without a title/body section, e.g. note_tag
+}
+
+// jexEntry is one file inside a JEX tar archive.
+type jexEntry struct {
+	name string
+	data []byte
+}
+
+func (it joplinItem) serialize() []byte {
+	var b strings.Builder
+	if !it.noTitle {
+		b.WriteString(it.title)
+		b.WriteString("\n\n")
+	}
+	if it.body != "" {
+		b.WriteString(it.body)
+		b.WriteString("\n\n")
+	}
+	for i, prop := range it.props {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(prop[0])
+		b.WriteString(": ")
+		b.WriteString(prop[1])
+	}
+	return []byte(b.String())
+}
+
+// ExportJoplin writes post as a Joplin JEX archive at exportDir/<tid>.jex: one
+// notebook named after the thread holding a single note, with every local
+// image attached as a resource and linked via the ":/<id>" scheme.
+// sourceRoot is the directory holding the stored <tid>/ folder.
+func (g *MarkdownGenerator) ExportJoplin(post *Post, sourceRoot, exportDir string) (string, error) {
+	tidDir, _, err := g.preparePostDir(post, sourceRoot)
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := g.renderEntries(post)
+	if err != nil {
+		return "", fmt.Errorf("生成Markdown失败: %v", err)
+	}
+
+	created := joplinTime(post.CreatedAt)
+	folderID := stableID("joplin-folder", post.TID)
+	noteID := stableID("joplin-note", post.TID)
+
+	resources := make(map[string]string) // image file -> resource id
+	var resourceOrder []string
+	relink := func(file string) string {
+		id, ok := resources[file]
+		if !ok {
+			id = stableID("joplin-resource", post.TID, file)
+			resources[file] = id
+			resourceOrder = append(resourceOrder, file)
+		}
+		return ":/" + id
+	}
+
+	var body strings.Builder
+	if post.URL != "" {
+		fmt.Fprintf(&body, "Source: %s\n\n", post.URL)
+	}
+	for _, e := range entries {
+		body.WriteString(e.Header)
+		body.WriteString("\n\n")
+		if e.Content != "" {
+			body.WriteString(g.rewriteLocalImageLinks(e.Content, relink))
+			body.WriteString("\n\n")
+		}
+	}
+
+	if err := os.MkdirAll(exportDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create export dir: %w", err)
+	}
+	jexPath := filepath.Join(exportDir, SanitizePathComponent(post.TID)+".jex")
+	tmpPath := jexPath + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create jex file: %w", err)
+	}
+	defer os.Remove(tmpPath)
+
+	tw := tar.NewWriter(f)
+	writeEntry := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: post.CreatedAt,
+		}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	folder := joplinItem{
+		title: post.Title,
+		props: [][2]string{
+			{"id", folderID},
+			{"created_time", created},
+			{"updated_time", created},
+			{"type_", fmt.Sprint(joplinTypeFolder)},
+		},
+	}
+	note := joplinItem{
+		title: post.Title,
+		body:  strings.TrimRight(body.String(), "\n"),
+		props: [][2]string{
+			{"id", noteID},
+			{"parent_id", folderID},
+			{"created_time", created},
+			{"updated_time", created},
+			{"source_url", post.URL},
+			{"markup_language", "1"},
+			{"type_", fmt.Sprint(joplinTypeNote)},
+		},
+	}
+
+	items := []jexEntry{
+		{folderID + ".md", folder.serialize()},
+		{noteID + ".md", note.serialize()},
+	}
+
+	for _, tag := range post.Tags {
+		tagID := stableID("joplin-tag", tag)
+		noteTagID := stableID("joplin-note-tag", post.TID, tag)
+		tagItem := joplinItem{
+			title: tag,
+			props: [][2]string{
+				{"id", tagID},
+				{"created_time", created},
+				{"updated_time", created},
+				{"type_", fmt.Sprint(joplinTypeTag)},
+			},
+		}
+		noteTag := joplinItem{
+			noTitle: true,
+			props: [][2]string{
+				{"id", noteTagID},
+				{"note_id", noteID},
+				{"tag_id", tagID},
+				{"created_time", created},
+				{"updated_time", created},
+				{"type_", fmt.Sprint(joplinTypeNoteTag)},
+			},
+		}
+		items = append(items,
+			jexEntry{tagID + ".md", tagItem.serialize()},
+			jexEntry{noteTagID + ".md", noteTag.serialize()},
+		)
+	}
+
+	for _, file := range resourceOrder {
+		data, err := os.ReadFile(filepath.Join(tidDir, g.imageHandler.cacheDir, file))
+		if err != nil {
+			f.Close()
+			return "", fmt.Errorf("failed to read image %s: %w", file, err)
+		}
+		id := resources[file]
+		ext := strings.TrimPrefix(filepath.Ext(file), ".")
+		mimeType := mime.TypeByExtension(filepath.Ext(file))
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+		resource := joplinItem{
+			title: file,
+			props: [][2]string{
+				{"id", id},
+				{"mime", mimeType},
+				{"filename", file},
+				{"created_time", created},
+				{"updated_time", created},
+				{"file_extension", ext},
+				{"size", fmt.Sprint(len(data))},
+				{"type_", fmt.Sprint(joplinTypeResource)},
+			},
+		}
+		items = append(items,
+			jexEntry{id + ".md", resource.serialize()},
+			jexEntry{"resources/" + id + "." + ext, data},
+		)
+	}
+
+	for _, item := range items {
+		if err := writeEntry(item.name, item.data); err != nil {
+			f.Close()
+			return "", fmt.Errorf("failed to write jex entry %s: %w", item.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to finalize jex archive: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to close jex file: %w", err)
+	}
+	if err := os.Rename(tmpPath, jexPath); err != nil {
+		return "", fmt.Errorf("failed to finalize jex file: %w", err)
+	}
+	return jexPath, nil
+}
+
+func joplinTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
@@ -0,0 +1,92 @@
+package south2md
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExportLogseq writes post as a Logseq page into graphDir/pages/<tid>.md and
+// copies its images into graphDir/assets/<tid>/. Every floor becomes a
+// top-level block with a stable id:: property so it can be block-referenced.
+// sourceRoot is the directory holding the stored <tid>/ folder.
+func (g *MarkdownGenerator) ExportLogseq(post *Post, sourceRoot, graphDir string) (string, error) {
+	tidDir, _, err := g.preparePostDir(post, sourceRoot)
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := g.renderEntries(post)
+	if err != nil {
+		return "", fmt.Errorf("生成Markdown失败: %v", err)
+	}
+
+	assetsDir := threadDir(filepath.Join(graphDir, "assets"), post.TID)
+	copied := make(map[string]struct{})
+	var copyErr error
+	relink := func(file string) string {
+		if _, ok := copied[file]; !ok && copyErr == nil {
+			copied[file] = struct{}{}
+			if err := os.MkdirAll(assetsDir, 0755); err != nil {
+				copyErr = fmt.Errorf("failed to create assets dir: %w", err)
+			} else if err := copyFile(filepath.Join(tidDir, g.imageHandler.cacheDir, file), filepath.Join(assetsDir, file)); err != nil {
+				copyErr = err
+			}
+		}
+		return "../assets/" + post.TID + "/" + file
+	}
+
+	var md strings.Builder
+	fmt.Fprintf(&md, "title:: %s\n", logseqPropertyValue(post.Title))
+	fmt.Fprintf(&md, "tid:: %s\n", post.TID)
+	if post.URL != "" {
+		fmt.Fprintf(&md, "source:: %s\n", post.URL)
+	}
+	if post.Forum != "" {
+		fmt.Fprintf(&md, "forum:: %s\n", logseqPropertyValue(post.Forum))
+	}
+	if len(post.Tags) > 0 {
+		fmt.Fprintf(&md, "tags:: %s\n", logseqPropertyValue(strings.Join(post.Tags, ", ")))
+	}
+	md.WriteString("\n")
+
+	for _, e := range entries {
+		fmt.Fprintf(&md, "- **%s** %s · %s\n", e.Floor, e.Entry.Author.Username, e.Entry.PostTime.Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(&md, "  id:: %s\n", stableUUID(post.TID, e.Entry.PostID, e.Floor))
+		if e.Entry.Author.UID != "" {
+			fmt.Fprintf(&md, "  uid:: %s\n", e.Entry.Author.UID)
+		}
+		for _, block := range splitMarkdownBlocks(g.rewriteLocalImageLinks(e.Content, relink)) {
+			md.WriteString("\t- ")
+			md.WriteString(strings.ReplaceAll(block, "\n", "\n\t  "))
+			md.WriteString("\n")
+		}
+	}
+	if copyErr != nil {
+		return "", copyErr
+	}
+
+	pagePath := filepath.Join(graphDir, "pages", SanitizePathComponent(post.TID)+".md")
+	if err := writeFileAtomic(pagePath, []byte(md.String())); err != nil {
+		return "", fmt.Errorf("保存Logseq页面失败: %v", err)
+	}
+	return pagePath, nil
+}
+
+// splitMarkdownBlocks splits markdown into paragraphs separated by blank lines.
+func splitMarkdownBlocks(markdown string) []string {
+	var blocks []string
+	for _, block := range strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n\n") {
+		block = strings.Trim(block, "\n")
+		if strings.TrimSpace(block) != "" {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// logseqPropertyValue keeps property values on one line.
+func logseqPropertyValue(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
@@ -0,0 +1,195 @@
+package south2md
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// pdfChromeCandidates are the executables tried when no Chrome path is configured.
+var pdfChromeCandidates = []string{
+	"chromium",
+	"chromium-browser",
+	"google-chrome",
+	"google-chrome-stable",
+	"chrome",
+	"microsoft-edge",
+}
+
+// pdfRenderTimeout bounds a single headless print; large threads with many
+// images can take a while to lay out.
+const pdfRenderTimeout = 5 * time.Minute
+
+// pdfContentSecurityPolicy keeps the print page to its own style and images.
+const pdfContentSecurityPolicy = "default-src 'none'; img-src file: data: https: http:; style-src 'unsafe-inline'"
+
+const pdfStyle = `body{font-family:sans-serif;line-height:1.6;margin:0 1.5em}
+img{max-width:100%;height:auto}
+.title-page{page-break-after:always;padding-top:30vh;text-align:center}
+.title-page dl{display:inline-grid;grid-template-columns:auto auto;gap:.3em 1em;text-align:left}
+.title-page dt{font-weight:bold}
+.floor{border-top:1px solid #ccc;margin-top:1.5em}
+.floor h2{font-size:1.05em;color:#555}
+blockquote{border-left:3px solid #ccc;margin-left:0;padding-left:1em;color:#555}`
+
+// ExportPDF renders post to exportDir/<tid>.pdf with a headless Chrome/Chromium
+// (chromePath, or the first browser found on PATH). The document starts with a
+// title page and every floor is a heading, so the PDF outline has one bookmark
+// per floor. sourceRoot is the directory holding the stored <tid>/ folder.
+func (g *MarkdownGenerator) ExportPDF(post *Post, sourceRoot, exportDir, chromePath string) (string, error) {
+	chrome, err := findChrome(chromePath)
+	if err != nil {
+		return "", err
+	}
+
+	tidDir, _, err := g.preparePostDir(post, sourceRoot)
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := g.renderEntries(post)
+	if err != nil {
+		return "", fmt.Errorf("生成Markdown失败: %v", err)
+	}
+
+	absTidDir, err := filepath.Abs(tidDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve thread dir: %w", err)
+	}
+	// Local image links stay relative to the thread dir, so the Markdown
+	// renderer doesn't have to pass file: URLs through.
+	document, err := g.buildPrintHTML(post, entries, (&url.URL{Scheme: "file", Path: filepath.ToSlash(absTidDir) + "/"}).String())
+	if err != nil {
+		return "", err
+	}
+
+	workDir, err := os.MkdirTemp("", "south2md-pdf-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create pdf work dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	htmlPath := filepath.Join(workDir, SanitizePathComponent(post.TID)+".html")
+	if err := os.WriteFile(htmlPath, document, 0644); err != nil {
+		return "", fmt.Errorf("failed to write print html: %w", err)
+	}
+
+	if err := os.MkdirAll(exportDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create export dir: %w", err)
+	}
+	pdfPath, err := filepath.Abs(filepath.Join(exportDir, SanitizePathComponent(post.TID)+".pdf"))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve pdf path: %w", err)
+	}
+	tmpPath := pdfPath + ".tmp"
+	defer os.Remove(tmpPath)
+
+	// The page is built from forum content, so it is printed with scripts
+	// off and the browser sandbox on. Chrome refuses to start sandboxed as
+	// root, which is the usual case in containers.
+	args := []string{
+		"--headless=new",
+		"--disable-gpu",
+		"--blink-settings=scriptEnabled=false",
+		"--no-pdf-header-footer",
+		"--generate-pdf-document-outline",
+		"--user-data-dir=" + filepath.Join(workDir, "profile"),
+		"--print-to-pdf=" + tmpPath,
+	}
+	if os.Geteuid() == 0 {
+		args = append(args, "--no-sandbox")
+	}
+	args = append(args, (&url.URL{Scheme: "file", Path: filepath.ToSlash(htmlPath)}).String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), pdfRenderTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, chrome, args...)
+	slog.Debug("Rendering PDF", "chrome", chrome, "output", pdfPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", NewIOError("headless Chrome failed to print PDF", fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output))))
+	}
+	if info, err := os.Stat(tmpPath); err != nil || info.Size() == 0 {
+		return "", NewIOError("headless Chrome produced no PDF", err)
+	}
+	if err := os.Rename(tmpPath, pdfPath); err != nil {
+		return "", fmt.Errorf("failed to finalize pdf: %w", err)
+	}
+	return pdfPath, nil
+}
+
+// buildPrintHTML renders entries into a standalone, print-ready HTML document
+// whose relative links, such as local images, resolve against baseURL. Raw
+// HTML in the Markdown is left out, and the page's content security policy
+// forbids scripts, frames and plugins.
+func (g *MarkdownGenerator) buildPrintHTML(post *Post, entries []renderedEntry, baseURL string) ([]byte, error) {
+	md := goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+	var doc bytes.Buffer
+	fmt.Fprintf(&doc, "<!DOCTYPE html>\n<html lang=\"zh\">\n<head>\n<meta charset=\"utf-8\">\n<meta http-equiv=\"Content-Security-Policy\" content=\"%s\">\n<base href=\"%s\">\n<title>%s</title>\n<style>%s</style>\n</head>\n<body>\n",
+		pdfContentSecurityPolicy, html.EscapeString(baseURL), html.EscapeString(post.Title), pdfStyle)
+
+	doc.WriteString("<section class=\"title-page\">\n")
+	fmt.Fprintf(&doc, "<h1>%s</h1>\n<dl>\n", html.EscapeString(post.Title))
+	writeField := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&doc, "<dt>%s</dt><dd>%s</dd>\n", name, html.EscapeString(value))
+		}
+	}
+	writeField("TID", post.TID)
+	writeField("Forum", post.Forum)
+	writeField("Author", post.MainPost.Author.Username)
+	if !post.MainPost.PostTime.IsZero() {
+		writeField("Posted", post.MainPost.PostTime.Format("2006-01-02 15:04:05"))
+	}
+	writeField("Floors", fmt.Sprint(len(entries)))
+	writeField("Source", post.URL)
+	if !g.formatter.options.Reproducible {
+		writeField("Archived", time.Now().Format("2006-01-02 15:04:05"))
+	}
+	doc.WriteString("</dl>\n</section>\n")
+
+	for _, e := range entries {
+		fmt.Fprintf(&doc, "<section class=\"floor\">\n<h2 id=\"pid%s\">%s · %s · %s</h2>\n",
+			html.EscapeString(e.Entry.PostID),
+			html.EscapeString(e.Floor),
+			html.EscapeString(e.Entry.Author.Username),
+			e.Entry.PostTime.Format("2006-01-02 15:04:05"))
+		if e.Content != "" {
+			if err := md.Convert([]byte(e.Content), &doc); err != nil {
+				return nil, fmt.Errorf("failed to render floor %s: %w", e.Floor, err)
+			}
+		}
+		doc.WriteString("</section>\n")
+	}
+
+	doc.WriteString("</body>\n</html>\n")
+	return doc.Bytes(), nil
+}
+
+// findChrome resolves the browser used for PDF printing.
+func findChrome(chromePath string) (string, error) {
+	if chromePath != "" {
+		path, err := exec.LookPath(chromePath)
+		if err != nil {
+			return "", NewValidationError(fmt.Sprintf("chrome executable %q not found: %v", chromePath, err))
+		}
+		return path, nil
+	}
+	for _, candidate := range pdfChromeCandidates {
+		if path, err := exec.LookPath(candidate); err == nil {
+			return path, nil
+		}
+	}
+	return "", NewValidationError("no Chrome/Chromium found for PDF export; install one or set --chrome-path")
+}
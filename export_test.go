@@ -0,0 +1,292 @@
+package south2md_test
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/fdkevin0/south2md"
+)
+
+func newExportTestPost(t *testing.T, storeRoot string) *main.Post {
+	t.Helper()
+
+	post := &main.Post{
+		TID:   "100",
+		Title: "Export test",
+		URL:   "https://south-plus.net/read.php?tid-100.html",
+		Forum: "Forum",
+		MainPost: main.PostEntry{
+			Floor:       "GF",
+			Author:      main.Author{Username: "alice", UID: "1"},
+			HTMLContent: `<p>hello</p><p><img src="https://cdn.example.com/a.png"></p>`,
+			PostTime:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			PostID:      "tpc",
+		},
+		Replies: []main.PostEntry{
+			{
+				Floor:       "B1F",
+				Author:      main.Author{Username: "bob", UID: "2"},
+				HTMLContent: `<p>reply</p>`,
+				PostTime:    time.Date(2024, 1, 3, 3, 4, 5, 0, time.UTC),
+				PostID:      "200",
+			},
+		},
+		Images: []main.Image{
+			{URL: "https://cdn.example.com/a.png", Local: "a.png", Downloaded: true},
+		},
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	imagesDir := filepath.Join(storeRoot, post.TID, "images")
+	if err := os.MkdirAll(imagesDir, 0755); err != nil {
+		t.Fatalf("mkdir images: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(imagesDir, "a.png"), []byte("png"), 0644); err != nil {
+		t.Fatalf("write image: %v", err)
+	}
+	return post
+}
+
+func newExportTestGenerator() *main.MarkdownGenerator {
+	g := main.NewMarkdownGenerator(&main.MarkdownOptions{IncludeImages: true, FloorNumbering: true}, nil)
+	g.SetDownloadEnabled(false)
+	return g
+}
+
+func TestExportLogseqWritesBlocksAndAssets(t *testing.T) {
+	tmpDir := t.TempDir()
+	storeRoot := filepath.Join(tmpDir, "store")
+	post := newExportTestPost(t, storeRoot)
+	graphDir := filepath.Join(tmpDir, "graph")
+
+	pagePath, err := newExportTestGenerator().ExportLogseq(post, storeRoot, graphDir)
+	if err != nil {
+		t.Fatalf("ExportLogseq returned error: %v", err)
+	}
+	if pagePath != filepath.Join(graphDir, "pages", "100.md") {
+		t.Fatalf("unexpected page path: %s", pagePath)
+	}
+
+	data, err := os.ReadFile(pagePath)
+	if err != nil {
+		t.Fatalf("read page: %v", err)
+	}
+	page := string(data)
+	for _, want := range []string{
+		"title:: Export test\n",
+		"tid:: 100\n",
+		"- **0** alice",
+		"- **B1F** bob",
+		"](../assets/100/a.png)",
+	} {
+		if !strings.Contains(page, want) {
+			t.Fatalf("expected page to contain %q, got:\n%s", want, page)
+		}
+	}
+	if strings.Count(page, "  id:: ") != 2 {
+		t.Fatalf("expected one id:: per floor, got:\n%s", page)
+	}
+	if _, err := os.Stat(filepath.Join(graphDir, "assets", "100", "a.png")); err != nil {
+		t.Fatalf("expected copied asset: %v", err)
+	}
+
+	again, err := newExportTestGenerator().ExportLogseq(post, storeRoot, graphDir)
+	if err != nil {
+		t.Fatalf("second ExportLogseq returned error: %v", err)
+	}
+	data2, _ := os.ReadFile(again)
+	if string(data2) != page {
+		t.Fatal("expected re-export to keep stable block ids")
+	}
+}
+
+func TestExportJoplinWritesJEXArchive(t *testing.T) {
+	tmpDir := t.TempDir()
+	storeRoot := filepath.Join(tmpDir, "store")
+	post := newExportTestPost(t, storeRoot)
+
+	jexPath, err := newExportTestGenerator().ExportJoplin(post, storeRoot, filepath.Join(tmpDir, "out"))
+	if err != nil {
+		t.Fatalf("ExportJoplin returned error: %v", err)
+	}
+
+	f, err := os.Open(jexPath)
+	if err != nil {
+		t.Fatalf("open jex: %v", err)
+	}
+	defer f.Close()
+
+	entries := make(map[string]string)
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read jex: %v", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("read jex entry: %v", err)
+		}
+		entries[hdr.Name] = string(data)
+	}
+
+	var note, resourceFile string
+	types := map[string]int{}
+	for name, data := range entries {
+		switch {
+		case strings.HasPrefix(name, "resources/"):
+			resourceFile = name
+		case strings.HasSuffix(data, "type_: 1"):
+			note = data
+			types["note"]++
+		case strings.HasSuffix(data, "type_: 2"):
+			types["folder"]++
+		case strings.HasSuffix(data, "type_: 4"):
+			types["resource"]++
+		}
+	}
+	if types["note"] != 1 || types["folder"] != 1 || types["resource"] != 1 || resourceFile == "" {
+		t.Fatalf("unexpected jex entries: %v", entries)
+	}
+
+	resourceID := strings.TrimSuffix(strings.TrimPrefix(resourceFile, "resources/"), ".png")
+	if !strings.Contains(note, "(:/"+resourceID+")") {
+		t.Fatalf("expected note to link resource %s, got:\n%s", resourceID, note)
+	}
+	if !strings.HasPrefix(note, "Export test\n\n") {
+		t.Fatalf("expected note title first, got:\n%s", note)
+	}
+	if entries[resourceFile] != "png" {
+		t.Fatalf("unexpected resource content: %q", entries[resourceFile])
+	}
+}
+
+func TestExportHugoWritesPageBundle(t *testing.T) {
+	tmpDir := t.TempDir()
+	storeRoot := filepath.Join(tmpDir, "store")
+	post := newExportTestPost(t, storeRoot)
+	siteDir := filepath.Join(tmpDir, "site")
+
+	bundleDir, err := newExportTestGenerator().ExportHugo(post, storeRoot, siteDir, "archive")
+	if err != nil {
+		t.Fatalf("ExportHugo returned error: %v", err)
+	}
+	if bundleDir != filepath.Join(siteDir, "content", "archive", "100") {
+		t.Fatalf("unexpected bundle dir: %s", bundleDir)
+	}
+
+	data, err := os.ReadFile(filepath.Join(bundleDir, "index.md"))
+	if err != nil {
+		t.Fatalf("read index.md: %v", err)
+	}
+	index := string(data)
+	for _, want := range []string{
+		"+++\ntitle = \"Export test\"\n",
+		"date = 2024-01-02T03:04:05Z\n",
+		"[extra]\n",
+		"tid = \"100\"\n",
+		"](images/a.png)",
+	} {
+		if !strings.Contains(index, want) {
+			t.Fatalf("expected index.md to contain %q, got:\n%s", want, index)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(bundleDir, "images", "a.png")); err != nil {
+		t.Fatalf("expected page resource: %v", err)
+	}
+}
+
+func TestExportPDFInvokesHeadlessChrome(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake chrome is a shell script")
+	}
+
+	tmpDir := t.TempDir()
+	storeRoot := filepath.Join(tmpDir, "store")
+	post := newExportTestPost(t, storeRoot)
+	// The <br> in the table cell reaches the Markdown as raw HTML.
+	post.Replies[0].HTMLContent = `<p>reply</p><table><tr><td>a<br>b</td></tr></table>`
+
+	// The fake browser copies the page it was asked to print into the PDF path
+	// so the test can inspect the generated document.
+	chrome := filepath.Join(tmpDir, "fake-chrome")
+	script := `#!/bin/sh
+out=""
+for arg in "$@"; do
+  case "$arg" in
+    --print-to-pdf=*) out="${arg#--print-to-pdf=}" ;;
+    file://*) page="${arg#file://}" ;;
+  esac
+done
+echo "$@" > "$out.args"
+cp "$page" "$out"
+`
+	if err := os.WriteFile(chrome, []byte(script), 0755); err != nil {
+		t.Fatalf("write fake chrome: %v", err)
+	}
+
+	pdfPath, err := newExportTestGenerator().ExportPDF(post, storeRoot, filepath.Join(tmpDir, "out"), chrome)
+	if err != nil {
+		t.Fatalf("ExportPDF returned error: %v", err)
+	}
+	if filepath.Base(pdfPath) != "100.pdf" {
+		t.Fatalf("unexpected pdf path: %s", pdfPath)
+	}
+
+	data, err := os.ReadFile(pdfPath)
+	if err != nil {
+		t.Fatalf("read pdf: %v", err)
+	}
+	doc := string(data)
+	for _, want := range []string{
+		`<section class="title-page">`,
+		`<h2 id="pidtpc">0 · alice`,
+		`<h2 id="pid200">B1F · bob`,
+		`<base href="file://` + filepath.ToSlash(filepath.Join(storeRoot, "100")) + `/">`,
+		`<img src="images/a.png"`,
+	} {
+		if !strings.Contains(doc, want) {
+			t.Fatalf("expected print html to contain %q, got:\n%s", want, doc)
+		}
+	}
+
+	args, err := os.ReadFile(pdfPath + ".tmp.args")
+	if err != nil {
+		t.Fatalf("read chrome args: %v", err)
+	}
+	for _, want := range []string{"--generate-pdf-document-outline", "--blink-settings=scriptEnabled=false"} {
+		if !strings.Contains(string(args), want) {
+			t.Fatalf("expected %s, got: %s", want, args)
+		}
+	}
+	if strings.Contains(string(args), "--allow-file-access-from-files") {
+		t.Fatalf("print page must not get file access, got: %s", args)
+	}
+	if got, want := strings.Contains(string(args), "--no-sandbox"), os.Geteuid() == 0; got != want {
+		t.Fatalf("--no-sandbox passed = %v, want %v (only as root): %s", got, want, args)
+	}
+	if strings.Contains(doc, "<br") || !strings.Contains(doc, "raw HTML omitted") {
+		t.Fatalf("expected raw HTML to be left out of the print html, got:\n%s", doc)
+	}
+	if !strings.Contains(doc, `<meta http-equiv="Content-Security-Policy" content="default-src 'none';`) {
+		t.Fatalf("expected a content security policy, got:\n%s", doc)
+	}
+}
+
+func TestExportPDFRequiresChrome(t *testing.T) {
+	tmpDir := t.TempDir()
+	post := &main.Post{TID: "100"}
+	_, err := newExportTestGenerator().ExportPDF(post, tmpDir, tmpDir, filepath.Join(tmpDir, "missing-chrome"))
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected missing chrome error, got %v", err)
+	}
+}
@@ -50,3 +50,27 @@ func TestExtractPostDataFromHTML(t *testing.T) {
 		t.Errorf("Extracted post data does not match expected data")
 	}
 }
+
+func TestExtractPostAttachments(t *testing.T) {
+	parser := main.NewPostParser()
+	parser.LoadFromReader(bytes.NewBuffer(sourcePostHTML))
+
+	post, err := parser.ExtractPost()
+	if err != nil {
+		t.Fatalf("Failed to extract post data: %v", err)
+	}
+
+	want := []main.Attachment{{
+		ID:       "433233",
+		Filename: "9_1178845_eaeb05a2f12cc3d.png",
+		URL:      "https://north-plus.net/attachment/Mon_2508/9_1178845_eaeb05a2f12cc3d.png",
+	}}
+	if !reflect.DeepEqual(post.MainPost.Attachments, want) {
+		t.Errorf("main post attachments = %+v, want %+v", post.MainPost.Attachments, want)
+	}
+	for _, reply := range post.Replies {
+		if len(reply.Attachments) != 0 {
+			t.Errorf("reply %s: unexpected attachments %+v", reply.Floor, reply.Attachments)
+		}
+	}
+}
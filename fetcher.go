@@ -2,12 +2,12 @@ package south2md
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
-	"os"
 	"regexp"
 	"runtime"
 	"sort"
@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"github.com/gocolly/colly/v2"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Pre-compiled regex patterns for better performance
@@ -27,53 +28,19 @@ var (
 
 // Fetcher HTTP抓取器
 type Fetcher struct {
-	client        *http.Client
+	client        HTTPDoer
 	config        *HTTPOptions
 	cookieManager *CookieManager
-	baseURL       string
-}
-
-// configureProxy 从环境变量配置代理
-func configureProxy() *http.Transport {
-	// 优先检查 HTTPS_PROXY，然后是 HTTP_PROXY
-	proxyURL := os.Getenv("HTTPS_PROXY")
-	if proxyURL == "" {
-		proxyURL = os.Getenv("HTTP_PROXY")
-	}
-
-	if proxyURL == "" {
-		return nil // 没有配置代理
-	}
-
-	// 解析代理 URL
-	parsedURL, err := url.Parse(proxyURL)
-	if err != nil {
-		slog.Warn("Invalid proxy URL detected", "proxy", proxyURL, "error", err)
-		return nil
-	}
-
-	// 获取 NO_PROXY 列表
-	noProxy := os.Getenv("NO_PROXY")
-
-	// 创建带代理的 Transport
-	transport := &http.Transport{
-		Proxy: http.ProxyURL(parsedURL),
-	}
+	mirrors       *mirrorSet
 
-	// 如果有 NO_PROXY，设置代理忽略规则
-	if noProxy != "" {
-		slog.Warn("Using proxy with bypass rules", "proxy", proxyURL, "no_proxy", noProxy)
-	} else {
-		slog.Warn("Using proxy server", "proxy", proxyURL)
-	}
-
-	return transport
+	rawPageHandler RawPageHandler
+	metrics        *Metrics
 }
 
 // NewHTTPClient 创建一个新的HTTP客户端
 func NewHTTPClient(config *HTTPOptions) *http.Client {
 	// 创建带连接池的 HTTP 客户端
-	transport := configureProxy()
+	transport := configureProxy(config.Proxy, config.NoProxy)
 	if transport == nil {
 		transport = &http.Transport{
 			MaxIdleConns:        100,
@@ -86,30 +53,94 @@ func NewHTTPClient(config *HTTPOptions) *http.Client {
 		transport.MaxIdleConnsPerHost = 10
 		transport.IdleConnTimeout = 90 * time.Second
 	}
+	roundTripper, err := applyTLSFingerprint(transport, config.TLSFingerprint, config.TLSFingerprintHosts)
+	if err != nil {
+		slog.Warn("Invalid TLS fingerprint, using the default TLS handshake", "error", err)
+	}
+
+	if len(config.ProxyPool) > 0 {
+		pool, err := NewProxyPool(config.ProxyPool, config.ProxyBanTime)
+		if err != nil {
+			slog.Warn("Invalid proxy pool, not rotating proxies", "error", err)
+		} else {
+			_, noProxy := resolveProxy("", config.NoProxy)
+			direct := &http.Transport{
+				MaxIdleConns:        100,
+				MaxIdleConnsPerHost: 10,
+				IdleConnTimeout:     90 * time.Second,
+			}
+			fingerprinted, _ := applyTLSFingerprint(direct, config.TLSFingerprint, config.TLSFingerprintHosts)
+			roundTripper = pool.Transport(fingerprinted, noProxy)
+			slog.Info("Rotating requests over proxy pool", "proxies", pool.Size())
+		}
+	}
+
+	if config.FixturesDir != "" {
+		roundTripper = newReplayTransport(config.FixturesDir)
+	}
+	if config.HAR != nil {
+		roundTripper = config.HAR.Transport(roundTripper)
+	}
+	if len(config.HostLimits) > 0 || config.DefaultHostLimit > 0 {
+		roundTripper = newHostLimitTransport(roundTripper, config.HostLimits, config.DefaultHostLimit)
+	}
 
 	return &http.Client{
-		Transport: transport,
+		Transport: roundTripper,
 		Timeout:   config.Timeout,
 	}
 }
 
-// NewFetcher 创建新的HTTP抓取器
-func NewFetcher(client *http.Client, config *HTTPOptions, baseURL string) *Fetcher {
+// NewFetcher 创建新的HTTP抓取器。client 通常是 NewHTTPClient 的返回值，
+// 也可以是任意 HTTPDoer(例如测试桩或代理)。
+func NewFetcher(client HTTPDoer, config *HTTPOptions, baseURL string) *Fetcher {
 	fetcher := &Fetcher{
 		client:        client,
 		config:        config,
 		cookieManager: NewCookieManager(),
-		baseURL:       baseURL,
+		mirrors:       newMirrorSet(baseURL, config.Mirrors),
 	}
 
 	// 加载Cookie
 	if config.EnableCookie && config.CookieFile != "" {
 		fetcher.LoadCookies(config.CookieFile)
+		fetcher.alignUserAgent()
 	}
 
 	return fetcher
 }
 
+// alignUserAgent reconciles the configured User-Agent with the one recorded
+// when the cookies were imported: Cloudflare binds cf_clearance to the
+// browser that minted it, and a mismatch silently lands on the login wall.
+func (f *Fetcher) alignUserAgent() {
+	cookieUA := f.cookieManager.UserAgent()
+	if cookieUA == "" || cookieUA == f.config.UserAgent {
+		return
+	}
+	if !f.config.FollowCookieUserAgent {
+		slog.Warn("User-Agent differs from the one the cookies were imported with, the forum may reject them",
+			"user_agent", f.config.UserAgent, "cookie_user_agent", cookieUA)
+		return
+	}
+	options := *f.config
+	options.UserAgent = cookieUA
+	f.config = &options
+	slog.Info("Using the User-Agent recorded with the imported cookies", "user_agent", cookieUA)
+}
+
+// SetMetrics records request counts, bytes, retries, errors and durations
+// into metrics; nil disables recording.
+func (f *Fetcher) SetMetrics(metrics *Metrics) {
+	f.metrics = metrics
+}
+
+// HTTPDoer returns the client the fetcher sends requests through, so other
+// components (image and gofile downloads) can share its transport.
+func (f *Fetcher) HTTPDoer() HTTPDoer {
+	return f.client
+}
+
 // FetchPost 抓取指定TID的帖子内容
 func (f *Fetcher) FetchPost(tid string) (string, error) {
 	if tid == "" {
@@ -124,8 +155,7 @@ func (f *Fetcher) FetchPost(tid string) (string, error) {
 
 // buildPostURL 构建帖子URL
 func (f *Fetcher) buildPostURL(tid string, page int) string {
-	// 确保baseURL以/结尾
-	baseURL := strings.TrimRight(f.baseURL, "/")
+	baseURL := f.mirrors.current()
 
 	// 如果是第一页，使用原始URL格式
 	if page <= 1 {
@@ -142,17 +172,42 @@ func (f *Fetcher) FetchPostWithPage(tid string, page int) (string, error) {
 		return "", fmt.Errorf("TID不能为空")
 	}
 
-	slog.Info("Fetching post", "tid", tid, "page", page)
+	return f.fetchPage(context.Background(), tid, page)
+}
 
+// fetchPage fetches one page of a thread inside a "fetch_page" span.
+func (f *Fetcher) fetchPage(ctx context.Context, tid string, page int) (html string, err error) {
 	// 构建完整的URL，包含页码参数
-	postURL := f.buildPostURL(tid, page)
+	return f.fetchPageURL(ctx, tid, page, f.buildPostURL(tid, page))
+}
 
-	return f.FetchURL(postURL)
+// fetchPageURL fetches page of a thread from postURL inside a "fetch_page" span.
+func (f *Fetcher) fetchPageURL(ctx context.Context, tid string, page int, postURL string) (html string, err error) {
+	slog.Info("Fetching post", "tid", tid, "page", page)
+
+	ctx, span := startSpan(ctx, "south2md.fetch_page",
+		attribute.String("south2md.tid", tid),
+		attribute.Int("south2md.page", page),
+		attribute.String("url.full", postURL),
+	)
+	defer func() {
+		span.SetAttributes(attribute.Int("south2md.html_bytes", len(html)))
+		endSpan(span, err)
+	}()
+	html, mirror, err := f.fetchForumURL(ctx, postURL)
+	if err == nil && mirror != "" {
+		f.mirrors.record(tid, page, mirror)
+	}
+	return html, err
 }
 
 // FetchURL 抓取指定URL的内容
 func (f *Fetcher) FetchURL(targetURL string) (string, error) {
-	resp, err := f.FetchWithRetry(targetURL)
+	return f.fetchURL(context.Background(), targetURL)
+}
+
+func (f *Fetcher) fetchURL(ctx context.Context, targetURL string) (string, error) {
+	resp, err := f.fetchWithRetry(ctx, targetURL)
 	if err != nil {
 		return "", err
 	}
@@ -178,21 +233,49 @@ func (f *Fetcher) FetchURL(targetURL string) (string, error) {
 
 // FetchWithRetry 带重试机制的HTTP请求
 func (f *Fetcher) FetchWithRetry(targetURL string) (*http.Response, error) {
+	return f.fetchWithRetry(context.Background(), targetURL)
+}
+
+// fetchWithRetry retries targetURL until it succeeds, fails with a 4xx or
+// ctx is done. Every attempt gets its own "http_request" span.
+func (f *Fetcher) fetchWithRetry(ctx context.Context, targetURL string) (*http.Response, error) {
 	var lastErr error
 
 	for attempt := 0; attempt <= f.config.MaxRetries; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if attempt > 0 {
 			// 等待重试间隔
 			time.Sleep(f.config.RetryDelay)
 			slog.Info("Retrying request", "attempt", attempt, "url", targetURL)
+			f.metrics.Add(MetricRetriesTotal, 1, "component", MetricsComponentFetcher)
 		}
 
+		start := time.Now()
+		_, span := startSpan(ctx, "south2md.http_request",
+			attribute.String("http.request.method", http.MethodGet),
+			attribute.String("url.full", targetURL),
+			attribute.Int("http.request.resend_count", attempt),
+		)
 		resp, err := f.doRequest(targetURL)
 		if err != nil {
+			f.metrics.recordRequest(MetricsComponentFetcher, start, 0, err)
+			endSpan(span, err)
 			lastErr = err
 			// 网络错误，继续重试
 			continue
 		}
+		var statusErr error
+		if resp.StatusCode >= 400 {
+			statusErr = &httpStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+		}
+		f.metrics.recordRequest(MetricsComponentFetcher, start, resp.ContentLength, statusErr)
+		span.SetAttributes(
+			attribute.Int("http.response.status_code", resp.StatusCode),
+			attribute.Int64("http.response.body.size", resp.ContentLength),
+		)
+		endSpan(span, statusErr)
 
 		// 检查HTTP状态码
 		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
@@ -200,14 +283,21 @@ func (f *Fetcher) FetchWithRetry(targetURL string) (*http.Response, error) {
 		}
 
 		// 4xx错误不重试
+		reason := proxyBanReason(resp)
 		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
 			resp.Body.Close()
+			if reason != "" {
+				return nil, &blockedError{StatusCode: resp.StatusCode, Status: resp.Status, Reason: reason}
+			}
 			return nil, fmt.Errorf("HTTP错误 %d: %s", resp.StatusCode, resp.Status)
 		}
 
 		// 5xx错误继续重试
 		resp.Body.Close()
 		lastErr = fmt.Errorf("服务器错误 %d: %s", resp.StatusCode, resp.Status)
+		if reason != "" {
+			lastErr = &blockedError{StatusCode: resp.StatusCode, Status: resp.Status, Reason: reason}
+		}
 
 		// 5xx错误时增加重试间隔
 		if resp.StatusCode >= 500 {
@@ -215,11 +305,12 @@ func (f *Fetcher) FetchWithRetry(targetURL string) (*http.Response, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("请求失败，已重试 %d 次: %v", f.config.MaxRetries, lastErr)
+	return nil, fmt.Errorf("请求失败，已重试 %d 次: %w", f.config.MaxRetries, lastErr)
 }
 
-// doRequest 执行单个HTTP请求
-func (f *Fetcher) doRequest(targetURL string) (*http.Response, error) {
+// doRequest 执行单个HTTP请求; opts adjust the collector, e.g. its body size
+// limit.
+func (f *Fetcher) doRequest(targetURL string, opts ...func(*colly.Collector)) (*http.Response, error) {
 	parsedURL, err := url.Parse(targetURL)
 	if err != nil {
 		return nil, NewNetworkError("创建请求失败", err)
@@ -229,8 +320,11 @@ func (f *Fetcher) doRequest(targetURL string) (*http.Response, error) {
 	collector.ParseHTTPErrorResponse = true
 	collector.SetRequestTimeout(f.config.Timeout)
 
-	if f.client != nil && f.client.Transport != nil {
-		collector.WithTransport(f.client.Transport)
+	if transport := transportFor(f.client); transport != nil {
+		collector.WithTransport(transport)
+	}
+	for _, opt := range opts {
+		opt(collector)
 	}
 
 	var responseBody []byte
@@ -301,10 +395,11 @@ func (f *Fetcher) doRequest(targetURL string) (*http.Response, error) {
 	}
 
 	return &http.Response{
-		Status:     fmt.Sprintf("%d %s", responseStatusCode, statusText),
-		StatusCode: responseStatusCode,
-		Header:     responseHeader,
-		Body:       io.NopCloser(bytes.NewReader(responseBody)),
+		Status:        fmt.Sprintf("%d %s", responseStatusCode, statusText),
+		StatusCode:    responseStatusCode,
+		Header:        responseHeader,
+		Body:          io.NopCloser(bytes.NewReader(responseBody)),
+		ContentLength: int64(len(responseBody)),
 		Request: &http.Request{
 			Method: "GET",
 			URL:    parsedURL,
@@ -361,16 +456,46 @@ func (f *Fetcher) SaveCookies(cookieFile string) error {
 
 // FetchPostWithPagination 获取指定TID的帖子（自动处理分页）
 func (f *Fetcher) FetchPostWithPagination(tid string, postParser *PostParser) (*Post, error) {
+	return f.FetchPostWithPaginationContext(context.Background(), tid, postParser)
+}
+
+// FetchPostWithPaginationContext is FetchPostWithPagination with a context
+// that cancels pending requests and parents the run's tracing spans.
+func (f *Fetcher) FetchPostWithPaginationContext(ctx context.Context, tid string, postParser *PostParser) (post *Post, err error) {
+	if tid == "" {
+		return nil, NewValidationError("TID不能为空")
+	}
+	ctx, span := startSpan(ctx, "south2md.fetch_thread", attribute.String("south2md.tid", tid))
+	defer func() {
+		if post != nil {
+			span.SetAttributes(
+				attribute.Int("south2md.total_pages", post.TotalPages),
+				attribute.Int("south2md.missing_pages", len(post.MissingPages)),
+				attribute.Int("south2md.replies", len(post.Replies)),
+			)
+		}
+		endSpan(span, err)
+	}()
+
+	f.mirrors.track(tid)
+	defer f.mirrors.take(tid)
+
 	// 首先获取第一页以确定总页数
-	firstPageHTML, err := f.FetchPost(tid)
+	firstPageHTML, err := f.fetchPage(ctx, tid, 1)
 	if err != nil {
 		return nil, fmt.Errorf("获取帖子第一页失败: %v", err)
 	}
 
 	// 解析第一页
-	if err := postParser.LoadFromString(firstPageHTML); err != nil {
+	if err := parsePageTraced(ctx, postParser, 1, firstPageHTML); err != nil {
 		return nil, fmt.Errorf("解析第一页HTML失败: %v", err)
 	}
+	f.handleRawPage(tid, 1, firstPageHTML)
+
+	// Stop at a login wall before fetching the remaining pages.
+	if err := f.checkAccess(postParser); err != nil {
+		return nil, err
+	}
 
 	// 尝试从第一页获取总页数
 	totalPages := f.extractTotalPages(postParser)
@@ -379,35 +504,75 @@ func (f *Fetcher) FetchPostWithPagination(tid string, postParser *PostParser) (*
 		totalPages = 1
 	}
 
-	// 收集所有页面的解析器
-	var parsers []*PostParser
-
-	// 添加第一页解析器
-	parsers = append(parsers, postParser)
-
-	// 并发获取剩余页面
-	if totalPages > 1 {
-		parsers, err = f.fetchPagesConcurrently(tid, totalPages, parsers)
+	// 获取剩余页面，每页在 worker 中解析并提取回复
+	var pages [][]PostEntry
+	var failedPages []int
+	if f.config.Pagination == PaginationNext {
+		pages, failedPages, totalPages, err = f.fetchPagesByNextLink(ctx, tid, postParser, totalPages)
+		if err != nil {
+			return nil, err
+		}
+	} else if totalPages > 1 {
+		pages, failedPages, err = f.fetchPagesConcurrently(ctx, tid, totalPages, postParser.selectors)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	// 从所有页面提取数据
-	// Use the first parser to extract data from all parsers
-	post, err := parsers[0].ExtractPostFromMultiplePages(parsers)
+	// 从第一页提取帖子并合并其余页面的回复
+	_, extractSpan := startSpan(ctx, "south2md.extract_post", attribute.Int("south2md.pages", 1+len(pages)))
+	post, err = postParser.extractPostWithPages(pages)
+	endSpan(extractSpan, err)
 	if err != nil {
-		return nil, fmt.Errorf("从多页提取帖子数据失败: %v", err)
+		return nil, fmt.Errorf("从多页提取帖子数据失败: %w", err)
 	}
 
 	// 设置TID
 	post.TID = tid
+	post.TotalPages = totalPages
+	post.PageMirrors = f.mirrors.take(tid)
+	if len(failedPages) > 0 {
+		post.MissingPages = append(post.MissingPages, failedPages...)
+		sort.Ints(post.MissingPages)
+	}
 
 	return post, nil
 }
 
-// fetchPagesConcurrently 并发获取帖子的所有页面
-func (f *Fetcher) fetchPagesConcurrently(tid string, totalPages int, parsers []*PostParser) ([]*PostParser, error) {
+// checkAccess inspects the first page of a thread. A page without posts
+// fails with the classified auth/maintenance error. A guest page while a
+// login cookie is loaded means the cookies expired or no longer match the
+// User-Agent/IP; it fails with an AuthError unless AllowGuest is set, in
+// which case only the guest-visible content is archived.
+func (f *Fetcher) checkAccess(parser *PostParser) error {
+	if err := parser.CheckAccess(); err != nil {
+		return err
+	}
+	if parser.LoggedIn() || !f.hasLoginCookie() {
+		return nil
+	}
+	if f.config.AllowGuest {
+		slog.Warn("Cookies were rejected, archiving only what guests can see; re-import the cookies to get the full thread")
+		return nil
+	}
+	return NewAuthError("已加载登录 Cookie 但页面显示未登录，Cookie 可能已过期或与 User-Agent/IP 绑定不一致，请重新导入 Cookie (或使用 --allow-guest 仅保存游客可见内容)", nil)
+}
+
+// hasLoginCookie reports whether requests to the forum carry the login cookie.
+func (f *Fetcher) hasLoginCookie() bool {
+	if !f.config.EnableCookie {
+		return false
+	}
+	for _, cookie := range f.cookieManager.GetCookiesForURL(f.mirrors.current() + "/") {
+		if cookie.Name == loginCookieName {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchPagesConcurrently 并发获取帖子的所有页面，同时返回抓取失败的页码
+func (f *Fetcher) fetchPagesConcurrently(ctx context.Context, tid string, totalPages int, selectors htmlSelectors) ([][]PostEntry, []int, error) {
 	numWorkers := runtime.NumCPU()
 	if numWorkers > f.config.MaxConcurrent {
 		numWorkers = f.config.MaxConcurrent
@@ -423,7 +588,7 @@ func (f *Fetcher) fetchPagesConcurrently(tid string, totalPages int, parsers []*
 	// 启动工作池
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
-		go f.fetchPageWorker(tasks, results, &wg)
+		go f.fetchPageWorker(ctx, tasks, results, &wg, selectors)
 	}
 
 	// 发送任务
@@ -440,9 +605,8 @@ func (f *Fetcher) fetchPagesConcurrently(tid string, totalPages int, parsers []*
 		close(results)
 	}()
 
-	// 处理结果
-	pageParsers := make([]*PostParser, totalPages)
-	pageParsers[0] = parsers[0] // 第一页解析器
+	// 处理结果，pages[i] 为第 i+2 页的回复
+	pages := make([][]PostEntry, totalPages-1)
 
 	failedPages := make([]int, 0)
 	for result := range results {
@@ -452,13 +616,15 @@ func (f *Fetcher) fetchPagesConcurrently(tid string, totalPages int, parsers []*
 			continue
 		}
 
-		pageParsers[result.Page-1] = result.Parser
+		pages[result.Page-2] = result.Replies
+		f.handleRawPage(tid, result.Page, result.HTML)
 	}
 
 	if len(failedPages) > 0 {
 		sort.Ints(failedPages)
 	}
-	return resolvePageFetchResults(pageParsers, failedPages, f.config.StrictPagination)
+	resolved, err := resolvePageFetchResults(pages, failedPages, f.config.StrictPagination)
+	return resolved, failedPages, err
 }
 
 // PageFetchTask represents a page fetching task
@@ -467,20 +633,24 @@ type PageFetchTask struct {
 	TID  string
 }
 
-// PageFetchResult represents the result of a page fetch
+// PageFetchResult represents the result of a page fetch: the replies the
+// worker extracted from it, so neither the page's document nor its HTML
+// outlives the worker.
 type PageFetchResult struct {
-	Page   int
-	HTML   string
-	Error  error
-	Parser *PostParser
+	Page    int
+	HTML    string // only set when a raw page handler is registered
+	Error   error
+	Replies []PostEntry
 }
 
-// fetchPageWorker is a worker that fetches pages concurrently
-func (f *Fetcher) fetchPageWorker(tasks <-chan PageFetchTask, results chan<- PageFetchResult, wg *sync.WaitGroup) {
+// fetchPageWorker is a worker that fetches, parses and extracts pages
+// concurrently. Page parsers use the same selectors as the first page's
+// parser.
+func (f *Fetcher) fetchPageWorker(ctx context.Context, tasks <-chan PageFetchTask, results chan<- PageFetchResult, wg *sync.WaitGroup, selectors htmlSelectors) {
 	defer wg.Done()
 
 	for task := range tasks {
-		pageHTML, err := f.FetchPostWithPage(task.TID, task.Page)
+		pageHTML, err := f.fetchPage(ctx, task.TID, task.Page)
 		if err != nil {
 			results <- PageFetchResult{
 				Page:  task.Page,
@@ -489,9 +659,8 @@ func (f *Fetcher) fetchPageWorker(tasks <-chan PageFetchTask, results chan<- Pag
 			continue
 		}
 
-		// Create parser for this page
-		pageParser := NewPostParser()
-		if err := pageParser.LoadFromString(pageHTML); err != nil {
+		replies, err := extractPageReplies(ctx, selectors, task.Page, pageHTML)
+		if err != nil {
 			results <- PageFetchResult{
 				Page:  task.Page,
 				Error: err,
@@ -499,12 +668,40 @@ func (f *Fetcher) fetchPageWorker(tasks <-chan PageFetchTask, results chan<- Pag
 			continue
 		}
 
-		results <- PageFetchResult{
-			Page:   task.Page,
-			HTML:   pageHTML,
-			Parser: pageParser,
+		result := PageFetchResult{Page: task.Page, Replies: replies}
+		if f.rawPageHandler != nil {
+			result.HTML = pageHTML
 		}
+		results <- result
+	}
+}
+
+// extractPageReplies parses a page after the first and extracts its
+// replies; the page document is dropped on return. The result is non-nil on
+// success.
+func extractPageReplies(ctx context.Context, selectors htmlSelectors, page int, html string) ([]PostEntry, error) {
+	parser := NewPostParser()
+	parser.selectors = selectors
+	if err := parsePageTraced(ctx, parser, page, html); err != nil {
+		return nil, err
 	}
+	replies, err := parser.ExtractReplies()
+	if err != nil {
+		return nil, fmt.Errorf("提取第 %d 页回复失败: %w", page, err)
+	}
+	if replies == nil {
+		replies = []PostEntry{}
+	}
+	return replies, nil
+}
+
+// parsePageTraced loads html into parser as page inside a "parse_page" span.
+func parsePageTraced(ctx context.Context, parser *PostParser, page int, html string) error {
+	_, span := startSpan(ctx, "south2md.parse_page", attribute.Int("south2md.page", page))
+	parser.SetPage(page)
+	err := parser.LoadFromString(html)
+	endSpan(span, err)
+	return err
 }
 
 // extractTotalPages 从页面中提取总页数
@@ -560,7 +757,9 @@ func cloneHeaders(headers *http.Header) http.Header {
 	return cloned
 }
 
-func resolvePageFetchResults(pageParsers []*PostParser, failedPages []int, strict bool) ([]*PostParser, error) {
+// resolvePageFetchResults drops the failed (nil) pages, or fails when strict
+// and some page is missing.
+func resolvePageFetchResults(pages [][]PostEntry, failedPages []int, strict bool) ([][]PostEntry, error) {
 	if len(failedPages) > 0 {
 		if strict {
 			return nil, fmt.Errorf("分页抓取失败，缺失页: %v", failedPages)
@@ -568,13 +767,13 @@ func resolvePageFetchResults(pageParsers []*PostParser, failedPages []int, stric
 		slog.Warn("Pagination fetch completed with missing pages", "missing_pages", failedPages)
 	}
 
-	// 过滤掉nil解析器
-	validParsers := make([]*PostParser, 0, len(pageParsers))
-	for _, parser := range pageParsers {
-		if parser != nil {
-			validParsers = append(validParsers, parser)
+	// 过滤掉失败的页面
+	valid := make([][]PostEntry, 0, len(pages))
+	for _, replies := range pages {
+		if replies != nil {
+			valid = append(valid, replies)
 		}
 	}
 
-	return validParsers, nil
+	return valid, nil
 }
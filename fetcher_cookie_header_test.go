@@ -1,6 +1,7 @@
 package south2md
 
 import (
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -58,3 +59,29 @@ func TestCookieNames(t *testing.T) {
 		t.Fatalf("unexpected cookie names: %#v", names)
 	}
 }
+
+func TestFetcherFollowsCookieUserAgent(t *testing.T) {
+	cookieFile := filepath.Join(t.TempDir(), "cookies.txt")
+	cm := NewCookieManager()
+	if err := cm.LoadFromCurl(`curl https://south-plus.net/ -H 'Cookie: cf_clearance=x' -H 'User-Agent: BrowserUA/1.0'`); err != nil {
+		t.Fatalf("LoadFromCurl returned error: %v", err)
+	}
+	if err := cm.SaveToFile(cookieFile); err != nil {
+		t.Fatalf("SaveToFile returned error: %v", err)
+	}
+
+	options := &HTTPOptions{UserAgent: "ConfiguredUA/2.0", CookieFile: cookieFile, EnableCookie: true, FollowCookieUserAgent: true}
+	fetcher := NewFetcher(&stubDoer{}, options, "https://south-plus.net/")
+	if fetcher.config.UserAgent != "BrowserUA/1.0" {
+		t.Fatalf("expected the cookie User-Agent, got %q", fetcher.config.UserAgent)
+	}
+	if options.UserAgent != "ConfiguredUA/2.0" {
+		t.Fatalf("caller options were modified: %q", options.UserAgent)
+	}
+
+	options.FollowCookieUserAgent = false
+	fetcher = NewFetcher(&stubDoer{}, options, "https://south-plus.net/")
+	if fetcher.config.UserAgent != "ConfiguredUA/2.0" {
+		t.Fatalf("expected the configured User-Agent to be kept, got %q", fetcher.config.UserAgent)
+	}
+}
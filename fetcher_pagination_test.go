@@ -1,15 +1,20 @@
 package south2md
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"strings"
+	"sync"
 	"testing"
 )
 
 func TestResolvePageFetchResultsStrictModeReturnsError(t *testing.T) {
-	page1 := NewPostParser()
-	page2 := NewPostParser()
+	page1 := []PostEntry{}
+	page2 := []PostEntry{}
 
-	_, err := resolvePageFetchResults([]*PostParser{page1, page2, nil}, []int{3}, true)
+	_, err := resolvePageFetchResults([][]PostEntry{page1, page2, nil}, []int{3}, true)
 	if err == nil {
 		t.Fatal("expected strict pagination error")
 	}
@@ -19,14 +24,55 @@ func TestResolvePageFetchResultsStrictModeReturnsError(t *testing.T) {
 }
 
 func TestResolvePageFetchResultsNonStrictModeSkipsFailedPages(t *testing.T) {
-	page1 := NewPostParser()
-	page2 := NewPostParser()
+	page1 := []PostEntry{}
+	page2 := []PostEntry{}
 
-	parsers, err := resolvePageFetchResults([]*PostParser{page1, page2, nil}, []int{3}, false)
+	parsers, err := resolvePageFetchResults([][]PostEntry{page1, page2, nil}, []int{3}, false)
 	if err != nil {
 		t.Fatalf("unexpected error in non-strict mode: %v", err)
 	}
 	if len(parsers) != 2 {
-		t.Fatalf("expected 2 parsers, got %d", len(parsers))
+		t.Fatalf("expected 2 pages, got %d", len(parsers))
+	}
+}
+
+func TestFetchPageWorkerReturnsRepliesOnly(t *testing.T) {
+	fixture, err := os.ReadFile("tid-2636739.html")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(fixture)
+	}))
+	defer srv.Close()
+
+	run := func(f *Fetcher) PageFetchResult {
+		tasks := make(chan PageFetchTask, 1)
+		results := make(chan PageFetchResult, 1)
+		tasks <- PageFetchTask{Page: 2, TID: "2636739"}
+		close(tasks)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		f.fetchPageWorker(context.Background(), tasks, results, &wg, defaultHTMLSelectors)
+		return <-results
+	}
+
+	f := NewFetcher(srv.Client(), &HTTPOptions{MaxConcurrent: 1}, srv.URL)
+	result := run(f)
+	if result.Error != nil || len(result.Replies) == 0 {
+		t.Fatalf("expected replies, got %d (error %v)", len(result.Replies), result.Error)
+	}
+	if result.HTML != "" {
+		t.Fatal("expected the raw HTML to be dropped without a raw page handler")
+	}
+	for _, reply := range result.Replies {
+		if reply.SourcePage != 2 {
+			t.Fatalf("expected replies of page 2, got page %d", reply.SourcePage)
+		}
+	}
+
+	f.SetRawPageHandler(func(string, int, string) {})
+	if result := run(f); result.HTML == "" {
+		t.Fatal("expected the raw HTML to be kept for the raw page handler")
 	}
 }
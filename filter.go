@@ -0,0 +1,221 @@
+package south2md
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Filter rule kinds.
+const (
+	FilterKindCSS   = "css"   // remove elements matching Selector from floor content
+	FilterKindRegex = "regex" // replace Pattern in floor content and signatures with Replace
+	FilterKindHost  = "host"  // remove links and images pointing at Host or its subdomains
+	FilterKindUser  = "user"  // replace username User with Replace and drop that author's profile
+)
+
+// FilterKinds lists the supported filter rule kinds.
+var FilterKinds = []string{FilterKindCSS, FilterKindRegex, FilterKindHost, FilterKindUser}
+
+// StageFilter is the name of the stage applying content filter rules.
+const StageFilter = "filter"
+
+// defaultUserRedaction replaces redacted usernames when a rule sets none.
+const defaultUserRedaction = "匿名用户"
+
+// FilterRule is one content filter or redaction rule, configured as a
+// [[filters]] table.
+type FilterRule struct {
+	Kind     string `toml:"kind" mapstructure:"kind"`
+	Selector string `toml:"selector,omitempty" mapstructure:"selector"`
+	Pattern  string `toml:"pattern,omitempty" mapstructure:"pattern"`
+	Host     string `toml:"host,omitempty" mapstructure:"host"`
+	User     string `toml:"user,omitempty" mapstructure:"user"`
+	Replace  string `toml:"replace,omitempty" mapstructure:"replace"`
+}
+
+type compiledFilterRule struct {
+	FilterRule
+	selector cascadia.Selector
+	pattern  *regexp.Regexp
+}
+
+// ContentFilter applies filter rules to extracted posts.
+type ContentFilter struct {
+	rules []compiledFilterRule
+}
+
+// NewContentFilter validates and compiles rules.
+func NewContentFilter(rules []FilterRule) (*ContentFilter, error) {
+	filter := &ContentFilter{rules: make([]compiledFilterRule, 0, len(rules))}
+	for i, rule := range rules {
+		compiled := compiledFilterRule{FilterRule: rule}
+		switch rule.Kind {
+		case FilterKindCSS:
+			selector, err := cascadia.Compile(rule.Selector)
+			if err != nil {
+				return nil, fmt.Errorf("filter %d: invalid selector %q: %w", i+1, rule.Selector, err)
+			}
+			compiled.selector = selector
+		case FilterKindRegex:
+			if rule.Pattern == "" {
+				return nil, fmt.Errorf("filter %d: pattern is empty", i+1)
+			}
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("filter %d: invalid pattern %q: %w", i+1, rule.Pattern, err)
+			}
+			compiled.pattern = pattern
+		case FilterKindHost:
+			compiled.Host = strings.ToLower(strings.TrimSpace(rule.Host))
+			if compiled.Host == "" {
+				return nil, fmt.Errorf("filter %d: host is empty", i+1)
+			}
+		case FilterKindUser:
+			if strings.TrimSpace(rule.User) == "" {
+				return nil, fmt.Errorf("filter %d: user is empty", i+1)
+			}
+			if compiled.Replace == "" {
+				compiled.Replace = defaultUserRedaction
+			}
+		default:
+			return nil, fmt.Errorf("filter %d: unknown kind %q (supported: %s)", i+1, rule.Kind, strings.Join(FilterKinds, ", "))
+		}
+		filter.rules = append(filter.rules, compiled)
+	}
+	return filter, nil
+}
+
+// Apply filters the title, every floor and the authors of post in place.
+func (f *ContentFilter) Apply(post *Post) {
+	if f == nil || len(f.rules) == 0 || post == nil {
+		return
+	}
+	for _, rule := range f.rules {
+		if rule.Kind == FilterKindUser {
+			post.Title = strings.ReplaceAll(post.Title, rule.User, rule.Replace)
+		}
+	}
+	f.applyEntry(&post.MainPost)
+	for i := range post.Replies {
+		f.applyEntry(&post.Replies[i])
+	}
+}
+
+func (f *ContentFilter) applyEntry(entry *PostEntry) {
+	content := entry.HTMLContent
+	if content != "" && f.hasDOMRules() {
+		content = f.filterDOM(content)
+	}
+	for _, rule := range f.rules {
+		switch rule.Kind {
+		case FilterKindRegex:
+			content = rule.pattern.ReplaceAllString(content, rule.Replace)
+			entry.Author.Signature = rule.pattern.ReplaceAllString(entry.Author.Signature, rule.Replace)
+		case FilterKindUser:
+			content = strings.ReplaceAll(content, html.EscapeString(rule.User), html.EscapeString(rule.Replace))
+			if entry.Author.Username == rule.User {
+				entry.Author = Author{Username: rule.Replace}
+			}
+		}
+	}
+	entry.HTMLContent = content
+}
+
+func (f *ContentFilter) hasDOMRules() bool {
+	for _, rule := range f.rules {
+		if rule.Kind == FilterKindCSS || rule.Kind == FilterKindHost {
+			return true
+		}
+	}
+	return false
+}
+
+// filterDOM removes the elements matched by css and host rules from the
+// content fragment.
+func (f *ContentFilter) filterDOM(content string) string {
+	container := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(content), container)
+	if err != nil {
+		slog.Warn("Failed to parse floor content for filtering", "error", err)
+		return content
+	}
+	for _, node := range nodes {
+		container.AppendChild(node)
+	}
+
+	var remove []*html.Node
+	for _, rule := range f.rules {
+		switch rule.Kind {
+		case FilterKindCSS:
+			remove = append(remove, cascadia.QueryAll(container, rule.selector)...)
+		case FilterKindHost:
+			remove = append(remove, nodesLinkingHost(container, rule.Host)...)
+		}
+	}
+	if len(remove) == 0 {
+		return content
+	}
+	for _, node := range remove {
+		if node.Parent != nil {
+			node.Parent.RemoveChild(node)
+		}
+	}
+
+	var out bytes.Buffer
+	for child := container.FirstChild; child != nil; child = child.NextSibling {
+		if err := html.Render(&out, child); err != nil {
+			slog.Warn("Failed to render filtered floor content", "error", err)
+			return content
+		}
+	}
+	return out.String()
+}
+
+// nodesLinkingHost returns the <a> and <img> elements under root whose href
+// or src points at host or one of its subdomains.
+func nodesLinkingHost(root *html.Node, host string) []*html.Node {
+	var matches []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.DataAtom == atom.A || n.DataAtom == atom.Img) {
+			for _, attr := range n.Attr {
+				if (attr.Key == "href" || attr.Key == "src") && urlMatchesHost(attr.Val, host) {
+					matches = append(matches, n)
+					return
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(root)
+	return matches
+}
+
+func urlMatchesHost(rawURL, host string) bool {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return false
+	}
+	h := strings.ToLower(u.Hostname())
+	return h == host || strings.HasSuffix(h, "."+host)
+}
+
+// FilterStage applies filter to state.Post before it is stored; a nil or
+// empty filter does nothing.
+func FilterStage(filter *ContentFilter) Stage {
+	return NewStage(StageFilter, func(ctx context.Context, state *PipelineState) error {
+		filter.Apply(state.Post)
+		return nil
+	})
+}
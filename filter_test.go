@@ -0,0 +1,68 @@
+package south2md
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestContentFilterAppliesRules(t *testing.T) {
+	filter, err := NewContentFilter([]FilterRule{
+		{Kind: FilterKindCSS, Selector: "div.ad"},
+		{Kind: FilterKindHost, Host: "tracker.example"},
+		{Kind: FilterKindRegex, Pattern: `QQ\s*\d+`, Replace: "[QQ]"},
+		{Kind: FilterKindUser, User: "alice"},
+	})
+	if err != nil {
+		t.Fatalf("NewContentFilter returned error: %v", err)
+	}
+
+	post := &Post{
+		Title: "alice 的分享",
+		MainPost: PostEntry{
+			Author: Author{Username: "alice", UID: "7", Signature: "联系 QQ 12345"},
+			HTMLContent: `<p>正文</p><div class="ad">广告</div>` +
+				`<a href="https://cdn.tracker.example/x">track</a><img src="https://img.example/a.jpg"/>`,
+		},
+		Replies: []PostEntry{{
+			Author:      Author{Username: "bob", UID: "8"},
+			HTMLContent: `<blockquote>引用 alice 的发言</blockquote>QQ 678`,
+		}},
+	}
+	filter.Apply(post)
+
+	gf := post.MainPost
+	if strings.Contains(gf.HTMLContent, "广告") || strings.Contains(gf.HTMLContent, "tracker") {
+		t.Fatalf("expected the ad and tracker link to be removed, got %q", gf.HTMLContent)
+	}
+	if !strings.Contains(gf.HTMLContent, "<p>正文</p>") || !strings.Contains(gf.HTMLContent, "img.example/a.jpg") {
+		t.Fatalf("expected the remaining content to be kept, got %q", gf.HTMLContent)
+	}
+	if gf.Author.Username != defaultUserRedaction || gf.Author.UID != "" || gf.Author.Signature != "" {
+		t.Fatalf("expected alice's profile to be redacted, got %+v", gf.Author)
+	}
+	if post.Title != defaultUserRedaction+" 的分享" {
+		t.Fatalf("expected the title to be redacted, got %q", post.Title)
+	}
+
+	reply := post.Replies[0]
+	if reply.HTMLContent != `<blockquote>引用 `+defaultUserRedaction+` 的发言</blockquote>[QQ]` {
+		t.Fatalf("unexpected filtered reply %q", reply.HTMLContent)
+	}
+	if reply.Author.Username != "bob" || reply.Author.UID != "8" {
+		t.Fatalf("expected other authors to be kept, got %+v", reply.Author)
+	}
+}
+
+func TestNewContentFilterRejectsInvalidRules(t *testing.T) {
+	for _, rule := range []FilterRule{
+		{Kind: "unknown"},
+		{Kind: FilterKindCSS, Selector: "[["},
+		{Kind: FilterKindRegex, Pattern: "("},
+		{Kind: FilterKindHost},
+		{Kind: FilterKindUser},
+	} {
+		if _, err := NewContentFilter([]FilterRule{rule}); err == nil {
+			t.Fatalf("expected rule %+v to be rejected", rule)
+		}
+	}
+}
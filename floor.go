@@ -0,0 +1,129 @@
+package south2md
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// floorLabelPattern matches the floor labels the forum prints in each post
+// header ("GF" for the main post, "B12F" for replies).
+var floorLabelPattern = regexp.MustCompile(`^(?:GF|B(\d+)F)$`)
+
+// extractFloorLabel returns the forum's own floor label for a post table, or
+// "" when the page does not show one.
+func (p *PostParser) extractFloorLabel(table *DOMSelection) string {
+	label := table.Find(p.selectors.floorLabel)
+	if label.Length() == 0 {
+		return ""
+	}
+	text := strings.ToUpper(strings.TrimSpace(label.First().Text()))
+	if !floorLabelPattern.MatchString(text) {
+		return ""
+	}
+	return text
+}
+
+// floorOrdinal returns the reply ordinal of a "B<n>F" label.
+func floorOrdinal(label string) (int, bool) {
+	m := floorLabelPattern.FindStringSubmatch(label)
+	if len(m) < 2 || m[1] == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// findFloorGaps returns the reply ordinals missing between the labeled
+// replies, e.g. floors of a page that failed to fetch or were deleted.
+// Replies without a forum label are ignored.
+func findFloorGaps(replies []PostEntry) []int {
+	var gaps []int
+	next := 1
+	for _, reply := range replies {
+		n, ok := floorOrdinal(reply.Floor)
+		if !ok || n < next {
+			continue
+		}
+		for ; next < n; next++ {
+			gaps = append(gaps, next)
+		}
+		next = n + 1
+	}
+	return gaps
+}
+
+// Floor states recorded in PostEntry.Status; "" is a normal floor.
+const (
+	FloorStatusDeleted = "deleted"
+	FloorStatusBlocked = "blocked"
+)
+
+// blockedFloorMarkers are the notices the forum shows instead of a floor's
+// content when it was hidden by moderators or the author was banned.
+var blockedFloorMarkers = []string{
+	"该主题自动屏蔽",
+	"该帖被管理员或版主屏蔽",
+	"此帖被管理员屏蔽",
+	"用户被禁言",
+}
+
+var deletedFloorMarkers = []string{
+	"该楼层已被删除",
+	"此帖已被删除",
+}
+
+// maxFloorNoticeRunes bounds the content length that is checked for notices,
+// so replies merely quoting a notice are not mistaken for hidden floors.
+const maxFloorNoticeRunes = 80
+
+// detectFloorStatus classifies a floor from its content text.
+func detectFloorStatus(text string) string {
+	text = strings.TrimSpace(text)
+	if len([]rune(text)) > maxFloorNoticeRunes {
+		return ""
+	}
+	for _, marker := range blockedFloorMarkers {
+		if strings.Contains(text, marker) {
+			return FloorStatusBlocked
+		}
+	}
+	for _, marker := range deletedFloorMarkers {
+		if strings.Contains(text, marker) {
+			return FloorStatusDeleted
+		}
+	}
+	return ""
+}
+
+// fillDeletedFloors inserts placeholder entries for floors missing between
+// two labeled replies of the same page; the forum drops deleted floors from
+// the page while keeping the numbering. Gaps across pages are left alone as
+// they may come from pages that failed to fetch.
+func fillDeletedFloors(replies []PostEntry) []PostEntry {
+	filled := make([]PostEntry, 0, len(replies))
+	prev := -1
+	for i, reply := range replies {
+		n, ok := floorOrdinal(reply.Floor)
+		if ok && prev >= 0 && replies[i-1].SourcePage == reply.SourcePage {
+			for missing := prev + 1; missing < n; missing++ {
+				filled = append(filled, PostEntry{
+					Floor:      fmt.Sprintf("B%dF", missing),
+					SourcePage: reply.SourcePage,
+					Status:     FloorStatusDeleted,
+				})
+			}
+		}
+		if ok {
+			prev = n
+		} else {
+			prev = -1
+		}
+		filled = append(filled, reply)
+	}
+	return filled
+}
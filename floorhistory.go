@@ -0,0 +1,60 @@
+package south2md
+
+import (
+	"log/slog"
+	"time"
+)
+
+// FloorRevision is a previous version of a floor the author edited, kept in
+// the metadata's history section.
+type FloorRevision struct {
+	Floor       string    `toml:"floor"`        // 楼层标识
+	PostID      string    `toml:"post_id"`      // 帖子ID
+	ContentHash string    `toml:"content_hash"` // 旧内容的 SHA-256
+	HTMLContent string    `toml:"html_content"` // 旧的HTML内容
+	ReplacedAt  time.Time `toml:"replaced_at"`  // 发现新版本的时间
+}
+
+// stampContentHashes records the content hash of every floor of post.
+func stampContentHashes(post *Post) {
+	for _, entry := range postFloors(post) {
+		entry.Hash = entry.ContentHash()
+	}
+}
+
+// trackFloorEdits compares post, freshly extracted, with the previously
+// stored existing post. Floors whose content hash changed get EditedAt set to
+// now and their old version appended to the history; other floors keep the
+// edit mark and the history they already had. Deleted and blocked floors
+// aren't edits.
+func trackFloorEdits(existing, post *Post, now time.Time) {
+	oldFloors := floorsByLabel(existing)
+	history := existing.History
+	for i, entry := range postFloors(post) {
+		label := floorLabel(i, entry)
+		old, ok := oldFloors[label]
+		if !ok || old.Status != "" || entry.Status != "" {
+			continue
+		}
+		oldHash := old.Hash
+		if oldHash == "" {
+			oldHash = old.ContentHash()
+		}
+		if oldHash == entry.Hash {
+			if entry.EditedAt.IsZero() {
+				entry.EditedAt = old.EditedAt
+			}
+			continue
+		}
+		history = append(history, FloorRevision{
+			Floor:       label,
+			PostID:      old.PostID,
+			ContentHash: oldHash,
+			HTMLContent: old.HTMLContent,
+			ReplacedAt:  now,
+		})
+		entry.EditedAt = now
+		slog.Info("Floor was edited since the last fetch", "tid", post.TID, "floor", label)
+	}
+	post.History = history
+}
@@ -0,0 +1,68 @@
+package south2md
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStorePostRecordsFloorEdits(t *testing.T) {
+	root := t.TempDir()
+	g := NewMarkdownGenerator(&MarkdownOptions{}, nil)
+	g.SetDownloadEnabled(false)
+	newPost := func(reply string) *Post {
+		return &Post{
+			TID:      "100",
+			MainPost: PostEntry{Floor: "GF", PostID: "tpc", HTMLContent: "<p>main</p>"},
+			Replies: []PostEntry{
+				{Floor: "B1F", PostID: "1", HTMLContent: reply},
+				{Floor: "B2F", PostID: "2", HTMLContent: "<p>untouched</p>"},
+			},
+		}
+	}
+
+	if err := g.StorePost(newPost("<p>before</p>"), root); err != nil {
+		t.Fatalf("first StorePost returned error: %v", err)
+	}
+	stored, err := NewPostStore(root).LoadPostFromStore("100")
+	if err != nil {
+		t.Fatalf("LoadPostFromStore returned error: %v", err)
+	}
+	if stored.Replies[0].Hash == "" || len(stored.History) != 0 || !stored.Replies[0].EditedAt.IsZero() {
+		t.Fatalf("unexpected first snapshot: %+v", stored)
+	}
+
+	if err := g.StorePost(newPost("<p>after</p>"), root); err != nil {
+		t.Fatalf("second StorePost returned error: %v", err)
+	}
+	// A later fetch without further edits keeps the mark and the history.
+	post := newPost("<p>after</p>")
+	if err := g.StorePost(post, root); err != nil {
+		t.Fatalf("third StorePost returned error: %v", err)
+	}
+	stored, err = NewPostStore(root).LoadPostFromStore("100")
+	if err != nil {
+		t.Fatalf("LoadPostFromStore returned error: %v", err)
+	}
+	if len(stored.History) != 1 {
+		t.Fatalf("expected one revision, got %+v", stored.History)
+	}
+	revision := stored.History[0]
+	if revision.Floor != "B1F" || revision.PostID != "1" || revision.HTMLContent != "<p>before</p>" || revision.ReplacedAt.IsZero() {
+		t.Fatalf("unexpected revision: %+v", revision)
+	}
+	if stored.Replies[0].EditedAt.IsZero() || !stored.Replies[1].EditedAt.IsZero() || !stored.MainPost.EditedAt.IsZero() {
+		t.Fatalf("expected only B1F to be marked edited: %+v", stored.Replies)
+	}
+	if stored.Replies[0].EditedAt.After(time.Now()) {
+		t.Fatalf("unexpected edit time %v", stored.Replies[0].EditedAt)
+	}
+
+	markdown, err := g.GenerateMarkdown(stored)
+	if err != nil {
+		t.Fatalf("GenerateMarkdown returned error: %v", err)
+	}
+	if strings.Count(markdown, "*(已编辑)*") != 1 {
+		t.Fatalf("expected one edited marker:\n%s", markdown)
+	}
+}
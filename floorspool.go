@@ -0,0 +1,255 @@
+package south2md
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SpoolDirName holds the floor spools of streaming fetches. Its leading dot
+// keeps it apart from thread directories.
+const SpoolDirName = ".spool"
+
+// FloorSpool is an append-only JSON Lines file of extracted floors. A
+// streaming fetch appends every page's floors as soon as they are extracted
+// and reads them back once to assemble the post, so no page document is kept
+// in memory.
+type FloorSpool struct {
+	path  string
+	file  *os.File
+	w     *bufio.Writer
+	count int
+}
+
+// CreateFloorSpool creates (or truncates) the spool at path.
+func CreateFloorSpool(path string) (*FloorSpool, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create spool dir: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create floor spool: %w", err)
+	}
+	return &FloorSpool{path: path, file: file, w: bufio.NewWriter(file)}, nil
+}
+
+// Path returns the spool file path.
+func (s *FloorSpool) Path() string {
+	return s.path
+}
+
+// Len returns the number of floors appended so far.
+func (s *FloorSpool) Len() int {
+	return s.count
+}
+
+// Append writes entry to the spool.
+func (s *FloorSpool) Append(entry PostEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode floor %s: %w", entry.Floor, err)
+	}
+	data = append(data, '\n')
+	if _, err := s.w.Write(data); err != nil {
+		return fmt.Errorf("failed to write floor spool: %w", err)
+	}
+	s.count++
+	return nil
+}
+
+// Flush writes buffered floors to the file; called after every page.
+func (s *FloorSpool) Flush() error {
+	if err := s.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write floor spool: %w", err)
+	}
+	return nil
+}
+
+// Each flushes the spool and calls fn for every floor in append order.
+func (s *FloorSpool) Each(fn func(PostEntry) error) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	return ReadFloorSpool(s.path, fn)
+}
+
+// Close flushes and closes the spool file; the file is kept.
+func (s *FloorSpool) Close() error {
+	flushErr := s.Flush()
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	return flushErr
+}
+
+// Remove closes and deletes the spool file.
+func (s *FloorSpool) Remove() error {
+	s.file.Close()
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// ReadFloorSpool calls fn for every floor of the spool at path.
+func ReadFloorSpool(path string, fn func(PostEntry) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open floor spool: %w", err)
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var entry PostEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to decode floor spool %s: %w", path, err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// SpoolPath returns the floor spool path of tid.
+func (ps *PostStore) SpoolPath(tid string) string {
+	return filepath.Join(ps.rootDir, SpoolDirName, SanitizePathComponent(tid)+".jsonl")
+}
+
+// FetchPostStreaming fetches tid like FetchPostWithPaginationContext, but
+// with bounded memory for huge threads: pages are fetched one at a time and
+// pages after the first are extracted with ExtractFloors straight from the
+// response, appending their floors to spool. Only page 1 is parsed into
+// postParser, for the thread header and page count. The post is assembled
+// from the spool at the end. Pagination always follows the page count.
+func (f *Fetcher) FetchPostStreaming(ctx context.Context, tid string, postParser *PostParser, spool *FloorSpool) (post *Post, err error) {
+	if tid == "" {
+		return nil, NewValidationError("TID不能为空")
+	}
+	ctx, span := startSpan(ctx, "south2md.fetch_thread", attribute.String("south2md.tid", tid), attribute.Bool("south2md.streaming", true))
+	defer func() {
+		if post != nil {
+			span.SetAttributes(
+				attribute.Int("south2md.total_pages", post.TotalPages),
+				attribute.Int("south2md.missing_pages", len(post.MissingPages)),
+				attribute.Int("south2md.replies", len(post.Replies)),
+			)
+		}
+		endSpan(span, err)
+	}()
+	if f.config.Pagination == PaginationNext {
+		slog.Warn("Streaming extraction follows the page count, ignoring next-link pagination", "tid", tid)
+	}
+
+	f.mirrors.track(tid)
+	defer f.mirrors.take(tid)
+
+	firstPageHTML, err := f.fetchPage(ctx, tid, 1)
+	if err != nil {
+		return nil, fmt.Errorf("获取帖子第一页失败: %v", err)
+	}
+	if err := parsePageTraced(ctx, postParser, 1, firstPageHTML); err != nil {
+		return nil, fmt.Errorf("解析第一页HTML失败: %v", err)
+	}
+	f.handleRawPage(tid, 1, firstPageHTML)
+	if err := f.checkAccess(postParser); err != nil {
+		return nil, err
+	}
+	totalPages := max(f.extractTotalPages(postParser), 1)
+
+	post, err = postParser.ExtractPost()
+	if err != nil {
+		return nil, fmt.Errorf("提取第一页数据失败: %w", err)
+	}
+	for _, reply := range post.Replies {
+		if err := spool.Append(reply); err != nil {
+			return nil, err
+		}
+	}
+	post.Replies = nil
+	if err := spool.Flush(); err != nil {
+		return nil, err
+	}
+
+	var failedPages []int
+	for page := 2; page <= totalPages; page++ {
+		if err := f.streamPage(ctx, tid, page, postParser.selectors, spool); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			slog.Error("Failed to fetch post page", "page", page, "error", err)
+			failedPages = append(failedPages, page)
+		}
+	}
+	if _, err := resolvePageFetchResults(nil, failedPages, f.config.StrictPagination); err != nil {
+		return nil, err
+	}
+
+	replies := make([]PostEntry, 0, spool.Len())
+	if err := spool.Each(func(entry PostEntry) error {
+		replies = append(replies, entry)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	post.Replies = fillDeletedFloors(replies)
+	post.TotalFloors = 1 + len(post.Replies)
+	post.MissingFloors = findFloorGaps(post.Replies)
+	if len(post.MissingFloors) > 0 {
+		slog.Warn("Thread has gaps in floor numbering", "missing_floors", len(post.MissingFloors), "first", post.MissingFloors[0])
+	}
+	post.TID = tid
+	post.TotalPages = totalPages
+	post.MissingPages = failedPages
+	post.PageMirrors = f.mirrors.take(tid)
+	return post, nil
+}
+
+// streamPage fetches one page after the first and appends its replies to
+// spool. Like ExtractReplies, a leading table labelled GF (the main post
+// repeated on every page) is skipped. A page that fails halfway leaves its
+// floors out of the spool.
+func (f *Fetcher) streamPage(ctx context.Context, tid string, page int, selectors htmlSelectors, spool *FloorSpool) error {
+	html, err := f.fetchPage(ctx, tid, page)
+	if err != nil {
+		return err
+	}
+	f.handleRawPage(tid, page, html)
+
+	ctx, span := startSpan(ctx, "south2md.parse_page", attribute.Int("south2md.page", page))
+	parser := NewPostParser()
+	parser.selectors = selectors
+	parser.SetPage(page)
+	var floors []PostEntry
+	first := true
+	err = parser.ExtractFloors(ctx, strings.NewReader(html), func(entry PostEntry) error {
+		if first && entry.Floor == "GF" {
+			first = false
+			return nil
+		}
+		first = false
+		floors = append(floors, entry)
+		return nil
+	})
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+	for _, entry := range floors {
+		if err := spool.Append(entry); err != nil {
+			return err
+		}
+	}
+	return spool.Flush()
+}
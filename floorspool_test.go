@@ -0,0 +1,71 @@
+package south2md
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchPostStreamingMatchesPaginatedFetch(t *testing.T) {
+	fixture, err := os.ReadFile("tid-2636739.html")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	page := strings.Replace(string(fixture), "</body>", `<a href="read.php?tid-2636739-page-3.html">3</a></body>`, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.RawQuery, "page-2") {
+			http.Error(w, "gone", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(page))
+	}))
+	defer srv.Close()
+
+	options := &HTTPOptions{Timeout: 5 * time.Second, MaxConcurrent: 2}
+	want, err := NewFetcher(srv.Client(), options, srv.URL).FetchPostWithPagination("2636739", NewPostParser())
+	if err != nil {
+		t.Fatalf("FetchPostWithPagination returned error: %v", err)
+	}
+
+	spool, err := CreateFloorSpool(filepath.Join(t.TempDir(), SpoolDirName, "2636739.jsonl"))
+	if err != nil {
+		t.Fatalf("CreateFloorSpool returned error: %v", err)
+	}
+	defer spool.Remove()
+	got, err := NewFetcher(srv.Client(), options, srv.URL).FetchPostStreaming(context.Background(), "2636739", NewPostParser(), spool)
+	if err != nil {
+		t.Fatalf("FetchPostStreaming returned error: %v", err)
+	}
+
+	if got.TotalPages != 3 || len(got.MissingPages) != 1 || got.MissingPages[0] != 2 {
+		t.Fatalf("expected page 2 of 3 missing, got total=%d missing=%v", got.TotalPages, got.MissingPages)
+	}
+	if got.Title != want.Title || got.MainPost.HTMLContent != want.MainPost.HTMLContent {
+		t.Fatalf("header differs: %q vs %q", got.Title, want.Title)
+	}
+	if len(want.Replies) <= 4 || len(got.Replies) != len(want.Replies) || spool.Len() != len(want.Replies) {
+		t.Fatalf("expected %d replies, got %d (spooled %d)", len(want.Replies), len(got.Replies), spool.Len())
+	}
+	for i := range want.Replies {
+		if got.Replies[i].Floor != want.Replies[i].Floor || got.Replies[i].SourcePage != want.Replies[i].SourcePage ||
+			got.Replies[i].HTMLContent != want.Replies[i].HTMLContent {
+			t.Fatalf("reply %d differs: %s/p%d vs %s/p%d", i, got.Replies[i].Floor, got.Replies[i].SourcePage,
+				want.Replies[i].Floor, want.Replies[i].SourcePage)
+		}
+	}
+
+	options.StrictPagination = true
+	strictSpool, err := CreateFloorSpool(filepath.Join(t.TempDir(), "strict.jsonl"))
+	if err != nil {
+		t.Fatalf("CreateFloorSpool returned error: %v", err)
+	}
+	defer strictSpool.Remove()
+	if _, err := NewFetcher(srv.Client(), options, srv.URL).FetchPostStreaming(context.Background(), "2636739", NewPostParser(), strictSpool); err == nil {
+		t.Fatal("expected strict pagination to fail on the missing page")
+	}
+}
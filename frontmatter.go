@@ -0,0 +1,61 @@
+package south2md
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"go.yaml.in/yaml/v3"
+)
+
+// postFrontMatter is the metadata block prepended to post.md when front
+// matter is enabled.
+type postFrontMatter struct {
+	TID       string    `yaml:"tid"`
+	Title     string    `yaml:"title"`
+	URL       string    `yaml:"url,omitempty"`
+	Forum     string    `yaml:"forum,omitempty"`
+	Prefixes  []string  `yaml:"prefixes,omitempty"`
+	Author    string    `yaml:"author,omitempty"`
+	CreatedAt time.Time `yaml:"created_at"`
+	Floors    int       `yaml:"floors"`
+	Views     int       `yaml:"views,omitempty"`
+	Replies   int       `yaml:"replies,omitempty"`
+	Tags      []string  `yaml:"tags,omitempty"`
+}
+
+// newPostFrontMatter collects the front matter fields of post.
+func newPostFrontMatter(post *Post, floors int) postFrontMatter {
+	return postFrontMatter{
+		TID:       post.TID,
+		Title:     post.Title,
+		URL:       post.URL,
+		Forum:     post.Forum,
+		Prefixes:  post.Prefixes,
+		Author:    post.MainPost.Author.Username,
+		CreatedAt: post.CreatedAt,
+		Floors:    floors,
+		Views:     post.Views,
+		Replies:   post.ReplyCount,
+		Tags:      post.Tags,
+	}
+}
+
+// formatYAMLFrontMatter encodes v as a "---"-delimited YAML front matter block.
+func formatYAMLFrontMatter(v any) (string, error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode front matter: %w", err)
+	}
+	return "---\n" + string(data) + "---\n", nil
+}
+
+// formatTOMLFrontMatter encodes v as a "+++"-delimited TOML front matter block.
+func formatTOMLFrontMatter(v any) (string, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+		return "", fmt.Errorf("failed to encode front matter: %w", err)
+	}
+	return "+++\n" + buf.String() + "+++\n", nil
+}
@@ -0,0 +1,327 @@
+package south2md
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GC reasons reported in GCAction.Reason.
+const (
+	GCReasonExpired = "expired"       // thread not accessed within MaxAge
+	GCReasonQuota   = "quota"         // evicted to bring the store under MaxSize
+	GCReasonOrphan  = "orphan"        // asset not referenced by metadata
+	GCReasonStaging = "stale_staging" // staging dir left without a journal entry
+)
+
+const metadataFileName = "metadata.toml"
+
+// GCOptions selects the garbage collection policies. Zero values disable
+// the corresponding policy.
+type GCOptions struct {
+	MaxAge       time.Duration // delete threads not accessed for this long
+	MaxSize      int64         // evict least recently accessed threads above this many bytes
+	PruneOrphans bool          // delete image/gofile files not referenced by metadata
+	DryRun       bool          // only report what would be deleted
+}
+
+// GCAction is one deletion performed (or planned, in a dry run) by GC.
+type GCAction struct {
+	TID    string
+	Path   string
+	Size   int64
+	Reason string
+}
+
+// GCReport summarizes a GC run.
+type GCReport struct {
+	Actions   []GCAction
+	Freed     int64
+	SizeAfter int64    // store size once the actions are applied
+	Skipped   []string // threads left alone because another process holds them
+}
+
+// storedThread is one thread dir considered by GC.
+type storedThread struct {
+	tid        string
+	size       int64
+	accessedAt time.Time
+}
+
+// GC applies opts to the store: orphan pruning first, then age expiry and
+// LRU quota eviction by last access (see LoadPostFromStore). Threads locked
+// by another process are skipped. Images hard-linked between threads count
+// towards each of them.
+func (ps *PostStore) GC(opts GCOptions) (*GCReport, error) {
+	if ps == nil {
+		return nil, fmt.Errorf("post store is nil")
+	}
+	threads, err := ps.storedThreads()
+	if err != nil {
+		return nil, err
+	}
+	report := &GCReport{}
+	now := time.Now()
+
+	remove := func(action GCAction) error {
+		report.Actions = append(report.Actions, action)
+		report.Freed += action.Size
+		if opts.DryRun {
+			return nil
+		}
+		if err := os.RemoveAll(action.Path); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", action.Path, err)
+		}
+		slog.Info("Garbage collected", "tid", action.TID, "path", action.Path, "reason", action.Reason)
+		return nil
+	}
+
+	// withLock runs fn while holding tid's lock, skipping busy threads.
+	withLock := func(tid string, fn func() error) error {
+		lock, err := ps.lock(tid, 0)
+		if errors.Is(err, ErrStoreLocked) {
+			report.Skipped = append(report.Skipped, tid)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+		return fn()
+	}
+
+	if opts.PruneOrphans {
+		for i := range threads {
+			thread := &threads[i]
+			err := withLock(thread.tid, func() error {
+				orphans, err := ps.orphanedAssets(thread.tid)
+				if err != nil {
+					slog.Warn("Skipping orphan scan", "tid", thread.tid, "error", err)
+					return nil
+				}
+				for _, orphan := range orphans {
+					if err := remove(orphan); err != nil {
+						return err
+					}
+					thread.size -= orphan.Size
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := ps.staleStaging(remove); err != nil {
+			return nil, err
+		}
+	}
+
+	// Least recently accessed first, so quota eviction follows LRU order.
+	sort.Slice(threads, func(i, j int) bool { return threads[i].accessedAt.Before(threads[j].accessedAt) })
+	var total int64
+	for _, thread := range threads {
+		total += thread.size
+	}
+
+	for _, thread := range threads {
+		reason := ""
+		switch {
+		case opts.MaxAge > 0 && now.Sub(thread.accessedAt) > opts.MaxAge:
+			reason = GCReasonExpired
+		case opts.MaxSize > 0 && total > opts.MaxSize:
+			reason = GCReasonQuota
+		default:
+			continue
+		}
+		deleted := false
+		err := withLock(thread.tid, func() error {
+			deleted = true
+			if err := remove(GCAction{TID: thread.tid, Path: ps.PostDir(thread.tid), Size: thread.size, Reason: reason}); err != nil {
+				return err
+			}
+			if opts.DryRun {
+				return nil
+			}
+			return ps.removeFromCatalog(thread.tid)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if deleted {
+			total -= thread.size
+		}
+	}
+	report.SizeAfter = total
+	return report, nil
+}
+
+// storedThreads lists the thread dirs of the store with their size and last
+// access time.
+func (ps *PostStore) storedThreads() ([]storedThread, error) {
+	tids, err := ps.threadIDs()
+	if err != nil {
+		return nil, err
+	}
+	threads := make([]storedThread, 0, len(tids))
+	for _, tid := range tids {
+		info, err := os.Stat(filepath.Join(ps.PostDir(tid), metadataFileName))
+		if err != nil {
+			continue
+		}
+		size, err := dirSize(ps.PostDir(tid))
+		if err != nil {
+			return nil, err
+		}
+		threads = append(threads, storedThread{tid: tid, size: size, accessedAt: info.ModTime()})
+	}
+	return threads, nil
+}
+
+// threadIDs lists the TIDs of the store's thread dirs, i.e. the dirs holding
+// a metadata.toml, in directory order. Templated dir names are mapped back to
+// their TIDs through the index.
+func (ps *PostStore) threadIDs() ([]string, error) {
+	entries, err := os.ReadDir(ps.rootDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store: %w", err)
+	}
+
+	indexed := ps.indexedDirs()
+	var tids []string
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(ps.rootDir, entry.Name(), metadataFileName)); err != nil {
+			continue // not a stored thread
+		}
+		tid := entry.Name()
+		if indexedTID, ok := indexed[tid]; ok {
+			tid = indexedTID
+		}
+		tids = append(tids, tid)
+	}
+	return tids, nil
+}
+
+// touch marks tid as accessed now for GC's age and LRU policies.
+func (ps *PostStore) touch(tid string) {
+	now := time.Now()
+	if err := os.Chtimes(filepath.Join(ps.PostDir(tid), metadataFileName), now, now); err != nil {
+		slog.Debug("Failed to record thread access", "tid", tid, "error", err)
+	}
+}
+
+// orphanedAssets lists the files under images/ and the gofile share dirs of
+// tid that its metadata doesn't reference.
+func (ps *PostStore) orphanedAssets(tid string) ([]GCAction, error) {
+	post, err := ps.readPost(tid)
+	if err != nil {
+		return nil, err
+	}
+	dir := ps.PostDir(tid)
+	var orphans []GCAction
+
+	referenced := make(map[string]bool, len(post.Images))
+	for _, image := range post.Images {
+		referenced[image.Local] = true
+	}
+	images, err := os.ReadDir(filepath.Join(dir, "images"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	for _, entry := range images {
+		if entry.IsDir() || referenced[entry.Name()] {
+			continue
+		}
+		path := filepath.Join(dir, "images", entry.Name())
+		size, _ := dirSize(path)
+		orphans = append(orphans, GCAction{TID: tid, Path: path, Size: size, Reason: GCReasonOrphan})
+	}
+
+	// Only scan gofile dirs the metadata knows about, since the download dir
+	// name is configurable.
+	shares := make(map[string]bool)
+	parents := make(map[string]bool)
+	for _, record := range post.GofileFiles {
+		if record.LocalDir == "" {
+			continue
+		}
+		shares[filepath.FromSlash(record.LocalDir)] = true
+		parents[filepath.Dir(filepath.FromSlash(record.LocalDir))] = true
+	}
+	for parent := range parents {
+		entries, err := os.ReadDir(filepath.Join(dir, parent))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			rel := filepath.Join(parent, entry.Name())
+			if !entry.IsDir() || shares[rel] {
+				continue
+			}
+			path := filepath.Join(dir, rel)
+			size, _ := dirSize(path)
+			orphans = append(orphans, GCAction{TID: tid, Path: path, Size: size, Reason: GCReasonOrphan})
+		}
+	}
+	return orphans, nil
+}
+
+// staleStaging removes staging dirs that no journal entry accounts for.
+func (ps *PostStore) staleStaging(remove func(GCAction) error) error {
+	entries, err := os.ReadDir(filepath.Join(ps.rootDir, StagingDirName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read staging dir: %w", err)
+	}
+	for _, entry := range entries {
+		tid := strings.TrimSuffix(entry.Name(), ".old")
+		journal, err := ps.readJournal(tid)
+		if err != nil || journal != nil {
+			continue
+		}
+		lock, err := ps.lock(tid, 0)
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(ps.rootDir, StagingDirName, entry.Name())
+		size, _ := dirSize(path)
+		err = remove(GCAction{TID: tid, Path: path, Size: size, Reason: GCReasonStaging})
+		lock.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dirSize returns the total size of the regular files under path.
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
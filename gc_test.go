@@ -0,0 +1,126 @@
+package south2md
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// writeGCTestThread stores tid with one referenced image, one orphan and
+// metadata last accessed age ago.
+func writeGCTestThread(t *testing.T, store *PostStore, tid string, age time.Duration) {
+	t.Helper()
+	dir := store.PostDir(tid)
+	if err := os.MkdirAll(filepath.Join(dir, "images"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	post := &Post{TID: tid, Images: []Image{{URL: "https://img.example.com/a.jpg", Local: "a.jpg", Downloaded: true}}}
+	data, err := toml.Marshal(post)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	files := map[string]string{
+		metadataFileName:                 string(data),
+		filepath.Join("images", "a.jpg"): "0123456789",
+		filepath.Join("images", "b.jpg"): "orphan",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	accessed := time.Now().Add(-age)
+	if err := os.Chtimes(filepath.Join(dir, metadataFileName), accessed, accessed); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+}
+
+func TestGCDryRunReportsWithoutDeleting(t *testing.T) {
+	store := NewPostStore(t.TempDir())
+	writeGCTestThread(t, store, "100", 100*24*time.Hour)
+	writeGCTestThread(t, store, "200", time.Hour)
+
+	report, err := store.GC(GCOptions{MaxAge: 30 * 24 * time.Hour, PruneOrphans: true, DryRun: true})
+	if err != nil {
+		t.Fatalf("GC returned error: %v", err)
+	}
+	reasons := map[string]int{}
+	for _, action := range report.Actions {
+		reasons[action.Reason]++
+	}
+	if reasons[GCReasonOrphan] != 2 || reasons[GCReasonExpired] != 1 {
+		t.Fatalf("unexpected actions: %+v", report.Actions)
+	}
+	for _, path := range []string{store.PostDir("100"), filepath.Join(store.PostDir("200"), "images", "b.jpg")} {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("dry run must not delete %s: %v", path, err)
+		}
+	}
+}
+
+func TestGCPrunesOrphansAndEvictsLeastRecentlyAccessed(t *testing.T) {
+	store := NewPostStore(t.TempDir())
+	writeGCTestThread(t, store, "100", 3*time.Hour)
+	writeGCTestThread(t, store, "200", 2*time.Hour)
+	writeGCTestThread(t, store, "300", time.Hour)
+
+	// Loading a thread counts as an access and protects it from eviction.
+	if _, err := store.LoadPostFromStore("100"); err != nil {
+		t.Fatalf("LoadPostFromStore returned error: %v", err)
+	}
+
+	sizes, err := store.storedThreads()
+	if err != nil {
+		t.Fatalf("storedThreads returned error: %v", err)
+	}
+	threadSize := sizes[0].size - int64(len("orphan"))
+	if _, _, err := QueryCatalog(store.RootDir(), CatalogQuery{}); err != nil {
+		t.Fatalf("QueryCatalog returned error: %v", err)
+	}
+
+	report, err := store.GC(GCOptions{MaxSize: 2 * threadSize, PruneOrphans: true})
+	if err != nil {
+		t.Fatalf("GC returned error: %v", err)
+	}
+	if _, err := os.Stat(store.PostDir("200")); !os.IsNotExist(err) {
+		t.Fatalf("expected least recently accessed thread 200 to be evicted, stat: %v", err)
+	}
+	for _, tid := range []string{"100", "300"} {
+		if _, err := os.Stat(filepath.Join(store.PostDir(tid), "images", "a.jpg")); err != nil {
+			t.Fatalf("expected referenced image of %s to stay: %v", tid, err)
+		}
+		if _, err := os.Stat(filepath.Join(store.PostDir(tid), "images", "b.jpg")); !os.IsNotExist(err) {
+			t.Fatalf("expected orphan of %s to be pruned, stat: %v", tid, err)
+		}
+	}
+	if report.SizeAfter != 2*threadSize {
+		t.Fatalf("SizeAfter = %d, want %d", report.SizeAfter, 2*threadSize)
+	}
+	catalog, _, err := QueryCatalog(store.RootDir(), CatalogQuery{})
+	if err != nil {
+		t.Fatalf("QueryCatalog returned error: %v", err)
+	}
+	if len(catalog) != 2 || catalog[0].TID != "100" || catalog[1].TID != "300" {
+		t.Fatalf("expected evicted thread to leave the catalog, got %+v", catalog)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for input, want := range map[string]int64{
+		"1024":   1024,
+		"512MB":  512 << 20,
+		"20 GiB": 20 << 30,
+		"1.5k":   1536,
+	} {
+		got, err := ParseByteSize(input)
+		if err != nil || got != want {
+			t.Fatalf("ParseByteSize(%q) = %d, %v; want %d", input, got, err, want)
+		}
+	}
+	if _, err := ParseByteSize("lots"); err == nil {
+		t.Fatal("expected error for invalid size")
+	}
+}
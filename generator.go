@@ -1,13 +1,15 @@
 package south2md
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
-	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // MarkdownGenerator Markdown生成器
@@ -15,17 +17,30 @@ type MarkdownGenerator struct {
 	formatter     *MarkdownFormatter
 	imageHandler  *ImageHandler
 	gofileHandler *GofileHandler
+	summary       *RunSummary
+	profiles      ProfileFetcher // fetches author profiles for authors.toml; nil means none
 }
 
 // NewMarkdownGenerator creates a new markdown generator.
 func NewMarkdownGenerator(options *MarkdownOptions, gofileHandler *GofileHandler) *MarkdownGenerator {
+	summary := NewRunSummary()
+	gofileHandler.SetRunSummary(summary)
 	return &MarkdownGenerator{
 		formatter:     NewMarkdownFormatter(options),
 		imageHandler:  NewImageHandler("images"),
 		gofileHandler: gofileHandler,
+		summary:       summary,
 	}
 }
 
+// Summary returns the run summary collecting policy decisions made while generating.
+func (g *MarkdownGenerator) Summary() *RunSummary {
+	if g == nil {
+		return nil
+	}
+	return g.summary
+}
+
 // SetDownloadEnabled controls whether generator may download missing assets while rendering.
 func (g *MarkdownGenerator) SetDownloadEnabled(enabled bool) {
 	if g == nil {
@@ -37,39 +52,167 @@ func (g *MarkdownGenerator) SetDownloadEnabled(enabled bool) {
 	}
 }
 
-// GenerateMarkdown 生成完整的Markdown文档
-func (g *MarkdownGenerator) GenerateMarkdown(post *Post) (string, error) {
-	var md strings.Builder
+// SetWaybackFallback controls whether images whose origin answers 404/410
+// are downloaded from an archive.org snapshot instead.
+func (g *MarkdownGenerator) SetWaybackFallback(enabled bool) {
+	if g == nil {
+		return
+	}
+	g.imageHandler.SetWaybackFallback(enabled)
+}
+
+// SetImageClassifier tags newly cached images with classifier and
+// quarantines those tagged with one of quarantineTags; nil disables it.
+func (g *MarkdownGenerator) SetImageClassifier(classifier ImageClassifier, quarantineTags []string) {
+	if g == nil {
+		return
+	}
+	g.imageHandler.SetImageClassifier(classifier, quarantineTags)
+}
+
+// SetAttachmentFetcher downloads floor attachments through fetcher, usually
+// the cookie-aware Fetcher; see ImageHandler.SetAttachmentFetcher.
+func (g *MarkdownGenerator) SetAttachmentFetcher(fetcher AttachmentFetcher, maxSize int64) {
+	if g == nil {
+		return
+	}
+	g.imageHandler.SetAttachmentFetcher(fetcher, maxSize)
+}
 
-	// 文档标题
-	md.WriteString(g.formatter.FormatTitle(post.Title))
+// SetDownloadLimits skips images larger than maxFileSize bytes (0 means no
+// limit) and applies guard to image, attachment and gofile downloads.
+func (g *MarkdownGenerator) SetDownloadLimits(maxFileSize int64, guard *DownloadGuard) {
+	if g == nil {
+		return
+	}
+	g.imageHandler.SetDownloadLimits(maxFileSize, guard)
+	if g.gofileHandler != nil {
+		g.gofileHandler.SetDownloadGuard(guard)
+	}
+}
 
-	md.WriteString("----\n\n")
+// SetImageSkipRules leaves the images matching rules as remote links in
+// post.md instead of downloading them.
+func (g *MarkdownGenerator) SetImageSkipRules(rules ImageSkipRules) error {
+	if g == nil {
+		return nil
+	}
+	return g.imageHandler.SetImageSkipRules(rules)
+}
 
-	// 主楼内容
-	mainPostContent, err := g.formatter.FormatPostEntry(post.TID, post.MainPost, 0, "0", post, g.imageHandler, g.gofileHandler)
-	if err != nil {
-		return "", fmt.Errorf("failed to format main post: %w", err)
+// SetAvatars makes StorePost and ExportPost download the avatars of a
+// thread's authors into its avatars dir.
+func (g *MarkdownGenerator) SetAvatars(enabled bool) {
+	if g == nil {
+		return
 	}
-	md.WriteString(mainPostContent)
-	md.WriteString("\n")
+	g.imageHandler.SetAvatars(enabled)
+}
 
-	// 回复内容
-	if len(post.Replies) > 0 {
-		for i, reply := range post.Replies {
-			replyContent, err := g.formatter.FormatPostEntry(post.TID, reply, i+1, reply.Floor, post, g.imageHandler, g.gofileHandler)
-			if err != nil {
-				return "", fmt.Errorf("failed to format reply %d: %w", i, err)
-			}
-			md.WriteString(replyContent)
-			md.WriteString("\n")
-		}
+// SetVerifyChecksums makes reused images and attachments pass a SHA-256
+// check, not just a size check, before they are kept; see
+// ImageHandler.SetVerifyChecksums.
+func (g *MarkdownGenerator) SetVerifyChecksums(enabled bool) {
+	if g == nil {
+		return
+	}
+	g.imageHandler.SetVerifyChecksums(enabled)
+}
+
+// SetHTTPDoer routes image and gofile downloads through doer, typically the
+// Fetcher's client so downloads share its proxy and transport.
+func (g *MarkdownGenerator) SetHTTPDoer(doer HTTPDoer) {
+	if g == nil {
+		return
+	}
+	g.imageHandler.SetHTTPDoer(doer)
+	if g.gofileHandler != nil {
+		g.gofileHandler.SetHTTPDoer(doer)
+	}
+}
+
+// SetMetrics records image and gofile download metrics into metrics.
+func (g *MarkdownGenerator) SetMetrics(metrics *Metrics) {
+	if g == nil {
+		return
+	}
+	g.imageHandler.SetMetrics(metrics)
+	if g.gofileHandler != nil {
+		g.gofileHandler.SetMetrics(metrics)
+	}
+}
+
+// SetImageDownloadHandler registers fn to receive every image downloaded;
+// see ImageHandler.SetDownloadHandler.
+func (g *MarkdownGenerator) SetImageDownloadHandler(fn ImageDownloadHandler) {
+	if g == nil {
+		return
 	}
+	g.imageHandler.SetDownloadHandler(fn)
+}
 
-	// 文档尾部信息
-	md.WriteString(g.formatter.FormatFooter())
+// SetAssetRegistry shares a store-wide asset registry with the image handler.
+// It is used whenever StorePost/ExportPost write into the registry's root.
+func (g *MarkdownGenerator) SetAssetRegistry(registry *AssetRegistry) {
+	if g == nil {
+		return
+	}
+	g.imageHandler.SetAssetRegistry(registry)
+}
+
+// GenerateMarkdown 生成完整的Markdown文档
+func (g *MarkdownGenerator) GenerateMarkdown(post *Post) (string, error) {
+	entries, err := g.renderEntries(post)
+	if err != nil {
+		return "", err
+	}
+	entries = g.arrangeEntries(post, entries)
 
-	return md.String(), nil
+	doc, err := g.newTemplateDocument(post, entries, true)
+	if err != nil {
+		return "", err
+	}
+	return g.formatter.FormatDocument(doc)
+}
+
+// newTemplateDocument builds the template data for entries, including the
+// TOC and (when enabled and whole) the front matter block and the author
+// appendix. whole is false for the parts of a split post, whose index holds
+// those instead.
+func (g *MarkdownGenerator) newTemplateDocument(post *Post, entries []renderedEntry, whole bool) (TemplateDocument, error) {
+	doc := TemplateDocument{
+		Post:        post,
+		Floors:      make([]TemplateFloor, 0, len(entries)),
+		GeneratedAt: g.generatedAt(),
+	}
+	for _, e := range entries {
+		floor := TemplateFloor{
+			Post:    post,
+			Entry:   e.Entry,
+			Index:   e.Index,
+			Floor:   e.Floor,
+			Content: e.Content,
+			Depth:   e.Depth,
+		}
+		if floor.Depth > 0 {
+			floor.Content = quoteLines(floor.Content, floor.Indent())
+		}
+		doc.Floors = append(doc.Floors, floor)
+	}
+	doc.TOC = g.formatter.FormatTOC(doc.Floors)
+	doc.Popular = g.formatter.FormatPopularReplies(doc.Floors)
+	if whole {
+		doc.Authors = g.formatter.FormatAuthorStats(doc.Floors)
+		doc.Mentions = g.formatter.FormatMentionIndex(doc.Floors)
+	}
+	if whole && g.formatter.options.FrontMatter {
+		frontMatter, err := formatYAMLFrontMatter(newPostFrontMatter(post, len(entries)))
+		if err != nil {
+			return doc, err
+		}
+		doc.FrontMatter = frontMatter
+	}
+	return doc, nil
 }
 
 func (g *MarkdownGenerator) preparePostDir(post *Post, baseDir string) (string, string, error) {
@@ -79,10 +222,11 @@ func (g *MarkdownGenerator) preparePostDir(post *Post, baseDir string) (string,
 	}
 
 	// 创建以TID命名的目录
-	tidDir := filepath.Join(baseDir, post.TID)
+	tidDir := threadDir(baseDir, post.TID)
 	if err := os.MkdirAll(tidDir, 0755); err != nil {
 		return "", "", fmt.Errorf("创建目录失败: %v", err)
 	}
+	g.imageHandler.guard.forget(tidDir)
 
 	imagesDir := filepath.Join(tidDir, "images")
 	gofileDir := filepath.Join(tidDir, "gofile")
@@ -94,7 +238,12 @@ func (g *MarkdownGenerator) preparePostDir(post *Post, baseDir string) (string,
 		return "", "", fmt.Errorf("创建gofile目录失败: %v", err)
 	}
 
-	// 检查是否存在现有metadata，如果存在则加载图片缓存信息
+	stampContentHashes(post)
+	BuildReplyTree(post)
+	post.Mentions = ExtractMentions(post)
+	post.CloudLinks = ExtractCloudLinks(post)
+
+	// 检查是否存在现有metadata，如果存在则加载图片缓存信息并检测楼层编辑
 	metadataFile := filepath.Join(tidDir, "metadata.toml")
 	if _, err := os.Stat(metadataFile); err == nil {
 		data, err := os.ReadFile(metadataFile)
@@ -104,6 +253,9 @@ func (g *MarkdownGenerator) preparePostDir(post *Post, baseDir string) (string,
 			if err == nil {
 				post.Images = existingPost.Images
 				post.GofileFiles = existingPost.GofileFiles
+				post.Tags = MergeTags(existingPost.Tags, post.Tags...)
+				post.WaybackSnapshots = mergeWaybackSnapshots(existingPost.WaybackSnapshots, post.WaybackSnapshots)
+				trackFloorEdits(&existingPost, post, time.Now())
 				slog.Info("Loaded existing image cache from metadata", "count", len(post.Images))
 			} else {
 				slog.Warn("Failed to unmarshal existing metadata", "error", err)
@@ -115,29 +267,185 @@ func (g *MarkdownGenerator) preparePostDir(post *Post, baseDir string) (string,
 	return tidDir, metadataFile, nil
 }
 
-// StorePost stores post data and assets without generating post.md.
+// StorePost stores post data and assets without generating post.md. Failed
+// downloads don't fail the call; they are recorded in the thread's
+// pending.json for RetryPending.
 func (g *MarkdownGenerator) StorePost(post *Post, baseDir string) error {
-	_, metadataFile, err := g.preparePostDir(post, baseDir)
+	tidDir, metadataFile, err := g.preparePostDir(post, baseDir)
 	if err != nil {
 		return err
 	}
+	g.gofileHandler.resetRun(post.TID)
+
+	var pending *PendingQueue
+	if g.imageHandler.download {
+		pending = NewPendingQueue()
+		g.trackPending(pending)
+		defer g.trackPending(nil)
+	}
 
 	// Render once to populate/update local assets and metadata references.
 	if _, err := g.GenerateMarkdown(post); err != nil {
 		return fmt.Errorf("生成Markdown失败: %v", err)
 	}
+	if err := g.storeAuthors(post, tidDir); err != nil {
+		return err
+	}
+	if err := storeLinks(post, tidDir); err != nil {
+		return err
+	}
+
+	if pending != nil {
+		previous, err := LoadPendingQueue(tidDir)
+		if err != nil {
+			slog.Warn("Failed to read previous retry queue", "tid", post.TID, "error", err)
+		}
+		pending.carryAttempts(previous)
+		g.keepUntried(pending, previous)
+		if err := pending.Save(post.TID, tidDir); err != nil {
+			return err
+		}
+		if n := pending.Len(); n > 0 {
+			slog.Warn("Some downloads failed and were queued for retry", "tid", post.TID, "count", n)
+		}
+	}
 
 	// 保存元数据
+	g.normalizePost(post)
 	metadata, err := toml.Marshal(post)
 	if err != nil {
 		return fmt.Errorf("生成元数据失败: %v", err)
 	}
 
-	if err := os.WriteFile(metadataFile, metadata, 0644); err != nil {
+	// Replace rather than rewrite: the file may be hard-linked into a live
+	// store dir while staging (see PostStore.Transact).
+	if err := writeFileAtomic(metadataFile, metadata); err != nil {
 		return fmt.Errorf("保存metadata.toml失败: %v", err)
 	}
 
-	return nil
+	return g.imageHandler.registry.Save()
+}
+
+// StorePostContext is StorePost inside a "store_post" span that parents the
+// image and gofile download spans; ctx also cancels pending image downloads.
+func (g *MarkdownGenerator) StorePostContext(ctx context.Context, post *Post, baseDir string) (err error) {
+	ctx, span := startSpan(ctx, "south2md.store_post", attribute.String("south2md.tid", post.TID))
+	defer func() { endSpan(span, err) }()
+
+	g.imageHandler.traceCtx = ctx
+	if g.gofileHandler != nil {
+		g.gofileHandler.traceCtx = ctx
+	}
+	defer func() {
+		g.imageHandler.traceCtx = nil
+		if g.gofileHandler != nil {
+			g.gofileHandler.traceCtx = nil
+		}
+	}()
+	return g.StorePost(post, baseDir)
+}
+
+// RetryPending re-attempts only the downloads listed in the pending.json of
+// the post stored under baseDir, then rewrites metadata and the queue. It
+// returns the downloads that still failed.
+func (g *MarkdownGenerator) RetryPending(ctx context.Context, post *Post, baseDir string) (*PendingQueue, error) {
+	postDir := threadDir(baseDir, post.TID)
+	queue, err := LoadPendingQueue(postDir)
+	if err != nil {
+		return nil, err
+	}
+	if queue.Len() == 0 {
+		return queue, nil
+	}
+
+	g.imageHandler.retryOnly = queue.urls(PendingKindImage)
+	if g.gofileHandler != nil {
+		g.gofileHandler.retryOnly = queue.urls(PendingKindGofile)
+	}
+	defer func() {
+		g.imageHandler.retryOnly = nil
+		if g.gofileHandler != nil {
+			g.gofileHandler.retryOnly = nil
+		}
+	}()
+
+	if err := g.StorePostContext(ctx, post, baseDir); err != nil {
+		return nil, err
+	}
+	return LoadPendingQueue(postDir)
+}
+
+// RepairImages downloads again only the images and attachments of the post
+// stored under baseDir whose cached file is missing, empty or has the wrong
+// size (with SetVerifyChecksums, also a wrong SHA-256), then rewrites
+// metadata. It returns the files that are still broken.
+func (g *MarkdownGenerator) RepairImages(ctx context.Context, post *Post, baseDir string) ([]ImageMismatch, error) {
+	postDir := threadDir(baseDir, post.TID)
+	stored, err := LoadPostFile(filepath.Join(postDir, metadataFileName))
+	if err != nil {
+		return nil, err
+	}
+	broken := FindBrokenImages(postDir, stored, g.imageHandler.verifyChecksums)
+	if len(broken) == 0 {
+		return nil, nil
+	}
+
+	retry := make(map[string]bool, len(broken))
+	for _, mismatch := range broken {
+		if mismatch.URL != "" {
+			retry[mismatch.URL] = true
+		}
+	}
+	g.imageHandler.retryOnly = retry
+	if g.gofileHandler != nil {
+		g.gofileHandler.retryOnly = map[string]bool{}
+	}
+	defer func() {
+		g.imageHandler.retryOnly = nil
+		if g.gofileHandler != nil {
+			g.gofileHandler.retryOnly = nil
+		}
+	}()
+
+	if err := g.StorePostContext(ctx, post, baseDir); err != nil {
+		return nil, err
+	}
+	return FindBrokenImages(postDir, post, g.imageHandler.verifyChecksums), nil
+}
+
+// keepUntried copies the items of previous that a RetryPending or
+// RepairImages run skipped because it only retried other downloads into
+// queue, so they stay queued.
+func (g *MarkdownGenerator) keepUntried(queue, previous *PendingQueue) {
+	if g.imageHandler.retryOnly == nil {
+		return
+	}
+	for _, item := range previous.Items() {
+		tried := g.imageHandler.retryOnly[item.URL]
+		if item.Kind == PendingKindGofile {
+			tried = g.gofileHandler != nil && g.gofileHandler.retryOnly[item.URL]
+		}
+		if !tried {
+			queue.keep(item)
+		}
+	}
+}
+
+// storeAuthors downloads the avatars and profiles of the authors of post
+// into tidDir, when enabled.
+func (g *MarkdownGenerator) storeAuthors(post *Post, tidDir string) error {
+	if err := g.imageHandler.DownloadAvatars(post.TID, post); err != nil {
+		return fmt.Errorf("下载头像失败: %w", err)
+	}
+	return g.storeAuthorProfiles(post, tidDir)
+}
+
+// trackPending makes the handlers record failed downloads into queue.
+func (g *MarkdownGenerator) trackPending(queue *PendingQueue) {
+	g.imageHandler.pending = queue
+	if g.gofileHandler != nil {
+		g.gofileHandler.pending = queue
+	}
 }
 
 // ExportPost generates post.md for one post under baseDir/<tid>/.
@@ -147,22 +455,40 @@ func (g *MarkdownGenerator) ExportPost(post *Post, baseDir string) error {
 		return err
 	}
 
-	markdown, err := g.GenerateMarkdown(post)
+	index, parts, err := g.GenerateMarkdownParts(post)
 	if err != nil {
 		return fmt.Errorf("生成Markdown失败: %v", err)
 	}
+	if err := g.storeAuthors(post, tidDir); err != nil {
+		return err
+	}
+	if err := storeLinks(post, tidDir); err != nil {
+		return err
+	}
+
+	if err := removeStaleParts(tidDir); err != nil {
+		return err
+	}
+	post.Parts = nil
+	for _, part := range parts {
+		if err := writeFileAtomic(filepath.Join(tidDir, part.Name), []byte(part.Content)); err != nil {
+			return fmt.Errorf("保存%s失败: %v", part.Name, err)
+		}
+		post.Parts = append(post.Parts, part.Name)
+	}
 
 	postFile := filepath.Join(tidDir, "post.md")
-	if err := os.WriteFile(postFile, []byte(markdown), 0644); err != nil {
+	if err := writeFileAtomic(postFile, []byte(index)); err != nil {
 		return fmt.Errorf("保存post.md失败: %v", err)
 	}
 
+	g.normalizePost(post)
 	metadata, err := toml.Marshal(post)
 	if err != nil {
 		return fmt.Errorf("生成元数据失败: %v", err)
 	}
-	if err := os.WriteFile(metadataFile, metadata, 0644); err != nil {
+	if err := writeFileAtomic(metadataFile, metadata); err != nil {
 		return fmt.Errorf("保存metadata.toml失败: %v", err)
 	}
-	return nil
+	return g.imageHandler.registry.Save()
 }
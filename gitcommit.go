@@ -0,0 +1,88 @@
+package south2md
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// gitMu serializes the git commands of GitCommitPath: the threads of a batch
+// export into the same repository, and git allows one writer per index.
+var gitMu sync.Mutex
+
+// GitCommitPath commits the current state of path, a file or directory under
+// repoDir, to the git repository at repoDir, initializing one there first if
+// repoDir has none. It reports whether a commit was made; nothing is
+// committed when path is unchanged. Files under path named in exclude, such
+// as bookkeeping that changes on every run, are left out. Without a
+// configured git identity the commit is authored as south2md.
+func GitCommitPath(ctx context.Context, repoDir, path, message string, exclude ...string) (bool, error) {
+	repoDir, err := filepath.Abs(repoDir)
+	if err != nil {
+		return false, err
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(repoDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false, fmt.Errorf("%s is outside git repository %s", path, repoDir)
+	}
+	pathspec := []string{"--", rel}
+	for _, name := range exclude {
+		pathspec = append(pathspec, ":(exclude,glob)"+filepath.ToSlash(filepath.Join(rel, "**", name)))
+	}
+
+	gitMu.Lock()
+	defer gitMu.Unlock()
+	if _, err := os.Stat(filepath.Join(repoDir, ".git")); errors.Is(err, os.ErrNotExist) {
+		if _, err := runGit(ctx, repoDir, nil, "init", "-q"); err != nil {
+			return false, err
+		}
+	}
+	if _, err := runGit(ctx, repoDir, nil, append([]string{"add", "-A"}, pathspec...)...); err != nil {
+		return false, err
+	}
+	var exitErr *exec.ExitError
+	_, err = runGit(ctx, repoDir, nil, append([]string{"diff", "--cached", "--quiet"}, pathspec...)...)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		return false, err
+	}
+
+	var env []string
+	if email, err := runGit(ctx, repoDir, nil, "config", "user.email"); err != nil || len(bytes.TrimSpace(email)) == 0 {
+		env = []string{
+			"GIT_AUTHOR_NAME=south2md", "GIT_AUTHOR_EMAIL=south2md@localhost",
+			"GIT_COMMITTER_NAME=south2md", "GIT_COMMITTER_EMAIL=south2md@localhost",
+		}
+	}
+	if _, err := runGit(ctx, repoDir, env, append([]string{"commit", "-q", "-m", message}, pathspec...)...); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// runGit runs the git subcommand args[0] in dir with env added to the
+// environment and returns its output. Errors carry git's output and wrap
+// the *exec.ExitError.
+func runGit(ctx context.Context, dir string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return output, fmt.Errorf("git %s failed: %w: %s", args[0], err, bytes.TrimSpace(output))
+	}
+	return output, nil
+}
@@ -0,0 +1,65 @@
+package south2md
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitCommitPath(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	// No identity from the user's config, so the south2md fallback is used.
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	ctx := context.Background()
+	repo := t.TempDir()
+	thread := filepath.Join(repo, "2636739")
+	if err := os.MkdirAll(thread, 0o755); err != nil {
+		t.Fatalf("create thread dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(thread, "post.md"), []byte("# v1\n"), 0o644); err != nil {
+		t.Fatalf("write post: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "other.md"), []byte("untouched\n"), 0o644); err != nil {
+		t.Fatalf("write other file: %v", err)
+	}
+	writePending := func(attempts string) {
+		if err := os.WriteFile(filepath.Join(thread, "pending.json"), []byte(attempts), 0o644); err != nil {
+			t.Fatalf("write pending: %v", err)
+		}
+	}
+	writePending("1")
+
+	if committed, err := GitCommitPath(ctx, repo, thread, "Archive 2636739\n\nTID: 2636739", "pending.json"); err != nil || !committed {
+		t.Fatalf("expected a first commit, got %v (%v)", committed, err)
+	}
+	writePending("2")
+	if committed, err := GitCommitPath(ctx, repo, thread, "no changes", "pending.json"); err != nil || committed {
+		t.Fatalf("expected no commit for an unchanged thread, got %v (%v)", committed, err)
+	}
+	if err := os.WriteFile(filepath.Join(thread, "post.md"), []byte("# v2\n"), 0o644); err != nil {
+		t.Fatalf("write post: %v", err)
+	}
+	if committed, err := GitCommitPath(ctx, repo, thread, "Update 2636739", "pending.json"); err != nil || !committed {
+		t.Fatalf("expected an update commit, got %v (%v)", committed, err)
+	}
+
+	log, err := exec.Command("git", "-C", repo, "log", "--format=%an: %s", "--name-only").CombinedOutput()
+	if err != nil {
+		t.Fatalf("git log: %v: %s", err, log)
+	}
+	want := "south2md: Update 2636739\n\n2636739/post.md\nsouth2md: Archive 2636739\n\n2636739/post.md"
+	if got := strings.TrimSpace(string(log)); got != want {
+		t.Fatalf("expected only the thread without pending.json to be committed, got:\n%s", got)
+	}
+
+	if _, err := GitCommitPath(ctx, repo, t.TempDir(), "outside"); err == nil {
+		t.Fatal("expected a path outside the repository to be rejected")
+	}
+}
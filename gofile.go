@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/md5"
 	"crypto/sha256"
 	"encoding/hex"
@@ -21,6 +22,8 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var gofileURLPattern = regexp.MustCompile(`https?://(?:www\.)?gofile\.io/d/([A-Za-z0-9]+)`)
@@ -38,7 +41,37 @@ type GofileHandler struct {
 	timeoutSec    int
 	userAgent     string
 	skipExisting  bool
-	httpClient    *http.Client
+	cacheTTL      time.Duration // lifetime of cached content API responses; 0 disables the cache
+	limiter       *tokenBucket  // shared API/download rate limit; nil means unlimited
+	httpClient    HTTPDoer
+	metrics       *Metrics
+	traceCtx      context.Context // parent of download spans; nil means none
+
+	// assetLimit is the estimated thread-wide byte budget before falling back
+	// to manifest-only mode; preflight caches the per-tid decision and trees.
+	assetLimit int64
+	preflight  map[string]bool
+	trees      map[string][]gofileRemoteFile
+	summary    *RunSummary
+
+	pending   *PendingQueue   // receives failed shares; nil means none
+	retryOnly map[string]bool // when set, only these share URLs are downloaded
+
+	// include and selector narrow each share to the files to download;
+	// maxFileSize skips single files above it and maxSize caps the selected
+	// bytes per share. skipped and oversized remember the outcome per share
+	// URL for its metadata record.
+	include     []string
+	selector    GofileFileSelector
+	maxFileSize int64
+	maxSize     int64
+	skipped     map[string][]GofileManifestEntry
+	oversized   map[string]bool
+
+	// guard enforces the thread size cap and free space reserve for
+	// guardDir, the thread dir being downloaded into; nil means none.
+	guard    *DownloadGuard
+	guardDir string
 }
 
 type gofileAPIResponse struct {
@@ -91,15 +124,38 @@ func NewGofileHandler(config *Config) *GofileHandler {
 		rootDir:       ".",
 		download:      true,
 		token:         config.GofileToken,
-		maxConcurrent: config.HTTPMaxConcurrent,
+		maxConcurrent: config.HTTPMaxConcurrentGofile,
 		maxRetries:    max(1, config.HTTPMaxRetries),
 		timeoutSec:    int(config.HTTPTimeout.Seconds()),
 		userAgent:     config.HTTPUserAgent,
 		skipExisting:  config.GofileSkipExisting,
+		cacheTTL:      config.GofileCacheTTL,
+		limiter:       sharedGofileBucket(config.GofileRateLimit),
 		httpClient: &http.Client{
 			Timeout: timeout,
 		},
+		assetLimit:  config.PolicyExternalAssetLimit,
+		include:     config.GofileInclude,
+		maxFileSize: config.GofileMaxFileSize,
+		maxSize:     config.GofileMaxSize,
+	}
+}
+
+// SetHTTPDoer replaces the client used for gofile API calls and downloads;
+// nil is ignored.
+func (gh *GofileHandler) SetHTTPDoer(doer HTTPDoer) {
+	if gh == nil || doer == nil {
+		return
 	}
+	gh.httpClient = doer
+}
+
+// SetMetrics records gofile request metrics into metrics; nil disables it.
+func (gh *GofileHandler) SetMetrics(metrics *Metrics) {
+	if gh == nil {
+		return
+	}
+	gh.metrics = metrics
 }
 
 // SetRootDir sets the write root for gofile downloads.
@@ -122,6 +178,135 @@ func (gh *GofileHandler) SetDownloadEnabled(enabled bool) {
 	gh.download = enabled
 }
 
+// SetDownloadGuard applies guard's thread size cap and free space reserve to
+// gofile downloads; nil disables both.
+func (gh *GofileHandler) SetDownloadGuard(guard *DownloadGuard) {
+	if gh == nil {
+		return
+	}
+	gh.guard = guard
+}
+
+// SetRunSummary sets the summary that receives policy decisions.
+func (gh *GofileHandler) SetRunSummary(summary *RunSummary) {
+	if gh == nil {
+		return
+	}
+	gh.summary = summary
+}
+
+// Preflight estimates the total size of all gofile content referenced by the
+// post and switches the thread to manifest-only mode when it exceeds the
+// configured asset limit, so unattended runs never pull unexpectedly huge shares.
+func (gh *GofileHandler) Preflight(post *Post) {
+	if gh == nil || post == nil || !gh.download || gh.assetLimit <= 0 {
+		return
+	}
+	if _, ok := gh.preflight[post.TID]; ok {
+		return
+	}
+
+	urls := collectPostGofileLinks(post)
+	if len(urls) == 0 {
+		return
+	}
+
+	token, err := gh.ensureAccountToken()
+	if err != nil {
+		slog.Warn("Gofile preflight skipped", "tid", post.TID, "error", err)
+		return
+	}
+
+	baseDir := filepath.Join(threadDir(gh.rootDir, post.TID), gh.downloadDir)
+	var total int64
+	for _, rawURL := range urls {
+		contentID := extractGofileContentID(rawURL)
+		files, err := gh.contentTree(baseDir, contentID, token)
+		if err != nil {
+			slog.Warn("Gofile preflight failed to fetch content tree", "url", rawURL, "error", err)
+			continue
+		}
+		files, _ = gh.filterIncluded(filepath.Join(baseDir, contentID), files)
+		for _, file := range files {
+			total += file.Size
+		}
+	}
+
+	if gh.preflight == nil {
+		gh.preflight = make(map[string]bool)
+	}
+	manifestOnly := total > gh.assetLimit
+	gh.preflight[post.TID] = manifestOnly
+	if !manifestOnly {
+		return
+	}
+
+	reason := fmt.Sprintf("estimated %s across %d share(s) exceeds limit %s",
+		FormatByteSize(total), len(urls), FormatByteSize(gh.assetLimit))
+	slog.Warn("Gofile downloads switched to manifest-only", "tid", post.TID, "reason", reason)
+	gh.summary.RecordDecision(PolicyDecision{
+		Policy: "external_asset_limit",
+		Scope:  "gofile",
+		Action: "manifest_only",
+		Reason: reason,
+	})
+}
+
+// resetRun forgets the preflight decision for tid and the cached share
+// trees, so a long-lived process (serve, the Telegram bot) re-estimates a
+// thread on every run instead of reusing the first run's answer.
+func (gh *GofileHandler) resetRun(tid string) {
+	if gh == nil {
+		return
+	}
+	delete(gh.preflight, tid)
+	clear(gh.trees)
+}
+
+func (gh *GofileHandler) isManifestOnly(tid string) bool {
+	return gh.preflight[tid]
+}
+
+// contentTree returns the remote file list for one share, cached per content
+// dir for the run. API responses are also cached on disk in baseDir for
+// cacheTTL.
+func (gh *GofileHandler) contentTree(baseDir, contentID, token string) ([]gofileRemoteFile, error) {
+	if contentID == "" {
+		return nil, fmt.Errorf("empty gofile content id")
+	}
+	contentDir := filepath.Join(baseDir, contentID)
+	if files, ok := gh.trees[contentDir]; ok {
+		return files, nil
+	}
+
+	var cache *gofileAPICache
+	if gh.cacheTTL > 0 {
+		cache = loadGofileAPICache(baseDir, gh.cacheTTL)
+	}
+	files, err := gh.buildContentTree(cache, contentDir, contentID, token, "", map[string]int{})
+	if cache != nil {
+		cache.save()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if gh.trees == nil {
+		gh.trees = make(map[string][]gofileRemoteFile)
+	}
+	gh.trees[contentDir] = files
+	return files, nil
+}
+
+func collectPostGofileLinks(post *Post) []string {
+	var content strings.Builder
+	content.WriteString(post.MainPost.HTMLContent)
+	for _, reply := range post.Replies {
+		content.WriteString("\n")
+		content.WriteString(reply.HTMLContent)
+	}
+	return ExtractGofileLinks(content.String())
+}
+
 // DownloadAndAnnotateGofileLinks downloads gofile links and annotates markdown with local paths.
 func (gh *GofileHandler) DownloadAndAnnotateGofileLinks(tid string, markdown []byte, post *Post) ([]byte, error) {
 	if gh == nil {
@@ -134,32 +319,61 @@ func (gh *GofileHandler) DownloadAndAnnotateGofileLinks(tid string, markdown []b
 	}
 
 	if !gh.download {
-		mapping := gh.mappingFromRecords(post, urls)
-		if len(mapping) == 0 {
-			return markdown, nil
-		}
-		annotated := annotateGofileLinks(string(markdown), mapping)
+		annotated := annotateGofileLinks(string(markdown), gh.mappingFromRecords(post, urls))
+		annotated = annotateGofileManifests(annotated, manifestRecords(post))
+		return []byte(annotated), nil
+	}
+
+	baseDir := filepath.Join(threadDir(gh.rootDir, tid), gh.downloadDir)
+	if gh.isManifestOnly(tid) {
+		annotated := annotateGofileManifests(string(markdown), gh.recordManifests(baseDir, urls, post))
 		return []byte(annotated), nil
 	}
 
-	baseDir := filepath.Join(gh.rootDir, tid, gh.downloadDir)
 	if err := os.MkdirAll(baseDir, 0755); err != nil {
 		return markdown, fmt.Errorf("failed to create gofile directory: %w", err)
 	}
 
-	if err := gh.downloadBatch(baseDir, urls); err != nil {
+	gh.guardDir = threadDir(gh.rootDir, tid)
+	if err := gh.downloadBatch(baseDir, gh.retryFilter(urls)); err != nil {
+		var diskErr *DiskSpaceError
+		if errors.As(err, &diskErr) {
+			return markdown, err
+		}
 		slog.Warn("Gofile download failed", "error", err)
 	}
 
-	mapping := gh.collectLocalFiles(baseDir, urls, post)
-	if len(mapping) == 0 {
-		return markdown, nil
+	var oversized, downloaded []string
+	for _, rawURL := range urls {
+		if gh.oversized[rawURL] {
+			oversized = append(oversized, rawURL)
+		} else {
+			downloaded = append(downloaded, rawURL)
+		}
 	}
 
+	mapping := gh.collectLocalFiles(baseDir, downloaded, post)
 	annotated := annotateGofileLinks(string(markdown), mapping)
+	if len(oversized) > 0 {
+		annotated = annotateGofileManifests(annotated, gh.recordManifests(baseDir, oversized, post))
+	}
 	return []byte(annotated), nil
 }
 
+// retryFilter drops share URLs that are not being retried.
+func (gh *GofileHandler) retryFilter(urls []string) []string {
+	if gh.retryOnly == nil {
+		return urls
+	}
+	filtered := make([]string, 0, len(urls))
+	for _, rawURL := range urls {
+		if gh.retryOnly[rawURL] {
+			filtered = append(filtered, rawURL)
+		}
+	}
+	return filtered
+}
+
 func (gh *GofileHandler) mappingFromRecords(post *Post, urls []string) map[string]string {
 	if post == nil || len(post.GofileFiles) == 0 {
 		return nil
@@ -216,39 +430,130 @@ func annotateGofileLinks(markdown string, mapping map[string]string) string {
 	})
 }
 
+func manifestRecords(post *Post) map[string]GofileFile {
+	if post == nil {
+		return nil
+	}
+	records := make(map[string]GofileFile)
+	for _, record := range post.GofileFiles {
+		if record.ManifestOnly && record.URL != "" {
+			records[record.URL] = record
+		}
+	}
+	return records
+}
+
+func annotateGofileManifests(markdown string, records map[string]GofileFile) string {
+	return gofileURLPattern.ReplaceAllStringFunc(markdown, func(rawURL string) string {
+		record, ok := records[rawURL]
+		if !ok {
+			return rawURL
+		}
+		return fmt.Sprintf("%s (manifest only: %d files, %s)", rawURL, len(record.Manifest), FormatByteSize(record.TotalSize))
+	})
+}
+
+// recordManifests stores remote file listings for shares that are not downloaded.
+func (gh *GofileHandler) recordManifests(baseDir string, urls []string, post *Post) map[string]GofileFile {
+	token, err := gh.ensureAccountToken()
+	if err != nil {
+		slog.Warn("Gofile manifest listing skipped", "error", err)
+		return nil
+	}
+
+	records := make(map[string]GofileFile, len(urls))
+	for _, rawURL := range urls {
+		contentID := extractGofileContentID(rawURL)
+		files, err := gh.contentTree(baseDir, contentID, token)
+		if err != nil {
+			slog.Warn("Gofile manifest listing failed", "url", rawURL, "error", err)
+			continue
+		}
+
+		contentDir := filepath.Join(baseDir, contentID)
+		record := GofileFile{
+			URL:          rawURL,
+			ContentID:    contentID,
+			LocalDir:     filepath.ToSlash(filepath.Join(gh.downloadDir, contentID)),
+			ManifestOnly: true,
+			Manifest:     make([]GofileManifestEntry, 0, len(files)),
+		}
+		for _, file := range files {
+			record.TotalSize += file.Size
+			record.Manifest = append(record.Manifest, gofileManifestEntry(contentDir, file))
+		}
+
+		if post != nil {
+			post.GofileFiles = upsertGofileRecord(post.GofileFiles, record)
+		}
+		records[rawURL] = record
+	}
+	return records
+}
+
 func (gh *GofileHandler) downloadBatch(baseDir string, urls []string) error {
-	if gh.skipExisting && gh.allContentDirsPresent(baseDir, urls) {
+	if len(urls) == 0 || gh.skipExisting && gh.allContentDirsPresent(baseDir, urls) {
 		return nil
 	}
 
 	token, err := gh.ensureAccountToken()
 	if err != nil {
+		for _, rawURL := range urls {
+			gh.pending.Add(PendingKindGofile, rawURL, err)
+		}
 		return err
 	}
 
 	var errs []error
+	fail := func(rawURL string, err error) {
+		gh.pending.Add(PendingKindGofile, rawURL, err)
+		errs = append(errs, err)
+	}
 	for _, rawURL := range urls {
 		contentID := extractGofileContentID(rawURL)
 		if contentID == "" {
-			errs = append(errs, fmt.Errorf("invalid gofile url: %s", rawURL))
+			fail(rawURL, fmt.Errorf("invalid gofile url: %s", rawURL))
 			continue
 		}
 
-		contentDir := filepath.Join(baseDir, contentID)
-		if err := os.MkdirAll(contentDir, 0755); err != nil {
-			errs = append(errs, fmt.Errorf("failed to create content dir for %s: %w", rawURL, err))
+		files, err := gh.contentTree(baseDir, contentID, token)
+		if err != nil {
+			fail(rawURL, fmt.Errorf("failed to fetch content tree for %s: %w", rawURL, err))
 			continue
 		}
 
-		files, err := gh.buildContentTree(contentDir, contentID, token, "", map[string]int{})
+		contentDir := filepath.Join(baseDir, contentID)
+		files, err = gh.selectFiles(rawURL, contentDir, files)
 		if err != nil {
-			errs = append(errs, fmt.Errorf("failed to fetch content tree for %s: %w", rawURL, err))
+			fail(rawURL, fmt.Errorf("failed to select files for %s: %w", rawURL, err))
+			continue
+		}
+		if gh.exceedsMaxSize(rawURL, files) {
+			if gh.oversized == nil {
+				gh.oversized = make(map[string]bool)
+			}
+			gh.oversized[rawURL] = true
+			continue
+		}
+
+		if err := os.MkdirAll(contentDir, 0755); err != nil {
+			fail(rawURL, fmt.Errorf("failed to create content dir for %s: %w", rawURL, err))
 			continue
 		}
 
 		for _, file := range files {
-			if err := gh.downloadFile(file); err != nil {
-				errs = append(errs, fmt.Errorf("download failed for %s: %w", file.Link, err))
+			err := gh.downloadFile(file)
+			var diskErr *DiskSpaceError
+			switch {
+			case err == nil:
+			case errors.As(err, &diskErr):
+				// Later files would hit the same wall; stop the thread here.
+				gh.pending.Add(PendingKindGofile, rawURL, err)
+				return err
+			case errors.Is(err, ErrSizeLimit):
+				gh.skipOverLimit(rawURL, contentDir, file, err)
+			default:
+				fail(rawURL, fmt.Errorf("download failed for %s: %w", file.Link, err))
 			}
 		}
 	}
@@ -256,11 +561,37 @@ func (gh *GofileHandler) downloadBatch(baseDir string, urls []string) error {
 	return errors.Join(errs...)
 }
 
+// skipOverLimit records file of share rawURL as skipped because the thread
+// reached its size cap.
+func (gh *GofileHandler) skipOverLimit(rawURL, contentDir string, file gofileRemoteFile, err error) {
+	if gh.skipped == nil {
+		gh.skipped = make(map[string][]GofileManifestEntry)
+	}
+	gh.skipped[rawURL] = append(gh.skipped[rawURL], gofileManifestEntry(contentDir, file))
+	slog.Warn("Gofile file skipped by the thread size limit", "url", file.Link, "error", err)
+	gh.summary.RecordDecision(PolicyDecision{
+		Policy: "max_thread_size",
+		Scope:  "gofile",
+		Action: "skip",
+		Reason: fmt.Sprintf("%s: %v", file.Link, err),
+	})
+}
+
 func (gh *GofileHandler) ensureAccountToken() (string, error) {
 	if strings.TrimSpace(gh.token) != "" {
 		return gh.token, nil
 	}
 
+	var token string
+	err := gh.retryRateLimited(func() error {
+		var err error
+		token, err = gh.createAccountToken()
+		return err
+	})
+	return token, err
+}
+
+func (gh *GofileHandler) createAccountToken() (string, error) {
 	req, err := http.NewRequest(http.MethodPost, "https://api.gofile.io/accounts", nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create account request: %w", err)
@@ -281,6 +612,9 @@ func (gh *GofileHandler) ensureAccountToken() (string, error) {
 	if err := decodeJSONResponse(resp.Body, resp.Header.Get("Content-Encoding"), &envelope); err != nil {
 		return "", fmt.Errorf("failed to parse account response: %w", err)
 	}
+	if envelope.Status == gofileRateLimitStatus {
+		return "", rateLimitErrorFromResponse(resp)
+	}
 	if envelope.Status != "ok" {
 		return "", fmt.Errorf("account response status is %q", envelope.Status)
 	}
@@ -298,13 +632,14 @@ func (gh *GofileHandler) ensureAccountToken() (string, error) {
 }
 
 func (gh *GofileHandler) buildContentTree(
+	cache *gofileAPICache,
 	parentDir string,
 	contentID string,
 	token string,
 	password string,
 	pathingCount map[string]int,
 ) ([]gofileRemoteFile, error) {
-	content, err := gh.fetchContent(contentID, token, password)
+	content, err := gh.fetchContentCached(cache, contentID, token, password)
 	if err != nil {
 		return nil, err
 	}
@@ -324,13 +659,12 @@ func (gh *GofileHandler) buildContentTree(
 		}}, nil
 	}
 
+	// Folders are created lazily by downloadFile so that listing a tree has no
+	// filesystem side effects (preflight and manifest-only mode rely on this).
 	absolutePath := resolveNamingCollision(pathingCount, parentDir, content.Name, true)
 	if filepath.Base(parentDir) == contentID {
 		absolutePath = parentDir
 	}
-	if err := os.MkdirAll(absolutePath, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create folder %s: %w", absolutePath, err)
-	}
 
 	var result []gofileRemoteFile
 	keys := make([]string, 0, len(content.Children))
@@ -342,7 +676,7 @@ func (gh *GofileHandler) buildContentTree(
 	for _, key := range keys {
 		child := content.Children[key]
 		if child.Type == "folder" {
-			childFiles, err := gh.buildContentTree(absolutePath, child.ID, token, password, pathingCount)
+			childFiles, err := gh.buildContentTree(cache, absolutePath, child.ID, token, password, pathingCount)
 			if err != nil {
 				return nil, err
 			}
@@ -364,6 +698,16 @@ func (gh *GofileHandler) buildContentTree(
 }
 
 func (gh *GofileHandler) fetchContent(contentID, token, password string) (gofileContentData, error) {
+	var data gofileContentData
+	err := gh.retryRateLimited(func() error {
+		var err error
+		data, err = gh.fetchContentOnce(contentID, token, password)
+		return err
+	})
+	return data, err
+}
+
+func (gh *GofileHandler) fetchContentOnce(contentID, token, password string) (gofileContentData, error) {
 	parsed, err := url.Parse(fmt.Sprintf("https://api.gofile.io/contents/%s", contentID))
 	if err != nil {
 		return gofileContentData{}, fmt.Errorf("failed to build content url: %w", err)
@@ -398,6 +742,9 @@ func (gh *GofileHandler) fetchContent(contentID, token, password string) (gofile
 	if err := decodeJSONResponse(resp.Body, resp.Header.Get("Content-Encoding"), &envelope); err != nil {
 		return gofileContentData{}, fmt.Errorf("failed to parse content response: %w", err)
 	}
+	if envelope.Status == gofileRateLimitStatus {
+		return gofileContentData{}, rateLimitErrorFromResponse(resp)
+	}
 	if envelope.Status != "ok" {
 		return gofileContentData{}, fmt.Errorf("content response status is %q", envelope.Status)
 	}
@@ -433,8 +780,21 @@ func (gh *GofileHandler) downloadFile(file gofileRemoteFile) error {
 	if info, err := os.Stat(tmpPath); err == nil {
 		partSize = info.Size()
 	}
+	reserved := file.Size - partSize
+	if err := gh.guard.Reserve(gh.guardDir, reserved); err != nil {
+		return err
+	}
 	slog.Info("Gofile file download started", "url", file.Link, "path", finalPath, "resume_bytes", partSize)
 
+	_, span := startSpan(gh.traceCtx, "south2md.gofile_download",
+		attribute.String("url.full", file.Link),
+		attribute.String("file.path", finalPath),
+		attribute.Int64("file.size", file.Size),
+		attribute.Int64("south2md.resume_bytes", partSize),
+	)
+	var spanErr error
+	defer func() { endSpan(span, spanErr) }()
+
 	var lastErr error
 	for i := 0; i < max(1, gh.maxRetries); i++ {
 		if err := gh.downloadFileAttempt(file.Link, tmpPath, finalPath, partSize); err == nil {
@@ -454,10 +814,13 @@ func (gh *GofileHandler) downloadFile(file gofileRemoteFile) error {
 		}
 	}
 
+	gh.guard.Release(gh.guardDir, reserved)
 	if lastErr != nil {
-		return fmt.Errorf("exceeded retry limit: %w", lastErr)
+		spanErr = fmt.Errorf("exceeded retry limit: %w", lastErr)
+	} else {
+		spanErr = fmt.Errorf("exceeded retry limit")
 	}
-	return fmt.Errorf("exceeded retry limit")
+	return spanErr
 }
 
 func (gh *GofileHandler) verifyAndMaybeSkipExistingFile(finalPath string, file gofileRemoteFile) (bool, error) {
@@ -560,17 +923,28 @@ func (gh *GofileHandler) downloadFileAttempt(link, tmpPath, finalPath string, pa
 		return err
 	}
 
+	// The .part file may be hard-linked from the live thread dir by
+	// PostStore.Transact, so never write it in place: resume into a private
+	// copy, or start over with a new file.
 	openFlag := os.O_CREATE | os.O_WRONLY
 	if effectivePartSize > 0 {
+		if err := detachFile(tmpPath); err != nil {
+			return fmt.Errorf("failed to prepare temp file: %w", err)
+		}
 		openFlag |= os.O_APPEND
 	} else {
+		if err := os.Remove(tmpPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove temp file: %w", err)
+		}
 		openFlag |= os.O_TRUNC
 	}
 	f, err := os.OpenFile(tmpPath, openFlag, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open temp file: %w", err)
 	}
-	if _, err := io.Copy(f, bodyReader); err != nil {
+	written, err := io.Copy(f, bodyReader)
+	gh.metrics.Add(MetricBytesTotal, float64(written), "component", MetricsComponentGofile)
+	if err != nil {
 		_ = f.Close()
 		return fmt.Errorf("failed to write temp file: %w", err)
 	}
@@ -595,13 +969,39 @@ func (gh *GofileHandler) downloadFileAttempt(link, tmpPath, finalPath string, pa
 func (gh *GofileHandler) doRequestWithRetry(req *http.Request) (*http.Response, error) {
 	attempts := max(1, gh.maxRetries)
 	var lastErr error
+	// waitRateLimit already counted the retry that follows a 429.
+	rateLimited := false
 
 	for i := 0; i < attempts; i++ {
+		if i > 0 && !rateLimited {
+			gh.metrics.Add(MetricRetriesTotal, 1, "component", MetricsComponentGofile)
+		}
+		rateLimited = false
+		if err := gh.limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
 		cloned := req.Clone(req.Context())
+		start := time.Now()
 		resp, err := gh.httpClient.Do(cloned)
 		if err == nil {
+			var statusErr error
+			if resp.StatusCode >= 400 {
+				statusErr = &httpStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+			}
+			gh.metrics.recordRequest(MetricsComponentGofile, start, 0, statusErr)
+			if resp.StatusCode == http.StatusTooManyRequests && i+1 < attempts {
+				rlErr := rateLimitErrorFromResponse(resp)
+				_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+				_ = resp.Body.Close()
+				if err := gh.waitRateLimit(req.Context(), rlErr, i); err != nil {
+					return nil, err
+				}
+				rateLimited = true
+				continue
+			}
 			return resp, nil
 		}
+		gh.metrics.recordRequest(MetricsComponentGofile, start, 0, err)
 		lastErr = err
 		if !isRetryableNetError(err) {
 			break
@@ -682,7 +1082,7 @@ func writeGofileDigest(path string, d gofileFileDigest) error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal digest: %w", err)
 	}
-	if err := os.WriteFile(path, raw, 0644); err != nil {
+	if err := writeFileAtomic(path, raw); err != nil {
 		return fmt.Errorf("failed to write digest file: %w", err)
 	}
 	return nil
@@ -781,6 +1181,12 @@ func (gh *GofileHandler) collectLocalFiles(baseDir string, urls []string, post *
 		if len(localFiles) == 0 {
 			record.Error = "download_failed"
 		}
+		if skipped, ok := gh.skipped[rawURL]; ok {
+			record.Skipped = skipped
+		} else {
+			// Shares skipped as already present keep their earlier selection.
+			record.Skipped = previousGofileSkipped(post.GofileFiles, rawURL)
+		}
 
 		post.GofileFiles = upsertGofileRecord(post.GofileFiles, record)
 		if record.Downloaded && record.LocalDir != "" {
@@ -791,6 +1197,15 @@ func (gh *GofileHandler) collectLocalFiles(baseDir string, urls []string, post *
 	return mapping
 }
 
+func previousGofileSkipped(records []GofileFile, rawURL string) []GofileManifestEntry {
+	for _, record := range records {
+		if record.URL == rawURL {
+			return record.Skipped
+		}
+	}
+	return nil
+}
+
 func upsertGofileRecord(records []GofileFile, record GofileFile) []GofileFile {
 	for i := range records {
 		if records[i].URL == record.URL {
@@ -851,7 +1266,7 @@ func listFilesRecursive(root string) []string {
 }
 
 func resolveNamingCollision(pathingCount map[string]int, parentDir, childName string, isDir bool) string {
-	targetPath := filepath.Join(parentDir, childName)
+	targetPath := filepath.Join(parentDir, SanitizePathComponent(childName))
 	count, exists := pathingCount[targetPath]
 	if !exists {
 		pathingCount[targetPath] = 0
@@ -428,3 +428,167 @@ func TestDownloadFileRedownloadsWhenDigestMismatch(t *testing.T) {
 		t.Fatalf("unexpected repaired file content: %q", string(got))
 	}
 }
+
+func TestPreflightSwitchesToManifestOnlyWhenOverLimit(t *testing.T) {
+	downloads := 0
+	summary := NewRunSummary()
+	handler := &GofileHandler{
+		rootDir:     t.TempDir(),
+		downloadDir: "gofile",
+		download:    true,
+		token:       "tok",
+		maxRetries:  1,
+		assetLimit:  100,
+		summary:     summary,
+		httpClient: &http.Client{
+			Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if !strings.HasPrefix(req.URL.String(), "https://api.gofile.io/contents/big1") {
+					downloads++
+					t.Fatalf("unexpected request in manifest-only mode: %s", req.URL.String())
+				}
+				body := mustGzipJSON(t, map[string]any{
+					"status": "ok",
+					"data": map[string]any{
+						"id":   "big1",
+						"type": "folder",
+						"name": "root",
+						"children": map[string]any{
+							"a": map[string]any{"id": "a", "type": "file", "name": "a.zip", "size": 80, "link": "https://store/a.zip"},
+							"b": map[string]any{"id": "b", "type": "file", "name": "b.zip", "size": 50, "link": "https://store/b.zip"},
+						},
+					},
+				})
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     make(http.Header),
+					Body:       io.NopCloser(bytes.NewReader(body)),
+				}, nil
+			}),
+		},
+	}
+
+	post := &Post{
+		TID:      "42",
+		MainPost: PostEntry{HTMLContent: `<a href="https://gofile.io/d/big1">share</a>`},
+	}
+	handler.Preflight(post)
+
+	got, err := handler.DownloadAndAnnotateGofileLinks("42", []byte("see https://gofile.io/d/big1"), post)
+	if err != nil {
+		t.Fatalf("DownloadAndAnnotateGofileLinks failed: %v", err)
+	}
+	if !strings.Contains(string(got), "(manifest only: 2 files, 130 B)") {
+		t.Fatalf("expected manifest annotation, got: %q", string(got))
+	}
+	if downloads != 0 {
+		t.Fatalf("expected no downloads, got %d", downloads)
+	}
+	if len(post.GofileFiles) != 1 || !post.GofileFiles[0].ManifestOnly || len(post.GofileFiles[0].Manifest) != 2 {
+		t.Fatalf("unexpected gofile records: %+v", post.GofileFiles)
+	}
+	if post.GofileFiles[0].Manifest[0].Path != "a.zip" {
+		t.Fatalf("unexpected manifest path: %q", post.GofileFiles[0].Manifest[0].Path)
+	}
+
+	decisions := summary.Decisions()
+	if len(decisions) != 1 || decisions[0].Action != "manifest_only" {
+		t.Fatalf("expected manifest-only decision, got %+v", decisions)
+	}
+}
+
+func TestPreflightReestimatesAfterResetRun(t *testing.T) {
+	size := 130
+	lookups := 0
+	handler := &GofileHandler{
+		rootDir:     t.TempDir(),
+		downloadDir: "gofile",
+		download:    true,
+		token:       "tok",
+		maxRetries:  1,
+		assetLimit:  100,
+		summary:     NewRunSummary(),
+		httpClient: &http.Client{
+			Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				lookups++
+				body := mustGzipJSON(t, map[string]any{
+					"status": "ok",
+					"data": map[string]any{
+						"id":   "big1",
+						"type": "folder",
+						"name": "root",
+						"children": map[string]any{
+							"a": map[string]any{"id": "a", "type": "file", "name": "a.zip", "size": size, "link": "https://store/a.zip"},
+						},
+					},
+				})
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     make(http.Header),
+					Body:       io.NopCloser(bytes.NewReader(body)),
+				}, nil
+			}),
+		},
+	}
+
+	post := &Post{
+		TID:      "42",
+		MainPost: PostEntry{HTMLContent: `<a href="https://gofile.io/d/big1">share</a>`},
+	}
+	handler.Preflight(post)
+	handler.Preflight(post)
+	if !handler.isManifestOnly("42") || lookups != 1 {
+		t.Fatalf("expected one cached manifest-only decision, manifestOnly=%v lookups=%d", handler.isManifestOnly("42"), lookups)
+	}
+
+	// The share shrank between runs of a long-lived process.
+	size = 30
+	handler.resetRun("42")
+	handler.Preflight(post)
+	if handler.isManifestOnly("42") || lookups != 2 {
+		t.Fatalf("expected a fresh estimate after resetRun, manifestOnly=%v lookups=%d", handler.isManifestOnly("42"), lookups)
+	}
+}
+
+func TestDownloadFileResumeLeavesHardLinkedPartIntact(t *testing.T) {
+	tmpDir := t.TempDir()
+	handler := &GofileHandler{
+		maxRetries: 1,
+		httpClient: &http.Client{
+			Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				resp := &http.Response{
+					StatusCode: http.StatusPartialContent,
+					Header:     make(http.Header),
+					Body:       io.NopCloser(strings.NewReader("def")),
+				}
+				resp.Header.Set("Content-Length", "3")
+				return resp, nil
+			}),
+		},
+	}
+
+	// The live copy of a .part file that PostStore.Transact hard-linked into
+	// the staging dir.
+	livePart := filepath.Join(tmpDir, "live.part")
+	if err := os.WriteFile(livePart, []byte("abc"), 0644); err != nil {
+		t.Fatalf("write part file: %v", err)
+	}
+	if err := os.Link(livePart, filepath.Join(tmpDir, "resume.bin.part")); err != nil {
+		t.Skipf("hard links unsupported: %v", err)
+	}
+
+	file := gofileRemoteFile{
+		Path:     tmpDir,
+		Filename: "resume.bin",
+		Link:     "https://example.com/download/resume.bin",
+	}
+	if err := handler.downloadFile(file); err != nil {
+		t.Fatalf("downloadFile failed: %v", err)
+	}
+
+	if got, err := os.ReadFile(filepath.Join(tmpDir, "resume.bin")); err != nil || string(got) != "abcdef" {
+		t.Fatalf("unexpected final file: %q, %v", got, err)
+	}
+	if got, err := os.ReadFile(livePart); err != nil || string(got) != "abc" {
+		t.Fatalf("live part file must be untouched, got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,113 @@
+package south2md
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// GofileCacheFileName is the cache of gofile content API responses kept in
+// a thread's gofile download dir, so re-runs and verify passes don't query
+// the API for shares listed recently.
+const GofileCacheFileName = ".api-cache.json"
+
+// gofileCacheEntry is one cached content API response.
+type gofileCacheEntry struct {
+	FetchedAt time.Time         `json:"fetched_at"`
+	Content   gofileContentData `json:"content"`
+}
+
+// gofileAPICache holds the cached responses of one thread, keyed by content
+// ID (plus password hash for protected shares).
+type gofileAPICache struct {
+	path    string
+	ttl     time.Duration
+	entries map[string]gofileCacheEntry
+	dirty   bool
+}
+
+// loadGofileAPICache reads the cache in baseDir. A missing or unreadable
+// file starts an empty cache.
+func loadGofileAPICache(baseDir string, ttl time.Duration) *gofileAPICache {
+	cache := &gofileAPICache{
+		path:    filepath.Join(baseDir, GofileCacheFileName),
+		ttl:     ttl,
+		entries: make(map[string]gofileCacheEntry),
+	}
+	data, err := os.ReadFile(cache.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("Failed to read gofile API cache", "path", cache.path, "error", err)
+		}
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache.entries); err != nil {
+		slog.Warn("Ignoring corrupt gofile API cache", "path", cache.path, "error", err)
+		cache.entries = make(map[string]gofileCacheEntry)
+	}
+	return cache
+}
+
+func gofileCacheKey(contentID, password string) string {
+	if password == "" {
+		return contentID
+	}
+	return contentID + ":" + hashPassword(password)
+}
+
+// get returns the cached content unless it is older than the TTL.
+func (c *gofileAPICache) get(contentID, password string) (gofileContentData, bool) {
+	entry, ok := c.entries[gofileCacheKey(contentID, password)]
+	if !ok || time.Since(entry.FetchedAt) > c.ttl {
+		return gofileContentData{}, false
+	}
+	return entry.Content, true
+}
+
+func (c *gofileAPICache) put(contentID, password string, content gofileContentData) {
+	c.entries[gofileCacheKey(contentID, password)] = gofileCacheEntry{FetchedAt: time.Now(), Content: content}
+	c.dirty = true
+}
+
+// save writes the cache when it changed, dropping expired entries.
+func (c *gofileAPICache) save() {
+	if !c.dirty {
+		return
+	}
+	for key, entry := range c.entries {
+		if time.Since(entry.FetchedAt) > c.ttl {
+			delete(c.entries, key)
+		}
+	}
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(c.path, data)
+	}
+	if err != nil {
+		slog.Warn("Failed to write gofile API cache", "path", c.path, "error", err)
+		return
+	}
+	c.dirty = false
+}
+
+// fetchContentCached is fetchContent answered from cache when possible; a
+// nil cache always queries the API.
+func (gh *GofileHandler) fetchContentCached(cache *gofileAPICache, contentID, token, password string) (gofileContentData, error) {
+	if cache != nil {
+		if content, ok := cache.get(contentID, password); ok {
+			slog.Debug("Using cached gofile content listing", "content_id", contentID)
+			return content, nil
+		}
+	}
+	content, err := gh.fetchContent(contentID, token, password)
+	if err != nil {
+		return content, err
+	}
+	if cache != nil {
+		cache.put(contentID, password, content)
+	}
+	return content, nil
+}
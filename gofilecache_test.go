@@ -0,0 +1,86 @@
+package south2md
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestContentTreeUsesPersistentAPICache(t *testing.T) {
+	baseDir := filepath.Join(t.TempDir(), "42", "gofile")
+	requests := 0
+	newHandler := func() *GofileHandler {
+		return &GofileHandler{
+			maxRetries: 1,
+			cacheTTL:   time.Hour,
+			httpClient: &http.Client{
+				Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					requests++
+					body := mustGzipJSON(t, map[string]any{
+						"status": "ok",
+						"data": map[string]any{
+							"id":   "abc",
+							"type": "folder",
+							"name": "root",
+							"children": map[string]any{
+								"a": map[string]any{"id": "a", "type": "file", "name": "a.zip", "size": 10, "link": "https://store/a.zip"},
+							},
+						},
+					})
+					return &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: io.NopCloser(bytes.NewReader(body))}, nil
+				}),
+			},
+		}
+	}
+
+	for run := 1; run <= 2; run++ {
+		files, err := newHandler().contentTree(baseDir, "abc", "tok")
+		if err != nil {
+			t.Fatalf("run %d: contentTree failed: %v", run, err)
+		}
+		if len(files) != 1 || files[0].Filename != "a.zip" {
+			t.Fatalf("run %d: unexpected files %+v", run, files)
+		}
+	}
+	if requests != 1 {
+		t.Fatalf("expected the second run to use the cache, got %d API requests", requests)
+	}
+
+	// Age the entry past the TTL.
+	cachePath := filepath.Join(baseDir, GofileCacheFileName)
+	var entries map[string]gofileCacheEntry
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		t.Fatalf("read cache: %v", err)
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatalf("decode cache: %v", err)
+	}
+	entry := entries["abc"]
+	entry.FetchedAt = time.Now().Add(-2 * time.Hour)
+	entries["abc"] = entry
+	data, _ = json.Marshal(entries)
+	if err := os.WriteFile(cachePath, data, 0644); err != nil {
+		t.Fatalf("write cache: %v", err)
+	}
+	if _, err := newHandler().contentTree(baseDir, "abc", "tok"); err != nil {
+		t.Fatalf("contentTree failed: %v", err)
+	}
+	if requests != 2 {
+		t.Fatalf("expected an expired entry to be refetched, got %d API requests", requests)
+	}
+
+	handler := newHandler()
+	handler.cacheTTL = 0
+	if _, err := handler.contentTree(baseDir, "abc", "tok"); err != nil {
+		t.Fatalf("contentTree failed: %v", err)
+	}
+	if requests != 3 {
+		t.Fatalf("expected a zero TTL to bypass the cache, got %d API requests", requests)
+	}
+}
@@ -0,0 +1,189 @@
+package south2md
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gofileRateLimitStatus is the API status gofile answers with when the
+// client is rate limited, sometimes with HTTP 200.
+const gofileRateLimitStatus = "error-rateLimit"
+
+// Backoff used when a rate-limited response carries no Retry-After.
+const (
+	gofileRateLimitBackoff    = 5 * time.Second
+	gofileRateLimitMaxBackoff = time.Minute
+	// gofileMaxRetryAfter is the longest Retry-After honored; longer waits
+	// fail the request instead of stalling the run.
+	gofileMaxRetryAfter = 10 * time.Minute
+)
+
+// GofileRateLimitError reports that gofile rate limited a request.
+// RetryAfter is the server's requested wait; HasRetryAfter is false when the
+// response carried no usable Retry-After header.
+type GofileRateLimitError struct {
+	RetryAfter    time.Duration
+	HasRetryAfter bool
+}
+
+func (e *GofileRateLimitError) Error() string {
+	if e.HasRetryAfter {
+		return fmt.Sprintf("gofile rate limit exceeded, retry after %s", e.RetryAfter)
+	}
+	return "gofile rate limit exceeded"
+}
+
+// tokenBucket is a token-bucket limiter: bursts of up to burst requests,
+// refilled at rate tokens per second. pause holds every waiter until a
+// server-requested Retry-After has passed.
+type tokenBucket struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	tokens    float64
+	last      time.Time
+	notBefore time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// gofileBuckets holds one bucket per rate. gofile limits by client IP, so
+// all handlers of the process (one per thread in a batch) share it.
+var gofileBuckets sync.Map
+
+// sharedGofileBucket returns the process-wide bucket for rate requests per
+// second, or nil when rate is 0 (unlimited).
+func sharedGofileBucket(rate float64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	bucket, _ := gofileBuckets.LoadOrStore(rate, newTokenBucket(rate, max(1, int(math.Ceil(rate)))))
+	return bucket.(*tokenBucket)
+}
+
+// Wait blocks until a token is available or ctx is done. A nil bucket never
+// blocks.
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+		var wait time.Duration
+		switch {
+		case now.Before(b.notBefore):
+			wait = b.notBefore.Sub(now)
+		case b.tokens >= 1:
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		default:
+			wait = time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		}
+		b.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// pause holds all requests for d and empties the bucket, so requests resume
+// one by one afterwards.
+func (b *tokenBucket) pause(d time.Duration) {
+	if b == nil || d <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until := time.Now().Add(d); until.After(b.notBefore) {
+		b.notBefore = until
+	}
+	b.tokens = 0
+}
+
+// rateLimitErrorFromResponse builds a GofileRateLimitError from resp's
+// Retry-After header.
+func rateLimitErrorFromResponse(resp *http.Response) *GofileRateLimitError {
+	retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	return &GofileRateLimitError{RetryAfter: retryAfter, HasRetryAfter: ok}
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP
+// date. ok is false when the header is absent or malformed.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(0, time.Duration(seconds)*time.Second), true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(0, at.Sub(now)), true
+	}
+	return 0, false
+}
+
+// rateLimitWait returns how long to wait before retry attempt (0-based)
+// after err: the server's Retry-After, or an exponential backoff.
+func rateLimitWait(err *GofileRateLimitError, attempt int) time.Duration {
+	if err.HasRetryAfter {
+		return err.RetryAfter
+	}
+	return min(gofileRateLimitBackoff<<attempt, gofileRateLimitMaxBackoff)
+}
+
+// waitRateLimit pauses the shared bucket and sleeps for the wait after a
+// rate-limited attempt. It fails when the server asks for more than
+// gofileMaxRetryAfter.
+func (gh *GofileHandler) waitRateLimit(ctx context.Context, rlErr *GofileRateLimitError, attempt int) error {
+	wait := rateLimitWait(rlErr, attempt)
+	if wait > gofileMaxRetryAfter {
+		return rlErr
+	}
+	gh.metrics.Add(MetricRetriesTotal, 1, "component", MetricsComponentGofile)
+	slog.Warn("Gofile rate limit hit, backing off", "wait", wait, "attempt", attempt+1)
+	gh.limiter.pause(wait)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryRateLimited runs call again while it fails with a GofileRateLimitError
+// (an "error-rateLimit" API status), up to maxRetries attempts.
+func (gh *GofileHandler) retryRateLimited(call func() error) error {
+	attempts := max(1, gh.maxRetries)
+	for attempt := 0; ; attempt++ {
+		err := call()
+		var rlErr *GofileRateLimitError
+		if !errors.As(err, &rlErr) || attempt+1 >= attempts {
+			return err
+		}
+		if err := gh.waitRateLimit(context.Background(), rlErr, attempt); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package south2md
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDoRequestWithRetryHonorsRetryAfterOn429(t *testing.T) {
+	calls := 0
+	handler := &GofileHandler{
+		maxRetries: 3,
+		httpClient: &http.Client{
+			Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				calls++
+				if calls == 1 {
+					header := make(http.Header)
+					header.Set("Retry-After", "0")
+					return &http.Response{StatusCode: http.StatusTooManyRequests, Header: header, Body: io.NopCloser(bytes.NewReader(nil))}, nil
+				}
+				return &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: io.NopCloser(bytes.NewReader([]byte("ok")))}, nil
+			}),
+		},
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://store/a.zip", nil)
+	resp, err := handler.doRequestWithRetry(req)
+	if err != nil {
+		t.Fatalf("doRequestWithRetry failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls != 2 {
+		t.Fatalf("expected a retry after the 429, got status %d after %d calls", resp.StatusCode, calls)
+	}
+}
+
+func TestFetchContentRetriesRateLimitStatus(t *testing.T) {
+	calls := 0
+	handler := &GofileHandler{
+		maxRetries: 3,
+		httpClient: &http.Client{
+			Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				calls++
+				header := make(http.Header)
+				payload := map[string]any{"status": "ok", "data": map[string]any{"id": "abc", "type": "folder", "name": "root"}}
+				if calls == 1 {
+					header.Set("Retry-After", "0")
+					payload = map[string]any{"status": gofileRateLimitStatus, "data": map[string]any{}}
+				}
+				body := mustGzipJSON(t, payload)
+				return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(bytes.NewReader(body))}, nil
+			}),
+		},
+	}
+
+	content, err := handler.fetchContent("abc", "tok", "")
+	if err != nil {
+		t.Fatalf("fetchContent failed: %v", err)
+	}
+	if content.ID != "abc" || calls != 2 {
+		t.Fatalf("expected the rate-limited call to be retried, got %+v after %d calls", content, calls)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"7", 7 * time.Second, true},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tc := range cases {
+		got, ok := parseRetryAfter(tc.value, now)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("parseRetryAfter(%q) = %s, %v; want %s, %v", tc.value, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestTokenBucketPauseHoldsWaiters(t *testing.T) {
+	bucket := newTokenBucket(1000, 5)
+	bucket.pause(50 * time.Millisecond)
+
+	start := time.Now()
+	if err := bucket.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Fatalf("expected Wait to honor the pause, returned after %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	bucket.pause(time.Hour)
+	if err := bucket.Wait(ctx); err == nil {
+		t.Fatal("expected Wait to stop on a cancelled context")
+	}
+}
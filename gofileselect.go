@@ -0,0 +1,141 @@
+package south2md
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"path/filepath"
+)
+
+// GofileFileSelector chooses which files of a gofile share to download.
+// files are the share's remote files that passed the include patterns; the
+// returned subset is downloaded and the rest is recorded as skipped.
+type GofileFileSelector func(shareURL string, files []GofileManifestEntry) ([]GofileManifestEntry, error)
+
+// SetFileSelector installs an interactive selector consulted once per share
+// before downloading; nil downloads every matching file.
+func (gh *GofileHandler) SetFileSelector(selector GofileFileSelector) {
+	if gh == nil {
+		return
+	}
+	gh.selector = selector
+}
+
+// matchesGofileInclude reports whether the share-relative path rel matches
+// one of patterns, compared against the full path or its base name. An
+// empty pattern list matches everything.
+func matchesGofileInclude(patterns []string, rel string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// gofileManifestEntry describes file relative to contentDir.
+func gofileManifestEntry(contentDir string, file gofileRemoteFile) GofileManifestEntry {
+	rel, err := filepath.Rel(contentDir, filepath.Join(file.Path, file.Filename))
+	if err != nil {
+		rel = file.Filename
+	}
+	return GofileManifestEntry{
+		Path: filepath.ToSlash(rel),
+		Size: file.Size,
+		MD5:  file.MD5,
+		Link: file.Link,
+	}
+}
+
+// filterIncluded splits files into those matching the include patterns and
+// within the per-file size cap, and the skipped rest.
+func (gh *GofileHandler) filterIncluded(contentDir string, files []gofileRemoteFile) ([]gofileRemoteFile, []GofileManifestEntry) {
+	if len(gh.include) == 0 && gh.maxFileSize <= 0 {
+		return files, nil
+	}
+	selected := make([]gofileRemoteFile, 0, len(files))
+	var skipped []GofileManifestEntry
+	for _, file := range files {
+		entry := gofileManifestEntry(contentDir, file)
+		switch {
+		case !matchesGofileInclude(gh.include, entry.Path):
+			skipped = append(skipped, entry)
+		case gh.maxFileSize > 0 && file.Size > gh.maxFileSize:
+			slog.Info("Gofile file larger than the per-file limit, skipping", "path", entry.Path, "size", file.Size, "limit", gh.maxFileSize)
+			skipped = append(skipped, entry)
+		default:
+			selected = append(selected, file)
+		}
+	}
+	return selected, skipped
+}
+
+// selectFiles applies the include patterns and the interactive selector to
+// one share and remembers the skipped files for its metadata record.
+func (gh *GofileHandler) selectFiles(rawURL, contentDir string, files []gofileRemoteFile) ([]gofileRemoteFile, error) {
+	selected, skipped := gh.filterIncluded(contentDir, files)
+	if gh.selector != nil && len(selected) > 0 {
+		entries := make([]GofileManifestEntry, len(selected))
+		for i, file := range selected {
+			entries[i] = gofileManifestEntry(contentDir, file)
+		}
+		chosen, err := gh.selector(rawURL, entries)
+		if err != nil {
+			return nil, fmt.Errorf("file selection failed: %w", err)
+		}
+		keep := make(map[string]bool, len(chosen))
+		for _, entry := range chosen {
+			keep[entry.Path] = true
+		}
+		kept := selected[:0:0]
+		for i, file := range selected {
+			if keep[entries[i].Path] {
+				kept = append(kept, file)
+			} else {
+				skipped = append(skipped, entries[i])
+			}
+		}
+		selected = kept
+	}
+
+	if len(skipped) > 0 {
+		if gh.skipped == nil {
+			gh.skipped = make(map[string][]GofileManifestEntry)
+		}
+		gh.skipped[rawURL] = skipped
+		slog.Info("Gofile files skipped by selection", "url", rawURL, "selected", len(selected), "skipped", len(skipped))
+	}
+	return selected, nil
+}
+
+// exceedsMaxSize reports whether the selected files of a share are larger
+// than the --gofile-max-size cap, recording the decision when they are.
+func (gh *GofileHandler) exceedsMaxSize(rawURL string, files []gofileRemoteFile) bool {
+	if gh.maxSize <= 0 {
+		return false
+	}
+	var total int64
+	for _, file := range files {
+		total += file.Size
+	}
+	if total <= gh.maxSize {
+		return false
+	}
+
+	reason := fmt.Sprintf("%s: %s in %d file(s) exceeds gofile max size %s",
+		rawURL, FormatByteSize(total), len(files), FormatByteSize(gh.maxSize))
+	slog.Warn("Gofile share too large, recording manifest only", "url", rawURL, "reason", reason)
+	gh.summary.RecordDecision(PolicyDecision{
+		Policy: "gofile_max_size",
+		Scope:  "gofile",
+		Action: "manifest_only",
+		Reason: reason,
+	})
+	return true
+}
@@ -0,0 +1,122 @@
+package south2md
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newSelectionTestHandler(t *testing.T, downloads *[]string) *GofileHandler {
+	t.Helper()
+	return &GofileHandler{
+		rootDir:     t.TempDir(),
+		downloadDir: "gofile",
+		download:    true,
+		token:       "tok",
+		maxRetries:  1,
+		summary:     NewRunSummary(),
+		httpClient: &http.Client{
+			Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if strings.HasPrefix(req.URL.String(), "https://api.gofile.io/contents/share1") {
+					body := mustGzipJSON(t, map[string]any{
+						"status": "ok",
+						"data": map[string]any{
+							"id":   "share1",
+							"type": "folder",
+							"name": "root",
+							"children": map[string]any{
+								"a": map[string]any{"id": "a", "type": "file", "name": "a.zip", "size": 3, "link": "https://store/a.zip"},
+								"b": map[string]any{"id": "b", "type": "file", "name": "b.txt", "size": 200, "link": "https://store/b.txt"},
+							},
+						},
+					})
+					return &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: io.NopCloser(bytes.NewReader(body))}, nil
+				}
+				*downloads = append(*downloads, req.URL.String())
+				return &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: io.NopCloser(strings.NewReader("abc"))}, nil
+			}),
+		},
+	}
+}
+
+func TestDownloadGofileIncludePatternsRecordSkippedFiles(t *testing.T) {
+	var downloads []string
+	handler := newSelectionTestHandler(t, &downloads)
+	handler.include = []string{"*.zip"}
+
+	post := &Post{TID: "42"}
+	got, err := handler.DownloadAndAnnotateGofileLinks("42", []byte("see https://gofile.io/d/share1"), post)
+	if err != nil {
+		t.Fatalf("DownloadAndAnnotateGofileLinks failed: %v", err)
+	}
+	if len(downloads) != 1 || downloads[0] != "https://store/a.zip" {
+		t.Fatalf("expected only a.zip to be downloaded, got %v", downloads)
+	}
+	if !strings.Contains(string(got), "(local: gofile/share1)") {
+		t.Fatalf("expected local annotation, got %q", string(got))
+	}
+	if len(post.GofileFiles) != 1 || len(post.GofileFiles[0].Skipped) != 1 || post.GofileFiles[0].Skipped[0].Path != "b.txt" {
+		t.Fatalf("expected b.txt to be recorded as skipped, got %+v", post.GofileFiles)
+	}
+}
+
+func TestDownloadGofileSelectorChoosesFiles(t *testing.T) {
+	var downloads []string
+	handler := newSelectionTestHandler(t, &downloads)
+	var offered []string
+	handler.SetFileSelector(func(shareURL string, files []GofileManifestEntry) ([]GofileManifestEntry, error) {
+		for _, file := range files {
+			offered = append(offered, file.Path)
+		}
+		return files[:1], nil
+	})
+
+	post := &Post{TID: "42"}
+	if _, err := handler.DownloadAndAnnotateGofileLinks("42", []byte("https://gofile.io/d/share1"), post); err != nil {
+		t.Fatalf("DownloadAndAnnotateGofileLinks failed: %v", err)
+	}
+	if len(offered) != 2 || len(downloads) != 1 || downloads[0] != "https://store/a.zip" {
+		t.Fatalf("expected the selector's choice to be downloaded, offered %v, downloaded %v", offered, downloads)
+	}
+	if len(post.GofileFiles[0].Skipped) != 1 || post.GofileFiles[0].Skipped[0].Path != "b.txt" {
+		t.Fatalf("expected the deselected file to be recorded, got %+v", post.GofileFiles[0].Skipped)
+	}
+}
+
+func TestDownloadGofileMaxSizeRecordsManifestOnly(t *testing.T) {
+	var downloads []string
+	handler := newSelectionTestHandler(t, &downloads)
+	handler.maxSize = 150
+
+	post := &Post{TID: "42"}
+	got, err := handler.DownloadAndAnnotateGofileLinks("42", []byte("see https://gofile.io/d/share1"), post)
+	if err != nil {
+		t.Fatalf("DownloadAndAnnotateGofileLinks failed: %v", err)
+	}
+	if len(downloads) != 0 {
+		t.Fatalf("expected no downloads over the cap, got %v", downloads)
+	}
+	if !strings.Contains(string(got), "(manifest only: 2 files, 203 B)") {
+		t.Fatalf("expected manifest annotation, got %q", string(got))
+	}
+	if len(post.GofileFiles) != 1 || !post.GofileFiles[0].ManifestOnly {
+		t.Fatalf("expected a manifest-only record, got %+v", post.GofileFiles)
+	}
+	if decisions := handler.summary.Decisions(); len(decisions) != 1 || decisions[0].Policy != "gofile_max_size" {
+		t.Fatalf("expected a gofile_max_size decision, got %+v", decisions)
+	}
+
+	// With *.zip selected the share fits under the cap.
+	downloads = nil
+	handler = newSelectionTestHandler(t, &downloads)
+	handler.maxSize = 150
+	handler.include = []string{"*.zip"}
+	if _, err := handler.DownloadAndAnnotateGofileLinks("42", []byte("https://gofile.io/d/share1"), &Post{TID: "42"}); err != nil {
+		t.Fatalf("DownloadAndAnnotateGofileLinks failed: %v", err)
+	}
+	if len(downloads) != 1 {
+		t.Fatalf("expected the selected file to be downloaded, got %v", downloads)
+	}
+}
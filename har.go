@@ -0,0 +1,405 @@
+package south2md
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHARBodyLimit is how many bytes of each response body a HAR
+// recording keeps.
+const DefaultHARBodyLimit = 64 * 1024
+
+// redactedValue replaces credentials in recorded headers and cookies.
+const redactedValue = "(redacted)"
+
+// HARRecorder records the HTTP exchanges passing through its transport and
+// writes them as an HTTP Archive (HAR 1.2) for debugging. Cookie and
+// Authorization values are redacted; cookie names are kept.
+type HARRecorder struct {
+	bodyLimit int
+
+	mu      sync.Mutex
+	records []*harRecord
+}
+
+// harRecord is one exchange being recorded; its response body keeps
+// arriving after RoundTrip returns.
+type harRecord struct {
+	mu    sync.Mutex
+	entry harEntry
+	body  bytes.Buffer
+}
+
+// NewHARRecorder creates a recorder keeping up to bodyLimit bytes of each
+// textual response body; bodyLimit <= 0 uses DefaultHARBodyLimit.
+func NewHARRecorder(bodyLimit int) *HARRecorder {
+	if bodyLimit <= 0 {
+		bodyLimit = DefaultHARBodyLimit
+	}
+	return &HARRecorder{bodyLimit: bodyLimit}
+}
+
+// Transport wraps next so that every exchange is recorded.
+func (r *HARRecorder) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &harTransport{recorder: r, next: next}
+}
+
+// Len returns the number of recorded exchanges.
+func (r *HARRecorder) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.records)
+}
+
+// WriteFile writes the recorded exchanges to path, sorted by start time.
+// Exchanges whose body is still being read are written as far as they got.
+func (r *HARRecorder) WriteFile(path string) error {
+	r.mu.Lock()
+	entries := make([]harEntry, len(r.records))
+	for i, record := range r.records {
+		record.mu.Lock()
+		entries[i] = record.entry
+		entries[i].Response.Content.Text = record.body.String()
+		record.mu.Unlock()
+	}
+	r.mu.Unlock()
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].StartedDateTime < entries[j].StartedDateTime })
+
+	data, err := json.MarshalIndent(harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "south2md", Version: "1"},
+		Entries: entries,
+	}}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("编码HAR失败: %w", err)
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("创建HAR目录失败: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("写入HAR文件失败: %w", err)
+	}
+	return nil
+}
+
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// harTimings are in milliseconds; -1 means the phase did not happen, e.g.
+// no DNS lookup on a reused connection.
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type harTransport struct {
+	recorder *HARRecorder
+	next     http.RoundTripper
+}
+
+// harPhases collects the connection timestamps of one request.
+type harPhases struct {
+	mu                        sync.Mutex
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	gotConn, wroteRequest     time.Time
+	firstByte                 time.Time
+}
+
+func (p *harPhases) mark(t *time.Time) func() {
+	return func() {
+		p.mu.Lock()
+		*t = time.Now()
+		p.mu.Unlock()
+	}
+}
+
+func (p *harPhases) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { p.mark(&p.dnsStart)() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { p.mark(&p.dnsDone)() },
+		ConnectStart:         func(string, string) { p.mark(&p.connectStart)() },
+		ConnectDone:          func(string, string, error) { p.mark(&p.connectDone)() },
+		TLSHandshakeStart:    p.mark(&p.tlsStart),
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { p.mark(&p.tlsDone)() },
+		GotConn:              func(httptrace.GotConnInfo) { p.mark(&p.gotConn)() },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { p.mark(&p.wroteRequest)() },
+		GotFirstResponseByte: p.mark(&p.firstByte),
+	}
+}
+
+func millis(from, to time.Time) float64 {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return -1
+	}
+	return float64(to.Sub(from).Microseconds()) / 1000
+}
+
+func (t *harTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	phases := &harPhases{}
+	start := time.Now()
+	record := &harRecord{entry: harEntry{
+		StartedDateTime: start.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: req.Proto,
+			Cookies:     harCookies(req.Cookies()),
+			Headers:     harHeaders(req.Header),
+			QueryString: harQuery(req),
+			HeadersSize: -1,
+			BodySize:    req.ContentLength,
+		},
+	}}
+	if record.entry.Request.HTTPVersion == "" {
+		record.entry.Request.HTTPVersion = "HTTP/1.1"
+	}
+	t.recorder.mu.Lock()
+	t.recorder.records = append(t.recorder.records, record)
+	t.recorder.mu.Unlock()
+
+	resp, err := t.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), phases.trace())))
+	headersAt := time.Now()
+
+	record.mu.Lock()
+	defer record.mu.Unlock()
+	entry := &record.entry
+	entry.Timings = phases.timings(start, headersAt)
+	entry.Time = millis(start, headersAt)
+	if err != nil {
+		entry.Response = harResponse{Cookies: []harNameValue{}, Headers: []harNameValue{}, HeadersSize: -1, BodySize: -1}
+		entry.Comment = err.Error()
+		return nil, err
+	}
+
+	mimeType := resp.Header.Get("Content-Type")
+	entry.Response = harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode))),
+		HTTPVersion: resp.Proto,
+		Cookies:     harCookies(resp.Cookies()),
+		Headers:     harHeaders(resp.Header),
+		Content:     harContent{Size: -1, MimeType: mimeType},
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	keep := 0
+	switch {
+	case !isTextualMIME(mimeType):
+		entry.Response.Content.Comment = "binary body not recorded"
+	case resp.Header.Get("Content-Encoding") != "" && !strings.EqualFold(resp.Header.Get("Content-Encoding"), "identity"):
+		entry.Response.Content.Comment = "encoded body not recorded"
+	default:
+		keep = t.recorder.bodyLimit
+	}
+	resp.Body = &harBody{ReadCloser: resp.Body, record: record, start: start, headersAt: headersAt, keep: keep}
+	return resp, nil
+}
+
+func (p *harPhases) timings(start, headersAt time.Time) harTimings {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t := harTimings{
+		Blocked: millis(start, p.dnsStart),
+		DNS:     millis(p.dnsStart, p.dnsDone),
+		Connect: millis(p.connectStart, p.connectDone),
+		SSL:     millis(p.tlsStart, p.tlsDone),
+		Send:    millis(p.gotConn, p.wroteRequest),
+		Wait:    millis(p.wroteRequest, p.firstByte),
+		Receive: 0,
+	}
+	if p.dnsStart.IsZero() {
+		t.Blocked = millis(start, p.connectStart)
+		if p.connectStart.IsZero() {
+			t.Blocked = millis(start, p.gotConn)
+		}
+	}
+	if t.Send < 0 {
+		t.Send = 0
+	}
+	if t.Wait < 0 {
+		t.Wait = millis(start, headersAt)
+	}
+	return t
+}
+
+// harBody copies up to keep bytes of the body into the record and finishes
+// the entry's size and timings once the body is drained or closed.
+type harBody struct {
+	io.ReadCloser
+	record    *harRecord
+	start     time.Time
+	headersAt time.Time
+	keep      int
+	read      int64
+	done      bool
+}
+
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.record.mu.Lock()
+	b.read += int64(n)
+	if room := b.keep - b.record.body.Len(); room > 0 {
+		b.record.body.Write(p[:min(n, room)])
+	}
+	if err == io.EOF {
+		b.finishLocked()
+	}
+	b.record.mu.Unlock()
+	return n, err
+}
+
+func (b *harBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.record.mu.Lock()
+	b.finishLocked()
+	b.record.mu.Unlock()
+	return err
+}
+
+func (b *harBody) finishLocked() {
+	if b.done {
+		return
+	}
+	b.done = true
+	now := time.Now()
+	entry := &b.record.entry
+	entry.Response.Content.Size = b.read
+	entry.Response.BodySize = b.read
+	entry.Timings.Receive = millis(b.headersAt, now)
+	entry.Time = millis(b.start, now)
+	if b.keep > 0 && b.read > int64(b.record.body.Len()) {
+		entry.Response.Content.Comment = fmt.Sprintf("truncated to %d of %d bytes", b.record.body.Len(), b.read)
+	}
+}
+
+// isTextualMIME reports whether a body of mimeType is worth keeping as text.
+func isTextualMIME(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return mimeType == ""
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml") ||
+		mediaType == "application/javascript"
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	values := []harNameValue{}
+	for name, list := range header {
+		for _, value := range list {
+			switch http.CanonicalHeaderKey(name) {
+			case "Cookie", "Set-Cookie", "Authorization", "Proxy-Authorization":
+				value = redactedValue
+			}
+			values = append(values, harNameValue{Name: name, Value: value})
+		}
+	}
+	sortNameValues(values)
+	return values
+}
+
+func harCookies(cookies []*http.Cookie) []harNameValue {
+	values := []harNameValue{}
+	for _, cookie := range cookies {
+		values = append(values, harNameValue{Name: cookie.Name, Value: redactedValue})
+	}
+	return values
+}
+
+func harQuery(req *http.Request) []harNameValue {
+	values := []harNameValue{}
+	for name, list := range req.URL.Query() {
+		for _, value := range list {
+			values = append(values, harNameValue{Name: name, Value: value})
+		}
+	}
+	sortNameValues(values)
+	return values
+}
+
+func sortNameValues(values []harNameValue) {
+	sort.SliceStable(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+}
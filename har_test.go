@@ -0,0 +1,77 @@
+package south2md
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHARRecorderWritesExchanges(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/image.jpg" {
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write([]byte{0xff, 0xd8, 0xff})
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, strings.Repeat("a", 100))
+	}))
+	defer server.Close()
+
+	recorder := NewHARRecorder(10)
+	client := NewHTTPClient(&HTTPOptions{Timeout: 5 * time.Second, Proxy: ProxyDirect, HAR: recorder})
+	for _, path := range []string{"/read.php?tid=1", "/image.jpg"} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		req.Header.Set("Cookie", "winduser=secret")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	path := filepath.Join(t.TempDir(), "run.har")
+	if err := recorder.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile returned error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read HAR: %v", err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Fatalf("expected cookie values to be redacted:\n%s", data)
+	}
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		t.Fatalf("decode HAR: %v", err)
+	}
+	if har.Log.Version != "1.2" || len(har.Log.Entries) != 2 {
+		t.Fatalf("expected two HAR 1.2 entries, got %+v", har.Log)
+	}
+
+	page := har.Log.Entries[0]
+	if page.Request.QueryString[0] != (harNameValue{Name: "tid", Value: "1"}) || page.Request.Cookies[0].Name != "winduser" {
+		t.Fatalf("unexpected request: %+v", page.Request)
+	}
+	content := page.Response.Content
+	if page.Response.Status != http.StatusOK || content.Size != 100 || content.Text != strings.Repeat("a", 10) ||
+		content.Comment != "truncated to 10 of 100 bytes" || page.Response.Cookies[0].Name != "session" {
+		t.Fatalf("unexpected page response: %+v", page.Response)
+	}
+	if page.Time < 0 || page.Timings.Wait < 0 {
+		t.Fatalf("expected timings, got %+v", page.Timings)
+	}
+
+	image := har.Log.Entries[1].Response.Content
+	if image.Size != 3 || image.Text != "" || image.MimeType != "image/jpeg" {
+		t.Fatalf("expected the binary body to be sized but not kept, got %+v", image)
+	}
+}
@@ -0,0 +1,90 @@
+package south2md
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// HistoryFileName is the run history at the store root, one JSON object per
+// run appended as it ends.
+const HistoryFileName = "history.jsonl"
+
+// RunRecord is one run of a command in the history.
+type RunRecord struct {
+	ID        int           `json:"-"` // 1-based position in the history
+	Command   string        `json:"command"`
+	TIDs      []string      `json:"tids,omitempty"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	Pages     int           `json:"pages,omitempty"`  // Thread pages fetched
+	Images    int           `json:"images,omitempty"` // Image requests sent
+	Bytes     int64         `json:"bytes,omitempty"`  // Bytes received from the network
+	Output    string        `json:"output,omitempty"` // Export target, if any
+	Error     string        `json:"error,omitempty"`
+}
+
+// OK reports whether the run succeeded.
+func (r RunRecord) OK() bool {
+	return r.Error == ""
+}
+
+// AppendRun adds rec to the end of the history. Each record is written with
+// a single append, so concurrent runs don't interleave lines.
+func (ps *PostStore) AppendRun(rec RunRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode run record: %w", err)
+	}
+	if err := os.MkdirAll(ps.rootDir, 0755); err != nil {
+		return fmt.Errorf("failed to create store root: %w", err)
+	}
+	file, err := os.OpenFile(ps.historyPath(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open run history: %w", err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write run history: %w", err)
+	}
+	return file.Close()
+}
+
+// LoadHistory returns every run in the history, oldest first. A missing
+// history yields none; unreadable lines are skipped but keep their ID.
+func (ps *PostStore) LoadHistory() ([]RunRecord, error) {
+	file, err := os.Open(ps.historyPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open run history: %w", err)
+	}
+	defer file.Close()
+
+	var records []RunRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var rec RunRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			slog.Warn("Skipping malformed run history line", "line", line, "error", err)
+			continue
+		}
+		rec.ID = line
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read run history: %w", err)
+	}
+	return records, nil
+}
+
+func (ps *PostStore) historyPath() string {
+	return filepath.Join(ps.rootDir, HistoryFileName)
+}
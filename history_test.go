@@ -0,0 +1,44 @@
+package south2md
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPostStoreHistory(t *testing.T) {
+	store := NewPostStore(t.TempDir())
+	if records, err := store.LoadHistory(); err != nil || len(records) != 0 {
+		t.Fatalf("expected an empty history, got %v (%v)", records, err)
+	}
+
+	started := time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC)
+	if err := store.AppendRun(RunRecord{Command: "fetch", TIDs: []string{"2636739"}, StartedAt: started, Duration: 3 * time.Second, Pages: 2, Bytes: 4096}); err != nil {
+		t.Fatalf("AppendRun returned error: %v", err)
+	}
+	file, err := os.OpenFile(filepath.Join(store.RootDir(), HistoryFileName), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("open history: %v", err)
+	}
+	file.WriteString("{truncated\n")
+	file.Close()
+	if err := store.AppendRun(RunRecord{Command: "retry", TIDs: []string{"1"}, StartedAt: started.Add(time.Hour), Error: "timeout"}); err != nil {
+		t.Fatalf("AppendRun returned error: %v", err)
+	}
+
+	records, err := store.LoadHistory()
+	if err != nil {
+		t.Fatalf("LoadHistory returned error: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %+v", records)
+	}
+	first, second := records[0], records[1]
+	if first.ID != 1 || first.Command != "fetch" || first.TIDs[0] != "2636739" || !first.StartedAt.Equal(started) || first.Duration != 3*time.Second || first.Bytes != 4096 || !first.OK() {
+		t.Fatalf("unexpected first record %+v", first)
+	}
+	if second.ID != 3 || second.Command != "retry" || second.OK() {
+		t.Fatalf("expected the failed retry to keep ID 3, got %+v", second)
+	}
+}
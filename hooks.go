@@ -0,0 +1,63 @@
+package south2md
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// Hook events, also the config keys holding their commands.
+const (
+	HookThreadArchived = "on_thread_archived" // a thread was fetched and stored
+	HookUpdate         = "on_update"          // a stored thread gained new floors
+	HookError          = "on_error"           // archiving a thread failed
+)
+
+// HookEnv describes the thread a hook command runs for. Fields the event
+// doesn't know, such as the title of a thread that failed before it was
+// parsed, are empty.
+type HookEnv struct {
+	Event             string
+	TID               string
+	Title             string
+	URL               string
+	Path              string // the thread's store directory
+	Output            string // export target, if any
+	Floors            int
+	NewFloors         int    // floors the previous snapshot didn't have; all of them on the first fetch
+	NewFloorsMarkdown string // the new floors with their first lines, see PostDiff.NewFloorsMarkdown
+	Error             string
+}
+
+// Environ returns env as SOUTH2MD_HOOK_* variables, apart from the
+// SOUTH2MD_* config variables so south2md run by a hook ignores them.
+func (env HookEnv) Environ() []string {
+	return []string{
+		"SOUTH2MD_HOOK_EVENT=" + env.Event,
+		"SOUTH2MD_HOOK_TID=" + env.TID,
+		"SOUTH2MD_HOOK_TITLE=" + env.Title,
+		"SOUTH2MD_HOOK_URL=" + env.URL,
+		"SOUTH2MD_HOOK_PATH=" + env.Path,
+		"SOUTH2MD_HOOK_OUTPUT=" + env.Output,
+		"SOUTH2MD_HOOK_FLOORS=" + strconv.Itoa(env.Floors),
+		"SOUTH2MD_HOOK_NEW_FLOORS=" + strconv.Itoa(env.NewFloors),
+		"SOUTH2MD_HOOK_NEW_FLOORS_MARKDOWN=" + env.NewFloorsMarkdown,
+		"SOUTH2MD_HOOK_ERROR=" + env.Error,
+	}
+}
+
+// RunHook runs command through the system shell (sh -c, or cmd /C on
+// Windows) with env added to the environment and returns its combined
+// output.
+func RunHook(ctx context.Context, command string, env HookEnv) ([]byte, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), env.Environ()...)
+	return cmd.CombinedOutput()
+}
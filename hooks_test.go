@@ -0,0 +1,28 @@
+package south2md
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRunHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh syntax")
+	}
+	env := HookEnv{Event: HookUpdate, TID: "2636739", Title: "a 'quoted' title", Path: "/data/2636739", Floors: 12, NewFloors: 3,
+		NewFloorsMarkdown: "- B12F @bob\n  > hi\n"}
+	output, err := RunHook(context.Background(), `printf '%s|%s|%s|%s|%s|%s' "$SOUTH2MD_HOOK_EVENT" "$SOUTH2MD_HOOK_TID" "$SOUTH2MD_HOOK_TITLE" "$SOUTH2MD_HOOK_FLOORS" "$SOUTH2MD_HOOK_NEW_FLOORS" "$SOUTH2MD_HOOK_NEW_FLOORS_MARKDOWN"`, env)
+	if err != nil {
+		t.Fatalf("RunHook returned error: %v", err)
+	}
+	if got := string(output); got != "on_update|2636739|a 'quoted' title|12|3|- B12F @bob\n  > hi\n" {
+		t.Fatalf("unexpected hook output %q", got)
+	}
+
+	output, err = RunHook(context.Background(), "echo broken >&2; exit 3", env)
+	if err == nil || strings.TrimSpace(string(output)) != "broken" {
+		t.Fatalf("expected the failure with its stderr, got %q (%v)", output, err)
+	}
+}
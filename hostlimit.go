@@ -0,0 +1,186 @@
+package south2md
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Politeness profiles. PolitenessPolite caps every per-host limit at the
+// conservative values below, for long crawls that should stay unnoticed.
+const (
+	PolitenessDefault = "default"
+	PolitenessPolite  = "polite"
+)
+
+// PolitenessProfiles lists the supported politeness profiles.
+var PolitenessProfiles = []string{PolitenessDefault, PolitenessPolite}
+
+// Per-host concurrency caps of the polite profile.
+const (
+	politeForumConcurrency  = 1
+	politeAssetConcurrency  = 2
+	politeGofileConcurrency = 1
+)
+
+// GofileHost is the domain all gofile API and download hosts live under.
+const GofileHost = "gofile.io"
+
+// IsValidPolitenessProfile reports whether name is a supported profile.
+func IsValidPolitenessProfile(name string) bool {
+	for _, profile := range PolitenessProfiles {
+		if profile == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HostConcurrencyLimits derives per-host request limits from config: the
+// forum host gets HTTPMaxConcurrent, gofile hosts HTTPMaxConcurrentGofile and
+// HTTPHostConcurrency adds explicit overrides. fallback applies to every other
+// host (image CDNs), each host counted separately.
+func HostConcurrencyLimits(config *Config) (limits map[string]int, fallback int) {
+	forum, assets, gofile := config.HTTPMaxConcurrent, config.HTTPMaxConcurrentAssets, config.HTTPMaxConcurrentGofile
+	if config.HTTPPoliteness == PolitenessPolite {
+		forum = capLimit(forum, politeForumConcurrency)
+		assets = capLimit(assets, politeAssetConcurrency)
+		gofile = capLimit(gofile, politeGofileConcurrency)
+	}
+
+	limits = make(map[string]int)
+	if host := hostOf(config.BaseURL); host != "" && forum > 0 {
+		limits[host] = forum
+	}
+	if gofile > 0 {
+		limits[GofileHost] = gofile
+	}
+	for host, limit := range config.HTTPHostConcurrency {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host == "" {
+			continue
+		}
+		if config.HTTPPoliteness == PolitenessPolite {
+			limit = capLimit(limit, assets)
+		}
+		limits[host] = limit
+	}
+	return limits, assets
+}
+
+// ValidateHostConcurrency checks the per-host limits in config.
+func ValidateHostConcurrency(config *Config) error {
+	if config.HTTPMaxConcurrentAssets < 0 || config.HTTPMaxConcurrentGofile < 0 {
+		return NewValidationError("max_concurrent_assets/max_concurrent_gofile 不能为负数")
+	}
+	for host, limit := range config.HTTPHostConcurrency {
+		if limit < 0 {
+			return NewValidationError(fmt.Sprintf("host_concurrency[%q] 不能为负数", host))
+		}
+	}
+	if config.HTTPPoliteness != "" && !IsValidPolitenessProfile(config.HTTPPoliteness) {
+		return NewValidationError(fmt.Sprintf("不支持的 politeness 配置 %q (可选: %s)", config.HTTPPoliteness, strings.Join(PolitenessProfiles, ", ")))
+	}
+	return nil
+}
+
+func capLimit(limit, ceiling int) int {
+	if limit <= 0 || limit > ceiling {
+		return ceiling
+	}
+	return limit
+}
+
+func hostOf(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// hostLimitTransport bounds in-flight requests per host. A request holds its
+// slot until the response body is closed, so slow image bodies on a CDN can't
+// eat into the forum's share.
+type hostLimitTransport struct {
+	next     http.RoundTripper
+	limits   map[string]int
+	fallback int
+
+	mu   sync.Mutex
+	sems map[string]chan struct{}
+}
+
+// newHostLimitTransport wraps next with per-host limits. Hosts match the
+// longest limit key equal to them or one of their parent domains; a limit of
+// 0 means unlimited.
+func newHostLimitTransport(next http.RoundTripper, limits map[string]int, fallback int) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &hostLimitTransport{next: next, limits: limits, fallback: fallback, sems: make(map[string]chan struct{})}
+}
+
+// semaphore returns the slot channel for host, or nil when it is unlimited.
+func (t *hostLimitTransport) semaphore(host string) chan struct{} {
+	key, limit := host, t.fallback
+	matched := ""
+	for candidate, candidateLimit := range t.limits {
+		if len(candidate) <= len(matched) {
+			continue
+		}
+		if host == candidate || strings.HasSuffix(host, "."+candidate) {
+			matched = candidate
+			key, limit = candidate, candidateLimit
+		}
+	}
+	if limit <= 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sem, ok := t.sems[key]
+	if !ok {
+		sem = make(chan struct{}, limit)
+		t.sems[key] = sem
+	}
+	return sem
+}
+
+func (t *hostLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	sem := t.semaphore(strings.ToLower(req.URL.Hostname()))
+	if sem == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	select {
+	case sem <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	release := sync.OnceFunc(func() { <-sem })
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releasingBody frees a host slot when the response body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
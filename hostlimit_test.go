@@ -0,0 +1,83 @@
+package south2md
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingTransport records the peak number of in-flight requests per host
+// until the response bodies are closed.
+type blockingTransport struct {
+	mu       sync.Mutex
+	inFlight map[string]int
+	peak     map[string]int
+}
+
+func (b *blockingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	b.mu.Lock()
+	b.inFlight[host]++
+	b.peak[host] = max(b.peak[host], b.inFlight[host])
+	b.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	b.mu.Lock()
+	b.inFlight[host]--
+	b.mu.Unlock()
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestHostLimitTransportBoundsEachHostSeparately(t *testing.T) {
+	next := &blockingTransport{inFlight: map[string]int{}, peak: map[string]int{}}
+	client := &http.Client{Transport: newHostLimitTransport(next, map[string]int{"south-plus.net": 2, "gofile.io": 1}, 3)}
+
+	var wg sync.WaitGroup
+	var failures int32
+	for _, target := range []string{
+		"https://south-plus.net/read.php", "https://www.south-plus.net/read.php",
+		"https://img.example.com/a.jpg", "https://store1.gofile.io/f",
+	} {
+		for i := 0; i < 6; i++ {
+			wg.Add(1)
+			go func(target string) {
+				defer wg.Done()
+				resp, err := client.Get(target)
+				if err != nil {
+					atomic.AddInt32(&failures, 1)
+					return
+				}
+				resp.Body.Close()
+			}(target)
+		}
+	}
+	wg.Wait()
+
+	if failures > 0 {
+		t.Fatalf("%d requests failed", failures)
+	}
+	forumPeak := next.peak["south-plus.net"] + next.peak["www.south-plus.net"]
+	if forumPeak > 4 || next.peak["south-plus.net"] > 2 || next.peak["www.south-plus.net"] > 2 {
+		t.Fatalf("forum peak too high: %v", next.peak)
+	}
+	if next.peak["img.example.com"] > 3 || next.peak["store1.gofile.io"] > 1 {
+		t.Fatalf("asset peaks too high: %v", next.peak)
+	}
+}
+
+func TestHostConcurrencyLimitsPoliteProfile(t *testing.T) {
+	config := NewDefaultConfig()
+	config.HTTPHostConcurrency = map[string]int{"IMG.example.com": 6}
+
+	limits, fallback := HostConcurrencyLimits(config)
+	if limits["south-plus.net"] != 5 || limits[GofileHost] != 2 || limits["img.example.com"] != 6 || fallback != 8 {
+		t.Fatalf("unexpected default limits: %v fallback=%d", limits, fallback)
+	}
+
+	config.HTTPPoliteness = PolitenessPolite
+	limits, fallback = HostConcurrencyLimits(config)
+	if limits["south-plus.net"] != 1 || limits[GofileHost] != 1 || limits["img.example.com"] != 2 || fallback != 2 {
+		t.Fatalf("unexpected polite limits: %v fallback=%d", limits, fallback)
+	}
+}
@@ -0,0 +1,75 @@
+package south2md
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// FormatHTML renders node and its subtree as indented HTML, one element or
+// text run per line, for inspecting page structure. Whitespace-only text is
+// dropped, so the output is not byte-identical to the source.
+func FormatHTML(node *html.Node) string {
+	var b strings.Builder
+	formatHTMLNode(&b, node, 0)
+	return b.String()
+}
+
+func formatHTMLNode(b *strings.Builder, node *html.Node, depth int) {
+	indent := strings.Repeat("  ", depth)
+	switch node.Type {
+	case html.DocumentNode:
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			formatHTMLNode(b, child, depth)
+		}
+	case html.TextNode:
+		if text := strings.Join(strings.Fields(node.Data), " "); text != "" {
+			fmt.Fprintf(b, "%s%s\n", indent, html.EscapeString(text))
+		}
+	case html.CommentNode:
+		fmt.Fprintf(b, "%s<!--%s-->\n", indent, node.Data)
+	case html.ElementNode:
+		b.WriteString(indent)
+		b.WriteString("<")
+		b.WriteString(node.Data)
+		for _, attr := range node.Attr {
+			fmt.Fprintf(b, " %s=%q", attr.Key, attr.Val)
+		}
+		b.WriteString(">\n")
+		if isVoidElement(node.Data) {
+			return
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			formatHTMLNode(b, child, depth+1)
+		}
+		fmt.Fprintf(b, "%s</%s>\n", indent, node.Data)
+	}
+}
+
+func isVoidElement(tag string) bool {
+	switch tag {
+	case "area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "source", "track", "wbr":
+		return true
+	}
+	return false
+}
+
+// DebugSelect runs selector against the loaded document and returns every
+// match formatted with FormatHTML.
+func (p *PostParser) DebugSelect(selector string) ([]string, error) {
+	if p.doc == nil {
+		return nil, NewValidationError("HTML 文档未加载")
+	}
+	compiled, err := compileSelector(selector)
+	if err != nil {
+		return nil, NewValidationError(fmt.Sprintf("无效的选择器 %q: %v", selector, err))
+	}
+
+	var matches []string
+	for _, node := range cascadia.QueryAll(p.doc, compiled) {
+		matches = append(matches, FormatHTML(node))
+	}
+	return matches, nil
+}
@@ -0,0 +1,23 @@
+package south2md
+
+import "testing"
+
+func TestDebugSelectFormatsMatches(t *testing.T) {
+	parser := NewPostParser()
+	if err := parser.LoadFromString(`<div class="a"><p>hello   <b>world</b></p><br><p>x</p></div>`); err != nil {
+		t.Fatalf("LoadFromString returned error: %v", err)
+	}
+
+	matches, err := parser.DebugSelect("div.a p:first-child")
+	if err != nil {
+		t.Fatalf("DebugSelect returned error: %v", err)
+	}
+	want := "<p>\n  hello\n  <b>\n    world\n  </b>\n</p>\n"
+	if len(matches) != 1 || matches[0] != want {
+		t.Fatalf("unexpected matches: %q", matches)
+	}
+
+	if _, err := parser.DebugSelect("p["); err == nil {
+		t.Fatal("expected error for invalid selector")
+	}
+}
@@ -0,0 +1,36 @@
+package south2md
+
+import "net/http"
+
+// HTTPDoer sends HTTP requests. *http.Client satisfies it; tests and proxies
+// can inject their own implementation into every component that talks to
+// the network.
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// doerTransport adapts an HTTPDoer to http.RoundTripper for libraries that
+// only accept a transport (colly).
+type doerTransport struct {
+	doer HTTPDoer
+}
+
+func (t doerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.doer.Do(req)
+}
+
+// transportFor returns the transport requests through doer should use, or
+// nil when doer is a plain *http.Client on the default transport.
+func transportFor(doer HTTPDoer) http.RoundTripper {
+	switch d := doer.(type) {
+	case nil:
+		return nil
+	case *http.Client:
+		if d == nil {
+			return nil
+		}
+		return d.Transport
+	default:
+		return doerTransport{doer: doer}
+	}
+}
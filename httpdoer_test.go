@@ -0,0 +1,73 @@
+package south2md
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// stubDoer answers every request with body and records the requested URLs.
+type stubDoer struct {
+	mu   sync.Mutex
+	body string
+	urls []string
+}
+
+func (d *stubDoer) Do(req *http.Request) (*http.Response, error) {
+	d.mu.Lock()
+	d.urls = append(d.urls, req.URL.String())
+	d.mu.Unlock()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     http.Header{"Content-Type": []string{"text/html"}},
+		Body:       io.NopCloser(strings.NewReader(d.body)),
+		Request:    req,
+	}, nil
+}
+
+func TestFetcherSendsRequestsThroughInjectedDoer(t *testing.T) {
+	doer := &stubDoer{body: "<html><body>stubbed</body></html>"}
+	f := NewFetcher(doer, &HTTPOptions{MaxRetries: 1}, "https://forum.example.com/")
+
+	html, err := f.FetchPost("123")
+	if err != nil {
+		t.Fatalf("FetchPost returned error: %v", err)
+	}
+	if !strings.Contains(html, "stubbed") {
+		t.Fatalf("expected stubbed body, got %q", html)
+	}
+	if len(doer.urls) != 1 || doer.urls[0] != "https://forum.example.com/read.php?tid-123.html" {
+		t.Fatalf("unexpected requests: %v", doer.urls)
+	}
+	if f.HTTPDoer() != doer {
+		t.Fatal("HTTPDoer should return the injected client")
+	}
+}
+
+func TestImageHandlerDownloadsThroughInjectedDoer(t *testing.T) {
+	doer := &stubDoer{body: "image-bytes"}
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "100", "images"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	h := NewImageHandler("images")
+	h.SetRootDir(root)
+	h.SetHTTPDoer(doer)
+
+	post := &Post{}
+	got, err := h.DownloadAndCacheImages("100", []byte("![a](https://img.example.com/a.jpg)"), post)
+	if err != nil {
+		t.Fatalf("DownloadAndCacheImages returned error: %v", err)
+	}
+	if len(doer.urls) != 1 || doer.urls[0] != "https://img.example.com/a.jpg" {
+		t.Fatalf("unexpected requests: %v", doer.urls)
+	}
+	if strings.Contains(string(got), "https://img.example.com/a.jpg") {
+		t.Fatalf("expected image link to be localized, got %q", got)
+	}
+}
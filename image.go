@@ -2,30 +2,58 @@ package south2md
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
 	"runtime"
 	"strings"
 	"sync"
-)
+	"time"
 
-var imageLinkPattern = regexp.MustCompile(`!\[[^\]]*\]\(\s*(<)?([^)\s>]+)(>)?([^)]*)\)`)
+	"go.opentelemetry.io/otel/attribute"
+)
 
 // ImageHandler handles image downloading, caching and processing
 type ImageHandler struct {
 	cacheDir   string
 	rootDir    string
 	download   bool
-	httpClient *http.Client
+	httpClient HTTPDoer
+	metrics    *Metrics
+	traceCtx   context.Context // parent of download spans; nil means none
+	registry   *AssetRegistry
+	pending    *PendingQueue   // receives failed downloads; nil means none
+	retryOnly  map[string]bool // when set, only these URLs are downloaded
+	wayback    bool            // fall back to archive.org snapshots for 404/410 images
+	waybackAPI string          // availability endpoint override for tests; empty means archive.org
+	classifier ImageClassifier // tags newly cached images; nil means none
+	quarantine map[string]bool // classifier tags whose images are quarantined
+
+	attachments       AttachmentFetcher // downloads floor attachments; nil means none
+	attachmentMaxSize int64             // attachments labelled larger are skipped; 0 means no limit
+
+	maxFileSize int64          // images larger than this are skipped; 0 means no limit
+	skipper     *imageSkipper  // images left as remote links; nil means none
+	guard       *DownloadGuard // thread size cap and free space reserve; nil means none
+
+	verifyChecksums bool // compare the SHA-256 of reused cached files, not just their size
+	avatars         bool // download the avatars of a thread's authors
+
+	onDownload ImageDownloadHandler // told about every image written to the cache; nil means none
 }
 
+// ImageDownloadHandler receives each image downloaded for thread tid: its
+// URL, the cached file and the file's size in bytes.
+type ImageDownloadHandler func(tid, url, path string, size int64)
+
 // NewImageHandler creates a new image handler
 func NewImageHandler(cacheDir string) *ImageHandler {
 	return &ImageHandler{
@@ -38,6 +66,32 @@ func NewImageHandler(cacheDir string) *ImageHandler {
 	}
 }
 
+// SetHTTPDoer replaces the client used for image downloads; nil is ignored.
+func (ih *ImageHandler) SetHTTPDoer(doer HTTPDoer) {
+	if ih == nil || doer == nil {
+		return
+	}
+	ih.httpClient = doer
+}
+
+// SetMetrics records image download metrics into metrics; nil disables it.
+func (ih *ImageHandler) SetMetrics(metrics *Metrics) {
+	if ih == nil {
+		return
+	}
+	ih.metrics = metrics
+}
+
+// SetDownloadHandler registers fn to be called after each image is
+// downloaded and cached; images reused from the cache or the asset registry
+// are not reported. fn is called from a single goroutine.
+func (ih *ImageHandler) SetDownloadHandler(fn ImageDownloadHandler) {
+	if ih == nil {
+		return
+	}
+	ih.onDownload = fn
+}
+
 // SetRootDir sets the write root for cached image files.
 func (ih *ImageHandler) SetRootDir(rootDir string) {
 	if ih == nil {
@@ -58,6 +112,42 @@ func (ih *ImageHandler) SetDownloadEnabled(enabled bool) {
 	ih.download = enabled
 }
 
+// SetAssetRegistry makes the handler reuse images already downloaded by other
+// threads in the store instead of fetching them again. The registry is only
+// consulted while the handler writes into the registry's store root.
+func (ih *ImageHandler) SetAssetRegistry(registry *AssetRegistry) {
+	if ih == nil {
+		return
+	}
+	ih.registry = registry
+}
+
+// storeRegistry returns the asset registry when rootDir is its store root or
+// the store's staging root, whose thread dirs are renamed into the store.
+func (ih *ImageHandler) storeRegistry() *AssetRegistry {
+	if ih.registry == nil {
+		return nil
+	}
+	root := filepath.Clean(ih.rootDir)
+	if filepath.Base(root) == StagingDirName {
+		root = filepath.Dir(root)
+	}
+	if root != filepath.Clean(ih.registry.rootDir) {
+		return nil
+	}
+	return ih.registry
+}
+
+// SetDownloadLimits skips images larger than maxFileSize bytes (0 means no
+// limit) and checks every image and attachment written against guard.
+func (ih *ImageHandler) SetDownloadLimits(maxFileSize int64, guard *DownloadGuard) {
+	if ih == nil {
+		return
+	}
+	ih.maxFileSize = maxFileSize
+	ih.guard = guard
+}
+
 // DownloadTask represents an image download task
 type DownloadTask struct {
 	URL string
@@ -65,61 +155,96 @@ type DownloadTask struct {
 
 // DownloadResult represents the result of an image download
 type DownloadResult struct {
-	URL       string
-	ImageData []byte
-	Error     error
+	URL           string
+	ImageData     []byte
+	ContentLength int64  // Content-Length the server announced; -1 when it sent none
+	Source        string // "" for the original URL, ImageSourceWayback for a snapshot
+	Error         error
 }
 
 func (ih *ImageHandler) downloadWorker(tasks <-chan DownloadTask, results chan<- DownloadResult, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for task := range tasks {
-		imageData, err := ih.downloadImage(task.URL)
+		if err := ih.checkImageBytes(task.URL); err != nil {
+			results <- DownloadResult{URL: task.URL, Error: err}
+			continue
+		}
+		imageData, contentLength, err := ih.downloadImage(task.URL)
+		source := ""
+		if err != nil && ih.wayback && isDeadLinkError(err) {
+			archived, archivedLength, waybackErr := ih.downloadFromWayback(task.URL)
+			if waybackErr == nil {
+				imageData, contentLength, err, source = archived, archivedLength, nil, ImageSourceWayback
+			} else {
+				slog.Warn("Wayback fallback failed", "url", task.URL, "error", waybackErr)
+			}
+		}
 		results <- DownloadResult{
-			URL:       task.URL,
-			ImageData: imageData,
-			Error:     err,
+			URL:           task.URL,
+			ImageData:     imageData,
+			ContentLength: contentLength,
+			Source:        source,
+			Error:         err,
 		}
 	}
 }
 
 // DownloadAndCacheImages replaces remote markdown image URLs with cached paths.
 func (ih *ImageHandler) DownloadAndCacheImages(tid string, mdDoc []byte, post *Post) ([]byte, error) {
+	imageURLs := ih.extractRemoteImageURLs(mdDoc)
+	if len(imageURLs) == 0 {
+		return mdDoc, nil
+	}
+	mapping, err := ih.cacheImages(tid, imageURLs, post)
+	if err != nil {
+		return mdDoc, err
+	}
+	return ih.replaceImageURLs(tid, mdDoc, mapping), nil
+}
+
+// cacheImages makes sure the images imageURLs of thread tid are cached,
+// reusing the records in post and the asset registry and downloading the rest
+// concurrently. It returns the cached file of every available image by URL.
+func (ih *ImageHandler) cacheImages(tid string, imageURLs []string, post *Post) (map[string]string, error) {
 	mapping := make(map[string]string)
-	existingImages := make(map[string]string)
+	existingImages := make(map[string]Image)
 	if post != nil {
 		for i := range post.Images {
 			if !post.Images[i].Downloaded || post.Images[i].URL == "" || post.Images[i].Local == "" {
 				continue
 			}
-			existingImages[post.Images[i].URL] = post.Images[i].Local
+			existingImages[post.Images[i].URL] = post.Images[i]
 		}
 	}
 
-	imageURLs := ih.extractRemoteImageURLs(mdDoc)
-	if len(imageURLs) == 0 {
-		return mdDoc, nil
-	}
-
 	pending := make([]string, 0, len(imageURLs))
 	for _, imageURL := range imageURLs {
-		if local, ok := existingImages[imageURL]; ok {
-			mapping[imageURL] = local
-			slog.Info("Reusing cached image", "url", imageURL, "path", local)
+		if img, ok := existingImages[imageURL]; ok && !(ih.download && ih.dropDamagedImage(tid, img, post)) {
+			mapping[imageURL] = img.Local
+			slog.Info("Reusing cached image", "url", imageURL, "path", img.Local)
+			continue
+		}
+		if ih.linkRegisteredImage(tid, imageURL, post, mapping) {
+			continue
+		}
+		if ih.retryOnly != nil && !ih.retryOnly[imageURL] {
 			continue
 		}
 		pending = append(pending, imageURL)
 	}
 
 	if ih.download && len(pending) > 0 {
-		ih.downloadImagesConcurrently(tid, pending, post, mapping)
+		if err := ih.downloadImagesConcurrently(tid, pending, post, mapping); err != nil {
+			return mapping, err
+		}
 	}
-
-	return ih.replaceImageURLs(mdDoc, mapping), nil
+	return mapping, nil
 }
 
-// downloadImagesConcurrently downloads multiple images using a worker pool
-func (ih *ImageHandler) downloadImagesConcurrently(tid string, imageURLs []string, post *Post, mapping map[string]string) {
+// downloadImagesConcurrently downloads multiple images using a worker pool.
+// It stops at the first *DiskSpaceError and returns it.
+func (ih *ImageHandler) downloadImagesConcurrently(tid string, imageURLs []string, post *Post, mapping map[string]string) error {
 	numWorkers := runtime.NumCPU()
 	if numWorkers > 8 {
 		numWorkers = 8 // Cap at 8 workers to avoid overwhelming the server
@@ -151,60 +276,156 @@ func (ih *ImageHandler) downloadImagesConcurrently(tid string, imageURLs []strin
 
 	// Process results
 	for result := range results {
+		if errors.Is(result.Error, ErrSizeLimit) {
+			slog.Warn("Skipping image", "url", result.URL, "error", result.Error)
+			continue
+		}
+		if errors.Is(result.Error, ErrImageSkipped) {
+			slog.Info("Skipping image", "url", result.URL, "reason", result.Error)
+			continue
+		}
 		if result.Error != nil {
 			slog.Error("Failed to download image", "url", result.URL, "error", result.Error)
+			ih.pending.Add(PendingKindImage, result.URL, result.Error)
 			continue
 		}
 
-		ih.processDownloadedImage(tid, result.URL, result.ImageData, post, mapping)
+		if aside, err := ih.setAsideSmallImage(tid, result, mapping); aside || err != nil {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err := ih.processDownloadedImage(tid, result, post, mapping); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-// processDownloadedImage processes a downloaded image and updates the mapping
-func (ih *ImageHandler) processDownloadedImage(tid, rawURL string, imageData []byte, post *Post, mapping map[string]string) {
+// linkRegisteredImage links an image another thread already downloaded into
+// this thread's cache dir. It reports whether the image was reused.
+func (ih *ImageHandler) linkRegisteredImage(tid, rawURL string, post *Post, mapping map[string]string) bool {
+	registry := ih.storeRegistry()
+	rec, ok := registry.Lookup(rawURL)
+	if !ok {
+		return false
+	}
+	filename := filepath.Base(rec.File)
+	filePath := filepath.Join(threadDir(ih.rootDir, tid), ih.cacheDir, filename)
+	if err := registry.Link(rec, filePath); err != nil {
+		slog.Warn("Failed to link registered image, downloading again", "url", rawURL, "error", err)
+		return false
+	}
+
+	slog.Info("Reusing image from store", "url", rawURL, "source", rec.File)
+	sum, err := fileSHA256(filePath)
+	if err != nil {
+		slog.Warn("Failed to hash linked image", "path", filePath, "error", err)
+	}
+	local, tag := ih.classifyImage(tid, filename)
+	mapping[rawURL] = local
+	if post != nil {
+		post.Images = append(post.Images, Image{
+			URL:        rawURL,
+			Local:      local,
+			Downloaded: true,
+			FileSize:   rec.Size,
+			Tag:        tag,
+			SHA256:     sum,
+		})
+	}
+	return true
+}
+
+// processDownloadedImage processes a downloaded image and updates the
+// mapping. Only a *DiskSpaceError is returned.
+func (ih *ImageHandler) processDownloadedImage(tid string, result DownloadResult, post *Post, mapping map[string]string) error {
+	rawURL, imageData := result.URL, result.ImageData
 	hash := md5.Sum(imageData)
-	filename := fmt.Sprintf("%x%s", hash, filepath.Ext(rawURL))
-	filePath := filepath.Join(ih.rootDir, tid, ih.cacheDir, filename)
+	filename := SanitizePathComponent(fmt.Sprintf("%x%s", hash, imageFileExt(rawURL)))
+	filePath := filepath.Join(threadDir(ih.rootDir, tid), ih.cacheDir, filename)
 
-	// Check if file already exists
-	if _, err := os.Stat(filePath); err == nil {
-		slog.Info("Image file already exists, skipping write", "path", filePath)
-	} else {
-		if err := os.WriteFile(filePath, imageData, 0644); err != nil {
-			slog.Error("Failed to save image to cache", "path", filePath, "error", err)
-			return
+	if err := ih.writeCacheFile(tid, rawURL, filePath, imageData); err != nil {
+		var diskErr *DiskSpaceError
+		if errors.As(err, &diskErr) {
+			return err
 		}
+		return nil
 	}
 
 	slog.Info("Cached image successfully", "original_url", rawURL, "cached_path", filePath)
-	mapping[rawURL] = filename
+	if ih.onDownload != nil {
+		ih.onDownload(tid, rawURL, filePath, int64(len(imageData)))
+	}
+	local, tag := ih.classifyImage(tid, filename)
+	mapping[rawURL] = local
+	ih.storeRegistry().Record(AssetRecord{
+		URL:       rawURL,
+		Digest:    fmt.Sprintf("%x", hash),
+		File:      filepath.ToSlash(filepath.Join(tid, ih.cacheDir, filepath.FromSlash(local))),
+		Size:      int64(len(imageData)),
+		FetchedAt: time.Now(),
+	})
 
 	if post != nil {
 		image := Image{
 			URL:        rawURL,
-			Local:      filename,
+			Local:      local,
 			Alt:        "",
 			Downloaded: true,
 			FileSize:   int64(len(imageData)),
+			Source:     result.Source,
+			Tag:        tag,
+			SHA256:     sha256Hex(imageData),
+		}
+		if result.ContentLength >= 0 {
+			image.ContentLength = result.ContentLength
 		}
 		post.Images = append(post.Images, image)
 	}
+	return nil
 }
 
-func (ih *ImageHandler) extractRemoteImageURLs(mdDoc []byte) []string {
-	matches := imageLinkPattern.FindAllSubmatchIndex(mdDoc, -1)
-	if len(matches) == 0 {
+// writeCacheFile writes data downloaded from rawURL to filePath in the cache
+// dir of thread tid unless the file already exists. Failures are logged;
+// write errors and a *DiskSpaceError also queue rawURL for retry.
+func (ih *ImageHandler) writeCacheFile(tid, rawURL, filePath string, data []byte) error {
+	if _, err := os.Stat(filePath); err == nil {
+		slog.Info("Cached file already exists, skipping write", "path", filePath)
 		return nil
 	}
 
-	seen := make(map[string]struct{}, len(matches))
-	urls := make([]string, 0, len(matches))
-	for _, match := range matches {
-		if len(match) < 6 || match[4] < 0 || match[5] < 0 {
-			continue
+	dir := threadDir(ih.rootDir, tid)
+	if err := ih.guard.Reserve(dir, int64(len(data))); err != nil {
+		if errors.Is(err, ErrSizeLimit) {
+			slog.Warn("Skipping download", "url", rawURL, "error", err)
+		} else {
+			slog.Error("Refusing to write download", "url", rawURL, "error", err)
+			ih.pending.Add(PendingKindImage, rawURL, err)
 		}
-		imageURL := string(mdDoc[match[4]:match[5]])
-		if !ih.isRemoteURL(imageURL) {
+		return err
+	}
+	if err := writeFileAtomic(filePath, data); err != nil {
+		ih.guard.Release(dir, int64(len(data)))
+		slog.Error("Failed to save file to cache", "path", filePath, "error", err)
+		ih.pending.Add(PendingKindImage, rawURL, err)
+		return err
+	}
+	return nil
+}
+
+func (ih *ImageHandler) extractRemoteImageURLs(mdDoc []byte) []string {
+	links := findImageLinks(mdDoc)
+	if len(links) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]struct{}, len(links))
+	urls := make([]string, 0, len(links))
+	for _, link := range links {
+		imageURL := link.Dest
+		if !ih.isRemoteURL(imageURL) || ih.skipper.skips(link) {
 			continue
 		}
 		if _, ok := seen[imageURL]; ok {
@@ -217,29 +438,30 @@ func (ih *ImageHandler) extractRemoteImageURLs(mdDoc []byte) []string {
 	return urls
 }
 
-func (ih *ImageHandler) replaceImageURLs(mdDoc []byte, mapping map[string]string) []byte {
+// replaceImageURLs points the image links of mdDoc at their cached files.
+// Quarantined images of tid become a link to the file wrapping its blurred
+// thumbnail, or a plain link when no thumbnail could be made.
+func (ih *ImageHandler) replaceImageURLs(tid string, mdDoc []byte, mapping map[string]string) []byte {
 	if len(mapping) == 0 {
 		return mdDoc
 	}
 
-	matches := imageLinkPattern.FindAllSubmatchIndex(mdDoc, -1)
-	if len(matches) == 0 {
+	links := findImageLinks(mdDoc)
+	if len(links) == 0 {
 		return mdDoc
 	}
 
 	var out bytes.Buffer
-	out.Grow(len(mdDoc) + len(matches)*8)
+	out.Grow(len(mdDoc) + len(links)*8)
 
+	// Only the destination is replaced; the alt text, title and anything
+	// else in the link are kept as written.
 	last := 0
-	for _, match := range matches {
-		if len(match) < 6 || match[4] < 0 || match[5] < 0 {
-			continue
-		}
-
-		start := match[0]
-		end := match[1]
-		urlStart := match[4]
-		urlEnd := match[5]
+	for _, link := range links {
+		start := link.Start
+		end := link.End
+		urlStart := link.DestStart
+		urlEnd := link.DestEnd
 
 		if start < last {
 			continue
@@ -255,10 +477,15 @@ func (ih *ImageHandler) replaceImageURLs(mdDoc []byte, mapping map[string]string
 		}
 
 		newPath := strings.ReplaceAll(filepath.Join(ih.cacheDir, cachedFile), "\\", "/")
+		last = end
+		if isQuarantined(cachedFile) {
+			ih.writeQuarantinedLink(&out, tid, mdDoc[start:urlStart], mdDoc[urlEnd:end], newPath)
+			slog.Info("Updated quarantined image path", "original_url", originalURL, "new_path", newPath)
+			continue
+		}
 		out.Write(mdDoc[start:urlStart])
 		out.WriteString(newPath)
 		out.Write(mdDoc[urlEnd:end])
-		last = end
 
 		slog.Info("Updated image path", "original_url", originalURL, "new_path", newPath)
 	}
@@ -267,23 +494,69 @@ func (ih *ImageHandler) replaceImageURLs(mdDoc []byte, mapping map[string]string
 	return out.Bytes()
 }
 
-// downloadImage fetches image data from a URL.
-func (ih *ImageHandler) downloadImage(imageURL string) ([]byte, error) {
-	resp, err := ih.httpClient.Get(imageURL)
+// downloadImage fetches image data from a URL along with the Content-Length
+// the server announced, or -1 when it sent none or announced 0. Bodies shorter than the
+// announced length fail as incomplete.
+func (ih *ImageHandler) downloadImage(imageURL string) (data []byte, contentLength int64, err error) {
+	start := time.Now()
+	ctx, span := startSpan(ih.traceCtx, "south2md.download_image", attribute.String("url.full", imageURL))
+	defer func() {
+		ih.metrics.recordRequest(MetricsComponentImage, start, int64(len(data)), err)
+		span.SetAttributes(attribute.Int("http.response.body.size", len(data)))
+		endSpan(span, err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := ih.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make HTTP request: %w", err)
+		return nil, -1, fmt.Errorf("failed to make HTTP request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("bad status code: %s", resp.Status)
+		return nil, -1, &httpStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	if ih.maxFileSize > 0 && resp.ContentLength > ih.maxFileSize {
+		return nil, -1, sizeLimitError("image", ih.maxFileSize)
+	}
+
+	body := io.Reader(resp.Body)
+	if ih.maxFileSize > 0 {
+		// One byte over the limit tells an oversized body from one that fits.
+		body = io.LimitReader(resp.Body, ih.maxFileSize+1)
 	}
+	imageData, err := io.ReadAll(body)
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if ih.maxFileSize > 0 && int64(len(imageData)) > ih.maxFileSize {
+		return nil, -1, sizeLimitError("image", ih.maxFileSize)
+	}
+	// Some HTTPDoers leave ContentLength at 0 instead of -1 when unknown.
+	if resp.ContentLength <= 0 {
+		return imageData, -1, nil
+	}
+	if int64(len(imageData)) != resp.ContentLength {
+		return nil, -1, fmt.Errorf("download incomplete: got %d of %d bytes", len(imageData), resp.ContentLength)
+	}
+	return imageData, resp.ContentLength, nil
+}
 
-	imageData, err := io.ReadAll(resp.Body)
+// imageFileExt returns the extension of the path of rawURL, ignoring its
+// query and fragment.
+func imageFileExt(rawURL string) string {
+	u, err := url.Parse(rawURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return ""
+	}
+	ext := path.Ext(u.Path)
+	if len(ext) > maxExtBytes {
+		return ""
 	}
-	return imageData, nil
+	return ext
 }
 
 // isRemoteURL checks if a URL is an absolute remote URL.
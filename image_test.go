@@ -1,6 +1,9 @@
 package south2md
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -78,3 +81,39 @@ func TestDownloadAndCacheImagesDoesNotLeakMappingAcrossCalls(t *testing.T) {
 		t.Fatalf("unexpected cross-call mapping leak: %q", secondText)
 	}
 }
+
+func TestRenderEntriesDownloadsImagesOfAllFloorsOnce(t *testing.T) {
+	doer := &flakyImageDoer{}
+	g := NewMarkdownGenerator(&MarkdownOptions{IncludeImages: true}, nil)
+	g.SetHTTPDoer(doer)
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "100", "images"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	g.imageHandler.SetRootDir(root)
+
+	post := &Post{TID: "100", MainPost: PostEntry{Floor: "GF", HTMLContent: `<p>main <img src="https://img.example.com/shared.jpg"></p>`}}
+	for i := 1; i <= 40; i++ {
+		post.Replies = append(post.Replies, PostEntry{
+			Floor:       fmt.Sprintf("B%dF", i),
+			HTMLContent: fmt.Sprintf(`<p>reply %d <img src="https://img.example.com/%d.jpg"><img src="https://img.example.com/shared.jpg"></p>`, i, i),
+		})
+	}
+
+	entries, err := g.renderEntries(post)
+	if err != nil {
+		t.Fatalf("renderEntries returned error: %v", err)
+	}
+	if len(doer.urls) != 41 {
+		t.Fatalf("expected each image to be downloaded once, got %d requests", len(doer.urls))
+	}
+	for i, e := range entries {
+		want := "main "
+		if i > 0 {
+			want = fmt.Sprintf("reply %d ", i)
+		}
+		if !strings.HasPrefix(e.Content, want) || strings.Contains(e.Content, "https://") {
+			t.Fatalf("floor %d: expected localized content starting with %q, got %q", i, want, e.Content)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package south2md
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"  // register GIF decoding for thumbnails
+	_ "image/jpeg" // register JPEG decoding for thumbnails
+	"image/png"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// QuarantineDirName is the subdirectory of the image cache dir that holds
+// images whose classifier tag is quarantined.
+const QuarantineDirName = "quarantine"
+
+const (
+	// classifierTimeout bounds a single classifier command run.
+	classifierTimeout = 30 * time.Second
+	// blurThumbnailSize is the longest edge of a quarantine thumbnail.
+	blurThumbnailSize = 160
+	// blurRadius is the box blur radius applied to the thumbnail, in pixels.
+	blurRadius = 6
+)
+
+// ImageClassifier tags the downloaded image at path, e.g. "nsfw" or "safe".
+// An empty tag leaves the image unclassified.
+type ImageClassifier func(ctx context.Context, path string) (string, error)
+
+// CommandImageClassifier returns a classifier that runs command with the
+// image path appended as its last argument and uses the first word printed on
+// stdout, lowercased, as the tag. The command is split on whitespace and not
+// run through a shell.
+func CommandImageClassifier(command string) ImageClassifier {
+	args := strings.Fields(command)
+	return func(ctx context.Context, path string) (string, error) {
+		if len(args) == 0 {
+			return "", fmt.Errorf("empty classifier command")
+		}
+		ctx, cancel := context.WithTimeout(ctx, classifierTimeout)
+		defer cancel()
+
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, args[0], append(args[1:], path)...)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("classifier %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		fields := strings.Fields(string(out))
+		if len(fields) == 0 {
+			return "", nil
+		}
+		return strings.ToLower(fields[0]), nil
+	}
+}
+
+// SetImageClassifier runs classifier on every newly cached image and records
+// its tag. Images tagged with one of quarantineTags are moved to the
+// quarantine dir and shown as a blurred thumbnail. A nil classifier disables
+// classification.
+func (ih *ImageHandler) SetImageClassifier(classifier ImageClassifier, quarantineTags []string) {
+	if ih == nil {
+		return
+	}
+	ih.classifier = classifier
+	ih.quarantine = make(map[string]bool, len(quarantineTags))
+	for _, tag := range quarantineTags {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			ih.quarantine[tag] = true
+		}
+	}
+}
+
+// classifyImage tags the cached image filename of tid and quarantines it when
+// its tag asks for it. It returns the image path relative to the cache dir,
+// which changes when the file was moved. Classifier failures only leave the
+// image untagged.
+func (ih *ImageHandler) classifyImage(tid, filename string) (local, tag string) {
+	if ih.classifier == nil {
+		return filename, ""
+	}
+	cacheDir := filepath.Join(threadDir(ih.rootDir, tid), ih.cacheDir)
+	src := filepath.Join(cacheDir, filename)
+	ctx := ih.traceCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	tag, err := ih.classifier(ctx, src)
+	if err != nil {
+		slog.Warn("Failed to classify image", "path", src, "error", err)
+		return filename, ""
+	}
+	if !ih.quarantine[tag] {
+		return filename, tag
+	}
+
+	dir := filepath.Join(cacheDir, QuarantineDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		slog.Warn("Failed to create quarantine dir", "path", dir, "error", err)
+		return filename, tag
+	}
+	dst := filepath.Join(dir, filename)
+	if err := os.Rename(src, dst); err != nil {
+		slog.Warn("Failed to quarantine image", "path", src, "error", err)
+		return filename, tag
+	}
+	if err := writeBlurredThumbnail(dst, filepath.Join(dir, blurredThumbnailName(filename))); err != nil {
+		slog.Warn("Failed to create blurred thumbnail", "path", dst, "error", err)
+	}
+	slog.Info("Quarantined image", "path", dst, "tag", tag)
+	return path.Join(QuarantineDirName, filename), tag
+}
+
+// isQuarantined reports whether the cache-relative image path local lies in
+// the quarantine dir.
+func isQuarantined(local string) bool {
+	return strings.HasPrefix(local, QuarantineDirName+"/")
+}
+
+// writeQuarantinedLink writes the quarantined image at newPath, relative to
+// the thread dir of tid, as a link wrapping its blurred thumbnail. head and
+// tail are the parts of the original image link before and after its URL.
+// Without a thumbnail the image is only linked, never embedded.
+func (ih *ImageHandler) writeQuarantinedLink(out *bytes.Buffer, tid string, head, tail []byte, newPath string) {
+	thumbPath := path.Join(path.Dir(newPath), blurredThumbnailName(path.Base(newPath)))
+	if _, err := os.Stat(filepath.Join(threadDir(ih.rootDir, tid), filepath.FromSlash(thumbPath))); err == nil {
+		out.WriteByte('[')
+		out.Write(head)
+		out.WriteString(thumbPath)
+		out.Write(tail)
+		out.WriteString("](" + newPath + ")")
+		return
+	}
+	label := []byte("[quarantined image]")
+	if end := bytes.Index(head, []byte("](")); end > 2 {
+		label = head[1 : end+1]
+	}
+	out.Write(label)
+	out.WriteString("(" + newPath + ")")
+}
+
+// blurredThumbnailName returns the thumbnail file name of a quarantined image.
+func blurredThumbnailName(filename string) string {
+	return strings.TrimSuffix(filename, filepath.Ext(filename)) + ".blur.png"
+}
+
+// writeBlurredThumbnail decodes the image at src and writes a small, heavily
+// blurred PNG preview of it to dst.
+func writeBlurredThumbnail(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+	thumb := downscaleImage(img, blurThumbnailSize)
+	if thumb == nil {
+		return fmt.Errorf("empty image")
+	}
+	// Two box blur passes approximate a gaussian blur.
+	thumb = boxBlur(boxBlur(thumb, blurRadius), blurRadius)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, thumb); err != nil {
+		return fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return writeFileAtomic(dst, buf.Bytes())
+}
+
+// downscaleImage shrinks img so its longest edge is at most size, averaging
+// the source pixels covered by each output pixel. It returns nil for an empty
+// image.
+func downscaleImage(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= 0 || h <= 0 {
+		return nil
+	}
+	tw, th := w, h
+	if w >= h && w > size {
+		tw, th = size, max(1, h*size/w)
+	} else if h > w && h > size {
+		tw, th = max(1, w*size/h), size
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0 := b.Min.Y + y*h/th
+		y1 := max(y0+1, b.Min.Y+(y+1)*h/th)
+		for x := 0; x < tw; x++ {
+			x0 := b.Min.X + x*w/tw
+			x1 := max(x0+1, b.Min.X+(x+1)*w/tw)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			out.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+	return out
+}
+
+// boxBlur returns img blurred with a box of the given radius, clamping the box
+// at the image edges.
+func boxBlur(img *image.RGBA, radius int) *image.RGBA {
+	b := img.Bounds()
+	horizontal := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			horizontal.SetRGBA(x, y, averageRGBA(img, max(b.Min.X, x-radius), min(b.Max.X, x+radius+1), y, y+1))
+		}
+	}
+	out := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			out.SetRGBA(x, y, averageRGBA(horizontal, x, x+1, max(b.Min.Y, y-radius), min(b.Max.Y, y+radius+1)))
+		}
+	}
+	return out
+}
+
+// averageRGBA averages the pixels of img in [x0,x1)x[y0,y1).
+func averageRGBA(img *image.RGBA, x0, x1, y0, y1 int) color.RGBA {
+	var r, g, b, a, n int
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			c := img.RGBAAt(x, y)
+			r, g, b, a = r+int(c.R), g+int(c.G), b+int(c.B), a+int(c.A)
+			n++
+		}
+	}
+	return color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)}
+}
@@ -0,0 +1,123 @@
+package south2md
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testPNG(t *testing.T, fill color.Color) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			img.Set(x, y, fill)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDownloadAndCacheImagesQuarantinesTaggedImages(t *testing.T) {
+	red := testPNG(t, color.RGBA{R: 255, A: 255})
+	blue := testPNG(t, color.RGBA{B: 255, A: 255})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nsfw.png":
+			_, _ = w.Write(red)
+		case "/safe.png":
+			_, _ = w.Write(blue)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "100", "images"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	h := NewImageHandler("images")
+	h.SetRootDir(root)
+	h.SetImageClassifier(func(_ context.Context, path string) (string, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		if bytes.Equal(data, red) {
+			return "nsfw", nil
+		}
+		return "safe", nil
+	}, []string{"NSFW"})
+
+	post := &Post{}
+	markdown := "![x](" + server.URL + "/nsfw.png)\n![](" + server.URL + "/safe.png)"
+	got, err := h.DownloadAndCacheImages("100", []byte(markdown), post)
+	if err != nil {
+		t.Fatalf("DownloadAndCacheImages returned error: %v", err)
+	}
+
+	tags := map[string]Image{}
+	for _, img := range post.Images {
+		tags[img.Tag] = img
+	}
+	flagged, safe := tags["nsfw"], tags["safe"]
+	if !strings.HasPrefix(flagged.Local, "quarantine/") || strings.Contains(safe.Local, "/") {
+		t.Fatalf("unexpected image records: %+v", post.Images)
+	}
+	if _, err := os.Stat(filepath.Join(root, "100", "images", flagged.Local)); err != nil {
+		t.Fatalf("expected quarantined file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "100", "images", filepath.Base(flagged.Local))); !os.IsNotExist(err) {
+		t.Fatalf("expected the flagged image to leave images/, got %v", err)
+	}
+
+	thumbRel := "images/quarantine/" + blurredThumbnailName(filepath.Base(flagged.Local))
+	f, err := os.Open(filepath.Join(root, "100", filepath.FromSlash(thumbRel)))
+	if err != nil {
+		t.Fatalf("expected blurred thumbnail: %v", err)
+	}
+	defer f.Close()
+	thumb, err := png.Decode(f)
+	if err != nil || thumb.Bounds().Dx() != blurThumbnailSize || thumb.Bounds().Dy() != blurThumbnailSize/2 {
+		t.Fatalf("unexpected thumbnail: %v, %v", thumb.Bounds(), err)
+	}
+
+	want := "[![x](" + thumbRel + ")](images/" + flagged.Local + ")\n![](images/" + safe.Local + ")"
+	if string(got) != want {
+		t.Fatalf("unexpected markdown:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestReplaceImageURLsLinksQuarantinedImageWithoutThumbnail(t *testing.T) {
+	h := NewImageHandler("images")
+	h.SetRootDir(t.TempDir())
+	got := h.replaceImageURLs("100", []byte("![](https://img.example.com/a.webp)"), map[string]string{
+		"https://img.example.com/a.webp": "quarantine/abc.webp",
+	})
+	if want := "[quarantined image](images/quarantine/abc.webp)"; string(got) != want {
+		t.Fatalf("replaceImageURLs = %q, want %q", got, want)
+	}
+}
+
+func TestCommandImageClassifierUsesFirstWord(t *testing.T) {
+	if _, err := exec.LookPath("echo"); err != nil {
+		t.Skip("echo not available")
+	}
+	tag, err := CommandImageClassifier("echo NSFW")(context.Background(), "/tmp/a.jpg")
+	if err != nil || tag != "nsfw" {
+		t.Fatalf("classifier = %q, %v", tag, err)
+	}
+}
@@ -0,0 +1,222 @@
+package south2md
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"image"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrImageSkipped marks an image left out by the ImageSkipRules.
+var ErrImageSkipped = errors.New("image skipped by skip rules")
+
+// ImageSkipRules decide which remote images are left as links in post.md
+// instead of being downloaded, e.g. smileys, rank badges and trackers. Keep
+// overrides all other rules.
+type ImageSkipRules struct {
+	Skip      []string // regexes of image URLs not to download
+	Keep      []string // regexes of image URLs always downloaded
+	MinWidth  int      // images the forum HTML sizes narrower are skipped; 0 means no limit
+	MinHeight int      // images the forum HTML sizes lower are skipped; 0 means no limit
+	MinBytes  int64    // images whose HEAD Content-Length is smaller are skipped; 0 sends no HEAD
+
+	// MinPixels is a "WxH" threshold checked against the decoded header of
+	// each downloaded image; images narrower or lower are dropped. Empty
+	// means no check.
+	MinPixels string
+	// SmallDir stores the images below MinPixels in this subdirectory of the
+	// image cache dir instead of dropping them. They are still linked from
+	// post.md but left out of the post's image list.
+	SmallDir string
+}
+
+// imageSkipper is the compiled form of ImageSkipRules.
+type imageSkipper struct {
+	skip, keep          []*regexp.Regexp
+	minWidth, minHeight int
+	minBytes            int64
+
+	minPixelWidth, minPixelHeight int
+	smallDir                      string
+}
+
+// Validate reports the first invalid rule.
+func (r ImageSkipRules) Validate() error {
+	_, err := r.compile()
+	return err
+}
+
+func (r ImageSkipRules) compile() (*imageSkipper, error) {
+	if r.MinWidth < 0 || r.MinHeight < 0 || r.MinBytes < 0 {
+		return nil, fmt.Errorf("image_min_width/image_min_height/image_min_bytes 不能为负数")
+	}
+	s := &imageSkipper{minWidth: r.MinWidth, minHeight: r.MinHeight, minBytes: r.MinBytes}
+	if r.MinPixels != "" {
+		w, h, ok := parsePixelSize(r.MinPixels)
+		if !ok {
+			return nil, fmt.Errorf("image_min_pixels %q 无效，应为 宽x高，例如 64x64", r.MinPixels)
+		}
+		s.minPixelWidth, s.minPixelHeight = w, h
+	}
+	if r.SmallDir != "" {
+		if r.SmallDir != SanitizePathComponent(r.SmallDir) || r.SmallDir == ".." || r.SmallDir == QuarantineDirName {
+			return nil, fmt.Errorf("image_small_dir %q 必须是普通的目录名", r.SmallDir)
+		}
+		s.smallDir = r.SmallDir
+	}
+	for _, list := range []struct {
+		key      string
+		patterns []string
+		into     *[]*regexp.Regexp
+	}{
+		{"image_skip", r.Skip, &s.skip},
+		{"image_keep", r.Keep, &s.keep},
+	} {
+		for _, pattern := range list.patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s 中的正则 %q 无效: %v", list.key, pattern, err)
+			}
+			*list.into = append(*list.into, re)
+		}
+	}
+	if len(s.skip) == 0 && len(s.keep) == 0 && s.minWidth == 0 && s.minHeight == 0 && s.minBytes == 0 &&
+		s.minPixelWidth == 0 && s.minPixelHeight == 0 {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// SetImageSkipRules makes the handler leave the images matching rules as
+// remote links instead of downloading them.
+func (ih *ImageHandler) SetImageSkipRules(rules ImageSkipRules) error {
+	if ih == nil {
+		return nil
+	}
+	skipper, err := rules.compile()
+	if err != nil {
+		return err
+	}
+	ih.skipper = skipper
+	return nil
+}
+
+func (s *imageSkipper) kept(rawURL string) bool {
+	for _, re := range s.keep {
+		if re.MatchString(rawURL) {
+			return true
+		}
+	}
+	return false
+}
+
+// skips reports whether the image link is skipped by its URL or by the size
+// hint its alt text carries from the forum HTML.
+func (s *imageSkipper) skips(link imageLink) bool {
+	if s == nil || s.kept(link.Dest) {
+		return false
+	}
+	for _, re := range s.skip {
+		if re.MatchString(link.Dest) {
+			return true
+		}
+	}
+	_, width, height := splitSizeHint(link.Alt)
+	if w, err := strconv.Atoi(width); err == nil && w < s.minWidth {
+		return true
+	}
+	if h, err := strconv.Atoi(height); err == nil && h < s.minHeight {
+		return true
+	}
+	return false
+}
+
+// checkImageBytes asks the server for the size of imageURL with a HEAD
+// request and returns an ErrImageSkipped error when it is below the minimum.
+// Servers that don't answer HEAD or send no length let the image through.
+func (ih *ImageHandler) checkImageBytes(imageURL string) error {
+	if ih.skipper == nil || ih.skipper.minBytes == 0 || ih.skipper.kept(imageURL) {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodHead, imageURL, nil)
+	if err != nil {
+		return nil
+	}
+	resp, err := ih.httpClient.Do(req)
+	if err != nil {
+		return nil
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK && resp.ContentLength > 0 && resp.ContentLength < ih.skipper.minBytes {
+		return fmt.Errorf("%w: %d bytes, below image_min_bytes %d", ErrImageSkipped, resp.ContentLength, ih.skipper.minBytes)
+	}
+	return nil
+}
+
+// parsePixelSize parses a "WxH" size such as "64x64". Either edge may be 0.
+func parsePixelSize(value string) (width, height int, ok bool) {
+	w, h, found := strings.Cut(strings.ToLower(strings.TrimSpace(value)), "x")
+	if !found {
+		return 0, 0, false
+	}
+	width, errW := strconv.Atoi(strings.TrimSpace(w))
+	height, errH := strconv.Atoi(strings.TrimSpace(h))
+	if errW != nil || errH != nil || width < 0 || height < 0 {
+		return 0, 0, false
+	}
+	return width, height, true
+}
+
+// undersized reports the decoded size of the downloaded image data and
+// whether it is below the pixel minimum. Formats the standard library can't
+// decode, such as WebP, let the image through.
+func (s *imageSkipper) undersized(rawURL string, data []byte) (width, height int, small bool) {
+	if s == nil || (s.minPixelWidth == 0 && s.minPixelHeight == 0) || s.kept(rawURL) {
+		return 0, 0, false
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, false
+	}
+	return cfg.Width, cfg.Height, cfg.Width < s.minPixelWidth || cfg.Height < s.minPixelHeight
+}
+
+// setAsideSmallImage drops the downloaded image of result, or stores it in
+// the small image dir, when its pixel size is below the minimum. It reports
+// whether the image was set aside; only a *DiskSpaceError is returned.
+func (ih *ImageHandler) setAsideSmallImage(tid string, result DownloadResult, mapping map[string]string) (bool, error) {
+	width, height, small := ih.skipper.undersized(result.URL, result.ImageData)
+	if !small {
+		return false, nil
+	}
+	if ih.skipper.smallDir == "" {
+		slog.Info("Skipping image", "url", result.URL, "reason", fmt.Sprintf("%dx%d below image_min_pixels", width, height))
+		return true, nil
+	}
+
+	dir := filepath.Join(threadDir(ih.rootDir, tid), ih.cacheDir, ih.skipper.smallDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		slog.Warn("Failed to create small image dir", "path", dir, "error", err)
+		return true, nil
+	}
+	filename := SanitizePathComponent(fmt.Sprintf("%x%s", md5.Sum(result.ImageData), imageFileExt(result.URL)))
+	if err := ih.writeCacheFile(tid, result.URL, filepath.Join(dir, filename), result.ImageData); err != nil {
+		var diskErr *DiskSpaceError
+		if errors.As(err, &diskErr) {
+			return true, err
+		}
+		return true, nil
+	}
+	slog.Info("Stored small image", "url", result.URL, "path", filepath.Join(dir, filename), "size", fmt.Sprintf("%dx%d", width, height))
+	mapping[result.URL] = path.Join(ih.skipper.smallDir, filename)
+	return true, nil
+}
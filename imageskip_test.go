@@ -0,0 +1,158 @@
+package south2md
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestImageHandlerAppliesSkipRules(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string][]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path] = append(requests[r.URL.Path], r.Method)
+		mu.Unlock()
+		body := strings.Repeat("x", 200)
+		if r.URL.Path == "/tiny.gif" {
+			body = "x"
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "100", "images"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	h := NewImageHandler("images")
+	h.SetRootDir(root)
+	h.SetHTTPDoer(srv.Client())
+	if err := h.SetImageSkipRules(ImageSkipRules{
+		Skip:     []string{`/smile/`},
+		Keep:     []string{`/smile/keep\.gif$`},
+		MinWidth: 32,
+		MinBytes: 100,
+	}); err != nil {
+		t.Fatalf("SetImageSkipRules returned error: %v", err)
+	}
+
+	md := strings.Join([]string{
+		"![](" + srv.URL + "/smile/face.gif)",
+		"![](" + srv.URL + "/smile/keep.gif)",
+		"![rank|16x16](" + srv.URL + "/badge.png)",
+		"![](" + srv.URL + "/tiny.gif)",
+		"![photo|800x600](" + srv.URL + "/photo.jpg)",
+	}, "\n")
+	post := &Post{}
+	got, err := h.DownloadAndCacheImages("100", []byte(md), post)
+	if err != nil {
+		t.Fatalf("DownloadAndCacheImages returned error: %v", err)
+	}
+
+	for _, remote := range []string{"/smile/face.gif", "/badge.png", "/tiny.gif"} {
+		if !strings.Contains(string(got), srv.URL+remote) {
+			t.Fatalf("expected %s to stay a remote link, got:\n%s", remote, got)
+		}
+	}
+	if len(post.Images) != 2 || strings.Count(string(got), "](images/") != 2 {
+		t.Fatalf("expected the kept smiley and the photo to be cached, got %+v:\n%s", post.Images, got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests["/smile/face.gif"]) != 0 || len(requests["/badge.png"]) != 0 {
+		t.Fatalf("expected no request for images skipped by URL or size hint, got %v", requests)
+	}
+	if strings.Join(requests["/tiny.gif"], ",") != "HEAD" || strings.Join(requests["/photo.jpg"], ",") != "HEAD,GET" {
+		t.Fatalf("expected a HEAD request before each download, got %v", requests)
+	}
+	if strings.Join(requests["/smile/keep.gif"], ",") != "GET" {
+		t.Fatalf("expected kept images to bypass the HEAD check, got %v", requests)
+	}
+}
+
+func TestImageSkipRulesValidate(t *testing.T) {
+	if err := (ImageSkipRules{Skip: []string{"[a-"}}).Validate(); err == nil {
+		t.Fatal("expected an invalid image_skip regex to be rejected")
+	}
+	if err := (ImageSkipRules{MinBytes: -1}).Validate(); err == nil {
+		t.Fatal("expected a negative image_min_bytes to be rejected")
+	}
+	if err := (ImageSkipRules{MinPixels: "64"}).Validate(); err == nil {
+		t.Fatal("expected an image_min_pixels without height to be rejected")
+	}
+	if err := (ImageSkipRules{MinPixels: "64x64", SmallDir: "a/b"}).Validate(); err == nil {
+		t.Fatal("expected a nested image_small_dir to be rejected")
+	}
+}
+
+func TestImageHandlerSetsAsideSmallImages(t *testing.T) {
+	pngOf := func(width, height int) []byte {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+			t.Fatalf("encode png: %v", err)
+		}
+		return buf.Bytes()
+	}
+	bodies := map[string][]byte{
+		"/pixel.png":    pngOf(1, 1),
+		"/badge.png":    pngOf(80, 20),
+		"/photo.png":    pngOf(640, 480),
+		"/notimage.png": []byte("not an image"),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bodies[r.URL.Path])
+	}))
+	defer srv.Close()
+
+	md := strings.Join([]string{
+		"![](" + srv.URL + "/pixel.png)",
+		"![](" + srv.URL + "/badge.png)",
+		"![](" + srv.URL + "/photo.png)",
+		"![](" + srv.URL + "/notimage.png)",
+	}, "\n")
+
+	for _, smallDir := range []string{"", "small"} {
+		root := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(root, "100", "images"), 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		h := NewImageHandler("images")
+		h.SetRootDir(root)
+		h.SetHTTPDoer(srv.Client())
+		if err := h.SetImageSkipRules(ImageSkipRules{MinPixels: "64x64", SmallDir: smallDir}); err != nil {
+			t.Fatalf("SetImageSkipRules returned error: %v", err)
+		}
+
+		post := &Post{}
+		got, err := h.DownloadAndCacheImages("100", []byte(md), post)
+		if err != nil {
+			t.Fatalf("DownloadAndCacheImages returned error: %v", err)
+		}
+		if len(post.Images) != 2 {
+			t.Fatalf("expected only the photo and the undecodable image in the post, got %+v", post.Images)
+		}
+		for _, small := range []string{"/pixel.png", "/badge.png"} {
+			remote := strings.Contains(string(got), srv.URL+small)
+			if smallDir == "" && !remote {
+				t.Fatalf("expected %s to stay a remote link, got:\n%s", small, got)
+			}
+			if smallDir != "" && remote {
+				t.Fatalf("expected %s to be stored locally, got:\n%s", small, got)
+			}
+		}
+		stored, _ := filepath.Glob(filepath.Join(root, "100", "images", "small", "*.png"))
+		if smallDir == "" && len(stored) != 0 || smallDir != "" && (len(stored) != 2 || strings.Count(string(got), "](images/small/") != 2) {
+			t.Fatalf("unexpected small images %v with small dir %q:\n%s", stored, smallDir, got)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package south2md
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Image link styles selectable with MarkdownOptions.ImageStyle.
+const (
+	ImageStyleInline    = "inline"    // ![alt](images/a.jpg)
+	ImageStyleReference = "reference" // ![alt][img-1], definitions at the bottom
+	ImageStyleFigure    = "figure"    // <figure> with the alt text as caption
+)
+
+// ImageStyles lists all supported image link styles.
+var ImageStyles = []string{
+	ImageStyleInline,
+	ImageStyleReference,
+	ImageStyleFigure,
+}
+
+// IsValidImageStyle reports whether style is a supported image link style.
+func IsValidImageStyle(style string) bool {
+	for _, s := range ImageStyles {
+		if s == style {
+			return true
+		}
+	}
+	return false
+}
+
+// styledImageTargetPattern matches the targets of reference definitions and
+// <figure> images written by applyImageStyle.
+var styledImageTargetPattern = regexp.MustCompile(`(?m)^\[img-\d+\]: <?([^\s>]+)|<img src="([^"]+)"`)
+
+// imageTargets returns the targets of all image links in markdown, in any of
+// the ImageStyles.
+func imageTargets(markdown []byte) []string {
+	var targets []string
+	for _, link := range findImageLinks(markdown) {
+		targets = append(targets, link.Dest)
+	}
+	for _, match := range styledImageTargetPattern.FindAllSubmatch(markdown, -1) {
+		if len(match[1]) > 0 {
+			targets = append(targets, string(match[1]))
+		} else {
+			targets = append(targets, html.UnescapeString(string(match[2])))
+		}
+	}
+	return targets
+}
+
+// applyImageStyle rewrites the inline image links of markdown to style.
+// Reference definitions are appended to the end of markdown, one per
+// distinct target.
+func applyImageStyle(markdown, style string) string {
+	switch style {
+	case ImageStyleReference:
+		return referenceImageLinks(markdown)
+	case ImageStyleFigure:
+		return figureImageLinks(markdown)
+	}
+	return markdown
+}
+
+func referenceImageLinks(markdown string) string {
+	labels := make(map[string]string)
+	var definitions strings.Builder
+	out := replaceImageLinks(markdown, func(link imageLink) string {
+		target, title := link.Dest, link.Title
+		key := target + "\x00" + title
+		label, seen := labels[key]
+		if !seen {
+			label = fmt.Sprintf("img-%d", len(labels)+1)
+			labels[key] = label
+			if link.Angled {
+				target = "<" + target + ">"
+			}
+			fmt.Fprintf(&definitions, "[%s]: %s", label, target)
+			if title != "" {
+				definitions.WriteString(" " + title)
+			}
+			definitions.WriteString("\n")
+		}
+		return "![" + link.Alt + "][" + label + "]"
+	})
+	if definitions.Len() == 0 {
+		return markdown
+	}
+	return strings.TrimRight(out, "\n") + "\n\n" + definitions.String()
+}
+
+// figureImageLinks replaces every image link with a one-line <figure>, so
+// links inside quotes and list items stay in place.
+func figureImageLinks(markdown string) string {
+	return replaceImageLinks(markdown, func(link imageLink) string {
+		target := link.Dest
+		alt, width, height := splitSizeHint(unescapeMarkdown(link.Alt))
+		var figure strings.Builder
+		fmt.Fprintf(&figure, `<figure><img src="%s" alt="%s"`, html.EscapeString(target), html.EscapeString(alt))
+		if width != "" {
+			fmt.Fprintf(&figure, ` width="%s"`, width)
+		}
+		if height != "" {
+			fmt.Fprintf(&figure, ` height="%s"`, height)
+		}
+		figure.WriteString(">")
+		if strings.TrimSpace(alt) != "" {
+			fmt.Fprintf(&figure, "<figcaption>%s</figcaption>", html.EscapeString(alt))
+		}
+		figure.WriteString("</figure>")
+		return figure.String()
+	})
+}
+
+// unescapeMarkdown drops the backslashes escaping ASCII punctuation in text,
+// which raw HTML would show literally.
+func unescapeMarkdown(text string) string {
+	if !strings.Contains(text, `\`) {
+		return text
+	}
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) && strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", text[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(text[i])
+	}
+	return b.String()
+}
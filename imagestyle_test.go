@@ -0,0 +1,45 @@
+package south2md
+
+import "testing"
+
+func TestApplyImageStyleReference(t *testing.T) {
+	markdown := "![a](images/a.jpg) ![b](<images/b.jpg> \"title\")\n\n![again](images/a.jpg)\n"
+
+	got := applyImageStyle(markdown, ImageStyleReference)
+	want := "![a][img-1] ![b][img-2]\n\n![again][img-1]\n\n" +
+		"[img-1]: images/a.jpg\n" +
+		"[img-2]: <images/b.jpg> \"title\"\n"
+	if got != want {
+		t.Fatalf("unexpected reference links:\n%s", got)
+	}
+}
+
+func TestApplyImageStyleFigure(t *testing.T) {
+	markdown := "> ![a \\*quoted\\* <pic>](images/a.jpg)\n\n![](https://img.example.com/b.jpg?x=1&y=2)"
+
+	got := applyImageStyle(markdown, ImageStyleFigure)
+	want := `> <figure><img src="images/a.jpg" alt="a *quoted* &lt;pic&gt;"><figcaption>a *quoted* &lt;pic&gt;</figcaption></figure>` + "\n\n" +
+		`<figure><img src="https://img.example.com/b.jpg?x=1&amp;y=2" alt=""></figure>`
+	if got != want {
+		t.Fatalf("unexpected figures:\n%s", got)
+	}
+}
+
+func TestApplyImageStyleInlineKeepsLinks(t *testing.T) {
+	markdown := "![a](images/a.jpg)"
+	for _, style := range []string{"", ImageStyleInline} {
+		if got := applyImageStyle(markdown, style); got != markdown {
+			t.Fatalf("style %q rewrote the links: %q", style, got)
+		}
+	}
+}
+
+func TestImageTargetsReadsEveryStyle(t *testing.T) {
+	markdown := "![a](images/a.jpg)\n\n![b](images/b.jpg)"
+	for _, style := range ImageStyles {
+		got := imageTargets([]byte(applyImageStyle(markdown, style)))
+		if len(got) != 2 || got[0] != "images/a.jpg" || got[1] != "images/b.jpg" {
+			t.Fatalf("style %q: unexpected targets %v", style, got)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package south2md
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ImageMismatch describes a cached image or attachment whose file no longer
+// matches the size or SHA-256 recorded when it was downloaded.
+type ImageMismatch struct {
+	TID    string
+	URL    string
+	Local  string // Path relative to the thread's images dir
+	Reason string
+}
+
+// ImageVerifyReport summarizes a VerifyImages run.
+type ImageVerifyReport struct {
+	Checked    int
+	Mismatches []ImageMismatch
+}
+
+// SetVerifyChecksums makes the handler compare the SHA-256 of every cached
+// image it reuses, not just its size. Damaged files are downloaded again.
+func (ih *ImageHandler) SetVerifyChecksums(enabled bool) {
+	if ih == nil {
+		return
+	}
+	ih.verifyChecksums = enabled
+}
+
+// VerifyImages checks the cached images of the stored threads tids, or of
+// every stored thread when tids is empty, against the sizes and SHA-256
+// digests recorded in their metadata.
+func (ps *PostStore) VerifyImages(tids ...string) (*ImageVerifyReport, error) {
+	if len(tids) == 0 {
+		var err error
+		if tids, err = ps.threadIDs(); err != nil {
+			return nil, err
+		}
+		sort.Strings(tids)
+	}
+
+	report := &ImageVerifyReport{}
+	for _, tid := range tids {
+		post, err := ps.readPost(tid)
+		if err != nil {
+			return nil, fmt.Errorf("thread %s: %w", tid, err)
+		}
+		for _, img := range post.Images {
+			if img.Downloaded && img.Local != "" {
+				report.Checked++
+			}
+		}
+		report.Mismatches = append(report.Mismatches, FindBrokenImages(ps.PostDir(tid), post, true)...)
+	}
+	return report, nil
+}
+
+// FindBrokenImages returns the images and attachments of post, stored in
+// postDir, whose cached file is missing, empty or has the wrong size.
+// withChecksum also compares their SHA-256. Local image links in postDir's
+// post.md that point at a missing file without a metadata record are
+// reported with an empty URL, since they can't be downloaded again.
+func FindBrokenImages(postDir string, post *Post, withChecksum bool) []ImageMismatch {
+	imagesDir := filepath.Join(postDir, "images")
+	var broken []ImageMismatch
+	recorded := make(map[string]bool, len(post.Images))
+	for _, img := range post.Images {
+		if !img.Downloaded || img.Local == "" {
+			continue
+		}
+		recorded[img.Local] = true
+		if reason := checkCachedImage(filepath.Join(imagesDir, filepath.FromSlash(img.Local)), img, withChecksum); reason != "" {
+			broken = append(broken, ImageMismatch{TID: post.TID, URL: img.URL, Local: img.Local, Reason: reason})
+		}
+	}
+
+	markdown, err := os.ReadFile(filepath.Join(postDir, "post.md"))
+	if err != nil {
+		return broken
+	}
+	for _, target := range imageTargets(markdown) {
+		local, ok := strings.CutPrefix(target, "images/")
+		if !ok || recorded[local] {
+			continue
+		}
+		recorded[local] = true
+		if _, err := os.Stat(filepath.Join(imagesDir, filepath.FromSlash(local))); err != nil {
+			broken = append(broken, ImageMismatch{TID: post.TID, Local: local, Reason: "missing, not in metadata"})
+		}
+	}
+	return broken
+}
+
+// checkCachedImage returns why the file at path doesn't match img, or ""
+// when it does. withChecksum also compares the recorded SHA-256, which
+// reads the whole file.
+func checkCachedImage(path string, img Image, withChecksum bool) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "missing"
+	}
+	if info.Size() == 0 {
+		return "empty file"
+	}
+	want := img.ContentLength
+	if want <= 0 {
+		want = img.FileSize
+	}
+	switch {
+	case want > 0 && info.Size() < want:
+		return fmt.Sprintf("truncated: %d of %d bytes", info.Size(), want)
+	case want > 0 && info.Size() != want:
+		return fmt.Sprintf("size mismatch: %d bytes, want %d", info.Size(), want)
+	}
+	if withChecksum && img.SHA256 != "" {
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return fmt.Sprintf("unreadable: %v", err)
+		}
+		if sum != img.SHA256 {
+			return "sha256 mismatch"
+		}
+	}
+	return ""
+}
+
+// dropDamagedImage checks the cached file of img in thread tid and, when it
+// is damaged, removes the file and its record from post so img is downloaded
+// again. It reports whether img was dropped.
+func (ih *ImageHandler) dropDamagedImage(tid string, img Image, post *Post) bool {
+	path := filepath.Join(threadDir(ih.rootDir, tid), ih.cacheDir, filepath.FromSlash(img.Local))
+	reason := checkCachedImage(path, img, ih.verifyChecksums)
+	if reason == "" {
+		return false
+	}
+	slog.Warn("Cached file is damaged, downloading it again", "url", img.URL, "path", path, "reason", reason)
+	// The file may be hard-linked into the live store dir; removing only
+	// drops this link.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Failed to remove damaged file", "path", path, "error", err)
+	}
+	kept := post.Images[:0]
+	for _, existing := range post.Images {
+		if existing.URL != img.URL || existing.Local != img.Local {
+			kept = append(kept, existing)
+		}
+	}
+	post.Images = kept
+	return true
+}
+
+// sha256Hex returns the hex SHA-256 digest of data.
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
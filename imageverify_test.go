@@ -0,0 +1,197 @@
+package south2md
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+// lengthDoer answers every request with body and the Content-Length length.
+type lengthDoer struct {
+	body   string
+	length int64
+}
+
+func (d *lengthDoer) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Header:        make(http.Header),
+		ContentLength: d.length,
+		Body:          io.NopCloser(strings.NewReader(d.body)),
+		Request:       req,
+	}, nil
+}
+
+func newVerifyTestHandler(t *testing.T, doer HTTPDoer) (*ImageHandler, string) {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "100", "images"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	h := NewImageHandler("images")
+	h.SetRootDir(root)
+	h.SetHTTPDoer(doer)
+	h.pending = NewPendingQueue()
+	return h, root
+}
+
+func TestDownloadRecordsContentLengthAndSHA256(t *testing.T) {
+	h, _ := newVerifyTestHandler(t, &lengthDoer{body: "image-bytes", length: 11})
+
+	post := &Post{}
+	if _, err := h.DownloadAndCacheImages("100", []byte("![a](https://img.example.com/a.jpg)"), post); err != nil {
+		t.Fatalf("DownloadAndCacheImages returned error: %v", err)
+	}
+	if len(post.Images) != 1 {
+		t.Fatalf("expected one image record, got %+v", post.Images)
+	}
+	img := post.Images[0]
+	if img.ContentLength != 11 || img.SHA256 != sha256Hex([]byte("image-bytes")) {
+		t.Fatalf("unexpected integrity fields: %+v", img)
+	}
+}
+
+func TestDownloadRejectsTruncatedImages(t *testing.T) {
+	h, root := newVerifyTestHandler(t, &lengthDoer{body: "image-bytes", length: 64})
+
+	post := &Post{}
+	if _, err := h.DownloadAndCacheImages("100", []byte("![a](https://img.example.com/a.jpg)"), post); err != nil {
+		t.Fatalf("DownloadAndCacheImages returned error: %v", err)
+	}
+	if len(post.Images) != 0 || h.pending.Len() != 1 {
+		t.Fatalf("expected the truncated image to be queued for retry, got %+v", post.Images)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(root, "100", "images")); len(entries) != 0 {
+		t.Fatalf("expected nothing to be cached, got %d files", len(entries))
+	}
+}
+
+func TestDownloadReplacesTruncatedCachedImage(t *testing.T) {
+	h, root := newVerifyTestHandler(t, &lengthDoer{body: "image-bytes", length: 11})
+	damaged := filepath.Join(root, "100", "images", "old.jpg")
+	if err := os.WriteFile(damaged, []byte("imag"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	post := &Post{Images: []Image{{
+		URL:           "https://img.example.com/a.jpg",
+		Local:         "old.jpg",
+		FileSize:      11,
+		ContentLength: 11,
+		Downloaded:    true,
+	}}}
+	got, err := h.DownloadAndCacheImages("100", []byte("![a](https://img.example.com/a.jpg)"), post)
+	if err != nil {
+		t.Fatalf("DownloadAndCacheImages returned error: %v", err)
+	}
+	if len(post.Images) != 1 || post.Images[0].Local == "old.jpg" {
+		t.Fatalf("expected the damaged record to be replaced, got %+v", post.Images)
+	}
+	if strings.Contains(string(got), "old.jpg") {
+		t.Fatalf("expected the link to point at the new file, got %q", got)
+	}
+	if _, err := os.Stat(damaged); !os.IsNotExist(err) {
+		t.Fatalf("expected the damaged file to be removed, stat: %v", err)
+	}
+}
+
+func TestPostStoreVerifyImages(t *testing.T) {
+	root := t.TempDir()
+	store := NewPostStore(root)
+	imagesDir := filepath.Join(root, "100", "images")
+	if err := os.MkdirAll(imagesDir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for name, content := range map[string]string{"good.jpg": "good", "bad.jpg": "evil"} {
+		if err := os.WriteFile(filepath.Join(imagesDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	post := &Post{TID: "100", Images: []Image{
+		{URL: "https://img.example.com/good.jpg", Local: "good.jpg", FileSize: 4, Downloaded: true, SHA256: sha256Hex([]byte("good"))},
+		{URL: "https://img.example.com/bad.jpg", Local: "bad.jpg", FileSize: 4, Downloaded: true, SHA256: sha256Hex([]byte("good"))},
+		{URL: "https://img.example.com/gone.jpg", Local: "gone.jpg", FileSize: 4, Downloaded: true},
+	}}
+	metadata, err := toml.Marshal(post)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "100", metadataFileName), metadata, 0644); err != nil {
+		t.Fatalf("write metadata: %v", err)
+	}
+
+	report, err := store.VerifyImages()
+	if err != nil {
+		t.Fatalf("VerifyImages: %v", err)
+	}
+	if report.Checked != 3 || len(report.Mismatches) != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.Mismatches[0].Local != "bad.jpg" || report.Mismatches[0].Reason != "sha256 mismatch" {
+		t.Fatalf("unexpected first mismatch: %+v", report.Mismatches[0])
+	}
+	if report.Mismatches[1].Local != "gone.jpg" || report.Mismatches[1].Reason != "missing" {
+		t.Fatalf("unexpected second mismatch: %+v", report.Mismatches[1])
+	}
+}
+
+func TestRepairImagesRedownloadsOnlyBrokenFiles(t *testing.T) {
+	root := t.TempDir()
+	failing := "https://img.example.com/c.jpg"
+	doer := &flakyImageDoer{failing: map[string]bool{failing: true}}
+	g := NewMarkdownGenerator(&MarkdownOptions{IncludeImages: true}, nil)
+	g.SetHTTPDoer(doer)
+
+	post := &Post{
+		TID: "100",
+		MainPost: PostEntry{
+			Floor:       "GF",
+			HTMLContent: `<p><img src="https://img.example.com/a.jpg"><img src="https://img.example.com/b.jpg"><img src="https://img.example.com/c.jpg"></p>`,
+		},
+	}
+	if err := g.StorePost(post, root); err != nil {
+		t.Fatalf("StorePost returned error: %v", err)
+	}
+	if broken, err := g.RepairImages(t.Context(), post, root); err != nil || len(broken) != 0 {
+		t.Fatalf("expected nothing to repair, got %+v, %v", broken, err)
+	}
+
+	// Empty out a.jpg; c.jpg stays queued from the first run.
+	var emptied string
+	for _, img := range post.Images {
+		if img.URL == "https://img.example.com/a.jpg" {
+			emptied = filepath.Join(root, "100", "images", img.Local)
+		}
+	}
+	if err := os.WriteFile(emptied, nil, 0644); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+
+	doer.urls = nil
+	broken, err := g.RepairImages(t.Context(), post, root)
+	if err != nil {
+		t.Fatalf("RepairImages returned error: %v", err)
+	}
+	if len(broken) != 0 {
+		t.Fatalf("expected the image to be repaired, still broken: %+v", broken)
+	}
+	if len(doer.urls) != 1 || doer.urls[0] != "https://img.example.com/a.jpg" {
+		t.Fatalf("expected only the empty image to be downloaded, got %v", doer.urls)
+	}
+	if info, err := os.Stat(emptied); err != nil || info.Size() == 0 {
+		t.Fatalf("expected the image to be rewritten, stat: %v", err)
+	}
+	pending, err := NewPostStore(root).LoadPending("100")
+	if err != nil {
+		t.Fatalf("LoadPending returned error: %v", err)
+	}
+	if items := pending.Items(); len(items) != 1 || items[0].URL != failing {
+		t.Fatalf("expected the untried download to stay queued, got %+v", items)
+	}
+}
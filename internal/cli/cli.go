@@ -1,46 +1,182 @@
 package cli
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/fdkevin0/south2md"
 	"github.com/spf13/cobra"
 )
 
 var (
 	// 命令行参数
-	flagConfigFile string
-	flagTID        string
-	flagInputFile  string
-	flagOutputFile string
-	flagOffline    bool
-	flagCacheDir   string
-	flagBaseURL    string
+	flagConfigFile  string
+	flagTID         string
+	flagInputFile   string
+	flagOutputFile  string
+	flagFormat      string
+	flagHugoSection string
+	flagGitCommit   bool
+	flagOffline     bool
+	flagCacheDir    string
+	flagSite        string
+	flagBaseURL     string
 	// 简化：移除部分不常用的参数
-	flagCookieFile         string
-	flagNoCache            bool
-	flagTimeout            int
-	flagMaxConcurrent      int
-	flagStrictPagination   bool
-	flagDebug              bool
-	flagUserAgent          string
-	flagGofileEnable       bool
-	flagGofileTool         string
-	flagGofileDir          string
-	flagGofileToken        string
-	flagGofileVenvDir      string
-	flagGofileSkipExisting bool
+	flagCookieFile          string
+	flagNoCache             bool
+	flagNoWayback           bool
+	flagWaybackSave         bool
+	flagCacheAvatars        bool
+	flagAuthorProfiles      bool
+	flagWaybackSaveInterval time.Duration
+	flagTranslate           string
+	flagTranslateTarget     string
+	flagTranslateMode       string
+	flagTranslateEndpoint   string
+	flagTranslateModel      string
+	flagTimeout             int
+	flagMaxConcurrent       int
+	flagThreadsParallel     int
+	flagStream              bool
+	flagMaxConcurrentAssets int
+	flagMaxConcurrentGofile int
+	flagPoliteness          string
+	flagStrictPagination    bool
+	flagStrictPages         bool
+	flagPagination          string
+	flagFollowCookieUA      bool
+	flagAllowGuest          bool
+	flagDebug               bool
+	flagUserAgent           string
+	flagProxy               string
+	flagNoProxy             string
+	flagProxyPoolFile       string
+	flagMirrors             []string
+	flagTLSFingerprint      string
+	flagProxyBanTime        time.Duration
+	flagLockWait            time.Duration
+	flagDirTemplate         string
+	flagMaxThreadSize       int64
+	flagMinFreeSpace        int64
+	flagGofileEnable        bool
+	flagGofileTool          string
+	flagGofileDir           string
+	flagGofileToken         string
+	flagGofileVenvDir       string
+	flagGofileSkipExisting  bool
+	flagGofileCacheTTL      time.Duration
+	flagGofileRateLimit     float64
+	flagGofileMaxSize       int64
+	flagGofileMaxFileSize   int64
+	flagGofileInclude       []string
+	flagGofileSelect        bool
+	flagImageClassifier     string
+	flagImageQuarantine     []string
+	flagImageSkip           []string
+	flagImageKeep           []string
+	flagImageMinWidth       int
+	flagImageMinHeight      int
+	flagImageMinBytes       int64
+	flagImageMinPixels      string
+	flagImageSmallDir       string
+	flagExternalAssetLimit  int64
+	flagMetricsAddr         string
+	flagOTelEndpoint        string
+	flagLogFile             string
+	flagLogFormat           string
+	flagLogMaxSize          int64
+	flagLogMaxBackups       int
+	flagRecordHAR           string
+	flagFixturesDir         string
+	flagJSONProgress        bool
+	flagOnThreadArchived    string
+	flagOnUpdate            string
+	flagOnError             string
+	flagDedupeQuotes        float64
+	flagChromePath          string
+	flagTemplateFile        string
+	flagFrontMatter         bool
+	flagAuthorStats         bool
+	flagReproducible        bool
+	flagThreaded            bool
+	flagMentionIndex        bool
+	flagTableOfContents     bool
+	flagTOCDepth            int
+	flagTOCMaxEntries       int
+	flagTOCPageSize         int
+	flagSplitEvery          int
+	flagPopularReplies      int
+	flagPopularStrategy     string
+	flagImageStyle          string
+	flagLineBreaks          string
+	flagSelectorProfile     string
+	flagSaveHTML            bool
+	flagSaveHTMLGzip        bool
+
+	// debug parse 参数
+	flagDebugSelector string
+	flagDebugExtract  bool
 
 	// Cookie相关参数
-	flagCookieImportFile string
+	flagCookieImportFile     string
+	flagCookieImportCurl     string
+	flagCookieImportCurlFile string
+
+	// list 参数
+	flagListTags     []string
+	flagListPrefix   string
+	flagListMinViews int
+
+	// store gc 参数
+	flagGCMaxAgeDays   int
+	flagGCMaxSize      string
+	flagGCPruneOrphans bool
+	flagGCDryRun       bool
+
+	// store dedupe 参数
+	flagDedupeLink bool
+
+	// store verify 参数
+	flagVerifyRepair bool
+
+	// diff 参数
+	flagDiffOld  string
+	flagDiffNew  string
+	flagDiffJSON bool
+
+	// serve 参数
+	flagAPIAddr       string
+	flagAPIToken      string
+	flagTelegramToken string
+	flagTelegramUsers []string
+
+	// history 参数
+	flagHistoryLimit  int
+	flagHistoryFailed bool
+
+	// export 参数
+	flagExportSinceFloor int
+	flagExportSinceDate  string
 )
 
 // rootCmd 根命令
 var rootCmd = &cobra.Command{
-	Use:   "south2md [TID]",
+	Use:   "south2md [TID...]",
 	Short: "HTML数据提取器 - 从南+ South Plus论坛提取帖子内容并转换为Markdown",
 	Long: `HTML数据提取器是一个用Go语言开发的工具，专门用于从"南+ South Plus"论坛抓取帖子内容并转换为Markdown格式。
 支持功能：
@@ -52,6 +188,9 @@ var rootCmd = &cobra.Command{
   south2md 2636739
   south2md --tid=2636739
 
+  # 批量抓取多个帖子，同时处理 3 个
+  south2md 2636739 2636740 2636741 --threads-parallel=3
+
   # 使用Cookie文件登录
   south2md 2636739 --cookie-file=./cookies.txt
 
@@ -59,9 +198,226 @@ var rootCmd = &cobra.Command{
   south2md --input=post.html
 
   # 导出已存储帖子到指定目录
-  south2md 2636739 --offline --output=./exports`,
+  south2md 2636739 --offline --output=./exports
+
+  # 导出为 Logseq 页面 / Joplin JEX 归档
+  south2md 2636739 --offline --format=logseq --output=~/logseq-graph
+  south2md 2636739 --offline --format=joplin --output=./exports
+
+  # 导出为 Hugo/Zola 页面包 (content/<section>/<tid>/index.md)
+  south2md 2636739 --offline --format=hugo --hugo-section=archive --output=./site
+
+  # 导出为带书签的 PDF (需要 Chrome/Chromium)
+  south2md 2636739 --offline --format=pdf --output=./exports
+
+  # 导出到 WebDAV (Nextcloud)
+  SOUTH2MD_WEBDAV_PASSWORD=xxx south2md 2636739 --offline --output=https://user@cloud.example.com/remote.php/dav/files/user/south2md`,
 	RunE: runExtractor,
-	Args: cobra.MaximumNArgs(1), // 允许最多一个位置参数
+	Args: cobra.ArbitraryArgs, // 多个TID时批量抓取
+}
+
+// selectorsCmd 选择器配置命令
+var selectorsCmd = &cobra.Command{
+	Use:   "selectors",
+	Short: "选择器配置工具",
+	Long:  `查看和测试用于解析帖子的 CSS 选择器配置`,
+}
+
+// selectorsTestCmd 选择器测试命令
+var selectorsTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Report how many nodes each selector matches in a page",
+	Example: `  # Test the default profile against a saved page
+  south2md selectors test --input=page.html
+
+  # Test a custom profile from the config file
+  south2md selectors test --input=page.html --selector-profile=custom --config=south2md.toml`,
+	RunE: runSelectorsTest,
+}
+
+// debugCmd 调试命令
+var debugCmd = &cobra.Command{
+	Use:   "debug",
+	Short: "调试工具",
+	Long:  `用于适配论坛页面结构变化的调试工具`,
+}
+
+// debugParseCmd 解析调试命令
+var debugParseCmd = &cobra.Command{
+	Use:   "parse",
+	Short: "Run a selector or the extractor against a saved page",
+	Example: `  # Pretty-print every element matched by a selector
+  south2md debug parse --input=page.html --selector='table.js-post'
+
+  # Show the extracted post as TOML
+  south2md debug parse --input=page.html --extract`,
+	RunE: runDebugParse,
+}
+
+// regenCmd 离线重新生成命令
+var regenCmd = &cobra.Command{
+	Use:   "regen <TID>",
+	Short: "Re-extract and re-render a stored post without fetching it",
+	Long: `Re-run the extractor over the raw pages saved with --save-html (or reuse the stored
+metadata when there are none) and regenerate the post with the current selectors and options.`,
+	Example: `  # Apply new selectors/options to an archived thread
+  south2md regen 2636739
+
+  # Regenerate and export
+  south2md regen 2636739 --split-every=100 --output=./exports`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRegen,
+}
+
+// retryCmd 重试失败下载命令
+var retryCmd = &cobra.Command{
+	Use:   "retry <TID>",
+	Short: "Re-attempt the downloads that failed in earlier runs of a stored post",
+	Long: `Failed image and gofile downloads don't abort a run; they are queued in the thread's
+pending.json with the reason they failed. retry re-attempts only those downloads and keeps
+whatever still fails in the queue.`,
+	Example: `  # Retry the failed downloads of an archived thread
+  south2md retry 2636739
+
+  # Retry and export the completed post
+  south2md retry 2636739 --output=./exports`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRetry,
+}
+
+// imagesCmd 图片管理命令
+var imagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "Manage the cached images of stored posts",
+}
+
+// imagesRepairCmd 图片修复命令
+var imagesRepairCmd = &cobra.Command{
+	Use:   "repair <TID>",
+	Short: "Re-download the missing or empty images of a stored post",
+	Long: `Scan the metadata (and post.md, when present) of a stored post for images and attachments whose
+local file is missing, empty or has the wrong size, and download only those again. Other images,
+gofile shares and the pages themselves are left alone.`,
+	Example: `  # Repair the images of an archived thread
+  south2md images repair 2636739
+
+  # Repair and export the completed post
+  south2md images repair 2636739 --output=./exports`,
+	Args: cobra.ExactArgs(1),
+	RunE: runImagesRepair,
+}
+
+// tagCmd 标签管理命令
+var tagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "为本地库中的帖子添加标签",
+	Long:  `管理本地库帖子的标签。标签保存在 metadata.toml 中，可用于 list 过滤，并随导出写入 front matter、Logseq 属性和 Joplin 标签。`,
+}
+
+// tagAddCmd 添加标签命令
+var tagAddCmd = &cobra.Command{
+	Use:     "add <TID> <TAG>...",
+	Short:   "Add tags to a stored thread",
+	Example: `  south2md tag add 2636739 asmr 2024`,
+	Args:    cobra.MinimumNArgs(2),
+	RunE:    runTagUpdate(true),
+}
+
+// tagRemoveCmd 删除标签命令
+var tagRemoveCmd = &cobra.Command{
+	Use:     "rm <TID> <TAG>...",
+	Aliases: []string{"remove"},
+	Short:   "Remove tags from a stored thread",
+	Example: `  south2md tag rm 2636739 2024`,
+	Args:    cobra.MinimumNArgs(2),
+	RunE:    runTagUpdate(false),
+}
+
+// tagListCmd 列出标签命令
+var tagListCmd = &cobra.Command{
+	Use:   "ls [TID]",
+	Short: "List the tags of a thread, or all tags with their thread counts",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runTagList,
+}
+
+// listCmd 列出本地库帖子命令
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List stored threads",
+	Example: `  # Threads tagged both asmr and 2024
+  south2md list --tag=asmr --tag=2024`,
+	Args: cobra.NoArgs,
+	RunE: runList,
+}
+
+// diffCmd 帖子快照对比命令
+var diffCmd = &cobra.Command{
+	Use:   "diff <TID>",
+	Short: "Show what changed in a thread since it was archived",
+	Long: `Compare the stored metadata of a thread with a fresh fetch and report new, edited (content hash
+changed) and deleted floors plus new attachments. --old and --new compare metadata.toml snapshots
+instead; nothing is written to the store.`,
+	Example: `  # Compare the archived thread with the forum
+  south2md diff 2636739
+
+  # Compare two saved snapshots as JSON
+  south2md diff 2636739 --old=./2024/metadata.toml --new=./2025/metadata.toml --json`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDiff,
+}
+
+// storeCmd 本地库管理命令
+var storeCmd = &cobra.Command{
+	Use:   "store",
+	Short: "本地帖子库管理工具",
+	Long:  `管理 XDG data 目录下的本地帖子库`,
+}
+
+// storeGCCmd 本地库垃圾回收命令
+var storeGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Delete old threads, enforce a size quota and prune orphaned assets",
+	Long: `Garbage-collect the local post store. Threads are aged by their last access (fetch, retry,
+regen or offline export). With --max-size the least recently accessed threads are evicted until
+the store fits. Run with --dry-run first to see what would be deleted.`,
+	Example: `  # Preview deleting threads untouched for 90 days and orphaned images
+  south2md store gc --max-age-days=90 --prune-orphans --dry-run
+
+  # Keep the store under 20 GB
+  south2md store gc --max-size=20GB`,
+	Args: cobra.NoArgs,
+	RunE: runStoreGC,
+}
+
+// storeDedupeCmd 本地库重复资源命令
+var storeDedupeCmd = &cobra.Command{
+	Use:   "dedupe",
+	Short: "Report duplicate asset files across threads and optionally hard-link them",
+	Long: `Hash the downloaded images and gofile files of every stored thread, report identical files and
+the space linking them would save. With --link every copy is replaced by a hard link to one file.`,
+	Example: `  # Report duplicates
+  south2md store dedupe
+
+  # Replace duplicates with hard links
+  south2md store dedupe --link`,
+	Args: cobra.NoArgs,
+	RunE: runStoreDedupe,
+}
+
+// storeVerifyCmd 本地库图片校验命令
+var storeVerifyCmd = &cobra.Command{
+	Use:   "verify [TID...]",
+	Short: "Check cached images and attachments against their recorded size and SHA-256",
+	Long: `Compare every cached image and attachment of the given stored threads, or of the whole store,
+with the Content-Length and SHA-256 recorded when it was downloaded, and report missing, truncated
+or altered files. With --repair the damaged files are downloaded again.`,
+	Example: `  # Check the whole store
+  south2md store verify
+
+  # Re-download the damaged images of one thread
+  south2md store verify 2636739 --repair`,
+	RunE: runStoreVerify,
 }
 
 // cookieCmd cookie管理命令
@@ -74,10 +430,15 @@ var cookieCmd = &cobra.Command{
 // cookieImportCmd cookie导入命令
 var cookieImportCmd = &cobra.Command{
 	Use:   "import",
-	Short: "Import a Netscape cookie file",
-	Long:  `Import a Netscape cookie file and cache it to the user data dir`,
+	Short: "Import a Netscape cookie file or a browser \"Copy as cURL\" command",
+	Long: `Import cookies and cache them to the user data dir. Cookies come from a Netscape cookie file
+(--file) or from the -b/--cookie and Cookie header options of a curl command copied from the
+browser dev tools (--curl, or --curl-file to read the command from a file).`,
 	Example: `  # Import a Netscape cookie file
-  south2md cookie import --file=./cookies.txt`,
+  south2md cookie import --file=./cookies.txt
+
+  # Import the cookies of a request copied as cURL
+  south2md cookie import --curl-file=./request.sh`,
 	RunE: runCookieImport,
 }
 
@@ -88,30 +449,182 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&flagConfigFile, "config", "", "配置文件路径 (TOML)")
 	rootCmd.PersistentFlags().StringVar(&flagTID, "tid", "", "帖子ID (用于在线抓取)")
 	rootCmd.PersistentFlags().StringVar(&flagInputFile, "input", "", "输入HTML文件路径")
-	rootCmd.PersistentFlags().StringVar(&flagOutputFile, "output", "", "导出目录路径（可选）")
+	rootCmd.PersistentFlags().StringVar(&flagOutputFile, "output", "", "导出目录路径或 WebDAV URL（可选）")
+	rootCmd.PersistentFlags().StringVar(&flagFormat, "format", defaultConfig.OutputFormat, "导出格式 ("+strings.Join(south2md.ExportFormats, "/")+")")
+	rootCmd.PersistentFlags().StringVar(&flagHugoSection, "hugo-section", defaultConfig.HugoSection, "hugo 格式导出的内容分区 (content/<section>)")
+	rootCmd.PersistentFlags().BoolVar(&flagGitCommit, "git-commit", defaultConfig.GitCommit, "把导出目录作为 git 仓库，每次导出后提交帖子的改动 (标题、新增楼层；隐含 --reproducible)")
+	rootCmd.PersistentFlags().StringVar(&flagChromePath, "chrome-path", defaultConfig.PDFChromePath, "pdf 格式导出使用的 Chrome/Chromium 可执行文件 (默认自动查找)")
+	rootCmd.PersistentFlags().StringVar(&flagSelectorProfile, "selector-profile", defaultConfig.SelectorProfile, "解析使用的选择器配置 (内置 south-plus，可在配置文件 [selectors.<name>] 中自定义)")
+	rootCmd.PersistentFlags().BoolVar(&flagSaveHTML, "save-html", defaultConfig.SaveHTML, "保存抓取到的原始 HTML 到 <tid>/raw/page-N.html，便于日后离线重新解析")
+	rootCmd.PersistentFlags().BoolVar(&flagSaveHTMLGzip, "save-html-gzip", defaultConfig.SaveHTMLGzip, "以 gzip 压缩保存原始 HTML (page-N.html.gz)")
 	rootCmd.PersistentFlags().BoolVar(&flagOffline, "offline", false, "离线模式：只从本地库导出，不抓取线上数据")
 	rootCmd.PersistentFlags().StringVar(&flagCacheDir, "cache-dir", defaultConfig.CacheDir, "附件缓存目录")
 	rootCmd.PersistentFlags().StringVar(&flagBaseURL, "base-url", "https://south-plus.net/", "论坛基础URL")
+	rootCmd.PersistentFlags().StringVar(&flagSite, "site", defaultConfig.Site, "使用配置文件中 [sites.<name>] 的站点配置 (为空时按帖子链接的主机推断)")
 	rootCmd.PersistentFlags().StringVar(&flagCookieFile, "cookie-file", defaultConfig.HTTPCookieFile, "Cookie file path (Netscape format)")
 	rootCmd.PersistentFlags().BoolVar(&flagNoCache, "no-cache", false, "禁用附件缓存")
+	rootCmd.PersistentFlags().BoolVar(&flagNoWayback, "no-wayback", false, "图片返回 404/410 时不再尝试从 archive.org 快照下载")
+	rootCmd.PersistentFlags().StringVar(&flagImageClassifier, "image-classifier", defaultConfig.ImageClassifier, "图片分类命令：对每张新下载的图片运行 (图片路径作为最后一个参数)，输出的第一个词记为标签")
+	rootCmd.PersistentFlags().StringSliceVar(&flagImageQuarantine, "image-quarantine", defaultConfig.ImageQuarantine, "把带有这些标签的图片移入 images/quarantine/，post.md 中只显示模糊缩略图 (可重复，如 nsfw)")
+	rootCmd.PersistentFlags().StringArrayVar(&flagImageSkip, "image-skip", defaultConfig.ImageSkip, "不下载 URL 匹配这些正则的图片，在 post.md 中保留远程链接 (可重复，如 '/smile/')")
+	rootCmd.PersistentFlags().StringArrayVar(&flagImageKeep, "image-keep", defaultConfig.ImageKeep, "总是下载 URL 匹配这些正则的图片，优先于 --image-skip 和尺寸下限 (可重复)")
+	rootCmd.PersistentFlags().IntVar(&flagImageMinWidth, "image-min-width", defaultConfig.ImageMinWidth, "不下载网页标注宽度小于此值的图片 (0 不限)")
+	rootCmd.PersistentFlags().IntVar(&flagImageMinHeight, "image-min-height", defaultConfig.ImageMinHeight, "不下载网页标注高度小于此值的图片 (0 不限)")
+	rootCmd.PersistentFlags().Int64Var(&flagImageMinBytes, "image-min-bytes", defaultConfig.ImageMinBytes, "先发 HEAD 请求，不下载小于此字节数的图片 (0 不检查)")
+	rootCmd.PersistentFlags().StringVar(&flagImageMinPixels, "image-min-pixels", defaultConfig.ImageMinPixels, "解码下载的图片，丢弃实际尺寸小于 宽x高 的图片，如 64x64 (空为不检查)")
+	rootCmd.PersistentFlags().StringVar(&flagImageSmallDir, "image-small-dir", defaultConfig.ImageSmallDir, "将小于 --image-min-pixels 的图片另存到图片目录下的此子目录，而非丢弃")
+	rootCmd.PersistentFlags().BoolVar(&flagCacheAvatars, "cache-avatars", defaultConfig.CacheAvatars, "把每位作者的头像下载到帖子的 avatars/ 目录")
+	rootCmd.PersistentFlags().BoolVar(&flagAuthorProfiles, "author-profiles", defaultConfig.CacheAuthorProfiles, "抓取每位作者的资料页 (u.php) 摘要并保存到 authors.toml")
+	rootCmd.PersistentFlags().BoolVar(&flagWaybackSave, "wayback-save", defaultConfig.WaybackSave, "抓取后把每页提交到 archive.org 保存快照 (尽力而为，快照链接记录到元数据)")
+	rootCmd.PersistentFlags().DurationVar(&flagWaybackSaveInterval, "wayback-save-interval", defaultConfig.WaybackSaveInterval, "两次 archive.org 保存请求的最小间隔")
+	rootCmd.PersistentFlags().StringVar(&flagTranslate, "translate", defaultConfig.TranslateBackend, "翻译后端 ("+strings.Join(south2md.TranslateBackends, "/")+")，设置后额外生成 post.<语言>.md 译文")
+	rootCmd.PersistentFlags().StringVar(&flagTranslateTarget, "translate-target", defaultConfig.TranslateTarget, "翻译目标语言代码 (如 en、ja)")
+	rootCmd.PersistentFlags().StringVar(&flagTranslateMode, "translate-mode", defaultConfig.TranslateMode, "译文模式 ("+strings.Join(south2md.TranslateModes, "/")+")，bilingual 在原文后附上译文")
+	rootCmd.PersistentFlags().StringVar(&flagTranslateEndpoint, "translate-endpoint", defaultConfig.TranslateEndpoint, "翻译 API 地址 (默认使用后端的公共地址)")
+	rootCmd.PersistentFlags().StringVar(&flagTranslateModel, "translate-model", defaultConfig.TranslateModel, "openai 后端使用的模型")
 	rootCmd.PersistentFlags().BoolVar(&flagDebug, "debug", false, "启用调试日志")
 	rootCmd.PersistentFlags().IntVar(&flagTimeout, "timeout", 30, "HTTP请求超时(秒)")
 	rootCmd.PersistentFlags().IntVar(&flagMaxConcurrent, "max-concurrent", 5, "最大并发下载数")
+	rootCmd.PersistentFlags().BoolVar(&flagStream, "stream", defaultConfig.StreamExtract, "逐页流式提取楼层并暂存到磁盘，抓取超长帖子时限制内存占用")
+	rootCmd.PersistentFlags().IntVar(&flagThreadsParallel, "threads-parallel", defaultConfig.ThreadsParallel, "传入多个TID时同时处理的帖子数，所有帖子共享按主机的并发限制")
+	rootCmd.PersistentFlags().IntVar(&flagMaxConcurrentAssets, "max-concurrent-assets", defaultConfig.HTTPMaxConcurrentAssets, "每个图片/附件主机的最大并发请求数 (0 不限)")
+	rootCmd.PersistentFlags().IntVar(&flagMaxConcurrentGofile, "max-concurrent-gofile", defaultConfig.HTTPMaxConcurrentGofile, "gofile 主机的最大并发请求数 (0 不限)")
+	rootCmd.PersistentFlags().StringVar(&flagPoliteness, "politeness", defaultConfig.HTTPPoliteness, "礼貌抓取配置 ("+strings.Join(south2md.PolitenessProfiles, "/")+")，polite 将论坛/图片/gofile 并发分别限制为 1/2/1")
+	rootCmd.PersistentFlags().BoolVar(&flagStrictPages, "strict-pages", defaultConfig.HTTPStrictPagination, "任一分页抓取失败时报错；默认跳过失败页并记录到 metadata.toml 的 missing_pages")
 	rootCmd.PersistentFlags().BoolVar(&flagStrictPagination, "strict-pagination", defaultConfig.HTTPStrictPagination, "分页抓取失败时是否立即报错")
+	_ = rootCmd.PersistentFlags().MarkDeprecated("strict-pagination", "请改用 --strict-pages")
+	rootCmd.PersistentFlags().StringVar(&flagPagination, "pagination", defaultConfig.HTTPPagination, "分页发现方式 ("+strings.Join(south2md.PaginationModes, "/")+")，next 逐页跟随“下一页”链接并与总页数核对")
 	rootCmd.PersistentFlags().StringVar(&flagUserAgent, "user-agent", defaultConfig.HTTPUserAgent, "HTTP User-Agent")
+	rootCmd.PersistentFlags().BoolVar(&flagAllowGuest, "allow-guest", defaultConfig.HTTPAllowGuest, "Cookie 失效(页面显示未登录)时仅保存游客可见内容并警告，而不是中止")
+	rootCmd.PersistentFlags().BoolVar(&flagFollowCookieUA, "follow-cookie-ua", defaultConfig.HTTPFollowCookieUA, "使用导入 Cookie 时记录的浏览器 User-Agent (关闭时仅在不一致时警告)")
+	rootCmd.PersistentFlags().StringVar(&flagProxy, "proxy", defaultConfig.HTTPProxy, "代理URL (http://、https://、socks5://、socks5h://，direct 禁用代理；默认读取 HTTPS_PROXY/HTTP_PROXY/ALL_PROXY)")
+	rootCmd.PersistentFlags().StringVar(&flagNoProxy, "no-proxy", defaultConfig.HTTPNoProxy, "不走代理的主机列表，逗号分隔 (默认读取 NO_PROXY)")
+	rootCmd.PersistentFlags().StringVar(&flagTLSFingerprint, "tls-fingerprint", defaultConfig.HTTPTLSFingerprint, "模仿的浏览器TLS指纹 (chrome/firefox/safari/edge)，降低 Cloudflare 验证频率 (仅用于直连论坛及镜像的HTTPS请求)")
+	rootCmd.PersistentFlags().StringSliceVar(&flagMirrors, "mirrors", defaultConfig.HTTPMirrors, "论坛镜像基础URL (可重复)，主域名被封锁 (403/Cloudflare 验证) 或无法连接时依次切换")
+	rootCmd.PersistentFlags().StringVar(&flagProxyPoolFile, "proxy-pool-file", defaultConfig.HTTPProxyPoolFile, "代理池列表文件 (每行一个代理URL)，设置后请求在代理间轮换并自动停用返回 403/Cloudflare 验证的代理")
+	rootCmd.PersistentFlags().DurationVar(&flagProxyBanTime, "proxy-ban-time", defaultConfig.HTTPProxyBanTime, "代理池中被封禁代理的停用时长")
 	rootCmd.PersistentFlags().BoolVar(&flagGofileEnable, "gofile-enable", defaultConfig.GofileEnable, "启用gofile下载")
 	rootCmd.PersistentFlags().StringVar(&flagGofileTool, "gofile-tool", defaultConfig.GofileTool, "gofile-downloader脚本路径")
 	rootCmd.PersistentFlags().StringVar(&flagGofileDir, "gofile-dir", defaultConfig.GofileDir, "gofile下载目录")
 	rootCmd.PersistentFlags().StringVar(&flagGofileToken, "gofile-token", defaultConfig.GofileToken, "gofile账号token")
 	rootCmd.PersistentFlags().StringVar(&flagGofileVenvDir, "gofile-venv-dir", defaultConfig.GofileVenvDir, "gofile虚拟环境目录")
 	rootCmd.PersistentFlags().BoolVar(&flagGofileSkipExisting, "gofile-skip-existing", defaultConfig.GofileSkipExisting, "跳过已存在的gofile内容")
+	rootCmd.PersistentFlags().DurationVar(&flagGofileCacheTTL, "gofile-cache-ttl", defaultConfig.GofileCacheTTL, "gofile 内容列表 API 响应的缓存时长 (0 禁用缓存)")
+	rootCmd.PersistentFlags().Float64Var(&flagGofileRateLimit, "gofile-rate-limit", defaultConfig.GofileRateLimit, "gofile API 与下载请求的每秒速率上限 (0 不限速)")
+	rootCmd.PersistentFlags().Int64Var(&flagGofileMaxSize, "gofile-max-size", defaultConfig.GofileMaxSize, "单个 gofile 分享所选文件的字节上限，超出时仅记录清单 (0 不限)")
+	rootCmd.PersistentFlags().Int64Var(&flagGofileMaxFileSize, "gofile-max-file-size", defaultConfig.GofileMaxFileSize, "跳过大于此字节数的单个 gofile 文件，仅记录在清单中 (0 不限)")
+	rootCmd.PersistentFlags().StringSliceVar(&flagGofileInclude, "gofile-include", defaultConfig.GofileInclude, "只下载匹配这些通配符的 gofile 文件 (可重复，如 '*.zip')")
+	rootCmd.PersistentFlags().BoolVar(&flagGofileSelect, "gofile-select", defaultConfig.GofileSelect, "下载前交互式选择每个 gofile 分享中要下载的文件")
+	rootCmd.PersistentFlags().StringVar(&flagMetricsAddr, "metrics", defaultConfig.MetricsAddr, "运行期间在此地址提供 Prometheus 指标 (如 :9090)")
+	rootCmd.PersistentFlags().DurationVar(&flagLockWait, "lock-wait", defaultConfig.StoreLockWait, "帖子正被另一个 south2md 进程写入时的等待时长 (0 立即失败，负数一直等待)")
+	rootCmd.PersistentFlags().StringVar(&flagDirTemplate, "dir-template", defaultConfig.StoreDirTemplate, "帖子目录名模板，如 '{title}-{tid}' (占位符: {tid}、{title})")
+	rootCmd.PersistentFlags().Int64Var(&flagMaxThreadSize, "max-thread-size", defaultConfig.StoreMaxThreadSize, "跳过会使帖子目录超过此字节数的图片、附件和 gofile 下载 (0 不限)")
+	rootCmd.PersistentFlags().Int64Var(&flagMinFreeSpace, "min-free-space", defaultConfig.StoreMinFreeSpace, "下载会使本地库所在文件系统的剩余空间低于此字节数时中止该帖子")
+	rootCmd.PersistentFlags().StringVar(&flagLogFile, "log-file", defaultConfig.LogFile, "把日志写入此文件而不是 stderr")
+	rootCmd.PersistentFlags().StringVar(&flagLogFormat, "log-format", defaultConfig.LogFormat, "日志格式 (text/json)")
+	rootCmd.PersistentFlags().Int64Var(&flagLogMaxSize, "log-max-size", defaultConfig.LogMaxSize, "日志文件超过此 MB 数后轮转 (0 不轮转)")
+	rootCmd.PersistentFlags().IntVar(&flagLogMaxBackups, "log-max-backups", defaultConfig.LogMaxBackups, "保留的轮转日志文件数")
+	rootCmd.PersistentFlags().StringVar(&flagFixturesDir, "fixtures-dir", defaultConfig.FixturesDir, "所有请求都从此目录中的 fixture 文件应答，不访问网络 (开发用)")
+	rootCmd.PersistentFlags().BoolVar(&flagJSONProgress, "json-progress", defaultConfig.JSONProgress, "在 stdout 上以逐行 JSON 事件输出进度，而不是文本")
+	rootCmd.PersistentFlags().StringVar(&flagOnThreadArchived, "on-thread-archived", defaultConfig.HookOnThreadArchived, "每个帖子保存后运行的 shell 命令，环境变量中带有 SOUTH2MD_HOOK_TID、SOUTH2MD_HOOK_PATH 等")
+	rootCmd.PersistentFlags().StringVar(&flagOnUpdate, "on-update", defaultConfig.HookOnUpdate, "已保存的帖子有新楼层时运行的 shell 命令")
+	rootCmd.PersistentFlags().StringVar(&flagOnError, "on-error", defaultConfig.HookOnError, "帖子归档失败时运行的 shell 命令")
+	rootCmd.PersistentFlags().StringVar(&flagRecordHAR, "record-har", defaultConfig.RecordHAR, "把本次运行的 HTTP 请求与响应 (头部、耗时、截断的正文) 记录到此 HAR 文件")
+	rootCmd.PersistentFlags().StringVar(&flagOTelEndpoint, "otel-endpoint", defaultConfig.OTelEndpoint, "把 OpenTelemetry 链路追踪导出到此 OTLP/HTTP 地址 (如 Jaeger 的 http://localhost:4318)")
+	rootCmd.PersistentFlags().Int64Var(&flagExternalAssetLimit, "external-asset-limit", defaultConfig.PolicyExternalAssetLimit, "gofile 分享预估总字节数超过此值时只记录清单不下载，仅作用于 gofile (0 不限)")
+
+	rootCmd.PersistentFlags().Float64Var(&flagDedupeQuotes, "dedupe-quotes", defaultConfig.MarkdownQuoteDedupe, "折叠只完整引用其他楼层(+1)的回复的相似度阈值，0 为关闭 (如 0.9)")
+
+	rootCmd.PersistentFlags().StringVar(&flagTemplateFile, "template", defaultConfig.MarkdownTemplateFile, "自定义 post.md 模板文件 (Go text/template)")
+
+	rootCmd.PersistentFlags().BoolVar(&flagFrontMatter, "front-matter", defaultConfig.MarkdownFrontMatter, "在 post.md 开头写入 YAML front matter")
+	rootCmd.PersistentFlags().BoolVar(&flagAuthorStats, "author-stats", defaultConfig.MarkdownAuthorStats, "在文末附上参与者统计 (楼层数、首次/最后发言、图片数)")
+	rootCmd.PersistentFlags().BoolVar(&flagMentionIndex, "mention-index", defaultConfig.MarkdownMentionIndex, "在文末附上被提及用户索引 (@提及和用户主页链接所在楼层)")
+	rootCmd.PersistentFlags().BoolVar(&flagReproducible, "reproducible", defaultConfig.MarkdownReproducible, "可复现输出: 不写生成时间, 元数据中的集合排序后保存")
+	rootCmd.PersistentFlags().BoolVar(&flagThreaded, "threaded", defaultConfig.MarkdownThreaded, "按引用关系把回复嵌套显示在被回复的楼层下")
+
+	rootCmd.PersistentFlags().BoolVar(&flagTableOfContents, "table-of-contents", defaultConfig.MarkdownTableOfContents, "在标题后生成楼层目录")
+	rootCmd.PersistentFlags().IntVar(&flagTOCDepth, "toc-depth", defaultConfig.MarkdownTOCDepth, "目录层级 (按页分组时 1 只列出页)")
+	rootCmd.PersistentFlags().IntVar(&flagTOCMaxEntries, "toc-max-entries", defaultConfig.MarkdownTOCMaxEntries, "目录最多列出的楼层数 (0 不限)")
+	rootCmd.PersistentFlags().IntVar(&flagTOCPageSize, "toc-page-size", defaultConfig.MarkdownTOCPageSize, "目录按页分组时每页楼层数 (0 不分组)")
+
+	rootCmd.PersistentFlags().IntVar(&flagSplitEvery, "split-every", defaultConfig.MarkdownSplitEvery, "每 N 层拆分为 post-001.md, post-002.md ... 并以 post.md 作索引 (0 不拆分)")
+
+	rootCmd.PersistentFlags().IntVar(&flagPopularReplies, "popular-replies", defaultConfig.MarkdownPopularReplies, "在标题后列出前 N 条热门回复 (0 关闭)")
+	rootCmd.PersistentFlags().StringVar(&flagPopularStrategy, "popular-strategy", defaultConfig.MarkdownPopularStrategy, "热门回复排序策略 ("+strings.Join(south2md.PopularStrategies, "/")+")")
+	rootCmd.PersistentFlags().StringVar(&flagImageStyle, "image-style", defaultConfig.MarkdownImageStyle, "图片链接样式 ("+strings.Join(south2md.ImageStyles, "/")+")")
+	rootCmd.PersistentFlags().StringVar(&flagLineBreaks, "line-breaks", defaultConfig.MarkdownLineBreaks, "换行样式 ("+strings.Join(south2md.LineBreakStyles, "/")+"，spaces/backslash 保留每个 <br> 和连续空行)")
 
 	// 添加子命令
 	rootCmd.AddCommand(cookieCmd)
 	cookieCmd.AddCommand(cookieImportCmd)
+	rootCmd.AddCommand(selectorsCmd)
+	selectorsCmd.AddCommand(selectorsTestCmd)
+	rootCmd.AddCommand(regenCmd)
+	rootCmd.AddCommand(retryCmd)
+	rootCmd.AddCommand(imagesCmd)
+	imagesCmd.AddCommand(imagesRepairCmd)
+	rootCmd.AddCommand(storeCmd)
+	rootCmd.AddCommand(tagCmd)
+	tagCmd.AddCommand(tagAddCmd, tagRemoveCmd, tagListCmd)
+	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(historyShowCmd)
+	storeCmd.AddCommand(storeGCCmd, storeDedupeCmd, storeVerifyCmd)
+	rootCmd.AddCommand(debugCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(tuiCmd)
+	rootCmd.AddCommand(serveCmd)
+	configCmd.AddCommand(configShowCmd)
+	debugCmd.AddCommand(debugParseCmd)
+
+	// debug parse 命令参数
+	debugParseCmd.Flags().StringVar(&flagDebugSelector, "selector", "", "在 --input 页面上运行的 CSS 选择器")
+	debugParseCmd.Flags().BoolVar(&flagDebugExtract, "extract", false, "以 TOML 输出提取到的帖子")
 
 	// cookie import 命令参数
 	cookieImportCmd.Flags().StringVar(&flagCookieImportFile, "file", "", "Cookie file path (Netscape format)")
+	cookieImportCmd.Flags().StringVar(&flagCookieImportCurl, "curl", "", "从浏览器开发者工具复制的 curl 命令行")
+	cookieImportCmd.Flags().StringVar(&flagCookieImportCurlFile, "curl-file", "", "包含 curl 命令行的文件 (- 表示标准输入)")
+	cookieImportCmd.MarkFlagsMutuallyExclusive("file", "curl", "curl-file")
+
+	// list 参数
+	listCmd.Flags().StringSliceVar(&flagListTags, "tag", nil, "只列出带有此标签的帖子 (可重复，须全部匹配)")
+	listCmd.Flags().StringVar(&flagListPrefix, "prefix", "", "只列出标题带有此前缀的帖子，如 [RPG] 对应 RPG")
+	listCmd.Flags().IntVar(&flagListMinViews, "min-views", 0, "只列出浏览数不少于此值的帖子")
+
+	// diff 参数
+	diffCmd.Flags().StringVar(&flagDiffOld, "old", "", "作为比较起点的 metadata.toml 快照 (默认: 本地库中的帖子)")
+	diffCmd.Flags().StringVar(&flagDiffNew, "new", "", "作为比较终点的 metadata.toml 快照 (默认: 在线抓取帖子)")
+	diffCmd.Flags().BoolVar(&flagDiffJSON, "json", false, "以 JSON 而不是 Markdown 输出差异")
+
+	// store gc 参数
+	storeGCCmd.Flags().IntVar(&flagGCMaxAgeDays, "max-age-days", 0, "删除超过此天数未访问的帖子 (0 不删除)")
+	storeGCCmd.Flags().StringVar(&flagGCMaxSize, "max-size", "", "按最近访问时间淘汰帖子，直到本地库不超过此大小，如 20GB")
+	storeGCCmd.Flags().BoolVar(&flagGCPruneOrphans, "prune-orphans", false, "删除元数据未引用的图片/gofile 文件和残留的暂存目录")
+	storeGCCmd.Flags().BoolVar(&flagGCDryRun, "dry-run", false, "只报告将被删除的内容")
+
+	// store dedupe 参数
+	storeDedupeCmd.Flags().BoolVar(&flagDedupeLink, "link", false, "用硬链接替换重复文件")
+
+	// serve 参数
+	serveCmd.Flags().StringVar(&flagAPIAddr, "api-addr", defaultConfig.APIAddr, "控制 API 的监听地址")
+	serveCmd.Flags().StringVar(&flagAPIToken, "api-token", defaultConfig.APIToken, "API 请求必须携带的 Bearer token (--api-addr 不是回环地址时必填)")
+	serveCmd.Flags().StringVar(&flagTelegramToken, "telegram-token", defaultConfig.TelegramToken, "Telegram 机器人 token，机器人会把白名单用户发来的帖子加入队列")
+	serveCmd.Flags().StringSliceVar(&flagTelegramUsers, "telegram-users", defaultConfig.TelegramUsers, "允许使用机器人的 Telegram 用户 ID 或 @用户名 (可重复)")
+
+	// history 参数
+	historyCmd.Flags().IntVar(&flagHistoryLimit, "limit", 20, "列出的运行记录数 (0 列出全部)")
+	historyCmd.Flags().BoolVar(&flagHistoryFailed, "failed", false, "只列出失败的运行")
+
+	// export 参数
+	exportCmd.Flags().IntVar(&flagExportSinceFloor, "since-floor", 0, "只导出楼层号大于此值的楼层，如 120 表示 B120F 之后的楼层")
+	exportCmd.Flags().StringVar(&flagExportSinceDate, "since-date", "", "只导出此时间之后发布的楼层 (YYYY-MM-DD、YYYY-MM-DD HH:MM[:SS] 或 RFC 3339)")
+
+	// store verify 参数
+	storeVerifyCmd.Flags().BoolVar(&flagVerifyRepair, "repair", false, "重新下载损坏的文件")
 
 	// 标记必需参数
 	rootCmd.MarkFlagsMutuallyExclusive("tid", "input")
@@ -123,172 +636,1441 @@ func Execute() error {
 }
 
 // runExtractor 运行提取器
-func runExtractor(cmd *cobra.Command, args []string) error {
+func runExtractor(cmd *cobra.Command, args []string) (err error) {
 	runtimeConfig, err := buildRuntimeConfig(cmd, args)
 	if err != nil {
 		return fmt.Errorf("初始化配置失败: %v", err)
 	}
 	cfg := runtimeConfig.App
 
-	south2md.InitLogger(runtimeConfig.Debug)
+	if err := initLogger(runtimeConfig.Debug, runtimeConfig.App); err != nil {
+		return err
+	}
 
-	storeDir := filepath.Join(south2md.DefaultDataDir("south2md"), "posts")
-	store := south2md.NewPostStore(storeDir)
+	store := openPostStore(cfg)
 	if err := store.EnsureRoot(); err != nil {
 		return fmt.Errorf("初始化本地数据目录失败: %v", err)
 	}
+	if interrupted, err := store.Interrupted(); err != nil {
+		slog.Warn("Failed to read store journal", "error", err)
+	} else {
+		for _, entry := range interrupted {
+			slog.Warn("Found interrupted store write, it resumes on the next fetch of this thread",
+				"tid", entry.TID, "state", entry.State, "started_at", entry.StartedAt)
+		}
+	}
+
+	progress := newProgressEmitter(cmd.OutOrStdout(), cfg.JSONProgress)
+	out := progress.output()
+
+	command, started := "fetch", time.Now()
+	if runtimeConfig.Offline {
+		command = "export"
+	}
+	var (
+		metrics *south2md.Metrics
+		output  string
+	)
+	defer func() { recordRun(store, command, runtimeConfig.TIDs, started, metrics, output, err) }()
 
 	if runtimeConfig.Offline {
 		if cfg.OutputFile == "" {
 			return fmt.Errorf("--offline 模式需要指定 --output 导出目录")
 		}
-		exportGenerator := newMarkdownGenerator(cfg)
+		exportGenerator, err := newMarkdownGenerator(cfg)
+		if err != nil {
+			return err
+		}
 		exportGenerator.SetDownloadEnabled(false)
 		post, err := store.LoadPostFromStore(cfg.TID)
 		if err != nil {
 			return fmt.Errorf("离线加载帖子失败: %v", err)
 		}
-		exportDir := resolveExportDir(cfg.OutputFile)
-		exportedDir, err := store.ExportPost(cfg.TID, exportDir)
+		exportedDir, err := exportPost(cfg, store, exportGenerator, post)
 		if err != nil {
-			return fmt.Errorf("离线导出失败: %v", err)
-		}
-		if err := exportGenerator.ExportPost(post, exportDir); err != nil {
-			return fmt.Errorf("离线导出Markdown失败: %v", err)
+			err = fmt.Errorf("离线导出失败: %v", err)
+			progress.done(store, cfg.TID, &south2md.PipelineState{Post: post}, err)
+			return err
 		}
-		fmt.Printf("✓ 离线导出完成: %s\n", exportedDir)
+		output = exportedDir
+		progress.done(store, cfg.TID, &south2md.PipelineState{Post: post, Output: exportedDir}, nil)
+		fmt.Fprintf(out, "✓ 离线导出完成: %s\n", exportedDir)
 		return nil
 	}
 
 	// 创建HTTP客户端
-	httpOptions := buildHTTPOptions(cfg)
+	httpOptions := south2md.HTTPOptionsFromConfig(cfg)
+	stopHAR := startHARRecording(cfg.RecordHAR, httpOptions)
+	defer stopHAR()
 	client := south2md.NewHTTPClient(httpOptions)
 
 	// 创建Fetcher
 	httpClient := south2md.NewFetcher(client, httpOptions, cfg.BaseURL)
+	var savePage south2md.RawPageHandler
+	if cfg.SaveHTML || cfg.SaveHTMLGzip {
+		savePage = func(tid string, page int, html string) {
+			if err := store.SaveRawPage(tid, page, html, cfg.SaveHTMLGzip); err != nil {
+				slog.Warn("Failed to save raw HTML page", "tid", tid, "page", page, "error", err)
+			}
+		}
+	}
+	httpClient.SetRawPageHandler(progress.rawPageHandler(savePage))
+
+	metrics = south2md.NewMetrics()
+	httpClient.SetMetrics(metrics)
+	stopMetrics, err := startMetricsServer(cfg.MetricsAddr, metrics)
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+	shutdownTracing, err := initTracing(cmd.Context(), cfg.OTelEndpoint)
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing()
+
+	saver := newWaybackSaver(cfg, httpClient.HTTPDoer())
+
+	if len(runtimeConfig.TIDs) > 1 {
+		err := runBatch(cmd.Context(), cfg, store, httpClient, metrics, saver, progress, runtimeConfig.TIDs)
+		fmt.Fprint(out, metrics.Summary())
+		return err
+	}
 
 	// 创建帖子解析器
-	postParser := south2md.NewPostParser()
+	postParser, err := newPostParser(cfg)
+	if err != nil {
+		return err
+	}
 
-	markdownGenerator := newMarkdownGenerator(cfg)
+	markdownGenerator, err := newMarkdownGenerator(cfg)
+	if err != nil {
+		return err
+	}
+	markdownGenerator.SetHTTPDoer(httpClient.HTTPDoer())
+	markdownGenerator.SetMetrics(metrics)
+	attachAttachmentFetcher(markdownGenerator, httpClient, cfg)
+	attachAssetRegistry(markdownGenerator, store)
+	progress.attach(markdownGenerator)
 
 	// 获取帖子内容
-	var post *south2md.Post
-
+	var source south2md.Stage
 	if cfg.TID != "" {
-		// 在线抓取模式
-		var fetchErr error
-		post, fetchErr = httpClient.FetchPostWithPagination(cfg.TID, postParser)
-		if fetchErr != nil {
-			return fmt.Errorf("抓取帖子失败: %v", fetchErr)
-		}
+		source = newMaintenanceBackoff(out).stage(fetchStage(cfg, httpClient, postParser, store))
 	} else if runtimeConfig.InputFile != "" {
-		// 从本地文件加载
-		if err := postParser.LoadFromFile(runtimeConfig.InputFile); err != nil {
-			return fmt.Errorf("加载HTML文件失败: %v", err)
-		}
-
-		// 提取帖子数据
-		var extractErr error
-		post, extractErr = postParser.ExtractPost()
-		if extractErr != nil {
-			return fmt.Errorf("提取帖子数据失败: %v", extractErr)
-		}
+		source = south2md.ParseFileStage(postParser, runtimeConfig.InputFile)
 	} else {
 		return fmt.Errorf("必须指定帖子ID或 --input 参数")
 	}
 
-	if post.TID == "" {
-		post.TID = cfg.TID
+	state := &south2md.PipelineState{TID: cfg.TID}
+	pipeline := newArchivePipeline(cfg, store, markdownGenerator, source, out)
+	progress.addFloorEvents(pipeline, source.Name())
+	if cfg.TID != "" {
+		addWaybackSave(pipeline, httpClient, saver)
 	}
-	if post.TID == "" {
-		return fmt.Errorf("无法确定帖子ID，请提供 --tid 或位置参数")
+	_, err = runArchivePipeline(cmd.Context(), cfg, store, pipeline, state)
+	output = state.Output
+	progress.done(store, cfg.TID, state, err)
+	if err != nil {
+		return err
 	}
 
-	// 始终先入库到 XDG data 目录
-	fmt.Println("正在保存帖子到本地库...")
-	if err := markdownGenerator.StorePost(post, store.RootDir()); err != nil {
-		return fmt.Errorf("保存帖子到本地库失败: %v", err)
+	fmt.Fprint(out, markdownGenerator.Summary().String())
+	fmt.Fprint(out, metrics.Summary())
+	return nil
+}
+
+// fetchStage returns the stage fetching a thread, streaming it through the
+// store's spool with --stream.
+func fetchStage(cfg *south2md.Config, fetcher *south2md.Fetcher, parser *south2md.PostParser, store *south2md.PostStore) south2md.Stage {
+	if cfg.StreamExtract {
+		return south2md.StreamFetchStage(fetcher, parser, store)
 	}
-	fmt.Printf("✓ 帖子已存储到 %s/%s/\n", store.RootDir(), post.TID)
+	return south2md.FetchStage(fetcher, parser)
+}
 
-	// 可选导出
-	if cfg.OutputFile != "" {
-		exportDir := resolveExportDir(cfg.OutputFile)
-		exportedDir, err := store.ExportPost(post.TID, exportDir)
+// newWaybackSaver returns the archive.org saver shared by every thread of a
+// run, so --wayback-save-interval spaces requests across concurrent threads,
+// or nil without --wayback-save.
+func newWaybackSaver(cfg *south2md.Config, client south2md.HTTPDoer) *south2md.WaybackSaver {
+	if !cfg.WaybackSave {
+		return nil
+	}
+	return south2md.NewWaybackSaver(client, cfg.WaybackSaveInterval)
+}
+
+// addWaybackSave submits the fetched pages to archive.org before the post is
+// stored when saver is set.
+func addWaybackSave(pipeline *south2md.Pipeline, fetcher *south2md.Fetcher, saver *south2md.WaybackSaver) {
+	if saver == nil {
+		return
+	}
+	if err := pipeline.InsertAfter(south2md.StageFetch, south2md.WaybackSaveStage(fetcher, saver)); err != nil {
+		slog.Warn("Wayback save disabled", "error", err)
+	}
+}
+
+// addContentFilter applies cfg's [[filters]] rules right after the stage
+// named anchor, which produces the post.
+func addContentFilter(pipeline *south2md.Pipeline, cfg *south2md.Config, anchor string) {
+	if len(cfg.Filters) == 0 {
+		return
+	}
+	filter, err := south2md.NewContentFilter(cfg.Filters)
+	if err != nil {
+		slog.Warn("Content filters disabled", "error", err)
+		return
+	}
+	_ = pipeline.InsertAfter(anchor, south2md.FilterStage(filter))
+}
+
+// newArchivePipeline stores the post produced by source and exports it,
+// reporting progress to out.
+func newArchivePipeline(cfg *south2md.Config, store *south2md.PostStore, generator *south2md.MarkdownGenerator, source south2md.Stage, out io.Writer) *south2md.Pipeline {
+	// 始终先入库到 XDG data 目录，再按需导出
+	pipeline := south2md.NewPipeline(
+		source,
+		south2md.NewStage("announce", func(ctx context.Context, state *south2md.PipelineState) error {
+			fmt.Fprintln(out, "正在保存帖子到本地库...")
+			return nil
+		}),
+		south2md.StoreStage(generator, store),
+		south2md.NewStage("stored", func(ctx context.Context, state *south2md.PipelineState) error {
+			fmt.Fprintf(out, "✓ 帖子已存储到 %s/\n", store.PostDir(state.Post.TID))
+			printPendingNotice(out, store, state.Post.TID)
+			printMissingPagesNotice(out, store, state.Post)
+			return nil
+		}),
+		exportStage(cfg, store, generator, out),
+	)
+	addContentFilter(pipeline, cfg, source.Name())
+	if cfg.TranslateBackend != "" {
+		translator, err := south2md.NewTranslator(slowRequestClient(south2md.HTTPOptionsFromConfig(cfg)), south2md.TranslatorOptions{
+			Backend:  cfg.TranslateBackend,
+			Endpoint: cfg.TranslateEndpoint,
+			APIKey:   cfg.TranslateAPIKey,
+			Model:    cfg.TranslateModel,
+		})
 		if err != nil {
-			return fmt.Errorf("导出帖子失败: %v", err)
+			slog.Warn("Translation disabled", "error", err)
+			return pipeline
+		}
+		// Translate after storing so the variant is written next to the
+		// stored thread and exported with it.
+		_ = pipeline.InsertBefore(south2md.StageExport, south2md.TranslateStage(translator, generator, store, cfg.TranslateTarget, cfg.TranslateMode))
+	}
+	return pipeline
+}
+
+// runArchivePipeline runs pipeline on state, then the hooks configured for
+// its outcome: on_thread_archived, plus on_update when a thread already in
+// the store gained floors, or on_error. With git_commit it commits the
+// exported thread to the git repository in the export directory. It returns
+// the changes against the thread stored before the run, or nil when the
+// thread is new or the run failed.
+func runArchivePipeline(ctx context.Context, cfg *south2md.Config, store *south2md.PostStore, pipeline *south2md.Pipeline, state *south2md.PipelineState) (*south2md.PostDiff, error) {
+	// The snapshot stored before this run, for finding the new floors.
+	var previous *south2md.Post
+	_ = pipeline.InsertBefore(south2md.StageStore, south2md.NewStage("snapshot", func(ctx context.Context, state *south2md.PipelineState) error {
+		previous, _ = store.LoadPostFromStore(state.Post.TID)
+		return nil
+	}))
+	err := pipeline.Run(ctx, state)
+
+	// Hooks still run when the run was interrupted.
+	ctx = context.WithoutCancel(ctx)
+	env := south2md.HookEnv{TID: state.TID, Output: state.Output}
+	if post := state.Post; post != nil {
+		env.TID, env.Title, env.URL, env.Floors = post.TID, post.Title, post.URL, post.TotalFloors
+	}
+	if env.TID != "" {
+		env.Path = store.PostDir(env.TID)
+	}
+	if err != nil {
+		env.Error = err.Error()
+		runHook(ctx, cfg.HookOnError, south2md.HookError, env)
+		return nil, err
+	}
+	base := previous
+	if base == nil {
+		base = &south2md.Post{}
+	}
+	diff := south2md.DiffPosts(base, state.Post)
+	env.NewFloors = len(diff.NewFloors)
+	env.NewFloorsMarkdown = diff.NewFloorsMarkdown(hookSnippetFloors)
+	if cfg.GitCommit {
+		commitExport(ctx, cfg, previous == nil, env)
+	}
+	runHook(ctx, cfg.HookOnThreadArchived, south2md.HookThreadArchived, env)
+	if previous == nil {
+		return nil, nil
+	}
+	if env.NewFloors > 0 {
+		runHook(ctx, cfg.HookOnUpdate, south2md.HookUpdate, env)
+	}
+	return diff, nil
+}
+
+// hookSnippetFloors is how many new floors SOUTH2MD_HOOK_NEW_FLOORS_MARKDOWN
+// shows, keeping it well inside the size limit of an environment variable
+// on the first fetch of a long thread.
+const hookSnippetFloors = 20
+
+// commitExport commits the thread exported to env.Output to the git
+// repository in the export directory. The subject names the thread and the
+// floors added; trailers carry the details for scripts reading the log. The
+// retry queue is left out, its attempt counters change on every run. A
+// failed commit is logged and doesn't fail the run, the export is on disk.
+func commitExport(ctx context.Context, cfg *south2md.Config, first bool, env south2md.HookEnv) {
+	subject := fmt.Sprintf("Update %s: %s (+%d floors)", env.TID, env.Title, env.NewFloors)
+	if first {
+		subject = fmt.Sprintf("Archive %s: %s", env.TID, env.Title)
+	}
+	message := fmt.Sprintf("%s\n\nTID: %s\nTitle: %s\nURL: %s\nFloors: %d\nNew-Floors: %d\n",
+		subject, env.TID, env.Title, env.URL, env.Floors, env.NewFloors)
+	committed, err := south2md.GitCommitPath(ctx, resolveExportDir(cfg.OutputFile), env.Output, message, south2md.PendingFileName)
+	if err != nil {
+		slog.Warn("Git commit failed", "tid", env.TID, "error", err)
+		return
+	}
+	if !committed {
+		slog.Debug("Export unchanged, nothing to commit", "tid", env.TID)
+		return
+	}
+	slog.Info("Committed export", "tid", env.TID, "new_floors", env.NewFloors)
+}
+
+// runHook runs command, if set, for event. A failing hook is logged and
+// doesn't fail the run; its output goes to the log so it can't garble
+// progress output.
+func runHook(ctx context.Context, command, event string, env south2md.HookEnv) {
+	if command == "" {
+		return
+	}
+	env.Event = event
+	output, err := south2md.RunHook(ctx, command, env)
+	text := strings.TrimSpace(string(output))
+	if len(text) > 2000 {
+		text = "..." + text[len(text)-2000:]
+	}
+	if err != nil {
+		slog.Warn("Hook failed", "event", event, "tid", env.TID, "error", err, "output", text)
+		return
+	}
+	slog.Info("Hook finished", "event", event, "tid", env.TID, "output", text)
+}
+
+// runBatch archives tids with up to cfg.ThreadsParallel threads in flight.
+// Every thread goes through fetcher, so page fetches and asset downloads of
+// the whole batch share its per-host limits. A failed thread doesn't stop the
+// others; while the forum is under maintenance the whole batch pauses (see
+// maintenanceBackoff).
+func runBatch(ctx context.Context, cfg *south2md.Config, store *south2md.PostStore, fetcher *south2md.Fetcher, metrics *south2md.Metrics, saver *south2md.WaybackSaver, progress *progressEmitter, tids []string) error {
+	out := progress.output()
+
+	// One registry for the batch, so concurrent threads don't overwrite each
+	// other's records.
+	registry, err := south2md.LoadAssetRegistry(store.RootDir())
+	if err != nil {
+		slog.Warn("Failed to load asset registry, images will not be shared between threads", "error", err)
+	}
+
+	var (
+		mu     sync.Mutex
+		failed []string
+		wg     sync.WaitGroup
+	)
+	slots := make(chan struct{}, max(cfg.ThreadsParallel, 1))
+	backoff := newMaintenanceBackoff(out)
+	archive := func(tid string) error {
+		parser, err := newPostParser(cfg)
+		if err != nil {
+			return err
+		}
+		generator, err := newMarkdownGenerator(cfg)
+		if err != nil {
+			return err
 		}
-		if err := markdownGenerator.ExportPost(post, exportDir); err != nil {
-			return fmt.Errorf("导出Markdown失败: %v", err)
+		generator.SetHTTPDoer(fetcher.HTTPDoer())
+		generator.SetMetrics(metrics)
+		attachAttachmentFetcher(generator, fetcher, cfg)
+		if registry != nil {
+			generator.SetAssetRegistry(registry)
 		}
-		fmt.Printf("✓ 帖子已导出到 %s\n", exportedDir)
+		progress.attach(generator)
+		state := &south2md.PipelineState{TID: tid}
+		source := backoff.stage(fetchStage(cfg, fetcher, parser, store))
+		pipeline := newArchivePipeline(cfg, store, generator, source, out)
+		progress.addFloorEvents(pipeline, source.Name())
+		addWaybackSave(pipeline, fetcher, saver)
+		_, err = runArchivePipeline(ctx, cfg, store, pipeline, state)
+		progress.done(store, tid, state, err)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(out, generator.Summary().String())
+		return nil
+	}
+
+	fmt.Fprintf(out, "批量抓取 %d 个帖子，同时处理 %d 个\n", len(tids), cap(slots))
+	for _, tid := range tids {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			mu.Lock()
+			failed = append(failed, tid)
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if err := archive(tid); err != nil {
+				fmt.Fprintf(out, "✗ 帖子 %s 处理失败: %v\n", tid, err)
+				mu.Lock()
+				failed = append(failed, tid)
+				mu.Unlock()
+			}
+		}()
 	}
+	wg.Wait()
 
+	fmt.Fprintf(out, "批量抓取完成: %d/%d 个帖子成功\n", len(tids)-len(failed), len(tids))
+	if len(failed) > 0 {
+		return fmt.Errorf("%d 个帖子处理失败: %s", len(failed), strings.Join(failed, ", "))
+	}
 	return nil
 }
 
-func buildHTTPOptions(cfg *south2md.Config) *south2md.HTTPOptions {
-	return &south2md.HTTPOptions{
-		Timeout:          cfg.HTTPTimeout,
-		UserAgent:        cfg.HTTPUserAgent,
-		MaxRetries:       cfg.HTTPMaxRetries,
-		RetryDelay:       cfg.HTTPRetryDelay,
-		MaxConcurrent:    cfg.HTTPMaxConcurrent,
-		StrictPagination: cfg.HTTPStrictPagination,
-		CookieFile:       cfg.HTTPCookieFile,
-		EnableCookie:     cfg.HTTPEnableCookie,
-		CustomHeaders:    cfg.HTTPCustomHeaders,
+// archiveFunc fetches thread tid, from the forum at baseURL when it is set,
+// into the store. Progress lines go to out and request counts to metrics. It
+// returns the changes against the thread stored before, or nil for a new
+// thread.
+type archiveFunc func(ctx context.Context, tid, baseURL string, metrics *south2md.Metrics, out io.Writer) (*south2md.PostDiff, error)
+
+// newThreadArchiver returns an archiveFunc running the pipeline of a normal
+// run without the export. Jobs share client, saver so archive.org saves stay
+// spaced across concurrent jobs, one asset registry so concurrent jobs don't
+// overwrite each other's records, and one maintenance back-off, so a
+// maintenance window pauses every job and is logged once.
+func newThreadArchiver(cfg *south2md.Config, store *south2md.PostStore, client south2md.HTTPDoer, options *south2md.HTTPOptions, saver *south2md.WaybackSaver) archiveFunc {
+	registry, err := south2md.LoadAssetRegistry(store.RootDir())
+	if err != nil {
+		slog.Warn("Failed to load asset registry, images will not be shared between threads", "error", err)
+	}
+	backoff := newMaintenanceBackoff(nil)
+	return func(ctx context.Context, tid, baseURL string, metrics *south2md.Metrics, out io.Writer) (*south2md.PostDiff, error) {
+		jobCfg := *cfg
+		jobCfg.TID = tid
+		jobCfg.OutputFile = ""
+		if baseURL != "" {
+			jobCfg.BaseURL = baseURL
+		}
+
+		fetcher := south2md.NewFetcher(client, options, jobCfg.BaseURL)
+		fetcher.SetMetrics(metrics)
+		if cfg.SaveHTML || cfg.SaveHTMLGzip {
+			fetcher.SetRawPageHandler(func(tid string, page int, html string) {
+				if err := store.SaveRawPage(tid, page, html, cfg.SaveHTMLGzip); err != nil {
+					slog.Warn("Failed to save raw HTML page", "tid", tid, "page", page, "error", err)
+				}
+			})
+		}
+		parser, err := newPostParser(&jobCfg)
+		if err != nil {
+			return nil, err
+		}
+		generator, err := newMarkdownGenerator(&jobCfg)
+		if err != nil {
+			return nil, err
+		}
+		generator.SetHTTPDoer(fetcher.HTTPDoer())
+		generator.SetMetrics(metrics)
+		attachAttachmentFetcher(generator, fetcher, &jobCfg)
+		if registry != nil {
+			generator.SetAssetRegistry(registry)
+		}
+
+		pipeline := newArchivePipeline(&jobCfg, store, generator, backoff.stage(fetchStage(&jobCfg, fetcher, parser, store)), out)
+		addWaybackSave(pipeline, fetcher, saver)
+		return runArchivePipeline(ctx, &jobCfg, store, pipeline, &south2md.PipelineState{TID: tid})
 	}
 }
 
-func newMarkdownGenerator(cfg *south2md.Config) *south2md.MarkdownGenerator {
-	var gofileHandler *south2md.GofileHandler
-	if cfg.GofileEnable {
-		gofileHandler = south2md.NewGofileHandler(cfg)
+// metricsProgress returns the pages fetched, images downloaded and bytes
+// received so far as recorded in metrics.
+func metricsProgress(metrics *south2md.Metrics) (pages, images int, bytes int64) {
+	if metrics == nil {
+		return 0, 0, 0
 	}
-	return south2md.NewMarkdownGenerator(&south2md.MarkdownOptions{
-		IncludeAuthorInfo: cfg.MarkdownIncludeAuthorInfo,
-		IncludeImages:     cfg.MarkdownIncludeImages,
-		ImageStyle:        cfg.MarkdownImageStyle,
-		TableOfContents:   cfg.MarkdownTableOfContents,
-		IncludeTOC:        cfg.MarkdownIncludeTOC,
-		FloorNumbering:    cfg.MarkdownFloorNumbering,
-	}, gofileHandler)
+	var received float64
+	for _, component := range []string{south2md.MetricsComponentFetcher, south2md.MetricsComponentImage, south2md.MetricsComponentGofile} {
+		received += metrics.Counter(south2md.MetricBytesTotal, "component", component)
+	}
+	return int(metrics.Counter(south2md.MetricRequestsTotal, "component", south2md.MetricsComponentFetcher)),
+		int(metrics.Counter(south2md.MetricRequestsTotal, "component", south2md.MetricsComponentImage)),
+		int64(received)
 }
 
-func resolveExportDir(output string) string {
-	if output == "" {
-		return ""
+// withHistory records every job archive runs as a run of command.
+func withHistory(store *south2md.PostStore, command string, archive archiveFunc) archiveFunc {
+	return func(ctx context.Context, tid, baseURL string, metrics *south2md.Metrics, out io.Writer) (*south2md.PostDiff, error) {
+		started := time.Now()
+		diff, err := archive(ctx, tid, baseURL, metrics, out)
+		recordRun(store, command, []string{tid}, started, metrics, "", err)
+		return diff, err
 	}
-	if strings.EqualFold(filepath.Ext(output), ".md") {
-		return filepath.Dir(output)
+}
+
+// recordRun appends a run of command over tids that began at started to the
+// store's history, with the request counts of metrics (which may be nil).
+func recordRun(store *south2md.PostStore, command string, tids []string, started time.Time, metrics *south2md.Metrics, output string, err error) {
+	rec := south2md.RunRecord{
+		Command:   command,
+		TIDs:      tids,
+		StartedAt: started,
+		Duration:  time.Since(started).Round(time.Millisecond),
+		Output:    output,
+	}
+	rec.Pages, rec.Images, rec.Bytes = metricsProgress(metrics)
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if err := store.AppendRun(rec); err != nil {
+		slog.Warn("Failed to record run history", "error", err)
 	}
-	return output
 }
 
-// runCookieImport 运行 cookie 导入命令
-func runCookieImport(cmd *cobra.Command, args []string) error {
-	south2md.InitLogger(flagDebug)
+// lineWriter passes each complete line written to it to send.
+type lineWriter struct {
+	send func(line string)
+	buf  []byte
+}
 
-	if flagCookieImportFile == "" {
-		return fmt.Errorf("missing required flag: --file")
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if line := strings.TrimSpace(string(w.buf[:i])); line != "" {
+			w.send(line)
+		}
+		w.buf = w.buf[i+1:]
 	}
+}
 
-	destPath := south2md.DefaultCookieFile("south2md")
-	destDir := filepath.Dir(destPath)
-	if err := os.MkdirAll(destDir, 0755); err != nil {
-		return fmt.Errorf("failed to create cookie cache directory: %v", err)
+// openPostStore returns the local post store in the user data dir.
+func openPostStore(cfg *south2md.Config) *south2md.PostStore {
+	store := south2md.NewPostStore(filepath.Join(south2md.DefaultDataDir("south2md"), "posts"))
+	store.SetLockWait(cfg.StoreLockWait)
+	store.SetDirTemplate(cfg.StoreDirTemplate)
+	return store
+}
+
+// attachAssetRegistry shares the store's asset registry with generator so
+// images already downloaded by other threads are reused.
+func attachAssetRegistry(generator *south2md.MarkdownGenerator, store *south2md.PostStore) {
+	if registry, err := south2md.LoadAssetRegistry(store.RootDir()); err != nil {
+		slog.Warn("Failed to load asset registry, images will not be shared between threads", "error", err)
+	} else {
+		generator.SetAssetRegistry(registry)
 	}
+}
 
-	cm := south2md.NewCookieManager()
-	if err := cm.LoadFromFile(flagCookieImportFile); err != nil {
-		return fmt.Errorf("failed to load cookie file: %v", err)
+// attachAttachmentFetcher downloads floor attachments through fetcher's forum
+// session when cache_files is enabled, and author profiles when
+// author_profiles is.
+func attachAttachmentFetcher(generator *south2md.MarkdownGenerator, fetcher *south2md.Fetcher, cfg *south2md.Config) {
+	if cfg.CacheCacheFiles {
+		generator.SetAttachmentFetcher(fetcher, cfg.CacheMaxFileSize)
 	}
-	if err := cm.SaveToFile(destPath); err != nil {
-		return fmt.Errorf("failed to save cookie file: %v", err)
+	if cfg.CacheAuthorProfiles {
+		generator.SetProfileFetcher(fetcher)
 	}
+}
 
-	fmt.Printf("Cookie file cached at %s\n", destPath)
+// printPendingNotice tells the user about downloads queued for retry.
+func printPendingNotice(out io.Writer, store *south2md.PostStore, tid string) {
+	pending, err := store.LoadPending(tid)
+	if err != nil {
+		slog.Warn("Failed to read retry queue", "tid", tid, "error", err)
+		return
+	}
+	if pending.Len() == 0 {
+		return
+	}
+	fmt.Fprintf(out, "⚠ %d 个资源下载失败，已记录到 %s，可运行 south2md retry %s 重试\n",
+		pending.Len(), filepath.Join(store.PostDir(tid), south2md.PendingFileName), tid)
+}
+
+// printMissingPagesNotice tells the user about pages skipped by a non-strict
+// fetch; they stay listed in the thread's metadata.
+func printMissingPagesNotice(out io.Writer, store *south2md.PostStore, post *south2md.Post) {
+	if len(post.MissingPages) == 0 {
+		return
+	}
+	pages := make([]string, len(post.MissingPages))
+	for i, page := range post.MissingPages {
+		pages[i] = strconv.Itoa(page)
+	}
+	fmt.Fprintf(out, "⚠ 第 %s 页抓取失败已跳过，已记录到 %s 的 missing_pages，帖子不完整\n",
+		strings.Join(pages, ", "), filepath.Join(store.PostDir(post.TID), "metadata.toml"))
+}
+
+// startHARRecording records the exchanges of the clients built from options
+// until the returned function writes them to path. An empty path records
+// nothing.
+func startHARRecording(path string, options *south2md.HTTPOptions) func() {
+	if path == "" {
+		return func() {}
+	}
+	options.HAR = south2md.NewHARRecorder(0)
+	return func() {
+		if err := options.HAR.WriteFile(path); err != nil {
+			slog.Warn("Failed to write HAR file", "path", path, "error", err)
+			return
+		}
+		slog.Info("Recorded HTTP exchanges", "path", path, "requests", options.HAR.Len())
+	}
+}
+
+// startMetricsServer serves metrics on addr at /metrics until the returned
+// stop function is called. An empty addr serves nothing.
+func startMetricsServer(addr string, metrics *south2md.Metrics) (func(), error) {
+	if addr == "" {
+		return func() {}, nil
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("启动 metrics 服务失败: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("Metrics server stopped", "error", err)
+		}
+	}()
+	slog.Info("Serving metrics", "addr", listener.Addr().String())
+	return func() { _ = server.Close() }, nil
+}
+
+// exportStage exports the stored post to cfg.OutputFile and reports it to
+// out; it does nothing when no export target is set.
+func exportStage(cfg *south2md.Config, store *south2md.PostStore, generator *south2md.MarkdownGenerator, out io.Writer) south2md.Stage {
+	return south2md.NewStage(south2md.StageExport, func(ctx context.Context, state *south2md.PipelineState) error {
+		if cfg.OutputFile == "" {
+			return nil
+		}
+		exportedDir, err := exportPost(cfg, store, generator, state.Post)
+		if err != nil {
+			return fmt.Errorf("导出帖子失败: %v", err)
+		}
+		state.Output = exportedDir
+		fmt.Fprintf(out, "✓ 帖子已导出到 %s\n", exportedDir)
+		return nil
+	})
+}
+
+// slowRequestTimeout is the least timeout of clients for APIs that answer
+// slowly: Telegram long polling and translation backends.
+const slowRequestTimeout = 2 * time.Minute
+
+// slowRequestClient returns a client routed like options, through the same
+// proxies, NO_PROXY list and host limits, whose timeout is at least
+// slowRequestTimeout.
+func slowRequestClient(options *south2md.HTTPOptions) *http.Client {
+	slow := *options
+	if slow.Timeout > 0 && slow.Timeout < slowRequestTimeout {
+		slow.Timeout = slowRequestTimeout
+	}
+	return south2md.NewHTTPClient(&slow)
+}
+
+func newPostParser(cfg *south2md.Config) (*south2md.PostParser, error) {
+	profile, err := south2md.ResolveSelectorProfile(cfg.SelectorProfile, cfg.Selectors)
+	if err != nil {
+		return nil, err
+	}
+	parser := south2md.NewPostParser()
+	parser.SetSelectorProfile(profile)
+	return parser, nil
+}
+
+func newMarkdownGenerator(cfg *south2md.Config) (*south2md.MarkdownGenerator, error) {
+	var tmpl *south2md.MarkdownTemplate
+	if cfg.MarkdownTemplateFile != "" {
+		var err error
+		tmpl, err = south2md.LoadMarkdownTemplate(cfg.MarkdownTemplateFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载Markdown模板失败: %v", err)
+		}
+	}
+
+	var gofileHandler *south2md.GofileHandler
+	if cfg.GofileEnable {
+		gofileHandler = south2md.NewGofileHandler(cfg)
+		if cfg.GofileSelect {
+			if !stdinIsTerminal() {
+				return nil, fmt.Errorf("--gofile-select 需要在交互式终端中运行")
+			}
+			gofileHandler.SetFileSelector(newGofilePrompt(os.Stdin, os.Stdout))
+		}
+	}
+	generator := south2md.NewMarkdownGenerator(&south2md.MarkdownOptions{
+		IncludeAuthorInfo:    cfg.MarkdownIncludeAuthorInfo,
+		IncludeImages:        cfg.MarkdownIncludeImages,
+		ImageStyle:           cfg.MarkdownImageStyle,
+		LineBreaks:           cfg.MarkdownLineBreaks,
+		TableOfContents:      cfg.MarkdownTableOfContents,
+		IncludeTOC:           cfg.MarkdownIncludeTOC,
+		FloorNumbering:       cfg.MarkdownFloorNumbering,
+		TOCDepth:             cfg.MarkdownTOCDepth,
+		TOCMaxEntries:        cfg.MarkdownTOCMaxEntries,
+		TOCPageSize:          cfg.MarkdownTOCPageSize,
+		SplitEvery:           cfg.MarkdownSplitEvery,
+		PopularReplies:       cfg.MarkdownPopularReplies,
+		PopularStrategy:      cfg.MarkdownPopularStrategy,
+		QuoteDedupeThreshold: cfg.MarkdownQuoteDedupe,
+		FrontMatter:          cfg.MarkdownFrontMatter,
+		AuthorStats:          cfg.MarkdownAuthorStats,
+		Reproducible:         cfg.MarkdownReproducible,
+		Threaded:             cfg.MarkdownThreaded,
+		MentionIndex:         cfg.MarkdownMentionIndex,
+		Template:             tmpl,
+	}, gofileHandler)
+	generator.SetWaybackFallback(cfg.CacheWayback)
+	generator.SetAvatars(cfg.CacheAvatars)
+	generator.SetDownloadLimits(cfg.CacheMaxFileSize, south2md.NewDownloadGuard(cfg.StoreMaxThreadSize, cfg.StoreMinFreeSpace))
+	if cfg.ImageClassifier != "" {
+		generator.SetImageClassifier(south2md.CommandImageClassifier(cfg.ImageClassifier), cfg.ImageQuarantine)
+	}
+	if err := generator.SetImageSkipRules(imageSkipRules(cfg)); err != nil {
+		return nil, err
+	}
+	return generator, nil
+}
+
+// imageSkipRules returns the image skip rules configured in cfg.
+func imageSkipRules(cfg *south2md.Config) south2md.ImageSkipRules {
+	return south2md.ImageSkipRules{
+		Skip:      cfg.ImageSkip,
+		Keep:      cfg.ImageKeep,
+		MinWidth:  cfg.ImageMinWidth,
+		MinHeight: cfg.ImageMinHeight,
+		MinBytes:  cfg.ImageMinBytes,
+		MinPixels: cfg.ImageMinPixels,
+		SmallDir:  cfg.ImageSmallDir,
+	}
+}
+
+// exportPost exports post in cfg.OutputFormat to cfg.OutputFile, which is
+// either a local directory or a WebDAV URL. It returns the location of the
+// exported artifact.
+func exportPost(cfg *south2md.Config, store *south2md.PostStore, generator *south2md.MarkdownGenerator, post *south2md.Post) (string, error) {
+	if !south2md.IsWebDAVTarget(cfg.OutputFile) {
+		return exportPostTo(cfg, store, generator, post, resolveExportDir(cfg.OutputFile))
+	}
+
+	exporter, err := south2md.NewWebDAVExporter(cfg.OutputFile, cfg)
+	if err != nil {
+		return "", err
+	}
+	exporter.SetHTTPDoer(south2md.NewHTTPClient(south2md.HTTPOptionsFromConfig(cfg)))
+	stagingDir, err := os.MkdirTemp("", "south2md-webdav-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging dir: %v", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	staged, err := exportPostTo(cfg, store, generator, post, stagingDir)
+	if err != nil {
+		return "", err
+	}
+	if err := exporter.UploadDir(stagingDir, ""); err != nil {
+		return "", fmt.Errorf("上传到WebDAV失败: %v", err)
+	}
+	rel, err := filepath.Rel(stagingDir, staged)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve staged path: %v", err)
+	}
+	return exporter.RemoteURL(filepath.ToSlash(rel)), nil
+}
+
+// exportPostTo writes post in cfg.OutputFormat under the local exportDir and
+// returns the exported post directory or file.
+func exportPostTo(cfg *south2md.Config, store *south2md.PostStore, generator *south2md.MarkdownGenerator, post *south2md.Post, exportDir string) (string, error) {
+	switch cfg.OutputFormat {
+	case south2md.ExportFormatLogseq:
+		return generator.ExportLogseq(post, store.RootDir(), exportDir)
+	case south2md.ExportFormatJoplin:
+		return generator.ExportJoplin(post, store.RootDir(), exportDir)
+	case south2md.ExportFormatHugo:
+		return generator.ExportHugo(post, store.RootDir(), exportDir, cfg.HugoSection)
+	case south2md.ExportFormatPDF:
+		return generator.ExportPDF(post, store.RootDir(), exportDir, cfg.PDFChromePath)
+	default:
+		exportedDir, err := store.ExportPost(post.TID, exportDir)
+		if err != nil {
+			return "", err
+		}
+		if err := generator.ExportPost(post, exportDir); err != nil {
+			return "", fmt.Errorf("导出Markdown失败: %v", err)
+		}
+		return exportedDir, nil
+	}
+}
+
+func resolveExportDir(output string) string {
+	if output == "" {
+		return ""
+	}
+	if strings.EqualFold(filepath.Ext(output), ".md") {
+		return filepath.Dir(output)
+	}
+	return output
+}
+
+// runCookieImport 运行 cookie 导入命令
+func runCookieImport(cmd *cobra.Command, args []string) error {
+	if err := initLogger(flagDebug, nil); err != nil {
+		return err
+	}
+
+	if flagCookieImportFile == "" && flagCookieImportCurl == "" && flagCookieImportCurlFile == "" {
+		return fmt.Errorf("missing required flag: --file, --curl or --curl-file")
+	}
+
+	destPath := south2md.DefaultCookieFile("south2md")
+	destDir := filepath.Dir(destPath)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("failed to create cookie cache directory: %v", err)
+	}
+
+	cm := south2md.NewCookieManager()
+	switch {
+	case flagCookieImportFile != "":
+		if err := cm.LoadFromFile(flagCookieImportFile); err != nil {
+			return fmt.Errorf("failed to load cookie file: %v", err)
+		}
+	default:
+		command := flagCookieImportCurl
+		if flagCookieImportCurlFile != "" {
+			data, err := readFileOrStdin(cmd, flagCookieImportCurlFile)
+			if err != nil {
+				return fmt.Errorf("failed to read curl command: %v", err)
+			}
+			command = string(data)
+		}
+		if err := cm.LoadFromCurl(command); err != nil {
+			return fmt.Errorf("failed to parse curl command: %v", err)
+		}
+	}
+	// cf_clearance only works with the browser that minted it, so remember
+	// its User-Agent for later fetches.
+	if cmd.Flags().Changed("user-agent") {
+		cm.SetUserAgent(flagUserAgent)
+	}
+	if err := cm.SaveToFile(destPath); err != nil {
+		return fmt.Errorf("failed to save cookie file: %v", err)
+	}
+
+	fmt.Printf("Cookie file cached at %s\n", destPath)
+	if ua := cm.UserAgent(); ua != "" {
+		fmt.Printf("Recorded User-Agent: %s\n", ua)
+	} else {
+		fmt.Println("No User-Agent recorded; pass --user-agent with the browser's User-Agent if Cloudflare rejects the cookies")
+	}
+	return nil
+}
+
+// readFileOrStdin reads path, or the command's stdin when path is "-".
+func readFileOrStdin(cmd *cobra.Command, path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(cmd.InOrStdin())
+	}
+	return os.ReadFile(path)
+}
+
+// runSelectorsTest 运行选择器测试命令
+func runSelectorsTest(cmd *cobra.Command, args []string) error {
+	runtimeConfig, err := buildRuntimeConfig(cmd, args)
+	if err != nil {
+		return fmt.Errorf("初始化配置失败: %v", err)
+	}
+	if err := initLogger(runtimeConfig.Debug, runtimeConfig.App); err != nil {
+		return err
+	}
+	if runtimeConfig.InputFile == "" {
+		return fmt.Errorf("missing required flag: --input")
+	}
+
+	parser, err := newPostParser(runtimeConfig.App)
+	if err != nil {
+		return err
+	}
+	if err := parser.LoadFromFile(runtimeConfig.InputFile); err != nil {
+		return fmt.Errorf("加载HTML文件失败: %v", err)
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "selector profile: %s\n", runtimeConfig.App.SelectorProfile)
+	for _, match := range parser.TestSelectors() {
+		status := "ok"
+		if match.Count == 0 {
+			status = "NO MATCH"
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%-13s %5d  %-8s %s\n", match.Name, match.Count, status, match.Selector)
+	}
+	return nil
+}
+
+// runDebugParse 运行解析调试命令
+func runDebugParse(cmd *cobra.Command, args []string) error {
+	runtimeConfig, err := buildRuntimeConfig(cmd, args)
+	if err != nil {
+		return fmt.Errorf("初始化配置失败: %v", err)
+	}
+	if err := initLogger(runtimeConfig.Debug, runtimeConfig.App); err != nil {
+		return err
+	}
+	if runtimeConfig.InputFile == "" {
+		return fmt.Errorf("missing required flag: --input")
+	}
+	if flagDebugSelector == "" && !flagDebugExtract {
+		return fmt.Errorf("需要指定 --selector 或 --extract")
+	}
+
+	parser, err := newPostParser(runtimeConfig.App)
+	if err != nil {
+		return err
+	}
+	if err := parser.LoadFromFile(runtimeConfig.InputFile); err != nil {
+		return fmt.Errorf("加载HTML文件失败: %v", err)
+	}
+
+	out := cmd.OutOrStdout()
+	if flagDebugSelector != "" {
+		matches, err := parser.DebugSelect(flagDebugSelector)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%d match(es) for %s\n", len(matches), flagDebugSelector)
+		for i, match := range matches {
+			fmt.Fprintf(out, "\n--- match %d ---\n%s", i+1, match)
+		}
+	}
+
+	if flagDebugExtract {
+		post, err := parser.ExtractPost()
+		if err != nil {
+			return fmt.Errorf("提取帖子数据失败: %v", err)
+		}
+		data, err := toml.Marshal(post)
+		if err != nil {
+			return fmt.Errorf("生成TOML失败: %v", err)
+		}
+		if flagDebugSelector != "" {
+			fmt.Fprintln(out)
+		}
+		out.Write(data)
+	}
+	return nil
+}
+
+// runTagUpdate 返回添加(add=true)或删除标签的命令实现
+func runTagUpdate(add bool) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		runtimeConfig, err := buildRuntimeConfig(cmd, args[:1])
+		if err != nil {
+			return fmt.Errorf("初始化配置失败: %v", err)
+		}
+		if err := initLogger(runtimeConfig.Debug, runtimeConfig.App); err != nil {
+			return err
+		}
+
+		store := openPostStore(runtimeConfig.App)
+		var tags []string
+		if add {
+			tags, err = store.UpdateTags(runtimeConfig.App.TID, args[1:], nil)
+		} else {
+			tags, err = store.UpdateTags(runtimeConfig.App.TID, nil, args[1:])
+		}
+		if err != nil {
+			return fmt.Errorf("更新标签失败: %v", err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: %s\n", runtimeConfig.App.TID, strings.Join(tags, ", "))
+		return nil
+	}
+}
+
+// runTagList 运行列出标签命令
+func runTagList(cmd *cobra.Command, args []string) error {
+	runtimeConfig, err := buildRuntimeConfig(cmd, args)
+	if err != nil {
+		return fmt.Errorf("初始化配置失败: %v", err)
+	}
+	if err := initLogger(runtimeConfig.Debug, runtimeConfig.App); err != nil {
+		return err
+	}
+
+	store := openPostStore(runtimeConfig.App)
+	out := cmd.OutOrStdout()
+	if tid := runtimeConfig.App.TID; tid != "" {
+		post, err := store.LoadPostFromStore(tid)
+		if err != nil {
+			return fmt.Errorf("加载帖子失败: %v", err)
+		}
+		for _, tag := range post.Tags {
+			fmt.Fprintln(out, tag)
+		}
+		return nil
+	}
+
+	counts, err := store.TagCounts()
+	if err != nil {
+		return err
+	}
+	tags := make([]string, 0, len(counts))
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		fmt.Fprintf(out, "%-20s %d\n", tag, counts[tag])
+	}
+	return nil
+}
+
+// runList 运行列出本地库帖子命令
+func runList(cmd *cobra.Command, args []string) error {
+	runtimeConfig, err := buildRuntimeConfig(cmd, args)
+	if err != nil {
+		return fmt.Errorf("初始化配置失败: %v", err)
+	}
+	if err := initLogger(runtimeConfig.Debug, runtimeConfig.App); err != nil {
+		return err
+	}
+
+	posts, err := openPostStore(runtimeConfig.App).ListPosts(flagListTags...)
+	if err != nil {
+		return err
+	}
+	out := cmd.OutOrStdout()
+	for _, post := range posts {
+		if (flagListPrefix != "" && !post.HasPrefix(flagListPrefix)) || post.Views < flagListMinViews {
+			continue
+		}
+		line := fmt.Sprintf("%-10s %s", post.TID, post.Title)
+		if post.Views > 0 || post.ReplyCount > 0 {
+			line += fmt.Sprintf("  (%d 浏览 / %d 回复)", post.Views, post.ReplyCount)
+		}
+		if len(post.Tags) > 0 {
+			line += "  [" + strings.Join(post.Tags, ", ") + "]"
+		}
+		fmt.Fprintln(out, line)
+	}
+	return nil
+}
+
+// runDiff 运行帖子快照对比命令
+func runDiff(cmd *cobra.Command, args []string) error {
+	runtimeConfig, err := buildRuntimeConfig(cmd, args)
+	if err != nil {
+		return fmt.Errorf("初始化配置失败: %v", err)
+	}
+	cfg := runtimeConfig.App
+	if err := initLogger(runtimeConfig.Debug, runtimeConfig.App); err != nil {
+		return err
+	}
+
+	var oldPost, newPost *south2md.Post
+	if flagDiffOld != "" {
+		oldPost, err = south2md.LoadPostFile(flagDiffOld)
+	} else {
+		oldPost, err = openPostStore(cfg).LoadPostFromStore(cfg.TID)
+	}
+	if err != nil {
+		return fmt.Errorf("加载旧快照失败: %v", err)
+	}
+
+	if flagDiffNew != "" {
+		if newPost, err = south2md.LoadPostFile(flagDiffNew); err != nil {
+			return fmt.Errorf("加载新快照失败: %v", err)
+		}
+	} else {
+		httpOptions := south2md.HTTPOptionsFromConfig(cfg)
+		fetcher := south2md.NewFetcher(south2md.NewHTTPClient(httpOptions), httpOptions, cfg.BaseURL)
+		parser, err := newPostParser(cfg)
+		if err != nil {
+			return err
+		}
+		state := &south2md.PipelineState{TID: cfg.TID}
+		if err := south2md.NewPipeline(fetchStage(cfg, fetcher, parser, openPostStore(cfg))).Run(cmd.Context(), state); err != nil {
+			return err
+		}
+		newPost = state.Post
+	}
+
+	diff := south2md.DiffPosts(oldPost, newPost)
+	out := cmd.OutOrStdout()
+	if flagDiffJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	}
+	_, err = fmt.Fprint(out, diff.Markdown())
+	return err
+}
+
+// runStoreGC 运行本地库垃圾回收命令
+func runStoreGC(cmd *cobra.Command, args []string) error {
+	runtimeConfig, err := buildRuntimeConfig(cmd, args)
+	if err != nil {
+		return fmt.Errorf("初始化配置失败: %v", err)
+	}
+	if err := initLogger(runtimeConfig.Debug, runtimeConfig.App); err != nil {
+		return err
+	}
+
+	opts := south2md.GCOptions{
+		MaxAge:       time.Duration(flagGCMaxAgeDays) * 24 * time.Hour,
+		PruneOrphans: flagGCPruneOrphans,
+		DryRun:       flagGCDryRun,
+	}
+	if flagGCMaxAgeDays < 0 {
+		return fmt.Errorf("max-age-days 不能为负数")
+	}
+	if flagGCMaxSize != "" {
+		if opts.MaxSize, err = south2md.ParseByteSize(flagGCMaxSize); err != nil {
+			return fmt.Errorf("无效的 --max-size: %v", err)
+		}
+	}
+	if opts.MaxAge == 0 && opts.MaxSize == 0 && !opts.PruneOrphans {
+		return fmt.Errorf("需要指定 --max-age-days、--max-size 或 --prune-orphans")
+	}
+
+	store := openPostStore(runtimeConfig.App)
+	report, err := store.GC(opts)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	verb := "已删除"
+	if opts.DryRun {
+		verb = "将删除"
+	}
+	for _, action := range report.Actions {
+		fmt.Fprintf(out, "  - [%s] %s (%s)\n", action.Reason, action.Path, south2md.FormatByteSize(action.Size))
+	}
+	for _, tid := range report.Skipped {
+		fmt.Fprintf(out, "  - [skipped] %s 正在被其他进程写入\n", tid)
+	}
+	fmt.Fprintf(out, "%s %d 项，释放 %s，本地库剩余 %s\n", verb, len(report.Actions),
+		south2md.FormatByteSize(report.Freed), south2md.FormatByteSize(report.SizeAfter))
+	return nil
+}
+
+// runStoreDedupe 运行本地库重复资源命令
+func runStoreDedupe(cmd *cobra.Command, args []string) error {
+	runtimeConfig, err := buildRuntimeConfig(cmd, args)
+	if err != nil {
+		return fmt.Errorf("初始化配置失败: %v", err)
+	}
+	if err := initLogger(runtimeConfig.Debug, runtimeConfig.App); err != nil {
+		return err
+	}
+
+	store := openPostStore(runtimeConfig.App)
+	report, err := store.FindDuplicates()
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	for _, group := range report.Groups {
+		fmt.Fprintf(out, "%s  %s × %d (可节省 %s)\n", group.Digest[:12], south2md.FormatByteSize(group.Size),
+			len(group.Files), south2md.FormatByteSize(group.Savings))
+		for _, file := range group.Files {
+			fmt.Fprintf(out, "  - %s\n", file)
+		}
+	}
+	fmt.Fprintf(out, "扫描 %d 个文件，发现 %d 组重复，可节省 %s\n", report.Scanned, len(report.Groups),
+		south2md.FormatByteSize(report.Savings))
+
+	if flagDedupeLink && report.Savings > 0 {
+		linked, err := store.LinkDuplicates(report)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "✓ 已将 %d 个重复文件替换为硬链接\n", linked)
+	}
+	return nil
+}
+
+// runStoreVerify 运行本地库图片校验命令
+func runStoreVerify(cmd *cobra.Command, args []string) error {
+	runtimeConfig, err := buildRuntimeConfig(cmd, args)
+	if err != nil {
+		return fmt.Errorf("初始化配置失败: %v", err)
+	}
+	cfg := runtimeConfig.App
+	if err := initLogger(runtimeConfig.Debug, runtimeConfig.App); err != nil {
+		return err
+	}
+
+	store := openPostStore(cfg)
+	report, err := store.VerifyImages(args...)
+	if err != nil {
+		return fmt.Errorf("校验失败: %v", err)
+	}
+	out := cmd.OutOrStdout()
+	printImageMismatches(out, report.Mismatches)
+	fmt.Fprintf(out, "检查 %d 个文件，%d 个损坏\n", report.Checked, len(report.Mismatches))
+	if !flagVerifyRepair || len(report.Mismatches) == 0 {
+		return nil
+	}
+
+	generator, err := newRepairGenerator(cfg, store)
+	if err != nil {
+		return err
+	}
+	generator.SetVerifyChecksums(true)
+
+	var damaged []string
+	for _, mismatch := range report.Mismatches {
+		if len(damaged) == 0 || damaged[len(damaged)-1] != mismatch.TID {
+			damaged = append(damaged, mismatch.TID)
+		}
+	}
+	var remaining []south2md.ImageMismatch
+	for _, tid := range damaged {
+		broken, err := repairStoredImages(cmd.Context(), store, generator, tid)
+		if err != nil {
+			return err
+		}
+		remaining = append(remaining, broken...)
+	}
+	fmt.Fprintf(out, "✓ 已修复 %d 个文件，%d 个仍然损坏\n", len(report.Mismatches)-len(remaining), len(remaining))
+	printImageMismatches(out, remaining)
+	return nil
+}
+
+// runImagesRepair 运行图片修复命令
+func runImagesRepair(cmd *cobra.Command, args []string) error {
+	runtimeConfig, err := buildRuntimeConfig(cmd, args)
+	if err != nil {
+		return fmt.Errorf("初始化配置失败: %v", err)
+	}
+	cfg := runtimeConfig.App
+	if err := initLogger(runtimeConfig.Debug, runtimeConfig.App); err != nil {
+		return err
+	}
+
+	store := openPostStore(cfg)
+	post, err := store.LoadPostFromStore(cfg.TID)
+	if err != nil {
+		return fmt.Errorf("加载帖子失败: %v", err)
+	}
+	out := cmd.OutOrStdout()
+	broken := south2md.FindBrokenImages(store.PostDir(cfg.TID), post, false)
+	if len(broken) == 0 {
+		fmt.Fprintf(out, "✓ 帖子 %s 的图片完好\n", cfg.TID)
+		return nil
+	}
+	fmt.Fprintf(out, "正在重新下载 %d 个缺失或损坏的文件...\n", len(broken))
+
+	generator, err := newRepairGenerator(cfg, store)
+	if err != nil {
+		return err
+	}
+	remaining, err := repairStoredImages(cmd.Context(), store, generator, cfg.TID)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "✓ %d 个文件已修复，%d 个仍然缺失\n", len(broken)-len(remaining), len(remaining))
+	printImageMismatches(out, remaining)
+
+	if cfg.OutputFile != "" {
+		exportedDir, err := exportPost(cfg, store, generator, post)
+		if err != nil {
+			return fmt.Errorf("导出帖子失败: %v", err)
+		}
+		fmt.Printf("✓ 帖子已导出到 %s\n", exportedDir)
+	}
+	return nil
+}
+
+// newRepairGenerator builds a generator that downloads through the forum
+// session, for re-downloading the cached files of stored posts.
+func newRepairGenerator(cfg *south2md.Config, store *south2md.PostStore) (*south2md.MarkdownGenerator, error) {
+	httpOptions := south2md.HTTPOptionsFromConfig(cfg)
+	httpClient := south2md.NewFetcher(south2md.NewHTTPClient(httpOptions), httpOptions, cfg.BaseURL)
+	generator, err := newMarkdownGenerator(cfg)
+	if err != nil {
+		return nil, err
+	}
+	generator.SetHTTPDoer(httpClient.HTTPDoer())
+	attachAttachmentFetcher(generator, httpClient, cfg)
+	attachAssetRegistry(generator, store)
+	return generator, nil
+}
+
+// repairStoredImages re-downloads the broken cached files of stored thread
+// tid and returns those still broken.
+func repairStoredImages(ctx context.Context, store *south2md.PostStore, generator *south2md.MarkdownGenerator, tid string) ([]south2md.ImageMismatch, error) {
+	post, err := store.LoadPostFromStore(tid)
+	if err != nil {
+		return nil, fmt.Errorf("加载帖子 %s 失败: %v", tid, err)
+	}
+	var remaining []south2md.ImageMismatch
+	err = store.Transact(tid, func(stageRoot string) error {
+		remaining, err = generator.RepairImages(ctx, post, stageRoot)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("修复帖子 %s 失败: %v", tid, err)
+	}
+	return remaining, nil
+}
+
+// printImageMismatches lists damaged files, one per line.
+func printImageMismatches(out io.Writer, mismatches []south2md.ImageMismatch) {
+	for _, mismatch := range mismatches {
+		if mismatch.URL == "" {
+			fmt.Fprintf(out, "  - [%s] images/%s: %s\n", mismatch.TID, mismatch.Local, mismatch.Reason)
+			continue
+		}
+		fmt.Fprintf(out, "  - [%s] images/%s: %s (%s)\n", mismatch.TID, mismatch.Local, mismatch.Reason, mismatch.URL)
+	}
+}
+
+// runRetry 运行重试失败下载命令
+func runRetry(cmd *cobra.Command, args []string) (err error) {
+	runtimeConfig, err := buildRuntimeConfig(cmd, args)
+	if err != nil {
+		return fmt.Errorf("初始化配置失败: %v", err)
+	}
+	cfg := runtimeConfig.App
+	if err := initLogger(runtimeConfig.Debug, runtimeConfig.App); err != nil {
+		return err
+	}
+
+	store := openPostStore(cfg)
+	post, err := store.LoadPostFromStore(cfg.TID)
+	if err != nil {
+		return fmt.Errorf("加载帖子失败: %v", err)
+	}
+	started, metrics := time.Now(), south2md.NewMetrics()
+	var output string
+	defer func() { recordRun(store, "retry", []string{cfg.TID}, started, metrics, output, err) }()
+	pending, err := store.LoadPending(cfg.TID)
+	if err != nil {
+		return fmt.Errorf("读取重试队列失败: %v", err)
+	}
+	if pending.Len() == 0 {
+		fmt.Printf("✓ 帖子 %s 没有需要重试的下载\n", cfg.TID)
+		return nil
+	}
+	fmt.Printf("正在重试 %d 个失败的下载...\n", pending.Len())
+
+	httpOptions := south2md.HTTPOptionsFromConfig(cfg)
+	httpClient := south2md.NewFetcher(south2md.NewHTTPClient(httpOptions), httpOptions, cfg.BaseURL)
+	httpClient.SetMetrics(metrics)
+	generator, err := newMarkdownGenerator(cfg)
+	if err != nil {
+		return err
+	}
+	generator.SetHTTPDoer(httpClient.HTTPDoer())
+	generator.SetMetrics(metrics)
+	attachAttachmentFetcher(generator, httpClient, cfg)
+	attachAssetRegistry(generator, store)
+
+	var remaining *south2md.PendingQueue
+	err = store.Transact(cfg.TID, func(stageRoot string) error {
+		remaining, err = generator.RetryPending(cmd.Context(), post, stageRoot)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("重试下载失败: %v", err)
+	}
+	fmt.Printf("✓ %d 个下载已完成，%d 个仍然失败\n", pending.Len()-remaining.Len(), remaining.Len())
+	for _, item := range remaining.Items() {
+		fmt.Printf("  - [%s] %s: %s (已尝试 %d 次)\n", item.Kind, item.URL, item.Reason, item.Attempts)
+	}
+
+	if cfg.OutputFile != "" {
+		exportedDir, err := exportPost(cfg, store, generator, post)
+		if err != nil {
+			return fmt.Errorf("导出帖子失败: %v", err)
+		}
+		output = exportedDir
+		fmt.Printf("✓ 帖子已导出到 %s\n", exportedDir)
+	}
+	return nil
+}
+
+// runRegen 运行离线重新生成命令
+func runRegen(cmd *cobra.Command, args []string) (err error) {
+	runtimeConfig, err := buildRuntimeConfig(cmd, args)
+	if err != nil {
+		return fmt.Errorf("初始化配置失败: %v", err)
+	}
+	cfg := runtimeConfig.App
+	if err := initLogger(runtimeConfig.Debug, runtimeConfig.App); err != nil {
+		return err
+	}
+
+	store := openPostStore(cfg)
+	started := time.Now()
+	state := &south2md.PipelineState{TID: cfg.TID}
+	defer func() { recordRun(store, "regen", []string{cfg.TID}, started, nil, state.Output, err) }()
+	pages, err := store.LoadRawPages(cfg.TID)
+	if err != nil {
+		return fmt.Errorf("读取原始页面失败: %v", err)
+	}
+
+	parser, err := newPostParser(cfg)
+	if err != nil {
+		return err
+	}
+	generator, err := newMarkdownGenerator(cfg)
+	if err != nil {
+		return err
+	}
+	generator.SetDownloadEnabled(false)
+
+	state.Pages = pages
+	if len(pages) > 0 {
+		fmt.Printf("已从 %d 个原始页面重新提取帖子\n", len(pages))
+	} else {
+		post, err := store.LoadPostFromStore(cfg.TID)
+		if err != nil {
+			return fmt.Errorf("加载帖子失败: %v", err)
+		}
+		state.Post = post
+		fmt.Println("未找到原始页面，使用已存储的元数据重新生成")
+	}
+
+	pipeline := south2md.NewPipeline(
+		south2md.ExtractStage(parser),
+		south2md.StoreStage(generator, store),
+		south2md.NewStage("announce", func(ctx context.Context, state *south2md.PipelineState) error {
+			fmt.Printf("✓ 帖子已重新生成到 %s/\n", store.PostDir(state.Post.TID))
+			return nil
+		}),
+		exportStage(cfg, store, generator, os.Stdout),
+	)
+	addContentFilter(pipeline, cfg, south2md.StageExtract)
+	if err := pipeline.Run(cmd.Context(), state); err != nil {
+		return err
+	}
 	return nil
 }
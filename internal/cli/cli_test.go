@@ -1,11 +1,27 @@
 package cli
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"reflect"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/fdkevin0/south2md"
 	"github.com/spf13/pflag"
 )
@@ -18,26 +34,137 @@ func resetCLIStateForTest(t *testing.T) {
 	flagTID = ""
 	flagInputFile = ""
 	flagOutputFile = ""
+	flagFormat = south2md.ExportFormatMarkdown
+	flagHugoSection = defaultConfig.HugoSection
+	flagGitCommit = defaultConfig.GitCommit
 	flagOffline = false
 	flagCacheDir = defaultConfig.CacheDir
 	flagBaseURL = defaultConfig.BaseURL
+	flagSite = defaultConfig.Site
 	flagCookieFile = defaultConfig.HTTPCookieFile
 	flagNoCache = false
+	flagNoWayback = false
+	flagImageClassifier = defaultConfig.ImageClassifier
+	flagImageQuarantine = defaultConfig.ImageQuarantine
+	flagImageSkip = defaultConfig.ImageSkip
+	flagImageKeep = defaultConfig.ImageKeep
+	flagImageMinWidth = defaultConfig.ImageMinWidth
+	flagImageMinHeight = defaultConfig.ImageMinHeight
+	flagImageMinBytes = defaultConfig.ImageMinBytes
+	flagImageMinPixels = defaultConfig.ImageMinPixels
+	flagImageSmallDir = defaultConfig.ImageSmallDir
+	flagWaybackSave = defaultConfig.WaybackSave
+	flagCacheAvatars = defaultConfig.CacheAvatars
+	flagAuthorProfiles = defaultConfig.CacheAuthorProfiles
+	flagWaybackSaveInterval = defaultConfig.WaybackSaveInterval
+	flagTranslate = defaultConfig.TranslateBackend
+	flagTranslateTarget = defaultConfig.TranslateTarget
+	flagTranslateMode = defaultConfig.TranslateMode
+	flagTranslateEndpoint = defaultConfig.TranslateEndpoint
+	flagTranslateModel = defaultConfig.TranslateModel
 	flagTimeout = int(defaultConfig.HTTPTimeout.Seconds())
 	flagMaxConcurrent = defaultConfig.HTTPMaxConcurrent
+	flagMaxConcurrentAssets = defaultConfig.HTTPMaxConcurrentAssets
+	flagMaxConcurrentGofile = defaultConfig.HTTPMaxConcurrentGofile
+	flagPoliteness = defaultConfig.HTTPPoliteness
 	flagStrictPagination = defaultConfig.HTTPStrictPagination
+	flagStrictPages = defaultConfig.HTTPStrictPagination
+	flagThreadsParallel = defaultConfig.ThreadsParallel
+	flagStream = defaultConfig.StreamExtract
+	flagPagination = defaultConfig.HTTPPagination
+	flagFollowCookieUA = defaultConfig.HTTPFollowCookieUA
+	flagAllowGuest = defaultConfig.HTTPAllowGuest
 	flagDebug = false
 	flagUserAgent = defaultConfig.HTTPUserAgent
+	flagProxy = ""
+	flagNoProxy = ""
+	flagProxyPoolFile = ""
+	flagMirrors = nil
+	flagTLSFingerprint = defaultConfig.HTTPTLSFingerprint
+	flagProxyBanTime = defaultConfig.HTTPProxyBanTime
 	flagGofileEnable = defaultConfig.GofileEnable
 	flagGofileTool = defaultConfig.GofileTool
 	flagGofileDir = defaultConfig.GofileDir
 	flagGofileToken = defaultConfig.GofileToken
 	flagGofileVenvDir = defaultConfig.GofileVenvDir
 	flagGofileSkipExisting = defaultConfig.GofileSkipExisting
+	flagGofileCacheTTL = defaultConfig.GofileCacheTTL
+	flagGofileRateLimit = defaultConfig.GofileRateLimit
+	flagGofileMaxSize = defaultConfig.GofileMaxSize
+	flagGofileMaxFileSize = defaultConfig.GofileMaxFileSize
+	flagGofileInclude = defaultConfig.GofileInclude
+	flagGofileSelect = defaultConfig.GofileSelect
+	flagExternalAssetLimit = defaultConfig.PolicyExternalAssetLimit
+	flagMetricsAddr = ""
+	flagOTelEndpoint = ""
+	flagLockWait = defaultConfig.StoreLockWait
+	flagDirTemplate = defaultConfig.StoreDirTemplate
+	flagMaxThreadSize = defaultConfig.StoreMaxThreadSize
+	flagMinFreeSpace = defaultConfig.StoreMinFreeSpace
+	flagLogFile = ""
+	flagLogFormat = defaultConfig.LogFormat
+	flagLogMaxSize = defaultConfig.LogMaxSize
+	flagLogMaxBackups = defaultConfig.LogMaxBackups
+	flagRecordHAR = defaultConfig.RecordHAR
+	flagFixturesDir = defaultConfig.FixturesDir
+	flagJSONProgress = defaultConfig.JSONProgress
+	flagOnThreadArchived = defaultConfig.HookOnThreadArchived
+	flagOnUpdate = defaultConfig.HookOnUpdate
+	flagOnError = defaultConfig.HookOnError
+	flagDedupeQuotes = defaultConfig.MarkdownQuoteDedupe
+	flagChromePath = defaultConfig.PDFChromePath
+	flagTemplateFile = defaultConfig.MarkdownTemplateFile
+	flagFrontMatter = defaultConfig.MarkdownFrontMatter
+	flagAuthorStats = defaultConfig.MarkdownAuthorStats
+	flagReproducible = defaultConfig.MarkdownReproducible
+	flagThreaded = defaultConfig.MarkdownThreaded
+	flagMentionIndex = defaultConfig.MarkdownMentionIndex
+	flagTableOfContents = defaultConfig.MarkdownTableOfContents
+	flagTOCDepth = defaultConfig.MarkdownTOCDepth
+	flagTOCMaxEntries = defaultConfig.MarkdownTOCMaxEntries
+	flagTOCPageSize = defaultConfig.MarkdownTOCPageSize
+	flagSplitEvery = defaultConfig.MarkdownSplitEvery
+	flagPopularReplies = defaultConfig.MarkdownPopularReplies
+	flagPopularStrategy = defaultConfig.MarkdownPopularStrategy
+	flagImageStyle = defaultConfig.MarkdownImageStyle
+	flagLineBreaks = defaultConfig.MarkdownLineBreaks
+	flagSelectorProfile = defaultConfig.SelectorProfile
+	flagDebugSelector = ""
+	flagDebugExtract = false
+	flagSaveHTML = false
+	flagSaveHTMLGzip = false
 	flagCookieImportFile = ""
+	flagCookieImportCurl = ""
+	flagCookieImportCurlFile = ""
+	flagListTags = nil
+	flagListPrefix = ""
+	flagListMinViews = 0
+	flagGCMaxAgeDays = 0
+	flagGCMaxSize = ""
+	flagGCPruneOrphans = false
+	flagGCDryRun = false
+	flagDedupeLink = false
+	flagVerifyRepair = false
+	flagDiffOld = ""
+	flagDiffNew = ""
+	flagDiffJSON = false
+	flagAPIAddr = defaultConfig.APIAddr
+	flagAPIToken = ""
+	flagTelegramToken = ""
+	flagTelegramUsers = defaultConfig.TelegramUsers
+	flagHistoryLimit = 20
+	flagHistoryFailed = false
+	flagExportSinceFloor = 0
+	flagExportSinceDate = ""
+	exportCmd.Flags().VisitAll(func(f *pflag.Flag) { f.Changed = false })
 
 	rootCmd.PersistentFlags().VisitAll(func(f *pflag.Flag) {
 		f.Changed = false
+		// Set appends to slice flags, and their DefValue is rendered as "[]".
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			_ = slice.Replace(nil)
+			return
+		}
 		_ = f.Value.Set(f.DefValue)
 	})
 }
@@ -122,6 +249,54 @@ func TestBuildRuntimeConfigFlagOverridesEnv(t *testing.T) {
 	}
 }
 
+func TestBuildRuntimeConfigStrictPages(t *testing.T) {
+	resetCLIStateForTest(t)
+
+	cfg, err := buildRuntimeConfig(rootCmd, []string{"2636739"})
+	if err != nil {
+		t.Fatalf("buildRuntimeConfig returned error: %v", err)
+	}
+	if cfg.App.HTTPStrictPagination {
+		t.Fatal("expected non-strict pagination by default")
+	}
+
+	if err := rootCmd.PersistentFlags().Set("strict-pages", "true"); err != nil {
+		t.Fatalf("set strict-pages flag: %v", err)
+	}
+	cfg, err = buildRuntimeConfig(rootCmd, []string{"2636739"})
+	if err != nil {
+		t.Fatalf("buildRuntimeConfig returned error: %v", err)
+	}
+	if !cfg.App.HTTPStrictPagination {
+		t.Fatal("expected --strict-pages to enable strict pagination")
+	}
+}
+
+func TestBuildRuntimeConfigCollectsBatchTIDs(t *testing.T) {
+	resetCLIStateForTest(t)
+	if err := rootCmd.PersistentFlags().Set("threads-parallel", "3"); err != nil {
+		t.Fatalf("set threads-parallel flag: %v", err)
+	}
+
+	cfg, err := buildRuntimeConfig(rootCmd, []string{"2636739", " 2636740 ", ""})
+	if err != nil {
+		t.Fatalf("buildRuntimeConfig returned error: %v", err)
+	}
+	if strings.Join(cfg.TIDs, ",") != "2636739,2636740" || cfg.App.TID != "2636739" {
+		t.Fatalf("unexpected tids %q (tid %q)", cfg.TIDs, cfg.App.TID)
+	}
+	if cfg.App.ThreadsParallel != 3 {
+		t.Fatalf("expected 3 parallel threads, got %d", cfg.App.ThreadsParallel)
+	}
+
+	if err := rootCmd.PersistentFlags().Set("offline", "true"); err != nil {
+		t.Fatalf("set offline flag: %v", err)
+	}
+	if _, err := buildRuntimeConfig(rootCmd, []string{"2636739", "2636740"}); err == nil {
+		t.Fatal("expected a batch to be rejected with --offline")
+	}
+}
+
 func TestBuildRuntimeConfigRejectsOfflineWithInput(t *testing.T) {
 	resetCLIStateForTest(t)
 	if err := rootCmd.PersistentFlags().Set("offline", "true"); err != nil {
@@ -155,3 +330,1030 @@ func TestBuildRuntimeConfigMissingExplicitConfigFile(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestBuildRuntimeConfigReadsEnvOnlyWebDAVCredentials(t *testing.T) {
+	resetCLIStateForTest(t)
+	t.Setenv("SOUTH2MD_WEBDAV_USERNAME", "alice")
+	t.Setenv("SOUTH2MD_WEBDAV_PASSWORD", "secret")
+
+	cfg, err := buildRuntimeConfig(rootCmd, []string{"2636739"})
+	if err != nil {
+		t.Fatalf("buildRuntimeConfig returned error: %v", err)
+	}
+
+	if cfg.App.WebDAVUsername != "alice" || cfg.App.WebDAVPassword != "secret" {
+		t.Fatalf("expected env webdav credentials, got %q/%q", cfg.App.WebDAVUsername, cfg.App.WebDAVPassword)
+	}
+}
+
+func TestBuildRuntimeConfigRejectsUnknownFormat(t *testing.T) {
+	resetCLIStateForTest(t)
+	if err := rootCmd.PersistentFlags().Set("format", "obsidian"); err != nil {
+		t.Fatalf("set format flag: %v", err)
+	}
+
+	_, err := buildRuntimeConfig(rootCmd, []string{"2636739"})
+	if err == nil {
+		t.Fatal("expected unsupported format error")
+	}
+	if !strings.Contains(err.Error(), "不支持的导出格式") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBuildRuntimeConfigRejectsUnknownLogFormat(t *testing.T) {
+	resetCLIStateForTest(t)
+	if err := rootCmd.PersistentFlags().Set("log-format", "xml"); err != nil {
+		t.Fatalf("set log-format flag: %v", err)
+	}
+
+	_, err := buildRuntimeConfig(rootCmd, []string{"2636739"})
+	if err == nil || !strings.Contains(err.Error(), "不支持的日志格式") {
+		t.Fatalf("expected unsupported log format error, got %v", err)
+	}
+}
+
+func TestRotatingFileKeepsBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "south2md.log")
+	file, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("openRotatingFile returned error: %v", err)
+	}
+	defer file.Close()
+
+	for _, line := range []string{"first-01\n", "second-2\n", "third-03\n", "fourth-4\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	for path, want := range map[string]string{
+		path:        "fourth-4\n",
+		path + ".1": "third-03\n",
+		path + ".2": "second-2\n",
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		if string(data) != want {
+			t.Fatalf("%s = %q, want %q", path, data, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected only 2 backups, stat .3: %v", err)
+	}
+}
+
+func TestInitLoggerWritesJSONToFile(t *testing.T) {
+	cfg := south2mdDefaultConfigForTest()
+	cfg.LogFile = filepath.Join(t.TempDir(), "south2md.log")
+	cfg.LogFormat = logFormatJSON
+	if err := initLogger(false, cfg); err != nil {
+		t.Fatalf("initLogger returned error: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = initLogger(false, nil)
+		closeLogOutput()
+	})
+
+	slog.Warn("Fetch failed", "tid", "2636739")
+
+	data, err := os.ReadFile(cfg.LogFile)
+	if err != nil {
+		t.Fatalf("read log file: %v", err)
+	}
+	var record map[string]any
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatalf("log line is not JSON: %v (%q)", err, data)
+	}
+	if record["msg"] != "Fetch failed" || record["tid"] != "2636739" || record["level"] != "WARN" {
+		t.Fatalf("unexpected log record: %v", record)
+	}
+}
+
+func TestBuildRuntimeConfigGofileInclude(t *testing.T) {
+	resetCLIStateForTest(t)
+
+	for _, pattern := range []string{"*.zip", "*.7z"} {
+		if err := rootCmd.PersistentFlags().Set("gofile-include", pattern); err != nil {
+			t.Fatalf("set gofile-include flag: %v", err)
+		}
+	}
+	cfg, err := buildRuntimeConfig(rootCmd, []string{"2636739"})
+	if err != nil {
+		t.Fatalf("buildRuntimeConfig returned error: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.App.GofileInclude, []string{"*.zip", "*.7z"}) {
+		t.Fatalf("unexpected gofile include patterns: %q", cfg.App.GofileInclude)
+	}
+
+	resetCLIStateForTest(t)
+	if err := rootCmd.PersistentFlags().Set("gofile-include", "[a-"); err != nil {
+		t.Fatalf("set gofile-include flag: %v", err)
+	}
+	if _, err := buildRuntimeConfig(rootCmd, []string{"2636739"}); err == nil {
+		t.Fatal("expected a malformed gofile-include pattern to be rejected")
+	}
+}
+
+func TestBuildRuntimeConfigImageQuarantine(t *testing.T) {
+	resetCLIStateForTest(t)
+
+	if err := rootCmd.PersistentFlags().Set("image-quarantine", " NSFW "); err != nil {
+		t.Fatalf("set image-quarantine flag: %v", err)
+	}
+	if _, err := buildRuntimeConfig(rootCmd, []string{"2636739"}); err == nil {
+		t.Fatal("expected --image-quarantine without a classifier to be rejected")
+	}
+
+	if err := rootCmd.PersistentFlags().Set("image-classifier", "nsfw-check --threshold 0.8"); err != nil {
+		t.Fatalf("set image-classifier flag: %v", err)
+	}
+	cfg, err := buildRuntimeConfig(rootCmd, []string{"2636739"})
+	if err != nil {
+		t.Fatalf("buildRuntimeConfig returned error: %v", err)
+	}
+	if cfg.App.ImageClassifier != "nsfw-check --threshold 0.8" || !reflect.DeepEqual(cfg.App.ImageQuarantine, []string{"nsfw"}) {
+		t.Fatalf("unexpected image classification config: %q %q", cfg.App.ImageClassifier, cfg.App.ImageQuarantine)
+	}
+}
+
+func TestBuildRuntimeConfigImageSkipRules(t *testing.T) {
+	resetCLIStateForTest(t)
+
+	for _, pattern := range []string{`/smile/`, `badge_\d{1,3}\.gif`} {
+		if err := rootCmd.PersistentFlags().Set("image-skip", pattern); err != nil {
+			t.Fatalf("set image-skip flag: %v", err)
+		}
+	}
+	if err := rootCmd.PersistentFlags().Set("image-min-width", "32"); err != nil {
+		t.Fatalf("set image-min-width flag: %v", err)
+	}
+	cfg, err := buildRuntimeConfig(rootCmd, []string{"2636739"})
+	if err != nil {
+		t.Fatalf("buildRuntimeConfig returned error: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.App.ImageSkip, []string{`/smile/`, `badge_\d{1,3}\.gif`}) || cfg.App.ImageMinWidth != 32 {
+		t.Fatalf("unexpected image skip config: %q %d", cfg.App.ImageSkip, cfg.App.ImageMinWidth)
+	}
+
+	if err := rootCmd.PersistentFlags().Set("image-keep", "(unclosed"); err != nil {
+		t.Fatalf("set image-keep flag: %v", err)
+	}
+	if _, err := buildRuntimeConfig(rootCmd, []string{"2636739"}); err == nil {
+		t.Fatal("expected a malformed image-keep regex to be rejected")
+	}
+}
+
+func TestBuildRuntimeConfigDownloadLimits(t *testing.T) {
+	resetCLIStateForTest(t)
+
+	if err := rootCmd.PersistentFlags().Set("min-free-space", "-1"); err != nil {
+		t.Fatalf("set min-free-space flag: %v", err)
+	}
+	if _, err := buildRuntimeConfig(rootCmd, []string{"2636739"}); err == nil {
+		t.Fatal("expected a negative --min-free-space to be rejected")
+	}
+
+	for name, value := range map[string]string{"min-free-space": "1073741824", "max-thread-size": "5368709120", "gofile-max-file-size": "104857600"} {
+		if err := rootCmd.PersistentFlags().Set(name, value); err != nil {
+			t.Fatalf("set %s flag: %v", name, err)
+		}
+	}
+	cfg, err := buildRuntimeConfig(rootCmd, []string{"2636739"})
+	if err != nil {
+		t.Fatalf("buildRuntimeConfig returned error: %v", err)
+	}
+	if cfg.App.StoreMinFreeSpace != 1<<30 || cfg.App.StoreMaxThreadSize != 5<<30 || cfg.App.GofileMaxFileSize != 100<<20 {
+		t.Fatalf("unexpected download limits: %+v", cfg.App)
+	}
+}
+
+func TestBuildRuntimeConfigReadsFilterRules(t *testing.T) {
+	resetCLIStateForTest(t)
+
+	configPath := filepath.Join(t.TempDir(), "south2md.toml")
+	content := strings.Join([]string{
+		"[[filters]]",
+		"kind = \"css\"",
+		"selector = \".ad\"",
+		"",
+		"[[filters]]",
+		"kind = \"user\"",
+		"user = \"alice\"",
+	}, "\n")
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	t.Setenv("SOUTH2MD_CONFIG", configPath)
+
+	cfg, err := buildRuntimeConfig(rootCmd, []string{"2636739"})
+	if err != nil {
+		t.Fatalf("buildRuntimeConfig returned error: %v", err)
+	}
+	if len(cfg.App.Filters) != 2 || cfg.App.Filters[0].Selector != ".ad" || cfg.App.Filters[1].User != "alice" {
+		t.Fatalf("unexpected filter rules: %+v", cfg.App.Filters)
+	}
+
+	if err := os.WriteFile(configPath, []byte("[[filters]]\nkind = \"bogus\"\n"), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	if _, err := buildRuntimeConfig(rootCmd, []string{"2636739"}); err == nil {
+		t.Fatal("expected an unknown filter kind to be rejected")
+	}
+}
+
+func TestParseGofileSelection(t *testing.T) {
+	cases := map[string][]int{
+		"":          {0, 1, 2, 3},
+		"all":       {0, 1, 2, 3},
+		"none":      nil,
+		"1,3-4":     {0, 2, 3},
+		" 2 , 2-3 ": {1, 2},
+	}
+	for input, want := range cases {
+		got, err := parseGofileSelection(input, 4)
+		if err != nil {
+			t.Fatalf("parseGofileSelection(%q) returned error: %v", input, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("parseGofileSelection(%q) = %v, want %v", input, got, want)
+		}
+	}
+	for _, input := range []string{"0", "5", "3-1", "x"} {
+		if _, err := parseGofileSelection(input, 4); err == nil {
+			t.Fatalf("expected parseGofileSelection(%q) to fail", input)
+		}
+	}
+}
+
+func TestBuildRuntimeConfigAppliesSites(t *testing.T) {
+	resetCLIStateForTest(t)
+
+	configPath := filepath.Join(t.TempDir(), "south2md.toml")
+	content := strings.Join([]string{
+		"user_agent = \"top-level\"",
+		"",
+		"[sites.south]",
+		"base_url = \"https://south-plus.net/\"",
+		"cookie_file = \"south.txt\"",
+		"",
+		"[sites.north]",
+		"base_url = \"https://north-plus.net/\"",
+		"cookie_file = \"north.txt\"",
+		"user_agent = \"north-ua\"",
+	}, "\n")
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	t.Setenv("SOUTH2MD_CONFIG", configPath)
+
+	cfg, err := buildRuntimeConfig(rootCmd, []string{"https://www.north-plus.net/read.php?tid-2636739.html"})
+	if err != nil {
+		t.Fatalf("buildRuntimeConfig returned error: %v", err)
+	}
+	if cfg.App.TID != "2636739" || cfg.App.Site != "north" || cfg.App.BaseURL != "https://north-plus.net/" ||
+		cfg.App.HTTPCookieFile != "north.txt" || cfg.App.HTTPUserAgent != "north-ua" {
+		t.Fatalf("expected the north site inferred from the URL, got %+v", cfg.App)
+	}
+
+	if err := rootCmd.PersistentFlags().Set("site", "south"); err != nil {
+		t.Fatalf("set site flag: %v", err)
+	}
+	if err := rootCmd.PersistentFlags().Set("cookie-file", "flag.txt"); err != nil {
+		t.Fatalf("set cookie-file flag: %v", err)
+	}
+	cfg, err = buildRuntimeConfig(rootCmd, []string{"2636739"})
+	if err != nil {
+		t.Fatalf("buildRuntimeConfig returned error: %v", err)
+	}
+	if cfg.App.BaseURL != "https://south-plus.net/" || cfg.App.HTTPCookieFile != "flag.txt" || cfg.App.HTTPUserAgent != "top-level" {
+		t.Fatalf("expected --site with the explicit flag winning, got %+v", cfg.App)
+	}
+
+	if err := rootCmd.PersistentFlags().Set("site", "east"); err != nil {
+		t.Fatalf("set site flag: %v", err)
+	}
+	if _, err := buildRuntimeConfig(rootCmd, []string{"2636739"}); err == nil {
+		t.Fatal("expected an unknown site to be rejected")
+	}
+}
+
+func TestBuildRuntimeConfigUsesHostOfUnconfiguredThreadURL(t *testing.T) {
+	resetCLIStateForTest(t)
+
+	cfg, err := buildRuntimeConfig(rootCmd, []string{"https://level-plus.net/read.php?tid=123&page=2"})
+	if err != nil {
+		t.Fatalf("buildRuntimeConfig returned error: %v", err)
+	}
+	if cfg.App.TID != "123" || cfg.App.BaseURL != "https://level-plus.net/" {
+		t.Fatalf("unexpected tid %q and base url %q", cfg.App.TID, cfg.App.BaseURL)
+	}
+
+	if _, err := buildRuntimeConfig(rootCmd, []string{"https://level-plus.net/read.php?tid-1.html", "https://south-plus.net/read.php?tid-2.html"}); err == nil {
+		t.Fatal("expected thread URLs of different sites to be rejected")
+	}
+}
+
+// writeThreadFixture returns a fixtures directory replaying thread 2636739.
+func writeThreadFixture(t *testing.T) string {
+	t.Helper()
+	page, err := os.ReadFile(filepath.Join("..", "..", "tid-2636739.html"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	fixturesDir := t.TempDir()
+	fixture, err := south2md.FixturePath(fixturesDir, "https://south-plus.net/read.php?tid-2636739.html")
+	if err != nil {
+		t.Fatalf("FixturePath returned error: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(fixture), 0o755); err != nil {
+		t.Fatalf("create fixture dir: %v", err)
+	}
+	if err := os.WriteFile(fixture, page, 0o600); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+	return fixturesDir
+}
+
+func TestRunExtractorReplaysFixtures(t *testing.T) {
+	resetCLIStateForTest(t)
+
+	fixturesDir := writeThreadFixture(t)
+	dataHome := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dataHome)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	outputDir := t.TempDir()
+	for name, value := range map[string]string{
+		"fixtures-dir": fixturesDir,
+		"cache-dir":    t.TempDir(),
+		"output":       outputDir,
+	} {
+		if err := rootCmd.PersistentFlags().Set(name, value); err != nil {
+			t.Fatalf("set %s flag: %v", name, err)
+		}
+	}
+
+	rootCmd.SetContext(context.Background())
+	if err := runExtractor(rootCmd, []string{"2636739"}); err != nil {
+		t.Fatalf("runExtractor returned error: %v", err)
+	}
+	post, err := south2md.NewPostStore(filepath.Join(dataHome, "south2md", "posts")).LoadPostFromStore("2636739")
+	if err != nil {
+		t.Fatalf("load stored post: %v", err)
+	}
+	if post.TID != "2636739" || post.Title == "" || len(post.Replies) == 0 {
+		t.Fatalf("expected the replayed thread in the store, got %+v", post)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "2636739", "post.md")); err != nil {
+		entries, _ := os.ReadDir(outputDir)
+		t.Fatalf("expected an exported post.md, got %v (%v)", entries, err)
+	}
+
+	var out bytes.Buffer
+	historyCmd.SetOut(&out)
+	defer historyCmd.SetOut(nil)
+	if err := runHistory(historyCmd, nil); err != nil {
+		t.Fatalf("runHistory returned error: %v", err)
+	}
+	if line := out.String(); !strings.HasPrefix(line, "1 ") || !strings.Contains(line, "fetch") || !strings.Contains(line, "2636739") || !strings.Contains(line, "✓") {
+		t.Fatalf("expected the fetch in the history, got %q", line)
+	}
+	out.Reset()
+	if err := runHistoryShow(historyCmd, []string{"1"}); err != nil {
+		t.Fatalf("runHistoryShow returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "命令:   fetch") || !strings.Contains(out.String(), "导出:   "+filepath.Join(outputDir, "2636739")) {
+		t.Fatalf("unexpected run details:\n%s", out.String())
+	}
+	if err := runHistoryShow(historyCmd, []string{"2"}); err == nil {
+		t.Fatal("expected an unknown run to be rejected")
+	}
+}
+
+func TestRunExportWritesNewFloors(t *testing.T) {
+	resetCLIStateForTest(t)
+
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	for name, value := range map[string]string{
+		"fixtures-dir": writeThreadFixture(t),
+		"cache-dir":    t.TempDir(),
+	} {
+		if err := rootCmd.PersistentFlags().Set(name, value); err != nil {
+			t.Fatalf("set %s flag: %v", name, err)
+		}
+	}
+	rootCmd.SetContext(context.Background())
+	if err := runExtractor(rootCmd, []string{"2636739"}); err != nil {
+		t.Fatalf("runExtractor returned error: %v", err)
+	}
+
+	if err := runExport(exportCmd, []string{"2636739"}); err == nil {
+		t.Fatal("expected export without --since-floor or --since-date to be rejected")
+	}
+	if err := exportCmd.Flags().Set("since-floor", "2"); err != nil {
+		t.Fatalf("set since-floor flag: %v", err)
+	}
+	var out, status bytes.Buffer
+	exportCmd.SetOut(&out)
+	exportCmd.SetErr(&status)
+	defer exportCmd.SetOut(nil)
+	defer exportCmd.SetErr(nil)
+	if err := runExport(exportCmd, []string{"2636739"}); err != nil {
+		t.Fatalf("runExport returned error: %v", err)
+	}
+	digest := out.String()
+	if !strings.Contains(digest, "B3F.[3]") || !strings.Contains(digest, "B4F.[4]") || strings.Contains(digest, "B2F.[2]") ||
+		!strings.Contains(status.String(), "导出了 2 个新楼层，下次可用 --since-floor=4") {
+		t.Fatalf("expected the floors after B2F, got:\n%s\n%s", digest, status.String())
+	}
+
+	out.Reset()
+	status.Reset()
+	outputDir := t.TempDir()
+	if err := rootCmd.PersistentFlags().Set("output", outputDir); err != nil {
+		t.Fatalf("set output flag: %v", err)
+	}
+	if err := exportCmd.Flags().Set("since-floor", "4"); err != nil {
+		t.Fatalf("set since-floor flag: %v", err)
+	}
+	if err := runExport(exportCmd, []string{"2636739"}); err != nil {
+		t.Fatalf("runExport returned error: %v", err)
+	}
+	if !strings.Contains(status.String(), "没有新楼层") {
+		t.Fatalf("expected no new floors, got %q", status.String())
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "2636739-delta.md")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected no digest file without new floors, got %v", err)
+	}
+}
+
+func TestRunExtractorJSONProgress(t *testing.T) {
+	resetCLIStateForTest(t)
+
+	fixturesDir := writeThreadFixture(t)
+	// A 1x1 GIF for one of the thread's smilies.
+	gif := []byte("GIF89a\x01\x00\x01\x00\x80\x00\x00\x00\x00\x00\xff\xff\xff!\xf9\x04\x01\x00\x00\x00\x00,\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02D\x01\x00;")
+	image, err := south2md.FixturePath(fixturesDir, "https://south-plus.net/images/post/smile/smallface/face106.gif")
+	if err != nil {
+		t.Fatalf("FixturePath returned error: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(image), 0o755); err != nil {
+		t.Fatalf("create fixture dir: %v", err)
+	}
+	if err := os.WriteFile(image, gif, 0o600); err != nil {
+		t.Fatalf("write image fixture: %v", err)
+	}
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	for name, value := range map[string]string{
+		"fixtures-dir":  fixturesDir,
+		"cache-dir":     t.TempDir(),
+		"output":        "",
+		"json-progress": "true",
+	} {
+		if err := rootCmd.PersistentFlags().Set(name, value); err != nil {
+			t.Fatalf("set %s flag: %v", name, err)
+		}
+	}
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	t.Cleanup(func() { rootCmd.SetOut(nil) })
+	rootCmd.SetContext(context.Background())
+	if err := runExtractor(rootCmd, []string{"2636739"}); err != nil {
+		t.Fatalf("runExtractor returned error: %v", err)
+	}
+
+	counts := make(map[string]int)
+	var done progressEvent
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var event progressEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("expected only JSON lines on stdout, got %q: %v", line, err)
+		}
+		if event.TID != "2636739" {
+			t.Fatalf("expected events of thread 2636739, got %+v", event)
+		}
+		counts[event.Event]++
+		if event.Event == progressDone {
+			done = event
+		}
+	}
+	if counts[progressPageFetched] != 1 || counts[progressImageDownloaded] != 1 || counts[progressDone] != 1 {
+		t.Fatalf("unexpected event counts %v", counts)
+	}
+	if counts[progressFloorExtracted] != done.Floors || done.Floors == 0 {
+		t.Fatalf("expected one floor_extracted per floor, got %d for %d floors", counts[progressFloorExtracted], done.Floors)
+	}
+	if done.Error != "" || done.Images != 1 || done.Bytes <= int64(len(gif)) || done.Output == "" {
+		t.Fatalf("unexpected done event %+v", done)
+	}
+}
+
+func TestConfigShowReportsSources(t *testing.T) {
+	resetCLIStateForTest(t)
+
+	configPath := filepath.Join(t.TempDir(), "south2md.toml")
+	content := strings.Join([]string{
+		"max_retries = 7",
+		"webdav_password = \"secret\"",
+		"",
+		"[sites.north]",
+		"base_url = \"https://north-plus.net/\"",
+		"user_agent = \"north-ua\"",
+	}, "\n")
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	t.Setenv("SOUTH2MD_CONFIG", configPath)
+	t.Setenv("SOUTH2MD_MAX_CONCURRENT", "2")
+	if err := rootCmd.PersistentFlags().Set("user-agent", "flag-ua"); err != nil {
+		t.Fatalf("set user-agent flag: %v", err)
+	}
+	if err := rootCmd.PersistentFlags().Set("no-cache", "true"); err != nil {
+		t.Fatalf("set no-cache flag: %v", err)
+	}
+
+	var out bytes.Buffer
+	configShowCmd.SetOut(&out)
+	defer configShowCmd.SetOut(nil)
+	if err := runConfigShow(configShowCmd, []string{"https://north-plus.net/read.php?tid-1.html"}); err != nil {
+		t.Fatalf("runConfigShow returned error: %v", err)
+	}
+	for _, want := range []string{
+		"# 配置文件: " + configPath + "\n",
+		"max_retries = 7 # config file\n",
+		"max_concurrent = 2 # env SOUTH2MD_MAX_CONCURRENT\n",
+		"base_url = \"https://north-plus.net/\" # [sites.north]\n",
+		"user_agent = \"flag-ua\" # flag --user-agent\n",
+		"enable_cache = false # flag --no-cache (no_cache)\n",
+		"webdav_password = \"***\" # config file\n",
+		"timeout = \"30s\" # default\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("expected %q in:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "警告") {
+		t.Fatalf("expected a valid configuration:\n%s", out.String())
+	}
+}
+
+// drainTUI runs cmd and feeds the messages it produces back into m.
+func drainTUI(m *tuiModel, cmd tea.Cmd) {
+	if cmd == nil {
+		return
+	}
+	switch msg := cmd().(type) {
+	case nil:
+	case tea.BatchMsg:
+		for _, cmd := range msg {
+			drainTUI(m, cmd)
+		}
+	default:
+		_, next := m.Update(msg)
+		drainTUI(m, next)
+	}
+}
+
+func TestTUIFetchesAndExportsThread(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	cfg := south2md.NewDefaultConfig()
+	cfg.FixturesDir = writeThreadFixture(t)
+	cfg.CacheDir = t.TempDir()
+	store := openPostStore(cfg)
+	if err := store.EnsureRoot(); err != nil {
+		t.Fatalf("EnsureRoot returned error: %v", err)
+	}
+	options := south2md.HTTPOptionsFromConfig(cfg)
+	model := newTUIModel(context.Background(), cfg, store, newThreadArchiver(cfg, store, south2md.NewHTTPClient(options), options, nil))
+	var lines []string
+	model.send = func(msg tea.Msg) {
+		if line, ok := msg.(tuiJobLineMsg); ok {
+			lines = append(lines, line.line)
+		}
+	}
+	model.Update(tea.WindowSizeMsg{Width: 100, Height: 30})
+
+	model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+	model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("https://south-plus.net/read.php?tid-2636739.html")})
+	_, cmd := model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if len(model.jobs) != 1 || model.jobs[0].tid != "2636739" || model.jobs[0].status != tuiJobRunning {
+		t.Fatalf("expected a running job for 2636739, got %+v", model.jobs)
+	}
+	drainTUI(model, cmd)
+	if model.jobs[0].status != tuiJobDone {
+		t.Fatalf("expected the job to finish, got %q: %s", model.jobs[0].status, model.jobs[0].message)
+	}
+	if len(lines) == 0 || !strings.Contains(strings.Join(lines, "\n"), "帖子已存储") {
+		t.Fatalf("expected pipeline progress lines, got %q", lines)
+	}
+	if len(model.posts) != 1 || model.selectedTID() != "2636739" {
+		t.Fatalf("expected the stored thread in the list, got %d posts", len(model.posts))
+	}
+	if view := model.View(); !strings.Contains(view, "2636739") {
+		t.Fatalf("expected the view to show the thread, got:\n%s", view)
+	}
+
+	outputDir := t.TempDir()
+	model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("e")})
+	model.input.SetValue(outputDir)
+	_, cmd = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	drainTUI(model, cmd)
+	if !strings.Contains(model.status, "已导出") {
+		t.Fatalf("expected an export status, got %q", model.status)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "2636739", "post.md")); err != nil {
+		t.Fatalf("expected exported post.md: %v", err)
+	}
+}
+
+func TestAPIServerRunsQueuedJobs(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	store := openPostStore(south2md.NewDefaultConfig())
+	archive := func(ctx context.Context, tid, baseURL string, metrics *south2md.Metrics, out io.Writer) (*south2md.PostDiff, error) {
+		fmt.Fprintf(out, "archived %s from %q\n", tid, baseURL)
+		if tid == "2" {
+			return nil, errors.New("forum unreachable")
+		}
+		return &south2md.PostDiff{TID: tid, NewFloors: []south2md.FloorChange{{Floor: "B5F", Author: "bob", Snippet: []string{"hello"}}}}, nil
+	}
+	logs := &logBroadcaster{}
+	fmt.Fprintln(logs, `{"msg":"started"}`)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := newAPIServer(ctx, "secret", store, archive, logs)
+	server.start(1)
+	ts := httptest.NewServer(server.handler())
+	defer ts.Close()
+
+	call := func(method, path, token, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequestWithContext(ctx, method, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("NewRequest returned error: %v", err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	if resp := call("GET", "/api/jobs", "wrong", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a wrong token, got %d", resp.StatusCode)
+	}
+	if resp := call("POST", "/api/jobs", "secret", `{"threads":["abc"]}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid thread, got %d", resp.StatusCode)
+	}
+	resp := call("POST", "/api/jobs", "secret", `{"threads":["1","https://north-plus.net/read.php?tid-2.html"]}`)
+	var queued []apiJob
+	if err := json.NewDecoder(resp.Body).Decode(&queued); err != nil || resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202 with the queued jobs, got %d: %v", resp.StatusCode, err)
+	}
+	if len(queued) != 2 || queued[1].ID != 2 || queued[1].TID != "2" || queued[1].BaseURL != "https://north-plus.net/" {
+		t.Fatalf("unexpected queued jobs %+v", queued)
+	}
+
+	var job apiJob
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		resp := call("GET", "/api/jobs/2", "secret", "")
+		if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+			t.Fatalf("decode job: %v", err)
+		}
+		if job.Status == apiJobFailed || job.Status == apiJobDone || time.Now().After(deadline) {
+			break
+		}
+	}
+	if job.Status != apiJobFailed || job.Error != "forum unreachable" || job.Message != `archived 2 from "https://north-plus.net/"` {
+		t.Fatalf("unexpected job 2 %+v", job)
+	}
+	var jobs []apiJob
+	if err := json.NewDecoder(call("GET", "/api/jobs", "secret", "").Body).Decode(&jobs); err != nil || len(jobs) != 2 || jobs[0].Status != apiJobDone {
+		t.Fatalf("expected job 1 done, got %+v (%v)", jobs, err)
+	}
+	if floors := jobs[0].NewFloors; len(floors) != 1 || floors[0].Floor != "B5F" || len(floors[0].Snippet) != 1 || floors[0].Snippet[0] != "hello" {
+		t.Fatalf("expected job 1 to carry its new floors, got %+v", floors)
+	}
+	if resp := call("GET", "/api/jobs/3", "secret", ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown job, got %d", resp.StatusCode)
+	}
+	if body, _ := io.ReadAll(call("GET", "/api/posts", "secret", "").Body); strings.TrimSpace(string(body)) != "[]" {
+		t.Fatalf("expected an empty archive, got %s", body)
+	}
+
+	stream := call("GET", "/api/logs", "secret", "").Body
+	line, err := bufio.NewReader(stream).ReadString('\n')
+	stream.Close()
+	if err != nil || line != `{"msg":"started"}`+"\n" {
+		t.Fatalf("expected the log backlog, got %q (%v)", line, err)
+	}
+}
+
+func TestAPIServerFiltersAndPagesPosts(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	store := openPostStore(south2md.NewDefaultConfig())
+	for tid, fields := range map[string]string{
+		"9999":  `forum = "同人音声"` + "\ntags = [\"asmr\"]\ncreated_at = 2024-01-02T00:00:00Z\n",
+		"10000": `forum = "综合"` + "\ncreated_at = 2025-03-01T00:00:00Z\n",
+		"20000": `forum = "同人音声"` + "\ncreated_at = 2025-06-01T00:00:00Z\n",
+	} {
+		dir := store.PostDir(tid)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "metadata.toml"), []byte("tid = \""+tid+"\"\n"+fields), 0644); err != nil {
+			t.Fatalf("write metadata: %v", err)
+		}
+	}
+	pending := south2md.NewPendingQueue()
+	pending.Add(south2md.PendingKindImage, "https://cdn.example.com/a.png", errors.New("timeout"))
+	if err := pending.Save("10000", store.PostDir("10000")); err != nil {
+		t.Fatalf("save pending: %v", err)
+	}
+	ts := httptest.NewServer(newAPIServer(context.Background(), "", store, nil, &logBroadcaster{}).handler())
+	defer ts.Close()
+
+	list := func(query string) (string, string) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + "/api/posts?" + query)
+		if err != nil {
+			t.Fatalf("GET %s: %v", query, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: status %d", query, resp.StatusCode)
+		}
+		var posts []map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&posts); err != nil {
+			t.Fatalf("decode %s: %v", query, err)
+		}
+		var tids []string
+		for _, post := range posts {
+			tids = append(tids, fmt.Sprint(post["tid"]))
+		}
+		return strings.Join(tids, ","), resp.Header.Get("X-Next-Cursor")
+	}
+	for query, want := range map[string]string{
+		"": "9999,10000,20000",
+		"forum=%E5%90%8C%E4%BA%BA%E9%9F%B3%E5%A3%B0": "9999,20000",
+		"tag=asmr":                          "9999",
+		"since=2025-01-01&until=2025-04-01": "10000",
+		"pending=true":                      "10000",
+		"pending=false":                     "9999,20000",
+		"limit=2&cursor=10000":              "20000",
+	} {
+		if got, _ := list(query); got != want {
+			t.Errorf("GET /api/posts?%s: expected %s, got %s", query, want, got)
+		}
+	}
+	if got, next := list("limit=2"); got != "9999,10000" || next != "10000" {
+		t.Fatalf("expected the first page with a cursor, got %s (next %q)", got, next)
+	}
+	if _, next := list("limit=2&cursor=10000"); next != "" {
+		t.Fatalf("expected no cursor after the last page, got %q", next)
+	}
+
+	resp, err := http.Get(ts.URL + "/api/posts?pending=true&fields=tid,pending")
+	if err != nil {
+		t.Fatalf("GET with fields: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if strings.TrimSpace(string(body)) != `[{"pending":1,"tid":"10000"}]` {
+		t.Fatalf("expected only the selected fields, got %s", body)
+	}
+	for _, query := range []string{"fields=secret", "limit=0", "since=yesterday"} {
+		resp, err := http.Get(ts.URL + "/api/posts?" + query)
+		if err != nil {
+			t.Fatalf("GET %s: %v", query, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestIsLoopbackAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:8790": true,
+		"[::1]:8790":     true,
+		"localhost:8790": true,
+		":8790":          false,
+		"0.0.0.0:8790":   false,
+		"example.com:80": false,
+	} {
+		if got := isLoopbackAddr(addr); got != want {
+			t.Errorf("isLoopbackAddr(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestTelegramBotArchivesThreads(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	cfg := south2md.NewDefaultConfig()
+	cfg.FixturesDir = writeThreadFixture(t)
+	cfg.CacheDir = t.TempDir()
+	cfg.TelegramUsers = []string{"42", "@bob"}
+	store := openPostStore(cfg)
+	if err := store.EnsureRoot(); err != nil {
+		t.Fatalf("EnsureRoot returned error: %v", err)
+	}
+
+	var mu sync.Mutex
+	var messages []string
+	documents := make(chan string, 1)
+	telegram := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bottoken/sendMessage":
+			var payload struct {
+				Text string `json:"text"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			mu.Lock()
+			messages = append(messages, payload.Text)
+			mu.Unlock()
+		case "/bottoken/sendDocument":
+			_, header, err := r.FormFile("document")
+			if err != nil {
+				t.Errorf("read document: %v", err)
+			} else {
+				documents <- header.Filename + "\n" + r.FormValue("caption")
+			}
+		}
+		io.WriteString(w, `{"ok":true,"result":{}}`)
+	}))
+	defer telegram.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	options := south2md.HTTPOptionsFromConfig(cfg)
+	server := newAPIServer(ctx, "", store, newThreadArchiver(cfg, store, south2md.NewHTTPClient(options), options, nil), &logBroadcaster{})
+	server.start(1)
+	bot := newTelegramBot(south2md.NewTelegramBot(telegram.Client(), telegram.URL, "token"), server, cfg)
+
+	bot.handle(ctx, &south2md.TelegramMessage{From: &south2md.TelegramUser{ID: 7, Username: "mallory"}, Text: "2636739"})
+	bot.handle(ctx, &south2md.TelegramMessage{From: &south2md.TelegramUser{ID: 8, Username: "Bob"}, Text: "hello"})
+	bot.handle(ctx, &south2md.TelegramMessage{From: &south2md.TelegramUser{ID: 42}, Text: "https://south-plus.net/read.php?tid-2636739.html"})
+	select {
+	case document := <-documents:
+		if !strings.HasPrefix(document, "2636739.") || !strings.Contains(document, "楼层") {
+			t.Fatalf("unexpected document %q", document)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("timed out waiting for the exported thread")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(messages) != 3 || messages[0] != "你没有使用此机器人的权限。" || messages[1] != telegramHelp || !strings.Contains(messages[2], "任务 #1: 帖子 2636739") {
+		t.Fatalf("unexpected replies %q", messages)
+	}
+}
+
+func TestFormatNewFloorsListsSnippetsUpToTheLimit(t *testing.T) {
+	floors := []south2md.FloorChange{
+		{Floor: "B5F", Author: "bob", Snippet: []string{"first line", "second line"}},
+		{Floor: "B6F", Snippet: []string{"*not bold*"}},
+		{Floor: "B7F", Author: "carol"},
+	}
+	want := "新楼层 (3)\n\nB5F @bob\nfirst line\nsecond line\n\nB6F\n*not bold*\n\n另有 1 个新楼层"
+	if got := formatNewFloors(floors, 2); got != want {
+		t.Fatalf("formatNewFloors = %q, want %q", got, want)
+	}
+}
+
+func TestRunExtractorRunsHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks use sh syntax")
+	}
+	resetCLIStateForTest(t)
+
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	events := filepath.Join(t.TempDir(), "events")
+	hook := `printf '%s %s %s\n' "$SOUTH2MD_HOOK_EVENT" "$SOUTH2MD_HOOK_TID" "$SOUTH2MD_HOOK_NEW_FLOORS" >> ` + events
+	for name, value := range map[string]string{
+		"fixtures-dir":       writeThreadFixture(t),
+		"cache-dir":          t.TempDir(),
+		"on-thread-archived": hook,
+		"on-update":          hook,
+		"on-error":           hook,
+	} {
+		if err := rootCmd.PersistentFlags().Set(name, value); err != nil {
+			t.Fatalf("set %s flag: %v", name, err)
+		}
+	}
+
+	rootCmd.SetContext(context.Background())
+	for range 2 {
+		if err := runExtractor(rootCmd, []string{"2636739"}); err != nil {
+			t.Fatalf("runExtractor returned error: %v", err)
+		}
+	}
+	if err := runExtractor(rootCmd, []string{"1"}); err == nil {
+		t.Fatal("expected a thread without fixture to fail")
+	}
+
+	data, err := os.ReadFile(events)
+	if err != nil {
+		t.Fatalf("read hook events: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "on_thread_archived 2636739 ") || lines[0] == "on_thread_archived 2636739 0" ||
+		lines[1] != "on_thread_archived 2636739 0" || lines[2] != "on_error 1 0" {
+		t.Fatalf("unexpected hook events %q", lines)
+	}
+}
+
+func TestRunExtractorCommitsExportsToGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	resetCLIStateForTest(t)
+
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	exportDir := t.TempDir()
+	for name, value := range map[string]string{
+		"fixtures-dir": writeThreadFixture(t),
+		"cache-dir":    t.TempDir(),
+		"output":       exportDir,
+		"git-commit":   "true",
+	} {
+		if err := rootCmd.PersistentFlags().Set(name, value); err != nil {
+			t.Fatalf("set %s flag: %v", name, err)
+		}
+	}
+
+	rootCmd.SetContext(context.Background())
+	for range 2 {
+		if err := runExtractor(rootCmd, []string{"2636739"}); err != nil {
+			t.Fatalf("runExtractor returned error: %v", err)
+		}
+	}
+
+	log, err := exec.Command("git", "-C", exportDir, "log", "--format=%s%n%b").Output()
+	if err != nil {
+		t.Fatalf("git log: %v", err)
+	}
+	if !strings.HasPrefix(string(log), "Archive 2636739: ") || strings.Contains(string(log), "Update 2636739") ||
+		!strings.Contains(string(log), "TID: 2636739\n") {
+		t.Fatalf("expected one archive commit for the unchanged thread, got %q", log)
+	}
+}
+
+func TestMaintenanceBackoffPausesUntilTheForumIsBack(t *testing.T) {
+	var out bytes.Buffer
+	backoff := &maintenanceBackoff{initial: time.Millisecond, max: 4 * time.Millisecond, out: &out}
+
+	var (
+		mu       sync.Mutex
+		attempts int
+	)
+	archive := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts <= 4 {
+			return south2md.NewMaintenanceError("论坛正在维护")
+		}
+		return nil
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = backoff.run(context.Background(), archive)
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("thread %d: expected the fetch to resume, got %v", i, err)
+		}
+	}
+	if got := strings.Count(out.String(), "论坛维护中"); got != 1 {
+		t.Fatalf("expected a single pause notice, got %q", out.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := backoff.run(ctx, func() error { return south2md.NewMaintenanceError("论坛正在维护") })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancelled fetch to stop waiting, got %v", err)
+	}
+}
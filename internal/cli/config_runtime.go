@@ -2,7 +2,12 @@ package cli
 
 import (
 	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
 	"reflect"
+	"slices"
 	"strings"
 	"time"
 
@@ -10,11 +15,13 @@ import (
 	"github.com/fdkevin0/south2md/internal/configsource"
 	"github.com/go-viper/mapstructure/v2"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 type runtimeConfig struct {
 	App        *south2md.Config
+	TIDs       []string // threads to fetch; more than one runs a batch
 	InputFile  string
 	Offline    bool
 	Debug      bool
@@ -23,16 +30,57 @@ type runtimeConfig struct {
 
 type runtimeConfigValues struct {
 	south2md.Config `mapstructure:",squash"`
-	InputFile       string `mapstructure:"input"`
-	Offline         bool   `mapstructure:"offline"`
-	Debug           bool   `mapstructure:"debug"`
+	InputFile       string   `mapstructure:"input"`
+	Offline         bool     `mapstructure:"offline"`
+	Debug           bool     `mapstructure:"debug"`
+	TIDs            []string `mapstructure:"-"`
+	ThreadBaseURLs  []string `mapstructure:"-"` // forum roots of the thread URLs given instead of TIDs
 }
 
 func buildRuntimeConfig(cmd *cobra.Command, args []string) (*runtimeConfig, error) {
-	v, err := configsource.NewViperForCommand(cmd, flagConfigFile)
+	cfg, _, err := loadRuntimeConfig(cmd, args)
 	if err != nil {
 		return nil, err
 	}
+	if err := validateRuntimeConfig(cfg); err != nil {
+		return nil, err
+	}
+	if err := loadProxyPool(cfg.App); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// buildThreadlessConfig is buildRuntimeConfig for commands that don't need a
+// thread up front, because they are given threads later (interactively or
+// over the API) or only filter by one, so the checks on the thread arguments
+// don't apply.
+func buildThreadlessConfig(cmd *cobra.Command, args []string) (*runtimeConfig, error) {
+	cfg, _, err := loadRuntimeConfig(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	tid := cfg.App.TID
+	cfg.App.TID = "-"
+	err = validateRuntimeConfig(cfg)
+	cfg.App.TID = tid
+	if err != nil {
+		return nil, err
+	}
+	if err := loadProxyPool(cfg.App); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadRuntimeConfig merges defaults, the config file, environment variables,
+// flags and the selected site block without validating the result. It also
+// returns the viper instance the values came from.
+func loadRuntimeConfig(cmd *cobra.Command, args []string) (*runtimeConfig, *viper.Viper, error) {
+	v, err := configsource.NewViperForCommand(cmd, flagConfigFile)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	values := runtimeConfigValues{
 		Config: *south2md.NewDefaultConfig(),
@@ -41,41 +89,179 @@ func buildRuntimeConfig(cmd *cobra.Command, args []string) (*runtimeConfig, erro
 		durationDecodeHook(),
 		mapstructure.StringToTimeDurationHookFunc(),
 	))); err != nil {
-		return nil, fmt.Errorf("反序列化配置失败: %w", err)
+		return nil, nil, fmt.Errorf("反序列化配置失败: %w", err)
 	}
 
 	applyFlagsToConfig(&values, args)
+	if err := applySiteConfig(cmd, &values); err != nil {
+		return nil, nil, err
+	}
 
 	cfg := &runtimeConfig{
 		App:        &values.Config,
+		TIDs:       values.TIDs,
 		InputFile:  values.InputFile,
 		Offline:    values.Offline,
 		Debug:      values.Debug,
 		ConfigFile: v.ConfigFileUsed(),
 	}
+	return cfg, v, nil
+}
 
-	if err := validateRuntimeConfig(cfg); err != nil {
-		return nil, err
+// loadProxyPool appends the proxies from proxy_pool_file to proxy_pool and
+// validates the resulting pool.
+func loadProxyPool(cfg *south2md.Config) error {
+	if cfg.HTTPProxyPoolFile != "" {
+		proxies, err := south2md.LoadProxyPoolFile(cfg.HTTPProxyPoolFile)
+		if err != nil {
+			return err
+		}
+		cfg.HTTPProxyPool = append(cfg.HTTPProxyPool, proxies...)
 	}
-	return cfg, nil
+	if len(cfg.HTTPProxyPool) == 0 {
+		return nil
+	}
+	if _, err := south2md.NewProxyPool(cfg.HTTPProxyPool, cfg.HTTPProxyBanTime); err != nil {
+		return fmt.Errorf("代理池配置无效: %w", err)
+	}
+	return nil
 }
 
 func applyFlagsToConfig(values *runtimeConfigValues, args []string) {
 	values.TID = strings.TrimSpace(values.TID)
 	values.InputFile = strings.TrimSpace(values.InputFile)
 	values.OutputFile = strings.TrimSpace(values.OutputFile)
+	values.OutputFormat = strings.ToLower(strings.TrimSpace(values.OutputFormat))
+	values.TranslateBackend = strings.ToLower(strings.TrimSpace(values.TranslateBackend))
+	values.TranslateTarget = strings.ToLower(strings.TrimSpace(values.TranslateTarget))
+	values.TranslateMode = strings.ToLower(strings.TrimSpace(values.TranslateMode))
+	values.TranslateEndpoint = strings.TrimSpace(values.TranslateEndpoint)
+	values.TranslateModel = strings.TrimSpace(values.TranslateModel)
+	values.HugoSection = strings.TrimSpace(values.HugoSection)
+	values.PDFChromePath = strings.TrimSpace(values.PDFChromePath)
+	values.MarkdownTemplateFile = strings.TrimSpace(values.MarkdownTemplateFile)
+	values.MarkdownPopularStrategy = strings.ToLower(strings.TrimSpace(values.MarkdownPopularStrategy))
+	values.MarkdownImageStyle = strings.ToLower(strings.TrimSpace(values.MarkdownImageStyle))
+	values.MarkdownLineBreaks = strings.ToLower(strings.TrimSpace(values.MarkdownLineBreaks))
+	values.SelectorProfile = strings.ToLower(strings.TrimSpace(values.SelectorProfile))
+	values.Site = strings.ToLower(strings.TrimSpace(values.Site))
 	values.CacheDir = strings.TrimSpace(values.CacheDir)
 	values.BaseURL = strings.TrimSpace(values.BaseURL)
 	values.HTTPCookieFile = strings.TrimSpace(values.HTTPCookieFile)
 	values.HTTPUserAgent = strings.TrimSpace(values.HTTPUserAgent)
+	values.HTTPProxy = strings.TrimSpace(values.HTTPProxy)
+	values.HTTPNoProxy = strings.TrimSpace(values.HTTPNoProxy)
+	values.HTTPProxyPoolFile = strings.TrimSpace(values.HTTPProxyPoolFile)
+	values.HTTPPoliteness = strings.ToLower(strings.TrimSpace(values.HTTPPoliteness))
+	values.HTTPPagination = strings.ToLower(strings.TrimSpace(values.HTTPPagination))
+	values.HTTPTLSFingerprint = strings.ToLower(strings.TrimSpace(values.HTTPTLSFingerprint))
+	values.MetricsAddr = strings.TrimSpace(values.MetricsAddr)
+	values.OTelEndpoint = strings.TrimSpace(values.OTelEndpoint)
+	values.APIAddr = strings.TrimSpace(values.APIAddr)
+	values.APIToken = strings.TrimSpace(values.APIToken)
+	values.TelegramToken = strings.TrimSpace(values.TelegramToken)
+	values.HookOnThreadArchived = strings.TrimSpace(values.HookOnThreadArchived)
+	values.HookOnUpdate = strings.TrimSpace(values.HookOnUpdate)
+	values.HookOnError = strings.TrimSpace(values.HookOnError)
+	values.LogFile = strings.TrimSpace(values.LogFile)
+	values.RecordHAR = strings.TrimSpace(values.RecordHAR)
+	values.FixturesDir = strings.TrimSpace(values.FixturesDir)
+	values.LogFormat = strings.ToLower(strings.TrimSpace(values.LogFormat))
 	values.GofileTool = strings.TrimSpace(values.GofileTool)
 	values.GofileDir = strings.TrimSpace(values.GofileDir)
 	values.GofileToken = strings.TrimSpace(values.GofileToken)
 	values.GofileVenvDir = strings.TrimSpace(values.GofileVenvDir)
+	values.ImageClassifier = strings.TrimSpace(values.ImageClassifier)
+	values.StoreDirTemplate = strings.TrimSpace(values.StoreDirTemplate)
+	if values.StoreDirTemplate == "" {
+		values.StoreDirTemplate = south2md.DefaultDirTemplate
+	}
+	if values.GitCommit {
+		// A generation timestamp would make every run of an unchanged
+		// thread a new commit.
+		values.MarkdownReproducible = true
+	}
+	for i, mirror := range values.HTTPMirrors {
+		values.HTTPMirrors[i] = strings.TrimSpace(mirror)
+	}
+	for i, user := range values.TelegramUsers {
+		values.TelegramUsers[i] = strings.ToLower(strings.TrimSpace(user))
+	}
+	for i, tag := range values.ImageQuarantine {
+		values.ImageQuarantine[i] = strings.ToLower(strings.TrimSpace(tag))
+	}
+
+	addThread := func(arg string) {
+		tid, baseURL := south2md.ParseThreadArg(arg)
+		if tid == "" {
+			return
+		}
+		values.TIDs = append(values.TIDs, tid)
+		if baseURL != "" {
+			values.ThreadBaseURLs = append(values.ThreadBaseURLs, baseURL)
+		}
+	}
+	if values.TID == "" {
+		for _, arg := range args {
+			addThread(arg)
+		}
+	} else {
+		addThread(values.TID)
+	}
+	if len(values.TIDs) > 0 {
+		values.TID = values.TIDs[0]
+	}
+}
 
-	if values.TID == "" && len(args) > 0 {
-		values.TID = strings.TrimSpace(args[0])
+// cmdFlag looks up a local or inherited flag of cmd.
+func cmdFlag(cmd *cobra.Command, name string) *pflag.Flag {
+	if cmd == nil {
+		return nil
 	}
+	return cmd.Flag(name)
+}
+
+// siteFlags are the flags a [sites.<name>] block sets, by config key.
+var siteFlags = map[string]string{
+	"base_url":         "base-url",
+	"cookie_file":      "cookie-file",
+	"user_agent":       "user-agent",
+	"selector_profile": "selector-profile",
+	"mirrors":          "mirrors",
+	"tls_fingerprint":  "tls-fingerprint",
+}
+
+// applySiteConfig applies the [sites.<name>] block selected with --site, or
+// else the one whose base_url has the host of the thread URLs given as
+// arguments. A thread URL of an unconfigured host only sets base_url.
+// Explicitly passed flags take precedence over the site block.
+func applySiteConfig(cmd *cobra.Command, values *runtimeConfigValues) error {
+	keep := make(map[string]bool, len(siteFlags))
+	for key, flag := range siteFlags {
+		if f := cmdFlag(cmd, flag); f != nil && f.Changed {
+			keep[key] = true
+		}
+	}
+
+	threadBase := ""
+	for _, baseURL := range values.ThreadBaseURLs {
+		if threadBase != "" && !strings.EqualFold(baseURL, threadBase) {
+			return fmt.Errorf("帖子链接来自不同站点 (%s, %s)，请分批抓取", threadBase, baseURL)
+		}
+		threadBase = baseURL
+	}
+
+	site := values.Site
+	if site == "" && threadBase != "" {
+		site = south2md.SiteForURL(values.Sites, threadBase)
+	}
+	if site != "" {
+		return values.Config.ApplySite(site, keep)
+	}
+	if threadBase != "" && !keep["base_url"] {
+		values.BaseURL = threadBase
+	}
+	return nil
 }
 
 func validateRuntimeConfig(cfg *runtimeConfig) error {
@@ -85,12 +271,144 @@ func validateRuntimeConfig(cfg *runtimeConfig) error {
 	if cfg.Offline && cfg.App.TID == "" {
 		return fmt.Errorf("--offline 模式必须指定帖子ID")
 	}
+	if len(cfg.TIDs) > 1 && (cfg.Offline || cfg.InputFile != "") {
+		return fmt.Errorf("批量抓取多个帖子时不支持 --offline 或 --input")
+	}
+	if cfg.App.ThreadsParallel <= 0 {
+		return fmt.Errorf("threads-parallel 必须大于 0")
+	}
 	if cfg.App.HTTPTimeout <= 0 {
 		return fmt.Errorf("timeout 必须大于 0")
 	}
 	if cfg.App.HTTPMaxConcurrent <= 0 {
 		return fmt.Errorf("max-concurrent 必须大于 0")
 	}
+	if cfg.App.HTTPProxy != "" && !strings.EqualFold(cfg.App.HTTPProxy, south2md.ProxyDirect) {
+		if _, err := south2md.ParseProxyURL(cfg.App.HTTPProxy); err != nil {
+			return err
+		}
+	}
+	for _, mirror := range cfg.App.HTTPMirrors {
+		if u, err := url.Parse(strings.TrimSpace(mirror)); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("无效的镜像URL %q", mirror)
+		}
+	}
+	if cfg.App.FixturesDir != "" {
+		if info, err := os.Stat(cfg.App.FixturesDir); err != nil || !info.IsDir() {
+			return fmt.Errorf("回放目录不存在: %s", cfg.App.FixturesDir)
+		}
+	}
+	if err := south2md.ValidateTLSFingerprint(cfg.App.HTTPTLSFingerprint); err != nil {
+		return err
+	}
+	if !south2md.IsValidPaginationMode(cfg.App.HTTPPagination) {
+		return fmt.Errorf("不支持的分页方式 %q (可选: %s)", cfg.App.HTTPPagination, strings.Join(south2md.PaginationModes, ", "))
+	}
+	if err := south2md.ValidateHostConcurrency(cfg.App); err != nil {
+		return err
+	}
+	if cfg.App.LogFormat != logFormatText && cfg.App.LogFormat != logFormatJSON {
+		return fmt.Errorf("不支持的日志格式 %q (可选: %s, %s)", cfg.App.LogFormat, logFormatText, logFormatJSON)
+	}
+	if cfg.App.JSONProgress && cfg.App.GofileSelect {
+		return fmt.Errorf("--json-progress 不能与 --gofile-select 同时使用")
+	}
+	if cfg.App.LogMaxSize < 0 || cfg.App.LogMaxBackups < 0 {
+		return fmt.Errorf("log-max-size/log-max-backups 不能为负数")
+	}
+	if cfg.App.HTTPProxyBanTime < 0 {
+		return fmt.Errorf("proxy-ban-time 不能为负数")
+	}
+	if cfg.App.GofileCacheTTL < 0 {
+		return fmt.Errorf("gofile-cache-ttl 不能为负数")
+	}
+	if cfg.App.GofileRateLimit < 0 {
+		return fmt.Errorf("gofile-rate-limit 不能为负数")
+	}
+	if cfg.App.WaybackSaveInterval < 0 {
+		return fmt.Errorf("wayback-save-interval 不能为负数")
+	}
+	if cfg.App.GofileMaxSize < 0 {
+		return fmt.Errorf("gofile-max-size 不能为负数")
+	}
+	if cfg.App.GofileMaxFileSize < 0 {
+		return fmt.Errorf("gofile-max-file-size 不能为负数")
+	}
+	if cfg.App.CacheMaxFileSize < 0 {
+		return fmt.Errorf("max_file_size 不能为负数")
+	}
+	if cfg.App.StoreMaxThreadSize < 0 {
+		return fmt.Errorf("max-thread-size 不能为负数")
+	}
+	if cfg.App.StoreMinFreeSpace < 0 {
+		return fmt.Errorf("min-free-space 不能为负数")
+	}
+	for _, pattern := range cfg.App.GofileInclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("无效的 gofile-include 模式 %q: %w", pattern, err)
+		}
+	}
+	if err := south2md.ValidateDirTemplate(cfg.App.StoreDirTemplate); err != nil {
+		return err
+	}
+	if len(cfg.App.ImageQuarantine) > 0 && cfg.App.ImageClassifier == "" {
+		return fmt.Errorf("--image-quarantine 需要同时设置 --image-classifier")
+	}
+	if err := imageSkipRules(cfg.App).Validate(); err != nil {
+		return err
+	}
+	if cfg.App.MarkdownQuoteDedupe < 0 || cfg.App.MarkdownQuoteDedupe > 1 {
+		return fmt.Errorf("dedupe-quotes 必须在 0 到 1 之间")
+	}
+	if cfg.App.MarkdownTOCDepth < 0 || cfg.App.MarkdownTOCMaxEntries < 0 || cfg.App.MarkdownTOCPageSize < 0 {
+		return fmt.Errorf("toc-depth/toc-max-entries/toc-page-size 不能为负数")
+	}
+	if cfg.App.MarkdownPopularReplies < 0 {
+		return fmt.Errorf("popular-replies 不能为负数")
+	}
+	if !south2md.IsValidPopularStrategy(cfg.App.MarkdownPopularStrategy) {
+		return fmt.Errorf("不支持的热门回复排序策略 %q (可选: %s)", cfg.App.MarkdownPopularStrategy, strings.Join(south2md.PopularStrategies, ", "))
+	}
+	if !south2md.IsValidImageStyle(cfg.App.MarkdownImageStyle) {
+		return fmt.Errorf("不支持的图片链接样式 %q (可选: %s)", cfg.App.MarkdownImageStyle, strings.Join(south2md.ImageStyles, ", "))
+	}
+	if !south2md.IsValidLineBreakStyle(cfg.App.MarkdownLineBreaks) {
+		return fmt.Errorf("不支持的换行样式 %q (可选: %s)", cfg.App.MarkdownLineBreaks, strings.Join(south2md.LineBreakStyles, ", "))
+	}
+	if cfg.App.MarkdownSplitEvery < 0 {
+		return fmt.Errorf("split-every 不能为负数")
+	}
+	if _, err := south2md.ResolveSelectorProfile(cfg.App.SelectorProfile, cfg.App.Selectors); err != nil {
+		return err
+	}
+	if _, err := south2md.NewContentFilter(cfg.App.Filters); err != nil {
+		return fmt.Errorf("过滤规则无效: %w", err)
+	}
+	if cfg.App.TranslateBackend != "" {
+		if !slices.Contains(south2md.TranslateBackends, cfg.App.TranslateBackend) {
+			return fmt.Errorf("不支持的翻译后端 %q (可选: %s)", cfg.App.TranslateBackend, strings.Join(south2md.TranslateBackends, ", "))
+		}
+		if !slices.Contains(south2md.TranslateModes, cfg.App.TranslateMode) {
+			return fmt.Errorf("不支持的翻译模式 %q (可选: %s)", cfg.App.TranslateMode, strings.Join(south2md.TranslateModes, ", "))
+		}
+		if cfg.App.TranslateTarget == "" || strings.ContainsAny(cfg.App.TranslateTarget, `/\.`) {
+			return fmt.Errorf("无效的翻译目标语言 %q", cfg.App.TranslateTarget)
+		}
+	}
+	if !south2md.IsValidExportFormat(cfg.App.OutputFormat) {
+		return fmt.Errorf("不支持的导出格式 %q (可选: %s)", cfg.App.OutputFormat, strings.Join(south2md.ExportFormats, ", "))
+	}
+	if cfg.App.GitCommit {
+		if cfg.App.OutputFile == "" {
+			return fmt.Errorf("--git-commit 需要用 --output 指定导出目录")
+		}
+		if south2md.IsWebDAVTarget(cfg.App.OutputFile) {
+			return fmt.Errorf("--git-commit 不支持 WebDAV 导出")
+		}
+		if _, err := exec.LookPath("git"); err != nil {
+			return fmt.Errorf("--git-commit 需要安装 git")
+		}
+	}
 	if !cfg.Offline && cfg.App.TID == "" && cfg.InputFile == "" {
 		return fmt.Errorf("必须指定帖子ID或 --input 参数")
 	}
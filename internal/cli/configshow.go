@@ -0,0 +1,232 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fdkevin0/south2md"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// configCmd 配置命令
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "配置工具",
+	Long:  `查看合并默认值、配置文件、环境变量和命令行参数后的生效配置`,
+}
+
+// configShowCmd 显示生效配置命令
+var configShowCmd = &cobra.Command{
+	Use:   "show [TID|URL...]",
+	Short: "Print the effective configuration and where each value came from",
+	Long: `Print every config key with the value a run with the same flags, environment and
+config file would use, followed by its source: a flag, an environment variable, the
+config file, a [sites.<name>] block or the built-in default. Pass thread URLs to see
+which site block they select. Secrets are masked.`,
+	Example: `  # Show the configuration of a plain run
+  south2md config show
+
+  # Check what an environment variable and a site block change
+  SOUTH2MD_MAX_CONCURRENT=2 south2md config show https://north-plus.net/read.php?tid-2636739.html`,
+	Args: cobra.ArbitraryArgs,
+	RunE: runConfigShow,
+}
+
+// secretConfigKeys are masked when printed.
+var secretConfigKeys = map[string]bool{
+	"webdav_password":   true,
+	"translate_api_key": true,
+	"gofile_token":      true,
+	"api_token":         true,
+	"telegram_token":    true,
+}
+
+// derivedConfigKeys are set from another key by configsource, e.g. --no-cache
+// sets enable_cache.
+var derivedConfigKeys = map[string]string{
+	"enable_cache":      "no_cache",
+	"wayback":           "no_wayback",
+	"strict_pagination": "strict_pages",
+}
+
+func runConfigShow(cmd *cobra.Command, args []string) error {
+	runtimeConfig, v, err := loadRuntimeConfig(cmd, args)
+	if err != nil {
+		return fmt.Errorf("初始化配置失败: %v", err)
+	}
+	if err := printEffectiveConfig(cmd.OutOrStdout(), cmd, v, runtimeConfig); err != nil {
+		return err
+	}
+	// Without a thread the fetch checks don't apply; the rest still do.
+	if runtimeConfig.App.TID == "" && runtimeConfig.InputFile == "" && !runtimeConfig.Offline {
+		runtimeConfig.App.TID = "-"
+	}
+	if err := validateRuntimeConfig(runtimeConfig); err != nil {
+		fmt.Fprintf(cmd.OutOrStdout(), "# 警告: 配置无效: %v\n", err)
+	}
+	return nil
+}
+
+// printEffectiveConfig writes the config keys of cfg as TOML lines, each
+// followed by a comment naming its source.
+func printEffectiveConfig(w io.Writer, cmd *cobra.Command, v *viper.Viper, cfg *runtimeConfig) error {
+	if cfg.ConfigFile != "" {
+		fmt.Fprintf(w, "# 配置文件: %s\n", cfg.ConfigFile)
+	} else {
+		fmt.Fprintln(w, "# 配置文件: (无)")
+	}
+
+	flags := configFlags(cmd)
+	siteKeys := appliedSiteKeys(cmd, cfg.App)
+	source := func(key string) string {
+		if siteKeys[key] {
+			return fmt.Sprintf("[sites.%s]", cfg.App.Site)
+		}
+		if f := flags[key]; f != nil && f.Changed {
+			return "flag --" + f.Name
+		}
+		env := "SOUTH2MD_" + strings.ToUpper(key)
+		if _, ok := os.LookupEnv(env); ok {
+			return "env " + env
+		}
+		if v.InConfig(key) {
+			return "config file"
+		}
+		return ""
+	}
+
+	value := reflect.ValueOf(cfg.App).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		key := strings.Split(value.Type().Field(i).Tag.Get("mapstructure"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		from := source(key)
+		if from == "" {
+			if derived, ok := derivedConfigKeys[key]; ok {
+				if from = source(derived); from != "" {
+					from += " (" + derived + ")"
+				}
+			}
+		}
+		if from == "" {
+			from = "default"
+		}
+		formatted, err := formatConfigValue(value.Field(i).Interface())
+		if err != nil {
+			return fmt.Errorf("格式化配置项 %s 失败: %w", key, err)
+		}
+		if secretConfigKeys[key] && formatted != `""` {
+			formatted = `"***"`
+		}
+		fmt.Fprintf(w, "%s = %s # %s\n", key, formatted, from)
+	}
+	return nil
+}
+
+// configFlags maps config keys to the flags bound to them.
+func configFlags(cmd *cobra.Command) map[string]*pflag.Flag {
+	flags := make(map[string]*pflag.Flag)
+	add := func(f *pflag.Flag) {
+		flags[strings.ReplaceAll(f.Name, "-", "_")] = f
+	}
+	cmd.InheritedFlags().VisitAll(add)
+	cmd.Flags().VisitAll(add)
+	// configsource aliases output_file to the --output flag.
+	if f := flags["output"]; f != nil {
+		flags["output_file"] = f
+	}
+	return flags
+}
+
+// appliedSiteKeys returns the config keys the selected [sites.<name>] block
+// set, i.e. those it has a value for and no flag overrides.
+func appliedSiteKeys(cmd *cobra.Command, cfg *south2md.Config) map[string]bool {
+	keys := make(map[string]bool)
+	site, ok := south2md.LookupSite(cfg.Sites, cfg.Site)
+	if cfg.Site == "" || !ok {
+		return keys
+	}
+	value := reflect.ValueOf(site)
+	for i := 0; i < value.NumField(); i++ {
+		key := value.Type().Field(i).Tag.Get("mapstructure")
+		if value.Field(i).IsZero() {
+			continue
+		}
+		if f := cmdFlag(cmd, siteFlags[key]); f != nil && f.Changed {
+			continue
+		}
+		keys[key] = true
+	}
+	return keys
+}
+
+// formatConfigValue renders a config value as TOML, with maps and structs as
+// inline tables leaving out empty fields.
+func formatConfigValue(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("%q", v), nil
+	case time.Duration:
+		return fmt.Sprintf("%q", v.String()), nil
+	case bool, int, int64, float64:
+		return fmt.Sprint(v), nil
+	case []string:
+		quoted := make([]string, len(v))
+		for i, s := range v {
+			quoted[i] = fmt.Sprintf("%q", s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]", nil
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Map && rv.Len() == 0 {
+		return "{}", nil
+	}
+	if rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String {
+		keys := make([]string, 0, rv.Len())
+		for _, key := range rv.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, key := range keys {
+			formatted, err := formatConfigValue(rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key())).Interface())
+			if err != nil {
+				return "", err
+			}
+			parts[i] = fmt.Sprintf("%q = %s", key, formatted)
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", nil
+	}
+	if rv.Kind() == reflect.Struct {
+		var parts []string
+		for i := 0; i < rv.NumField(); i++ {
+			key := strings.Split(rv.Type().Field(i).Tag.Get("toml"), ",")[0]
+			if key == "" || key == "-" || rv.Field(i).IsZero() {
+				continue
+			}
+			formatted, err := formatConfigValue(rv.Field(i).Interface())
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, fmt.Sprintf("%s = %s", key, formatted))
+		}
+		if len(parts) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fdkevin0/south2md"
+	"github.com/spf13/cobra"
+)
+
+// exportCmd 增量导出命令
+var exportCmd = &cobra.Command{
+	Use:   "export <TID>",
+	Short: "Export only the floors of a stored thread added after a floor or date",
+	Long: `Render the floors of a stored thread that come after --since-floor, or were posted after
+--since-date, as one markdown digest of what's new. Nothing is fetched; archive the thread first.
+The digest goes to stdout, or to --output (a .md file, or <tid>-delta.md in a directory); its
+image links point into the store. When both flags are set a floor must pass both.`,
+	Example: `  # Floors after B120F
+  south2md export 2636739 --since-floor=120
+
+  # Floors posted since October, written to a file
+  south2md export 2636739 --since-date=2026-10-01 --output=./digest.md`,
+	Args: cobra.ExactArgs(1),
+	RunE: runExport,
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	filter := south2md.DeltaFilter{SinceFloor: -1}
+	if cmd.Flags().Changed("since-floor") {
+		if flagExportSinceFloor < 0 {
+			return fmt.Errorf("since-floor 不能为负数")
+		}
+		filter.SinceFloor = flagExportSinceFloor
+	}
+	if flagExportSinceDate != "" {
+		since, err := south2md.ParseDeltaTime(flagExportSinceDate)
+		if err != nil {
+			return fmt.Errorf("无效的 --since-date: %v", err)
+		}
+		filter.SinceDate = since
+	}
+	if filter.SinceFloor < 0 && filter.SinceDate.IsZero() {
+		return fmt.Errorf("需要指定 --since-floor 或 --since-date")
+	}
+
+	runtimeConfig, err := buildRuntimeConfig(cmd, args)
+	if err != nil {
+		return fmt.Errorf("初始化配置失败: %v", err)
+	}
+	cfg := runtimeConfig.App
+	if err := initLogger(runtimeConfig.Debug, runtimeConfig.App); err != nil {
+		return err
+	}
+	if south2md.IsWebDAVTarget(cfg.OutputFile) {
+		return fmt.Errorf("export 不支持 WebDAV 导出")
+	}
+
+	store := openPostStore(cfg)
+	post, err := store.LoadPostFromStore(cfg.TID)
+	if err != nil {
+		return fmt.Errorf("加载帖子失败: %v", err)
+	}
+	generator, err := newMarkdownGenerator(cfg)
+	if err != nil {
+		return err
+	}
+	generator.SetDownloadEnabled(false)
+	imageDir := filepath.ToSlash(filepath.Join(store.PostDir(post.TID), "images"))
+	markdown, count, err := generator.GenerateDelta(post, filter, imageDir)
+	if err != nil {
+		return fmt.Errorf("生成增量导出失败: %v", err)
+	}
+
+	status := cmd.ErrOrStderr()
+	if count == 0 {
+		fmt.Fprintln(status, "没有新楼层")
+		return nil
+	}
+	if cfg.OutputFile == "" {
+		fmt.Fprint(cmd.OutOrStdout(), markdown)
+	} else {
+		target := cfg.OutputFile
+		if !strings.EqualFold(filepath.Ext(target), ".md") {
+			target = filepath.Join(target, post.TID+"-delta.md")
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("创建导出目录失败: %v", err)
+		}
+		if err := os.WriteFile(target, []byte(markdown), 0644); err != nil {
+			return fmt.Errorf("写入增量导出失败: %v", err)
+		}
+		fmt.Fprintf(status, "✓ 增量导出已写入 %s\n", target)
+	}
+	fmt.Fprintf(status, "✓ 导出了 %d 个新楼层", count)
+	if last := lastFloorNumber(post); last > 0 {
+		fmt.Fprintf(status, "，下次可用 --since-floor=%d", last)
+	}
+	fmt.Fprintln(status)
+	return nil
+}
+
+// lastFloorNumber returns the number of the last floor of post, or 0 when it
+// has no numbered replies.
+func lastFloorNumber(post *south2md.Post) int {
+	if len(post.Replies) == 0 {
+		return 0
+	}
+	n, _ := south2md.FloorNumber(post.Replies[len(post.Replies)-1].Floor)
+	return n
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fdkevin0/south2md"
+)
+
+// newGofilePrompt returns a selector that lists each share's files on out and
+// reads the chosen indexes from in. Prompts are serialized so parallel
+// threads do not interleave.
+func newGofilePrompt(in io.Reader, out io.Writer) south2md.GofileFileSelector {
+	var mu sync.Mutex
+	reader := bufio.NewReader(in)
+	return func(shareURL string, files []south2md.GofileManifestEntry) ([]south2md.GofileManifestEntry, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var total int64
+		fmt.Fprintf(out, "\ngofile 分享 %s:\n", shareURL)
+		for i, file := range files {
+			total += file.Size
+			fmt.Fprintf(out, "  [%d] %s (%s)\n", i+1, file.Path, south2md.FormatByteSize(file.Size))
+		}
+		fmt.Fprintf(out, "共 %d 个文件, %s\n", len(files), south2md.FormatByteSize(total))
+
+		for {
+			fmt.Fprint(out, "选择要下载的文件 (如 1,3-5；回车或 all 为全部，none 为跳过): ")
+			line, err := reader.ReadString('\n')
+			if err != nil && line == "" {
+				return nil, fmt.Errorf("读取选择失败: %w", err)
+			}
+			indexes, parseErr := parseGofileSelection(line, len(files))
+			if parseErr != nil {
+				fmt.Fprintln(out, parseErr)
+				if err != nil {
+					return nil, parseErr
+				}
+				continue
+			}
+			chosen := make([]south2md.GofileManifestEntry, 0, len(indexes))
+			for _, index := range indexes {
+				chosen = append(chosen, files[index])
+			}
+			return chosen, nil
+		}
+	}
+}
+
+// parseGofileSelection parses a 1-based selection such as "1,3-5" into
+// 0-based indexes below n. Empty input and "all" select everything.
+func parseGofileSelection(input string, n int) ([]int, error) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	switch input {
+	case "", "all":
+		indexes := make([]int, n)
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes, nil
+	case "none":
+		return nil, nil
+	}
+
+	seen := make(map[int]bool)
+	var indexes []int
+	for _, part := range strings.Split(input, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf("无效的选择 %q", part)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+				return nil, fmt.Errorf("无效的选择 %q", part)
+			}
+		}
+		if start < 1 || end > n || start > end {
+			return nil, fmt.Errorf("选择 %q 超出范围 1-%d", part, n)
+		}
+		for i := start; i <= end; i++ {
+			if !seen[i-1] {
+				seen[i-1] = true
+				indexes = append(indexes, i-1)
+			}
+		}
+	}
+	return indexes, nil
+}
+
+// stdinIsTerminal reports whether stdin is an interactive terminal.
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fdkevin0/south2md"
+	"github.com/spf13/cobra"
+)
+
+// historyCmd 运行历史命令
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List past runs with their threads, duration, downloaded bytes and errors",
+	Long: `Every fetch, offline export, retry and regen, and every job of serve and tui, is recorded in
+history.jsonl in the data directory when it ends. history lists the latest runs, newest first;
+history show prints one run in full.`,
+	Example: `  # The last 20 runs
+  south2md history
+
+  # Failed runs of one thread
+  south2md history --tid=2636739 --failed
+
+  # Details of run 42
+  south2md history show 42`,
+	Args: cobra.NoArgs,
+	RunE: runHistory,
+}
+
+// historyShowCmd 运行详情命令
+var historyShowCmd = &cobra.Command{
+	Use:   "show <ID>",
+	Short: "Show one run of the history",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runHistoryShow,
+}
+
+// loadHistory returns the run history and the thread --tid filters it by.
+func loadHistory(cmd *cobra.Command) ([]south2md.RunRecord, string, error) {
+	runtimeConfig, err := buildThreadlessConfig(cmd, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("初始化配置失败: %v", err)
+	}
+	if err := initLogger(runtimeConfig.Debug, runtimeConfig.App); err != nil {
+		return nil, "", err
+	}
+	records, err := openPostStore(runtimeConfig.App).LoadHistory()
+	if err != nil {
+		return nil, "", fmt.Errorf("读取运行历史失败: %v", err)
+	}
+	return records, runtimeConfig.App.TID, nil
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	if flagHistoryLimit < 0 {
+		return fmt.Errorf("limit 不能为负数")
+	}
+	records, tid, err := loadHistory(cmd)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	shown := 0
+	for _, rec := range slices.Backward(records) {
+		if flagHistoryLimit > 0 && shown == flagHistoryLimit {
+			break
+		}
+		if (tid != "" && !slices.Contains(rec.TIDs, tid)) || (flagHistoryFailed && rec.OK()) {
+			continue
+		}
+		status := "✓"
+		if !rec.OK() {
+			status = "✗ " + rec.Error
+		}
+		fmt.Fprintf(out, "%-5d %s  %-7s %-20s %8s %10s  %s\n", rec.ID, rec.StartedAt.Local().Format("2006-01-02 15:04:05"),
+			rec.Command, historyTIDs(rec.TIDs), rec.Duration, south2md.FormatByteSize(rec.Bytes), status)
+		shown++
+	}
+	if shown == 0 {
+		fmt.Fprintln(out, "没有匹配的运行记录")
+	}
+	return nil
+}
+
+func runHistoryShow(cmd *cobra.Command, args []string) error {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("无效的运行ID %q", args[0])
+	}
+	records, _, err := loadHistory(cmd)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(records, func(rec south2md.RunRecord) bool { return rec.ID == id })
+	if i < 0 {
+		return fmt.Errorf("未找到运行记录 %d", id)
+	}
+	rec := records[i]
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "运行:   %d\n", rec.ID)
+	fmt.Fprintf(out, "命令:   %s\n", rec.Command)
+	fmt.Fprintf(out, "帖子:   %s\n", strings.Join(rec.TIDs, ", "))
+	fmt.Fprintf(out, "开始:   %s\n", rec.StartedAt.Local().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(out, "耗时:   %s\n", rec.Duration)
+	fmt.Fprintf(out, "页面:   %d\n", rec.Pages)
+	fmt.Fprintf(out, "图片:   %d\n", rec.Images)
+	fmt.Fprintf(out, "下载:   %s\n", south2md.FormatByteSize(rec.Bytes))
+	if rec.Output != "" {
+		fmt.Fprintf(out, "导出:   %s\n", rec.Output)
+	}
+	if rec.OK() {
+		fmt.Fprintln(out, "结果:   ✓ 成功")
+	} else {
+		fmt.Fprintf(out, "结果:   ✗ %s\n", rec.Error)
+	}
+	return nil
+}
+
+// historyTIDs shortens the thread list of a run to one column.
+func historyTIDs(tids []string) string {
+	switch len(tids) {
+	case 0:
+		return "-"
+	case 1:
+		return tids[0]
+	default:
+		return fmt.Sprintf("%s +%d", tids[0], len(tids)-1)
+	}
+}
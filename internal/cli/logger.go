@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/fdkevin0/south2md"
+	"github.com/lmittmann/tint"
+)
+
+// Log formats accepted by --log-format.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// logOutput is the current log file, closed when the logger is replaced.
+var logOutput io.Closer
+
+// initLogger initializes the global slog logger. Logs go to stderr as tinted
+// text unless cfg names a log file, which is rotated by size; cfg may be nil.
+func initLogger(debug bool, cfg *south2md.Config) error {
+	level := slog.LevelWarn
+	if debug {
+		level = slog.LevelDebug
+	}
+
+	var w io.Writer = os.Stderr
+	format, toFile := logFormatText, false
+	if cfg != nil {
+		if cfg.LogFormat != "" {
+			format = cfg.LogFormat
+		}
+		if cfg.LogFile != "" {
+			file, err := openRotatingFile(cfg.LogFile, cfg.LogMaxSize*1024*1024, cfg.LogMaxBackups)
+			if err != nil {
+				return fmt.Errorf("打开日志文件失败: %w", err)
+			}
+			closeLogOutput()
+			logOutput = file
+			w, toFile = file, true
+		}
+	}
+
+	var handler slog.Handler
+	switch format {
+	case logFormatJSON:
+		handler = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+	case logFormatText:
+		handler = tint.NewHandler(w, &tint.Options{
+			Level:      level,
+			TimeFormat: time.DateTime,
+			NoColor:    toFile,
+		})
+	default:
+		return fmt.Errorf("不支持的日志格式 %q (可选: %s, %s)", format, logFormatText, logFormatJSON)
+	}
+
+	// Set global logger with custom options
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+func closeLogOutput() {
+	if logOutput != nil {
+		_ = logOutput.Close()
+		logOutput = nil
+	}
+}
+
+// teeHandler passes each record to every handler enabled for its level.
+type teeHandler []slog.Handler
+
+func (h teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h teeHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, handler := range h {
+		if handler.Enabled(ctx, record.Level) {
+			errs = append(errs, handler.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (h teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return handlers
+}
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/fdkevin0/south2md"
+)
+
+// Probe intervals while the forum is under maintenance: the first retry waits
+// maintenanceProbeInitial, and each retry after that waits twice as long, up
+// to maintenanceProbeMax.
+const (
+	maintenanceProbeInitial = time.Minute
+	maintenanceProbeMax     = 30 * time.Minute
+)
+
+// maintenanceBackoff pauses fetching while the forum serves its maintenance
+// page. The first thread to hit it announces the pause once and retries at
+// doubling intervals; other threads sharing the back-off wait until it gets
+// through, then retry theirs.
+type maintenanceBackoff struct {
+	initial, max time.Duration
+	out          io.Writer
+
+	mu      sync.Mutex
+	paused  chan struct{} // closed when the current pause ends; nil when not paused
+	resumes int           // pauses that have ended
+}
+
+// newMaintenanceBackoff announces pauses on out, or in the log when out is
+// nil.
+func newMaintenanceBackoff(out io.Writer) *maintenanceBackoff {
+	return &maintenanceBackoff{initial: maintenanceProbeInitial, max: maintenanceProbeMax, out: out}
+}
+
+// run calls archive until it returns something other than a maintenance
+// error or ctx is done.
+func (b *maintenanceBackoff) run(ctx context.Context, archive func() error) error {
+	for {
+		if err := b.wait(ctx); err != nil {
+			return err
+		}
+		b.mu.Lock()
+		resumes := b.resumes
+		b.mu.Unlock()
+		err := archive()
+		if !south2md.IsMaintenanceError(err) {
+			return err
+		}
+		b.mu.Lock()
+		if b.paused != nil || b.resumes != resumes {
+			// Another thread is already probing the forum, or got through
+			// while this attempt was running.
+			b.mu.Unlock()
+			continue
+		}
+		paused := make(chan struct{})
+		b.paused = paused
+		b.mu.Unlock()
+
+		err = b.probe(ctx, archive)
+
+		b.mu.Lock()
+		b.paused = nil
+		b.resumes++
+		close(paused)
+		b.mu.Unlock()
+		return err
+	}
+}
+
+// stage wraps stage so that it backs off while the forum is under
+// maintenance. The wrapped stage keeps its name.
+func (b *maintenanceBackoff) stage(stage south2md.Stage) south2md.Stage {
+	return south2md.NewStage(stage.Name(), func(ctx context.Context, state *south2md.PipelineState) error {
+		return b.run(ctx, func() error { return stage.Run(ctx, state) })
+	})
+}
+
+// wait blocks while the batch is paused.
+func (b *maintenanceBackoff) wait(ctx context.Context) error {
+	b.mu.Lock()
+	paused := b.paused
+	b.mu.Unlock()
+	if paused == nil {
+		return nil
+	}
+	select {
+	case <-paused:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// probe retries archive at doubling intervals while it fails with a
+// maintenance error.
+func (b *maintenanceBackoff) probe(ctx context.Context, archive func() error) error {
+	interval := b.initial
+	if b.out != nil {
+		fmt.Fprintf(b.out, "论坛维护中，暂停抓取，%s 后重试\n", interval)
+	} else {
+		slog.Warn("Forum under maintenance, pausing fetches", "retry_in", interval)
+	}
+	for {
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		err := archive()
+		if !south2md.IsMaintenanceError(err) {
+			if b.out != nil {
+				fmt.Fprintln(b.out, "论坛维护已结束，继续抓取")
+			} else {
+				slog.Info("Forum maintenance ended, resuming fetches")
+			}
+			return err
+		}
+		interval = min(interval*2, b.max)
+		slog.Info("Forum still under maintenance", "retry_in", interval)
+	}
+}
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fdkevin0/south2md"
+)
+
+// Events written by --json-progress.
+const (
+	progressPageFetched     = "page_fetched"
+	progressFloorExtracted  = "floor_extracted"
+	progressImageDownloaded = "image_downloaded"
+	progressDone            = "done"
+)
+
+// progressEvent is one line of --json-progress output.
+type progressEvent struct {
+	Event  string    `json:"event"`
+	Time   time.Time `json:"time"`
+	TID    string    `json:"tid,omitempty"`
+	Page   int       `json:"page,omitempty"`
+	Floor  string    `json:"floor,omitempty"`
+	PostID string    `json:"post_id,omitempty"`
+	URL    string    `json:"url,omitempty"`
+	Path   string    `json:"path,omitempty"`
+	Bytes  int64     `json:"bytes,omitempty"`
+	Floors int       `json:"floors,omitempty"`
+	Images int       `json:"images,omitempty"`
+	Output string    `json:"output,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// progressEmitter writes progress events as newline-delimited JSON. It keeps
+// the bytes fetched per thread for the done event. A nil emitter writes
+// nothing.
+type progressEmitter struct {
+	mu    sync.Mutex
+	enc   *json.Encoder
+	bytes map[string]int64
+}
+
+// newProgressEmitter returns an emitter writing to w, or nil when enabled is
+// false.
+func newProgressEmitter(w io.Writer, enabled bool) *progressEmitter {
+	if !enabled {
+		return nil
+	}
+	return &progressEmitter{enc: json.NewEncoder(w), bytes: make(map[string]int64)}
+}
+
+func (p *progressEmitter) emit(event progressEvent) {
+	if p == nil {
+		return
+	}
+	event.Time = time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bytes[event.TID] += event.Bytes
+	if event.Event == progressDone {
+		event.Bytes = p.bytes[event.TID]
+		delete(p.bytes, event.TID)
+	}
+	_ = p.enc.Encode(event)
+}
+
+// output returns where human-readable progress goes: stdout, or nowhere
+// when stdout carries events.
+func (p *progressEmitter) output() io.Writer {
+	if p != nil {
+		return io.Discard
+	}
+	return os.Stdout
+}
+
+// rawPageHandler chains a page_fetched event before next, which may be nil.
+// It returns next unchanged for a nil emitter.
+func (p *progressEmitter) rawPageHandler(next south2md.RawPageHandler) south2md.RawPageHandler {
+	if p == nil {
+		return next
+	}
+	return func(tid string, page int, html string) {
+		p.emit(progressEvent{Event: progressPageFetched, TID: tid, Page: page, Bytes: int64(len(html))})
+		if next != nil {
+			next(tid, page, html)
+		}
+	}
+}
+
+// attach reports the images generator downloads.
+func (p *progressEmitter) attach(generator *south2md.MarkdownGenerator) {
+	if p == nil {
+		return
+	}
+	generator.SetImageDownloadHandler(func(tid, url, path string, size int64) {
+		p.emit(progressEvent{Event: progressImageDownloaded, TID: tid, URL: url, Path: path, Bytes: size})
+	})
+}
+
+// addFloorEvents reports the floors of the post right after the stage named
+// anchor, which produces it.
+func (p *progressEmitter) addFloorEvents(pipeline *south2md.Pipeline, anchor string) {
+	if p == nil {
+		return
+	}
+	_ = pipeline.InsertAfter(anchor, south2md.NewStage("progress", func(ctx context.Context, state *south2md.PipelineState) error {
+		post := state.Post
+		for _, entry := range append([]south2md.PostEntry{post.MainPost}, post.Replies...) {
+			p.emit(progressEvent{Event: progressFloorExtracted, TID: post.TID, Page: entry.SourcePage, Floor: entry.Floor, PostID: entry.PostID})
+		}
+		return nil
+	}))
+}
+
+// done reports the end of thread tid with the post and output of state,
+// either of which may be unset, and err. Without an export the output is the
+// thread's store directory.
+func (p *progressEmitter) done(store *south2md.PostStore, tid string, state *south2md.PipelineState, err error) {
+	if p == nil {
+		return
+	}
+	event := progressEvent{Event: progressDone, TID: tid}
+	if state != nil {
+		event.Output = state.Output
+		if state.Post != nil {
+			event.TID = state.Post.TID
+			event.Floors = state.Post.TotalFloors
+			event.Images = len(state.Post.Images)
+		}
+	}
+	if err != nil {
+		event.Error = err.Error()
+	} else if event.Output == "" && event.TID != "" {
+		event.Output = store.PostDir(event.TID)
+	}
+	p.emit(event)
+}
@@ -0,0 +1,539 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fdkevin0/south2md"
+	"github.com/spf13/cobra"
+)
+
+// serveCmd 控制API服务命令
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run as a daemon with an HTTP API to queue threads, track jobs, list the archive and stream logs",
+	Long: `Listen on --api-addr and archive the threads queued over the API with the flags and config
+of a normal run, --threads-parallel at a time. Fetched threads are stored, not exported.
+
+  POST /api/jobs       queue threads: {"threads": ["2636739", "https://north-plus.net/read.php?tid-2636739.html"]}
+  GET  /api/jobs       all jobs with their status and progress
+  GET  /api/jobs/{id}  one job
+  GET  /api/posts      stored threads; filter with ?tag=, ?forum=, ?since=, ?until=, ?pending=,
+                       page with ?limit= and ?cursor=, select fields with ?fields=tid,title
+  GET  /api/logs       recent and live log records as newline-delimited JSON
+
+With --api-token every request must send "Authorization: Bearer <token>". Without a token
+the API only listens on a loopback address.
+
+With --telegram-token a Telegram bot also queues the threads the --telegram-users send it
+and replies with the exported thread.`,
+	Example: `  # Serve on all interfaces with a token from the environment
+  SOUTH2MD_API_TOKEN=secret south2md serve --api-addr=:8790
+
+  # Queue a thread
+  curl -H 'Authorization: Bearer secret' -d '{"threads":["2636739"]}' http://localhost:8790/api/jobs`,
+	Args: cobra.NoArgs,
+	RunE: runServe,
+}
+
+// apiQueueSize is the number of jobs that can wait for a worker.
+const apiQueueSize = 1024
+
+// apiLogBacklog is the number of recent log records sent to new /api/logs
+// clients.
+const apiLogBacklog = 200
+
+// Job states reported by the API.
+const (
+	apiJobQueued  = "queued"
+	apiJobRunning = "running"
+	apiJobDone    = "done"
+	apiJobFailed  = "failed"
+)
+
+// apiJob is one queued thread. Fields are guarded by apiServer.mu.
+type apiJob struct {
+	ID         int                    `json:"id"`
+	TID        string                 `json:"tid"`
+	BaseURL    string                 `json:"base_url,omitempty"`
+	Status     string                 `json:"status"`
+	Message    string                 `json:"message,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Pages      int                    `json:"pages"`
+	Images     int                    `json:"images"`
+	Bytes      int64                  `json:"bytes"`
+	NewFloors  []south2md.FloorChange `json:"new_floors,omitempty"` // floors a stored thread gained, with their first lines
+	CreatedAt  time.Time              `json:"created_at"`
+	StartedAt  *time.Time             `json:"started_at,omitempty"`
+	FinishedAt *time.Time             `json:"finished_at,omitempty"`
+
+	metrics *south2md.Metrics
+	notify  func(apiJob)
+}
+
+// apiPostFields lists the JSON fields of a /api/posts entry that ?fields=
+// can select.
+var apiPostFields = []string{"tid", "title", "url", "forum", "prefixes", "tags", "views", "reply_count", "total_floors", "images", "missing_pages", "pending", "created_at"}
+
+// parseAPIPostQuery reads the filters and page of a /api/posts request, and
+// the fields to return (nil for all).
+func parseAPIPostQuery(values url.Values) (query south2md.CatalogQuery, fields []string, err error) {
+	query = south2md.CatalogQuery{Tags: values["tag"], Forum: values.Get("forum"), After: values.Get("cursor")}
+	for name, at := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if value := values.Get(name); value != "" {
+			if *at, err = parseAPITime(value); err != nil {
+				return query, nil, fmt.Errorf("invalid %s: %q", name, value)
+			}
+		}
+	}
+	if value := values.Get("pending"); value != "" {
+		pending, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, nil, fmt.Errorf("invalid pending: %q", value)
+		}
+		query.Pending = &pending
+	}
+	if value := values.Get("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil || query.Limit < 1 {
+			return query, nil, fmt.Errorf("invalid limit: %q", value)
+		}
+	}
+	if value := values.Get("fields"); value != "" {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if !slices.Contains(apiPostFields, field) {
+				return query, nil, fmt.Errorf("unknown field %q", field)
+			}
+			fields = append(fields, field)
+		}
+	}
+	return query, fields, nil
+}
+
+// parseAPITime parses an RFC 3339 timestamp or a YYYY-MM-DD date (UTC).
+func parseAPITime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// apiServer queues threads for a pool of workers and serves the control
+// API.
+type apiServer struct {
+	ctx     context.Context
+	token   string
+	store   *south2md.PostStore
+	archive archiveFunc
+	logs    *logBroadcaster
+	queue   chan *apiJob
+
+	mu   sync.Mutex
+	jobs []*apiJob
+}
+
+func newAPIServer(ctx context.Context, token string, store *south2md.PostStore, archive archiveFunc, logs *logBroadcaster) *apiServer {
+	return &apiServer{
+		ctx:     ctx,
+		token:   token,
+		store:   store,
+		archive: archive,
+		logs:    logs,
+		queue:   make(chan *apiJob, apiQueueSize),
+	}
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	runtimeConfig, err := buildThreadlessConfig(cmd, args)
+	if err != nil {
+		return fmt.Errorf("初始化配置失败: %v", err)
+	}
+	cfg := runtimeConfig.App
+	if cfg.APIToken == "" && !isLoopbackAddr(cfg.APIAddr) {
+		return fmt.Errorf("监听非本机地址 %s 时必须设置 --api-token", cfg.APIAddr)
+	}
+	if cfg.TelegramToken != "" && len(cfg.TelegramUsers) == 0 {
+		return fmt.Errorf("设置 --telegram-token 时必须用 --telegram-users 指定允许使用机器人的用户")
+	}
+
+	if err := initLogger(runtimeConfig.Debug, cfg); err != nil {
+		return err
+	}
+	logs := &logBroadcaster{}
+	slog.SetDefault(slog.New(teeHandler{
+		slog.Default().Handler(),
+		slog.NewJSONHandler(logs, &slog.HandlerOptions{Level: slog.LevelInfo}),
+	}))
+
+	store := openPostStore(cfg)
+	if err := store.EnsureRoot(); err != nil {
+		return fmt.Errorf("初始化本地数据目录失败: %v", err)
+	}
+	httpOptions := south2md.HTTPOptionsFromConfig(cfg)
+	stopHAR := startHARRecording(cfg.RecordHAR, httpOptions)
+	defer stopHAR()
+	client := south2md.NewHTTPClient(httpOptions)
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	server := newAPIServer(ctx, cfg.APIToken, store, withHistory(store, "serve", newThreadArchiver(cfg, store, client, httpOptions, newWaybackSaver(cfg, client))), logs)
+	server.start(cfg.ThreadsParallel)
+	if cfg.TelegramToken != "" {
+		bot := newTelegramBot(south2md.NewTelegramBot(slowRequestClient(httpOptions), "", cfg.TelegramToken), server, cfg)
+		go bot.run(ctx)
+		slog.Info("Telegram bot started", "users", len(cfg.TelegramUsers))
+	}
+
+	listener, err := net.Listen("tcp", cfg.APIAddr)
+	if err != nil {
+		return fmt.Errorf("监听 %s 失败: %w", cfg.APIAddr, err)
+	}
+	httpServer := &http.Server{Handler: server.handler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+	fmt.Fprintf(cmd.OutOrStdout(), "API 服务已启动: http://%s/api/\n", listener.Addr())
+	if err := httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// isLoopbackAddr reports whether addr only listens on a loopback interface.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// start runs workers goroutines archiving queued jobs until the server's
+// context ends.
+func (s *apiServer) start(workers int) {
+	for range max(workers, 1) {
+		go func() {
+			for {
+				select {
+				case job := <-s.queue:
+					s.runJob(job)
+				case <-s.ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (s *apiServer) runJob(job *apiJob) {
+	s.mu.Lock()
+	now := time.Now()
+	job.Status, job.StartedAt, job.metrics = apiJobRunning, &now, south2md.NewMetrics()
+	id, tid, baseURL, metrics := job.ID, job.TID, job.BaseURL, job.metrics
+	s.mu.Unlock()
+
+	slog.Info("Job started", "job", id, "tid", tid)
+	out := &lineWriter{send: func(line string) {
+		s.mu.Lock()
+		job.Message = line
+		s.mu.Unlock()
+		slog.Info("Job progress", "job", id, "tid", tid, "message", line)
+	}}
+	diff, err := s.archive(s.ctx, tid, baseURL, metrics, out)
+
+	s.mu.Lock()
+	now = time.Now()
+	job.Status, job.FinishedAt = apiJobDone, &now
+	if err != nil {
+		job.Status, job.Error = apiJobFailed, err.Error()
+	} else if diff != nil {
+		job.NewFloors = diff.NewFloors
+	}
+	s.mu.Unlock()
+	if err != nil {
+		slog.Warn("Job failed", "job", id, "tid", tid, "error", err)
+	} else {
+		slog.Info("Job finished", "job", id, "tid", tid)
+	}
+	if job.notify != nil {
+		job.notify(s.snapshot(job))
+	}
+}
+
+// snapshot returns a copy of job with its current progress.
+func (s *apiServer) snapshot(job *apiJob) apiJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *job
+	copied.Pages, copied.Images, copied.Bytes = metricsProgress(job.metrics)
+	return copied
+}
+
+func (s *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/jobs", s.handleEnqueue)
+	mux.HandleFunc("GET /api/jobs", s.handleJobs)
+	mux.HandleFunc("GET /api/jobs/{id}", s.handleJob)
+	mux.HandleFunc("GET /api/posts", s.handlePosts)
+	mux.HandleFunc("GET /api/logs", s.handleLogs)
+	return s.authenticate(mux)
+}
+
+// authenticate rejects requests without the bearer token when one is set.
+func (s *apiServer) authenticate(next http.Handler) http.Handler {
+	if s.token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="south2md"`)
+			writeAPIError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *apiServer) handleEnqueue(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Threads []string `json:"threads"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&request); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if len(request.Threads) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "no threads given")
+		return
+	}
+	snapshots, err := s.enqueue(request.Threads, nil)
+	switch {
+	case errors.Is(err, errQueueFull):
+		writeAPIError(w, http.StatusServiceUnavailable, err.Error())
+	case err != nil:
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeAPIJSON(w, http.StatusAccepted, snapshots)
+	}
+}
+
+// errQueueFull is returned by enqueue when the queue has no room for all
+// threads.
+var errQueueFull = errors.New("job queue is full")
+
+// enqueue queues a job per thread ID or URL in args, calling notify (if not
+// nil) with each finished job. Either all threads are queued or none.
+func (s *apiServer) enqueue(args []string, notify func(apiJob)) ([]apiJob, error) {
+	jobs := make([]*apiJob, 0, len(args))
+	for _, arg := range args {
+		tid, baseURL, ok := parseThreadRef(arg)
+		if !ok {
+			return nil, fmt.Errorf("not a thread ID or URL: %q", arg)
+		}
+		jobs = append(jobs, &apiJob{TID: tid, BaseURL: baseURL, Status: apiJobQueued, CreatedAt: time.Now(), notify: notify})
+	}
+
+	// Only enqueuers send on the queue and they hold mu, so the sends below
+	// can't block once the free space is checked.
+	s.mu.Lock()
+	if cap(s.queue)-len(s.queue) < len(jobs) {
+		s.mu.Unlock()
+		return nil, errQueueFull
+	}
+	snapshots := make([]apiJob, len(jobs))
+	for i, job := range jobs {
+		job.ID = len(s.jobs) + 1
+		s.jobs = append(s.jobs, job)
+		s.queue <- job
+		snapshots[i] = *job
+	}
+	s.mu.Unlock()
+	for _, job := range snapshots {
+		slog.Info("Job queued", "job", job.ID, "tid", job.TID)
+	}
+	return snapshots, nil
+}
+
+// parseThreadRef parses a thread ID or URL, reporting whether arg is one.
+func parseThreadRef(arg string) (tid, baseURL string, ok bool) {
+	tid, baseURL = south2md.ParseThreadArg(arg)
+	if _, err := strconv.ParseUint(tid, 10, 64); err != nil {
+		return "", "", false
+	}
+	return tid, baseURL, true
+}
+
+func (s *apiServer) handleJobs(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	jobs := append([]*apiJob(nil), s.jobs...)
+	s.mu.Unlock()
+	snapshots := make([]apiJob, len(jobs))
+	for i, job := range jobs {
+		snapshots[i] = s.snapshot(job)
+	}
+	writeAPIJSON(w, http.StatusOK, snapshots)
+}
+
+func (s *apiServer) handleJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	s.mu.Lock()
+	var job *apiJob
+	if err == nil && id >= 1 && id <= len(s.jobs) {
+		job = s.jobs[id-1]
+	}
+	s.mu.Unlock()
+	if job == nil {
+		writeAPIError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, s.snapshot(job))
+}
+
+// handlePosts lists stored threads from the store's catalog in TID order.
+// When ?limit= cuts the list short, the X-Next-Cursor header holds the
+// ?cursor= of the next page.
+func (s *apiServer) handlePosts(w http.ResponseWriter, r *http.Request) {
+	query, fields, err := parseAPIPostQuery(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	posts, next, err := south2md.QueryCatalog(s.store.RootDir(), query)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
+	if fields == nil {
+		writeAPIJSON(w, http.StatusOK, posts)
+		return
+	}
+	selected := make([]map[string]json.RawMessage, len(posts))
+	for i, post := range posts {
+		data, err := json.Marshal(post)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(data, &all); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		selected[i] = make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, ok := all[field]; ok {
+				selected[i][field] = value
+			}
+		}
+	}
+	writeAPIJSON(w, http.StatusOK, selected)
+}
+
+// handleLogs streams log records as newline-delimited JSON, starting with
+// the recent ones, until the client disconnects.
+func (s *apiServer) handleLogs(w http.ResponseWriter, r *http.Request) {
+	backlog, lines, unsubscribe := s.logs.subscribe()
+	defer unsubscribe()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	for _, line := range backlog {
+		_, _ = w.Write(line)
+	}
+	for {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case line := <-lines:
+			if _, err := w.Write(line); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeAPIJSON(w, status, map[string]string{"error": message})
+}
+
+// logBroadcaster passes each log record written to it to the /api/logs
+// clients, keeping the last apiLogBacklog records for clients that connect
+// later. Slow clients miss records rather than block logging.
+type logBroadcaster struct {
+	mu     sync.Mutex
+	recent [][]byte
+	subs   map[chan []byte]struct{}
+}
+
+func (b *logBroadcaster) Write(p []byte) (int, error) {
+	line := bytes.Clone(p)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.recent = append(b.recent, line)
+	if len(b.recent) > apiLogBacklog {
+		b.recent = b.recent[len(b.recent)-apiLogBacklog:]
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// subscribe returns the recent records and a channel receiving new ones
+// until unsubscribe is called.
+func (b *logBroadcaster) subscribe() (backlog [][]byte, lines <-chan []byte, unsubscribe func()) {
+	ch := make(chan []byte, 64)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs == nil {
+		b.subs = make(map[chan []byte]struct{})
+	}
+	b.subs[ch] = struct{}{}
+	return append([][]byte(nil), b.recent...), ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+}
@@ -0,0 +1,268 @@
+package cli
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fdkevin0/south2md"
+)
+
+// telegramPollTimeout is how long one getUpdates call waits for messages.
+const telegramPollTimeout = 50 * time.Second
+
+// telegramRetryDelay is the pause after a failed getUpdates call.
+const telegramRetryDelay = 5 * time.Second
+
+// telegramSnippetFloors is how many new floors a reply shows, keeping it
+// inside Telegram's message size limit.
+const telegramSnippetFloors = 5
+
+const telegramHelp = "发送帖子ID或链接 (可一次发送多个，以空格或换行分隔)，抓取完成后会回复导出的 Markdown 或压缩包。"
+
+// telegramBot queues the threads whitelisted users send to the bot on the
+// server's job queue and replies with the exported thread once its job
+// finishes.
+type telegramBot struct {
+	bot    *south2md.TelegramBot
+	server *apiServer
+	cfg    *south2md.Config
+	users  map[string]bool
+}
+
+func newTelegramBot(bot *south2md.TelegramBot, server *apiServer, cfg *south2md.Config) *telegramBot {
+	users := make(map[string]bool, len(cfg.TelegramUsers))
+	for _, user := range cfg.TelegramUsers {
+		users[user] = true
+	}
+	return &telegramBot{bot: bot, server: server, cfg: cfg, users: users}
+}
+
+// run polls for messages until ctx ends.
+func (b *telegramBot) run(ctx context.Context) {
+	var offset int64
+	for ctx.Err() == nil {
+		updates, err := b.bot.GetUpdates(ctx, offset, telegramPollTimeout)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("Failed to poll Telegram updates", "error", err)
+			select {
+			case <-time.After(telegramRetryDelay):
+			case <-ctx.Done():
+			}
+			continue
+		}
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			if update.Message != nil {
+				b.handle(ctx, update.Message)
+			}
+		}
+	}
+}
+
+// allowed reports whether user is on the whitelist by ID or @username.
+func (b *telegramBot) allowed(user *south2md.TelegramUser) bool {
+	if user == nil {
+		return false
+	}
+	if b.users[strconv.FormatInt(user.ID, 10)] {
+		return true
+	}
+	return user.Username != "" && b.users["@"+strings.ToLower(user.Username)]
+}
+
+func (b *telegramBot) handle(ctx context.Context, msg *south2md.TelegramMessage) {
+	chatID, replyTo := msg.Chat.ID, msg.MessageID
+	if !b.allowed(msg.From) {
+		var userID int64
+		if msg.From != nil {
+			userID = msg.From.ID
+		}
+		slog.Warn("Rejected Telegram message from a user not on the whitelist", "user", userID)
+		b.send(ctx, chatID, replyTo, "你没有使用此机器人的权限。")
+		return
+	}
+
+	var threads []string
+	for _, field := range strings.Fields(msg.Text) {
+		if _, _, ok := parseThreadRef(field); ok {
+			threads = append(threads, field)
+		}
+	}
+	if len(threads) == 0 {
+		b.send(ctx, chatID, replyTo, telegramHelp)
+		return
+	}
+	jobs, err := b.server.enqueue(threads, func(job apiJob) {
+		b.reply(ctx, chatID, replyTo, job)
+	})
+	if err != nil {
+		b.send(ctx, chatID, replyTo, fmt.Sprintf("加入队列失败: %v", err))
+		return
+	}
+	lines := make([]string, len(jobs))
+	for i, job := range jobs {
+		lines[i] = fmt.Sprintf("任务 #%d: 帖子 %s", job.ID, job.TID)
+	}
+	b.send(ctx, chatID, replyTo, "已加入队列\n"+strings.Join(lines, "\n"))
+}
+
+// reply sends the outcome of job: its error, or the first lines of the
+// floors a stored thread gained and a summary with the exported thread
+// attached.
+func (b *telegramBot) reply(ctx context.Context, chatID, replyTo int64, job apiJob) {
+	if job.Status == apiJobFailed {
+		b.send(ctx, chatID, replyTo, fmt.Sprintf("帖子 %s 抓取失败: %s", job.TID, job.Error))
+		return
+	}
+	if len(job.NewFloors) > 0 {
+		b.send(ctx, chatID, replyTo, formatNewFloors(job.NewFloors, telegramSnippetFloors))
+	}
+	post, err := b.server.store.LoadPostFromStore(job.TID)
+	if err != nil {
+		b.send(ctx, chatID, replyTo, fmt.Sprintf("读取帖子 %s 失败: %v", job.TID, err))
+		return
+	}
+	summary := fmt.Sprintf("✓ %s\n%s\n楼层: %d  图片: %d  下载: %s",
+		post.Title, post.URL, post.TotalFloors, len(post.Images), south2md.FormatByteSize(job.Bytes))
+
+	name, content, err := b.exportThread(post)
+	if err != nil {
+		b.send(ctx, chatID, replyTo, fmt.Sprintf("%s\n导出失败: %v", summary, err))
+		return
+	}
+	if len(content) > south2md.TelegramMaxUploadSize {
+		b.send(ctx, chatID, replyTo, fmt.Sprintf("%s\n导出文件过大 (%s)，未发送。", summary, south2md.FormatByteSize(int64(len(content)))))
+		return
+	}
+	if err := b.bot.SendDocument(ctx, chatID, replyTo, name, bytes.NewReader(content), summary); err != nil {
+		slog.Warn("Failed to send Telegram document", "tid", post.TID, "error", err)
+	}
+}
+
+// formatNewFloors lists floors as plain text, each followed by its snippet,
+// counting the floors past limit instead of showing them.
+func formatNewFloors(floors []south2md.FloorChange, limit int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "新楼层 (%d)", len(floors))
+	for i, floor := range floors {
+		if i == limit {
+			fmt.Fprintf(&sb, "\n\n另有 %d 个新楼层", len(floors)-limit)
+			break
+		}
+		sb.WriteString("\n\n" + floor.Floor)
+		if floor.Author != "" {
+			sb.WriteString(" @" + floor.Author)
+		}
+		for _, line := range floor.Snippet {
+			sb.WriteString("\n" + line)
+		}
+	}
+	return sb.String()
+}
+
+// exportThread exports post from the store without downloading anything and
+// returns the file to send: a single exported file as is, post.md alone when
+// the thread has no assets to go with it, and otherwise the whole directory
+// as a zip.
+func (b *telegramBot) exportThread(post *south2md.Post) (string, []byte, error) {
+	dir, err := os.MkdirTemp("", "south2md-telegram-*")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	exportCfg := *b.cfg
+	exportCfg.OutputFile = dir
+	generator, err := newMarkdownGenerator(&exportCfg)
+	if err != nil {
+		return "", nil, err
+	}
+	generator.SetDownloadEnabled(false)
+	path, err := exportPostTo(&exportCfg, b.server.store, generator, post, dir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", nil, err
+	}
+	if !info.IsDir() {
+		content, err := os.ReadFile(path)
+		return filepath.Base(path), content, err
+	}
+	if !hasSubdirs(path) {
+		if content, err := os.ReadFile(filepath.Join(path, "post.md")); err == nil {
+			return post.TID + ".md", content, nil
+		}
+	}
+	var buf bytes.Buffer
+	if err := zipDir(&buf, path); err != nil {
+		return "", nil, err
+	}
+	return post.TID + ".zip", buf.Bytes(), nil
+}
+
+// hasSubdirs reports whether dir contains a directory, such as images/.
+func hasSubdirs(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return true
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *telegramBot) send(ctx context.Context, chatID, replyTo int64, text string) {
+	if err := b.bot.SendMessage(ctx, chatID, replyTo, text); err != nil {
+		slog.Warn("Failed to send Telegram message", "chat", chatID, "error", err)
+	}
+}
+
+// zipDir writes the files under dir to w as a zip archive, nested in a
+// folder named after dir.
+func zipDir(w io.Writer, dir string) error {
+	archive := zip.NewWriter(w)
+	root := filepath.Dir(dir)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		file, err := archive.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(file, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
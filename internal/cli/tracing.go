@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+)
+
+// tracingShutdownTimeout bounds how long pending spans are flushed on exit.
+const tracingShutdownTimeout = 5 * time.Second
+
+// initTracing installs a global tracer provider exporting spans to the
+// OTLP/HTTP endpoint. An endpoint without a scheme is dialed over plain HTTP.
+// The returned function flushes and stops the exporter; with an empty
+// endpoint tracing stays disabled and it does nothing.
+func initTracing(ctx context.Context, endpoint string) (func(), error) {
+	if endpoint == "" {
+		return func() {}, nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var opts []otlptracehttp.Option
+	if strings.Contains(endpoint, "://") {
+		opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+	} else {
+		opts = append(opts, otlptracehttp.WithEndpoint(endpoint), otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("初始化 OpenTelemetry 导出器失败: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("south2md"))),
+	)
+	otel.SetTracerProvider(provider)
+	slog.Info("Exporting traces", "endpoint", endpoint)
+
+	return func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := provider.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("Failed to flush traces", "error", err)
+		}
+	}, nil
+}
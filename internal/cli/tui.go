@@ -0,0 +1,640 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/fdkevin0/south2md"
+	"github.com/lmittmann/tint"
+	"github.com/spf13/cobra"
+)
+
+// tuiCmd 交互式界面命令
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Browse the local archive and fetch, update and export threads interactively",
+	Long: `Open a full-screen interface with the stored threads on the left, a preview of the
+selected thread on the right and the fetch queue at the bottom. Threads are fetched one
+after another with the flags and config of a normal run; fetched threads are only stored,
+export them with "e".
+
+Keys: a add threads, u update the selected thread, e export it, r reload the list,
+tab switch between list and preview, q quit.`,
+	Example: `  # Browse the archive, fetching through a proxy
+  south2md tui --proxy=socks5://127.0.0.1:1080`,
+	Args: cobra.NoArgs,
+	RunE: runTUI,
+}
+
+// tuiQueueLines is the number of jobs the fetch queue pane shows.
+const tuiQueueLines = 5
+
+// tuiPreviewLimit caps how much of the rendered Markdown the preview shows.
+const tuiPreviewLimit = 64 * 1024
+
+// Job states shown in the fetch queue.
+const (
+	tuiJobQueued  = "等待"
+	tuiJobRunning = "抓取中"
+	tuiJobDone    = "完成"
+	tuiJobFailed  = "失败"
+)
+
+// tuiJob is one thread in the fetch queue.
+type tuiJob struct {
+	id      int
+	tid     string
+	baseURL string
+	status  string
+	message string
+	metrics *south2md.Metrics
+}
+
+type tuiInputMode int
+
+const (
+	tuiInputNone tuiInputMode = iota
+	tuiInputAdd
+	tuiInputExport
+)
+
+type tuiFocus int
+
+const (
+	tuiFocusList tuiFocus = iota
+	tuiFocusPreview
+)
+
+// Messages the model receives besides key presses and window sizes.
+type (
+	tuiPostsMsg struct {
+		posts []*south2md.Post
+		err   error
+	}
+	tuiJobLineMsg struct {
+		id   int
+		line string
+	}
+	tuiJobDoneMsg struct {
+		id  int
+		err error
+	}
+	tuiPreviewMsg struct {
+		tid      string
+		markdown string
+		err      error
+	}
+	tuiExportMsg struct {
+		tid  string
+		path string
+		err  error
+	}
+	tuiTickMsg time.Time
+)
+
+// tuiModel is the bubbletea model of south2md tui.
+type tuiModel struct {
+	ctx     context.Context
+	cfg     *south2md.Config
+	store   *south2md.PostStore
+	archive archiveFunc
+	send    func(tea.Msg)
+	logs    *tuiLogBuffer
+
+	posts  []*south2md.Post
+	cursor int
+	offset int
+
+	jobs      []*tuiJob
+	running   *tuiJob
+	nextJobID int
+
+	focus      tuiFocus
+	inputMode  tuiInputMode
+	input      textinput.Model
+	preview    viewport.Model
+	previewTID string
+	markdown   map[string]string
+	status     string
+
+	width  int
+	height int
+}
+
+func newTUIModel(ctx context.Context, cfg *south2md.Config, store *south2md.PostStore, archive archiveFunc) *tuiModel {
+	input := textinput.New()
+	input.Prompt = "> "
+	return &tuiModel{
+		ctx:      ctx,
+		cfg:      cfg,
+		store:    store,
+		archive:  archive,
+		send:     func(tea.Msg) {},
+		logs:     &tuiLogBuffer{},
+		input:    input,
+		preview:  viewport.New(0, 0),
+		markdown: make(map[string]string),
+	}
+}
+
+func runTUI(cmd *cobra.Command, args []string) error {
+	runtimeConfig, err := buildThreadlessConfig(cmd, args)
+	if err != nil {
+		return fmt.Errorf("初始化配置失败: %v", err)
+	}
+	cfg := runtimeConfig.App
+	if !stdinIsTerminal() {
+		return fmt.Errorf("tui 需要在交互式终端中运行")
+	}
+	// The interface owns the terminal, so gofile files can't be picked.
+	cfg.GofileSelect = false
+
+	if err := initLogger(runtimeConfig.Debug, cfg); err != nil {
+		return err
+	}
+	logs := &tuiLogBuffer{}
+	if cfg.LogFile == "" {
+		// Logs on stderr would tear the screen; the status line shows them.
+		level := slog.LevelWarn
+		if runtimeConfig.Debug {
+			level = slog.LevelDebug
+		}
+		slog.SetDefault(slog.New(tint.NewHandler(logs, &tint.Options{Level: level, TimeFormat: time.TimeOnly, NoColor: true})))
+	}
+
+	store := openPostStore(cfg)
+	if err := store.EnsureRoot(); err != nil {
+		return fmt.Errorf("初始化本地数据目录失败: %v", err)
+	}
+
+	httpOptions := south2md.HTTPOptionsFromConfig(cfg)
+	stopHAR := startHARRecording(cfg.RecordHAR, httpOptions)
+	defer stopHAR()
+	client := south2md.NewHTTPClient(httpOptions)
+
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+	model := newTUIModel(ctx, cfg, store, withHistory(store, "tui", newThreadArchiver(cfg, store, client, httpOptions, newWaybackSaver(cfg, client))))
+	model.logs = logs
+	program := tea.NewProgram(model, tea.WithAltScreen(), tea.WithContext(ctx))
+	model.send = program.Send
+	_, err = program.Run()
+	return err
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	return tea.Batch(m.loadPosts(), tuiTick())
+}
+
+func tuiTick() tea.Cmd {
+	return tea.Tick(500*time.Millisecond, func(t time.Time) tea.Msg { return tuiTickMsg(t) })
+}
+
+func (m *tuiModel) loadPosts() tea.Cmd {
+	store := m.store
+	return func() tea.Msg {
+		posts, err := store.ListPosts()
+		return tuiPostsMsg{posts: posts, err: err}
+	}
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		return m, m.refreshPreview(true)
+
+	case tea.KeyMsg:
+		if m.inputMode != tuiInputNone {
+			return m.updateInput(msg)
+		}
+		return m.updateKeys(msg)
+
+	case tuiPostsMsg:
+		if msg.err != nil {
+			m.status = fmt.Sprintf("读取本地库失败: %v", msg.err)
+			return m, nil
+		}
+		selected := m.selectedTID()
+		m.posts = msg.posts
+		m.cursor = 0
+		for i, post := range m.posts {
+			if post.TID == selected {
+				m.cursor = i
+			}
+		}
+		return m, m.refreshPreview(false)
+
+	case tuiPreviewMsg:
+		markdown := msg.markdown
+		if msg.err != nil {
+			markdown = fmt.Sprintf("生成预览失败: %v", msg.err)
+		}
+		m.markdown[msg.tid] = markdown
+		if msg.tid == m.previewTID {
+			return m, m.refreshPreview(true)
+		}
+		return m, nil
+
+	case tuiJobLineMsg:
+		if job := m.job(msg.id); job != nil {
+			job.message = msg.line
+		}
+		return m, nil
+
+	case tuiJobDoneMsg:
+		if job := m.job(msg.id); job != nil {
+			delete(m.markdown, job.tid)
+			job.status = tuiJobDone
+			if msg.err != nil {
+				job.status = tuiJobFailed
+				job.message = msg.err.Error()
+			}
+		}
+		m.running = nil
+		// Show the stored thread even if it was already selected.
+		m.previewTID = ""
+		return m, tea.Batch(m.loadPosts(), m.startNext())
+
+	case tuiExportMsg:
+		if msg.err != nil {
+			m.status = fmt.Sprintf("✗ 帖子 %s 导出失败: %v", msg.tid, msg.err)
+		} else {
+			m.status = fmt.Sprintf("✓ 帖子 %s 已导出到 %s", msg.tid, msg.path)
+		}
+		return m, nil
+
+	case tuiTickMsg:
+		if line := m.logs.Last(); line != "" {
+			m.status = line
+		}
+		return m, tuiTick()
+	}
+
+	if m.inputMode != tuiInputNone {
+		var cmd tea.Cmd
+		m.input, cmd = m.input.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+func (m *tuiModel) updateKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return m, tea.Quit
+	case "tab":
+		if m.focus == tuiFocusList {
+			m.focus = tuiFocusPreview
+		} else {
+			m.focus = tuiFocusList
+		}
+		return m, nil
+	case "a":
+		return m, m.openInput(tuiInputAdd, "帖子ID或链接, 多个用空格分隔", "")
+	case "u":
+		if post := m.selected(); post != nil {
+			return m, m.enqueue(post.TID, "")
+		}
+		return m, nil
+	case "e":
+		if post := m.selected(); post != nil {
+			return m, m.openInput(tuiInputExport, "导出目录", resolveExportDir(m.cfg.OutputFile))
+		}
+		return m, nil
+	case "r":
+		return m, m.loadPosts()
+	}
+
+	if m.focus == tuiFocusPreview {
+		var cmd tea.Cmd
+		m.preview, cmd = m.preview.Update(msg)
+		return m, cmd
+	}
+	switch msg.String() {
+	case "up", "k":
+		return m, m.moveCursor(-1)
+	case "down", "j":
+		return m, m.moveCursor(1)
+	case "pgup":
+		return m, m.moveCursor(-m.listHeight())
+	case "pgdown":
+		return m, m.moveCursor(m.listHeight())
+	case "home", "g":
+		return m, m.moveCursor(-len(m.posts))
+	case "end", "G":
+		return m, m.moveCursor(len(m.posts))
+	}
+	return m, nil
+}
+
+func (m *tuiModel) openInput(mode tuiInputMode, placeholder, value string) tea.Cmd {
+	m.inputMode = mode
+	m.input.Placeholder = placeholder
+	m.input.SetValue(value)
+	m.input.CursorEnd()
+	return m.input.Focus()
+}
+
+func (m *tuiModel) updateInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "ctrl+c":
+		m.closeInput()
+		return m, nil
+	case "enter":
+		mode, value := m.inputMode, strings.TrimSpace(m.input.Value())
+		m.closeInput()
+		if value == "" {
+			return m, nil
+		}
+		if mode == tuiInputExport {
+			return m, m.export(m.selected(), value)
+		}
+		var cmds []tea.Cmd
+		for _, arg := range strings.Fields(value) {
+			tid, baseURL := south2md.ParseThreadArg(arg)
+			cmds = append(cmds, m.enqueue(tid, baseURL))
+		}
+		return m, tea.Batch(cmds...)
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m *tuiModel) closeInput() {
+	m.inputMode = tuiInputNone
+	m.input.Blur()
+	m.input.SetValue("")
+}
+
+// enqueue adds a fetch of tid to the queue, starting it when nothing else
+// runs.
+func (m *tuiModel) enqueue(tid, baseURL string) tea.Cmd {
+	m.nextJobID++
+	m.jobs = append(m.jobs, &tuiJob{id: m.nextJobID, tid: tid, baseURL: baseURL, status: tuiJobQueued})
+	return m.startNext()
+}
+
+// startNext starts the oldest queued job unless one is running. Jobs run one
+// at a time, each with its own metrics for the progress columns.
+func (m *tuiModel) startNext() tea.Cmd {
+	if m.running != nil {
+		return nil
+	}
+	for _, job := range m.jobs {
+		if job.status != tuiJobQueued {
+			continue
+		}
+		job.status = tuiJobRunning
+		job.metrics = south2md.NewMetrics()
+		m.running = job
+		ctx, archive, send := m.ctx, m.archive, m.send
+		id, tid, baseURL, metrics := job.id, job.tid, job.baseURL, job.metrics
+		return func() tea.Msg {
+			out := &lineWriter{send: func(line string) { send(tuiJobLineMsg{id: id, line: line}) }}
+			_, err := archive(ctx, tid, baseURL, metrics, out)
+			return tuiJobDoneMsg{id: id, err: err}
+		}
+	}
+	return nil
+}
+
+// export exports post from the store to dir without downloading anything.
+func (m *tuiModel) export(post *south2md.Post, dir string) tea.Cmd {
+	if post == nil {
+		return nil
+	}
+	exportCfg := *m.cfg
+	exportCfg.OutputFile = dir
+	store, tid := m.store, post.TID
+	m.status = fmt.Sprintf("正在导出帖子 %s...", tid)
+	return func() tea.Msg {
+		generator, err := newMarkdownGenerator(&exportCfg)
+		if err != nil {
+			return tuiExportMsg{tid: tid, err: err}
+		}
+		generator.SetDownloadEnabled(false)
+		stored, err := store.LoadPostFromStore(tid)
+		if err != nil {
+			return tuiExportMsg{tid: tid, err: err}
+		}
+		path, err := exportPost(&exportCfg, store, generator, stored)
+		return tuiExportMsg{tid: tid, path: path, err: err}
+	}
+}
+
+func (m *tuiModel) job(id int) *tuiJob {
+	for _, job := range m.jobs {
+		if job.id == id {
+			return job
+		}
+	}
+	return nil
+}
+
+func (m *tuiModel) selected() *south2md.Post {
+	if m.cursor < 0 || m.cursor >= len(m.posts) {
+		return nil
+	}
+	return m.posts[m.cursor]
+}
+
+func (m *tuiModel) selectedTID() string {
+	if post := m.selected(); post != nil {
+		return post.TID
+	}
+	return ""
+}
+
+func (m *tuiModel) moveCursor(delta int) tea.Cmd {
+	m.cursor = max(0, min(m.cursor+delta, len(m.posts)-1))
+	return m.refreshPreview(false)
+}
+
+// Pane sizes; every pane has a one-cell border.
+func (m *tuiModel) listWidth() int     { return max(m.width*2/5-2, 10) }
+func (m *tuiModel) previewWidth() int  { return max(m.width-m.listWidth()-4, 10) }
+func (m *tuiModel) queueWidth() int    { return max(m.width-2, 10) }
+func (m *tuiModel) listHeight() int    { return max(m.height-tuiQueueLines-5, 3) }
+func (m *tuiModel) previewHeight() int { return m.listHeight() }
+
+// refreshPreview shows the selected thread in the preview pane when the
+// selection changed or force is set. The Markdown is rendered in the
+// background on first view; the returned command does that.
+func (m *tuiModel) refreshPreview(force bool) tea.Cmd {
+	m.preview.Width, m.preview.Height = m.previewWidth(), m.previewHeight()
+	post := m.selected()
+	if post == nil {
+		m.previewTID = ""
+		m.preview.SetContent("本地库中还没有帖子, 按 a 添加")
+		return nil
+	}
+	if !force && post.TID == m.previewTID {
+		return nil
+	}
+	if post.TID != m.previewTID {
+		m.preview.GotoTop()
+	}
+	m.previewTID = post.TID
+	markdown, rendered := m.markdown[post.TID]
+	if !rendered {
+		markdown = "正在生成预览..."
+	}
+	m.preview.SetContent(lipgloss.NewStyle().Width(m.preview.Width).Render(m.previewSummary(post) + "\n" + markdown))
+	if rendered {
+		return nil
+	}
+	cfg := m.cfg
+	return func() tea.Msg {
+		generator, err := newMarkdownGenerator(cfg)
+		if err != nil {
+			return tuiPreviewMsg{tid: post.TID, err: err}
+		}
+		markdown, err := generator.GenerateOfflineMarkdown(post)
+		if len(markdown) > tuiPreviewLimit {
+			markdown = strings.ToValidUTF8(markdown[:tuiPreviewLimit], "") + "\n..."
+		}
+		return tuiPreviewMsg{tid: post.TID, markdown: markdown, err: err}
+	}
+}
+
+// previewSummary lists what the store knows about post.
+func (m *tuiModel) previewSummary(post *south2md.Post) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", tuiTitleStyle.Render(post.Title))
+	fmt.Fprintf(&b, "TID: %s\n", post.TID)
+	if post.Forum != "" {
+		fmt.Fprintf(&b, "版块: %s\n", post.Forum)
+	}
+	if post.MainPost.Author.Username != "" {
+		fmt.Fprintf(&b, "作者: %s\n", post.MainPost.Author.Username)
+	}
+	fmt.Fprintf(&b, "楼层: %d  图片: %d\n", post.TotalFloors, len(post.Images))
+	if post.Views > 0 || post.ReplyCount > 0 {
+		fmt.Fprintf(&b, "%d 浏览 / %d 回复\n", post.Views, post.ReplyCount)
+	}
+	if len(post.Tags) > 0 {
+		fmt.Fprintf(&b, "标签: %s\n", strings.Join(post.Tags, ", "))
+	}
+	if len(post.MissingPages) > 0 {
+		fmt.Fprintf(&b, "缺失页: %v\n", post.MissingPages)
+	}
+	if !post.CreatedAt.IsZero() {
+		fmt.Fprintf(&b, "存档时间: %s\n", post.CreatedAt.Local().Format(time.DateTime))
+	}
+	fmt.Fprintf(&b, "目录: %s\n", m.store.PostDir(post.TID))
+	return b.String()
+}
+
+var (
+	tuiTitleStyle    = lipgloss.NewStyle().Bold(true)
+	tuiSelectedStyle = lipgloss.NewStyle().Reverse(true)
+	tuiFaintStyle    = lipgloss.NewStyle().Faint(true)
+)
+
+func tuiPane(focused bool) lipgloss.Style {
+	color := lipgloss.Color("240")
+	if focused {
+		color = lipgloss.Color("62")
+	}
+	return lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(color)
+}
+
+func (m *tuiModel) View() string {
+	if m.width == 0 {
+		return "加载中..."
+	}
+	list := tuiPane(m.focus == tuiFocusList).Width(m.listWidth()).Height(m.listHeight()).Render(m.listView())
+	preview := tuiPane(m.focus == tuiFocusPreview).Width(m.previewWidth()).Height(m.previewHeight()).Render(m.preview.View())
+	queue := tuiPane(false).Width(m.queueWidth()).Height(tuiQueueLines).Render(m.queueView())
+	return lipgloss.JoinVertical(lipgloss.Left,
+		lipgloss.JoinHorizontal(lipgloss.Top, list, preview),
+		queue,
+		m.footerView(),
+	)
+}
+
+func (m *tuiModel) listView() string {
+	height, width := m.listHeight(), m.listWidth()
+	lines := []string{tuiTitleStyle.Render(fmt.Sprintf("本地库 (%d)", len(m.posts)))}
+	rows := height - 1
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	} else if m.cursor >= m.offset+rows {
+		m.offset = m.cursor - rows + 1
+	}
+	for i := m.offset; i < len(m.posts) && i < m.offset+rows; i++ {
+		post := m.posts[i]
+		line := lipgloss.NewStyle().MaxWidth(width).Render(fmt.Sprintf("%-8s %s", post.TID, post.Title))
+		if i == m.cursor {
+			line = tuiSelectedStyle.Render(line)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *tuiModel) queueView() string {
+	if len(m.jobs) == 0 {
+		return tuiFaintStyle.Render("抓取队列为空")
+	}
+	// The newest jobs, keeping the running one in view.
+	jobs := m.jobs[max(0, len(m.jobs)-tuiQueueLines):]
+	lines := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		line := fmt.Sprintf("%-4s %-8s", job.status, job.tid)
+		if job.metrics != nil {
+			pages, images, bytes := metricsProgress(job.metrics)
+			line += fmt.Sprintf("  页面 %d  图片 %d  %s", pages, images, south2md.FormatByteSize(bytes))
+		}
+		if job.message != "" {
+			line += "  " + job.message
+		}
+		lines = append(lines, lipgloss.NewStyle().MaxWidth(m.queueWidth()).Render(line))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *tuiModel) footerView() string {
+	if m.inputMode != tuiInputNone {
+		return m.input.View()
+	}
+	if m.status != "" {
+		return lipgloss.NewStyle().MaxWidth(m.width).Render(m.status)
+	}
+	return tuiFaintStyle.Render("a 添加  u 更新  e 导出  r 刷新  tab 切换  q 退出")
+}
+
+// tuiLogBuffer keeps the last log line for the status line. Logs are
+// written from any goroutine, including inside Update, so they are polled
+// rather than sent to the program.
+type tuiLogBuffer struct {
+	mu   sync.Mutex
+	last string
+}
+
+func (b *tuiLogBuffer) Write(p []byte) (int, error) {
+	lines := strings.Split(strings.TrimSpace(string(p)), "\n")
+	b.mu.Lock()
+	b.last = lines[len(lines)-1]
+	b.mu.Unlock()
+	return len(p), nil
+}
+
+// Last returns the line logged since the previous call, or "".
+func (b *tuiLogBuffer) Last() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	last := b.last
+	b.last = ""
+	return last
+}
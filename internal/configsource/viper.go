@@ -12,6 +12,14 @@ import (
 	"github.com/spf13/viper"
 )
 
+// envOnlyKeys are config keys without a CLI flag. Viper only unmarshals env
+// values for keys it already knows, so they must be bound explicitly.
+var envOnlyKeys = []string{
+	"webdav_username",
+	"webdav_password",
+	"translate_api_key",
+}
+
 func NewViperForCommand(cmd *cobra.Command, configFlagValue string) (*viper.Viper, error) {
 	v := viper.New()
 
@@ -64,6 +72,12 @@ func bindViperFlags(v *viper.Viper, cmd *cobra.Command) error {
 		return bindErr
 	}
 
+	for _, key := range envOnlyKeys {
+		if err := v.BindEnv(key); err != nil {
+			return fmt.Errorf("绑定环境变量到 key %q 失败: %w", key, err)
+		}
+	}
+
 	// Keep struct tag naming with existing --output flag.
 	v.RegisterAlias("output_file", "output")
 	return nil
@@ -74,6 +88,15 @@ func applyDerivedOverrides(v *viper.Viper, cmd *cobra.Command) {
 	if flagChanged(cmd, "no-cache") || hasEnvNoCache || v.InConfig("no_cache") {
 		v.Set("enable_cache", !v.GetBool("no_cache"))
 	}
+	_, hasEnvNoWayback := os.LookupEnv("SOUTH2MD_NO_WAYBACK")
+	if flagChanged(cmd, "no-wayback") || hasEnvNoWayback || v.InConfig("no_wayback") {
+		v.Set("wayback", !v.GetBool("no_wayback"))
+	}
+	// --strict-pages supersedes --strict-pagination but both set strict_pagination.
+	_, hasEnvStrictPages := os.LookupEnv("SOUTH2MD_STRICT_PAGES")
+	if flagChanged(cmd, "strict-pages") || hasEnvStrictPages || v.InConfig("strict_pages") {
+		v.Set("strict_pagination", v.GetBool("strict_pages"))
+	}
 }
 
 func resolveConfigFilePath(cmd *cobra.Command, configFlagValue string) (string, bool, error) {
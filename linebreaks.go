@@ -0,0 +1,127 @@
+package south2md
+
+import (
+	"context"
+	"strings"
+
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"golang.org/x/net/html"
+)
+
+// Line break styles selectable with MarkdownOptions.LineBreaks.
+const (
+	LineBreakCollapse  = "collapse"  // runs of <br> collapse into a paragraph break
+	LineBreakSpaces    = "spaces"    // every <br> is a "  " hard break
+	LineBreakBackslash = "backslash" // every <br> is a "\" hard break
+)
+
+// LineBreakStyles lists all supported line break styles.
+var LineBreakStyles = []string{
+	LineBreakCollapse,
+	LineBreakSpaces,
+	LineBreakBackslash,
+}
+
+// IsValidLineBreakStyle reports whether style is a supported line break
+// style.
+func IsValidLineBreakStyle(style string) bool {
+	for _, s := range LineBreakStyles {
+		if s == style {
+			return true
+		}
+	}
+	return false
+}
+
+// lineBreakKey is the context key of the line break style of a conversion.
+type lineBreakKey struct{}
+
+// withLineBreakStyle returns the converter context option selecting style.
+func withLineBreakStyle(style string) converter.ConvertOptionFunc {
+	return converter.WithContext(context.WithValue(context.Background(), lineBreakKey{}, style))
+}
+
+// blankLineFiller keeps an empty line inside a paragraph: a line of only
+// spaces would end it, a no-break space doesn't.
+const blankLineFiller = "\u00a0"
+
+// renderHardBreak is a converter renderer writing every <br> as a hard break
+// in the style of the conversion, like the forum shows them. A <br> that
+// starts a line (after another <br> or at the start of a block) keeps its
+// empty line with blankLineFiller instead of collapsing into a paragraph
+// break; <br>s ending a block are dropped. With the collapse style, and
+// inside tables and <pre>, it leaves the <br> to the default renderer.
+func renderHardBreak(ctx converter.Context, w converter.Writer, n *html.Node) converter.RenderStatus {
+	if n.Data != "br" {
+		return converter.RenderTryNext
+	}
+	style, _ := ctx.Value(lineBreakKey{}).(string)
+	var brk string
+	switch style {
+	case LineBreakSpaces:
+		brk = "  \n"
+	case LineBreakBackslash:
+		brk = "\\\n"
+	default:
+		return converter.RenderTryNext
+	}
+	for p := n.Parent; p != nil; p = p.Parent {
+		switch p.Data {
+		case "table", "pre":
+			return converter.RenderTryNext
+		}
+	}
+
+	if n.Parent != nil && !isInlineElement(n.Parent) && endsBlock(n) {
+		// Breaks ending a block would end the paragraph with a dangling hard
+		// break; the block end breaks the line anyway.
+		return converter.RenderSuccess
+	}
+	prev := significantSibling(n, true)
+	if (prev == nil && n.Parent != nil && !isInlineElement(n.Parent)) || (prev != nil && prev.Type == html.ElementNode && prev.Data == "br") {
+		w.WriteString(blankLineFiller)
+	}
+	w.WriteString(brk)
+	return converter.RenderSuccess
+}
+
+// endsBlock reports whether only <br>s follow n in its parent.
+func endsBlock(n *html.Node) bool {
+	for s := significantSibling(n, false); s != nil; s = significantSibling(s, false) {
+		if s.Type != html.ElementNode || s.Data != "br" {
+			return false
+		}
+	}
+	return true
+}
+
+// significantSibling returns the sibling before (or after) n, skipping
+// whitespace-only text.
+func significantSibling(n *html.Node, before bool) *html.Node {
+	next := func(s *html.Node) *html.Node {
+		if before {
+			return s.PrevSibling
+		}
+		return s.NextSibling
+	}
+	for s := next(n); s != nil; s = next(s) {
+		if s.Type == html.TextNode && strings.TrimSpace(s.Data) == "" {
+			continue
+		}
+		if s.Type == html.CommentNode {
+			continue
+		}
+		return s
+	}
+	return nil
+}
+
+// isInlineElement reports whether n is an inline element, whose end doesn't
+// end the line.
+func isInlineElement(n *html.Node) bool {
+	switch n.Data {
+	case "span", "font", "a", "b", "strong", "i", "em", "u", "s", "strike", "del", "small", "big", "sub", "sup", "code":
+		return true
+	}
+	return false
+}
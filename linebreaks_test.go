@@ -0,0 +1,41 @@
+package south2md_test
+
+import (
+	"strings"
+	"testing"
+
+	main "github.com/fdkevin0/south2md"
+)
+
+const asciiArtFloorHTML = `猫<br/>
+    &nbsp;/\_/\<br>&nbsp;( o.o )<br><br><br>- 不是列表<br>结束<br>`
+
+func lineBreakMarkdown(t *testing.T, style string) string {
+	t.Helper()
+	g := main.NewMarkdownGenerator(&main.MarkdownOptions{LineBreaks: style}, nil)
+	g.SetDownloadEnabled(false)
+	md, err := g.GenerateMarkdown(&main.Post{
+		TID:      "100",
+		Title:    "breaks",
+		MainPost: main.PostEntry{Floor: "GF", PostID: "tpc", HTMLContent: `<div class="f14">` + asciiArtFloorHTML + `</div>`},
+	})
+	if err != nil {
+		t.Fatalf("GenerateMarkdown returned error: %v", err)
+	}
+	return md
+}
+
+func TestGenerateMarkdownLineBreakStyles(t *testing.T) {
+	for style, want := range map[string]string{
+		main.LineBreakSpaces:    "猫  \n\u00a0/\\\\\\_/\\\\  \n\u00a0( o.o )  \n\u00a0  \n\u00a0  \n\\- 不是列表  \n结束\n",
+		main.LineBreakBackslash: "猫\\\n\u00a0/\\\\\\_/\\\\\\\n\u00a0( o.o )\\\n\u00a0\\\n\u00a0\\\n\\- 不是列表\\\n结束\n",
+	} {
+		if md := lineBreakMarkdown(t, style); !strings.Contains(md, want) {
+			t.Fatalf("expected %s line breaks %q in:\n%q", style, want, md)
+		}
+	}
+
+	if md := lineBreakMarkdown(t, main.LineBreakCollapse); !strings.Contains(md, "( o.o )\n\n\\- 不是列表") {
+		t.Fatalf("expected runs of <br> to collapse by default, got:\n%q", md)
+	}
+}
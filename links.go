@@ -0,0 +1,194 @@
+package south2md
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/antchfx/htmlquery"
+)
+
+// Files of a thread dir listing the outbound links of its floors.
+const (
+	LinksFileName         = "links.toml"
+	LinksMarkdownFileName = "links.md"
+)
+
+// Link categories of the hosts resources are commonly shared on.
+const (
+	LinkCategoryGofile      = "gofile"
+	LinkCategoryMega        = "mega"
+	LinkCategoryBaiduPan    = "baidu-pan"
+	LinkCategoryLanzou      = "lanzou"
+	LinkCategoryAliyunDrive = "aliyun-drive"
+	LinkCategoryQuark       = "quark"
+	LinkCategory123Pan      = "123pan"
+	LinkCategoryGoogleDrive = "google-drive"
+	LinkCategoryOneDrive    = "onedrive"
+	LinkCategoryDropbox     = "dropbox"
+	LinkCategoryMediaFire   = "mediafire"
+	LinkCategoryPixeldrain  = "pixeldrain"
+	LinkCategoryOther       = "other"
+)
+
+// linkCategoryHosts maps host suffixes to their category. A suffix matches
+// the host itself and its subdomains.
+var linkCategoryHosts = []struct {
+	suffix   string
+	category string
+}{
+	{"gofile.io", LinkCategoryGofile},
+	{"mega.nz", LinkCategoryMega},
+	{"mega.co.nz", LinkCategoryMega},
+	{"mega.io", LinkCategoryMega},
+	{"pan.baidu.com", LinkCategoryBaiduPan},
+	{"yun.baidu.com", LinkCategoryBaiduPan},
+	{"woozooo.com", LinkCategoryLanzou},
+	{"aliyundrive.com", LinkCategoryAliyunDrive},
+	{"alipan.com", LinkCategoryAliyunDrive},
+	{"pan.quark.cn", LinkCategoryQuark},
+	{"123pan.com", LinkCategory123Pan},
+	{"123pan.cn", LinkCategory123Pan},
+	{"drive.google.com", LinkCategoryGoogleDrive},
+	{"1drv.ms", LinkCategoryOneDrive},
+	{"onedrive.live.com", LinkCategoryOneDrive},
+	{"sharepoint.com", LinkCategoryOneDrive},
+	{"dropbox.com", LinkCategoryDropbox},
+	{"mediafire.com", LinkCategoryMediaFire},
+	{"pixeldrain.com", LinkCategoryPixeldrain},
+}
+
+// ExternalLink is one outbound hyperlink of a floor.
+type ExternalLink struct {
+	URL      string `toml:"url"`            // 链接地址
+	Text     string `toml:"text,omitempty"` // 链接文字
+	Floor    string `toml:"floor"`          // 所在楼层
+	PostID   string `toml:"post_id"`        // 所在楼层的PostID
+	Host     string `toml:"host"`           // 链接域名
+	Category string `toml:"category"`       // 域名分类(gofile/mega/baidu-pan...，其他为other)
+}
+
+type linksFile struct {
+	TID   string         `toml:"tid"`
+	Title string         `toml:"title"`
+	Links []ExternalLink `toml:"links"`
+}
+
+// LinkCategory returns the category of a link host, LinkCategoryOther for
+// hosts that aren't known file hosts. Lanzou's many domains (lanzoux.com,
+// lanzouw.com, ...) all count as lanzou.
+func LinkCategory(host string) string {
+	host = strings.TrimPrefix(strings.ToLower(host), "www.")
+	for _, h := range linkCategoryHosts {
+		if host == h.suffix || strings.HasSuffix(host, "."+h.suffix) {
+			return h.category
+		}
+	}
+	if strings.HasPrefix(host, "lanzou") || strings.Contains(host, ".lanzou") {
+		return LinkCategoryLanzou
+	}
+	return LinkCategoryOther
+}
+
+// CollectExternalLinks returns the outbound links of every floor of post in
+// thread order, each URL once per floor. Relative links and links to the
+// thread's own forum host are internal and left out, as are non-HTTP links.
+func CollectExternalLinks(post *Post) []ExternalLink {
+	base, _ := url.Parse(post.URL)
+	forumHost := ""
+	if base != nil {
+		forumHost = strings.TrimPrefix(strings.ToLower(base.Hostname()), "www.")
+	}
+
+	var links []ExternalLink
+	for i, entry := range postFloors(post) {
+		if !strings.Contains(entry.HTMLContent, "href") {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, a := range htmlquery.Find(parseFragment(entry.HTMLContent), "//a[@href]") {
+			u, err := url.Parse(strings.TrimSpace(htmlquery.SelectAttr(a, "href")))
+			if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+				continue
+			}
+			host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+			if host == forumHost || seen[u.String()] {
+				continue
+			}
+			seen[u.String()] = true
+			links = append(links, ExternalLink{
+				URL:      u.String(),
+				Text:     strings.Join(strings.Fields(htmlquery.InnerText(a)), " "),
+				Floor:    floorLabel(i, entry),
+				PostID:   entry.PostID,
+				Host:     host,
+				Category: LinkCategory(host),
+			})
+		}
+	}
+	return links
+}
+
+// FormatLinksMarkdown renders links as the links.md inventory of post: a
+// table per category, file hosts first in the order of linkCategoryHosts.
+func FormatLinksMarkdown(post *Post, links []ExternalLink) string {
+	byCategory := make(map[string][]ExternalLink)
+	for _, link := range links {
+		byCategory[link.Category] = append(byCategory[link.Category], link)
+	}
+	var categories []string
+	for _, h := range linkCategoryHosts {
+		if len(byCategory[h.category]) > 0 && !slices.Contains(categories, h.category) {
+			categories = append(categories, h.category)
+		}
+	}
+	if len(byCategory[LinkCategoryOther]) > 0 {
+		categories = append(categories, LinkCategoryOther)
+	}
+
+	var md strings.Builder
+	fmt.Fprintf(&md, "## 外部链接 - %s\n\n", EscapeMarkdown(post.Title))
+	fmt.Fprintf(&md, "帖子 %s 共 %d 个外部链接。\n", post.TID, len(links))
+	for _, category := range categories {
+		fmt.Fprintf(&md, "\n### %s (%d)\n\n", category, len(byCategory[category]))
+		md.WriteString("| 楼层 | 链接 | 文字 |\n")
+		md.WriteString("| --- | --- | --- |\n")
+		for _, link := range byCategory[category] {
+			fmt.Fprintf(&md, "| %s | <%s> | %s |\n", link.Floor, link.URL, strings.ReplaceAll(EscapeMarkdown(link.Text), "|", "\\|"))
+		}
+	}
+	return md.String()
+}
+
+// storeLinks writes the outbound links of post to links.toml and links.md
+// in tidDir, or removes them when the thread has none.
+func storeLinks(post *Post, tidDir string) error {
+	links := CollectExternalLinks(post)
+	tomlPath := filepath.Join(tidDir, LinksFileName)
+	mdPath := filepath.Join(tidDir, LinksMarkdownFileName)
+	if len(links) == 0 {
+		for _, path := range []string{tomlPath, mdPath} {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("删除%s失败: %v", filepath.Base(path), err)
+			}
+		}
+		return nil
+	}
+
+	data, err := toml.Marshal(linksFile{TID: post.TID, Title: post.Title, Links: links})
+	if err != nil {
+		return fmt.Errorf("生成%s失败: %v", LinksFileName, err)
+	}
+	if err := writeFileAtomic(tomlPath, data); err != nil {
+		return fmt.Errorf("保存%s失败: %v", LinksFileName, err)
+	}
+	if err := writeFileAtomic(mdPath, []byte(FormatLinksMarkdown(post, links))); err != nil {
+		return fmt.Errorf("保存%s失败: %v", LinksMarkdownFileName, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package south2md_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	main "github.com/fdkevin0/south2md"
+)
+
+func linksTestPost() *main.Post {
+	return &main.Post{
+		TID:      "100",
+		Title:    "resources",
+		URL:      "https://south-plus.net/read.php?tid-100.html",
+		MainPost: main.PostEntry{Floor: "GF", PostID: "tpc", HTMLContent: `<a href="https://gofile.io/d/abc">下载</a> <a href="https://pan.baidu.com/s/1xyz">百度 网盘</a> <a href="https://gofile.io/d/abc">again</a>`},
+		Replies: []main.PostEntry{
+			{Floor: "B1F", PostID: "201", HTMLContent: `<a href="u.php?action-show-uid-3.html">carol</a> <a href="https://www.south-plus.net/read.php?tid-1.html">old</a> <a href="mailto:a@b.c">mail</a>`},
+			{Floor: "B2F", PostID: "202", HTMLContent: `<a href="https://wwi.lanzoux.com/iAbc">lanzou</a> <a href="https://mega.nz/file/x#key">mega</a> <a href="https://example.com/page">blog</a>`},
+		},
+	}
+}
+
+func TestCollectExternalLinks(t *testing.T) {
+	var got []string
+	for _, link := range main.CollectExternalLinks(linksTestPost()) {
+		got = append(got, link.Floor+" "+link.Category+" "+link.Host+" "+link.Text)
+	}
+	want := []string{
+		"GF gofile gofile.io 下载",
+		"GF baidu-pan pan.baidu.com 百度 网盘",
+		"B2F lanzou wwi.lanzoux.com lanzou",
+		"B2F mega mega.nz mega",
+		"B2F other example.com blog",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected links:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestExportPostWritesLinkInventory(t *testing.T) {
+	baseDir := t.TempDir()
+	g := main.NewMarkdownGenerator(&main.MarkdownOptions{}, nil)
+	g.SetDownloadEnabled(false)
+	post := linksTestPost()
+	if err := g.ExportPost(post, baseDir); err != nil {
+		t.Fatalf("ExportPost returned error: %v", err)
+	}
+
+	tidDir := filepath.Join(baseDir, "100")
+	data, err := os.ReadFile(filepath.Join(tidDir, main.LinksMarkdownFileName))
+	if err != nil {
+		t.Fatalf("read links.md: %v", err)
+	}
+	md := string(data)
+	for _, want := range []string{"帖子 100 共 5 个外部链接。", "### gofile (1)", "| GF | <https://gofile.io/d/abc> | 下载 |", "### other (1)"} {
+		if !strings.Contains(md, want) {
+			t.Fatalf("expected %q in links.md:\n%s", want, md)
+		}
+	}
+	if strings.Index(md, "### mega") > strings.Index(md, "### other") {
+		t.Fatalf("expected file hosts before other links:\n%s", md)
+	}
+	if _, err := os.Stat(filepath.Join(tidDir, main.LinksFileName)); err != nil {
+		t.Fatalf("expected links.toml: %v", err)
+	}
+
+	post.MainPost.HTMLContent = "<p>links removed</p>"
+	post.Replies = nil
+	if err := g.ExportPost(post, baseDir); err != nil {
+		t.Fatalf("ExportPost returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tidDir, main.LinksFileName)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the stale links.toml to be removed, got %v", err)
+	}
+}
@@ -2,25 +2,73 @@ package south2md
 
 import (
 	"fmt"
+	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
-	htmltomarkdown "github.com/JohannesKaufmann/html-to-markdown/v2"
 	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/base"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/commonmark"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/strikethrough"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/table"
 )
 
+// sharedConverter is the HTML→markdown converter reused for every floor; the
+// converter is safe for concurrent use and costly to build per call. phpwind
+// [table]s have no header row, so the first row becomes the header; cells
+// keep their line breaks as <br>.
+var sharedConverter = sync.OnceValue(func() *converter.Converter {
+	conv := converter.NewConverter(
+		converter.WithPlugins(
+			base.NewBasePlugin(),
+			commonmark.NewCommonmarkPlugin(),
+			strikethrough.NewStrikethroughPlugin(),
+			table.NewTablePlugin(
+				table.WithHeaderPromotion(true),
+				table.WithSpanCellBehavior(table.SpanBehaviorMirror),
+				table.WithNewlineBehavior(table.NewlineBehaviorPreserve),
+				table.WithSkipEmptyRows(true),
+				table.WithCellPaddingBehavior(table.CellPaddingBehaviorMinimal),
+			),
+		),
+	)
+	conv.Register.PreRenderer(resolveLazyImages, converter.PriorityStandard)
+	conv.Register.PreRenderer(resolveThumbnailOriginals, converter.PriorityStandard)
+	conv.Register.PreRenderer(keepImageSizeHints, converter.PriorityStandard)
+	conv.Register.PreRenderer(keepCodeBlocks, converter.PriorityStandard)
+	conv.Register.Renderer(renderHardBreak, converter.PriorityEarly)
+	return conv
+})
+
 // MarkdownFormatter handles markdown formatting operations
 type MarkdownFormatter struct {
-	options *MarkdownOptions
+	options  *MarkdownOptions
+	template *MarkdownTemplate
 }
 
 // NewMarkdownFormatter creates a new markdown formatter
 func NewMarkdownFormatter(options *MarkdownOptions) *MarkdownFormatter {
+	tmpl := options.Template
+	if tmpl == nil {
+		tmpl = NewDefaultMarkdownTemplate()
+	}
 	return &MarkdownFormatter{
-		options: options,
+		options:  options,
+		template: tmpl,
 	}
 }
 
+// FormatDocument renders the whole post.md through the "document" template
+// block, with image links in the configured ImageStyle.
+func (mf *MarkdownFormatter) FormatDocument(doc TemplateDocument) (string, error) {
+	markdown, err := mf.template.execute("document", doc)
+	if err != nil {
+		return "", err
+	}
+	return applyImageStyle(markdown, mf.options.ImageStyle), nil
+}
+
 // FormatTitle formats the document title
 func (mf *MarkdownFormatter) FormatTitle(title string) string {
 	return fmt.Sprintf("## %s\n\n", mf.escapeMarkdown(title))
@@ -30,59 +78,156 @@ func (mf *MarkdownFormatter) FormatTitle(title string) string {
 func (mf *MarkdownFormatter) FormatPostEntry(tid string, entry PostEntry, index int, floor string, post *Post, imageHandler *ImageHandler, gofileHandler *GofileHandler) (string, error) {
 	var md strings.Builder
 
-	// 复杂标题格式
-	floorDisplay := floor
-	if floor == "0" {
-		floorDisplay = "0"
+	md.WriteString(mf.FormatEntryHeader(entry, index, floor))
+	md.WriteString("\n\n")
+
+	content, err := mf.FormatEntryContent(tid, entry, post, imageHandler, gofileHandler)
+	if err != nil {
+		return "", err
+	}
+	if content != "" {
+		md.WriteString(content)
+		md.WriteString("\n\n")
 	}
 
-	// 构建复杂的span标题
-	header := fmt.Sprintf("##### <span id=\"pid%s\">%s.[%d] \\<pid:%s\\> %s by UID:%s(%s)</span>",
-		entry.PostID,
-		floorDisplay,
-		index,
-		entry.PostID,
-		entry.PostTime.Format("2006-01-02 15:04:05"),
-		entry.Author.UID,
-		entry.Author.Username)
+	return md.String(), nil
+}
 
-	md.WriteString(header)
-	md.WriteString("\n\n")
+// FormatEntryHeader formats the heading line of one floor.
+func (mf *MarkdownFormatter) FormatEntryHeader(entry PostEntry, index int, floor string) string {
+	header, err := mf.FormatFloorHeader(TemplateFloor{Entry: entry, Index: index, Floor: floor})
+	if err != nil {
+		slog.Warn("Failed to render floor header", "floor", floor, "error", err)
+	}
+	return header
+}
 
-	if entry.HTMLContent != "" {
-		markdown, err := htmltomarkdown.ConvertString(entry.HTMLContent,
-			converter.WithDomain("https://south-plus.net/"),
-		)
-		if err != nil {
-			return "", fmt.Errorf("failed to convert HTML to markdown: %w", err)
-		}
+// FormatFloorHeader renders the "floor_header" template block.
+func (mf *MarkdownFormatter) FormatFloorHeader(floor TemplateFloor) (string, error) {
+	return mf.template.execute("floor_header", floor)
+}
+
+// FormatEntryContent converts one floor's HTML to markdown and localizes its
+// images and gofile links. It returns an empty string for empty floors and a
+// placeholder note for deleted or blocked ones.
+func (mf *MarkdownFormatter) FormatEntryContent(tid string, entry PostEntry, post *Post, imageHandler *ImageHandler, gofileHandler *GofileHandler) (string, error) {
+	markdown, err := convertEntryHTML(entry, mf.options.LineBreaks)
+	if err != nil || !hasEntryContent(entry) {
+		return markdown, err
+	}
+
+	md2, err := imageHandler.DownloadAndCacheImages(tid, []byte(markdown), post)
+	if err != nil {
+		return "", fmt.Errorf("failed to download and cache images: %w", err)
+	}
+	return mf.finishEntryContent(tid, entry, md2, post, imageHandler, gofileHandler)
+}
+
+// hasEntryContent reports whether entry has content of its own, as opposed
+// to a deleted or blocked placeholder or an empty floor.
+func hasEntryContent(entry PostEntry) bool {
+	return entry.Status != FloorStatusDeleted && entry.Status != FloorStatusBlocked && entry.HTMLContent != ""
+}
+
+// convertEntryHTML converts the HTML of entry to markdown with its remote
+// image links untouched, writing <br>s in the lineBreaks style. It is safe
+// for concurrent use.
+func convertEntryHTML(entry PostEntry, lineBreaks string) (string, error) {
+	switch entry.Status {
+	case FloorStatusDeleted:
+		return "*该楼层已被删除*", nil
+	case FloorStatusBlocked:
+		return "*该楼层已被屏蔽*", nil
+	}
+	if entry.HTMLContent == "" {
+		return "", nil
+	}
 
-		md2, err := imageHandler.DownloadAndCacheImages(tid, []byte(markdown), post)
+	markdown, err := sharedConverter().ConvertString(entry.HTMLContent,
+		converter.WithDomain("https://south-plus.net/"),
+		withLineBreakStyle(lineBreaks),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert HTML to markdown: %w", err)
+	}
+	return markdown, nil
+}
+
+// finishEntryContent downloads the gofile links and attachments of a floor
+// whose images are already localized in md2, and appends its attachments.
+func (mf *MarkdownFormatter) finishEntryContent(tid string, entry PostEntry, md2 []byte, post *Post, imageHandler *ImageHandler, gofileHandler *GofileHandler) (string, error) {
+	var err error
+	if gofileHandler != nil {
+		md2, err = gofileHandler.DownloadAndAnnotateGofileLinks(tid, md2, post)
 		if err != nil {
-			return "", fmt.Errorf("failed to download and cache images: %w", err)
+			return "", fmt.Errorf("failed to download gofile links: %w", err)
 		}
+	}
+
+	if err := imageHandler.DownloadAttachments(tid, entry, post); err != nil {
+		return "", fmt.Errorf("failed to download attachments: %w", err)
+	}
+	content := string(md2)
+	if section := mf.FormatCloudLinks(entry); section != "" {
+		content = strings.TrimRight(content, "\n") + "\n\n" + section
+	}
+	if section := mf.FormatAttachments(entry, post, imageHandler.cacheDir); section != "" {
+		content = strings.TrimRight(content, "\n") + "\n\n" + section
+	}
+	return content, nil
+}
+
+// FormatAttachments renders the floor's attachments as a list with name, size,
+// local copy, original link and download status. Local links point into
+// cacheDir relative to the post directory.
+func (mf *MarkdownFormatter) FormatAttachments(entry PostEntry, post *Post, cacheDir string) string {
+	if len(entry.Attachments) == 0 {
+		return ""
+	}
 
-		if gofileHandler != nil {
-			md2, err = gofileHandler.DownloadAndAnnotateGofileLinks(tid, md2, post)
-			if err != nil {
-				return "", fmt.Errorf("failed to download gofile links: %w", err)
+	var md strings.Builder
+	md.WriteString("**Attachments**\n")
+	for _, att := range entry.Attachments {
+		size := att.Size
+		local := ""
+		if img := findAttachmentImage(post, att); img != nil {
+			local = cacheDir + "/" + img.Local
+			if size == 0 {
+				size = img.FileSize
 			}
 		}
 
-		md.WriteString(string(md2))
-		md.WriteString("\n\n")
+		fields := []string{"`" + att.Filename + "`"}
+		if size > 0 {
+			fields = append(fields, FormatByteSize(size))
+		} else {
+			fields = append(fields, "size unknown")
+		}
+		if local != "" {
+			fields = append(fields, fmt.Sprintf("[local](%s)", local))
+		}
+		fields = append(fields, fmt.Sprintf("[original](%s)", att.URL))
+		if local != "" {
+			fields = append(fields, "downloaded")
+		} else {
+			fields = append(fields, "not downloaded")
+		}
+		fmt.Fprintf(&md, "\n- %s", strings.Join(fields, " · "))
 	}
-
-	return md.String(), nil
+	return md.String()
 }
 
 // FormatFooter formats the document footer
 func (mf *MarkdownFormatter) FormatFooter() string {
-	var md strings.Builder
-	md.WriteString("---\n\n")
-	md.WriteString("*本文档由 south2md 自动生成*\n\n")
-	fmt.Fprintf(&md, "*生成时间: %s*\n", time.Now().Format("2006-01-02 15:04:05"))
-	return md.String()
+	var generatedAt time.Time
+	if !mf.options.Reproducible {
+		generatedAt = time.Now()
+	}
+	footer, err := mf.template.execute("footer", TemplateDocument{GeneratedAt: generatedAt})
+	if err != nil {
+		slog.Warn("Failed to render footer", "error", err)
+	}
+	return footer
 }
 
 // escapeMarkdown 转义Markdown特殊字符 (废弃的本地实现，使用共享的EscapeMarkdown)
@@ -0,0 +1,147 @@
+package south2md
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// codeBlockIDPattern matches the id phpwind gives the box of a [code] block.
+var codeBlockIDPattern = regexp.MustCompile(`^code\d+$`)
+
+// copyCodeLabels are the texts of the "copy" heading phpwind puts above a
+// [code] block.
+var copyCodeLabels = []string{"copy code", "复制代码", "複製代碼"}
+
+// keepCodeBlocks is a converter pre-render hook that turns phpwind [code]
+// boxes (a blockquote#codeN, or a .blockcode div, of <li> or <br> separated
+// lines) into <pre><code>, so they become fenced code blocks instead of
+// quoted lists with their markdown escaped. The "Copy code" heading above
+// the box is dropped.
+func keepCodeBlocks(_ converter.Context, doc *html.Node) {
+	var boxes []*html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if isCodeBox(n) {
+			boxes = append(boxes, n)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	for _, box := range boxes {
+		if prev := previousElement(box); prev != nil && isCopyCodeHeading(prev) {
+			prev.Parent.RemoveChild(prev)
+		}
+		code := &html.Node{Type: html.ElementNode, Data: "code", DataAtom: atom.Code}
+		code.AppendChild(&html.Node{Type: html.TextNode, Data: codeBoxText(box)})
+		pre := &html.Node{Type: html.ElementNode, Data: "pre", DataAtom: atom.Pre}
+		pre.AppendChild(code)
+		box.Parent.InsertBefore(pre, box)
+		box.Parent.RemoveChild(box)
+	}
+}
+
+func isCodeBox(n *html.Node) bool {
+	if n.Type != html.ElementNode || n.Parent == nil {
+		return false
+	}
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "id":
+			if codeBlockIDPattern.MatchString(attr.Val) {
+				return true
+			}
+		case "class":
+			if strings.Contains(" "+attr.Val+" ", " blockcode ") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isCopyCodeHeading(n *html.Node) bool {
+	if n.Data != "h6" && n.Data != "div" {
+		return false
+	}
+	text := strings.ToLower(strings.TrimSpace(htmlquery.InnerText(n)))
+	for _, label := range copyCodeLabels {
+		if strings.Contains(text, label) {
+			return len(text) <= len(label)+16
+		}
+	}
+	return false
+}
+
+// previousElement returns the element sibling before n, skipping blank text.
+func previousElement(n *html.Node) *html.Node {
+	for p := n.PrevSibling; p != nil; p = p.PrevSibling {
+		switch p.Type {
+		case html.ElementNode:
+			return p
+		case html.TextNode:
+			if strings.TrimSpace(p.Data) != "" {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// codeBoxText returns the lines of a code box: one per <li>, or split at
+// <br> and block elements when it has no list.
+func codeBoxText(box *html.Node) string {
+	var lines []string
+	var line strings.Builder
+	broke := true
+	flush := func() {
+		lines = append(lines, line.String())
+		line.Reset()
+		broke = true
+	}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			if n.Parent != nil && (n.Parent.Data == "ol" || n.Parent.Data == "ul") {
+				// Indentation of the list markup, not of the code.
+				return
+			}
+			line.WriteString(strings.NewReplacer("\u00a0", " ", "\r", "").Replace(n.Data))
+			broke = false
+			return
+		case n.Type == html.ElementNode && n.Data == "br":
+			flush()
+			return
+		}
+		before := len(lines)
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if n.Type != html.ElementNode {
+			return
+		}
+		// An empty <li> is a blank line of code.
+		if !broke || (n.Data == "li" && len(lines) == before) {
+			switch n.Data {
+			case "li", "p", "div":
+				flush()
+			}
+		}
+	}
+	for c := box.FirstChild; c != nil; c = c.NextSibling {
+		walk(c)
+	}
+	if !broke {
+		flush()
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
@@ -0,0 +1,57 @@
+package south2md_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	main "github.com/fdkevin0/south2md"
+)
+
+// structuredFloorHTML is a floor as phpwind renders [table], [code] and [s].
+const structuredFloorHTML = `配置如下：<br />
+<table class="read_form" cellspacing="0" cellpadding="0"><tr><td>名称</td><td>大小</td></tr>
+<tr><td>game.zip</td><td>1.2 GB<br />分卷</td></tr></table>
+<h6 class="quote"><a href="javascript:" onclick="CopyCode(document.getElementById('code1'));">Copy code</a></h6><blockquote id="code1" class="blockquote"><ol>
+<li>[General]</li>
+<li>&nbsp;&nbsp;path = *.exe</li>
+<li></li>
+<li>lang = zh_CN</li>
+</ol></blockquote>
+<del>旧版已失效</del>`
+
+func TestGenerateMarkdownKeepsTablesAndCodeBlocks(t *testing.T) {
+	fixture, err := os.ReadFile("tid-2636739.html")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	page := strings.Replace(string(fixture), "80分都不够，多少分才算及格", structuredFloorHTML, 1)
+	parser := main.NewPostParser()
+	if err := parser.LoadFromString(page); err != nil {
+		t.Fatalf("LoadFromString returned error: %v", err)
+	}
+	post, err := parser.ExtractPost()
+	if err != nil {
+		t.Fatalf("ExtractPost returned error: %v", err)
+	}
+
+	g := main.NewMarkdownGenerator(&main.MarkdownOptions{}, nil)
+	g.SetDownloadEnabled(false)
+	md, err := g.GenerateMarkdown(post)
+	if err != nil {
+		t.Fatalf("GenerateMarkdown returned error: %v", err)
+	}
+	for _, want := range []string{
+		"| 名称 | 大小 |\n|---|---|\n| game.zip | 1.2 GB",
+		"<br />分卷 |",
+		"```\n[General]\n  path = *.exe\n\nlang = zh_CN\n```",
+		"~~旧版已失效~~",
+	} {
+		if !strings.Contains(md, want) {
+			t.Fatalf("expected %q in:\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, "Copy code") {
+		t.Fatalf("expected the copy heading of the code block to be dropped:\n%s", md)
+	}
+}
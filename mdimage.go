@@ -0,0 +1,405 @@
+package south2md
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"golang.org/x/net/html"
+)
+
+// imageLink locates one inline image link, ![alt](dest "title"), in a
+// markdown document. Offsets are byte offsets into the parsed source; the
+// strings are the parts of the link as written, escapes included.
+type imageLink struct {
+	Start, End         int // the whole link, from '!' to the closing ')'
+	DestStart, DestEnd int // the destination, without <> brackets
+
+	Alt    string
+	Dest   string
+	Title  string // with its quotes, e.g. "title"
+	Angled bool   // the destination is written as <dest>
+}
+
+var imageLinksKey = parser.NewContextKey()
+
+// imageSpanParser wraps goldmark's link parser and records the source span of
+// every inline image it parses, which the AST itself doesn't keep.
+type imageSpanParser struct {
+	parser.InlineParser
+}
+
+func (p imageSpanParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	_, before := block.Position()
+	node := p.InlineParser.Parse(parent, block, pc)
+	img, ok := node.(*ast.Image)
+	if !ok {
+		return node
+	}
+	_, after := block.Position()
+	if link, ok := locateImageLink(block.Source(), before.Start, after.Start); ok {
+		links, _ := pc.Get(imageLinksKey).([]imageLink)
+		pc.Set(imageLinksKey, append(links, link))
+	}
+	return img
+}
+
+// locateImageLink finds the span of the inline image whose label closes at
+// the ']' at offset closer and which ends before end. Reference images have
+// no destination in place and are skipped.
+func locateImageLink(src []byte, closer, end int) (imageLink, bool) {
+	if closer+1 >= len(src) || src[closer+1] != '(' || end > len(src) {
+		return imageLink{}, false
+	}
+	start := -1
+	depth := 0
+	for i := closer; i > 0; i-- {
+		if isEscaped(src, i) {
+			continue
+		}
+		switch src[i] {
+		case ']':
+			depth++
+		case '[':
+			depth--
+		}
+		if depth == 0 {
+			if src[i-1] == '!' {
+				start = i - 1
+			}
+			break
+		}
+	}
+	if start < 0 {
+		return imageLink{}, false
+	}
+
+	i := closer + 2
+	for i < end && (src[i] == ' ' || src[i] == '\t') {
+		i++
+	}
+	link := imageLink{Start: start, End: end, DestStart: i, DestEnd: i}
+	if i < end && src[i] == '<' {
+		link.DestStart = i + 1
+		link.Angled = true
+		for j := i + 1; j < end && link.DestEnd == i; j++ {
+			if src[j] == '>' && !isEscaped(src, j) {
+				link.DestEnd = j
+			}
+		}
+		if link.DestEnd == i {
+			return imageLink{}, false
+		}
+		return link.withParts(src, closer), true
+	}
+	opened := 0
+	for ; i < end; i++ {
+		c := src[i]
+		if c == '\\' && i+1 < end && util.IsPunct(src[i+1]) {
+			i++
+			continue
+		}
+		if c == '(' {
+			opened++
+		} else if c == ')' {
+			if opened--; opened < 0 {
+				break
+			}
+		} else if util.IsSpace(c) {
+			break
+		}
+	}
+	link.DestEnd = i
+	return link.withParts(src, closer), true
+}
+
+// withParts fills in the alt text, destination and title of l from src.
+func (l imageLink) withParts(src []byte, closer int) imageLink {
+	l.Alt = string(src[l.Start+2 : closer])
+	l.Dest = string(src[l.DestStart:l.DestEnd])
+	rest := src[l.DestEnd : l.End-1]
+	if l.Angled {
+		rest = rest[1:]
+	}
+	l.Title = strings.TrimSpace(string(rest))
+	return l
+}
+
+// replaceImageLinks replaces every inline image link of markdown with what fn
+// returns for it, leaving the rest of the document byte for byte unchanged.
+func replaceImageLinks(markdown string, fn func(link imageLink) string) string {
+	links := findImageLinks([]byte(markdown))
+	if len(links) == 0 {
+		return markdown
+	}
+	var out strings.Builder
+	out.Grow(len(markdown))
+	last := 0
+	for _, link := range links {
+		if link.Start < last {
+			continue
+		}
+		out.WriteString(markdown[last:link.Start])
+		out.WriteString(fn(link))
+		last = link.End
+	}
+	out.WriteString(markdown[last:])
+	return out.String()
+}
+
+// isEscaped reports whether src[i] is preceded by an odd number of
+// backslashes.
+func isEscaped(src []byte, i int) bool {
+	n := 0
+	for j := i - 1; j >= 0 && src[j] == '\\'; j-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// sharedImageParser is a CommonMark parser whose link parser records image
+// spans. Like sharedConverter it is safe for concurrent use.
+var sharedImageParser = sync.OnceValue(func() parser.Parser {
+	inlines := parser.DefaultInlineParsers()
+	for i, p := range inlines {
+		if p.Value == parser.NewLinkParser() {
+			inlines[i] = util.Prioritized(imageSpanParser{p.Value.(parser.InlineParser)}, p.Priority)
+		}
+	}
+	return parser.NewParser(
+		parser.WithBlockParsers(parser.DefaultBlockParsers()...),
+		parser.WithInlineParsers(inlines...),
+		parser.WithParagraphTransformers(parser.DefaultParagraphTransformers()...),
+	)
+})
+
+// findImageLinks parses src as markdown and returns its inline image links in
+// document order. Unlike a pattern match it follows CommonMark, so alt texts
+// with escaped brackets, titles with parentheses and links inside code spans
+// or code blocks are handled correctly.
+func findImageLinks(src []byte) []imageLink {
+	pc := parser.NewContext()
+	sharedImageParser().Parse(text.NewReader(src), parser.WithContext(pc))
+	links, _ := pc.Get(imageLinksKey).([]imageLink)
+	// An image in the alt text of another closes first.
+	sort.SliceStable(links, func(i, j int) bool { return links[i].Start < links[j].Start })
+	return links
+}
+
+// sizeHintPattern matches the "|WxH" or "|W" size hint at the end of an alt
+// text.
+var sizeHintPattern = regexp.MustCompile(`\|(\d+)(?:x(\d+))?$`)
+
+// keepImageSizeHints is a converter pre-render hook that keeps the width and
+// height attributes of <img> tags as an Obsidian style "|WxH" suffix of the
+// alt text, since markdown image links have no size syntax of their own.
+func keepImageSizeHints(_ converter.Context, doc *html.Node) {
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "img" {
+			addSizeHint(n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+}
+
+// lazySourceAttrs are the attributes lazy-loading scripts keep the real image
+// URL in while src holds a placeholder, in order of preference.
+var lazySourceAttrs = []string{"data-original", "data-src", "data-lazy-src", "lazy-src", "data-echo", "zoomfile", "file"}
+
+// resolveLazyImages is a converter pre-render hook that points the src of
+// <img> tags at the real image instead of a lazy-loading placeholder: the
+// largest candidate of srcset (or data-srcset), else the first of
+// lazySourceAttrs that is set.
+func resolveLazyImages(_ converter.Context, doc *html.Node) {
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "img" {
+			if src := realImageSource(n); src != "" {
+				setAttr(n, "src", src)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+}
+
+// realImageSource returns the URL img really shows, or "" when src is all
+// there is.
+func realImageSource(img *html.Node) string {
+	attrs := make(map[string]string, len(img.Attr))
+	for _, attr := range img.Attr {
+		attrs[attr.Key] = strings.TrimSpace(attr.Val)
+	}
+	for _, key := range []string{"srcset", "data-srcset"} {
+		if src := largestSrcsetCandidate(attrs[key]); src != "" {
+			return src
+		}
+	}
+	for _, key := range lazySourceAttrs {
+		if src := attrs[key]; src != "" && !strings.HasPrefix(src, "data:") {
+			return src
+		}
+	}
+	return ""
+}
+
+// largestSrcsetCandidate returns the URL of the widest candidate of a srcset
+// ("a.jpg 640w, b.jpg 1280w"), or of the highest density ("a.jpg, b.jpg 2x")
+// when it has no width descriptors.
+func largestSrcsetCandidate(srcset string) string {
+	best, bestWidth, bestDensity := "", -1.0, -1.0
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "data:") {
+			continue
+		}
+		width, density := -1.0, 1.0
+		if len(fields) > 1 {
+			descriptor := strings.ToLower(fields[1])
+			v, err := strconv.ParseFloat(descriptor[:len(descriptor)-1], 64)
+			if err != nil {
+				continue
+			}
+			switch descriptor[len(descriptor)-1] {
+			case 'w':
+				width = v
+			case 'x':
+				density = v
+			default:
+				continue
+			}
+		}
+		if width > bestWidth || (width == bestWidth && density > bestDensity) {
+			best, bestWidth, bestDensity = fields[0], width, density
+		}
+	}
+	return best
+}
+
+// resolveThumbnailOriginals is a converter pre-render hook that points the
+// src of a thumbnail <img> at its full-size original, so the original is
+// archived instead of the thumbnail: the image its onclick opens with
+// window.open (how phpwind links attachment images), else the image its
+// enclosing link points to.
+func resolveThumbnailOriginals(_ converter.Context, doc *html.Node) {
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "img" {
+			if original := thumbnailOriginal(n); original != "" {
+				setAttr(n, "src", original)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+}
+
+// thumbnailOriginal returns the URL of the full-size image of img, or "".
+func thumbnailOriginal(img *html.Node) string {
+	for _, attr := range img.Attr {
+		if attr.Key == "onclick" {
+			if m := windowOpenPattern.FindStringSubmatch(attr.Val); len(m) > 1 && isImagePath(m[1]) {
+				return strings.TrimSpace(m[1])
+			}
+		}
+	}
+	for p := img.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && p.Data == "a" {
+			for _, attr := range p.Attr {
+				if attr.Key == "href" && isImagePath(attr.Val) {
+					return strings.TrimSpace(attr.Val)
+				}
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// isImagePath reports whether rawURL names an image file by its extension.
+func isImagePath(rawURL string) bool {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mime.TypeByExtension(strings.ToLower(path.Ext(u.Path))), "image/")
+}
+
+// setAttr sets the attribute key of n to val.
+func setAttr(n *html.Node, key, val string) {
+	for i, attr := range n.Attr {
+		if attr.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+func addSizeHint(img *html.Node) {
+	width, height := pixelAttr(img, "width"), pixelAttr(img, "height")
+	if width == 0 {
+		// The hint can't express a height alone.
+		return
+	}
+	hint := "|" + strconv.Itoa(width)
+	if height > 0 {
+		hint += fmt.Sprintf("x%d", height)
+	}
+	for i, attr := range img.Attr {
+		if attr.Key == "alt" {
+			if !sizeHintPattern.MatchString(attr.Val) {
+				img.Attr[i].Val = strings.TrimSpace(attr.Val) + hint
+			}
+			return
+		}
+	}
+	img.Attr = append(img.Attr, html.Attribute{Key: "alt", Val: hint})
+}
+
+// pixelAttr returns the attribute key of n as a positive pixel count, or 0.
+func pixelAttr(n *html.Node, key string) int {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			v, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(attr.Val), "px"))
+			if err != nil || v <= 0 {
+				return 0
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+// splitSizeHint splits the "|WxH" size hint off alt. width and height are
+// empty when alt has none.
+func splitSizeHint(alt string) (text, width, height string) {
+	match := sizeHintPattern.FindStringSubmatchIndex(alt)
+	if match == nil {
+		return alt, "", ""
+	}
+	width = alt[match[2]:match[3]]
+	if match[4] >= 0 {
+		height = alt[match[4]:match[5]]
+	}
+	return alt[:match[0]], width, height
+}
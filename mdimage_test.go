@@ -0,0 +1,114 @@
+package south2md
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+)
+
+func TestFindImageLinksFollowsCommonMark(t *testing.T) {
+	src := []byte("![a \\[b\\] c](https://a.com/1.jpg 'say \"hi\" (twice)')\n\n" +
+		"`![code](https://a.com/skip.jpg)`\n\n" +
+		"    ![indented](https://a.com/skip.jpg)\n\n" +
+		"[![inner](<https://a.com/2.jpg>)](https://a.com/big.jpg) ![](https://a.com/3(1).jpg)\n")
+
+	var got []string
+	for _, link := range findImageLinks(src) {
+		got = append(got, link.Dest)
+	}
+	want := []string{"https://a.com/1.jpg", "https://a.com/2.jpg", "https://a.com/3(1).jpg"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("unexpected destinations %v", got)
+	}
+
+	first := findImageLinks(src)[0]
+	if text := string(src[first.Start:first.End]); !strings.HasPrefix(text, "![a \\[b\\] c]") || !strings.HasSuffix(text, "(twice)')") {
+		t.Fatalf("unexpected link span %q", text)
+	}
+}
+
+func TestConverterKeepsImageSizeHints(t *testing.T) {
+	markdown, err := sharedConverter().ConvertString(
+		`<p><img src="https://a.com/x.jpg" alt="cover" title="t" width="150" height="155"><img src="https://a.com/y.jpg" height="96"></p>`,
+		converter.WithDomain("https://south-plus.net/"),
+	)
+	if err != nil {
+		t.Fatalf("ConvertString: %v", err)
+	}
+	if !strings.Contains(markdown, `![cover|150x155](https://a.com/x.jpg "t")`) || !strings.Contains(markdown, "![](https://a.com/y.jpg)") {
+		t.Fatalf("unexpected markdown %q", markdown)
+	}
+
+	got := applyImageStyle(markdown, ImageStyleFigure)
+	if !strings.Contains(got, `<img src="https://a.com/x.jpg" alt="cover" width="150" height="155"><figcaption>cover</figcaption>`) {
+		t.Fatalf("expected the size hint as attributes, got %q", got)
+	}
+}
+
+func TestConverterResolvesLazyImages(t *testing.T) {
+	markdown, err := sharedConverter().ConvertString(
+		`<p><img src="images/loading.gif" data-original="https://a.com/full.jpg">`+
+			`<img src="data:image/gif;base64,R0lGOD" data-src="attachment/1.jpg">`+
+			`<img src="https://a.com/small.jpg" srcset="https://a.com/m.jpg 640w, https://a.com/l.jpg 1280w, https://a.com/s.jpg 320w">`+
+			`<img src="https://a.com/1x.jpg" data-srcset="https://a.com/1x.jpg, https://a.com/3x.jpg 3x, https://a.com/2x.jpg 2x">`+
+			`<img src="https://a.com/plain.jpg" data-src="data:image/gif;base64,R0lGOD"></p>`,
+		converter.WithDomain("https://south-plus.net/"),
+	)
+	if err != nil {
+		t.Fatalf("ConvertString: %v", err)
+	}
+	var got []string
+	for _, link := range findImageLinks([]byte(markdown)) {
+		got = append(got, link.Dest)
+	}
+	want := []string{"https://a.com/full.jpg", "https://south-plus.net/attachment/1.jpg", "https://a.com/l.jpg", "https://a.com/3x.jpg", "https://a.com/plain.jpg"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("expected images %v, got %v in %q", want, got, markdown)
+	}
+}
+
+func TestConverterResolvesThumbnailOriginals(t *testing.T) {
+	markdown, err := sharedConverter().ConvertString(
+		`<span id="att_1"><img src="//south-plus.net/attachment/thumb/Mon_2508/1.jpg" onclick="if(this.width>=680) window.open('//south-plus.net/attachment/Mon_2508/1.jpg');"></span>`+
+			`<a href="https://a.com/full.png?x=1"><img src="https://a.com/small.png"></a>`+
+			`<img src="https://a.com/banner.jpg" onclick="window.open('read.php?tid-1.html');">`+
+			`<a href="https://a.com/page.html"><img src="https://a.com/linked.jpg"></a>`,
+		converter.WithDomain("https://south-plus.net/"),
+	)
+	if err != nil {
+		t.Fatalf("ConvertString: %v", err)
+	}
+	var got []string
+	for _, link := range findImageLinks([]byte(markdown)) {
+		got = append(got, link.Dest)
+	}
+	want := []string{"https://south-plus.net/attachment/Mon_2508/1.jpg", "https://a.com/full.png?x=1", "https://a.com/banner.jpg", "https://a.com/linked.jpg"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("expected images %v, got %v in %q", want, got, markdown)
+	}
+}
+
+func TestDownloadKeepsAltAndTitle(t *testing.T) {
+	h, _ := newVerifyTestHandler(t, &stubDoer{body: "image-bytes"})
+
+	src := "![a \\[b\\]|150x155](https://img.example.com/a.jpg 'the \"title\" (1)') and `![a](https://img.example.com/code.jpg)`"
+	got, err := h.DownloadAndCacheImages("100", []byte(src), &Post{})
+	if err != nil {
+		t.Fatalf("DownloadAndCacheImages returned error: %v", err)
+	}
+	if !strings.HasPrefix(string(got), "![a \\[b\\]|150x155](images/") || !strings.Contains(string(got), ".jpg 'the \"title\" (1)') and `![a](https://img.example.com/code.jpg)`") {
+		t.Fatalf("expected only the destination to change, got %q", got)
+	}
+}
+
+func TestRewriteLocalImageLinksKeepsTheRestOfTheLink(t *testing.T) {
+	g := NewMarkdownGenerator(&MarkdownOptions{}, nil)
+	src := "![a \\[1\\]|150x155](images/a.jpg 'the (title)') ![b](https://img.example.com/b.jpg)\n\n```\n![c](images/c.jpg)\n```"
+
+	got := g.rewriteLocalImageLinks(src, func(file string) string { return "/static/" + file })
+	want := "![a \\[1\\]|150x155](/static/a.jpg 'the (title)') ![b](https://img.example.com/b.jpg)\n\n```\n![c](images/c.jpg)\n```"
+	if got != want {
+		t.Fatalf("unexpected rewrite:\n%s", got)
+	}
+}
@@ -0,0 +1,196 @@
+package south2md
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+)
+
+// Mention is a user a floor mentions, by @name or by a link to their u.php
+// profile.
+type Mention struct {
+	Username string `toml:"username"`      // 被提及的用户名
+	UID      string `toml:"uid,omitempty"` // 用户ID(未知为空)
+	Floor    string `toml:"floor"`         // 提及所在的楼层
+	PostID   string `toml:"post_id"`       // 提及所在楼层的PostID
+}
+
+// mentionPattern matches @name in text, but not the @ of an email address.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.])@([\p{L}\p{N}_-]+)`)
+
+// maxMentionFloors caps the floors listed per user in the mention index.
+const maxMentionFloors = 10
+
+// ExtractMentions returns the mentions of every floor of post in thread
+// order, each user at most once per floor. Mentions inside quotes belong to
+// the quoted floor and are skipped. A @name gets the UID of the thread
+// participant or linked profile of that name, when there is one.
+func ExtractMentions(post *Post) []Mention {
+	floors := postFloors(post)
+	uids := knownUIDs(floors)
+	var mentions []Mention
+	for i, entry := range floors {
+		mentions = append(mentions, floorMentions(entry, floorLabel(i, entry), uids)...)
+	}
+	return mentions
+}
+
+// knownUIDs maps the lowercased usernames of the authors of floors to their
+// UIDs.
+func knownUIDs(floors []*PostEntry) map[string]string {
+	uids := make(map[string]string)
+	for _, entry := range floors {
+		if entry.Author.Username != "" && entry.Author.UID != "" {
+			uids[strings.ToLower(entry.Author.Username)] = entry.Author.UID
+		}
+	}
+	return uids
+}
+
+// floorMentions extracts the mentions of one floor labelled floor. Profile
+// links add their username to uids.
+func floorMentions(entry *PostEntry, floor string, uids map[string]string) []Mention {
+	if !strings.Contains(entry.HTMLContent, "@") && !strings.Contains(entry.HTMLContent, "u.php") {
+		return nil
+	}
+	root := parseFragment(entry.HTMLContent)
+	inQuote := make(map[*html.Node]bool)
+	if selector, err := compileSelector(quoteSelector); err == nil {
+		for _, n := range selector.MatchAll(root) {
+			inQuote[n] = true
+		}
+	}
+
+	var mentions []Mention
+	seen := make(map[string]bool)
+	add := func(username, uid string) {
+		username = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(username), "@"))
+		if uid == "" {
+			uid = uids[strings.ToLower(username)]
+		}
+		key := "uid:" + uid
+		if uid == "" {
+			if username == "" {
+				return
+			}
+			key = "name:" + strings.ToLower(username)
+		}
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		mentions = append(mentions, Mention{Username: username, UID: uid, Floor: floor, PostID: entry.PostID})
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if inQuote[n] {
+			return
+		}
+		switch {
+		case n.Type == html.ElementNode && n.Data == "a":
+			href := htmlquery.SelectAttr(n, "href")
+			if strings.Contains(href, "u.php") {
+				if m := uidURLPattern.FindStringSubmatch(href); len(m) == 2 {
+					username := strings.TrimPrefix(strings.TrimSpace(htmlquery.InnerText(n)), "@")
+					if username != "" {
+						uids[strings.ToLower(username)] = m[1]
+					}
+					add(username, m[1])
+					return
+				}
+			}
+		case n.Type == html.TextNode:
+			for _, m := range mentionPattern.FindAllStringSubmatch(n.Data, -1) {
+				add(m[1], "")
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return mentions
+}
+
+// mentionedUser is one user of the mention index with the floors mentioning
+// them.
+type mentionedUser struct {
+	Username string
+	UID      string
+	Floors   []TemplateFloor
+}
+
+// collectMentionedUsers groups the mentions of floors by user (UID, or the
+// username when the UID is unknown), in order of first mention.
+func collectMentionedUsers(floors []TemplateFloor) []mentionedUser {
+	entries := make([]*PostEntry, len(floors))
+	for i := range floors {
+		entries[i] = &floors[i].Entry
+	}
+	uids := knownUIDs(entries)
+
+	var users []mentionedUser
+	byUser := make(map[string]int)
+	for _, floor := range floors {
+		entry := floor.Entry
+		for _, m := range floorMentions(&entry, floor.Floor, uids) {
+			key := "uid:" + m.UID
+			if m.UID == "" {
+				key = "name:" + strings.ToLower(m.Username)
+			}
+			n, ok := byUser[key]
+			if !ok {
+				n = len(users)
+				byUser[key] = n
+				users = append(users, mentionedUser{Username: m.Username, UID: m.UID})
+			}
+			users[n].Floors = append(users[n].Floors, floor)
+		}
+	}
+	return users
+}
+
+// FormatMentionIndex renders the index of mentioned users linking to floors
+// in the same document, or "" when MentionIndex is off or nobody is
+// mentioned.
+func (mf *MarkdownFormatter) FormatMentionIndex(floors []TemplateFloor) string {
+	return mf.formatMentionIndex(floors, func(floor TemplateFloor) string {
+		return "#pid" + floor.Entry.PostID
+	})
+}
+
+// formatMentionIndex renders the mention index as a table, linking each
+// mentioning floor to href(floor).
+func (mf *MarkdownFormatter) formatMentionIndex(floors []TemplateFloor, href func(TemplateFloor) string) string {
+	if !mf.options.MentionIndex {
+		return ""
+	}
+	users := collectMentionedUsers(floors)
+	if len(users) == 0 {
+		return ""
+	}
+
+	var md strings.Builder
+	md.WriteString("**被提及的用户**\n\n")
+	md.WriteString("| 用户 | 被提及次数 | 楼层 |\n")
+	md.WriteString("| --- | ---: | --- |\n")
+	for _, u := range users {
+		name := EscapeMarkdown(u.Username)
+		if u.UID != "" {
+			name += " (UID:" + u.UID + ")"
+		}
+		links := make([]string, 0, min(len(u.Floors), maxMentionFloors))
+		for _, floor := range u.Floors[:min(len(u.Floors), maxMentionFloors)] {
+			links = append(links, fmt.Sprintf("[%s](%s)", floor.Floor, href(floor)))
+		}
+		if more := len(u.Floors) - maxMentionFloors; more > 0 {
+			links = append(links, fmt.Sprintf("等 %d 层", more))
+		}
+		fmt.Fprintf(&md, "| %s | %d | %s |\n", name, len(u.Floors), strings.Join(links, " "))
+	}
+	return md.String()
+}
@@ -0,0 +1,58 @@
+package south2md_test
+
+import (
+	"strings"
+	"testing"
+
+	main "github.com/fdkevin0/south2md"
+)
+
+func mentionTestPost() *main.Post {
+	return &main.Post{
+		TID:      "100",
+		Title:    "mentions",
+		MainPost: main.PostEntry{Floor: "GF", PostID: "tpc", Author: main.Author{Username: "alice", UID: "1"}, HTMLContent: "<p>hello</p>"},
+		Replies: []main.PostEntry{
+			{Floor: "B1F", PostID: "201", Author: main.Author{Username: "bob", UID: "2"}, HTMLContent: `@alice 谢谢分享, @Alice 再次感谢, mail me at bob@example.com`},
+			{Floor: "B2F", PostID: "202", HTMLContent: `看 <a href="u.php?action-show-uid-3.html">@carol</a> 的帖子，还有 @carol 和 @dave`},
+			{Floor: "B3F", PostID: "203", HTMLContent: `<blockquote class="blockquote">@dave said</blockquote>@bob`},
+		},
+	}
+}
+
+func TestExtractMentions(t *testing.T) {
+	var got []string
+	for _, m := range main.ExtractMentions(mentionTestPost()) {
+		got = append(got, m.Floor+":"+m.PostID+":"+m.Username+":"+m.UID)
+	}
+	want := "B1F:201:alice:1,B2F:202:carol:3,B2F:202:dave:,B3F:203:bob:2"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("expected mentions %s, got %s", want, strings.Join(got, ","))
+	}
+}
+
+func TestGenerateMarkdownMentionIndex(t *testing.T) {
+	g := main.NewMarkdownGenerator(&main.MarkdownOptions{MentionIndex: true}, nil)
+	g.SetDownloadEnabled(false)
+	md, err := g.GenerateMarkdown(mentionTestPost())
+	if err != nil {
+		t.Fatalf("GenerateMarkdown returned error: %v", err)
+	}
+	for _, want := range []string{
+		"**被提及的用户**",
+		"| alice (UID:1) | 1 | [B1F](#pid201) |",
+		"| carol (UID:3) | 1 | [B2F](#pid202) |",
+		"| dave | 1 | [B2F](#pid202) |",
+		"| bob (UID:2) | 1 | [B3F](#pid203) |",
+	} {
+		if !strings.Contains(md, want) {
+			t.Fatalf("expected %q in:\n%s", want, md)
+		}
+	}
+
+	g = main.NewMarkdownGenerator(&main.MarkdownOptions{}, nil)
+	g.SetDownloadEnabled(false)
+	if md, err = g.GenerateMarkdown(mentionTestPost()); err != nil || strings.Contains(md, "被提及的用户") {
+		t.Fatalf("expected no mention index by default, got %v:\n%s", err, md)
+	}
+}
@@ -0,0 +1,274 @@
+package south2md
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric names exported by Metrics.
+const (
+	MetricRequestsTotal   = "south2md_requests_total"
+	MetricBytesTotal      = "south2md_bytes_total"
+	MetricRetriesTotal    = "south2md_retries_total"
+	MetricErrorsTotal     = "south2md_errors_total"
+	MetricRequestDuration = "south2md_request_duration_seconds"
+)
+
+// Components that report metrics, used as the "component" label.
+const (
+	MetricsComponentFetcher = "fetcher"
+	MetricsComponentImage   = "image"
+	MetricsComponentGofile  = "gofile"
+)
+
+var metricHelp = map[string]string{
+	MetricRequestsTotal:   "HTTP requests sent, by component.",
+	MetricBytesTotal:      "Response bytes received, by component.",
+	MetricRetriesTotal:    "Request retries, by component.",
+	MetricErrorsTotal:     "Failed requests, by component and error type.",
+	MetricRequestDuration: "Request duration in seconds, by component.",
+}
+
+// durationBuckets are the histogram upper bounds in seconds.
+var durationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+type histogram struct {
+	counts []uint64 // per bucket, cumulative on output
+	sum    float64
+	count  uint64
+}
+
+// Metrics collects counters and duration histograms for a run and renders
+// them in the Prometheus text format. A nil *Metrics ignores every call, so
+// components can record unconditionally. It is safe for concurrent use.
+type Metrics struct {
+	mu         sync.Mutex
+	counters   map[string]map[string]float64 // name -> label set -> value
+	histograms map[string]map[string]*histogram
+}
+
+// NewMetrics creates an empty metrics registry.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		counters:   make(map[string]map[string]float64),
+		histograms: make(map[string]map[string]*histogram),
+	}
+}
+
+// Add increases counter name by value. labels are key/value pairs.
+func (m *Metrics) Add(name string, value float64, labels ...string) {
+	if m == nil {
+		return
+	}
+	key := formatLabels(labels)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series, ok := m.counters[name]
+	if !ok {
+		series = make(map[string]float64)
+		m.counters[name] = series
+	}
+	series[key] += value
+}
+
+// Observe records one duration in histogram name.
+func (m *Metrics) Observe(name string, d time.Duration, labels ...string) {
+	if m == nil {
+		return
+	}
+	key := formatLabels(labels)
+	seconds := d.Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series, ok := m.histograms[name]
+	if !ok {
+		series = make(map[string]*histogram)
+		m.histograms[name] = series
+	}
+	h, ok := series[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		series[key] = h
+	}
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// Counter returns the current value of counter name for labels.
+func (m *Metrics) Counter(name string, labels ...string) float64 {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[name][formatLabels(labels)]
+}
+
+// recordRequest records one finished request of component: its duration,
+// received bytes and, when err is non-nil, an error classified by metricsErrorType.
+func (m *Metrics) recordRequest(component string, start time.Time, bytes int64, err error) {
+	if m == nil {
+		return
+	}
+	m.Add(MetricRequestsTotal, 1, "component", component)
+	m.Observe(MetricRequestDuration, time.Since(start), "component", component)
+	if bytes > 0 {
+		m.Add(MetricBytesTotal, float64(bytes), "component", component)
+	}
+	if err != nil {
+		m.Add(MetricErrorsTotal, 1, "component", component, "type", metricsErrorType(err))
+	}
+}
+
+// metricsErrorType classifies err for the "type" label.
+func metricsErrorType(err error) string {
+	var appErr *AppError
+	if errors.As(err, &appErr) {
+		return string(appErr.Type)
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return fmt.Sprintf("http_%dxx", statusErr.StatusCode/100)
+	}
+	return string(NetworkError)
+}
+
+// httpStatusError reports an unexpected HTTP status.
+type httpStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("bad status code: %s", e.Status)
+}
+
+// WritePrometheus writes all metrics in the Prometheus text exposition format.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	for _, name := range sortedKeys(m.counters) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", name, metricHelp[name], name)
+		series := m.counters[name]
+		for _, labels := range sortedKeys(series) {
+			fmt.Fprintf(&b, "%s%s %s\n", name, labels, strconv.FormatFloat(series[labels], 'f', -1, 64))
+		}
+	}
+	for _, name := range sortedKeys(m.histograms) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s histogram\n", name, metricHelp[name], name)
+		series := m.histograms[name]
+		for _, labels := range sortedKeys(series) {
+			h := series[labels]
+			var cumulative uint64
+			for i, bound := range durationBuckets {
+				cumulative += h.counts[i]
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", name, withLabel(labels, "le", strconv.FormatFloat(bound, 'f', -1, 64)), cumulative)
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", name, withLabel(labels, "le", "+Inf"), h.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", name, labels, strconv.FormatFloat(h.sum, 'f', -1, 64))
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, labels, h.count)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = m.WritePrometheus(w)
+	})
+}
+
+// Summary renders per-component totals as plain text lines for CLI output.
+func (m *Metrics) Summary() string {
+	if m == nil {
+		return ""
+	}
+	components := []string{MetricsComponentFetcher, MetricsComponentImage, MetricsComponentGofile}
+
+	var b strings.Builder
+	for _, component := range components {
+		requests := m.Counter(MetricRequestsTotal, "component", component)
+		if requests == 0 {
+			continue
+		}
+		errorsTotal := 0.0
+		m.mu.Lock()
+		prefix := formatLabels([]string{"component", component})
+		prefix = prefix[:len(prefix)-1] + ","
+		for labels, value := range m.counters[MetricErrorsTotal] {
+			if strings.HasPrefix(labels, prefix) {
+				errorsTotal += value
+			}
+		}
+		var seconds float64
+		if h := m.histograms[MetricRequestDuration][formatLabels([]string{"component", component})]; h != nil {
+			seconds = h.sum
+		}
+		m.mu.Unlock()
+
+		if b.Len() == 0 {
+			b.WriteString("Metrics:\n")
+		}
+		fmt.Fprintf(&b, "  - %s: %.0f requests, %s, %.0f retries, %.0f errors, %.1fs total\n",
+			component, requests,
+			FormatByteSize(int64(m.Counter(MetricBytesTotal, "component", component))),
+			m.Counter(MetricRetriesTotal, "component", component),
+			errorsTotal, seconds)
+	}
+	return b.String()
+}
+
+// formatLabels renders key/value pairs as a Prometheus label set.
+func formatLabels(labels []string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("{")
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, "%s=%q", labels[i], labels[i+1])
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func withLabel(labels, key, value string) string {
+	pair := fmt.Sprintf("%s=%q", key, value)
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,67 @@
+package south2md
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsWritePrometheus(t *testing.T) {
+	m := NewMetrics()
+	m.Add(MetricRequestsTotal, 2, "component", "image")
+	m.Add(MetricErrorsTotal, 1, "component", "image", "type", "http_4xx")
+	m.Observe(MetricRequestDuration, 300*time.Millisecond, "component", "image")
+
+	var b strings.Builder
+	if err := m.WritePrometheus(&b); err != nil {
+		t.Fatalf("WritePrometheus returned error: %v", err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE south2md_requests_total counter\n",
+		`south2md_requests_total{component="image"} 2`,
+		`south2md_errors_total{component="image",type="http_4xx"} 1`,
+		`south2md_request_duration_seconds_bucket{component="image",le="0.25"} 0`,
+		`south2md_request_duration_seconds_bucket{component="image",le="0.5"} 1`,
+		`south2md_request_duration_seconds_bucket{component="image",le="+Inf"} 1`,
+		`south2md_request_duration_seconds_count{component="image"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in output:\n%s", want, out)
+		}
+	}
+	if summary := m.Summary(); !strings.Contains(summary, "image: 2 requests") || !strings.Contains(summary, "1 errors") {
+		t.Fatalf("unexpected summary: %q", summary)
+	}
+}
+
+func TestFetcherRecordsMetrics(t *testing.T) {
+	doer := &stubDoer{body: "<html>ok</html>"}
+	f := NewFetcher(doer, &HTTPOptions{MaxRetries: 1}, "https://forum.example.com/")
+	m := NewMetrics()
+	f.SetMetrics(m)
+
+	if _, err := f.FetchPost("1"); err != nil {
+		t.Fatalf("FetchPost returned error: %v", err)
+	}
+	if got := m.Counter(MetricRequestsTotal, "component", MetricsComponentFetcher); got != 1 {
+		t.Fatalf("requests = %v, want 1", got)
+	}
+	if got := m.Counter(MetricBytesTotal, "component", MetricsComponentFetcher); got != float64(len(doer.body)) {
+		t.Fatalf("bytes = %v, want %d", got, len(doer.body))
+	}
+}
+
+func TestMetricsErrorType(t *testing.T) {
+	cases := map[string]error{
+		"http_4xx":      &httpStatusError{StatusCode: 404, Status: "404 Not Found"},
+		"auth_error":    NewAuthError("denied", nil),
+		"network_error": errors.New("connection reset"),
+	}
+	for want, err := range cases {
+		if got := metricsErrorType(err); got != want {
+			t.Fatalf("metricsErrorType(%v) = %q, want %q", err, got, want)
+		}
+	}
+}
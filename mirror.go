@@ -0,0 +1,163 @@
+package south2md
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PageMirror records the forum mirror one page of a thread was fetched from.
+type PageMirror struct {
+	Page    int    `toml:"page"`     // 页码(从1开始)
+	BaseURL string `toml:"base_url"` // 提供该页的镜像基础URL
+}
+
+// mirrorSet is the forum's base URL followed by its mirrors. The fetcher
+// sends every forum request to the active mirror; when it turns out to be
+// blocked or unreachable, all later requests move on to the next one.
+type mirrorSet struct {
+	mu     sync.Mutex
+	bases  []string
+	active int
+
+	// served maps the threads being fetched to the mirror of each page.
+	served map[string]map[int]string
+}
+
+func newMirrorSet(baseURL string, mirrors []string) *mirrorSet {
+	m := &mirrorSet{}
+	seen := make(map[string]bool)
+	for _, base := range append([]string{baseURL}, mirrors...) {
+		base = strings.TrimRight(strings.TrimSpace(base), "/")
+		if base == "" || seen[strings.ToLower(base)] {
+			continue
+		}
+		seen[strings.ToLower(base)] = true
+		m.bases = append(m.bases, base)
+	}
+	if len(m.bases) == 0 {
+		m.bases = []string{""}
+	}
+	return m
+}
+
+// current returns the active mirror without a trailing slash.
+func (m *mirrorSet) current() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.bases[m.active]
+}
+
+// rebase moves targetURL from the mirror it points at to the active one and
+// returns it with that mirror. URLs outside the mirrors are left alone and
+// returned with "".
+func (m *mirrorSet) rebase(targetURL string) (string, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	active := m.bases[m.active]
+	for _, base := range m.bases {
+		if base != "" && strings.HasPrefix(targetURL, base+"/") {
+			return active + strings.TrimPrefix(targetURL, base), active
+		}
+	}
+	return targetURL, ""
+}
+
+// failover switches away from failed when it is still the active mirror. It
+// reports whether another mirror is active now, which is false once failed
+// was the last one.
+func (m *mirrorSet) failover(failed string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.bases[m.active] == failed {
+		if m.active+1 >= len(m.bases) {
+			return false
+		}
+		m.active++
+	}
+	return true
+}
+
+// track starts recording the mirrors serving the pages of thread tid. It
+// does nothing without mirrors.
+func (m *mirrorSet) track(tid string) {
+	if len(m.bases) < 2 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.served == nil {
+		m.served = make(map[string]map[int]string)
+	}
+	m.served[tid] = make(map[int]string)
+}
+
+func (m *mirrorSet) record(tid string, page int, base string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if pages, ok := m.served[tid]; ok {
+		pages[page] = base + "/"
+	}
+}
+
+// take stops recording thread tid and returns its pages' mirrors by page.
+func (m *mirrorSet) take(tid string) []PageMirror {
+	m.mu.Lock()
+	pages := m.served[tid]
+	delete(m.served, tid)
+	m.mu.Unlock()
+
+	var mirrors []PageMirror
+	for page, base := range pages {
+		mirrors = append(mirrors, PageMirror{Page: page, BaseURL: base})
+	}
+	sort.Slice(mirrors, func(i, j int) bool { return mirrors[i].Page < mirrors[j].Page })
+	return mirrors
+}
+
+// blockedError reports a forum response showing that the host refuses us,
+// e.g. a Cloudflare challenge or a 403, which a mirror may not do.
+type blockedError struct {
+	StatusCode int
+	Status     string
+	Reason     string
+}
+
+func (e *blockedError) Error() string {
+	return fmt.Sprintf("HTTP错误 %d: %s (%s)", e.StatusCode, e.Status, e.Reason)
+}
+
+// isMirrorFailure reports whether err means the forum host is blocked or
+// unreachable (DNS, connect or TLS failure, timeout, Cloudflare challenge),
+// so the request should move to the next mirror.
+func isMirrorFailure(err error) bool {
+	var blocked *blockedError
+	if errors.As(err, &blocked) {
+		return true
+	}
+	var appErr *AppError
+	return errors.As(err, &appErr) && appErr.Type == NetworkError
+}
+
+// fetchForumURL fetches a forum page, failing over to the next mirror while
+// the active one is blocked or unreachable. It returns the mirror that
+// served the page.
+func (f *Fetcher) fetchForumURL(ctx context.Context, targetURL string) (string, string, error) {
+	for {
+		rebased, base := f.mirrors.rebase(targetURL)
+		html, err := f.fetchURL(ctx, rebased)
+		if err == nil || base == "" || !isMirrorFailure(err) || ctx.Err() != nil {
+			return html, base, err
+		}
+		if !f.mirrors.failover(base) {
+			return "", base, err
+		}
+		slog.Warn("Forum host blocked or unreachable, switching to the next mirror",
+			"from", base, "to", f.mirrors.current(), "error", err)
+		targetURL = rebased
+	}
+}
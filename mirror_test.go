@@ -0,0 +1,67 @@
+package south2md
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchFailsOverToMirrors(t *testing.T) {
+	fixture, err := os.ReadFile("tid-2636739.html")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+
+	var blockedHits atomic.Int32
+	blocked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		blockedHits.Add(1)
+		w.Header().Set("Cf-Mitigated", "challenge")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer blocked.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(fixture)
+	}))
+	defer mirror.Close()
+
+	options := &HTTPOptions{
+		Timeout:       5 * time.Second,
+		MaxConcurrent: 1,
+		Mirrors:       []string{unreachable.URL, mirror.URL + "/"},
+	}
+	fetcher := NewFetcher(mirror.Client(), options, blocked.URL)
+	post, err := fetcher.FetchPostWithPagination("2636739", NewPostParser())
+	if err != nil {
+		t.Fatalf("FetchPostWithPagination returned error: %v", err)
+	}
+	if len(post.PageMirrors) != post.TotalPages || post.PageMirrors[0] != (PageMirror{Page: 1, BaseURL: mirror.URL + "/"}) {
+		t.Fatalf("expected every page served by the mirror, got %+v (pages %d)", post.PageMirrors, post.TotalPages)
+	}
+
+	// Later requests go straight to the working mirror.
+	if _, err := fetcher.FetchPost("2636739"); err != nil || blockedHits.Load() != 1 {
+		t.Fatalf("expected no further requests to the blocked host, got %d (err %v)", blockedHits.Load(), err)
+	}
+}
+
+func TestFetchWithoutMirrorsKeepsTheError(t *testing.T) {
+	blocked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer blocked.Close()
+
+	fetcher := NewFetcher(blocked.Client(), &HTTPOptions{Timeout: 5 * time.Second, MaxConcurrent: 1}, blocked.URL)
+	post, err := fetcher.FetchPostWithPagination("2636739", NewPostParser())
+	if err == nil || !strings.Contains(err.Error(), "HTTP错误 403") {
+		t.Fatalf("expected the 403 error, got %v", err)
+	}
+	if post != nil {
+		t.Fatalf("expected no post, got %+v", post)
+	}
+}
@@ -0,0 +1,120 @@
+package south2md
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+// Pagination modes select how the pages of a thread are discovered.
+const (
+	// PaginationTotal reads the page count from the first page and fetches
+	// the remaining pages concurrently.
+	PaginationTotal = "total"
+	// PaginationNext follows the next-page link from page to page, for skins
+	// whose page count can't be parsed.
+	PaginationNext = "next"
+)
+
+// PaginationModes lists the supported pagination modes.
+var PaginationModes = []string{PaginationTotal, PaginationNext}
+
+// IsValidPaginationMode reports whether mode is a supported pagination mode.
+func IsValidPaginationMode(mode string) bool {
+	return slices.Contains(PaginationModes, mode)
+}
+
+// fetchPagesByNextLink walks the thread from first by its next-page links,
+// one page at a time. When a page fails, the walk continues with the
+// numbered URL of the following page as long as computedTotal (the count
+// parsed from the first page) says there are more. It returns the replies of
+// every page after the first, the failed page numbers and the last page
+// reached, and logs a warning when that disagrees with computedTotal. Like
+// the concurrent workers, only the replies and the next link are kept from
+// each page.
+func (f *Fetcher) fetchPagesByNextLink(ctx context.Context, tid string, first *PostParser, computedTotal int) ([][]PostEntry, []int, int, error) {
+	var pages [][]PostEntry
+	var failedPages []int
+	seen := map[string]bool{f.buildPostURL(tid, 1): true}
+
+	page := 1
+	nextURL, nextPage := f.nextPageLink(tid, first, page, computedTotal)
+	for nextURL != "" {
+		if seen[nextURL] {
+			slog.Warn("Next-page link points to a page already fetched, stopping", "tid", tid, "page", page, "url", nextURL)
+			break
+		}
+		seen[nextURL] = true
+		page = nextPage
+
+		var parser *PostParser
+		html, err := f.fetchPageURL(ctx, tid, page, nextURL)
+		if err == nil {
+			parser = NewPostParser()
+			parser.selectors = first.selectors
+			if err = parsePageTraced(ctx, parser, page, html); err != nil {
+				parser = nil
+			}
+		}
+		var replies []PostEntry
+		if err == nil {
+			if replies, err = parser.ExtractReplies(); err == nil && replies == nil {
+				replies = []PostEntry{}
+			}
+		}
+		if err != nil {
+			slog.Error("Failed to fetch post page", "page", page, "error", err)
+			failedPages = append(failedPages, page)
+		} else {
+			f.handleRawPage(tid, page, html)
+			pages = append(pages, replies)
+		}
+		nextURL, nextPage = f.nextPageLink(tid, parser, page, computedTotal)
+	}
+
+	if computedTotal > 0 && page != computedTotal {
+		slog.Warn("Pages found by following next links differ from the page count",
+			"tid", tid, "followed", page, "page_count", computedTotal)
+	}
+	resolved, err := resolvePageFetchResults(pages, failedPages, f.config.StrictPagination)
+	return resolved, failedPages, page, err
+}
+
+// nextPageLink returns the URL and number of the page after page. current is
+// nil when page failed to fetch or parse; the next URL is then built from the page
+// number while page < computedTotal. An empty URL ends the walk.
+func (f *Fetcher) nextPageLink(tid string, current *PostParser, page, computedTotal int) (string, int) {
+	if current == nil {
+		if page < computedTotal {
+			return f.buildPostURL(tid, page+1), page + 1
+		}
+		return "", 0
+	}
+
+	href, ok := current.FindElement(current.selectors.nextPage).Attr("href")
+	if !ok || href == "" {
+		return "", 0
+	}
+	base, err := url.Parse(f.mirrors.current() + "/")
+	if err != nil {
+		return "", 0
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		slog.Warn("Invalid next-page link", "href", href, "error", err)
+		return "", 0
+	}
+
+	next := page + 1
+	if matches := pageLinkPattern.FindStringSubmatch(href); len(matches) > 1 {
+		if n, err := strconv.Atoi(matches[1]); err == nil {
+			next = n
+		}
+	}
+	if next <= page {
+		return "", 0
+	}
+	return base.ResolveReference(ref).String(), next
+}
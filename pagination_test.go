@@ -0,0 +1,73 @@
+package south2md
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFetchFollowsNextPageLinks(t *testing.T) {
+	fixture, err := os.ReadFile("tid-2636739.html")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	// Page 1 only links page 2, so the computed total undercounts the thread.
+	withNext := func(href string) string {
+		if href == "" {
+			return string(fixture)
+		}
+		return strings.Replace(string(fixture), "</body>", `<a href="`+href+`">下一页</a></body>`, 1)
+	}
+	pages := map[string]string{
+		"tid-2636739.html":        withNext("read.php?tid-2636739-page-2.html"),
+		"tid-2636739-page-2.html": withNext("read.php?tid-2636739-page-3.html"),
+		"tid-2636739-page-3.html": withNext(""),
+	}
+	var mu sync.Mutex
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.RawQuery)
+		mu.Unlock()
+		page, ok := pages[r.URL.RawQuery]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(page))
+	}))
+	defer srv.Close()
+
+	options := &HTTPOptions{Timeout: 5 * time.Second, MaxConcurrent: 1, Pagination: PaginationNext}
+	post, err := NewFetcher(srv.Client(), options, srv.URL).FetchPostWithPagination("2636739", NewPostParser())
+	if err != nil {
+		t.Fatalf("FetchPostWithPagination returned error: %v", err)
+	}
+	if post.TotalPages != 3 || len(requested) != 3 {
+		t.Fatalf("expected 3 pages, got TotalPages=%d requests=%v", post.TotalPages, requested)
+	}
+
+	requested = nil
+	options.Pagination = PaginationTotal
+	post, err = NewFetcher(srv.Client(), options, srv.URL).FetchPostWithPagination("2636739", NewPostParser())
+	if err != nil {
+		t.Fatalf("FetchPostWithPagination returned error: %v", err)
+	}
+	if post.TotalPages != 2 {
+		t.Fatalf("expected the page count to stop at 2, got %d", post.TotalPages)
+	}
+}
+
+func TestNextPageLinkContinuesPastFailedPage(t *testing.T) {
+	f := NewFetcher(http.DefaultClient, &HTTPOptions{}, "https://example.com/")
+	if url, page := f.nextPageLink("1", nil, 2, 4); page != 3 || url != "https://example.com/read.php?tid-1-page-3.html" {
+		t.Fatalf("expected page 3 by number, got %q %d", url, page)
+	}
+	if url, _ := f.nextPageLink("1", nil, 4, 4); url != "" {
+		t.Fatalf("expected the walk to end at the page count, got %q", url)
+	}
+}
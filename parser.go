@@ -5,11 +5,12 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net/url"
 	"os"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/andybalholm/cascadia"
@@ -24,8 +25,11 @@ var (
 	lastLoginPattern    = regexp.MustCompile(`最后登录:\s*([0-9\-]+)`)
 	uidURLPattern       = regexp.MustCompile(`uid[=-](\d+)`)
 	digitsPattern       = regexp.MustCompile(`(\d+)`)
+	windowOpenPattern   = regexp.MustCompile(`window\.open\('([^']+)'`)
+	attachSizePattern   = regexp.MustCompile(`\(\s*([\d.]+)\s*([KMG]?)B?\s*\)`)
 
-	selectorCache sync.Map
+	// selectorCache keeps compiled selectors across pages and threads.
+	selectorCache = newLRUCache[string, cascadia.Selector](256)
 )
 
 type DOMSelection struct {
@@ -38,6 +42,11 @@ type htmlSelectors struct {
 	postTable   string
 	postTime    string
 	postContent string
+	attachment  string
+	floorLabel  string
+	logoutLink  string
+	nextPage    string
+	threadStats string
 }
 
 var defaultHTMLSelectors = htmlSelectors{
@@ -46,6 +55,11 @@ var defaultHTMLSelectors = htmlSelectors{
 	postTable:   "table.js-post",
 	postTime:    ".tiptop .gray",
 	postContent: "div[id^='read_']",
+	attachment:  "span[id^='att_']",
+	floorLabel:  "a.s3[onclick^='copyUrl']",
+	logoutLink:  "a[href*='action-quit']",
+	nextPage:    "a:containsOwn('下一页'), a.pages_next",
+	threadStats: ".h2 .fl.w, .readTop .fl",
 }
 
 func (s *DOMSelection) Length() int {
@@ -130,15 +144,15 @@ func (s *DOMSelection) Html() (string, error) {
 }
 
 func compileSelector(selector string) (cascadia.Selector, error) {
-	if cached, ok := selectorCache.Load(selector); ok {
-		return cached.(cascadia.Selector), nil
+	if cached, ok := selectorCache.Get(selector); ok {
+		return cached, nil
 	}
 
 	compiled, err := cascadia.Compile(selector)
 	if err != nil {
 		return nil, err
 	}
-	selectorCache.Store(selector, compiled)
+	selectorCache.Add(selector, compiled)
 	return compiled, nil
 }
 
@@ -146,6 +160,7 @@ func compileSelector(selector string) (cascadia.Selector, error) {
 type PostParser struct {
 	doc       *html.Node
 	baseURL   string
+	page      int
 	selectors htmlSelectors
 }
 
@@ -156,6 +171,12 @@ func NewPostParser() *PostParser {
 	}
 }
 
+// SetPage records which page of the thread this parser holds, so extracted
+// floors carry it as PostEntry.SourcePage.
+func (p *PostParser) SetPage(page int) {
+	p.page = page
+}
+
 // LoadFromString loads HTML from string.
 func (p *PostParser) LoadFromString(htmlContent string) error {
 	return p.LoadFromReader(strings.NewReader(htmlContent))
@@ -249,10 +270,11 @@ func (p *PostParser) ExtractPost() (*Post, error) {
 	}
 
 	post.TID = p.extractTID()
+	p.extractThreadMeta(post)
 
 	mainPost, err := p.ExtractMainPost()
 	if err != nil {
-		return nil, fmt.Errorf("提取主楼失败: %v", err)
+		return nil, fmt.Errorf("提取主楼失败: %w", err)
 	}
 	post.MainPost = *mainPost
 	post.CreatedAt = mainPost.PostTime
@@ -261,8 +283,9 @@ func (p *PostParser) ExtractPost() (*Post, error) {
 	if err != nil {
 		return nil, fmt.Errorf("提取回复失败: %v", err)
 	}
-	post.Replies = replies
+	post.Replies = fillDeletedFloors(replies)
 	post.TotalFloors = 1 + len(post.Replies)
+	post.MissingFloors = findFloorGaps(post.Replies)
 
 	return post, nil
 }
@@ -273,22 +296,47 @@ func (p *PostParser) ExtractPostFromMultiplePages(parsers []*PostParser) (*Post,
 		return nil, fmt.Errorf("没有提供页面解析器")
 	}
 
-	post, err := parsers[0].ExtractPost()
-	if err != nil {
-		return nil, fmt.Errorf("提取第一页数据失败: %v", err)
-	}
-
+	pages := make([][]PostEntry, 0, len(parsers)-1)
+	var missingPages []int
 	for i := 1; i < len(parsers); i++ {
 		replies, err := parsers[i].ExtractReplies()
 		if err != nil {
-			slog.Error("Failed to extract replies from page", "page", i+1, "error", err)
+			page := parsers[i].page
+			if page <= 0 {
+				page = i + 1
+			}
+			slog.Error("Failed to extract replies from page", "page", page, "error", err)
+			missingPages = append(missingPages, page)
 			continue
 		}
+		pages = append(pages, replies)
+	}
 
+	post, err := parsers[0].extractPostWithPages(pages)
+	if err != nil {
+		return nil, err
+	}
+	post.MissingPages = append(post.MissingPages, missingPages...)
+	return post, nil
+}
+
+// extractPostWithPages extracts the post from the loaded first page and
+// appends the replies already extracted from later pages, in page order.
+func (p *PostParser) extractPostWithPages(pages [][]PostEntry) (*Post, error) {
+	post, err := p.ExtractPost()
+	if err != nil {
+		return nil, fmt.Errorf("提取第一页数据失败: %w", err)
+	}
+	for _, replies := range pages {
 		post.Replies = append(post.Replies, replies...)
 	}
+	post.Replies = fillDeletedFloors(post.Replies)
 
 	post.TotalFloors = 1 + len(post.Replies)
+	post.MissingFloors = findFloorGaps(post.Replies)
+	if len(post.MissingFloors) > 0 {
+		slog.Warn("Thread has gaps in floor numbering", "missing_floors", len(post.MissingFloors), "first", post.MissingFloors[0])
+	}
 	return post, nil
 }
 
@@ -314,13 +362,20 @@ func (p *PostParser) ExtractReplies() ([]PostEntry, error) {
 		return nil, p.classifyMissingPostTableError()
 	}
 
+	// The first table is the main post on page 1; later pages may start
+	// directly with a reply, which its floor label tells apart.
+	start := 1
+	if label := p.extractFloorLabel(postTables.Eq(0)); label != "" && label != "GF" {
+		start = 0
+	}
+
 	tableCount := postTables.Length()
-	if tableCount <= 1 {
+	if tableCount <= start {
 		return []PostEntry{}, nil
 	}
 
-	replies := make([]PostEntry, 0, tableCount-1)
-	for i := 1; i < tableCount; i++ {
+	replies := make([]PostEntry, 0, tableCount-start)
+	for i := start; i < tableCount; i++ {
 		floorNumber := p.generateFloorNumber(i)
 		entry, err := p.extractPostEntry(postTables.Eq(i), floorNumber)
 		if err != nil {
@@ -333,6 +388,22 @@ func (p *PostParser) ExtractReplies() ([]PostEntry, error) {
 	return replies, nil
 }
 
+// CheckAccess reports whether the loaded page shows the thread: it returns
+// the auth, maintenance or validation error extraction would fail with when
+// the page has no post table, and nil otherwise.
+func (p *PostParser) CheckAccess() error {
+	if p.FindElements(p.selectors.postTable).Length() == 0 {
+		return p.classifyMissingPostTableError()
+	}
+	return nil
+}
+
+// LoggedIn reports whether the loaded page was rendered for a logged-in
+// user, i.e. it carries the logout link.
+func (p *PostParser) LoggedIn() bool {
+	return p.FindElements(p.selectors.logoutLink).Length() > 0
+}
+
 func (p *PostParser) classifyMissingPostTableError() error {
 	pageTitle := strings.TrimSpace(p.FindElement("title").Text())
 	bodyText := strings.ToLower(strings.TrimSpace(p.FindElement("body").Text()))
@@ -347,6 +418,10 @@ func (p *PostParser) classifyMissingPostTableError() error {
 		return NewAuthError(fmt.Sprintf("疑似触发 Cloudflare 验证或 cf_clearance 已失效，请刷新 Cookie 后重试 (title=%q)", pageTitle), nil)
 	}
 
+	if isMaintenancePage(titleText, bodyText) {
+		return NewMaintenanceError(fmt.Sprintf("论坛正在维护，请稍后重试 (title=%q)", pageTitle))
+	}
+
 	if strings.Contains(bodyText, "登录") ||
 		strings.Contains(bodyText, "log in") ||
 		strings.Contains(bodyText, "please login") ||
@@ -357,8 +432,33 @@ func (p *PostParser) classifyMissingPostTableError() error {
 	return NewValidationError(fmt.Sprintf("未找到帖子表格 (选择器: %s)", p.selectors.postTable))
 }
 
-// extractPostEntry extracts a single post entry.
+// maintenanceMarkers are phrases found on the forum's maintenance/closed page.
+var maintenanceMarkers = []string{
+	"维护中",
+	"系统维护",
+	"论坛维护",
+	"站点维护",
+	"暂时关闭",
+	"升级维护",
+	"under maintenance",
+	"maintenance mode",
+}
+
+func isMaintenancePage(titleText, bodyText string) bool {
+	for _, marker := range maintenanceMarkers {
+		if strings.Contains(titleText, marker) || strings.Contains(bodyText, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractPostEntry extracts a single post entry. floor is used only when the
+// page shows no floor label of its own.
 func (p *PostParser) extractPostEntry(table *DOMSelection, floor string) (*PostEntry, error) {
+	if label := p.extractFloorLabel(table); label != "" {
+		floor = label
+	}
 	entry := &PostEntry{
 		Floor: floor,
 	}
@@ -379,9 +479,14 @@ func (p *PostParser) extractPostEntry(table *DOMSelection, floor string) (*PostE
 		if htmlContent, err := contentElement.Html(); err == nil {
 			entry.HTMLContent = p.cleanHTMLContent(htmlContent)
 		}
+		entry.Attachments = p.extractAttachments(contentElement.First())
+		entry.Status = detectFloorStatus(contentElement.First().Text())
+	} else {
+		entry.Status = FloorStatusDeleted
 	}
 
 	entry.PostID = p.extractPostID(table)
+	entry.SourcePage = p.page
 	return entry, nil
 }
 
@@ -499,6 +604,97 @@ func (p *PostParser) parsePostTime(timeText string) time.Time {
 	return time.Now()
 }
 
+// extractAttachments collects the attachments rendered as span#att_<id>
+// inside a floor's content.
+func (p *PostParser) extractAttachments(content *DOMSelection) []Attachment {
+	spans := content.Find(p.selectors.attachment)
+	if spans.Length() == 0 {
+		return nil
+	}
+
+	attachments := make([]Attachment, 0, spans.Length())
+	for i := 0; i < spans.Length(); i++ {
+		span := spans.Eq(i)
+		id, _ := span.Attr("id")
+		attachment := Attachment{ID: strings.TrimPrefix(id, "att_")}
+
+		if link := span.Find("a[href]").First(); link.Length() > 0 {
+			href, _ := link.Attr("href")
+			attachment.URL = p.resolveURL(href)
+			attachment.Filename = strings.TrimSpace(link.Text())
+		} else if img := span.Find("img").First(); img.Length() > 0 {
+			src, _ := img.Attr("src")
+			if onclick, ok := img.Attr("onclick"); ok {
+				if m := windowOpenPattern.FindStringSubmatch(onclick); len(m) > 1 {
+					src = m[1]
+				}
+			}
+			attachment.URL = p.resolveURL(src)
+		}
+		if attachment.URL == "" {
+			continue
+		}
+		if attachment.Filename == "" {
+			attachment.Filename = attachmentFilename(attachment.URL)
+		}
+		if m := attachSizePattern.FindStringSubmatch(span.Text()); len(m) > 2 {
+			attachment.Size = parseAttachmentSize(m[1], m[2])
+		}
+		attachments = append(attachments, attachment)
+	}
+	if len(attachments) == 0 {
+		return nil
+	}
+	return attachments
+}
+
+// resolveURL makes protocol-relative and relative links absolute.
+func (p *PostParser) resolveURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	if strings.HasPrefix(raw, "//") {
+		return "https:" + raw
+	}
+	ref, err := url.Parse(raw)
+	if err != nil || ref.IsAbs() {
+		return raw
+	}
+	base, err := url.Parse(p.GetBaseURL())
+	if err != nil || !base.IsAbs() {
+		return raw
+	}
+	return base.ResolveReference(ref).String()
+}
+
+func attachmentFilename(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	if name := path.Base(u.Path); name != "." && name != "/" {
+		return name
+	}
+	return rawURL
+}
+
+func parseAttachmentSize(value, unit string) int64 {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	switch unit {
+	case "K":
+		n *= 1 << 10
+	case "M":
+		n *= 1 << 20
+	case "G":
+		n *= 1 << 30
+	}
+	return int64(n)
+}
+
 func (p *PostParser) extractPostID(element *DOMSelection) string {
 	tableCell := element.Find("th[id^=\"td_\"]")
 	if tableCell.Length() > 0 {
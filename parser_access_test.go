@@ -1,6 +1,16 @@
 package south2md
 
-import "testing"
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
 
 func TestExtractMainPostReturnsAuthErrorForCloudflarePage(t *testing.T) {
 	parser := NewPostParser()
@@ -53,3 +63,166 @@ func TestExtractMainPostReturnsValidationErrorForGenericPage(t *testing.T) {
 		t.Fatalf("expected ValidationError, got %s", appErr.Type)
 	}
 }
+
+func TestExtractMainPostReturnsMaintenanceErrorForMaintenancePage(t *testing.T) {
+	parser := NewPostParser()
+
+	html := `<!doctype html><html><head><title>South Plus</title></head><body>论坛维护中，请稍后访问。请先登录</body></html>`
+	if err := parser.LoadFromString(html); err != nil {
+		t.Fatalf("load html failed: %v", err)
+	}
+
+	_, err := parser.ExtractMainPost()
+	if !IsMaintenanceError(err) {
+		t.Fatalf("expected MaintenanceError, got %v", err)
+	}
+}
+
+func TestExtractRepliesRecordsSourcePage(t *testing.T) {
+	parser := NewPostParser()
+	parser.SetPage(3)
+	if err := parser.LoadFromFile("tid-2636739.html"); err != nil {
+		t.Fatalf("LoadFromFile returned error: %v", err)
+	}
+
+	replies, err := parser.ExtractReplies()
+	if err != nil {
+		t.Fatalf("ExtractReplies returned error: %v", err)
+	}
+	if len(replies) == 0 {
+		t.Fatal("expected replies in fixture")
+	}
+	for _, reply := range replies {
+		if reply.SourcePage != 3 {
+			t.Fatalf("expected source page 3, got %d for %s", reply.SourcePage, reply.Floor)
+		}
+	}
+}
+
+func TestExtractPostFromMultiplePagesRecordsMissingPages(t *testing.T) {
+	first := NewPostParser()
+	first.SetPage(1)
+	if err := first.LoadFromFile("tid-2636739.html"); err != nil {
+		t.Fatalf("LoadFromFile returned error: %v", err)
+	}
+	broken := NewPostParser()
+	broken.SetPage(2)
+	if err := broken.LoadFromString("<html><head><title>empty</title></head><body></body></html>"); err != nil {
+		t.Fatalf("LoadFromString returned error: %v", err)
+	}
+
+	post, err := first.ExtractPostFromMultiplePages([]*PostParser{first, broken})
+	if err != nil {
+		t.Fatalf("ExtractPostFromMultiplePages returned error: %v", err)
+	}
+	if len(post.MissingPages) != 1 || post.MissingPages[0] != 2 {
+		t.Fatalf("expected page 2 recorded as missing, got %v", post.MissingPages)
+	}
+	if post.MainPost.SourcePage != 1 {
+		t.Fatalf("expected main post from page 1, got %d", post.MainPost.SourcePage)
+	}
+}
+
+func TestExtractRepliesUsesForumFloorLabels(t *testing.T) {
+	floor := func(pid, label string) string {
+		return `<table class="js-post"><tr><th id="td_` + pid + `"><a class="s3" onclick="copyUrl('` + pid + `')">` + label + `</a>` +
+			`<div id="read_` + pid + `">reply ` + label + `</div></th></tr></table>`
+	}
+	parser := NewPostParser()
+	if err := parser.LoadFromString("<html><body>" + floor("301", "B30F") + floor("302", "B31F") + floor("304", "B33F") + "</body></html>"); err != nil {
+		t.Fatalf("LoadFromString returned error: %v", err)
+	}
+
+	replies, err := parser.ExtractReplies()
+	if err != nil {
+		t.Fatalf("ExtractReplies returned error: %v", err)
+	}
+	var labels []string
+	for _, reply := range replies {
+		labels = append(labels, reply.Floor)
+	}
+	if strings.Join(labels, ",") != "B30F,B31F,B33F" {
+		t.Fatalf("expected forum labels including the first table, got %v", labels)
+	}
+
+	gaps := findFloorGaps(replies)
+	if len(gaps) != 30 || gaps[0] != 1 || gaps[28] != 29 || gaps[29] != 32 {
+		t.Fatalf("unexpected floor gaps: %v", gaps)
+	}
+}
+
+func TestExtractPostKeepsDeletedAndBlockedFloors(t *testing.T) {
+	floor := func(pid, label, content string) string {
+		return `<table class="js-post"><tr><th id="td_` + pid + `"><a class="s3" onclick="copyUrl('` + pid + `')">` + label + `</a>` +
+			`<div id="read_` + pid + `">` + content + `</div></th></tr></table>`
+	}
+	parser := NewPostParser()
+	html := "<html><body>" + floor("tpc", "GF", "main") + floor("301", "B1F", "用户被禁言,该主题自动屏蔽!") + floor("303", "B3F", "hello") + "</body></html>"
+	if err := parser.LoadFromString(html); err != nil {
+		t.Fatalf("LoadFromString returned error: %v", err)
+	}
+
+	post, err := parser.ExtractPost()
+	if err != nil {
+		t.Fatalf("ExtractPost returned error: %v", err)
+	}
+	if len(post.Replies) != 3 || post.TotalFloors != 4 {
+		t.Fatalf("expected placeholder for B2F, got %+v", post.Replies)
+	}
+	if post.Replies[0].Status != FloorStatusBlocked {
+		t.Fatalf("expected B1F blocked, got %q", post.Replies[0].Status)
+	}
+	if post.Replies[1].Floor != "B2F" || post.Replies[1].Status != FloorStatusDeleted {
+		t.Fatalf("expected deleted B2F placeholder, got %+v", post.Replies[1])
+	}
+	if post.Replies[2].Status != "" || len(post.MissingFloors) != 0 {
+		t.Fatalf("expected normal B3F and no gaps, got %+v, gaps %v", post.Replies[2], post.MissingFloors)
+	}
+
+	g := NewMarkdownGenerator(&MarkdownOptions{}, nil)
+	g.SetDownloadEnabled(false)
+	md, err := g.GenerateMarkdown(post)
+	if err != nil {
+		t.Fatalf("GenerateMarkdown returned error: %v", err)
+	}
+	if !strings.Contains(md, "*该楼层已被屏蔽*") || !strings.Contains(md, "*该楼层已被删除*") {
+		t.Fatalf("expected placeholder notes in markdown, got:\n%s", md)
+	}
+}
+
+func TestFetchAbortsOnLoginWallWhenLoginCookieIsLoaded(t *testing.T) {
+	fixture, err := os.ReadFile("tid-2636739.html")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	guestPage := strings.ReplaceAll(string(fixture), "action-quit", "action-login")
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(guestPage))
+	}))
+	defer srv.Close()
+
+	cookieFile := filepath.Join(t.TempDir(), "cookies.txt")
+	cm := NewCookieManager()
+	cm.AddCookie(&CookieEntry{Name: loginCookieName, Value: "expired", Domain: strings.TrimPrefix(srv.URL, "http://"), Path: "/"})
+	if err := cm.SaveToFile(cookieFile); err != nil {
+		t.Fatalf("SaveToFile returned error: %v", err)
+	}
+
+	options := &HTTPOptions{Timeout: 5 * time.Second, MaxConcurrent: 1, CookieFile: cookieFile, EnableCookie: true}
+	_, err = NewFetcher(srv.Client(), options, srv.URL).FetchPostWithPagination("2636739", NewPostParser())
+	var appErr *AppError
+	if !errors.As(err, &appErr) || appErr.Type != AuthError {
+		t.Fatalf("expected AuthError, got %v", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("expected to stop after the first page, got %d requests", n)
+	}
+
+	options.AllowGuest = true
+	post, err := NewFetcher(srv.Client(), options, srv.URL).FetchPostWithPagination("2636739", NewPostParser())
+	if err != nil || post.MainPost.HTMLContent == "" {
+		t.Fatalf("expected guest-visible content with AllowGuest, got %v", err)
+	}
+}
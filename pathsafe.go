@@ -0,0 +1,96 @@
+package south2md
+
+import (
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxPathComponentBytes caps one sanitized path component. Most filesystems
+// allow 255 bytes; the headroom covers suffixes added while downloading such
+// as ".part" and ".digest.json".
+const maxPathComponentBytes = 200
+
+// maxExtBytes is the longest suffix kept as an extension when truncating.
+const maxExtBytes = 16
+
+// windowsReservedNames are device names Windows refuses as file names, with
+// or without an extension.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizePathComponent turns name, typically a thread title, gofile name or
+// attachment name, into a single path component that is valid on Windows/NTFS
+// and common cloud sync clients:
+//   - path separators, control characters and `<>:"|?*` become "_"
+//   - surrounding spaces and trailing dots are removed
+//   - reserved device names such as CON or NUL.txt get a "_" prefix
+//   - names longer than maxPathComponentBytes are cut, keeping the extension
+//
+// Empty results and the special names "." and ".." become "_". Names that are
+// already safe are returned unchanged.
+func SanitizePathComponent(name string) string {
+	var b strings.Builder
+	b.Grow(len(name))
+	for _, r := range name {
+		switch {
+		case r < 0x20 || r == 0x7f || r == utf8.RuneError:
+			b.WriteByte('_')
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			b.WriteByte('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	name = truncatePathComponent(b.String())
+	name = strings.TrimRight(strings.TrimSpace(name), ". ")
+	if name == "" {
+		return "_"
+	}
+
+	base := name
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	if windowsReservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		name = "_" + name
+	}
+	return name
+}
+
+// SanitizeRelPath sanitizes every component of the slash separated relative
+// path p and drops empty and "." components, so the result never escapes the
+// directory it is joined to.
+func SanitizeRelPath(p string) string {
+	parts := strings.Split(strings.ReplaceAll(p, `\`, "/"), "/")
+	kept := parts[:0]
+	for _, part := range parts {
+		if strings.TrimSpace(part) == "" || part == "." {
+			continue
+		}
+		kept = append(kept, SanitizePathComponent(part))
+	}
+	return strings.Join(kept, "/")
+}
+
+// truncatePathComponent cuts name to maxPathComponentBytes on a rune
+// boundary, keeping a short extension.
+func truncatePathComponent(name string) string {
+	if len(name) <= maxPathComponentBytes {
+		return name
+	}
+	ext := path.Ext(name)
+	if len(ext) > maxExtBytes {
+		ext = ""
+	}
+	stem := name[:maxPathComponentBytes-len(ext)]
+	for !utf8.ValidString(stem) {
+		stem = stem[:len(stem)-1]
+	}
+	return stem + ext
+}
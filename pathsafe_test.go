@@ -0,0 +1,77 @@
+package south2md
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizePathComponent(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"safe name unchanged", "2636739", "2636739"},
+		{"unicode unchanged", "【合集】春季 新番.zip", "【合集】春季 新番.zip"},
+		{"invalid characters", `a:b*c?d"e<f>g|h`, "a_b_c_d_e_f_g_h"},
+		{"separators", `dir/sub\file.txt`, "dir_sub_file.txt"},
+		{"control characters", "a\tb\x00c", "a_b_c"},
+		{"trailing dots and spaces", " title... ", "title"},
+		{"dot names", "..", "_"},
+		{"empty", "", "_"},
+		{"reserved name", "CON", "_CON"},
+		{"reserved name with extension", "nul.txt", "_nul.txt"},
+		{"reserved name lowercase com port", "com1.tar.gz", "_com1.tar.gz"},
+		{"reserved prefix only", "CONSOLE.txt", "CONSOLE.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizePathComponent(tt.in); got != tt.want {
+				t.Fatalf("SanitizePathComponent(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			if again := SanitizePathComponent(tt.want); again != tt.want {
+				t.Fatalf("SanitizePathComponent is not idempotent: %q -> %q", tt.want, again)
+			}
+		})
+	}
+}
+
+func TestSanitizePathComponentLengthLimit(t *testing.T) {
+	long := strings.Repeat("测", 150) + ".mp4"
+	got := SanitizePathComponent(long)
+	if len(got) > maxPathComponentBytes || !utf8.ValidString(got) || !strings.HasSuffix(got, ".mp4") {
+		t.Fatalf("unexpected truncation: %d bytes, valid=%v, %q", len(got), utf8.ValidString(got), got)
+	}
+
+	noExt := strings.Repeat("a", 300) + "." + strings.Repeat("b", 40)
+	if got := SanitizePathComponent(noExt); len(got) != maxPathComponentBytes {
+		t.Fatalf("expected a long suffix to be cut like the rest, got %d bytes", len(got))
+	}
+}
+
+func TestSanitizeRelPath(t *testing.T) {
+	if got := SanitizeRelPath(`/archive/./../a:b//`); got != "archive/_/a_b" {
+		t.Fatalf("SanitizeRelPath = %q", got)
+	}
+}
+
+func TestResolveNamingCollisionSanitizesNames(t *testing.T) {
+	parent := filepath.Join("root", "abc")
+	counts := map[string]int{}
+	first := resolveNamingCollision(counts, parent, "../../etc/passwd", false)
+	if filepath.Dir(first) != parent {
+		t.Fatalf("expected the file to stay under %s, got %s", parent, first)
+	}
+	second := resolveNamingCollision(counts, parent, "..\\..\\etc\\passwd", false)
+	if filepath.Dir(second) != parent || second == first {
+		t.Fatalf("expected a renamed collision under %s, got %s", parent, second)
+	}
+}
+
+func TestImageFileExtIgnoresQuery(t *testing.T) {
+	if got := imageFileExt("https://img.example.com/a/b.jpg?size=large#x"); got != ".jpg" {
+		t.Fatalf("imageFileExt = %q", got)
+	}
+}
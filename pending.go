@@ -0,0 +1,191 @@
+package south2md
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PendingFileName is the retry queue file stored in each thread directory.
+const PendingFileName = "pending.json"
+
+// Kinds of downloads that can end up in the retry queue.
+const (
+	PendingKindImage  = "image"
+	PendingKindGofile = "gofile"
+)
+
+// PendingItem is one failed download waiting to be retried.
+type PendingItem struct {
+	Kind        string    `json:"kind"`
+	URL         string    `json:"url"`
+	Reason      string    `json:"reason"`
+	Attempts    int       `json:"attempts"` // Runs that tried and failed to fetch it
+	LastAttempt time.Time `json:"last_attempt"`
+}
+
+// PendingQueue collects failed downloads of one thread so a later
+// `south2md retry` can re-attempt only those. It is safe for concurrent use;
+// a nil *PendingQueue ignores additions.
+type PendingQueue struct {
+	mu    sync.Mutex
+	items map[string]*PendingItem // kind + "\x00" + url
+}
+
+type pendingFile struct {
+	TID       string        `json:"tid"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	Items     []PendingItem `json:"items"`
+}
+
+// NewPendingQueue creates an empty retry queue.
+func NewPendingQueue() *PendingQueue {
+	return &PendingQueue{items: make(map[string]*PendingItem)}
+}
+
+func pendingKey(kind, rawURL string) string {
+	return kind + "\x00" + rawURL
+}
+
+// Add records a failed download of rawURL. A later failure of the same URL
+// replaces the reason.
+func (q *PendingQueue) Add(kind, rawURL string, err error) {
+	if q == nil || rawURL == "" {
+		return
+	}
+	reason := "unknown error"
+	if err != nil {
+		reason = err.Error()
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	key := pendingKey(kind, rawURL)
+	if item, ok := q.items[key]; ok {
+		item.Reason = reason
+		return
+	}
+	q.items[key] = &PendingItem{Kind: kind, URL: rawURL, Reason: reason, Attempts: 1, LastAttempt: time.Now()}
+}
+
+// Len returns the number of queued downloads.
+func (q *PendingQueue) Len() int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Items returns the queued downloads sorted by kind and URL.
+func (q *PendingQueue) Items() []PendingItem {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := make([]PendingItem, 0, len(q.items))
+	for _, item := range q.items {
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Kind != items[j].Kind {
+			return items[i].Kind < items[j].Kind
+		}
+		return items[i].URL < items[j].URL
+	})
+	return items
+}
+
+// urls returns the set of queued URLs of kind.
+func (q *PendingQueue) urls(kind string) map[string]bool {
+	set := make(map[string]bool)
+	for _, item := range q.Items() {
+		if item.Kind == kind {
+			set[item.URL] = true
+		}
+	}
+	return set
+}
+
+// carryAttempts adds the attempt counts of previous to items still failing.
+func (q *PendingQueue) carryAttempts(previous *PendingQueue) {
+	if q == nil || previous == nil {
+		return
+	}
+	for _, old := range previous.Items() {
+		q.mu.Lock()
+		if item, ok := q.items[pendingKey(old.Kind, old.URL)]; ok {
+			item.Attempts += old.Attempts
+		}
+		q.mu.Unlock()
+	}
+}
+
+// keep queues item unchanged unless its URL is already queued.
+func (q *PendingQueue) keep(item PendingItem) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	key := pendingKey(item.Kind, item.URL)
+	if _, ok := q.items[key]; !ok {
+		q.items[key] = &item
+	}
+}
+
+// LoadPendingQueue reads postDir/pending.json. A missing file yields an
+// empty queue.
+func LoadPendingQueue(postDir string) (*PendingQueue, error) {
+	q := NewPendingQueue()
+	data, err := os.ReadFile(filepath.Join(postDir, PendingFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", PendingFileName, err)
+	}
+	var file pendingFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", PendingFileName, err)
+	}
+	for _, item := range file.Items {
+		item := item
+		q.items[pendingKey(item.Kind, item.URL)] = &item
+	}
+	return q, nil
+}
+
+// Save writes the queue to postDir/pending.json, or removes the file when
+// the queue is empty.
+func (q *PendingQueue) Save(tid, postDir string) error {
+	path := filepath.Join(postDir, PendingFileName)
+	if q.Len() == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", PendingFileName, err)
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(pendingFile{TID: tid, UpdatedAt: time.Now(), Items: q.Items()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", PendingFileName, err)
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+// LoadPending returns the retry queue of a stored thread.
+func (ps *PostStore) LoadPending(tid string) (*PendingQueue, error) {
+	if ps == nil {
+		return nil, fmt.Errorf("post store is nil")
+	}
+	if tid == "" {
+		return nil, fmt.Errorf("tid is empty")
+	}
+	return LoadPendingQueue(ps.PostDir(tid))
+}
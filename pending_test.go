@@ -0,0 +1,117 @@
+package south2md
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// flakyImageDoer fails requests for URLs in failing and serves the rest.
+type flakyImageDoer struct {
+	mu      sync.Mutex
+	failing map[string]bool
+	urls    []string
+}
+
+func (d *flakyImageDoer) Do(req *http.Request) (*http.Response, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.urls = append(d.urls, req.URL.String())
+	if d.failing[req.URL.String()] {
+		return nil, errors.New("connection reset")
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Body:       io.NopCloser(strings.NewReader("bytes of " + req.URL.Path)),
+		Request:    req,
+	}, nil
+}
+
+func TestPendingQueueSaveLoadAndRemove(t *testing.T) {
+	dir := t.TempDir()
+	q := NewPendingQueue()
+	q.Add(PendingKindImage, "https://img.example.com/b.jpg", errors.New("timeout"))
+	q.Add(PendingKindGofile, "https://gofile.io/d/abc", errors.New("status 500"))
+	q.Add(PendingKindImage, "https://img.example.com/b.jpg", errors.New("reset"))
+	if err := q.Save("100", dir); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	loaded, err := LoadPendingQueue(dir)
+	if err != nil {
+		t.Fatalf("LoadPendingQueue returned error: %v", err)
+	}
+	items := loaded.Items()
+	if len(items) != 2 || items[0].Kind != PendingKindGofile || items[1].Reason != "reset" || items[1].Attempts != 1 {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+
+	if err := NewPendingQueue().Save("100", dir); err != nil {
+		t.Fatalf("Save of empty queue returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, PendingFileName)); !os.IsNotExist(err) {
+		t.Fatalf("expected empty queue to remove %s, stat: %v", PendingFileName, err)
+	}
+}
+
+func TestStorePostQueuesFailedDownloadsAndRetryPending(t *testing.T) {
+	root := t.TempDir()
+	failing := "https://img.example.com/b.jpg"
+	doer := &flakyImageDoer{failing: map[string]bool{failing: true}}
+	g := NewMarkdownGenerator(&MarkdownOptions{IncludeImages: true}, nil)
+	g.SetHTTPDoer(doer)
+
+	post := &Post{
+		TID: "100",
+		MainPost: PostEntry{
+			Floor:       "GF",
+			HTMLContent: `<p><img src="https://img.example.com/a.jpg"><img src="https://img.example.com/b.jpg"></p>`,
+		},
+	}
+	if err := g.StorePost(post, root); err != nil {
+		t.Fatalf("StorePost should tolerate failed downloads, got %v", err)
+	}
+
+	pending, err := NewPostStore(root).LoadPending("100")
+	if err != nil {
+		t.Fatalf("LoadPending returned error: %v", err)
+	}
+	items := pending.Items()
+	if len(items) != 1 || items[0].URL != failing || !strings.Contains(items[0].Reason, "connection reset") {
+		t.Fatalf("unexpected pending items: %+v", items)
+	}
+
+	// A failing retry only requests the queued URL and counts the attempt.
+	doer.urls = nil
+	remaining, err := g.RetryPending(t.Context(), post, root)
+	if err != nil {
+		t.Fatalf("RetryPending returned error: %v", err)
+	}
+	if len(doer.urls) != 1 || doer.urls[0] != failing {
+		t.Fatalf("expected only the failed URL to be retried, got %v", doer.urls)
+	}
+	if items := remaining.Items(); len(items) != 1 || items[0].Attempts != 2 {
+		t.Fatalf("unexpected remaining items: %+v", items)
+	}
+
+	delete(doer.failing, failing)
+	remaining, err = g.RetryPending(t.Context(), post, root)
+	if err != nil {
+		t.Fatalf("RetryPending returned error: %v", err)
+	}
+	if remaining.Len() != 0 {
+		t.Fatalf("expected empty queue after successful retry, got %+v", remaining.Items())
+	}
+	if _, err := os.Stat(filepath.Join(root, "100", PendingFileName)); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed, stat: %v", PendingFileName, err)
+	}
+	if len(post.Images) != 2 {
+		t.Fatalf("expected both images recorded, got %+v", post.Images)
+	}
+}
@@ -0,0 +1,210 @@
+package south2md
+
+import (
+	"context"
+	"fmt"
+)
+
+// Built-in stage names, usable as anchors for Pipeline.InsertBefore/InsertAfter.
+const (
+	StageFetch   = "fetch"
+	StageParse   = "parse"
+	StageExtract = "extract"
+	StageStore   = "store"
+	StageExport  = "export"
+)
+
+// PipelineState is the data passed from stage to stage.
+type PipelineState struct {
+	TID   string
+	Pages []RawPage // raw pages to extract from when Post is not set yet
+	Post  *Post
+	// Output is what the last producing stage wrote (e.g. an export dir).
+	Output string
+}
+
+// Stage is one step of a Pipeline. Stages read and update state in place.
+type Stage interface {
+	Name() string
+	Run(ctx context.Context, state *PipelineState) error
+}
+
+type stageFunc struct {
+	name string
+	fn   func(ctx context.Context, state *PipelineState) error
+}
+
+func (s stageFunc) Name() string { return s.name }
+
+func (s stageFunc) Run(ctx context.Context, state *PipelineState) error { return s.fn(ctx, state) }
+
+// NewStage wraps fn as a Stage named name.
+func NewStage(name string, fn func(ctx context.Context, state *PipelineState) error) Stage {
+	return stageFunc{name: name, fn: fn}
+}
+
+// StageError reports which stage failed. Its message is the stage's own.
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string { return e.Err.Error() }
+
+func (e *StageError) Unwrap() error { return e.Err }
+
+// Pipeline runs stages in order: typically fetch → extract → store (which
+// downloads assets while rendering) → export.
+type Pipeline struct {
+	stages []Stage
+}
+
+// NewPipeline creates a pipeline running stages in order.
+func NewPipeline(stages ...Stage) *Pipeline {
+	return &Pipeline{stages: append([]Stage(nil), stages...)}
+}
+
+// Stages returns the stage names in run order.
+func (p *Pipeline) Stages() []string {
+	names := make([]string, 0, len(p.stages))
+	for _, stage := range p.stages {
+		names = append(names, stage.Name())
+	}
+	return names
+}
+
+// Append adds stage at the end.
+func (p *Pipeline) Append(stage Stage) {
+	p.stages = append(p.stages, stage)
+}
+
+// InsertBefore inserts stage before the first stage named anchor.
+func (p *Pipeline) InsertBefore(anchor string, stage Stage) error {
+	return p.insert(anchor, 0, stage)
+}
+
+// InsertAfter inserts stage after the first stage named anchor.
+func (p *Pipeline) InsertAfter(anchor string, stage Stage) error {
+	return p.insert(anchor, 1, stage)
+}
+
+func (p *Pipeline) insert(anchor string, offset int, stage Stage) error {
+	for i, existing := range p.stages {
+		if existing.Name() != anchor {
+			continue
+		}
+		at := i + offset
+		p.stages = append(p.stages[:at], append([]Stage{stage}, p.stages[at:]...)...)
+		return nil
+	}
+	return fmt.Errorf("pipeline has no stage %q", anchor)
+}
+
+// Run executes every stage in order, stopping at the first error or when
+// ctx is done. Errors are returned as *StageError.
+func (p *Pipeline) Run(ctx context.Context, state *PipelineState) error {
+	for _, stage := range p.stages {
+		if err := ctx.Err(); err != nil {
+			return &StageError{Stage: stage.Name(), Err: err}
+		}
+		if err := stage.Run(ctx, state); err != nil {
+			return &StageError{Stage: stage.Name(), Err: err}
+		}
+	}
+	return nil
+}
+
+// FetchStage fetches state.TID with every page and extracts it into state.Post.
+func FetchStage(fetcher *Fetcher, parser *PostParser) Stage {
+	return NewStage(StageFetch, func(ctx context.Context, state *PipelineState) error {
+		post, err := fetcher.FetchPostWithPaginationContext(ctx, state.TID, parser)
+		if err != nil {
+			if IsMaintenanceError(err) {
+				return fmt.Errorf("论坛维护中，已停止抓取，请稍后重试: %w", err)
+			}
+			return fmt.Errorf("抓取帖子失败: %w", err)
+		}
+		state.Post = post
+		return nil
+	})
+}
+
+// StreamFetchStage is FetchStage using Fetcher.FetchPostStreaming, spooling
+// floors to store's spool dir. The spool is removed once the post is
+// assembled.
+func StreamFetchStage(fetcher *Fetcher, parser *PostParser, store *PostStore) Stage {
+	return NewStage(StageFetch, func(ctx context.Context, state *PipelineState) error {
+		spool, err := CreateFloorSpool(store.SpoolPath(state.TID))
+		if err != nil {
+			return err
+		}
+		defer spool.Remove()
+		post, err := fetcher.FetchPostStreaming(ctx, state.TID, parser, spool)
+		if err != nil {
+			if IsMaintenanceError(err) {
+				return fmt.Errorf("论坛维护中，已停止抓取，请稍后重试: %w", err)
+			}
+			return fmt.Errorf("抓取帖子失败: %w", err)
+		}
+		state.Post = post
+		return nil
+	})
+}
+
+// ParseFileStage extracts state.Post from one local HTML file.
+func ParseFileStage(parser *PostParser, path string) Stage {
+	return NewStage(StageParse, func(ctx context.Context, state *PipelineState) error {
+		if err := parser.LoadFromFile(path); err != nil {
+			return fmt.Errorf("加载HTML文件失败: %w", err)
+		}
+		post, err := parser.ExtractPost()
+		if err != nil {
+			return fmt.Errorf("提取帖子数据失败: %w", err)
+		}
+		state.Post = post
+		return nil
+	})
+}
+
+// ExtractStage extracts state.Post from state.Pages, which belong to
+// state.TID when set; it does nothing when a post is already set.
+func ExtractStage(parser *PostParser) Stage {
+	return NewStage(StageExtract, func(ctx context.Context, state *PipelineState) error {
+		if state.Post != nil {
+			return nil
+		}
+		post, err := parser.ExtractPostFromRawPages(state.Pages)
+		if err != nil {
+			return fmt.Errorf("重新提取帖子失败: %w", err)
+		}
+		if state.TID != "" {
+			post.TID = state.TID
+		}
+		state.Post = post
+		return nil
+	})
+}
+
+// StoreStage downloads the post's assets and writes it into store in one
+// transaction (see PostStore.Transact). A post without a TID takes state.TID.
+func StoreStage(generator *MarkdownGenerator, store *PostStore) Stage {
+	return NewStage(StageStore, func(ctx context.Context, state *PipelineState) error {
+		if state.Post == nil {
+			return fmt.Errorf("没有可保存的帖子")
+		}
+		if state.Post.TID == "" {
+			state.Post.TID = state.TID
+		}
+		if state.Post.TID == "" {
+			return fmt.Errorf("无法确定帖子ID，请提供 --tid 或位置参数")
+		}
+		err := store.Transact(state.Post.TID, func(stageRoot string) error {
+			return generator.StorePostContext(ctx, state.Post, stageRoot)
+		})
+		if err != nil {
+			return fmt.Errorf("保存帖子到本地库失败: %w", err)
+		}
+		state.Output = store.PostDir(state.Post.TID)
+		return nil
+	})
+}
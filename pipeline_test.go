@@ -0,0 +1,97 @@
+package south2md_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	main "github.com/fdkevin0/south2md"
+)
+
+func recordStage(name string, trace *[]string) main.Stage {
+	return main.NewStage(name, func(ctx context.Context, state *main.PipelineState) error {
+		*trace = append(*trace, name)
+		return nil
+	})
+}
+
+func TestPipelineRunsInsertedStagesInOrder(t *testing.T) {
+	var trace []string
+	p := main.NewPipeline(recordStage("fetch", &trace), recordStage("store", &trace))
+	if err := p.InsertAfter("fetch", recordStage("filter", &trace)); err != nil {
+		t.Fatalf("InsertAfter returned error: %v", err)
+	}
+	if err := p.InsertBefore("fetch", recordStage("login", &trace)); err != nil {
+		t.Fatalf("InsertBefore returned error: %v", err)
+	}
+	if err := p.InsertAfter("missing", recordStage("x", &trace)); err == nil {
+		t.Fatal("expected error for unknown anchor")
+	}
+
+	want := []string{"login", "fetch", "filter", "store"}
+	if got := p.Stages(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Stages() = %v, want %v", got, want)
+	}
+	if err := p.Run(context.Background(), &main.PipelineState{}); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if !reflect.DeepEqual(trace, want) {
+		t.Fatalf("run order = %v, want %v", trace, want)
+	}
+}
+
+func TestPipelineStopsAtFailingStage(t *testing.T) {
+	var trace []string
+	boom := errors.New("boom")
+	p := main.NewPipeline(
+		recordStage("a", &trace),
+		main.NewStage("b", func(ctx context.Context, state *main.PipelineState) error { return boom }),
+		recordStage("c", &trace),
+	)
+
+	err := p.Run(context.Background(), &main.PipelineState{})
+	var stageErr *main.StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != "b" {
+		t.Fatalf("expected StageError for stage b, got %v", err)
+	}
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected error to wrap boom, got %v", err)
+	}
+	if !reflect.DeepEqual(trace, []string{"a"}) {
+		t.Fatalf("stages after failure should not run, trace = %v", trace)
+	}
+}
+
+func TestPipelineHonorsCanceledContext(t *testing.T) {
+	var trace []string
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := main.NewPipeline(recordStage("a", &trace)).Run(ctx, &main.PipelineState{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(trace) != 0 {
+		t.Fatalf("no stage should run after cancel, trace = %v", trace)
+	}
+}
+
+func TestExtractStageBuildsPostFromRawPages(t *testing.T) {
+	html, err := os.ReadFile("tid-2636739.html")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	state := &main.PipelineState{TID: "42", Pages: []main.RawPage{{Page: 1, HTML: string(html)}}}
+
+	if err := main.NewPipeline(main.ExtractStage(main.NewPostParser())).Run(context.Background(), state); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if state.Post == nil || state.Post.TID != "42" {
+		t.Fatalf("expected post with TID 42, got %+v", state.Post)
+	}
+	if len(state.Post.Replies) != 4 {
+		t.Fatalf("expected 4 replies, got %d", len(state.Post.Replies))
+	}
+}
@@ -0,0 +1,192 @@
+// Package south2md is the stable, library-facing API of south2md. It wraps
+// the fetcher, parser, renderer and post store behind small types so that
+// programs can archive South Plus threads without depending on the CLI or
+// on the internals of the root package.
+package south2md
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	core "github.com/fdkevin0/south2md"
+)
+
+// Data model shared with the root package.
+type (
+	Post          = core.Post
+	PostEntry     = core.PostEntry
+	Author        = core.Author
+	Attachment    = core.Attachment
+	Image         = core.Image
+	Config        = core.Config
+	RenderOptions = core.MarkdownOptions
+)
+
+// DefaultConfig returns the default configuration.
+func DefaultConfig() *Config {
+	return core.NewDefaultConfig()
+}
+
+// Client fetches and parses threads from the forum.
+type Client struct {
+	config  *Config
+	fetcher *core.Fetcher
+	profile core.SelectorProfile
+}
+
+// NewClient creates a client from config; nil uses DefaultConfig.
+func NewClient(config *Config) (*Client, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	profile, err := core.ResolveSelectorProfile(config.SelectorProfile, config.Selectors)
+	if err != nil {
+		return nil, err
+	}
+	proxyPool := config.HTTPProxyPool
+	if config.HTTPProxyPoolFile != "" {
+		proxies, err := core.LoadProxyPoolFile(config.HTTPProxyPoolFile)
+		if err != nil {
+			return nil, err
+		}
+		proxyPool = append(append([]string(nil), proxyPool...), proxies...)
+	}
+
+	options := core.HTTPOptionsFromConfig(config)
+	options.ProxyPool = proxyPool
+	return &Client{
+		config:  config,
+		fetcher: core.NewFetcher(core.NewHTTPClient(options), options, config.BaseURL),
+		profile: profile,
+	}, nil
+}
+
+// FetchThread fetches every page of thread tid and extracts it. ctx is
+// checked before every request and parents the OpenTelemetry spans of the
+// fetch; requests already in flight are bounded by the configured HTTP
+// timeout.
+func (c *Client) FetchThread(ctx context.Context, tid string) (*Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	post, err := c.fetcher.FetchPostWithPaginationContext(ctx, tid, c.newParser())
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+// ParseThread extracts a thread from one saved HTML page.
+func (c *Client) ParseThread(r io.Reader) (*Post, error) {
+	parser := c.newParser()
+	if err := parser.LoadFromReader(r); err != nil {
+		return nil, err
+	}
+	return parser.ExtractPost()
+}
+
+func (c *Client) newParser() *core.PostParser {
+	parser := core.NewPostParser()
+	parser.SetSelectorProfile(c.profile)
+	return parser
+}
+
+// Renderer turns posts into markdown without touching the network or disk:
+// remote images keep their original URLs.
+type Renderer struct{}
+
+// NewRenderer creates a renderer.
+func NewRenderer() *Renderer {
+	return &Renderer{}
+}
+
+// Render renders post as a single markdown document.
+func (r *Renderer) Render(post *Post, opts RenderOptions) (string, error) {
+	if post == nil {
+		return "", fmt.Errorf("post is nil")
+	}
+	generator := core.NewMarkdownGenerator(&opts, nil)
+	generator.SetDownloadEnabled(false)
+	return generator.GenerateMarkdown(post)
+}
+
+// Store persists posts and their downloaded assets.
+type Store interface {
+	// Save stores post, downloading its images, and writes its metadata.
+	Save(post *Post) error
+	// Load returns a previously saved post.
+	Load(tid string) (*Post, error)
+	// Export renders post.md for tid and copies the post directory into
+	// dir, returning the exported directory.
+	Export(tid, dir string) (string, error)
+}
+
+// FileStore is a Store keeping one directory per thread under a root
+// directory, the same layout the CLI uses.
+type FileStore struct {
+	store *core.PostStore
+	opts  RenderOptions
+}
+
+var _ Store = (*FileStore)(nil)
+
+// NewFileStore creates a store rooted at rootDir, rendering with opts.
+func NewFileStore(rootDir string, opts RenderOptions) (*FileStore, error) {
+	store := core.NewPostStore(rootDir)
+	if err := store.EnsureRoot(); err != nil {
+		return nil, err
+	}
+	return &FileStore{store: store, opts: opts}, nil
+}
+
+// Save implements Store.
+func (s *FileStore) Save(post *Post) error {
+	generator, err := s.newGenerator()
+	if err != nil {
+		return err
+	}
+	return s.store.Transact(post.TID, func(stageRoot string) error {
+		return generator.StorePost(post, stageRoot)
+	})
+}
+
+// Load implements Store.
+func (s *FileStore) Load(tid string) (*Post, error) {
+	return s.store.LoadPostFromStore(tid)
+}
+
+// Export implements Store.
+func (s *FileStore) Export(tid, dir string) (string, error) {
+	post, err := s.store.LoadPostFromStore(tid)
+	if err != nil {
+		return "", err
+	}
+	exported, err := s.store.ExportPost(tid, dir)
+	if err != nil {
+		return "", err
+	}
+	generator, err := s.newGenerator()
+	if err != nil {
+		return "", err
+	}
+	generator.SetDownloadEnabled(false)
+	if err := generator.ExportPost(post, dir); err != nil {
+		return "", err
+	}
+	return exported, nil
+}
+
+func (s *FileStore) newGenerator() (*core.MarkdownGenerator, error) {
+	opts := s.opts
+	generator := core.NewMarkdownGenerator(&opts, nil)
+	registry, err := core.LoadAssetRegistry(s.store.RootDir())
+	if err != nil {
+		return nil, err
+	}
+	generator.SetAssetRegistry(registry)
+	return generator, nil
+}
@@ -0,0 +1,116 @@
+package south2md_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fdkevin0/south2md/pkg/south2md"
+)
+
+func TestClientFetchRenderAndStore(t *testing.T) {
+	page, err := os.ReadFile(filepath.Join("..", "..", "tid-2636739.html"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(page)
+	}))
+	defer srv.Close()
+
+	config := south2md.DefaultConfig()
+	config.BaseURL = srv.URL
+	config.HTTPEnableCookie = false
+	client, err := south2md.NewClient(config)
+	if err != nil {
+		t.Fatalf("NewClient returned error: %v", err)
+	}
+
+	post, err := client.FetchThread(context.Background(), "2636739")
+	if err != nil {
+		t.Fatalf("FetchThread returned error: %v", err)
+	}
+	if post.TID != "2636739" || len(post.Replies) != 4 {
+		t.Fatalf("unexpected post: tid=%s replies=%d", post.TID, len(post.Replies))
+	}
+
+	md, err := south2md.NewRenderer().Render(post, south2md.RenderOptions{})
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	if !strings.Contains(md, post.Title) {
+		t.Fatalf("expected title in markdown, got:\n%s", md)
+	}
+
+	var store south2md.Store
+	store, err = south2md.NewFileStore(t.TempDir(), south2md.RenderOptions{})
+	if err != nil {
+		t.Fatalf("NewFileStore returned error: %v", err)
+	}
+	stored := &south2md.Post{
+		TID:      "100",
+		Title:    "stored",
+		MainPost: south2md.PostEntry{PostID: "tpc", HTMLContent: "<p>no images</p>"},
+	}
+	if err := store.Save(stored); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	loaded, err := store.Load("100")
+	if err != nil || loaded.Title != stored.Title {
+		t.Fatalf("Load returned %v, %v", loaded, err)
+	}
+	exported, err := store.Export("100", t.TempDir())
+	if err != nil {
+		t.Fatalf("Export returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(exported, "post.md")); err != nil {
+		t.Fatalf("expected exported post.md: %v", err)
+	}
+}
+
+func TestClientFetchThreadHonorsCancelledContext(t *testing.T) {
+	client, err := south2md.NewClient(nil)
+	if err != nil {
+		t.Fatalf("NewClient returned error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.FetchThread(ctx, "1"); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestClientReplaysFixturesDir(t *testing.T) {
+	page, err := os.ReadFile(filepath.Join("..", "..", "tid-2636739.html"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	dir := t.TempDir()
+	fixture := filepath.Join(dir, "south-plus.net", "read.php@tid-2636739.html")
+	if err := os.MkdirAll(filepath.Dir(fixture), 0o755); err != nil {
+		t.Fatalf("create fixture dir: %v", err)
+	}
+	if err := os.WriteFile(fixture, page, 0o600); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+
+	config := south2md.DefaultConfig()
+	config.BaseURL = "https://south-plus.net/"
+	config.HTTPEnableCookie = false
+	config.FixturesDir = dir
+	client, err := south2md.NewClient(config)
+	if err != nil {
+		t.Fatalf("NewClient returned error: %v", err)
+	}
+	post, err := client.FetchThread(context.Background(), "2636739")
+	if err != nil {
+		t.Fatalf("FetchThread returned error: %v", err)
+	}
+	if len(post.Replies) != 4 {
+		t.Fatalf("expected the thread from the fixtures dir, got %d replies", len(post.Replies))
+	}
+}
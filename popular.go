@@ -0,0 +1,141 @@
+package south2md
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Popular reply ranking strategies.
+const (
+	PopularStrategyQuotes   = "quotes"
+	PopularStrategyLength   = "length"
+	PopularStrategyCombined = "combined"
+)
+
+// PopularStrategies lists all supported ranking strategies.
+var PopularStrategies = []string{
+	PopularStrategyQuotes,
+	PopularStrategyLength,
+	PopularStrategyCombined,
+}
+
+// IsValidPopularStrategy reports whether strategy is a supported ranking strategy.
+func IsValidPopularStrategy(strategy string) bool {
+	for _, s := range PopularStrategies {
+		if s == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+// quotedFloorPattern matches phpwind's quote header, e.g. "引用第3楼xxx于...发表的".
+var quotedFloorPattern = regexp.MustCompile(`引用第(\d+)楼`)
+
+// quoteMatchThreshold is the similarity above which a quote without a header
+// is attributed to an earlier floor.
+const quoteMatchThreshold = 0.8
+
+// popularReply is one ranked reply with the signals behind its score.
+type popularReply struct {
+	Floor  TemplateFloor
+	Quotes int
+	Length int
+	Score  float64
+}
+
+// rankPopularReplies scores replies (never the main post) by how often later
+// floors quote them and by their own text length, and returns the top n with
+// a positive score, best first. Ties keep thread order.
+func rankPopularReplies(floors []TemplateFloor, strategy string, n int) []popularReply {
+	if n <= 0 || len(floors) < 2 {
+		return nil
+	}
+
+	plain := make([]string, len(floors))
+	quotes := make([]int, len(floors))
+	lengths := make([]int, len(floors))
+	for i, floor := range floors {
+		quoted, rest, hasQuote := splitQuotedHTML(floor.Entry.HTMLContent)
+		plain[i] = normalizeQuoteText(rest)
+		lengths[i] = len([]rune(plain[i]))
+		if !hasQuote {
+			continue
+		}
+		if target := quotedFloorIndex(quoted, i); target >= 0 {
+			quotes[target]++
+			continue
+		}
+		quoted = quoteHeaderPattern.ReplaceAllString(normalizeQuoteText(quoted), "")
+		best, bestScore := -1, 0.0
+		for j := 0; j < i; j++ {
+			if score := diceSimilarity(quoted, plain[j]); score > bestScore {
+				best, bestScore = j, score
+			}
+		}
+		if best >= 0 && bestScore >= quoteMatchThreshold {
+			quotes[best]++
+		}
+	}
+
+	ranked := make([]popularReply, 0, len(floors)-1)
+	for i := 1; i < len(floors); i++ {
+		var score float64
+		switch strategy {
+		case PopularStrategyQuotes:
+			score = float64(quotes[i])
+		case PopularStrategyLength:
+			score = float64(lengths[i])
+		default:
+			// One quote outweighs any length difference up to 500 characters.
+			score = float64(quotes[i]) + float64(min(lengths[i], 500))/500
+		}
+		if score <= 0 {
+			continue
+		}
+		ranked = append(ranked, popularReply{Floor: floors[i], Quotes: quotes[i], Length: lengths[i], Score: score})
+	}
+
+	sort.SliceStable(ranked, func(a, b int) bool { return ranked[a].Score > ranked[b].Score })
+	if len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return ranked
+}
+
+// quotedFloorIndex resolves a "引用第N楼" header to the entry index it refers
+// to, or -1 when the quote has no usable header.
+func quotedFloorIndex(quoted string, current int) int {
+	m := quotedFloorPattern.FindStringSubmatch(quoted)
+	if len(m) < 2 {
+		return -1
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n < 0 || n >= current {
+		return -1
+	}
+	return n
+}
+
+// FormatPopularReplies renders the ranked replies section, or "" when
+// PopularReplies is 0 or no reply scores.
+func (mf *MarkdownFormatter) FormatPopularReplies(floors []TemplateFloor) string {
+	ranked := rankPopularReplies(floors, mf.options.PopularStrategy, mf.options.PopularReplies)
+	if len(ranked) == 0 {
+		return ""
+	}
+
+	var md strings.Builder
+	md.WriteString("**热门回复**\n\n")
+	for i, reply := range ranked {
+		fmt.Fprintf(&md, "%d. [%s](#pid%s)", i+1, reply.Floor.Floor, reply.Floor.Entry.PostID)
+		if name := reply.Floor.Entry.Author.Username; name != "" {
+			md.WriteString(" " + EscapeMarkdown(name))
+		}
+		fmt.Fprintf(&md, " — 被引用 %d 次 · %d 字\n", reply.Quotes, reply.Length)
+	}
+	return md.String()
+}
@@ -0,0 +1,65 @@
+package south2md_test
+
+import (
+	"strings"
+	"testing"
+
+	main "github.com/fdkevin0/south2md"
+)
+
+func popularTestPost() *main.Post {
+	original := "这次的汉化质量非常高，翻译和嵌字都很用心，感谢各位大佬的付出"
+	return &main.Post{
+		TID:      "100",
+		Title:    "popular",
+		MainPost: main.PostEntry{Floor: "GF", PostID: "tpc", HTMLContent: "<p>main post</p>"},
+		Replies: []main.PostEntry{
+			{Floor: "B1F", PostID: "201", Author: main.Author{Username: "bob"}, HTMLContent: original},
+			{Floor: "B2F", PostID: "202", HTMLContent: "这是一条比较长的回复，但是没有人引用它，只是单纯地说了很多很多的话"},
+			{Floor: "B3F", PostID: "203", HTMLContent: `<blockquote class="blockquote">引用第1楼bob于2024-01-01 10:00发表的 :<br>` + original + `</blockquote>+1`},
+			{Floor: "B4F", PostID: "204", HTMLContent: `<blockquote class="blockquote">` + original + `</blockquote>同意`},
+		},
+	}
+}
+
+func TestGenerateMarkdownRanksPopularRepliesByQuotes(t *testing.T) {
+	g := main.NewMarkdownGenerator(&main.MarkdownOptions{PopularReplies: 1, PopularStrategy: main.PopularStrategyQuotes}, nil)
+	g.SetDownloadEnabled(false)
+	md, err := g.GenerateMarkdown(popularTestPost())
+	if err != nil {
+		t.Fatalf("GenerateMarkdown returned error: %v", err)
+	}
+
+	want := "**热门回复**\n\n1. [B1F](#pid201) bob — 被引用 2 次 ·"
+	if !strings.Contains(md, want) {
+		t.Fatalf("expected B1F ranked first with header and similarity quotes counted, got:\n%s", md)
+	}
+	if strings.Contains(md, "2. [") {
+		t.Fatalf("expected list capped at 1 entry, got:\n%s", md)
+	}
+}
+
+func TestGenerateMarkdownRanksPopularRepliesByLength(t *testing.T) {
+	g := main.NewMarkdownGenerator(&main.MarkdownOptions{PopularReplies: 2, PopularStrategy: main.PopularStrategyLength}, nil)
+	g.SetDownloadEnabled(false)
+	md, err := g.GenerateMarkdown(popularTestPost())
+	if err != nil {
+		t.Fatalf("GenerateMarkdown returned error: %v", err)
+	}
+
+	if !strings.Contains(md, "1. [B2F](#pid202)") || !strings.Contains(md, "2. [B1F](#pid201)") {
+		t.Fatalf("expected replies ordered by length, got:\n%s", md)
+	}
+}
+
+func TestGenerateMarkdownOmitsPopularRepliesByDefault(t *testing.T) {
+	g := main.NewMarkdownGenerator(&main.MarkdownOptions{}, nil)
+	g.SetDownloadEnabled(false)
+	md, err := g.GenerateMarkdown(popularTestPost())
+	if err != nil {
+		t.Fatalf("GenerateMarkdown returned error: %v", err)
+	}
+	if strings.Contains(md, "热门回复") {
+		t.Fatalf("expected no popular section when disabled, got:\n%s", md)
+	}
+}
@@ -0,0 +1,306 @@
+package south2md
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// SnippetLines is how many lines of text DiffPosts keeps of each new floor,
+// so a notification alone is often enough to read an update.
+const SnippetLines = 3
+
+// snippetLineRunes caps a snippet line, so one long paragraph can't swamp a
+// notification.
+const snippetLineRunes = 200
+
+// PostDiff describes what changed between two snapshots of one thread.
+type PostDiff struct {
+	TID            string           `json:"tid"`
+	Title          string           `json:"title"`
+	NewFloors      []FloorChange    `json:"new_floors"`
+	EditedFloors   []FloorChange    `json:"edited_floors"`
+	DeletedFloors  []FloorChange    `json:"deleted_floors"`
+	NewAttachments []AttachmentDiff `json:"new_attachments"`
+	MissingPages   []int            `json:"missing_pages,omitempty"` // pages of the new snapshot that failed; their floors aren't compared
+}
+
+// FloorChange is one floor that was added, edited or deleted.
+type FloorChange struct {
+	Floor   string `json:"floor"`
+	Author  string `json:"author"`
+	OldHash string `json:"old_hash,omitempty"`
+	NewHash string `json:"new_hash,omitempty"`
+	Status  string `json:"status,omitempty"` // status in the new snapshot, e.g. deleted or blocked
+	// Snippet is the first SnippetLines lines of a new floor's text, quotes
+	// left out, as plain text.
+	Snippet []string `json:"snippet,omitempty"`
+}
+
+// AttachmentDiff is an attachment that only the new snapshot has.
+type AttachmentDiff struct {
+	Floor    string `json:"floor"`
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	URL      string `json:"url"`
+	Size     int64  `json:"size,omitempty"`
+}
+
+// Empty reports whether the snapshots are the same.
+func (d *PostDiff) Empty() bool {
+	return len(d.NewFloors) == 0 && len(d.EditedFloors) == 0 && len(d.DeletedFloors) == 0 && len(d.NewAttachments) == 0
+}
+
+// ContentHash returns the SHA-256 of the floor's HTML content, ignoring
+// surrounding whitespace.
+func (e *PostEntry) ContentHash() string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(e.HTMLContent)))
+	return hex.EncodeToString(sum[:])
+}
+
+// DiffPosts compares two snapshots of a thread. Floors are matched by their
+// label; a floor counts as deleted when it is gone from newPost or the forum
+// now shows it as deleted or blocked. Floors on pages newPost failed to fetch
+// are left out.
+func DiffPosts(oldPost, newPost *Post) *PostDiff {
+	diff := &PostDiff{
+		TID:          newPost.TID,
+		Title:        newPost.Title,
+		MissingPages: newPost.MissingPages,
+	}
+	if diff.TID == "" {
+		diff.TID = oldPost.TID
+	}
+	missing := make(map[int]bool, len(newPost.MissingPages))
+	for _, page := range newPost.MissingPages {
+		missing[page] = true
+	}
+
+	oldFloors := floorsByLabel(oldPost)
+	newFloors := floorsByLabel(newPost)
+
+	for i, entry := range postFloors(newPost) {
+		label := floorLabel(i, entry)
+		old, ok := oldFloors[label]
+		if !ok {
+			if entry.Status == "" {
+				diff.NewFloors = append(diff.NewFloors, FloorChange{Floor: label, Author: entry.Author.Username, NewHash: entry.ContentHash(), Snippet: floorSnippet(entry)})
+			}
+			diff.NewAttachments = appendNewAttachments(diff.NewAttachments, label, nil, entry)
+			continue
+		}
+		switch {
+		case old.Status == "" && entry.Status != "":
+			diff.DeletedFloors = append(diff.DeletedFloors, FloorChange{Floor: label, Author: old.Author.Username, OldHash: old.ContentHash(), Status: entry.Status})
+		case old.Status == "" && old.ContentHash() != entry.ContentHash():
+			diff.EditedFloors = append(diff.EditedFloors, FloorChange{Floor: label, Author: entry.Author.Username, OldHash: old.ContentHash(), NewHash: entry.ContentHash()})
+		}
+		diff.NewAttachments = appendNewAttachments(diff.NewAttachments, label, old, entry)
+	}
+
+	for i, entry := range postFloors(oldPost) {
+		label := floorLabel(i, entry)
+		if _, ok := newFloors[label]; ok || entry.Status != "" || missing[entry.SourcePage] {
+			continue
+		}
+		diff.DeletedFloors = append(diff.DeletedFloors, FloorChange{Floor: label, Author: entry.Author.Username, OldHash: entry.ContentHash(), Status: FloorStatusDeleted})
+	}
+	return diff
+}
+
+// Markdown renders the diff as a markdown report.
+func (d *PostDiff) Markdown() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n", diffTitle(d))
+	if len(d.MissingPages) > 0 {
+		fmt.Fprintf(&sb, "> 新快照缺失第 %s 页，这些页上的楼层未比较\n\n", joinInts(d.MissingPages))
+	}
+	if d.Empty() {
+		sb.WriteString("没有变化\n")
+		return sb.String()
+	}
+
+	writeFloors := func(heading string, floors []FloorChange) {
+		if len(floors) == 0 {
+			return
+		}
+		fmt.Fprintf(&sb, "## %s (%d)\n\n", heading, len(floors))
+		for _, floor := range floors {
+			writeFloorChange(&sb, floor)
+		}
+		sb.WriteString("\n")
+	}
+	writeFloors("新楼层", d.NewFloors)
+	writeFloors("已编辑", d.EditedFloors)
+	writeFloors("已删除", d.DeletedFloors)
+
+	if len(d.NewAttachments) > 0 {
+		fmt.Fprintf(&sb, "## 新附件 (%d)\n\n", len(d.NewAttachments))
+		for _, att := range d.NewAttachments {
+			line := fmt.Sprintf("- %s [%s](%s)", att.Floor, att.Filename, att.URL)
+			if att.Size > 0 {
+				line += " " + FormatByteSize(att.Size)
+			}
+			sb.WriteString(line + "\n")
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimRight(sb.String(), "\n") + "\n"
+}
+
+// NewFloorsMarkdown renders the new floors as a Markdown list, each with its
+// snippet quoted below it. Past limit floors (0 means no limit) it only
+// counts the rest. It returns "" when there are no new floors.
+func (d *PostDiff) NewFloorsMarkdown(limit int) string {
+	if len(d.NewFloors) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for i, floor := range d.NewFloors {
+		if limit > 0 && i == limit {
+			fmt.Fprintf(&sb, "- 另有 %d 个新楼层\n", len(d.NewFloors)-limit)
+			break
+		}
+		writeFloorChange(&sb, floor)
+	}
+	return sb.String()
+}
+
+// writeFloorChange writes floor as a list item, its snippet escaped so it
+// can't open a link, list or code block of its own.
+func writeFloorChange(sb *strings.Builder, floor FloorChange) {
+	line := "- " + floor.Floor
+	if floor.Author != "" {
+		line += " @" + EscapeMarkdown(floor.Author)
+	}
+	if floor.Status != "" && floor.Status != FloorStatusDeleted {
+		line += " (" + floor.Status + ")"
+	}
+	sb.WriteString(line + "\n")
+	for _, text := range floor.Snippet {
+		sb.WriteString("  > " + snippetEscaper.Replace(EscapeMarkdown(text)) + "\n")
+	}
+}
+
+// snippetEscaper escapes what EscapeMarkdown leaves alone but could still
+// start raw HTML or a nested quote.
+var snippetEscaper = strings.NewReplacer("<", "\\<", ">", "\\>")
+
+// floorSnippet returns the first SnippetLines non-empty lines of the text
+// of entry, quotes left out and each cut at snippetLineRunes.
+func floorSnippet(entry *PostEntry) []string {
+	if strings.TrimSpace(entry.HTMLContent) == "" {
+		return nil
+	}
+	root := parseFragment(entry.HTMLContent)
+	inQuote := make(map[*html.Node]bool)
+	if selector, err := compileSelector(quoteSelector); err == nil {
+		for _, n := range selector.MatchAll(root) {
+			inQuote[n] = true
+		}
+	}
+
+	var text strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if inQuote[n] {
+			return
+		}
+		switch {
+		case n.Type == html.TextNode:
+			text.WriteString(n.Data)
+		case n.Type == html.ElementNode && n.Data == "br":
+			text.WriteString("\n")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if n.Type == html.ElementNode && n.Data != "img" && !isInlineElement(n) {
+			text.WriteString("\n")
+		}
+	}
+	walk(root)
+
+	var lines []string
+	for _, line := range strings.Split(text.String(), "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			continue
+		}
+		if utf8.RuneCountInString(line) > snippetLineRunes {
+			line = string([]rune(line)[:snippetLineRunes]) + "…"
+		}
+		lines = append(lines, line)
+		if len(lines) == SnippetLines {
+			break
+		}
+	}
+	return lines
+}
+
+func diffTitle(d *PostDiff) string {
+	if d.Title != "" {
+		return d.Title
+	}
+	return d.TID
+}
+
+// postFloors returns the main post followed by the replies.
+func postFloors(post *Post) []*PostEntry {
+	floors := make([]*PostEntry, 0, len(post.Replies)+1)
+	floors = append(floors, &post.MainPost)
+	for i := range post.Replies {
+		floors = append(floors, &post.Replies[i])
+	}
+	return floors
+}
+
+func floorsByLabel(post *Post) map[string]*PostEntry {
+	floors := make(map[string]*PostEntry, len(post.Replies)+1)
+	for i, entry := range postFloors(post) {
+		if label := floorLabel(i, entry); label != "" {
+			floors[label] = entry
+		}
+	}
+	return floors
+}
+
+// floorLabel returns the label of the i-th entry of postFloors; older
+// metadata may lack the main post's label.
+func floorLabel(i int, entry *PostEntry) string {
+	if i == 0 && entry.Floor == "" {
+		return "GF"
+	}
+	return entry.Floor
+}
+
+// appendNewAttachments appends the attachments of entry that old (nil for a
+// new floor) doesn't have, matched by ID or URL.
+func appendNewAttachments(diffs []AttachmentDiff, label string, old, entry *PostEntry) []AttachmentDiff {
+	known := make(map[string]bool)
+	if old != nil {
+		for _, att := range old.Attachments {
+			known[att.ID] = true
+			known[att.URL] = true
+		}
+	}
+	for _, att := range entry.Attachments {
+		if (att.ID != "" && known[att.ID]) || (att.URL != "" && known[att.URL]) {
+			continue
+		}
+		diffs = append(diffs, AttachmentDiff{Floor: label, ID: att.ID, Filename: att.Filename, URL: att.URL, Size: att.Size})
+	}
+	return diffs
+}
+
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprint(v)
+	}
+	return strings.Join(parts, ", ")
+}
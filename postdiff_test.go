@@ -0,0 +1,118 @@
+package south2md
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDiffPosts(t *testing.T) {
+	oldPost := &Post{
+		TID:      "100",
+		MainPost: PostEntry{Floor: "GF", HTMLContent: "<p>main</p>"},
+		Replies: []PostEntry{
+			{Floor: "B1F", HTMLContent: "<p>first</p>", SourcePage: 1},
+			{Floor: "B2F", HTMLContent: "<p>second</p>", SourcePage: 1,
+				Attachments: []Attachment{{ID: "1", Filename: "a.zip", URL: "https://example.com/a"}}},
+			{Floor: "B3F", HTMLContent: "<p>gone</p>", SourcePage: 1, Author: Author{Username: "carol"}},
+			{Floor: "B4F", HTMLContent: "<p>moderated</p>", SourcePage: 1},
+			{Floor: "B30F", HTMLContent: "<p>on a page that failed</p>", SourcePage: 2},
+		},
+	}
+	newPost := &Post{
+		TID:          "100",
+		Title:        "Thread",
+		MainPost:     PostEntry{HTMLContent: "  <p>main</p>\n"},
+		MissingPages: []int{2},
+		Replies: []PostEntry{
+			{Floor: "B1F", HTMLContent: "<p>first, edited</p>", SourcePage: 1, Author: Author{Username: "alice"}},
+			{Floor: "B2F", HTMLContent: "<p>second</p>", SourcePage: 1,
+				Attachments: []Attachment{{ID: "1", Filename: "a.zip", URL: "https://example.com/a"}, {ID: "2", Filename: "b.zip", URL: "https://example.com/b"}}},
+			{Floor: "B4F", SourcePage: 1, Status: FloorStatusBlocked},
+			{Floor: "B5F", HTMLContent: "<p>new</p>", SourcePage: 1, Author: Author{Username: "bob"},
+				Attachments: []Attachment{{ID: "3", Filename: "c.zip", URL: "https://example.com/c"}}},
+		},
+	}
+
+	diff := DiffPosts(oldPost, newPost)
+	floors := func(changes []FloorChange) string {
+		labels := make([]string, len(changes))
+		for i, change := range changes {
+			labels[i] = change.Floor
+		}
+		return strings.Join(labels, ",")
+	}
+	if got := floors(diff.NewFloors); got != "B5F" {
+		t.Fatalf("new floors = %q", got)
+	}
+	if got := floors(diff.EditedFloors); got != "B1F" {
+		t.Fatalf("edited floors = %q", got)
+	}
+	if got := floors(diff.DeletedFloors); got != "B4F,B3F" {
+		t.Fatalf("deleted floors = %q", got)
+	}
+	if diff.DeletedFloors[0].Status != FloorStatusBlocked {
+		t.Fatalf("expected B4F to be reported as blocked, got %+v", diff.DeletedFloors[0])
+	}
+	if len(diff.NewAttachments) != 2 || diff.NewAttachments[0].ID != "2" || diff.NewAttachments[1].Floor != "B5F" {
+		t.Fatalf("unexpected new attachments: %+v", diff.NewAttachments)
+	}
+
+	markdown := diff.Markdown()
+	for _, want := range []string{"# Thread", "## 新楼层 (1)", "- B5F @bob", "## 已删除 (2)", "- B4F (blocked)", "[b.zip](https://example.com/b)", "缺失第 2 页"} {
+		if !strings.Contains(markdown, want) {
+			t.Fatalf("markdown missing %q:\n%s", want, markdown)
+		}
+	}
+	if _, err := json.Marshal(diff); err != nil {
+		t.Fatalf("failed to encode diff: %v", err)
+	}
+
+	if !DiffPosts(oldPost, oldPost).Empty() {
+		t.Fatal("expected a snapshot to have no changes against itself")
+	}
+}
+
+func TestDiffPostsKeepsSnippetsOfNewFloors(t *testing.T) {
+	oldPost := &Post{TID: "100", MainPost: PostEntry{Floor: "GF", HTMLContent: "<p>main</p>"}}
+	newPost := &Post{
+		TID:      "100",
+		MainPost: PostEntry{Floor: "GF", HTMLContent: "<p>main</p>"},
+		Replies: []PostEntry{
+			{Floor: "B1F", Author: Author{Username: "bob"}, HTMLContent: `<blockquote class="blockquote">quoted reply</blockquote>` +
+				`first <b>line</b><br><br>[link](https://example.com) <img src="a.png"> *stars*<br>&lt;script&gt;<br>fourth line`},
+			{Floor: "B2F", HTMLContent: "<div>" + strings.Repeat("长", snippetLineRunes+10) + "</div>"},
+			{Floor: "B3F", HTMLContent: "<p>third</p>"},
+		},
+	}
+
+	diff := DiffPosts(oldPost, newPost)
+	if len(diff.NewFloors) != 3 {
+		t.Fatalf("expected 3 new floors, got %+v", diff.NewFloors)
+	}
+	want := []string{"first line", "[link](https://example.com) *stars*", "<script>"}
+	if got := diff.NewFloors[0].Snippet; strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("snippet = %q, want %q", got, want)
+	}
+	if got := diff.NewFloors[1].Snippet; len(got) != 1 || got[0] != strings.Repeat("长", snippetLineRunes)+"…" {
+		t.Fatalf("expected one line cut at %d runes, got %q", snippetLineRunes, got)
+	}
+
+	markdown := diff.NewFloorsMarkdown(2)
+	for _, want := range []string{
+		"- B1F @bob\n  > first line\n",
+		"  > \\[link\\]\\(https://example\\.com\\) \\*stars\\*\n",
+		"  > \\<script\\>\n",
+		"- 另有 1 个新楼层\n",
+	} {
+		if !strings.Contains(markdown, want) {
+			t.Fatalf("markdown missing %q:\n%s", want, markdown)
+		}
+	}
+	if strings.Contains(markdown, "B3F") {
+		t.Fatalf("expected floors past the limit to be counted only:\n%s", markdown)
+	}
+	if DiffPosts(newPost, newPost).NewFloorsMarkdown(0) != "" {
+		t.Fatal("expected no markdown without new floors")
+	}
+}
@@ -0,0 +1,100 @@
+package south2md
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyDirect disables proxying, including proxies from the environment.
+const ProxyDirect = "direct"
+
+// proxySchemes lists proxy URL schemes supported by net/http.
+var proxySchemes = []string{"http", "https", "socks5", "socks5h"}
+
+// ParseProxyURL validates a proxy URL. A bare host:port is treated as an
+// HTTP proxy.
+func ParseProxyURL(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return nil, NewValidationError(fmt.Sprintf("invalid proxy url %q: %v", raw, err))
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	if parsed.Host == "" {
+		return nil, NewValidationError(fmt.Sprintf("invalid proxy url %q: missing host", raw))
+	}
+	for _, scheme := range proxySchemes {
+		if parsed.Scheme == scheme {
+			return parsed, nil
+		}
+	}
+	return nil, NewValidationError(fmt.Sprintf("unsupported proxy scheme %q (supported: %s)", parsed.Scheme, strings.Join(proxySchemes, ", ")))
+}
+
+// resolveProxy picks the proxy URL and bypass list. Explicit values win over
+// HTTPS_PROXY, HTTP_PROXY, ALL_PROXY and NO_PROXY (either case).
+func resolveProxy(proxy, noProxy string) (string, string) {
+	if proxy == "" {
+		proxy = firstEnv("HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy", "ALL_PROXY", "all_proxy")
+	}
+	if noProxy == "" {
+		noProxy = firstEnv("NO_PROXY", "no_proxy")
+	}
+	if strings.EqualFold(proxy, ProxyDirect) {
+		proxy = ""
+	}
+	return proxy, noProxy
+}
+
+func firstEnv(keys ...string) string {
+	for _, key := range keys {
+		if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// configureProxy returns a transport sending requests through the resolved
+// proxy, or nil when no proxy applies. Hosts matching the NO_PROXY list (and
+// loopback addresses) are always reached directly, so e.g. the forum can go
+// through a proxy while asset hosts are excluded, or the other way round.
+func configureProxy(proxy, noProxy string) *http.Transport {
+	proxy, noProxy = resolveProxy(proxy, noProxy)
+	if proxy == "" {
+		return nil
+	}
+
+	parsedURL, err := ParseProxyURL(proxy)
+	if err != nil {
+		slog.Warn("Invalid proxy URL detected", "proxy", proxy, "error", err)
+		return nil
+	}
+
+	proxyFunc := (&httpproxy.Config{
+		HTTPProxy:  parsedURL.String(),
+		HTTPSProxy: parsedURL.String(),
+		NoProxy:    noProxy,
+	}).ProxyFunc()
+
+	if noProxy != "" {
+		slog.Warn("Using proxy with bypass rules", "proxy", parsedURL.Redacted(), "no_proxy", noProxy)
+	} else {
+		slog.Warn("Using proxy server", "proxy", parsedURL.Redacted())
+	}
+
+	return &http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		},
+	}
+}
@@ -0,0 +1,70 @@
+package south2md
+
+import (
+	"net/http"
+	"testing"
+)
+
+func clearProxyEnv(t *testing.T) {
+	for _, key := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy", "ALL_PROXY", "all_proxy", "NO_PROXY", "no_proxy"} {
+		t.Setenv(key, "")
+	}
+}
+
+func proxyFor(t *testing.T, transport *http.Transport, target string) string {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	proxyURL, err := transport.Proxy(req)
+	if err != nil {
+		t.Fatalf("proxy func: %v", err)
+	}
+	if proxyURL == nil {
+		return ""
+	}
+	return proxyURL.String()
+}
+
+func TestConfigureProxySOCKS5WithNoProxyForAssetHosts(t *testing.T) {
+	clearProxyEnv(t)
+	transport := configureProxy("socks5://127.0.0.1:1080", "img.example.com,.cdn.example.com")
+	if transport == nil {
+		t.Fatal("expected proxy transport")
+	}
+
+	if got := proxyFor(t, transport, "https://south-plus.net/read.php?tid-1.html"); got != "socks5://127.0.0.1:1080" {
+		t.Fatalf("forum request proxy = %q", got)
+	}
+	for _, asset := range []string{"https://img.example.com/a.jpg", "https://s1.cdn.example.com/b.png"} {
+		if got := proxyFor(t, transport, asset); got != "" {
+			t.Fatalf("asset %s should bypass proxy, got %q", asset, got)
+		}
+	}
+}
+
+func TestConfigureProxyFlagOverridesEnvironment(t *testing.T) {
+	clearProxyEnv(t)
+	t.Setenv("ALL_PROXY", "socks5h://10.0.0.1:9050")
+
+	if got := proxyFor(t, configureProxy("", ""), "http://south-plus.net/"); got != "socks5h://10.0.0.1:9050" {
+		t.Fatalf("ALL_PROXY should be used, got %q", got)
+	}
+	if got := proxyFor(t, configureProxy("http://10.0.0.2:8080", ""), "http://south-plus.net/"); got != "http://10.0.0.2:8080" {
+		t.Fatalf("explicit proxy should win, got %q", got)
+	}
+	if transport := configureProxy(ProxyDirect, ""); transport != nil {
+		t.Fatal("direct should disable the environment proxy")
+	}
+}
+
+func TestParseProxyURLRejectsUnsupportedSchemes(t *testing.T) {
+	if _, err := ParseProxyURL("ftp://10.0.0.1:21"); err == nil {
+		t.Fatal("expected error for ftp proxy")
+	}
+	parsed, err := ParseProxyURL("10.0.0.1:8080")
+	if err != nil || parsed.String() != "http://10.0.0.1:8080" {
+		t.Fatalf("bare host:port should default to http, got %v, %v", parsed, err)
+	}
+}
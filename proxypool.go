@@ -0,0 +1,234 @@
+package south2md
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Proxy pool defaults.
+const (
+	DefaultProxyBanTime      = 10 * time.Minute
+	proxyPoolMaxFailures     = 3 // consecutive network errors before a proxy is banned
+	proxyPoolIdleConns       = 10
+	proxyPoolIdleConnTimeout = 90 * time.Second
+)
+
+// pooledProxy is one proxy of a ProxyPool and its health state.
+type pooledProxy struct {
+	url         *url.URL
+	transport   *http.Transport
+	failures    int
+	bannedUntil time.Time
+}
+
+// ProxyPool rotates requests round-robin over a list of proxies. Proxies that
+// answer with a Cloudflare challenge or 403, or fail repeatedly at the
+// network level, are banned for a while and skipped.
+type ProxyPool struct {
+	mu      sync.Mutex
+	proxies []*pooledProxy
+	next    int
+	banTime time.Duration
+	now     func() time.Time
+}
+
+// NewProxyPool creates a pool from proxy URLs (see ParseProxyURL). banTime <= 0
+// uses DefaultProxyBanTime.
+func NewProxyPool(proxyURLs []string, banTime time.Duration) (*ProxyPool, error) {
+	if banTime <= 0 {
+		banTime = DefaultProxyBanTime
+	}
+	pool := &ProxyPool{banTime: banTime, now: time.Now}
+	for _, raw := range proxyURLs {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		parsed, err := ParseProxyURL(raw)
+		if err != nil {
+			return nil, err
+		}
+		pool.proxies = append(pool.proxies, &pooledProxy{
+			url: parsed,
+			transport: &http.Transport{
+				Proxy:               http.ProxyURL(parsed),
+				MaxIdleConns:        proxyPoolIdleConns,
+				MaxIdleConnsPerHost: proxyPoolIdleConns,
+				IdleConnTimeout:     proxyPoolIdleConnTimeout,
+			},
+		})
+	}
+	if len(pool.proxies) == 0 {
+		return nil, NewValidationError("proxy pool is empty")
+	}
+	return pool, nil
+}
+
+// LoadProxyPoolFile reads proxy URLs from path, one per line. Blank lines and
+// lines starting with # are ignored.
+func LoadProxyPoolFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, NewIOError("打开代理列表文件失败", err)
+	}
+	defer f.Close()
+
+	var proxies []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		proxies = append(proxies, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, NewIOError("读取代理列表文件失败", err)
+	}
+	return proxies, nil
+}
+
+// Size returns the number of proxies in the pool.
+func (p *ProxyPool) Size() int {
+	return len(p.proxies)
+}
+
+// Available returns the number of proxies that are not banned.
+func (p *ProxyPool) Available() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	count := 0
+	for _, proxy := range p.proxies {
+		if !now.Before(proxy.bannedUntil) {
+			count++
+		}
+	}
+	return count
+}
+
+// pick returns the next proxy that is not banned, or nil when all are.
+func (p *ProxyPool) pick() *pooledProxy {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	for i := 0; i < len(p.proxies); i++ {
+		proxy := p.proxies[(p.next+i)%len(p.proxies)]
+		if now.Before(proxy.bannedUntil) {
+			continue
+		}
+		p.next = (p.next + i + 1) % len(p.proxies)
+		return proxy
+	}
+	return nil
+}
+
+func (p *ProxyPool) ban(proxy *pooledProxy, reason string) {
+	p.mu.Lock()
+	until := p.now().Add(p.banTime)
+	proxy.bannedUntil = until
+	proxy.failures = 0
+	p.mu.Unlock()
+	slog.Warn("Banned proxy", "proxy", proxy.url.Redacted(), "reason", reason, "until", until.Format(time.TimeOnly))
+}
+
+// recordFailure counts a network error and bans the proxy after
+// proxyPoolMaxFailures consecutive failures.
+func (p *ProxyPool) recordFailure(proxy *pooledProxy, err error) {
+	p.mu.Lock()
+	proxy.failures++
+	failures := proxy.failures
+	p.mu.Unlock()
+	if failures >= proxyPoolMaxFailures {
+		p.ban(proxy, fmt.Sprintf("%d consecutive errors: %v", failures, err))
+	}
+}
+
+func (p *ProxyPool) recordSuccess(proxy *pooledProxy) {
+	p.mu.Lock()
+	proxy.failures = 0
+	p.mu.Unlock()
+}
+
+// Transport returns a RoundTripper that sends each request through the next
+// healthy proxy. Hosts matching noProxy are reached directly via direct.
+// Requests without a body are retried on another proxy when the chosen one
+// gets banned.
+func (p *ProxyPool) Transport(direct http.RoundTripper, noProxy string) http.RoundTripper {
+	if direct == nil {
+		direct = http.DefaultTransport
+	}
+	bypass := (&httpproxy.Config{HTTPProxy: "http://pool", HTTPSProxy: "http://pool", NoProxy: noProxy}).ProxyFunc()
+	return &proxyPoolTransport{pool: p, direct: direct, bypass: bypass}
+}
+
+type proxyPoolTransport struct {
+	pool   *ProxyPool
+	direct http.RoundTripper
+	bypass func(*url.URL) (*url.URL, error)
+}
+
+func (t *proxyPoolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if proxyURL, err := t.bypass(req.URL); err == nil && proxyURL == nil {
+		return t.direct.RoundTrip(req)
+	}
+
+	attempts := 1
+	if req.Body == nil || req.Body == http.NoBody {
+		attempts = t.pool.Size()
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		proxy := t.pool.pick()
+		if proxy == nil {
+			break
+		}
+
+		resp, err := proxy.transport.RoundTrip(req)
+		if err != nil {
+			t.pool.recordFailure(proxy, err)
+			lastErr = err
+			continue
+		}
+		if reason := proxyBanReason(resp); reason != "" {
+			t.pool.ban(proxy, reason)
+			if attempt < attempts-1 {
+				resp.Body.Close()
+				continue
+			}
+			return resp, nil
+		}
+		t.pool.recordSuccess(proxy)
+		return resp, nil
+	}
+
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, NewNetworkError("代理池中没有可用代理", nil)
+}
+
+// proxyBanReason reports why resp should get its proxy banned, or "" when the
+// proxy looks healthy.
+func proxyBanReason(resp *http.Response) string {
+	if strings.EqualFold(resp.Header.Get("Cf-Mitigated"), "challenge") {
+		return "cloudflare challenge"
+	}
+	cloudflare := strings.EqualFold(resp.Header.Get("Server"), "cloudflare")
+	switch {
+	case resp.StatusCode == http.StatusForbidden:
+		return "HTTP 403"
+	case cloudflare && resp.StatusCode == http.StatusServiceUnavailable:
+		return "cloudflare challenge"
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+package south2md
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeProxy is an HTTP proxy that answers every proxied request with status.
+func fakeProxy(t *testing.T, status int, hits *int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		w.WriteHeader(status)
+		io.WriteString(w, r.URL.String())
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestProxyPoolBansForbiddenProxyAndRotates(t *testing.T) {
+	var badHits, goodHits int32
+	bad := fakeProxy(t, http.StatusForbidden, &badHits)
+	good := fakeProxy(t, http.StatusOK, &goodHits)
+
+	pool, err := NewProxyPool([]string{bad.URL, good.URL}, time.Minute)
+	if err != nil {
+		t.Fatalf("NewProxyPool returned error: %v", err)
+	}
+	client := &http.Client{Transport: pool.Transport(nil, "")}
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get("http://forum.example.com/read.php?tid-1.html")
+		if err != nil {
+			t.Fatalf("request %d failed: %v", i, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d status = %d, want 200", i, resp.StatusCode)
+		}
+	}
+	if badHits != 1 || goodHits != 3 {
+		t.Fatalf("hits bad=%d good=%d, want bad=1 good=3", badHits, goodHits)
+	}
+	if pool.Available() != 1 {
+		t.Fatalf("Available() = %d, want 1", pool.Available())
+	}
+}
+
+func TestProxyPoolBanExpires(t *testing.T) {
+	pool, err := NewProxyPool([]string{"http://10.0.0.1:8080"}, time.Minute)
+	if err != nil {
+		t.Fatalf("NewProxyPool returned error: %v", err)
+	}
+	now := time.Now()
+	pool.now = func() time.Time { return now }
+
+	proxy := pool.pick()
+	pool.ban(proxy, "test")
+	if pool.pick() != nil {
+		t.Fatal("banned proxy should not be picked")
+	}
+	now = now.Add(2 * time.Minute)
+	if pool.pick() != proxy {
+		t.Fatal("proxy should be picked again after the ban expires")
+	}
+}
+
+func TestProxyPoolNoProxyHostsGoDirect(t *testing.T) {
+	var proxyHits int32
+	proxy := fakeProxy(t, http.StatusOK, &proxyHits)
+	pool, err := NewProxyPool([]string{proxy.URL}, 0)
+	if err != nil {
+		t.Fatalf("NewProxyPool returned error: %v", err)
+	}
+	var directHits int32
+	direct := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&directHits, 1)
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	})
+	client := &http.Client{Transport: pool.Transport(direct, "img.example.com")}
+
+	for _, target := range []string{"http://img.example.com/a.jpg", "http://forum.example.com/"} {
+		resp, err := client.Get(target)
+		if err != nil {
+			t.Fatalf("get %s: %v", target, err)
+		}
+		resp.Body.Close()
+	}
+	if directHits != 1 || proxyHits != 1 {
+		t.Fatalf("hits direct=%d proxy=%d, want 1 each", directHits, proxyHits)
+	}
+}
+
+func TestLoadProxyPoolFileSkipsComments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxies.txt")
+	content := "# pool\nsocks5://10.0.0.1:1080\n\n  http://10.0.0.2:8080  \n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write proxies: %v", err)
+	}
+	proxies, err := LoadProxyPoolFile(path)
+	if err != nil {
+		t.Fatalf("LoadProxyPoolFile returned error: %v", err)
+	}
+	if len(proxies) != 2 || proxies[0] != "socks5://10.0.0.1:1080" || proxies[1] != "http://10.0.0.2:8080" {
+		t.Fatalf("unexpected proxies: %v", proxies)
+	}
+}
@@ -0,0 +1,170 @@
+package south2md
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var rawPageNamePattern = regexp.MustCompile(`^page-(\d+)\.html(\.gz)?$`)
+
+// RawPage is one stored raw HTML snapshot of a thread page.
+type RawPage struct {
+	Page int
+	HTML string
+}
+
+// RawPageDir is the directory under <tid>/ holding raw HTML snapshots.
+const RawPageDir = "raw"
+
+// RawPageHandler receives the raw HTML of every fetched thread page.
+type RawPageHandler func(tid string, page int, html string)
+
+// SetRawPageHandler registers fn to receive each page fetched by
+// FetchPostWithPagination. fn is called from a single goroutine.
+func (f *Fetcher) SetRawPageHandler(fn RawPageHandler) {
+	if f == nil {
+		return
+	}
+	f.rawPageHandler = fn
+}
+
+func (f *Fetcher) handleRawPage(tid string, page int, html string) {
+	if f.rawPageHandler != nil {
+		f.rawPageHandler(tid, page, html)
+	}
+}
+
+// SaveRawPage stores one page's raw HTML as <tid>/raw/page-N.html, or
+// page-N.html.gz when compress is set, replacing the other variant.
+func (ps *PostStore) SaveRawPage(tid string, page int, html string, compress bool) error {
+	if ps == nil {
+		return fmt.Errorf("post store is nil")
+	}
+	if tid == "" {
+		return fmt.Errorf("tid is empty")
+	}
+
+	base := filepath.Join(ps.PostDir(tid), RawPageDir, fmt.Sprintf("page-%d.html", page))
+	data := []byte(html)
+	target, stale := base, base+".gz"
+	if compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return fmt.Errorf("failed to compress raw page: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("failed to compress raw page: %w", err)
+		}
+		data = buf.Bytes()
+		target, stale = base+".gz", base
+	}
+
+	if err := writeFileAtomic(target, data); err != nil {
+		return fmt.Errorf("failed to save raw page %d: %w", page, err)
+	}
+	if err := os.Remove(stale); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale raw page: %w", err)
+	}
+	return nil
+}
+
+// LoadRawPages returns the raw HTML snapshots stored for tid, ordered by
+// page. It returns no pages (and no error) when none were saved.
+func (ps *PostStore) LoadRawPages(tid string) ([]RawPage, error) {
+	if ps == nil {
+		return nil, fmt.Errorf("post store is nil")
+	}
+	if tid == "" {
+		return nil, fmt.Errorf("tid is empty")
+	}
+
+	dir := filepath.Join(ps.PostDir(tid), RawPageDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read raw page dir: %w", err)
+	}
+
+	var pages []RawPage
+	for _, entry := range entries {
+		m := rawPageNamePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+		page, _ := strconv.Atoi(m[1])
+		html, err := readRawPage(filepath.Join(dir, entry.Name()), m[2] != "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read raw page %d: %w", page, err)
+		}
+		pages = append(pages, RawPage{Page: page, HTML: html})
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Page < pages[j].Page })
+	return pages, nil
+}
+
+func readRawPage(path string, compressed bool) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if compressed {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return "", err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ExtractPostFromRawPages re-extracts a thread from stored raw pages using
+// this parser's selectors.
+func (p *PostParser) ExtractPostFromRawPages(pages []RawPage) (*Post, error) {
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("没有可用的原始页面")
+	}
+
+	parsers := make([]*PostParser, 0, len(pages))
+	for _, raw := range pages {
+		parser := NewPostParser()
+		parser.selectors = p.selectors
+		parser.SetPage(raw.Page)
+		if err := parser.LoadFromString(raw.HTML); err != nil {
+			return nil, fmt.Errorf("解析第%d页HTML失败: %w", raw.Page, err)
+		}
+		parsers = append(parsers, parser)
+	}
+
+	post, err := p.ExtractPostFromMultiplePages(parsers)
+	if err != nil {
+		return nil, err
+	}
+	post.TotalPages = pages[len(pages)-1].Page
+	for page, i := 1, 0; page <= post.TotalPages; page++ {
+		if i < len(pages) && pages[i].Page == page {
+			i++
+			continue
+		}
+		post.MissingPages = append(post.MissingPages, page)
+	}
+	sort.Ints(post.MissingPages)
+	return post, nil
+}
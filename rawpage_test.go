@@ -0,0 +1,95 @@
+package south2md
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFetchPostWithPaginationSavesRawPages(t *testing.T) {
+	page, err := os.ReadFile("tid-2636739.html")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(page)
+	}))
+	defer srv.Close()
+
+	options := &HTTPOptions{Timeout: 5 * time.Second, MaxConcurrent: 1}
+	fetcher := NewFetcher(srv.Client(), options, srv.URL)
+	store := NewPostStore(t.TempDir())
+	fetcher.SetRawPageHandler(func(tid string, page int, html string) {
+		if err := store.SaveRawPage(tid, page, html, true); err != nil {
+			t.Errorf("SaveRawPage returned error: %v", err)
+		}
+	})
+
+	if _, err := fetcher.FetchPostWithPagination("2636739", NewPostParser()); err != nil {
+		t.Fatalf("FetchPostWithPagination returned error: %v", err)
+	}
+
+	f, err := os.Open(filepath.Join(store.PostDir("2636739"), "raw", "page-1.html.gz"))
+	if err != nil {
+		t.Fatalf("expected gzipped raw page: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil || string(data) != string(page) {
+		t.Fatalf("raw page content mismatch (err=%v)", err)
+	}
+
+	if err := store.SaveRawPage("2636739", 1, "<html></html>", false); err != nil {
+		t.Fatalf("SaveRawPage returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(store.PostDir("2636739"), "raw", "page-1.html.gz")); !os.IsNotExist(err) {
+		t.Fatalf("expected gzipped variant replaced, stat err=%v", err)
+	}
+}
+
+func TestExtractPostFromStoredRawPages(t *testing.T) {
+	page, err := os.ReadFile("tid-2636739.html")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	store := NewPostStore(t.TempDir())
+	if err := store.SaveRawPage("2636739", 1, string(page), true); err != nil {
+		t.Fatalf("SaveRawPage returned error: %v", err)
+	}
+	if err := store.SaveRawPage("2636739", 3, string(page), false); err != nil {
+		t.Fatalf("SaveRawPage returned error: %v", err)
+	}
+
+	pages, err := store.LoadRawPages("2636739")
+	if err != nil {
+		t.Fatalf("LoadRawPages returned error: %v", err)
+	}
+	if len(pages) != 2 || pages[0].Page != 1 || pages[1].Page != 3 || pages[0].HTML != string(page) {
+		t.Fatalf("unexpected raw pages: %d", len(pages))
+	}
+
+	post, err := NewPostParser().ExtractPostFromRawPages(pages)
+	if err != nil {
+		t.Fatalf("ExtractPostFromRawPages returned error: %v", err)
+	}
+	if post.TotalPages != 3 || len(post.MissingPages) != 1 || post.MissingPages[0] != 2 {
+		t.Fatalf("expected page 2 missing of 3, got total=%d missing=%v", post.TotalPages, post.MissingPages)
+	}
+	if post.Replies[len(post.Replies)-1].SourcePage != 3 {
+		t.Fatalf("expected last reply from page 3, got %d", post.Replies[len(post.Replies)-1].SourcePage)
+	}
+
+	none, err := store.LoadRawPages("missing")
+	if err != nil || len(none) != 0 {
+		t.Fatalf("expected no raw pages for unknown tid, got %v (%v)", none, err)
+	}
+}
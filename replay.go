@@ -0,0 +1,109 @@
+package south2md
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FixturePath returns the file under dir that replays the response to
+// rawURL: the host, then the URL path, with "@" and the query appended to
+// the last segment, e.g. "south-plus.net/read.php@tid-2636739.html" for
+// https://south-plus.net/read.php?tid-2636739.html. A path ending in "/"
+// maps to "index.html" in that directory.
+func FixturePath(dir, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("无效的URL %q", rawURL)
+	}
+	name := path.Clean("/" + u.Path)
+	if strings.HasSuffix(u.Path, "/") || name == "/" {
+		name = path.Join(name, "index.html")
+	}
+	if u.RawQuery != "" {
+		name += "@" + u.RawQuery
+	}
+	segments := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = sanitizeFixtureSegment(segment)
+	}
+	return filepath.Join(append([]string{dir, sanitizeFixtureSegment(strings.ToLower(u.Host))}, segments...)...), nil
+}
+
+// sanitizeFixtureSegment replaces characters not allowed in file names on
+// common filesystems.
+func sanitizeFixtureSegment(segment string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		return r
+	}, segment)
+}
+
+// replayTransport answers requests from the fixture files under dir instead
+// of the network; requests without a fixture get a 404. It lets the full
+// fetch, extract and store pipeline run offline in tests and development.
+type replayTransport struct {
+	dir string
+}
+
+func newReplayTransport(dir string) http.RoundTripper {
+	return &replayTransport{dir: dir}
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	file, err := FixturePath(t.dir, req.URL.String())
+	if err != nil {
+		return nil, NewNetworkError("回放请求失败", err)
+	}
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		slog.Warn("No fixture for request, answering 404", "url", req.URL.String(), "fixture", file)
+		return replayResponse(req, http.StatusNotFound, "text/plain; charset=utf-8", []byte("fixture not found\n")), nil
+	}
+	if err != nil {
+		return nil, NewNetworkError("读取回放文件失败", err)
+	}
+
+	// Sniffing recognises pages and images; the extension only helps with
+	// text formats it can't tell apart, such as CSS or JSON.
+	contentType := http.DetectContentType(data)
+	if strings.HasPrefix(contentType, "text/plain") || contentType == "application/octet-stream" {
+		if byExt := mime.TypeByExtension(filepath.Ext(file)); byExt != "" {
+			contentType = byExt
+		}
+	}
+	return replayResponse(req, http.StatusOK, contentType, data), nil
+}
+
+func replayResponse(req *http.Request, status int, contentType string, body []byte) *http.Response {
+	header := make(http.Header)
+	header.Set("Content-Type", contentType)
+	if req.Method == http.MethodHead {
+		body = nil
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,57 @@
+package south2md
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFixturePath(t *testing.T) {
+	cases := map[string]string{
+		"https://south-plus.net/read.php?tid-2636739.html":   "south-plus.net/read.php@tid-2636739.html",
+		"https://South-Plus.net/":                            "south-plus.net/index.html",
+		"https://img.example.com/a/../b/c.jpg?w=1&h=2":       "img.example.com/b/c.jpg@w=1&h=2",
+		"https://south-plus.net/u.php?action-show-uid-1.htm": "south-plus.net/u.php@action-show-uid-1.htm",
+	}
+	for rawURL, want := range cases {
+		got, err := FixturePath("fixtures", rawURL)
+		if err != nil || got != filepath.Join("fixtures", filepath.FromSlash(want)) {
+			t.Errorf("FixturePath(%q) = %q, %v; want %q", rawURL, got, err, want)
+		}
+	}
+}
+
+func TestReplayTransportServesFixtures(t *testing.T) {
+	dir := t.TempDir()
+	fixture, _ := FixturePath(dir, "https://south-plus.net/read.php?tid-1.html")
+	if err := os.MkdirAll(filepath.Dir(fixture), 0o755); err != nil {
+		t.Fatalf("create fixture dir: %v", err)
+	}
+	if err := os.WriteFile(fixture, []byte("<html><body>thread</body></html>"), 0o600); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+
+	client := NewHTTPClient(&HTTPOptions{Timeout: 5 * time.Second, FixturesDir: dir})
+	resp, err := client.Get("https://south-plus.net/read.php?tid-1.html")
+	if err != nil {
+		t.Fatalf("GET fixture: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "<html><body>thread</body></html>" ||
+		resp.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Fatalf("unexpected fixture response %d %q %q", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+
+	resp, err = client.Get("https://south-plus.net/read.php?tid-2.html")
+	if err != nil {
+		t.Fatalf("GET missing fixture: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing fixture, got %d", resp.StatusCode)
+	}
+}
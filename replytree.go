@@ -0,0 +1,162 @@
+package south2md
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+)
+
+// maxReplyDepth caps the nesting of threaded rendering; deeper replies stay
+// at this depth, still right after the floor they answer.
+const maxReplyDepth = 4
+
+// BuildReplyTree links every reply of post to the earlier floor its quote
+// answers: ReplyTo is set to that floor's PostID and the child's PostID is
+// added to the parent's QuotedBy. A quote is matched by the post link phpwind
+// puts in it (pid=… or #…), then by its "引用第N楼" header, then by text
+// similarity. Floors without a quote, or whose quote matches nothing, are
+// roots. Previous links are replaced.
+func BuildReplyTree(post *Post) {
+	floors := postFloors(post)
+	byPostID := make(map[string]int, len(floors))
+	byNumber := make(map[int]int, len(floors))
+	plain := make([]string, len(floors))
+	for i, entry := range floors {
+		entry.ReplyTo, entry.QuotedBy = "", nil
+		if entry.PostID != "" {
+			byPostID[entry.PostID] = i
+		}
+		if n, ok := FloorNumber(floorLabel(i, entry)); ok {
+			byNumber[n] = i
+		}
+	}
+
+	for i, entry := range floors {
+		quotes, rest := splitQuoteNodes(entry.HTMLContent)
+		plain[i] = normalizeQuoteText(rest)
+		if i == 0 || len(quotes) == 0 || entry.PostID == "" {
+			continue
+		}
+		parent := quotedParent(quotes[0], i, byPostID, byNumber, plain)
+		if parent < 0 || floors[parent].PostID == "" {
+			continue
+		}
+		entry.ReplyTo = floors[parent].PostID
+		floors[parent].QuotedBy = append(floors[parent].QuotedBy, entry.PostID)
+	}
+}
+
+// quotedParent returns the index of the earlier floor (before current) quote
+// refers to, or -1.
+func quotedParent(quote *html.Node, current int, byPostID map[string]int, byNumber map[int]int, plain []string) int {
+	for _, a := range htmlquery.Find(quote, "//a[@href]") {
+		if i, ok := byPostID[quotedPostID(htmlquery.SelectAttr(a, "href"))]; ok && i < current {
+			return i
+		}
+	}
+
+	text := htmlquery.InnerText(quote)
+	if m := quotedFloorPattern.FindStringSubmatch(text); len(m) == 2 {
+		if n, err := strconv.Atoi(m[1]); err == nil {
+			if i, ok := byNumber[n]; ok && i < current {
+				return i
+			}
+		}
+	}
+
+	text = quoteHeaderPattern.ReplaceAllString(normalizeQuoteText(text), "")
+	best, bestScore := -1, 0.0
+	for j := 0; j < current; j++ {
+		if score := diceSimilarity(text, plain[j]); score > bestScore {
+			best, bestScore = j, score
+		}
+	}
+	if bestScore < quoteMatchThreshold {
+		return -1
+	}
+	return best
+}
+
+// quotedPostID extracts the post ID a quote link points to: the pid query
+// parameter of job.php?action=topost links, or the fragment of read.php links.
+func quotedPostID(href string) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if pid := u.Query().Get("pid"); pid != "" {
+		return pid
+	}
+	return u.Fragment
+}
+
+// threadEntries reorders entries so every reply directly follows the floor
+// it answers (see BuildReplyTree), depth first, and sets their Depth.
+// Replies whose parent isn't among entries stay roots.
+func threadEntries(post *Post, entries []renderedEntry) []renderedEntry {
+	BuildReplyTree(post)
+	floors := postFloors(post)
+	present := make(map[string]int, len(entries))
+	for i, e := range entries {
+		if e.Index < len(floors) && floors[e.Index].PostID != "" {
+			present[floors[e.Index].PostID] = i
+		}
+	}
+	children := make(map[int][]int, len(entries))
+	var roots []int
+	for i, e := range entries {
+		parent, ok := -1, false
+		if e.Index < len(floors) && floors[e.Index].ReplyTo != "" {
+			parent, ok = present[floors[e.Index].ReplyTo]
+		}
+		if ok && parent < i {
+			children[parent] = append(children[parent], i)
+		} else {
+			roots = append(roots, i)
+		}
+	}
+
+	threaded := make([]renderedEntry, 0, len(entries))
+	var walk func(i, depth int)
+	walk = func(i, depth int) {
+		e := entries[i]
+		e.Depth = min(depth, maxReplyDepth)
+		if e.Index < len(floors) {
+			e.Entry.ReplyTo, e.Entry.QuotedBy = floors[e.Index].ReplyTo, floors[e.Index].QuotedBy
+		}
+		threaded = append(threaded, e)
+		for _, child := range children[i] {
+			walk(child, depth+1)
+		}
+	}
+	for _, root := range roots {
+		walk(root, 0)
+	}
+	return threaded
+}
+
+// arrangeEntries returns entries in the order post.md shows them: threaded
+// when the Threaded option is set, thread order otherwise.
+func (g *MarkdownGenerator) arrangeEntries(post *Post, entries []renderedEntry) []renderedEntry {
+	if !g.formatter.options.Threaded {
+		return entries
+	}
+	return threadEntries(post, entries)
+}
+
+// quoteLines prefixes every line of markdown with prefix, trimmed on blank
+// lines so the blockquote doesn't end with trailing spaces.
+func quoteLines(markdown, prefix string) string {
+	lines := strings.Split(markdown, "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			lines[i] = strings.TrimSpace(prefix)
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
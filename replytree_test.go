@@ -0,0 +1,77 @@
+package south2md_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	main "github.com/fdkevin0/south2md"
+)
+
+func replyTreeTestPost() *main.Post {
+	original := "这次的汉化质量非常高，翻译和嵌字都很用心，感谢各位大佬的付出"
+	return &main.Post{
+		TID:      "100",
+		Title:    "threaded",
+		MainPost: main.PostEntry{Floor: "GF", PostID: "tpc", HTMLContent: "<p>main post</p>"},
+		Replies: []main.PostEntry{
+			{Floor: "B1F", PostID: "201", HTMLContent: original},
+			{Floor: "B2F", PostID: "202", HTMLContent: "<p>unrelated</p>"},
+			{Floor: "B3F", PostID: "203", HTMLContent: `<blockquote class="blockquote">引用第1楼bob于2024-01-01 10:00发表的 :<br>` + original + `</blockquote>by header`},
+			{Floor: "B4F", PostID: "204", HTMLContent: `<blockquote class="blockquote">引用 <a href="job.php?action=topost&amp;tid=100&amp;pid=203">B3F</a><br>by header</blockquote>by link`},
+			{Floor: "B5F", PostID: "205", HTMLContent: `<blockquote class="blockquote">` + original + `</blockquote>by similarity`},
+			{Floor: "B6F", PostID: "206", HTMLContent: `<blockquote class="blockquote">something nobody said</blockquote>orphan`},
+		},
+	}
+}
+
+func TestBuildReplyTree(t *testing.T) {
+	post := replyTreeTestPost()
+	post.Replies[1].ReplyTo = "stale"
+	main.BuildReplyTree(post)
+
+	for i, want := range []string{"", "", "201", "203", "201", ""} {
+		if got := post.Replies[i].ReplyTo; got != want {
+			t.Fatalf("expected %s to reply to %q, got %q", post.Replies[i].Floor, want, got)
+		}
+	}
+	if got := post.Replies[0].QuotedBy; !slices.Equal(got, []string{"203", "205"}) {
+		t.Fatalf("expected B1F to be quoted by B3F and B5F, got %v", got)
+	}
+	if got := post.Replies[2].QuotedBy; !slices.Equal(got, []string{"204"}) {
+		t.Fatalf("expected B3F to be quoted by B4F, got %v", got)
+	}
+}
+
+func TestGenerateMarkdownThreaded(t *testing.T) {
+	g := main.NewMarkdownGenerator(&main.MarkdownOptions{Threaded: true}, nil)
+	g.SetDownloadEnabled(false)
+	md, err := g.GenerateMarkdown(replyTreeTestPost())
+	if err != nil {
+		t.Fatalf("GenerateMarkdown returned error: %v", err)
+	}
+
+	var order []string
+	for _, line := range strings.Split(md, "\n") {
+		if i := strings.Index(line, `<span id="pid`); i >= 0 {
+			order = append(order, strings.TrimSpace(line[:i])+strings.SplitN(line[i+len(`<span id="pid`):], `"`, 2)[0])
+		}
+	}
+	want := []string{"#####tpc", "#####201", "> #####203", "> > #####204", "> #####205", "#####202", "#####206"}
+	if !slices.Equal(order, want) {
+		t.Fatalf("expected replies nested under the floors they quote, got %q in:\n%s", order, md)
+	}
+	if !strings.Contains(md, "> > by link") {
+		t.Fatalf("expected the nested reply's content quoted twice, got:\n%s", md)
+	}
+
+	flat := main.NewMarkdownGenerator(&main.MarkdownOptions{}, nil)
+	flat.SetDownloadEnabled(false)
+	md, err = flat.GenerateMarkdown(replyTreeTestPost())
+	if err != nil {
+		t.Fatalf("GenerateMarkdown returned error: %v", err)
+	}
+	if strings.Contains(md, "> #####") {
+		t.Fatalf("expected flat order without --threaded, got:\n%s", md)
+	}
+}
@@ -0,0 +1,69 @@
+package south2md
+
+import (
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// generatedAt returns the time recorded as the generation time of a
+// document, or the zero time in reproducible mode.
+func (g *MarkdownGenerator) generatedAt() time.Time {
+	if g.formatter.options.Reproducible {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// normalizePost applies reproducible mode to post; it does nothing otherwise.
+func (g *MarkdownGenerator) normalizePost(post *Post) {
+	if g.formatter.options.Reproducible {
+		normalizeReproducible(post)
+	}
+}
+
+// normalizeReproducible replaces the run-dependent parts of post: the parse
+// time becomes the time of the main post, and the records that downloads
+// append in completion order are sorted.
+func normalizeReproducible(post *Post) {
+	post.CreatedAt = post.MainPost.PostTime
+
+	sort.Ints(post.MissingPages)
+	sort.Ints(post.MissingFloors)
+	sort.Strings(post.Tags)
+
+	for i := range post.Images {
+		post.Images[i].Local = filepath.ToSlash(post.Images[i].Local)
+	}
+	sort.SliceStable(post.Images, func(i, j int) bool {
+		a, b := post.Images[i], post.Images[j]
+		if a.URL != b.URL {
+			return a.URL < b.URL
+		}
+		return a.Local < b.Local
+	})
+
+	for i := range post.GofileFiles {
+		file := &post.GofileFiles[i]
+		file.LocalDir = filepath.ToSlash(file.LocalDir)
+		for j := range file.LocalFiles {
+			file.LocalFiles[j] = filepath.ToSlash(file.LocalFiles[j])
+		}
+		sort.Strings(file.LocalFiles)
+		sortManifest(file.Manifest)
+		sortManifest(file.Skipped)
+	}
+	sort.SliceStable(post.GofileFiles, func(i, j int) bool {
+		return post.GofileFiles[i].URL < post.GofileFiles[j].URL
+	})
+
+	sort.SliceStable(post.WaybackSnapshots, func(i, j int) bool {
+		return post.WaybackSnapshots[i].Page < post.WaybackSnapshots[j].Page
+	})
+}
+
+func sortManifest(entries []GofileManifestEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+}
@@ -0,0 +1,56 @@
+package south2md
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReproducibleOutputIsByteIdentical(t *testing.T) {
+	newPost := func() *Post {
+		return &Post{
+			TID:       "100",
+			Title:     "reproducible",
+			CreatedAt: time.Now(),
+			MainPost: PostEntry{
+				Floor:       "GF",
+				PostTime:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				HTMLContent: `<p><img src="https://img.example.com/b.jpg"><img src="https://img.example.com/a.jpg"></p>`,
+			},
+		}
+	}
+	store := func(root string) (string, string) {
+		g := NewMarkdownGenerator(&MarkdownOptions{IncludeImages: true, FrontMatter: true, Reproducible: true}, nil)
+		g.SetHTTPDoer(&stubDoer{body: "image-bytes"})
+		post := newPost()
+		if err := g.ExportPost(post, root); err != nil {
+			t.Fatalf("ExportPost returned error: %v", err)
+		}
+		markdown, err := os.ReadFile(filepath.Join(root, "100", "post.md"))
+		if err != nil {
+			t.Fatalf("read post.md: %v", err)
+		}
+		metadata, err := os.ReadFile(filepath.Join(root, "100", metadataFileName))
+		if err != nil {
+			t.Fatalf("read metadata: %v", err)
+		}
+		return string(markdown), string(metadata)
+	}
+
+	firstMarkdown, firstMetadata := store(t.TempDir())
+	secondMarkdown, secondMetadata := store(t.TempDir())
+	if firstMarkdown != secondMarkdown || firstMetadata != secondMetadata {
+		t.Fatalf("expected identical output, got:\n%s\n---\n%s", firstMarkdown, secondMarkdown)
+	}
+	if strings.Contains(firstMarkdown, "生成时间") {
+		t.Fatalf("expected no generation time, got:\n%s", firstMarkdown)
+	}
+	if !strings.Contains(firstMetadata, "created_at = 2024-01-02T03:04:05Z") {
+		t.Fatalf("expected created_at to be the main post time, got:\n%s", firstMetadata)
+	}
+	if a, b := strings.Index(firstMetadata, `url = "https://img.example.com/a.jpg"`), strings.Index(firstMetadata, `url = "https://img.example.com/b.jpg"`); a < 0 || b < a {
+		t.Fatalf("expected image records sorted by URL, got:\n%s", firstMetadata)
+	}
+}
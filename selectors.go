@@ -0,0 +1,192 @@
+package south2md
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultSelectorProfile is the built-in profile matching south-plus and its
+// north-plus/level-plus mirrors.
+const DefaultSelectorProfile = "south-plus"
+
+// SelectorProfile is a named set of CSS selectors used to extract posts.
+// Empty fields fall back to the default profile, so a custom profile only
+// needs to list the selectors that differ.
+type SelectorProfile struct {
+	Title       string `toml:"title" mapstructure:"title"`               // 帖子标题
+	Forum       string `toml:"forum" mapstructure:"forum"`               // 版块名称
+	PostTable   string `toml:"post_table" mapstructure:"post_table"`     // 每个楼层的表格
+	PostTime    string `toml:"post_time" mapstructure:"post_time"`       // 楼层内的发帖时间
+	PostContent string `toml:"post_content" mapstructure:"post_content"` // 楼层内的正文
+	Attachment  string `toml:"attachment" mapstructure:"attachment"`     // 正文内的附件
+	FloorLabel  string `toml:"floor_label" mapstructure:"floor_label"`   // 楼层内的GF/B<n>F标签
+	LogoutLink  string `toml:"logout_link" mapstructure:"logout_link"`   // 仅登录后出现的退出链接
+	NextPage    string `toml:"next_page" mapstructure:"next_page"`       // 分页栏的“下一页”链接(--pagination=next)
+	ThreadStats string `toml:"thread_stats" mapstructure:"thread_stats"` // 显示浏览数/回复数的元素
+}
+
+// builtinSelectorProfiles are the profiles available without configuration.
+var builtinSelectorProfiles = map[string]SelectorProfile{
+	DefaultSelectorProfile: defaultHTMLSelectors.profile(),
+}
+
+// SelectorProfileNames returns the built-in profile names plus those in custom, sorted.
+func SelectorProfileNames(custom map[string]SelectorProfile) []string {
+	seen := make(map[string]struct{}, len(builtinSelectorProfiles)+len(custom))
+	for name := range builtinSelectorProfiles {
+		seen[name] = struct{}{}
+	}
+	for name := range custom {
+		seen[strings.ToLower(name)] = struct{}{}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveSelectorProfile looks up name among custom and built-in profiles.
+// A custom profile with a built-in name overrides only the fields it sets.
+// An empty name selects DefaultSelectorProfile.
+func ResolveSelectorProfile(name string, custom map[string]SelectorProfile) (SelectorProfile, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = DefaultSelectorProfile
+	}
+
+	resolved := builtinSelectorProfiles[DefaultSelectorProfile]
+	builtin, isBuiltin := builtinSelectorProfiles[name]
+	if isBuiltin {
+		resolved = resolved.merge(builtin)
+	}
+	override, isCustom := lookupSelectorProfile(custom, name)
+	if isCustom {
+		resolved = resolved.merge(override)
+	}
+	if !isBuiltin && !isCustom {
+		return SelectorProfile{}, NewValidationError(fmt.Sprintf("未知的选择器配置 %q (可选: %s)", name, strings.Join(SelectorProfileNames(custom), ", ")))
+	}
+
+	for _, field := range resolved.fields() {
+		if _, err := compileSelector(field.Selector); err != nil {
+			return SelectorProfile{}, NewValidationError(fmt.Sprintf("选择器配置 %q 的 %s 无效: %v", name, field.Name, err))
+		}
+	}
+	return resolved, nil
+}
+
+// lookupSelectorProfile finds name in custom case-insensitively; config
+// loaders may lower-case map keys.
+func lookupSelectorProfile(custom map[string]SelectorProfile, name string) (SelectorProfile, bool) {
+	for key, profile := range custom {
+		if strings.ToLower(key) == name {
+			return profile, true
+		}
+	}
+	return SelectorProfile{}, false
+}
+
+func (sp SelectorProfile) merge(override SelectorProfile) SelectorProfile {
+	pick := func(base, value string) string {
+		if strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+		return base
+	}
+	return SelectorProfile{
+		Title:       pick(sp.Title, override.Title),
+		Forum:       pick(sp.Forum, override.Forum),
+		PostTable:   pick(sp.PostTable, override.PostTable),
+		PostTime:    pick(sp.PostTime, override.PostTime),
+		PostContent: pick(sp.PostContent, override.PostContent),
+		Attachment:  pick(sp.Attachment, override.Attachment),
+		FloorLabel:  pick(sp.FloorLabel, override.FloorLabel),
+		LogoutLink:  pick(sp.LogoutLink, override.LogoutLink),
+		NextPage:    pick(sp.NextPage, override.NextPage),
+		ThreadStats: pick(sp.ThreadStats, override.ThreadStats),
+	}
+}
+
+// SelectorField is one named selector of a profile.
+type SelectorField struct {
+	Name     string
+	Selector string
+}
+
+// fields lists the profile's selectors under their config key names.
+func (sp SelectorProfile) fields() []SelectorField {
+	return []SelectorField{
+		{"title", sp.Title},
+		{"forum", sp.Forum},
+		{"post_table", sp.PostTable},
+		{"post_time", sp.PostTime},
+		{"post_content", sp.PostContent},
+		{"attachment", sp.Attachment},
+		{"floor_label", sp.FloorLabel},
+		{"logout_link", sp.LogoutLink},
+		{"next_page", sp.NextPage},
+		{"thread_stats", sp.ThreadStats},
+	}
+}
+
+func (s htmlSelectors) profile() SelectorProfile {
+	return SelectorProfile{
+		Title:       s.title,
+		Forum:       s.forum,
+		PostTable:   s.postTable,
+		PostTime:    s.postTime,
+		PostContent: s.postContent,
+		Attachment:  s.attachment,
+		FloorLabel:  s.floorLabel,
+		LogoutLink:  s.logoutLink,
+		NextPage:    s.nextPage,
+		ThreadStats: s.threadStats,
+	}
+}
+
+// SetSelectorProfile makes the parser extract with profile's selectors.
+// Empty fields keep the default selectors.
+func (p *PostParser) SetSelectorProfile(profile SelectorProfile) {
+	merged := defaultHTMLSelectors.profile().merge(profile)
+	p.selectors = htmlSelectors{
+		title:       merged.Title,
+		forum:       merged.Forum,
+		postTable:   merged.PostTable,
+		postTime:    merged.PostTime,
+		postContent: merged.PostContent,
+		attachment:  merged.Attachment,
+		floorLabel:  merged.FloorLabel,
+		logoutLink:  merged.LogoutLink,
+		nextPage:    merged.NextPage,
+		threadStats: merged.ThreadStats,
+	}
+}
+
+// SelectorMatch reports how many nodes one selector matched in a document.
+// Selectors scoped to a post (time, content, ...) are counted inside the
+// matched post tables.
+type SelectorMatch struct {
+	SelectorField
+	Count int
+}
+
+// TestSelectors runs every selector of the parser's profile against the
+// loaded document.
+func (p *PostParser) TestSelectors() []SelectorMatch {
+	tables := p.FindElements(p.selectors.postTable)
+	matches := make([]SelectorMatch, 0, 10)
+	for _, field := range p.selectors.profile().fields() {
+		match := SelectorMatch{SelectorField: field}
+		switch field.Name {
+		case "title", "forum", "post_table", "logout_link", "next_page", "thread_stats":
+			match.Count = p.FindElements(field.Selector).Length()
+		default:
+			match.Count = tables.Find(field.Selector).Length()
+		}
+		matches = append(matches, match)
+	}
+	return matches
+}
@@ -0,0 +1,46 @@
+package south2md
+
+import "testing"
+
+func TestResolveSelectorProfileMergesCustomOverrides(t *testing.T) {
+	custom := map[string]SelectorProfile{
+		"Custom": {PostTime: ".post-date"},
+	}
+
+	profile, err := ResolveSelectorProfile("custom", custom)
+	if err != nil {
+		t.Fatalf("ResolveSelectorProfile returned error: %v", err)
+	}
+	if profile.PostTime != ".post-date" {
+		t.Fatalf("expected overridden post_time, got %q", profile.PostTime)
+	}
+	if profile.PostTable != defaultHTMLSelectors.postTable {
+		t.Fatalf("expected default post_table, got %q", profile.PostTable)
+	}
+
+	if _, err := ResolveSelectorProfile("missing", custom); err == nil {
+		t.Fatal("expected error for unknown profile")
+	}
+	if _, err := ResolveSelectorProfile("custom", map[string]SelectorProfile{"custom": {PostTable: "table["}}); err == nil {
+		t.Fatal("expected error for invalid selector")
+	}
+}
+
+func TestTestSelectorsReportsMatchCounts(t *testing.T) {
+	parser := NewPostParser()
+	parser.SetSelectorProfile(SelectorProfile{PostTime: ".post-date"})
+	if err := parser.LoadFromFile("tid-2636739.html"); err != nil {
+		t.Fatalf("LoadFromFile returned error: %v", err)
+	}
+
+	counts := make(map[string]int)
+	for _, match := range parser.TestSelectors() {
+		counts[match.Name] = match.Count
+	}
+	if counts["post_table"] != 5 || counts["post_content"] != 5 {
+		t.Fatalf("expected 5 post tables and contents, got %v", counts)
+	}
+	if counts["post_time"] != 0 {
+		t.Fatalf("expected overridden post_time to match nothing, got %v", counts)
+	}
+}
@@ -0,0 +1,116 @@
+package south2md
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SiteConfig holds the per-forum settings of one [sites.<name>] block.
+// Empty fields keep the top-level value.
+type SiteConfig struct {
+	BaseURL         string   `toml:"base_url" mapstructure:"base_url"`                 // 论坛基础URL
+	CookieFile      string   `toml:"cookie_file" mapstructure:"cookie_file"`           // Cookie文件路径
+	UserAgent       string   `toml:"user_agent" mapstructure:"user_agent"`             // User-Agent
+	SelectorProfile string   `toml:"selector_profile" mapstructure:"selector_profile"` // 使用的选择器配置名
+	Mirrors         []string `toml:"mirrors" mapstructure:"mirrors"`                   // 该站点的镜像基础URL
+	TLSFingerprint  string   `toml:"tls_fingerprint" mapstructure:"tls_fingerprint"`   // 该站点模仿的浏览器TLS指纹
+}
+
+// threadURLPattern matches the TID of a thread URL, e.g. read.php?tid-123.html
+// or read.php?tid=123.
+var threadURLPattern = regexp.MustCompile(`[?&/]tid[-=](\d+)`)
+
+// ParseThreadArg accepts a bare TID or a full thread URL. For a URL it
+// returns the TID and the forum root the thread lives on, e.g.
+// "https://north-plus.net/"; baseURL is "" for a bare TID.
+func ParseThreadArg(arg string) (tid, baseURL string) {
+	arg = strings.TrimSpace(arg)
+	if !strings.Contains(arg, "://") {
+		return arg, ""
+	}
+	u, err := url.Parse(arg)
+	if err != nil || u.Host == "" {
+		return arg, ""
+	}
+	m := threadURLPattern.FindStringSubmatch(u.RequestURI())
+	if m == nil {
+		return arg, ""
+	}
+	return m[1], u.Scheme + "://" + u.Host + "/"
+}
+
+// SiteNames returns the names of the configured sites, sorted.
+func SiteNames(sites map[string]SiteConfig) []string {
+	names := make([]string, 0, len(sites))
+	for name := range sites {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupSite finds site name case-insensitively; config loaders may
+// lower-case map keys.
+func LookupSite(sites map[string]SiteConfig, name string) (SiteConfig, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for key, site := range sites {
+		if strings.ToLower(key) == name {
+			return site, true
+		}
+	}
+	return SiteConfig{}, false
+}
+
+// SiteForURL returns the name of the site whose base_url or one of whose
+// mirrors has the host of baseURL, or "" when none does.
+func SiteForURL(sites map[string]SiteConfig, baseURL string) string {
+	host := urlHost(baseURL)
+	if host == "" {
+		return ""
+	}
+	for _, name := range SiteNames(sites) {
+		site, _ := LookupSite(sites, name)
+		for _, siteURL := range append([]string{site.BaseURL}, site.Mirrors...) {
+			if urlHost(siteURL) == host {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func urlHost(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// ApplySite copies the non-empty settings of site name into c. keep lists
+// the config keys (base_url, cookie_file, user_agent, selector_profile,
+// mirrors, tls_fingerprint) that were set explicitly and must not be overridden.
+func (c *Config) ApplySite(name string, keep map[string]bool) error {
+	site, ok := LookupSite(c.Sites, name)
+	if !ok {
+		return NewValidationError(fmt.Sprintf("未知的站点配置 %q (可选: %s)", name, strings.Join(SiteNames(c.Sites), ", ")))
+	}
+	set := func(key string, dst *string, value string) {
+		if value = strings.TrimSpace(value); value != "" && !keep[key] {
+			*dst = value
+		}
+	}
+	set("base_url", &c.BaseURL, site.BaseURL)
+	set("cookie_file", &c.HTTPCookieFile, site.CookieFile)
+	set("user_agent", &c.HTTPUserAgent, site.UserAgent)
+	set("selector_profile", &c.SelectorProfile, strings.ToLower(site.SelectorProfile))
+	set("tls_fingerprint", &c.HTTPTLSFingerprint, strings.ToLower(site.TLSFingerprint))
+	if len(site.Mirrors) > 0 && !keep["mirrors"] {
+		c.HTTPMirrors = site.Mirrors
+	}
+	c.Site = strings.ToLower(strings.TrimSpace(name))
+	return nil
+}
@@ -0,0 +1,138 @@
+package south2md
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MarkdownPart is one file of a post split with MarkdownOptions.SplitEvery.
+type MarkdownPart struct {
+	Name    string
+	Content string
+}
+
+// partFilePattern matches the files written for split posts.
+const partFilePattern = "post-[0-9][0-9][0-9]*.md"
+
+func partFileName(i int) string {
+	return fmt.Sprintf("post-%03d.md", i+1)
+}
+
+// GenerateMarkdownParts renders post for post.md. When SplitEvery is set and
+// the thread has more floors than that, the floors are written to
+// post-001.md, post-002.md, ... with navigation links, and the returned index
+// lists the parts. Otherwise index is the full document and parts is nil.
+func (g *MarkdownGenerator) GenerateMarkdownParts(post *Post) (string, []MarkdownPart, error) {
+	entries, err := g.renderEntries(post)
+	if err != nil {
+		return "", nil, err
+	}
+	entries = g.arrangeEntries(post, entries)
+
+	every := g.formatter.options.SplitEvery
+	if every <= 0 || len(entries) <= every {
+		doc, err := g.newTemplateDocument(post, entries, true)
+		if err != nil {
+			return "", nil, err
+		}
+		markdown, err := g.formatter.FormatDocument(doc)
+		return markdown, nil, err
+	}
+
+	count := (len(entries) + every - 1) / every
+	parts := make([]MarkdownPart, 0, count)
+	for i := 0; i < count; i++ {
+		chunk := entries[i*every : min((i+1)*every, len(entries))]
+		doc, err := g.newTemplateDocument(post, chunk, false)
+		if err != nil {
+			return "", nil, err
+		}
+		body, err := g.formatter.FormatDocument(doc)
+		if err != nil {
+			return "", nil, err
+		}
+		nav := partNavigation(i, count)
+		parts = append(parts, MarkdownPart{
+			Name:    partFileName(i),
+			Content: nav + "\n\n" + body + "\n" + nav + "\n",
+		})
+	}
+
+	index, err := g.formatPartsIndex(post, entries, every)
+	if err != nil {
+		return "", nil, err
+	}
+	return index, parts, nil
+}
+
+// formatPartsIndex renders the post.md master index of a split post.
+func (g *MarkdownGenerator) formatPartsIndex(post *Post, entries []renderedEntry, every int) (string, error) {
+	var md strings.Builder
+	if g.formatter.options.FrontMatter {
+		frontMatter, err := formatYAMLFrontMatter(newPostFrontMatter(post, len(entries)))
+		if err != nil {
+			return "", err
+		}
+		md.WriteString(frontMatter)
+		md.WriteString("\n")
+	}
+	md.WriteString(g.formatter.FormatTitle(post.Title))
+
+	count := (len(entries) + every - 1) / every
+	fmt.Fprintf(&md, "本帖共 %d 层，分为 %d 个部分：\n\n", len(entries), count)
+	for i := 0; i < count; i++ {
+		first := entries[i*every]
+		last := entries[min((i+1)*every, len(entries))-1]
+		fmt.Fprintf(&md, "- [第 %d 部分](%s)：%s – %s\n", i+1, partFileName(i), first.Floor, last.Floor)
+	}
+	md.WriteString("\n")
+
+	floors := make([]TemplateFloor, len(entries))
+	parts := make(map[string]int, len(entries))
+	for i, e := range entries {
+		floors[i] = TemplateFloor{Post: post, Entry: e.Entry, Index: e.Index, Floor: e.Floor}
+		parts[e.Entry.PostID] = i / every
+	}
+	partLink := func(floor TemplateFloor) string {
+		return partFileName(parts[floor.Entry.PostID]) + "#pid" + floor.Entry.PostID
+	}
+	if stats := g.formatter.formatAuthorStats(floors, partLink); stats != "" {
+		md.WriteString(stats)
+		md.WriteString("\n")
+	}
+	if mentions := g.formatter.formatMentionIndex(floors, partLink); mentions != "" {
+		md.WriteString(mentions)
+		md.WriteString("\n")
+	}
+	md.WriteString(g.formatter.FormatFooter())
+	return md.String(), nil
+}
+
+func partNavigation(i, count int) string {
+	links := make([]string, 0, 3)
+	if i > 0 {
+		links = append(links, fmt.Sprintf("[« 上一部分](%s)", partFileName(i-1)))
+	}
+	links = append(links, fmt.Sprintf("[索引 (%d/%d)](post.md)", i+1, count))
+	if i < count-1 {
+		links = append(links, fmt.Sprintf("[下一部分 »](%s)", partFileName(i+1)))
+	}
+	return strings.Join(links, " · ")
+}
+
+// removeStaleParts deletes part files from a previous split export so a
+// re-export with fewer (or no) parts leaves no orphans behind.
+func removeStaleParts(tidDir string) error {
+	stale, err := filepath.Glob(filepath.Join(tidDir, partFilePattern))
+	if err != nil {
+		return fmt.Errorf("failed to list part files: %w", err)
+	}
+	for _, path := range stale {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove stale part %s: %w", path, err)
+		}
+	}
+	return nil
+}
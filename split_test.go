@@ -0,0 +1,70 @@
+package south2md_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	main "github.com/fdkevin0/south2md"
+)
+
+func TestExportPostSplitsIntoParts(t *testing.T) {
+	post := &main.Post{
+		TID:      "100",
+		Title:    "split",
+		MainPost: main.PostEntry{PostID: "tpc", HTMLContent: "<p>main</p>"},
+	}
+	for _, floor := range []string{"B1F", "B2F", "B3F", "B4F"} {
+		post.Replies = append(post.Replies, main.PostEntry{Floor: floor, PostID: floor, HTMLContent: "<p>" + floor + "</p>"})
+	}
+
+	baseDir := t.TempDir()
+	g := main.NewMarkdownGenerator(&main.MarkdownOptions{SplitEvery: 2}, nil)
+	g.SetDownloadEnabled(false)
+	if err := g.ExportPost(post, baseDir); err != nil {
+		t.Fatalf("ExportPost returned error: %v", err)
+	}
+
+	tidDir := filepath.Join(baseDir, "100")
+	index, err := os.ReadFile(filepath.Join(tidDir, "post.md"))
+	if err != nil {
+		t.Fatalf("read index: %v", err)
+	}
+	for _, want := range []string{
+		"- [第 1 部分](post-001.md)：0 – B1F",
+		"- [第 3 部分](post-003.md)：B4F – B4F",
+	} {
+		if !strings.Contains(string(index), want) {
+			t.Fatalf("expected %q in index:\n%s", want, index)
+		}
+	}
+
+	second, err := os.ReadFile(filepath.Join(tidDir, "post-002.md"))
+	if err != nil {
+		t.Fatalf("read part: %v", err)
+	}
+	part := string(second)
+	if !strings.HasPrefix(part, "[« 上一部分](post-001.md) · [索引 (2/3)](post.md) · [下一部分 »](post-003.md)\n") {
+		t.Fatalf("unexpected navigation:\n%s", part)
+	}
+	if !strings.Contains(part, "B2F") || !strings.Contains(part, "B3F") || strings.Contains(part, "B4F</span>") {
+		t.Fatalf("unexpected part floors:\n%s", part)
+	}
+	if strings.Join(post.Parts, ",") != "post-001.md,post-002.md,post-003.md" {
+		t.Fatalf("unexpected parts in metadata: %v", post.Parts)
+	}
+
+	// Re-exporting without splitting must drop the old parts.
+	g = main.NewMarkdownGenerator(&main.MarkdownOptions{}, nil)
+	g.SetDownloadEnabled(false)
+	if err := g.ExportPost(post, baseDir); err != nil {
+		t.Fatalf("ExportPost returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tidDir, "post-001.md")); !os.IsNotExist(err) {
+		t.Fatalf("expected stale part removed, got %v", err)
+	}
+	if len(post.Parts) != 0 {
+		t.Fatalf("expected no parts after unsplit export, got %v", post.Parts)
+	}
+}
@@ -6,13 +6,16 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/BurntSushi/toml"
 )
 
 // PostStore manages local persistence in user data directory.
 type PostStore struct {
-	rootDir string
+	rootDir     string
+	lockWait    time.Duration // see SetLockWait
+	dirTemplate string        // see SetDirTemplate
 }
 
 // NewPostStore creates a post store under the given root directory.
@@ -36,12 +39,14 @@ func (ps *PostStore) EnsureRoot() error {
 	return os.MkdirAll(ps.rootDir, 0755)
 }
 
-// PostDir returns the directory path for one thread id.
+// PostDir returns the directory path for one thread id, which is named after
+// the dir template when the thread was stored with one.
 func (ps *PostStore) PostDir(tid string) string {
-	return filepath.Join(ps.rootDir, tid)
+	return threadDir(ps.rootDir, tid)
 }
 
-// LoadPostFromStore loads metadata.toml from local store by tid.
+// LoadPostFromStore loads metadata.toml from local store by tid and records
+// the access for store gc.
 func (ps *PostStore) LoadPostFromStore(tid string) (*Post, error) {
 	if ps == nil {
 		return nil, fmt.Errorf("post store is nil")
@@ -49,19 +54,45 @@ func (ps *PostStore) LoadPostFromStore(tid string) (*Post, error) {
 	if tid == "" {
 		return nil, fmt.Errorf("tid is empty")
 	}
-	metadataPath := filepath.Join(ps.PostDir(tid), "metadata.toml")
-	data, err := os.ReadFile(metadataPath)
+	post, err := ps.readPost(tid)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read metadata from store: %w", err)
+		return nil, err
+	}
+	ps.touch(tid)
+	return post, nil
+}
+
+func (ps *PostStore) readPost(tid string) (*Post, error) {
+	return LoadPostFile(filepath.Join(ps.PostDir(tid), metadataFileName))
+}
+
+// LoadPostFile decodes a metadata.toml written by the store, e.g. a copy
+// kept as a snapshot of an earlier fetch.
+func LoadPostFile(path string) (*Post, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
 	}
 
 	var post Post
 	if err := toml.Unmarshal(data, &post); err != nil {
-		return nil, fmt.Errorf("failed to decode metadata from store: %w", err)
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
 	}
 	return &post, nil
 }
 
+// writePost replaces metadata.toml of a stored thread with post.
+func (ps *PostStore) writePost(post *Post) error {
+	metadata, err := toml.Marshal(post)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(ps.PostDir(post.TID), metadataFileName), metadata); err != nil {
+		return fmt.Errorf("failed to write metadata to store: %w", err)
+	}
+	return nil
+}
+
 // ExportPost exports one stored post directory to target directory.
 func (ps *PostStore) ExportPost(tid string, targetDir string) (string, error) {
 	if ps == nil {
@@ -85,7 +116,7 @@ func (ps *PostStore) ExportPost(tid string, targetDir string) (string, error) {
 	if err := os.MkdirAll(targetDir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create target dir: %w", err)
 	}
-	dstDir := filepath.Join(targetDir, tid)
+	dstDir := filepath.Join(targetDir, filepath.Base(srcDir))
 	if err := copyDir(srcDir, dstDir); err != nil {
 		return "", err
 	}
@@ -0,0 +1,123 @@
+package south2md
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// IndexDirName holds one file per thread whose directory isn't named after
+// its bare TID. The file is named after the TID and holds the directory name,
+// so threads still resolve by TID.
+const IndexDirName = ".index"
+
+// DefaultDirTemplate names thread directories by their bare TID.
+const DefaultDirTemplate = "{tid}"
+
+// maxDirTitleBytes caps the title part of a templated directory name.
+const maxDirTitleBytes = 80
+
+var dirTemplatePlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// ValidateDirTemplate checks that tmpl only uses the {tid} and {title}
+// placeholders and contains {tid}, which keeps directory names unique.
+func ValidateDirTemplate(tmpl string) error {
+	for _, placeholder := range dirTemplatePlaceholder.FindAllString(tmpl, -1) {
+		if placeholder != "{tid}" && placeholder != "{title}" {
+			return NewValidationError(fmt.Sprintf("目录模板中未知的占位符 %s (可选: {tid}, {title})", placeholder))
+		}
+	}
+	if !strings.Contains(tmpl, "{tid}") {
+		return NewValidationError(fmt.Sprintf("目录模板 %q 必须包含 {tid}", tmpl))
+	}
+	return nil
+}
+
+// ThreadDirName expands the directory template tmpl for a thread and returns
+// the sanitized directory name. Threads without a title fall back to the bare
+// TID.
+func ThreadDirName(tmpl, tid, title string) string {
+	title = strings.TrimSpace(title)
+	if tmpl == "" || (title == "" && strings.Contains(tmpl, "{title}")) {
+		tmpl = DefaultDirTemplate
+	}
+	if len(title) > maxDirTitleBytes {
+		title = title[:maxDirTitleBytes]
+		for !utf8.ValidString(title) {
+			title = title[:len(title)-1]
+		}
+	}
+	return SanitizePathComponent(strings.NewReplacer("{tid}", tid, "{title}", title).Replace(tmpl))
+}
+
+// threadDir returns the directory of thread tid under root, following the
+// index of root when the thread was stored under a templated name.
+func threadDir(root, tid string) string {
+	name := SanitizePathComponent(tid)
+	if data, err := os.ReadFile(filepath.Join(root, IndexDirName, name)); err == nil {
+		if indexed := strings.TrimSpace(string(data)); indexed != "" && indexed == SanitizePathComponent(indexed) {
+			return filepath.Join(root, indexed)
+		}
+	}
+	return filepath.Join(root, name)
+}
+
+// SetDirTemplate names the directories of newly stored threads after tmpl,
+// e.g. "{title}-{tid}"; empty means DefaultDirTemplate. Threads keep the
+// directory they were first given a templated name under; bare TID
+// directories are renamed on their next store write.
+func (ps *PostStore) SetDirTemplate(tmpl string) {
+	if ps == nil {
+		return
+	}
+	ps.dirTemplate = tmpl
+}
+
+// assignDir returns the live directory tid's staging dir is committed to,
+// recording templated names in the index.
+func (ps *PostStore) assignDir(tid, stageDir string) (string, error) {
+	bare := filepath.Join(ps.rootDir, SanitizePathComponent(tid))
+	if live := ps.PostDir(tid); live != bare {
+		return live, nil
+	}
+	if ps.dirTemplate == "" || ps.dirTemplate == DefaultDirTemplate {
+		return bare, nil
+	}
+	post, err := LoadPostFile(filepath.Join(stageDir, metadataFileName))
+	if err != nil {
+		slog.Warn("Failed to read staged metadata, keeping bare thread dir", "tid", tid, "error", err)
+		return bare, nil
+	}
+	name := ThreadDirName(ps.dirTemplate, tid, post.Title)
+	if name == filepath.Base(bare) {
+		return bare, nil
+	}
+
+	if err := writeFileAtomic(filepath.Join(ps.rootDir, IndexDirName, filepath.Base(bare)), []byte(name+"\n")); err != nil {
+		return "", fmt.Errorf("failed to update store index: %w", err)
+	}
+	return filepath.Join(ps.rootDir, name), nil
+}
+
+// indexedDirs maps the templated directory names recorded in the index to
+// their TIDs.
+func (ps *PostStore) indexedDirs() map[string]string {
+	entries, err := os.ReadDir(filepath.Join(ps.rootDir, IndexDirName))
+	if err != nil {
+		return nil
+	}
+	dirs := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
+		}
+		if dir := ps.PostDir(entry.Name()); dir != filepath.Join(ps.rootDir, entry.Name()) {
+			dirs[filepath.Base(dir)] = entry.Name()
+		}
+	}
+	return dirs
+}
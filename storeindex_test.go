@@ -0,0 +1,112 @@
+package south2md
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func storeTestPost(t *testing.T, store *PostStore, tid, title string) {
+	t.Helper()
+	err := store.Transact(tid, func(stageRoot string) error {
+		metadata, err := toml.Marshal(&Post{TID: tid, Title: title})
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(filepath.Join(threadDir(stageRoot, tid), metadataFileName), metadata)
+	})
+	if err != nil {
+		t.Fatalf("Transact returned error: %v", err)
+	}
+}
+
+func TestTransactNamesThreadDirFromTemplate(t *testing.T) {
+	root := t.TempDir()
+	store := NewPostStore(root)
+	store.SetDirTemplate("{title}-{tid}")
+
+	storeTestPost(t, store, "100", "问题: 求助?")
+	want := filepath.Join(root, "问题_ 求助_-100")
+	if got := store.PostDir("100"); got != want {
+		t.Fatalf("PostDir = %q, want %q", got, want)
+	}
+	post, err := store.LoadPostFromStore("100")
+	if err != nil || post.Title != "问题: 求助?" {
+		t.Fatalf("LoadPostFromStore = %+v, %v", post, err)
+	}
+
+	// A retitled thread keeps its directory so links into it stay valid.
+	storeTestPost(t, store, "100", "new title")
+	if got := store.PostDir("100"); got != want {
+		t.Fatalf("expected the directory to stay %q, got %q", want, got)
+	}
+
+	tids, err := store.threadIDs()
+	if err != nil || len(tids) != 1 || tids[0] != "100" {
+		t.Fatalf("threadIDs = %v, %v", tids, err)
+	}
+
+	exported, err := store.ExportPost("100", filepath.Join(t.TempDir(), "out"))
+	if err != nil || filepath.Base(exported) != filepath.Base(want) {
+		t.Fatalf("ExportPost = %q, %v", exported, err)
+	}
+}
+
+func TestTransactRenamesBareThreadDir(t *testing.T) {
+	root := t.TempDir()
+	store := NewPostStore(root)
+	storeTestPost(t, store, "200", "title")
+	if got := store.PostDir("200"); got != filepath.Join(root, "200") {
+		t.Fatalf("expected a bare dir without a template, got %q", got)
+	}
+
+	store.SetDirTemplate("{tid}-{title}")
+	storeTestPost(t, store, "200", "title")
+	if got := store.PostDir("200"); got != filepath.Join(root, "200-title") {
+		t.Fatalf("expected the bare dir to be renamed, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "200")); !os.IsNotExist(err) {
+		t.Fatalf("expected the bare dir to be gone, stat: %v", err)
+	}
+}
+
+func TestAssetRegistryFollowsRenamedThreadDir(t *testing.T) {
+	root := t.TempDir()
+	store := NewPostStore(root)
+	store.SetDirTemplate("{title}-{tid}")
+	storeTestPost(t, store, "300", "pics")
+	if err := os.MkdirAll(filepath.Join(store.PostDir("300"), "images"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(store.PostDir("300"), "images", "a.jpg"), []byte("a"), 0644); err != nil {
+		t.Fatalf("write image: %v", err)
+	}
+
+	registry, err := LoadAssetRegistry(root)
+	if err != nil {
+		t.Fatalf("LoadAssetRegistry: %v", err)
+	}
+	registry.Record(AssetRecord{URL: "https://img.example.com/a.jpg", File: "300/images/a.jpg"})
+	if _, ok := registry.Lookup("https://img.example.com/a.jpg"); !ok {
+		t.Fatal("expected the record to resolve through the store index")
+	}
+}
+
+func TestThreadDirNameAndTemplateValidation(t *testing.T) {
+	if got := ThreadDirName("{title}-{tid}", "1", "  "); got != "1" {
+		t.Fatalf("expected an untitled thread to use its TID, got %q", got)
+	}
+	if got := ThreadDirName("{title}-{tid}", "1", "a/b. "); got != "a_b.-1" {
+		t.Fatalf("expected a sanitized name, got %q", got)
+	}
+	for _, tmpl := range []string{"{title}", "{tid}-{author}"} {
+		if err := ValidateDirTemplate(tmpl); err == nil {
+			t.Fatalf("expected %q to be rejected", tmpl)
+		}
+	}
+	if err := ValidateDirTemplate("{title} [{tid}]"); err != nil {
+		t.Fatalf("ValidateDirTemplate: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package south2md
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LockDirName is the store directory holding per-thread lock files. Locks
+// live outside the thread dirs because Transact renames those.
+const LockDirName = ".locks"
+
+// lockPollInterval is how often a waiting Lock retries.
+const lockPollInterval = 200 * time.Millisecond
+
+// ErrStoreLocked is returned when another process is writing the same thread.
+var ErrStoreLocked = errors.New("post is locked by another south2md process")
+
+// errLockHeld is returned by the platform tryLock when the lock is taken.
+var errLockHeld = errors.New("lock held")
+
+// StoreLock is an exclusive, process-wide lock on one thread of a PostStore.
+// The OS releases it if the process dies.
+type StoreLock struct {
+	file *os.File
+}
+
+// SetLockWait sets how long writers wait for a thread locked by another
+// process: 0 fails fast, a negative value waits indefinitely.
+func (ps *PostStore) SetLockWait(wait time.Duration) {
+	if ps == nil {
+		return
+	}
+	ps.lockWait = wait
+}
+
+// Lock acquires the lock of tid, waiting as configured by SetLockWait. The
+// error wraps ErrStoreLocked when the lock could not be taken in time.
+func (ps *PostStore) Lock(tid string) (*StoreLock, error) {
+	return ps.lock(tid, ps.lockWait)
+}
+
+func (ps *PostStore) lock(tid string, wait time.Duration) (*StoreLock, error) {
+	if tid == "" {
+		return nil, fmt.Errorf("tid is empty")
+	}
+	dir := filepath.Join(ps.rootDir, LockDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock dir: %w", err)
+	}
+	path := filepath.Join(dir, SanitizePathComponent(tid)+".lock")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		err = tryLock(file)
+		if !errors.Is(err, errLockHeld) {
+			break
+		}
+		if wait >= 0 && !time.Now().Before(deadline) {
+			file.Close()
+			return nil, fmt.Errorf("%w: tid %s%s", ErrStoreLocked, tid, lockOwner(path))
+		}
+		time.Sleep(lockPollInterval)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", tid, err)
+	}
+
+	// Record the owner for the error message other processes show.
+	if err := file.Truncate(0); err == nil {
+		_, _ = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &StoreLock{file: file}, nil
+}
+
+// Unlock releases the lock. It is safe to call on a nil lock.
+func (l *StoreLock) Unlock() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	err := unlockFile(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	return err
+}
+
+// lockOwner describes the process recorded in the lock file at path.
+func lockOwner(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	if pid := strings.TrimSpace(string(data)); pid != "" {
+		return " (pid " + pid + ")"
+	}
+	return ""
+}
@@ -0,0 +1,10 @@
+//go:build !unix && !windows
+
+package south2md
+
+import "os"
+
+// Platforms without file locking run unlocked.
+func tryLock(file *os.File) error { return nil }
+
+func unlockFile(file *os.File) error { return nil }
@@ -0,0 +1,56 @@
+package south2md
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStoreLockFailsFastWhenHeld(t *testing.T) {
+	store := NewPostStore(t.TempDir())
+	held, err := store.Lock("100")
+	if err != nil {
+		t.Fatalf("Lock returned error: %v", err)
+	}
+
+	err = store.Transact("100", func(string) error {
+		t.Fatal("fn must not run while another writer holds the lock")
+		return nil
+	})
+	if !errors.Is(err, ErrStoreLocked) {
+		t.Fatalf("expected ErrStoreLocked, got %v", err)
+	}
+
+	other, err := store.Lock("200")
+	if err != nil {
+		t.Fatalf("locks of other threads must be independent: %v", err)
+	}
+	other.Unlock()
+
+	if err := held.Unlock(); err != nil {
+		t.Fatalf("Unlock returned error: %v", err)
+	}
+	if err := store.Transact("100", func(string) error { return nil }); err != nil {
+		t.Fatalf("Transact after unlock returned error: %v", err)
+	}
+}
+
+func TestStoreLockQueuesWithinWait(t *testing.T) {
+	store := NewPostStore(t.TempDir())
+	store.SetLockWait(5 * time.Second)
+	held, err := store.Lock("100")
+	if err != nil {
+		t.Fatalf("Lock returned error: %v", err)
+	}
+	time.AfterFunc(300*time.Millisecond, func() { held.Unlock() })
+
+	start := time.Now()
+	lock, err := store.Lock("100")
+	if err != nil {
+		t.Fatalf("expected queued Lock to succeed, got %v", err)
+	}
+	defer lock.Unlock()
+	if waited := time.Since(start); waited < 200*time.Millisecond {
+		t.Fatalf("expected Lock to wait for the holder, waited %s", waited)
+	}
+}
@@ -0,0 +1,281 @@
+package south2md
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Store directories that hold in-progress writes. Their leading dot keeps
+// them apart from thread directories.
+const (
+	StagingDirName = ".staging"
+	JournalDirName = ".journal"
+)
+
+// Journal states of a store transaction.
+const (
+	JournalStaging    = "staging"    // assets and metadata are being written to the staging dir
+	JournalCommitting = "committing" // the staging dir is being renamed into place
+)
+
+// JournalEntry records a store write that has started but not committed.
+// An entry left behind marks an interrupted run.
+type JournalEntry struct {
+	TID       string    `json:"tid"`
+	State     string    `json:"state"`
+	StartedAt time.Time `json:"started_at"`
+	PID       int       `json:"pid"`
+}
+
+// Transact runs fn against a staging copy of tid's directory and atomically
+// renames it into place when fn succeeds, so the live directory only ever
+// holds complete archives. fn writes under stageRoot exactly as it would
+// under RootDir(), i.e. into stageRoot/<tid>.
+//
+// The staging copy hard-links existing files, so fn must replace files
+// (write a temp file and rename) rather than rewrite them in place. When fn
+// fails or the process dies, the staging dir and a journal entry stay behind;
+// the next Transact for tid resumes from them, keeping assets downloaded so far.
+//
+// Transact holds tid's lock throughout, so concurrent writers of the same
+// thread queue or fail fast (see SetLockWait).
+func (ps *PostStore) Transact(tid string, fn func(stageRoot string) error) (err error) {
+	if err := ps.EnsureRoot(); err != nil {
+		return err
+	}
+	lock, err := ps.Lock(tid)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if unlockErr := lock.Unlock(); err == nil {
+			err = unlockErr
+		}
+	}()
+
+	stageRoot := filepath.Join(ps.rootDir, StagingDirName)
+	stageDir := threadDir(stageRoot, tid)
+	liveDir := ps.PostDir(tid)
+
+	entry, err := ps.readJournal(tid)
+	if err != nil {
+		return err
+	}
+	if entry != nil {
+		if err := ps.recover(*entry); err != nil {
+			return err
+		}
+		slog.Warn("Resuming interrupted store write", "tid", tid, "state", entry.State, "started_at", entry.StartedAt)
+	} else if err := os.RemoveAll(stageDir); err != nil {
+		return fmt.Errorf("failed to clear staging dir: %w", err)
+	}
+
+	if err := linkTree(liveDir, stageDir); err != nil {
+		return fmt.Errorf("failed to prepare staging dir: %w", err)
+	}
+	started := JournalEntry{TID: tid, State: JournalStaging, StartedAt: time.Now(), PID: os.Getpid()}
+	if entry != nil {
+		started.StartedAt = entry.StartedAt
+	}
+	if err := ps.writeJournal(started); err != nil {
+		return err
+	}
+
+	if err := fn(stageRoot); err != nil {
+		return err
+	}
+
+	started.State = JournalCommitting
+	if err := ps.writeJournal(started); err != nil {
+		return err
+	}
+	if err := ps.commit(tid); err != nil {
+		return err
+	}
+	if err := ps.removeJournal(tid); err != nil {
+		return err
+	}
+	return ps.refreshCatalog(tid)
+}
+
+// commit swaps the staging dir of tid with its live dir, moving the thread to
+// its templated name when it has none yet.
+func (ps *PostStore) commit(tid string) error {
+	stageDir := threadDir(filepath.Join(ps.rootDir, StagingDirName), tid)
+	oldDir := stageDir + ".old"
+	liveDir := ps.PostDir(tid)
+	target, err := ps.assignDir(tid, stageDir)
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(oldDir); err != nil {
+		return fmt.Errorf("failed to clear previous version: %w", err)
+	}
+	if _, err := os.Stat(liveDir); err == nil {
+		if err := os.Rename(liveDir, oldDir); err != nil {
+			return fmt.Errorf("failed to move previous version aside: %w", err)
+		}
+	}
+	if err := os.Rename(stageDir, target); err != nil {
+		if _, statErr := os.Stat(oldDir); statErr == nil {
+			_ = os.Rename(oldDir, target)
+		}
+		return fmt.Errorf("failed to commit post directory: %w", err)
+	}
+	if err := os.RemoveAll(oldDir); err != nil {
+		slog.Warn("Failed to remove previous post version", "path", oldDir, "error", err)
+	}
+	return nil
+}
+
+// recover repairs a commit that was interrupted between its two renames by
+// restoring the previous live dir.
+func (ps *PostStore) recover(entry JournalEntry) error {
+	if entry.State != JournalCommitting {
+		return nil
+	}
+	stageDir := threadDir(filepath.Join(ps.rootDir, StagingDirName), entry.TID)
+	oldDir := stageDir + ".old"
+	liveDir := ps.PostDir(entry.TID)
+	if _, err := os.Stat(liveDir); errors.Is(err, os.ErrNotExist) {
+		if _, err := os.Stat(oldDir); err == nil {
+			if err := os.Rename(oldDir, liveDir); err != nil {
+				return fmt.Errorf("failed to restore previous version: %w", err)
+			}
+		}
+	}
+	if err := os.RemoveAll(oldDir); err != nil {
+		return fmt.Errorf("failed to clear previous version: %w", err)
+	}
+	return nil
+}
+
+// Interrupted lists the store writes that started but never committed.
+// Threads currently being written by a live process are not included.
+func (ps *PostStore) Interrupted() ([]JournalEntry, error) {
+	entries, err := os.ReadDir(filepath.Join(ps.rootDir, JournalDirName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	var interrupted []JournalEntry
+	for _, e := range entries {
+		tid, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() {
+			continue
+		}
+		entry, err := ps.readJournal(tid)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+		lock, err := ps.lock(tid, 0)
+		if errors.Is(err, ErrStoreLocked) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		lock.Unlock()
+		interrupted = append(interrupted, *entry)
+	}
+	sort.Slice(interrupted, func(i, j int) bool { return interrupted[i].TID < interrupted[j].TID })
+	return interrupted, nil
+}
+
+func (ps *PostStore) journalPath(tid string) string {
+	return filepath.Join(ps.rootDir, JournalDirName, SanitizePathComponent(tid)+".json")
+}
+
+// readJournal returns tid's journal entry, or nil when there is none.
+func (ps *PostStore) readJournal(tid string) (*JournalEntry, error) {
+	data, err := os.ReadFile(ps.journalPath(tid))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal entry: %w", err)
+	}
+	var entry JournalEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to decode journal entry %s: %w", tid, err)
+	}
+	return &entry, nil
+}
+
+func (ps *PostStore) writeJournal(entry JournalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+	if err := writeFileAtomic(ps.journalPath(entry.TID), data); err != nil {
+		return fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	return nil
+}
+
+func (ps *PostStore) removeJournal(tid string) error {
+	if err := os.Remove(ps.journalPath(tid)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove journal entry: %w", err)
+	}
+	return nil
+}
+
+// detachFile replaces path with a copy of itself, so appending to it can't
+// reach a live file it is hard-linked to (see Transact).
+func detachFile(path string) error {
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := copyFile(path, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// linkTree mirrors srcDir into dstDir with hard links (copies across
+// filesystems). Files already in dstDir are kept. A missing srcDir just
+// creates dstDir.
+func linkTree(srcDir, dstDir string) error {
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(srcDir); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dstDir, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if _, err := os.Lstat(target); err == nil {
+			return nil
+		}
+		if err := os.Link(path, target); err == nil {
+			return nil
+		}
+		return copyFile(path, target)
+	})
+}
@@ -0,0 +1,182 @@
+package south2md
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestTransactCommitsStagedDirectory(t *testing.T) {
+	store := NewPostStore(t.TempDir())
+	liveDir := store.PostDir("100")
+	if err := os.MkdirAll(filepath.Join(liveDir, "images"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(liveDir, "metadata.toml"), []byte("old"), 0644); err != nil {
+		t.Fatalf("write metadata: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(liveDir, "images", "a.jpg"), []byte("a"), 0644); err != nil {
+		t.Fatalf("write image: %v", err)
+	}
+
+	err := store.Transact("100", func(stageRoot string) error {
+		stageDir := filepath.Join(stageRoot, "100")
+		if got := readTestFile(t, filepath.Join(stageDir, "images", "a.jpg")); got != "a" {
+			t.Fatalf("staging dir should start from the live files, got %q", got)
+		}
+		if err := writeFileAtomic(filepath.Join(stageDir, "metadata.toml"), []byte("new")); err != nil {
+			return err
+		}
+		if got := readTestFile(t, filepath.Join(liveDir, "metadata.toml")); got != "old" {
+			t.Fatalf("live dir must not change before commit, got %q", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transact returned error: %v", err)
+	}
+
+	if got := readTestFile(t, filepath.Join(liveDir, "metadata.toml")); got != "new" {
+		t.Fatalf("expected committed metadata, got %q", got)
+	}
+	if got := readTestFile(t, filepath.Join(liveDir, "images", "a.jpg")); got != "a" {
+		t.Fatalf("expected image to survive commit, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(store.RootDir(), StagingDirName, "100")); !os.IsNotExist(err) {
+		t.Fatalf("expected staging dir to be gone, stat: %v", err)
+	}
+	if interrupted, err := store.Interrupted(); err != nil || len(interrupted) != 0 {
+		t.Fatalf("expected no interrupted writes, got %v, %v", interrupted, err)
+	}
+}
+
+func TestTransactFailureIsDetectableAndResumable(t *testing.T) {
+	store := NewPostStore(t.TempDir())
+
+	err := store.Transact("100", func(stageRoot string) error {
+		if err := writeFileAtomic(filepath.Join(stageRoot, "100", "images", "a.jpg"), []byte("a")); err != nil {
+			return err
+		}
+		return errors.New("network down")
+	})
+	if err == nil {
+		t.Fatal("expected fn error to be returned")
+	}
+	if _, err := os.Stat(store.PostDir("100")); !os.IsNotExist(err) {
+		t.Fatalf("failed write must not create the live dir, stat: %v", err)
+	}
+	interrupted, err := store.Interrupted()
+	if err != nil || len(interrupted) != 1 || interrupted[0].TID != "100" || interrupted[0].State != JournalStaging {
+		t.Fatalf("expected one interrupted staging write, got %+v, %v", interrupted, err)
+	}
+
+	err = store.Transact("100", func(stageRoot string) error {
+		if got := readTestFile(t, filepath.Join(stageRoot, "100", "images", "a.jpg")); got != "a" {
+			t.Fatalf("expected resumed staging dir to keep downloaded assets, got %q", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transact returned error: %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(store.PostDir("100"), "images", "a.jpg")); got != "a" {
+		t.Fatalf("expected resumed asset in live dir, got %q", got)
+	}
+	if interrupted, _ := store.Interrupted(); len(interrupted) != 0 {
+		t.Fatalf("expected journal to be cleared, got %+v", interrupted)
+	}
+}
+
+func TestTransactRecoversInterruptedCommit(t *testing.T) {
+	store := NewPostStore(t.TempDir())
+	oldDir := filepath.Join(store.RootDir(), StagingDirName, "100.old")
+	if err := writeFileAtomic(filepath.Join(oldDir, "metadata.toml"), []byte("old")); err != nil {
+		t.Fatalf("write old metadata: %v", err)
+	}
+	if err := store.writeJournal(JournalEntry{TID: "100", State: JournalCommitting}); err != nil {
+		t.Fatalf("write journal: %v", err)
+	}
+
+	err := store.Transact("100", func(stageRoot string) error {
+		if got := readTestFile(t, filepath.Join(stageRoot, "100", "metadata.toml")); got != "old" {
+			t.Fatalf("expected previous version to be restored, got %q", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transact returned error: %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(store.PostDir("100"), "metadata.toml")); got != "old" {
+		t.Fatalf("unexpected live metadata %q", got)
+	}
+}
+
+func TestTransactUpdatesCatalogAfterCommit(t *testing.T) {
+	store := NewPostStore(t.TempDir())
+	err := store.Transact("100", func(stageRoot string) error {
+		return writeFileAtomic(filepath.Join(stageRoot, "100", "metadata.toml"), []byte("TID = \"100\"\nTitle = \"hello\"\n"))
+	})
+	if err != nil {
+		t.Fatalf("Transact returned error: %v", err)
+	}
+
+	page, _, err := QueryCatalog(store.RootDir(), CatalogQuery{})
+	if err != nil {
+		t.Fatalf("query catalog: %v", err)
+	}
+	if len(page) != 1 || page[0].TID != "100" || page[0].Title != "hello" {
+		t.Fatalf("expected the committed thread in the catalog, got %+v", page)
+	}
+	if _, err := os.Stat(filepath.Join(store.RootDir(), StagingDirName, CatalogFileName)); !os.IsNotExist(err) {
+		t.Fatalf("expected no catalog in the staging root, stat: %v", err)
+	}
+}
+
+func TestTransactExportPostKeepsLiveFilesUntilCommit(t *testing.T) {
+	store := NewPostStore(t.TempDir())
+	liveDir := store.PostDir("100")
+	if err := os.MkdirAll(liveDir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for _, name := range []string{"post.md", metadataFileName} {
+		if err := os.WriteFile(filepath.Join(liveDir, name), []byte("old"), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	post := &Post{
+		TID:      "100",
+		Title:    "staged",
+		MainPost: PostEntry{PostID: "tpc", HTMLContent: "<p>main</p>"},
+	}
+	g := NewMarkdownGenerator(&MarkdownOptions{}, nil)
+	g.SetDownloadEnabled(false)
+	err := store.Transact("100", func(stageRoot string) error {
+		if err := g.ExportPost(post, stageRoot); err != nil {
+			return err
+		}
+		for _, name := range []string{"post.md", metadataFileName} {
+			if got := readTestFile(t, filepath.Join(liveDir, name)); got != "old" {
+				t.Fatalf("live %s must not change before commit, got %q", name, got)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transact returned error: %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(liveDir, "post.md")); !strings.Contains(got, "staged") {
+		t.Fatalf("expected committed post.md, got %q", got)
+	}
+}
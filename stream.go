@@ -0,0 +1,135 @@
+package south2md
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// ExtractFloors parses a thread page from r and calls fn for every floor as
+// soon as its post table has been read. See PostParser.ExtractFloors.
+func ExtractFloors(ctx context.Context, r io.Reader, fn func(PostEntry) error) error {
+	return NewPostParser().ExtractFloors(ctx, r, fn)
+}
+
+// ExtractFloors streams r through an HTML tokenizer and calls fn for every
+// floor in page order, without building the page DOM or a Post, so huge
+// threads can be processed with bounded memory. Only one top-level table is
+// buffered at a time. Floors are labelled like ExtractMainPost/ExtractReplies
+// (GF, B1F, ...). An error returned by fn, or ctx being cancelled, stops
+// extraction and is returned as is.
+func (p *PostParser) ExtractFloors(ctx context.Context, r io.Reader, fn func(PostEntry) error) error {
+	tableSelector, err := compileSelector(p.selectors.postTable)
+	if err != nil {
+		return NewParseError(fmt.Sprintf("无效的选择器: %s", p.selectors.postTable), err)
+	}
+
+	z := html.NewTokenizer(r)
+	var table bytes.Buffer
+	depth, floors := 0, 0
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				break
+			}
+			return NewParseError("解析HTML失败", z.Err())
+		}
+
+		// Raw must be copied before TagName, which lowercases the buffer in place.
+		if depth > 0 {
+			table.Write(z.Raw())
+		}
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			raw := z.Raw()
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "base":
+				if hasAttr && p.baseURL == "" {
+					p.baseURL = baseHref(z)
+				}
+			case "table":
+				if tt != html.StartTagToken {
+					continue
+				}
+				if depth == 0 {
+					table.Reset()
+					table.Write(raw)
+				}
+				depth++
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if string(name) != "table" || depth == 0 {
+				continue
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+
+			entry, ok, err := p.extractStreamedFloor(table.Bytes(), tableSelector, floors)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			floors++
+			if err := fn(*entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	if floors == 0 {
+		return NewValidationError(fmt.Sprintf("未找到帖子表格 (选择器: %s)", p.selectors.postTable))
+	}
+	return nil
+}
+
+// extractStreamedFloor parses one buffered top-level table and extracts the
+// floor if it is a post table. ok is false for unrelated layout tables.
+func (p *PostParser) extractStreamedFloor(raw []byte, tableSelector cascadia.Selector, index int) (*PostEntry, bool, error) {
+	doc, err := html.Parse(bytes.NewReader(raw))
+	if err != nil {
+		return nil, false, NewParseError("解析楼层HTML失败", err)
+	}
+	node := cascadia.Query(doc, tableSelector)
+	if node == nil {
+		return nil, false, nil
+	}
+	entry, err := p.extractPostEntry(&DOMSelection{nodes: []*html.Node{node}}, p.generateFloorNumber(index))
+	if err != nil {
+		return nil, false, err
+	}
+	return entry, true, nil
+}
+
+func baseHref(z *html.Tokenizer) string {
+	for {
+		key, val, more := z.TagAttr()
+		if string(key) == "href" {
+			href := string(val)
+			if len(href) > 1 && href[:2] == "//" {
+				return "https:" + href
+			}
+			return href
+		}
+		if !more {
+			return ""
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package south2md_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	main "github.com/fdkevin0/south2md"
+)
+
+func TestExtractFloorsMatchesExtractPost(t *testing.T) {
+	parser := main.NewPostParser()
+	if err := parser.LoadFromReader(bytes.NewReader(sourcePostHTML)); err != nil {
+		t.Fatalf("load html: %v", err)
+	}
+	post, err := parser.ExtractPost()
+	if err != nil {
+		t.Fatalf("extract post: %v", err)
+	}
+	want := append([]main.PostEntry{post.MainPost}, post.Replies...)
+
+	var got []main.PostEntry
+	err = main.ExtractFloors(context.Background(), bytes.NewReader(sourcePostHTML), func(entry main.PostEntry) error {
+		got = append(got, entry)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ExtractFloors returned error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("streamed floors differ from ExtractPost:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestExtractFloorsStopsOnCallbackError(t *testing.T) {
+	stop := errors.New("stop")
+	calls := 0
+	err := main.ExtractFloors(context.Background(), bytes.NewReader(sourcePostHTML), func(main.PostEntry) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("expected callback error after one floor, got %v after %d calls", err, calls)
+	}
+}
+
+func TestExtractFloorsHonorsCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := main.ExtractFloors(ctx, bytes.NewReader(sourcePostHTML), func(main.PostEntry) error { return nil })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -1 +1,62 @@
 package south2md
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// PolicyDecision records an automatic behavior switch made during a run.
+type PolicyDecision struct {
+	Policy string // Policy identifier, e.g. "external_asset_limit"
+	Scope  string // What the decision applies to, e.g. "gofile"
+	Action string // Resulting behavior, e.g. "manifest_only"
+	Reason string // Human-readable explanation
+}
+
+// RunSummary collects notable decisions made while archiving.
+// It is safe for concurrent use.
+type RunSummary struct {
+	mu        sync.Mutex
+	decisions []PolicyDecision
+}
+
+// NewRunSummary creates an empty run summary.
+func NewRunSummary() *RunSummary {
+	return &RunSummary{}
+}
+
+// RecordDecision appends a policy decision to the summary.
+func (s *RunSummary) RecordDecision(decision PolicyDecision) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.decisions = append(s.decisions, decision)
+}
+
+// Decisions returns a copy of the recorded decisions.
+func (s *RunSummary) Decisions() []PolicyDecision {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]PolicyDecision(nil), s.decisions...)
+}
+
+// String renders the summary as plain text lines for CLI output.
+func (s *RunSummary) String() string {
+	decisions := s.Decisions()
+	if len(decisions) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("Run summary:\n")
+	for _, d := range decisions {
+		fmt.Fprintf(&b, "  - [%s] %s -> %s: %s\n", d.Policy, d.Scope, d.Action, d.Reason)
+	}
+	return b.String()
+}
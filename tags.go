@@ -0,0 +1,122 @@
+package south2md
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NormalizeTag trims tag, lowercases it and collapses inner whitespace, so
+// "ASMR " and "asmr" are the same tag.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(tag), " "))
+}
+
+// MergeTags returns the sorted union of tags and add, normalized and without
+// duplicates or empty tags.
+func MergeTags(tags []string, add ...string) []string {
+	seen := make(map[string]bool, len(tags)+len(add))
+	var merged []string
+	for _, tag := range append(append([]string(nil), tags...), add...) {
+		tag = NormalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		merged = append(merged, tag)
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// RemoveTags returns tags without the ones in remove.
+func RemoveTags(tags []string, remove ...string) []string {
+	drop := make(map[string]bool, len(remove))
+	for _, tag := range remove {
+		drop[NormalizeTag(tag)] = true
+	}
+	var kept []string
+	for _, tag := range tags {
+		if !drop[NormalizeTag(tag)] {
+			kept = append(kept, tag)
+		}
+	}
+	return kept
+}
+
+// HasTags reports whether post carries every tag in filter.
+func (p *Post) HasTags(filter ...string) bool {
+	have := make(map[string]bool, len(p.Tags))
+	for _, tag := range p.Tags {
+		have[NormalizeTag(tag)] = true
+	}
+	for _, tag := range filter {
+		if tag = NormalizeTag(tag); tag != "" && !have[tag] {
+			return false
+		}
+	}
+	return true
+}
+
+// UpdateTags adds and removes tags of a stored thread and returns its new
+// tag list. The thread's lock is held while metadata.toml is rewritten.
+func (ps *PostStore) UpdateTags(tid string, add, remove []string) ([]string, error) {
+	if ps == nil {
+		return nil, fmt.Errorf("post store is nil")
+	}
+	lock, err := ps.Lock(tid)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	post, err := ps.readPost(tid)
+	if err != nil {
+		return nil, err
+	}
+	post.Tags = RemoveTags(MergeTags(post.Tags, add...), remove...)
+	if err := ps.writePost(post); err != nil {
+		return nil, err
+	}
+	if err := UpdateCatalog(ps.rootDir, post); err != nil {
+		return nil, err
+	}
+	return post.Tags, nil
+}
+
+// ListPosts loads every stored thread carrying all tags, ordered by TID.
+// Threads whose metadata can't be read are skipped.
+func (ps *PostStore) ListPosts(tags ...string) ([]*Post, error) {
+	tids, err := ps.threadIDs()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(tids)
+
+	var posts []*Post
+	for _, tid := range tids {
+		post, err := ps.readPost(tid)
+		if err != nil {
+			continue
+		}
+		if post.HasTags(tags...) {
+			posts = append(posts, post)
+		}
+	}
+	return posts, nil
+}
+
+// TagCounts returns how many stored threads carry each tag.
+func (ps *PostStore) TagCounts() (map[string]int, error) {
+	posts, err := ps.ListPosts()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, post := range posts {
+		for _, tag := range post.Tags {
+			counts[tag]++
+		}
+	}
+	return counts, nil
+}
@@ -0,0 +1,106 @@
+package south2md
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestMergeAndRemoveTags(t *testing.T) {
+	tags := MergeTags([]string{"2024"}, " ASMR ", "2024", "", "voice  work")
+	if want := []string{"2024", "asmr", "voice work"}; !reflect.DeepEqual(tags, want) {
+		t.Fatalf("MergeTags = %v, want %v", tags, want)
+	}
+	if got := RemoveTags(tags, "Asmr"); !reflect.DeepEqual(got, []string{"2024", "voice work"}) {
+		t.Fatalf("RemoveTags = %v", got)
+	}
+}
+
+func TestUpdateTagsAndListPosts(t *testing.T) {
+	store := NewPostStore(t.TempDir())
+	for _, post := range []*Post{{TID: "100", Title: "a"}, {TID: "200", Title: "b"}} {
+		if err := os.MkdirAll(store.PostDir(post.TID), 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := store.writePost(post); err != nil {
+			t.Fatalf("writePost: %v", err)
+		}
+	}
+
+	if _, err := store.UpdateTags("100", []string{"asmr", "2024"}, nil); err != nil {
+		t.Fatalf("UpdateTags returned error: %v", err)
+	}
+	tags, err := store.UpdateTags("200", []string{"asmr", "draft"}, []string{"draft"})
+	if err != nil {
+		t.Fatalf("UpdateTags returned error: %v", err)
+	}
+	if !reflect.DeepEqual(tags, []string{"asmr"}) {
+		t.Fatalf("unexpected tags of 200: %v", tags)
+	}
+
+	posts, err := store.ListPosts("ASMR", "2024")
+	if err != nil {
+		t.Fatalf("ListPosts returned error: %v", err)
+	}
+	if len(posts) != 1 || posts[0].TID != "100" {
+		t.Fatalf("expected only thread 100, got %+v", posts)
+	}
+	counts, err := store.TagCounts()
+	if err != nil {
+		t.Fatalf("TagCounts returned error: %v", err)
+	}
+	if counts["asmr"] != 2 || counts["2024"] != 1 {
+		t.Fatalf("unexpected tag counts: %v", counts)
+	}
+
+	catalog, _, err := QueryCatalog(store.RootDir(), CatalogQuery{Tags: []string{"ASMR", "2024"}})
+	if err != nil {
+		t.Fatalf("QueryCatalog returned error: %v", err)
+	}
+	if len(catalog) != 1 || catalog[0].TID != "100" || !reflect.DeepEqual(catalog[0].Tags, []string{"2024", "asmr"}) {
+		t.Fatalf("expected tag writes to update the catalog, got %+v", catalog)
+	}
+}
+
+func TestStorePostKeepsTagsAndWritesFrontMatter(t *testing.T) {
+	root := t.TempDir()
+	store := NewPostStore(root)
+	if err := os.MkdirAll(store.PostDir("100"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := store.writePost(&Post{TID: "100", Tags: []string{"asmr"}}); err != nil {
+		t.Fatalf("writePost: %v", err)
+	}
+
+	// A re-fetch produces a fresh post without tags.
+	g := NewMarkdownGenerator(&MarkdownOptions{FrontMatter: true}, nil)
+	g.SetDownloadEnabled(false)
+	post := &Post{TID: "100", Title: "refetched", MainPost: PostEntry{Floor: "GF", HTMLContent: "<p>hi</p>"}}
+	if err := g.StorePost(post, root); err != nil {
+		t.Fatalf("StorePost returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(store.PostDir("100"), metadataFileName))
+	if err != nil {
+		t.Fatalf("read metadata: %v", err)
+	}
+	var stored Post
+	if err := toml.Unmarshal(data, &stored); err != nil {
+		t.Fatalf("decode metadata: %v", err)
+	}
+	if !reflect.DeepEqual(stored.Tags, []string{"asmr"}) {
+		t.Fatalf("expected tags to survive a re-store, got %v", stored.Tags)
+	}
+
+	markdown, err := g.GenerateMarkdown(post)
+	if err != nil {
+		t.Fatalf("GenerateMarkdown returned error: %v", err)
+	}
+	if !strings.Contains(markdown, "tags:\n    - asmr\n") {
+		t.Fatalf("expected tags in front matter, got:\n%s", markdown)
+	}
+}
@@ -0,0 +1,163 @@
+package south2md
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTelegramEndpoint is the public Telegram Bot API.
+const defaultTelegramEndpoint = "https://api.telegram.org"
+
+// TelegramMaxUploadSize is the largest file a bot may send.
+const TelegramMaxUploadSize = 50 << 20
+
+// TelegramUpdate is an incoming update; only messages are requested.
+type TelegramUpdate struct {
+	UpdateID int64            `json:"update_id"`
+	Message  *TelegramMessage `json:"message"`
+}
+
+// TelegramMessage is a message sent to the bot.
+type TelegramMessage struct {
+	MessageID int64         `json:"message_id"`
+	From      *TelegramUser `json:"from"`
+	Chat      TelegramChat  `json:"chat"`
+	Text      string        `json:"text"`
+}
+
+// TelegramUser is the sender of a message.
+type TelegramUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// TelegramChat is the chat a message was sent in.
+type TelegramChat struct {
+	ID int64 `json:"id"`
+}
+
+// TelegramBot talks to the Telegram Bot API with a bot token.
+type TelegramBot struct {
+	client   HTTPDoer
+	endpoint string
+}
+
+// NewTelegramBot creates a bot client for token. endpoint overrides the
+// public Bot API URL (e.g. a local Bot API server); client sends the
+// requests and nil uses a client whose timeout outlasts long polling.
+func NewTelegramBot(client HTTPDoer, endpoint, token string) *TelegramBot {
+	if client == nil {
+		client = &http.Client{Timeout: 2 * time.Minute}
+	}
+	endpoint = strings.TrimRight(strings.TrimSpace(endpoint), "/")
+	if endpoint == "" {
+		endpoint = defaultTelegramEndpoint
+	}
+	return &TelegramBot{client: client, endpoint: endpoint + "/bot" + token}
+}
+
+// GetUpdates long-polls for messages with an update ID of at least offset,
+// waiting up to timeout for the first one.
+func (b *TelegramBot) GetUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]TelegramUpdate, error) {
+	payload := map[string]any{
+		"offset":          offset,
+		"timeout":         int(timeout.Seconds()),
+		"allowed_updates": []string{"message"},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var updates []TelegramUpdate
+	if err := b.call(ctx, "getUpdates", "application/json", bytes.NewReader(body), &updates); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+// SendMessage sends text to chatID, as a reply to message replyTo unless it
+// is 0.
+func (b *TelegramBot) SendMessage(ctx context.Context, chatID, replyTo int64, text string) error {
+	payload := map[string]any{"chat_id": chatID, "text": text}
+	if replyTo != 0 {
+		payload["reply_parameters"] = map[string]any{"message_id": replyTo, "allow_sending_without_reply": true}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return b.call(ctx, "sendMessage", "application/json", bytes.NewReader(body), nil)
+}
+
+// SendDocument uploads content as the file name to chatID with a caption,
+// as a reply to message replyTo unless it is 0.
+func (b *TelegramBot) SendDocument(ctx context.Context, chatID, replyTo int64, name string, content io.Reader, caption string) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	_ = form.WriteField("chat_id", strconv.FormatInt(chatID, 10))
+	if caption != "" {
+		_ = form.WriteField("caption", caption)
+	}
+	if replyTo != 0 {
+		_ = form.WriteField("reply_parameters", fmt.Sprintf(`{"message_id":%d,"allow_sending_without_reply":true}`, replyTo))
+	}
+	part, err := form.CreateFormFile("document", name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+	return b.call(ctx, "sendDocument", form.FormDataContentType(), &body, nil)
+}
+
+// call posts body to the Bot API method and decodes its result into target,
+// which may be nil.
+func (b *TelegramBot) call(ctx context.Context, method, contentType string, body io.Reader, target any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.endpoint+"/"+method, body)
+	if err != nil {
+		return fmt.Errorf("failed to create telegram request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		// The URL carries the bot token; keep it out of the error.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("telegram %s failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+	var envelope struct {
+		OK          bool            `json:"ok"`
+		Result      json.RawMessage `json:"result"`
+		Description string          `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("telegram %s failed with status %d: %w", method, resp.StatusCode, err)
+	}
+	if !envelope.OK {
+		return fmt.Errorf("telegram %s failed with status %d: %s", method, resp.StatusCode, envelope.Description)
+	}
+	if target == nil {
+		return nil
+	}
+	if err := json.Unmarshal(envelope.Result, target); err != nil {
+		return fmt.Errorf("failed to parse telegram %s response: %w", method, err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package south2md
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTelegramBot(t *testing.T) {
+	var document, caption, sent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/botsecret/getUpdates":
+			var payload struct {
+				Offset  int64 `json:"offset"`
+				Timeout int   `json:"timeout"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+			if payload.Offset != 7 || payload.Timeout != 30 {
+				t.Errorf("unexpected getUpdates payload %+v", payload)
+			}
+			io.WriteString(w, `{"ok":true,"result":[{"update_id":7,"message":{"message_id":3,"from":{"id":42,"username":"alice"},"chat":{"id":-5},"text":"2636739"}}]}`)
+		case "/botsecret/sendMessage":
+			body, _ := io.ReadAll(r.Body)
+			sent = string(body)
+			io.WriteString(w, `{"ok":true,"result":{}}`)
+		case "/botsecret/sendDocument":
+			file, header, err := r.FormFile("document")
+			if err != nil {
+				t.Errorf("read document: %v", err)
+				return
+			}
+			content, _ := io.ReadAll(file)
+			document, caption = header.Filename+":"+string(content), r.FormValue("caption")
+			io.WriteString(w, `{"ok":true,"result":{}}`)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"ok":false,"error_code":401,"description":"Unauthorized"}`)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	bot := NewTelegramBot(server.Client(), server.URL+"/", "secret")
+	updates, err := bot.GetUpdates(ctx, 7, 30*time.Second)
+	if err != nil {
+		t.Fatalf("GetUpdates returned error: %v", err)
+	}
+	if len(updates) != 1 || updates[0].Message == nil || updates[0].Message.From.ID != 42 || updates[0].Message.Chat.ID != -5 || updates[0].Message.Text != "2636739" {
+		t.Fatalf("unexpected updates %+v", updates)
+	}
+	if err := bot.SendMessage(ctx, -5, 3, "queued"); err != nil {
+		t.Fatalf("SendMessage returned error: %v", err)
+	}
+	if !strings.Contains(sent, `"chat_id":-5`) || !strings.Contains(sent, `"message_id":3`) {
+		t.Fatalf("unexpected sendMessage body %s", sent)
+	}
+	if err := bot.SendDocument(ctx, -5, 3, "post.md", strings.NewReader("# title"), "done"); err != nil {
+		t.Fatalf("SendDocument returned error: %v", err)
+	}
+	if document != "post.md:# title" || caption != "done" {
+		t.Fatalf("unexpected document %q with caption %q", document, caption)
+	}
+
+	err = NewTelegramBot(server.Client(), server.URL, "wrong").SendMessage(ctx, 1, 0, "x")
+	if err == nil || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Fatalf("expected the API error, got %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package south2md
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// DefaultMarkdownTemplate reproduces the built-in post.md layout. Custom
+// template files may redefine any of its blocks: "document", "floor_header"
+// and "footer".
+const DefaultMarkdownTemplate = `{{define "document" -}}
+{{with .FrontMatter}}{{.}}
+{{end -}}
+## {{escape .Post.Title}}
+
+{{with .TOC}}{{.}}
+{{end -}}
+{{with .Popular}}{{.}}
+{{end -}}
+----
+
+{{range .Floors}}{{.Indent}}{{template "floor_header" .}}
+{{trim .Indent}}
+{{if .Content}}{{.Content}}
+
+{{end}}
+{{end}}{{with .Authors}}{{.}}
+{{end -}}
+{{with .Mentions}}{{.}}
+{{end -}}
+{{template "footer" .}}
+{{- end}}
+
+{{- define "floor_header" -}}
+##### <span id="pid{{.Entry.PostID}}">{{.Floor}}.[{{.Index}}] \<pid:{{.Entry.PostID}}\> {{.Entry.PostTime.Format "2006-01-02 15:04:05"}} by UID:{{.Entry.Author.UID}}({{.Entry.Author.Username}})</span>{{with .Permalink}} [原帖]({{.}}){{end}}{{if not .Entry.EditedAt.IsZero}} *(已编辑)*{{end}}
+{{- end}}
+
+{{- define "footer" -}}
+---
+
+*本文档由 south2md 自动生成*
+{{- if not .GeneratedAt.IsZero}}
+
+*生成时间: {{.GeneratedAt.Format "2006-01-02 15:04:05"}}*
+{{- end}}
+{{end}}`
+
+// TemplateDocument is the data passed to the "document" and "footer" blocks.
+// FrontMatter, TOC, Popular, Authors and Mentions hold the rendered blocks,
+// or "" when disabled.
+type TemplateDocument struct {
+	Post        *Post
+	Floors      []TemplateFloor
+	FrontMatter string
+	TOC         string
+	Popular     string
+	Authors     string
+	Mentions    string
+	GeneratedAt time.Time
+}
+
+// TemplateFloor is the data passed to the "floor_header" block. Floor is "0"
+// for the main post; Content is the floor's rendered markdown. Depth is the
+// nesting of a threaded reply, 0 otherwise; its Content is already quoted.
+type TemplateFloor struct {
+	Post    *Post
+	Entry   PostEntry
+	Index   int
+	Floor   string
+	Content string
+	Depth   int
+}
+
+// Indent returns the blockquote prefix of a threaded reply's lines.
+func (f TemplateFloor) Indent() string {
+	return strings.Repeat("> ", f.Depth)
+}
+
+// Permalink returns the floor's URL on the live forum, or "" when the page it
+// came from is unknown (e.g. posts parsed from a single local HTML file).
+func (f TemplateFloor) Permalink() string {
+	if f.Post == nil || f.Post.URL == "" || f.Post.TID == "" || f.Entry.PostID == "" || f.Entry.SourcePage <= 0 {
+		return ""
+	}
+	page := ""
+	if f.Entry.SourcePage > 1 {
+		page = fmt.Sprintf("-page-%d", f.Entry.SourcePage)
+	}
+	return fmt.Sprintf("%s/read.php?tid-%s%s.html#%s", strings.TrimRight(f.Post.URL, "/"), f.Post.TID, page, f.Entry.PostID)
+}
+
+// MarkdownTemplate renders post.md from named text/template blocks.
+type MarkdownTemplate struct {
+	tmpl *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	"escape": EscapeMarkdown,
+	"join":   strings.Join,
+	"trim":   strings.TrimSpace,
+}
+
+// defaultTemplate is parsed once; executing a template is safe for concurrent use.
+var defaultTemplate = sync.OnceValue(func() *MarkdownTemplate {
+	return &MarkdownTemplate{
+		tmpl: template.Must(template.New("south2md").Funcs(templateFuncs).Parse(DefaultMarkdownTemplate)),
+	}
+})
+
+// NewDefaultMarkdownTemplate returns the built-in template.
+func NewDefaultMarkdownTemplate() *MarkdownTemplate {
+	return defaultTemplate()
+}
+
+// templateCacheKey identifies one version of a template file.
+type templateCacheKey struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// templateCache reuses parsed template files until they change on disk.
+var templateCache = newLRUCache[templateCacheKey, *MarkdownTemplate](16)
+
+// LoadMarkdownTemplate parses a user template file on top of the default
+// template, so it only needs to define the blocks it wants to change.
+func LoadMarkdownTemplate(path string) (*MarkdownTemplate, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, NewIOError(fmt.Sprintf("failed to read template %s", path), err)
+	}
+	key := templateCacheKey{path: path, size: info.Size(), modTime: info.ModTime()}
+	if cached, ok := templateCache.Get(key); ok {
+		return cached, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, NewIOError(fmt.Sprintf("failed to read template %s", path), err)
+	}
+	tmpl, err := ParseMarkdownTemplate(string(data))
+	if err != nil {
+		return nil, err
+	}
+	templateCache.Add(key, tmpl)
+	return tmpl, nil
+}
+
+// ParseMarkdownTemplate parses template text on top of the default template.
+func ParseMarkdownTemplate(text string) (*MarkdownTemplate, error) {
+	tmpl, err := NewDefaultMarkdownTemplate().tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmpl.Parse(text); err != nil {
+		return nil, NewParseError("failed to parse markdown template", err)
+	}
+	return &MarkdownTemplate{tmpl: tmpl}, nil
+}
+
+func (t *MarkdownTemplate) execute(name string, data any) (string, error) {
+	var b strings.Builder
+	if err := t.tmpl.ExecuteTemplate(&b, name, data); err != nil {
+		return "", fmt.Errorf("failed to execute template %q: %w", name, err)
+	}
+	return b.String(), nil
+}
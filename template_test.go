@@ -0,0 +1,99 @@
+package south2md
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMarkdownTemplateOverridesBlocks(t *testing.T) {
+	tmpl, err := ParseMarkdownTemplate(`{{define "floor_header"}}### {{.Floor}} — {{.Entry.Author.Username}}{{end}}{{define "footer"}}-- {{.Post.TID}} --
+{{end}}`)
+	if err != nil {
+		t.Fatalf("ParseMarkdownTemplate returned error: %v", err)
+	}
+
+	g := NewMarkdownGenerator(&MarkdownOptions{Template: tmpl}, nil)
+	g.SetDownloadEnabled(false)
+	post := &Post{
+		TID:      "100",
+		Title:    "hello",
+		MainPost: PostEntry{PostID: "tpc", Author: Author{Username: "alice"}, HTMLContent: "<p>body</p>", PostTime: time.Now()},
+		Replies:  []PostEntry{{Floor: "B1F", PostID: "1", Author: Author{Username: "bob"}}},
+	}
+
+	md, err := g.GenerateMarkdown(post)
+	if err != nil {
+		t.Fatalf("GenerateMarkdown returned error: %v", err)
+	}
+	want := "## hello\n\n----\n\n### 0 — alice\n\nbody\n\n\n### B1F — bob\n\n\n-- 100 --\n"
+	if md != want {
+		t.Fatalf("unexpected markdown:\n%q\nwant:\n%q", md, want)
+	}
+}
+
+func TestLoadMarkdownTemplateReportsParseErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.tmpl")
+	if err := os.WriteFile(path, []byte(`{{define "footer"}}{{.Missing`), 0644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+
+	_, err := LoadMarkdownTemplate(path)
+	if err == nil || !strings.Contains(err.Error(), "failed to parse markdown template") {
+		t.Fatalf("expected parse error, got %v", err)
+	}
+}
+
+func TestGenerateMarkdownPrependsYAMLFrontMatter(t *testing.T) {
+	g := NewMarkdownGenerator(&MarkdownOptions{FrontMatter: true}, nil)
+	g.SetDownloadEnabled(false)
+	post := &Post{
+		TID:       "100",
+		Title:     "hello: world",
+		Forum:     "茶馆",
+		MainPost:  PostEntry{PostID: "tpc", Author: Author{Username: "alice"}},
+		Replies:   []PostEntry{{Floor: "B1F", PostID: "1"}},
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	md, err := g.GenerateMarkdown(post)
+	if err != nil {
+		t.Fatalf("GenerateMarkdown returned error: %v", err)
+	}
+	want := "---\ntid: \"100\"\ntitle: 'hello: world'\nforum: 茶馆\nauthor: alice\ncreated_at: 2024-01-02T03:04:05Z\nfloors: 2\n---\n\n## hello: world\n"
+	if !strings.HasPrefix(md, want) {
+		t.Fatalf("unexpected front matter:\n%s", md)
+	}
+}
+
+func TestGenerateMarkdownLinksFloorsToSourcePage(t *testing.T) {
+	g := NewMarkdownGenerator(&MarkdownOptions{}, nil)
+	g.SetDownloadEnabled(false)
+	post := &Post{
+		TID:      "100",
+		URL:      "https://north-plus.net/",
+		MainPost: PostEntry{PostID: "tpc", SourcePage: 1},
+		Replies: []PostEntry{
+			{Floor: "B30F", PostID: "3001", SourcePage: 2},
+			{Floor: "B31F", PostID: "3002"},
+		},
+	}
+
+	md, err := g.GenerateMarkdown(post)
+	if err != nil {
+		t.Fatalf("GenerateMarkdown returned error: %v", err)
+	}
+	for _, want := range []string{
+		"</span> [原帖](https://north-plus.net/read.php?tid-100.html#tpc)\n",
+		"</span> [原帖](https://north-plus.net/read.php?tid-100-page-2.html#3001)\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Fatalf("expected permalink %q, got:\n%s", want, md)
+		}
+	}
+	if strings.Count(md, "[原帖]") != 2 {
+		t.Fatalf("expected no permalink for floor with unknown page, got:\n%s", md)
+	}
+}
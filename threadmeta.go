@@ -0,0 +1,66 @@
+package south2md
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// titlePrefixPattern matches one bracketed prefix at the start of a title,
+// e.g. "[RPG]" or "【汉化】".
+var titlePrefixPattern = regexp.MustCompile(`^\s*(?:\[([^\[\]]+)\]|【([^【】]+)】)`)
+
+var (
+	threadViewsPattern   = regexp.MustCompile(`(?i)(?:浏览|点击|查看|阅读|views?|hits)\s*[:：]?\s*(\d+)`)
+	threadRepliesPattern = regexp.MustCompile(`(?i)(?:回复|回帖|replies)\s*[:：]?\s*(\d+)`)
+)
+
+// TitlePrefixes returns the bracketed prefixes at the start of title without
+// their brackets, e.g. ["RPG", "汉化"] for "[RPG]【汉化】Title".
+func TitlePrefixes(title string) []string {
+	var prefixes []string
+	for {
+		m := titlePrefixPattern.FindStringSubmatch(title)
+		if m == nil {
+			return prefixes
+		}
+		if prefix := strings.TrimSpace(m[1] + m[2]); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+		title = title[len(m[0]):]
+	}
+}
+
+// parseThreadStats reads the view and reply counts from the text of the
+// thread's statistics element, e.g. "浏览: 1234 | 回复: 56". Missing counts
+// are 0.
+func parseThreadStats(text string) (views, replies int) {
+	if m := threadViewsPattern.FindStringSubmatch(text); m != nil {
+		views, _ = strconv.Atoi(m[1])
+	}
+	if m := threadRepliesPattern.FindStringSubmatch(text); m != nil {
+		replies, _ = strconv.Atoi(m[1])
+	}
+	return views, replies
+}
+
+// extractThreadMeta fills in the title prefixes and the view and reply counts
+// the forum shows for the thread.
+func (p *PostParser) extractThreadMeta(post *Post) {
+	post.Prefixes = TitlePrefixes(post.Title)
+	if stats := p.FindElements(p.selectors.threadStats); stats.Length() > 0 {
+		post.Views, post.ReplyCount = parseThreadStats(stats.Text())
+	}
+}
+
+// HasPrefix reports whether post's title carries prefix, compared without
+// brackets and case.
+func (p *Post) HasPrefix(prefix string) bool {
+	prefix = strings.Trim(strings.TrimSpace(prefix), "[]【】")
+	for _, have := range p.Prefixes {
+		if strings.EqualFold(have, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package south2md
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTitlePrefixes(t *testing.T) {
+	cases := map[string]string{
+		"[RPG]【汉化】 [PC] Title [not a prefix]": "RPG,汉化,PC",
+		"Title":       "",
+		"[ ] Title":   "",
+		"  【求助】Title": "求助",
+	}
+	for title, want := range cases {
+		if got := strings.Join(TitlePrefixes(title), ","); got != want {
+			t.Errorf("TitlePrefixes(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
+
+func TestExtractPostReadsThreadMeta(t *testing.T) {
+	parser := NewPostParser()
+	html := `<html><body>
+<div class="h2"><span class="fl w">浏览: 1234 | 回复：56</span></div>
+<h1 id="subject_tpc">[RPG][汉化] 某游戏</h1>
+<table class="js-post"><tr><td><div class="tiptop"><span class="gray">2024-01-02 10:00</span></div><div id="read_tpc">main</div></td></tr></table>
+</body></html>`
+	if err := parser.LoadFromString(html); err != nil {
+		t.Fatalf("LoadFromString: %v", err)
+	}
+	post, err := parser.ExtractPost()
+	if err != nil {
+		t.Fatalf("ExtractPost returned error: %v", err)
+	}
+	if strings.Join(post.Prefixes, ",") != "RPG,汉化" || post.Views != 1234 || post.ReplyCount != 56 {
+		t.Fatalf("unexpected thread meta: prefixes=%v views=%d replies=%d", post.Prefixes, post.Views, post.ReplyCount)
+	}
+	if !post.HasPrefix("[rpg]") || !post.HasPrefix("汉化") || post.HasPrefix("ACT") {
+		t.Fatalf("unexpected HasPrefix results for %v", post.Prefixes)
+	}
+
+	frontMatter, err := formatYAMLFrontMatter(newPostFrontMatter(post, 1))
+	if err != nil {
+		t.Fatalf("formatYAMLFrontMatter: %v", err)
+	}
+	for _, want := range []string{"prefixes:\n    - RPG\n    - 汉化\n", "views: 1234\n", "replies: 56\n"} {
+		if !strings.Contains(frontMatter, want) {
+			t.Fatalf("expected %q in front matter:\n%s", want, frontMatter)
+		}
+	}
+}
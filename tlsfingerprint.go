@@ -0,0 +1,235 @@
+package south2md
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http2"
+)
+
+// Browser TLS fingerprints the fetcher can imitate.
+const (
+	TLSFingerprintChrome  = "chrome"
+	TLSFingerprintFirefox = "firefox"
+	TLSFingerprintSafari  = "safari"
+	TLSFingerprintEdge    = "edge"
+)
+
+// TLSFingerprints lists all supported TLS fingerprints.
+var TLSFingerprints = []string{
+	TLSFingerprintChrome,
+	TLSFingerprintFirefox,
+	TLSFingerprintSafari,
+	TLSFingerprintEdge,
+}
+
+var utlsHelloIDs = map[string]utls.ClientHelloID{
+	TLSFingerprintChrome:  utls.HelloChrome_Auto,
+	TLSFingerprintFirefox: utls.HelloFirefox_Auto,
+	TLSFingerprintSafari:  utls.HelloSafari_Auto,
+	TLSFingerprintEdge:    utls.HelloEdge_Auto,
+}
+
+// IsValidTLSFingerprint reports whether fingerprint is a supported TLS
+// fingerprint; "" (Go's own ClientHello) is valid too.
+func IsValidTLSFingerprint(fingerprint string) bool {
+	if fingerprint == "" {
+		return true
+	}
+	_, ok := utlsHelloIDs[fingerprint]
+	return ok
+}
+
+// ValidateTLSFingerprint checks that fingerprint is supported.
+func ValidateTLSFingerprint(fingerprint string) error {
+	if !IsValidTLSFingerprint(fingerprint) {
+		return NewValidationError(fmt.Sprintf("不支持的TLS指纹 %q (可选: %s)", fingerprint, strings.Join(TLSFingerprints, ", ")))
+	}
+	return nil
+}
+
+// forumHosts returns the hosts of config's base URL and mirrors, the hosts
+// the TLS fingerprint applies to.
+func forumHosts(config *Config) []string {
+	var hosts []string
+	for _, base := range append([]string{config.BaseURL}, config.HTTPMirrors...) {
+		if host := hostOf(base); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// applyTLSFingerprint returns a round tripper sending the direct HTTPS
+// requests to hosts with the ClientHello of the named browser and all other
+// requests, including proxied ones, through transport with Go's own
+// handshake. It returns transport itself when fingerprint or hosts is empty.
+func applyTLSFingerprint(transport *http.Transport, fingerprint string, hosts []string) (http.RoundTripper, error) {
+	if fingerprint == "" || len(hosts) == 0 {
+		return transport, nil
+	}
+	if err := ValidateTLSFingerprint(fingerprint); err != nil {
+		return transport, err
+	}
+	var rootCAs *x509.CertPool
+	if transport.TLSClientConfig != nil {
+		rootCAs = transport.TLSClientConfig.RootCAs
+	}
+	t := &fingerprintTransport{
+		next:  transport,
+		hosts: make(map[string]bool, len(hosts)),
+		utls: &utlsTransport{
+			fingerprint: fingerprint,
+			rootCAs:     rootCAs,
+			dialer:      &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+			transports:  make(map[string]http.RoundTripper),
+			pending:     make(map[string]net.Conn),
+		},
+	}
+	for _, host := range hosts {
+		t.hosts[strings.ToLower(host)] = true
+	}
+	return t, nil
+}
+
+// fingerprintTransport routes the direct HTTPS requests to the forum hosts
+// through utls and every other request through next.
+type fingerprintTransport struct {
+	next  *http.Transport
+	hosts map[string]bool
+	utls  *utlsTransport
+}
+
+func (t *fingerprintTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "https" && t.hosts[strings.ToLower(req.URL.Hostname())] && !t.proxied(req) {
+		return t.utls.RoundTrip(req)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// proxied reports whether next sends req through a proxy, which keeps Go's
+// own handshake with the proxy.
+func (t *fingerprintTransport) proxied(req *http.Request) bool {
+	if t.next.Proxy == nil {
+		return false
+	}
+	proxyURL, err := t.next.Proxy(req)
+	return err != nil || proxyURL != nil
+}
+
+func (t *fingerprintTransport) CloseIdleConnections() {
+	t.next.CloseIdleConnections()
+	t.utls.CloseIdleConnections()
+}
+
+// utlsTransport sends requests over connections presenting the browser's
+// ClientHello unchanged, ALPN included, and speaks HTTP/2 or HTTP/1.1 as the
+// server picks. The protocol is learned per address from the first
+// connection, which is then handed to the transport for that protocol.
+type utlsTransport struct {
+	fingerprint string
+	rootCAs     *x509.CertPool // nil uses the system roots
+	dialer      *net.Dialer
+
+	mu         sync.Mutex
+	transports map[string]http.RoundTripper // by host:port
+	pending    map[string]net.Conn          // first connection per host:port, not taken yet
+}
+
+func (t *utlsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	addr := req.URL.Host
+	if req.URL.Port() == "" {
+		addr = net.JoinHostPort(req.URL.Hostname(), "443")
+	}
+	rt, err := t.transportFor(req.Context(), addr)
+	if err != nil {
+		return nil, err
+	}
+	return rt.RoundTrip(req)
+}
+
+// transportFor returns the transport for addr, connecting once to learn the
+// protocol the server negotiates.
+func (t *utlsTransport) transportFor(ctx context.Context, addr string) (http.RoundTripper, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if rt, ok := t.transports[addr]; ok {
+		return rt, nil
+	}
+	conn, err := t.handshake(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	var rt http.RoundTripper
+	if conn.ConnectionState().NegotiatedProtocol == http2.NextProtoTLS {
+		rt = &http2.Transport{
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return t.dial(ctx, network, addr)
+			},
+		}
+	} else {
+		rt = &http.Transport{
+			DialTLSContext:      t.dial,
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 10,
+			IdleConnTimeout:     90 * time.Second,
+		}
+	}
+	t.transports[addr] = rt
+	t.pending[addr] = conn
+	return rt, nil
+}
+
+// dial returns the first connection to addr when it hasn't been taken yet,
+// or a new one.
+func (t *utlsTransport) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	t.mu.Lock()
+	conn, ok := t.pending[addr]
+	delete(t.pending, addr)
+	t.mu.Unlock()
+	if ok {
+		return conn, nil
+	}
+	return t.handshake(ctx, network, addr)
+}
+
+// handshake dials addr and completes a TLS handshake with the browser's
+// ClientHello, verifying the server against rootCAs.
+func (t *utlsTransport) handshake(ctx context.Context, network, addr string) (*utls.UConn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := t.dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	uconn := utls.UClient(conn, &utls.Config{ServerName: host, RootCAs: t.rootCAs}, utlsHelloIDs[t.fingerprint])
+	if err := uconn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return uconn, nil
+}
+
+func (t *utlsTransport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for addr, conn := range t.pending {
+		conn.Close()
+		delete(t.pending, addr)
+	}
+	for _, rt := range t.transports {
+		if closer, ok := rt.(interface{ CloseIdleConnections() }); ok {
+			closer.CloseIdleConnections()
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package south2md
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestApplyTLSFingerprint(t *testing.T) {
+	if _, err := applyTLSFingerprint(&http.Transport{}, "opera", []string{"south-plus.net"}); err == nil {
+		t.Fatal("expected an unknown fingerprint to be rejected")
+	}
+	transport := &http.Transport{}
+	if rt, err := applyTLSFingerprint(transport, "", []string{"south-plus.net"}); err != nil || rt != transport {
+		t.Fatalf("expected no fingerprint to keep the default handshake, got %v", err)
+	}
+	if rt, err := applyTLSFingerprint(transport, TLSFingerprintChrome, nil); err != nil || rt != transport {
+		t.Fatalf("expected no forum hosts to keep the default handshake, got %v", err)
+	}
+}
+
+func TestForumHosts(t *testing.T) {
+	got := forumHosts(&Config{BaseURL: "https://south-plus.net/", HTTPMirrors: []string{"https://North-Plus.net", ""}})
+	if !slices.Equal(got, []string{"south-plus.net", "north-plus.net"}) {
+		t.Fatalf("unexpected forum hosts %v", got)
+	}
+}
+
+func TestTLSFingerprintHandshake(t *testing.T) {
+	for _, h2 := range []bool{true, false} {
+		var hello *tls.ClientHelloInfo
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, r.Proto)
+		}))
+		server.EnableHTTP2 = h2
+		server.TLS = &tls.Config{GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			hello = info
+			return nil, nil
+		}}
+		server.StartTLS()
+
+		want := "HTTP/1.1"
+		if h2 {
+			want = "HTTP/2.0"
+		}
+		for _, fingerprint := range TLSFingerprints {
+			transport := server.Client().Transport.(*http.Transport).Clone()
+			rt, err := applyTLSFingerprint(transport, fingerprint, []string{"127.0.0.1"})
+			if err != nil {
+				t.Fatalf("applyTLSFingerprint(%s) returned error: %v", fingerprint, err)
+			}
+			client := &http.Client{Transport: rt}
+			for i := 0; i < 2; i++ {
+				resp, err := client.Get(server.URL)
+				if err != nil {
+					t.Fatalf("GET with %s fingerprint: %v", fingerprint, err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if string(body) != want {
+					t.Fatalf("expected %s with %s fingerprint, got %q", want, fingerprint, body)
+				}
+			}
+			// The browser's ALPN offer is sent unchanged.
+			if !slices.Contains(hello.SupportedProtos, "h2") || !slices.Contains(hello.SupportedProtos, "http/1.1") {
+				t.Fatalf("expected the %s ALPN offer, got %v", fingerprint, hello.SupportedProtos)
+			}
+			// Go's own ClientHello never offers GREASE values; the browser presets do.
+			if fingerprint == TLSFingerprintChrome && !hasGREASE(hello.CipherSuites) {
+				t.Fatalf("expected a browser ClientHello, got cipher suites %x", hello.CipherSuites)
+			}
+			client.CloseIdleConnections()
+		}
+		server.Close()
+	}
+}
+
+func TestTLSFingerprintOnlyAppliesToForumHosts(t *testing.T) {
+	var hello *tls.ClientHelloInfo
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+		hello = info
+		return nil, nil
+	}}
+	server.StartTLS()
+	defer server.Close()
+
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	rt, err := applyTLSFingerprint(transport, TLSFingerprintChrome, []string{"south-plus.net"})
+	if err != nil {
+		t.Fatalf("applyTLSFingerprint returned error: %v", err)
+	}
+	resp, err := (&http.Client{Transport: rt}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if hasGREASE(hello.CipherSuites) {
+		t.Fatal("expected Go's own ClientHello for a host that isn't the forum")
+	}
+
+	proxied := server.Client().Transport.(*http.Transport).Clone()
+	proxied.Proxy = http.ProxyURL(&url.URL{Scheme: "http", Host: "proxy.invalid"})
+	rt, _ = applyTLSFingerprint(proxied, TLSFingerprintChrome, []string{"127.0.0.1"})
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	if !rt.(*fingerprintTransport).proxied(req) {
+		t.Fatal("expected a proxied forum request to keep Go's own handshake")
+	}
+}
+
+func hasGREASE(values []uint16) bool {
+	for _, v := range values {
+		if v&0x0f0f == 0x0a0a {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package south2md
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FormatTOC renders an anchor-linked list of floors linking to the
+// <span id="pid..."> headers. It returns "" unless both TableOfContents and
+// IncludeTOC are enabled.
+//
+// With TOCPageSize > 0 floors are grouped under one item per page; TOCDepth 1
+// then lists only the pages. TOCMaxEntries caps the number of floor links.
+func (mf *MarkdownFormatter) FormatTOC(floors []TemplateFloor) string {
+	opts := mf.options
+	if !opts.TableOfContents || !opts.IncludeTOC || len(floors) == 0 {
+		return ""
+	}
+
+	limit := len(floors)
+	if opts.TOCMaxEntries > 0 && opts.TOCMaxEntries < limit {
+		limit = opts.TOCMaxEntries
+	}
+
+	var md strings.Builder
+	md.WriteString("**目录**\n\n")
+
+	if opts.TOCPageSize <= 0 {
+		for _, floor := range floors[:limit] {
+			md.WriteString("- " + tocFloorLink(floor) + "\n")
+		}
+	} else {
+		for start := 0; start < limit; start += opts.TOCPageSize {
+			end := min(start+opts.TOCPageSize, limit)
+			fmt.Fprintf(&md, "- [第 %d 页](#pid%s)\n", start/opts.TOCPageSize+1, floors[start].Entry.PostID)
+			if opts.TOCDepth == 1 {
+				continue
+			}
+			for _, floor := range floors[start:end] {
+				md.WriteString("  - " + tocFloorLink(floor) + "\n")
+			}
+		}
+	}
+
+	if rest := len(floors) - limit; rest > 0 {
+		fmt.Fprintf(&md, "- …… 另有 %d 层未列出\n", rest)
+	}
+	return md.String()
+}
+
+func tocFloorLink(floor TemplateFloor) string {
+	link := fmt.Sprintf("[%s](#pid%s)", floor.Floor, floor.Entry.PostID)
+	if name := floor.Entry.Author.Username; name != "" {
+		link += " " + EscapeMarkdown(name)
+	}
+	if !floor.Entry.PostTime.IsZero() {
+		link += " · " + floor.Entry.PostTime.Format("2006-01-02 15:04")
+	}
+	return link
+}
@@ -0,0 +1,55 @@
+package south2md
+
+import (
+	"strings"
+	"testing"
+)
+
+func tocTestFloors(n int) []TemplateFloor {
+	floors := make([]TemplateFloor, 0, n)
+	for i := 0; i < n; i++ {
+		floor := "B" + string(rune('0'+i)) + "F"
+		if i == 0 {
+			floor = "0"
+		}
+		floors = append(floors, TemplateFloor{
+			Index: i,
+			Floor: floor,
+			Entry: PostEntry{PostID: string(rune('a' + i)), Author: Author{Username: "u"}},
+		})
+	}
+	return floors
+}
+
+func TestFormatTOCListsFloorsWithLimit(t *testing.T) {
+	mf := NewMarkdownFormatter(&MarkdownOptions{TableOfContents: true, IncludeTOC: true, TOCMaxEntries: 2})
+
+	got := mf.FormatTOC(tocTestFloors(3))
+	want := "**目录**\n\n- [0](#pida) u\n- [B1F](#pidb) u\n- …… 另有 1 层未列出\n"
+	if got != want {
+		t.Fatalf("unexpected toc:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestFormatTOCGroupsPerPage(t *testing.T) {
+	mf := NewMarkdownFormatter(&MarkdownOptions{TableOfContents: true, IncludeTOC: true, TOCPageSize: 2, TOCDepth: 2})
+
+	got := mf.FormatTOC(tocTestFloors(3))
+	for _, want := range []string{"- [第 1 页](#pida)\n  - [0](#pida) u\n  - [B1F](#pidb) u\n", "- [第 2 页](#pidc)\n  - [B2F](#pidc) u\n"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in toc:\n%s", want, got)
+		}
+	}
+
+	mf.options.TOCDepth = 1
+	if got := mf.FormatTOC(tocTestFloors(3)); strings.Contains(got, "  - ") {
+		t.Fatalf("expected pages only at depth 1, got:\n%s", got)
+	}
+}
+
+func TestFormatTOCDisabled(t *testing.T) {
+	mf := NewMarkdownFormatter(&MarkdownOptions{TableOfContents: true})
+	if got := mf.FormatTOC(tocTestFloors(2)); got != "" {
+		t.Fatalf("expected no toc when IncludeTOC is false, got %q", got)
+	}
+}
@@ -0,0 +1,72 @@
+package south2md
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestFetchPostWithPaginationEmitsSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	page, err := os.ReadFile("tid-2636739.html")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(page)
+	}))
+	defer srv.Close()
+
+	fetcher := NewFetcher(srv.Client(), &HTTPOptions{Timeout: 5 * time.Second, MaxConcurrent: 1}, srv.URL)
+	if _, err := fetcher.FetchPostWithPaginationContext(context.Background(), "2636739", NewPostParser()); err != nil {
+		t.Fatalf("FetchPostWithPaginationContext returned error: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	byName := make(map[string]tracetest.SpanStub)
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	root, ok := byName["south2md.fetch_thread"]
+	if !ok {
+		t.Fatalf("missing fetch_thread span, got %d spans", len(spans))
+	}
+	for _, name := range []string{"south2md.fetch_page", "south2md.parse_page", "south2md.extract_post"} {
+		span, ok := byName[name]
+		if !ok {
+			t.Fatalf("missing %s span", name)
+		}
+		if span.Parent.SpanID() != root.SpanContext.SpanID() {
+			t.Fatalf("%s should be a child of fetch_thread", name)
+		}
+	}
+	request, ok := byName["south2md.http_request"]
+	if !ok || request.Parent.SpanID() != byName["south2md.fetch_page"].SpanContext.SpanID() {
+		t.Fatal("http_request span should be a child of fetch_page")
+	}
+}
+
+func TestFetchPostWithPaginationContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	doer := &stubDoer{}
+	fetcher := NewFetcher(doer, &HTTPOptions{MaxRetries: 2}, "https://forum.example.com/")
+	if _, err := fetcher.FetchPostWithPaginationContext(ctx, "1", NewPostParser()); err == nil {
+		t.Fatal("expected error for canceled context")
+	}
+	if len(doer.urls) != 0 {
+		t.Fatalf("no request should be sent after cancel, got %v", doer.urls)
+	}
+}
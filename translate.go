@@ -0,0 +1,332 @@
+package south2md
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Translation backends supported by NewTranslator.
+const (
+	TranslateBackendDeepL          = "deepl"
+	TranslateBackendOpenAI         = "openai"
+	TranslateBackendLibreTranslate = "libretranslate"
+)
+
+// TranslateBackends lists the supported translation backends.
+var TranslateBackends = []string{
+	TranslateBackendDeepL,
+	TranslateBackendOpenAI,
+	TranslateBackendLibreTranslate,
+}
+
+// Translation output modes.
+const (
+	TranslateModeTranslated = "translated" // floors hold only the translation
+	TranslateModeBilingual  = "bilingual"  // floors hold the original followed by the translation
+)
+
+// TranslateModes lists the supported translation output modes.
+var TranslateModes = []string{TranslateModeTranslated, TranslateModeBilingual}
+
+// StageTranslate is the name of the stage writing a translated post variant.
+const StageTranslate = "translate"
+
+// Default endpoints of the translation backends.
+const (
+	defaultDeepLEndpoint          = "https://api-free.deepl.com/v2/translate"
+	defaultOpenAIEndpoint         = "https://api.openai.com/v1/chat/completions"
+	defaultLibreTranslateEndpoint = "https://libretranslate.com/translate"
+	defaultOpenAIModel            = "gpt-4o-mini"
+)
+
+// translateBatchSize is the number of texts sent per DeepL request; the API
+// accepts at most 50.
+const translateBatchSize = 25
+
+// Translator translates HTML fragments into a target language. The result
+// has one translation per input text, in order.
+type Translator interface {
+	Translate(ctx context.Context, texts []string, targetLang string) ([]string, error)
+}
+
+// TranslatorOptions configures NewTranslator.
+type TranslatorOptions struct {
+	Backend  string // one of TranslateBackends
+	Endpoint string // API URL; empty uses the backend's public endpoint
+	APIKey   string
+	Model    string // chat model for the openai backend
+}
+
+// NewTranslator creates the translator for opts.Backend. client sends the
+// API requests; nil uses a client with a generous timeout.
+func NewTranslator(client HTTPDoer, opts TranslatorOptions) (Translator, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 2 * time.Minute}
+	}
+	endpoint := strings.TrimSpace(opts.Endpoint)
+	switch opts.Backend {
+	case TranslateBackendDeepL:
+		if endpoint == "" {
+			endpoint = defaultDeepLEndpoint
+		}
+		return &deeplTranslator{client: client, endpoint: endpoint, apiKey: opts.APIKey}, nil
+	case TranslateBackendOpenAI:
+		if endpoint == "" {
+			endpoint = defaultOpenAIEndpoint
+		}
+		model := opts.Model
+		if model == "" {
+			model = defaultOpenAIModel
+		}
+		return &openAITranslator{client: client, endpoint: endpoint, apiKey: opts.APIKey, model: model}, nil
+	case TranslateBackendLibreTranslate:
+		if endpoint == "" {
+			endpoint = defaultLibreTranslateEndpoint
+		}
+		return &libreTranslator{client: client, endpoint: endpoint, apiKey: opts.APIKey}, nil
+	default:
+		return nil, fmt.Errorf("unknown translation backend %q", opts.Backend)
+	}
+}
+
+// postJSON sends payload to endpoint and decodes the JSON answer into target.
+func postJSON(ctx context.Context, client HTTPDoer, endpoint string, header http.Header, payload, target any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create translation request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("translation request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("translation request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("failed to parse translation response: %w", err)
+	}
+	return nil
+}
+
+type deeplTranslator struct {
+	client   HTTPDoer
+	endpoint string
+	apiKey   string
+}
+
+func (t *deeplTranslator) Translate(ctx context.Context, texts []string, targetLang string) ([]string, error) {
+	out := make([]string, 0, len(texts))
+	for start := 0; start < len(texts); start += translateBatchSize {
+		batch := texts[start:min(start+translateBatchSize, len(texts))]
+		header := http.Header{}
+		if t.apiKey != "" {
+			header.Set("Authorization", "DeepL-Auth-Key "+t.apiKey)
+		}
+		var resp struct {
+			Translations []struct {
+				Text string `json:"text"`
+			} `json:"translations"`
+		}
+		payload := map[string]any{
+			"text":         batch,
+			"target_lang":  strings.ToUpper(targetLang),
+			"tag_handling": "html",
+		}
+		if err := postJSON(ctx, t.client, t.endpoint, header, payload, &resp); err != nil {
+			return nil, err
+		}
+		if len(resp.Translations) != len(batch) {
+			return nil, fmt.Errorf("deepl returned %d translations for %d texts", len(resp.Translations), len(batch))
+		}
+		for _, tr := range resp.Translations {
+			out = append(out, tr.Text)
+		}
+	}
+	return out, nil
+}
+
+type libreTranslator struct {
+	client   HTTPDoer
+	endpoint string
+	apiKey   string
+}
+
+func (t *libreTranslator) Translate(ctx context.Context, texts []string, targetLang string) ([]string, error) {
+	out := make([]string, 0, len(texts))
+	for _, text := range texts {
+		payload := map[string]any{
+			"q":      text,
+			"source": "auto",
+			"target": strings.ToLower(targetLang),
+			"format": "html",
+		}
+		if t.apiKey != "" {
+			payload["api_key"] = t.apiKey
+		}
+		var resp struct {
+			TranslatedText string `json:"translatedText"`
+		}
+		if err := postJSON(ctx, t.client, t.endpoint, nil, payload, &resp); err != nil {
+			return nil, err
+		}
+		out = append(out, resp.TranslatedText)
+	}
+	return out, nil
+}
+
+type openAITranslator struct {
+	client   HTTPDoer
+	endpoint string
+	apiKey   string
+	model    string
+}
+
+func (t *openAITranslator) Translate(ctx context.Context, texts []string, targetLang string) ([]string, error) {
+	header := http.Header{}
+	if t.apiKey != "" {
+		header.Set("Authorization", "Bearer "+t.apiKey)
+	}
+	prompt := fmt.Sprintf("Translate the HTML fragment from the user into the language with code %q. "+
+		"Keep every HTML tag, attribute and URL unchanged and reply with the translated HTML only.", targetLang)
+
+	out := make([]string, 0, len(texts))
+	for _, text := range texts {
+		payload := map[string]any{
+			"model": t.model,
+			"messages": []map[string]string{
+				{"role": "system", "content": prompt},
+				{"role": "user", "content": text},
+			},
+		}
+		var resp struct {
+			Choices []struct {
+				Message struct {
+					Content string `json:"content"`
+				} `json:"message"`
+			} `json:"choices"`
+		}
+		if err := postJSON(ctx, t.client, t.endpoint, header, payload, &resp); err != nil {
+			return nil, err
+		}
+		if len(resp.Choices) == 0 {
+			return nil, fmt.Errorf("openai returned no choices")
+		}
+		out = append(out, strings.TrimSpace(resp.Choices[0].Message.Content))
+	}
+	return out, nil
+}
+
+// TranslationFileName is the file holding the translation of post.md into
+// lang, e.g. "post.en.md".
+func TranslationFileName(lang string) string {
+	return "post." + strings.ToLower(lang) + ".md"
+}
+
+// TranslatePost returns a copy of post whose title and floor contents are
+// translated into targetLang. In TranslateModeBilingual each floor keeps its
+// original content, followed by the translation as a quote. post itself is
+// not modified.
+func TranslatePost(ctx context.Context, post *Post, translator Translator, targetLang, mode string) (*Post, error) {
+	translated := *post
+	translated.Replies = append([]PostEntry(nil), post.Replies...)
+	entries := make([]*PostEntry, 0, 1+len(translated.Replies))
+	entries = append(entries, &translated.MainPost)
+	for i := range translated.Replies {
+		entries = append(entries, &translated.Replies[i])
+	}
+
+	texts := []string{post.Title}
+	targets := make([]*PostEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Status != "" || strings.TrimSpace(entry.HTMLContent) == "" {
+			continue
+		}
+		texts = append(texts, entry.HTMLContent)
+		targets = append(targets, entry)
+	}
+
+	results, err := translator.Translate(ctx, texts, targetLang)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != len(texts) {
+		return nil, fmt.Errorf("translator returned %d texts for %d inputs", len(results), len(texts))
+	}
+
+	bilingual := mode == TranslateModeBilingual
+	if bilingual {
+		translated.Title = post.Title + " / " + results[0]
+	} else {
+		translated.Title = results[0]
+	}
+	for i, entry := range targets {
+		if bilingual {
+			entry.HTMLContent = entry.HTMLContent + "<blockquote>" + results[i+1] + "</blockquote>"
+		} else {
+			entry.HTMLContent = results[i+1]
+		}
+	}
+	return &translated, nil
+}
+
+// GenerateOfflineMarkdown renders post like GenerateMarkdown without
+// downloading anything: images and gofile links resolve only through the
+// post's existing records.
+func (g *MarkdownGenerator) GenerateOfflineMarkdown(post *Post) (string, error) {
+	imageDownload := g.imageHandler.download
+	gofileDownload := g.gofileHandler != nil && g.gofileHandler.download
+	g.SetDownloadEnabled(false)
+	defer func() {
+		g.imageHandler.SetDownloadEnabled(imageDownload)
+		g.gofileHandler.SetDownloadEnabled(gofileDownload)
+	}()
+	return g.GenerateMarkdown(post)
+}
+
+// TranslateStage writes the translation of state.Post into lang next to the
+// stored thread (see TranslationFileName), leaving the original untouched.
+// Translation is optional: failures are logged and don't stop the pipeline.
+func TranslateStage(translator Translator, generator *MarkdownGenerator, store *PostStore, lang, mode string) Stage {
+	return NewStage(StageTranslate, func(ctx context.Context, state *PipelineState) error {
+		if state.Post == nil || translator == nil {
+			return nil
+		}
+		translated, err := TranslatePost(ctx, state.Post, translator, lang, mode)
+		if err != nil {
+			slog.Warn("Translation failed", "tid", state.Post.TID, "lang", lang, "error", err)
+			return nil
+		}
+		markdown, err := generator.GenerateOfflineMarkdown(translated)
+		if err != nil {
+			slog.Warn("Failed to render translation", "tid", state.Post.TID, "lang", lang, "error", err)
+			return nil
+		}
+		err = store.Transact(state.Post.TID, func(stageRoot string) error {
+			return writeFileAtomic(filepath.Join(threadDir(stageRoot, state.Post.TID), TranslationFileName(lang)), []byte(markdown))
+		})
+		if err != nil {
+			slog.Warn("Failed to save translation", "tid", state.Post.TID, "lang", lang, "error", err)
+			return nil
+		}
+		slog.Info("Translation saved", "tid", state.Post.TID, "file", TranslationFileName(lang))
+		return nil
+	})
+}
@@ -0,0 +1,121 @@
+package south2md
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// upperTranslator "translates" by upper-casing each text.
+type upperTranslator struct{ calls int }
+
+func (u *upperTranslator) Translate(ctx context.Context, texts []string, targetLang string) ([]string, error) {
+	u.calls++
+	out := make([]string, len(texts))
+	for i, text := range texts {
+		out[i] = strings.ToUpper(text)
+	}
+	return out, nil
+}
+
+func TestTranslatePostModes(t *testing.T) {
+	post := &Post{
+		TID:      "42",
+		Title:    "title",
+		MainPost: PostEntry{Floor: "GF", HTMLContent: "<p>hello</p>"},
+		Replies: []PostEntry{
+			{Floor: "B1F", HTMLContent: "<p>reply</p>"},
+			{Floor: "B2F", HTMLContent: "<p>gone</p>", Status: "deleted"},
+		},
+	}
+
+	translated, err := TranslatePost(context.Background(), post, &upperTranslator{}, "en", TranslateModeTranslated)
+	if err != nil {
+		t.Fatalf("TranslatePost returned error: %v", err)
+	}
+	if translated.Title != "TITLE" || translated.MainPost.HTMLContent != "<P>HELLO</P>" || translated.Replies[0].HTMLContent != "<P>REPLY</P>" {
+		t.Fatalf("unexpected translation: %+v", translated)
+	}
+	if translated.Replies[1].HTMLContent != "<p>gone</p>" {
+		t.Fatalf("expected a deleted floor to be left alone, got %q", translated.Replies[1].HTMLContent)
+	}
+	if post.Title != "title" || post.Replies[0].HTMLContent != "<p>reply</p>" {
+		t.Fatalf("expected the original post to be untouched, got %+v", post)
+	}
+
+	bilingual, err := TranslatePost(context.Background(), post, &upperTranslator{}, "en", TranslateModeBilingual)
+	if err != nil {
+		t.Fatalf("TranslatePost returned error: %v", err)
+	}
+	if bilingual.Title != "title / TITLE" || bilingual.MainPost.HTMLContent != "<p>hello</p><blockquote><P>HELLO</P></blockquote>" {
+		t.Fatalf("unexpected bilingual translation: %+v", bilingual)
+	}
+}
+
+func TestDeepLTranslatorSendsBatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "DeepL-Auth-Key secret" {
+			t.Errorf("unexpected auth header %q", r.Header.Get("Authorization"))
+		}
+		var payload struct {
+			Text        []string `json:"text"`
+			TargetLang  string   `json:"target_lang"`
+			TagHandling string   `json:"tag_handling"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		if payload.TargetLang != "EN" || payload.TagHandling != "html" {
+			t.Errorf("unexpected payload %+v", payload)
+		}
+		translations := make([]map[string]string, len(payload.Text))
+		for i, text := range payload.Text {
+			translations[i] = map[string]string{"text": "en:" + text}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"translations": translations})
+	}))
+	defer srv.Close()
+
+	translator, err := NewTranslator(srv.Client(), TranslatorOptions{Backend: TranslateBackendDeepL, Endpoint: srv.URL, APIKey: "secret"})
+	if err != nil {
+		t.Fatalf("NewTranslator returned error: %v", err)
+	}
+	got, err := translator.Translate(context.Background(), []string{"a", "b"}, "en")
+	if err != nil {
+		t.Fatalf("Translate returned error: %v", err)
+	}
+	if strings.Join(got, ",") != "en:a,en:b" {
+		t.Fatalf("unexpected translations %q", got)
+	}
+}
+
+func TestTranslateStageWritesVariantNextToStoredThread(t *testing.T) {
+	store := NewPostStore(t.TempDir())
+	post := &Post{TID: "42", Title: "title", MainPost: PostEntry{Floor: "GF", HTMLContent: "<p>hello</p>"}}
+	generator := NewMarkdownGenerator(&MarkdownOptions{}, nil)
+	generator.SetDownloadEnabled(false)
+	state := &PipelineState{TID: "42", Post: post}
+
+	pipeline := NewPipeline(StoreStage(generator, store), TranslateStage(&upperTranslator{}, generator, store, "en", TranslateModeTranslated))
+	if err := pipeline.Run(context.Background(), state); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(store.PostDir("42"), "post.en.md"))
+	if err != nil {
+		t.Fatalf("read translation: %v", err)
+	}
+	if !strings.Contains(string(data), "HELLO") {
+		t.Fatalf("expected translated content, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(store.PostDir("42"), "metadata.toml")); err != nil {
+		t.Fatalf("expected the stored thread to remain intact: %v", err)
+	}
+	if post.MainPost.HTMLContent != "<p>hello</p>" {
+		t.Fatalf("expected the stored post to keep its original content, got %q", post.MainPost.HTMLContent)
+	}
+}
@@ -6,55 +6,112 @@ import (
 
 // Post 表示一个完整的论坛帖子
 type Post struct {
-	TID         string       `toml:"tid"`          // 帖子ID
-	Title       string       `toml:"title"`        // 帖子标题
-	URL         string       `toml:"url"`          // 帖子链接
-	Forum       string       `toml:"forum"`        // 版块名称
-	MainPost    PostEntry    `toml:"main_post"`    // 主楼内容
-	Replies     []PostEntry  `toml:"replies"`      // 回复列表
-	TotalFloors int          `toml:"total_floors"` // 总楼层数
-	Images      []Image      `toml:"images"`       // 图片信息列表
-	GofileFiles []GofileFile `toml:"gofile_files"` // Gofile download records
-	CreatedAt   time.Time    `toml:"created_at"`   // 创建时间
+	TID              string            `toml:"tid"`                         // 帖子ID
+	Title            string            `toml:"title"`                       // 帖子标题
+	URL              string            `toml:"url"`                         // 帖子链接
+	Forum            string            `toml:"forum"`                       // 版块名称
+	Prefixes         []string          `toml:"prefixes,omitempty"`          // 标题前缀(如 [RPG] 中的 RPG)
+	Views            int               `toml:"views,omitempty"`             // 论坛显示的浏览数(0表示未知)
+	ReplyCount       int               `toml:"reply_count,omitempty"`       // 论坛显示的回复数(0表示未知)
+	MainPost         PostEntry         `toml:"main_post"`                   // 主楼内容
+	Replies          []PostEntry       `toml:"replies"`                     // 回复列表
+	TotalFloors      int               `toml:"total_floors"`                // 总楼层数
+	TotalPages       int               `toml:"total_pages,omitempty"`       // 抓取时的总页数
+	MissingPages     []int             `toml:"missing_pages,omitempty"`     // 抓取或解析失败而缺失的页码
+	MissingFloors    []int             `toml:"missing_floors,omitempty"`    // 楼层编号中缺失的回复序号(B<n>F)
+	PageMirrors      []PageMirror      `toml:"page_mirrors,omitempty"`      // 配置了镜像时各页实际抓取的镜像
+	Images           []Image           `toml:"images"`                      // 图片信息列表
+	GofileFiles      []GofileFile      `toml:"gofile_files"`                // Gofile download records
+	Parts            []string          `toml:"parts,omitempty"`             // 分卷导出时的post-NNN.md文件
+	Tags             []string          `toml:"tags,omitempty"`              // 用户标签(south2md tag add)
+	History          []FloorRevision   `toml:"history,omitempty"`           // 被编辑楼层的旧版本
+	Mentions         []Mention         `toml:"mentions,omitempty"`          // 楼层中的@提及和用户主页链接
+	CloudLinks       []CloudLink       `toml:"cloud_links,omitempty"`       // 楼层中的百度网盘/蓝奏云链接及提取码
+	WaybackSnapshots []WaybackSnapshot `toml:"wayback_snapshots,omitempty"` // 提交到 archive.org 的页面快照
+	CreatedAt        time.Time         `toml:"created_at"`                  // 创建时间
+}
+
+// WaybackSnapshot 表示一次 archive.org 页面快照
+type WaybackSnapshot struct {
+	Page     int       `toml:"page"`     // 页码(从1开始)
+	URL      string    `toml:"url"`      // 提交的页面链接
+	Snapshot string    `toml:"snapshot"` // 快照链接
+	SavedAt  time.Time `toml:"saved_at"` // 提交时间
 }
 
 // PostEntry 表示单个楼层的内容
 type PostEntry struct {
-	Floor       string    `toml:"floor"`        // 楼层标识(GF, B1F, B2F...)
-	Author      Author    `toml:"author"`       // 作者信息
-	HTMLContent string    `toml:"html_content"` // 原始HTML内容
-	PostTime    time.Time `toml:"post_time"`    // 发帖时间
-	PostID      string    `toml:"post_id"`      // 帖子ID
+	Floor       string    `toml:"floor"`                  // 楼层标识(GF, B1F, B2F...)
+	Author      Author    `toml:"author"`                 // 作者信息
+	HTMLContent string    `toml:"html_content"`           // 原始HTML内容
+	PostTime    time.Time `toml:"post_time"`              // 发帖时间
+	PostID      string    `toml:"post_id"`                // 帖子ID
+	SourcePage  int       `toml:"source_page,omitempty"`  // 所在页码(从1开始, 0表示未知)
+	Status      string    `toml:"status,omitempty"`       // 楼层状态(deleted/blocked, 空为正常)
+	Hash        string    `toml:"content_hash,omitempty"` // HTMLContent 的 SHA-256(见 ContentHash)
+	EditedAt    time.Time `toml:"edited_at,omitempty"`    // 检测到作者编辑的时间(零值为未编辑)
+	ReplyTo     string    `toml:"reply_to,omitempty"`     // 引用的楼层PostID(回复树的父节点)
+	QuotedBy    []string  `toml:"quoted_by,omitempty"`    // 引用本楼的楼层PostID(回复树的子节点)
+
+	Attachments []Attachment `toml:"attachments,omitempty"` // 楼层附件
 }
 
 // Author 表示作者信息
 type Author struct {
-	Username     string `toml:"username"`      // 用户名
-	UID          string `toml:"uid"`           // 用户ID
-	Avatar       string `toml:"avatar"`        // 头像链接
-	PostCount    int    `toml:"post_count"`    // 发帖数
-	RegisterDate string `toml:"register_date"` // 注册时间
-	LastLogin    string `toml:"last_login"`    // 最后登录
-	Signature    string `toml:"signature"`     // 个性签名
+	Username     string `toml:"username"`               // 用户名
+	UID          string `toml:"uid"`                    // 用户ID
+	Avatar       string `toml:"avatar"`                 // 头像链接
+	AvatarLocal  string `toml:"avatar_local,omitempty"` // 本地头像路径(avatars/下)
+	PostCount    int    `toml:"post_count"`             // 发帖数
+	RegisterDate string `toml:"register_date"`          // 注册时间
+	LastLogin    string `toml:"last_login"`             // 最后登录
+	Signature    string `toml:"signature"`              // 个性签名
+}
+
+// Attachment 表示楼层中的附件(span#att_*)
+type Attachment struct {
+	ID       string `toml:"id"`             // 附件ID
+	Filename string `toml:"filename"`       // 文件名
+	URL      string `toml:"url"`            // 原始链接
+	Size     int64  `toml:"size,omitempty"` // 论坛标注的文件大小(字节)
 }
 
 // Image 表示图片信息
 type Image struct {
-	URL        string `toml:"url"`        // 原始图片URL
-	Local      string `toml:"local"`      // 本地缓存路径
-	Alt        string `toml:"alt"`        // 图片描述
-	FileSize   int64  `toml:"file_size"`  // 文件大小
-	Downloaded bool   `toml:"downloaded"` // 是否已下载
+	URL        string `toml:"url"`              // 原始图片URL
+	Local      string `toml:"local"`            // 本地缓存路径
+	Alt        string `toml:"alt"`              // 图片描述
+	FileSize   int64  `toml:"file_size"`        // 文件大小
+	Downloaded bool   `toml:"downloaded"`       // 是否已下载
+	Source     string `toml:"source,omitempty"` // 下载来源，"wayback" 表示取自 archive.org 快照
+	Tag        string `toml:"tag,omitempty"`    // 分类命令给出的标签(如 nsfw)
+
+	ContentLength int64  `toml:"content_length,omitempty"` // 下载时服务器声明的Content-Length
+	SHA256        string `toml:"sha256,omitempty"`         // 本地文件的SHA-256，用于校验
+
+	AttachmentID string `toml:"attachment_id,omitempty"` // 来自楼层附件时的附件ID
 }
 
 // GofileFile represents a gofile download record.
 type GofileFile struct {
-	URL        string   `toml:"url"`
-	ContentID  string   `toml:"content_id"`
-	LocalDir   string   `toml:"local_dir"`
-	LocalFiles []string `toml:"local_files"`
-	Downloaded bool     `toml:"downloaded"`
-	Error      string   `toml:"error,omitempty"`
+	URL          string                `toml:"url"`
+	ContentID    string                `toml:"content_id"`
+	LocalDir     string                `toml:"local_dir"`
+	LocalFiles   []string              `toml:"local_files"`
+	Downloaded   bool                  `toml:"downloaded"`
+	Error        string                `toml:"error,omitempty"`
+	ManifestOnly bool                  `toml:"manifest_only,omitempty"`
+	TotalSize    int64                 `toml:"total_size,omitempty"`
+	Manifest     []GofileManifestEntry `toml:"manifest,omitempty"`
+	Skipped      []GofileManifestEntry `toml:"skipped,omitempty"`
+}
+
+// GofileManifestEntry describes one remote gofile file without downloading it.
+type GofileManifestEntry struct {
+	Path string `toml:"path"`
+	Size int64  `toml:"size"`
+	MD5  string `toml:"md5,omitempty"`
+	Link string `toml:"link"`
 }
 
 // CookieEntry 表示Cookie信息
@@ -73,5 +130,6 @@ type CookieEntry struct {
 // CookieJar Cookie管理器
 type CookieJar struct {
 	Cookies     []CookieEntry `toml:"cookies"`      // Cookie列表
+	UserAgent   string        `toml:"user_agent"`   // 签发Cookie的浏览器User-Agent(cf_clearance与其绑定)
 	LastUpdated time.Time     `toml:"last_updated"` // 最后更新时间
 }
@@ -1,6 +1,8 @@
 package south2md
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -49,3 +51,36 @@ func CleanHTMLContent(str string) string {
 	// 单次操作清理前后空白和换行
 	return strings.Trim(str, " \n\r\t")
 }
+
+// ParseByteSize parses sizes such as "512MB", "10 GiB" or "1024" (bytes).
+// Units are binary, matching FormatByteSize.
+func ParseByteSize(text string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(text))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "IB"), "B")
+	multiplier := int64(1)
+	if s != "" {
+		if exp := strings.IndexByte("KMGTPE", s[len(s)-1]); exp >= 0 {
+			multiplier = int64(1) << (10 * (exp + 1))
+			s = strings.TrimSpace(s[:len(s)-1])
+		}
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", text)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+// FormatByteSize renders a byte count with a binary unit suffix, e.g. "2.0 GB".
+func FormatByteSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
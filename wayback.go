@@ -0,0 +1,103 @@
+package south2md
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// waybackAvailableAPI is the Wayback Machine availability endpoint.
+const waybackAvailableAPI = "https://archive.org/wayback/available"
+
+// ImageSourceWayback marks images restored from a Wayback Machine snapshot.
+const ImageSourceWayback = "wayback"
+
+type waybackAvailability struct {
+	ArchivedSnapshots struct {
+		Closest *struct {
+			Available bool   `json:"available"`
+			URL       string `json:"url"`
+			Timestamp string `json:"timestamp"`
+			Status    string `json:"status"`
+		} `json:"closest"`
+	} `json:"archived_snapshots"`
+}
+
+// errNoWaybackSnapshot reports that archive.org holds no usable snapshot.
+var errNoWaybackSnapshot = errors.New("no wayback snapshot")
+
+// SetWaybackFallback enables looking up archive.org snapshots for images
+// whose origin answers 404 or 410.
+func (ih *ImageHandler) SetWaybackFallback(enabled bool) {
+	if ih == nil {
+		return
+	}
+	ih.wayback = enabled
+}
+
+// isDeadLinkError reports whether err is a 404/410 answer from the origin.
+func isDeadLinkError(err error) bool {
+	var statusErr *httpStatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	return statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusGone
+}
+
+// waybackSnapshotURL returns the raw-content URL of the closest archived
+// snapshot of rawURL.
+func (ih *ImageHandler) waybackSnapshotURL(rawURL string) (string, error) {
+	endpoint := ih.waybackAPI
+	if endpoint == "" {
+		endpoint = waybackAvailableAPI
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint+"?url="+url.QueryEscape(rawURL), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create wayback request: %w", err)
+	}
+	resp, err := ih.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("wayback availability request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &httpStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	var availability waybackAvailability
+	if err := json.NewDecoder(resp.Body).Decode(&availability); err != nil {
+		return "", fmt.Errorf("failed to parse wayback response: %w", err)
+	}
+	closest := availability.ArchivedSnapshots.Closest
+	if closest == nil || !closest.Available || closest.URL == "" || closest.Status != "200" {
+		return "", errNoWaybackSnapshot
+	}
+	return waybackRawURL(closest.URL, closest.Timestamp), nil
+}
+
+// waybackRawURL rewrites a snapshot URL to its "id_" form, which serves the
+// archived bytes without the Wayback toolbar rewriting.
+func waybackRawURL(snapshotURL, timestamp string) string {
+	if timestamp == "" {
+		return snapshotURL
+	}
+	marker := "/web/" + timestamp + "/"
+	if i := strings.Index(snapshotURL, marker); i >= 0 {
+		return snapshotURL[:i] + "/web/" + timestamp + "id_/" + snapshotURL[i+len(marker):]
+	}
+	return snapshotURL
+}
+
+// downloadFromWayback fetches the archived copy of a dead image.
+func (ih *ImageHandler) downloadFromWayback(rawURL string) ([]byte, int64, error) {
+	snapshotURL, err := ih.waybackSnapshotURL(rawURL)
+	if err != nil {
+		return nil, -1, err
+	}
+	slog.Info("Downloading image from wayback snapshot", "url", rawURL, "snapshot", snapshotURL)
+	return ih.downloadImage(snapshotURL)
+}
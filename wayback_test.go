@@ -0,0 +1,74 @@
+package south2md
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadAndCacheImagesFallsBackToWayback(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/gone.jpg":
+			http.NotFound(w, r)
+		case r.URL.Path == "/available":
+			if r.URL.Query().Get("url") != server.URL+"/gone.jpg" {
+				fmt.Fprint(w, `{"archived_snapshots":{}}`)
+				return
+			}
+			fmt.Fprintf(w, `{"archived_snapshots":{"closest":{"available":true,"status":"200","timestamp":"20200101000000","url":"%s/web/20200101000000/%s/gone.jpg"}}}`, server.URL, server.URL)
+		case strings.HasPrefix(r.URL.Path, "/web/20200101000000id_/"):
+			_, _ = w.Write([]byte("archived-bytes"))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "100", "images"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	h := NewImageHandler("images")
+	h.SetRootDir(root)
+	h.waybackAPI = server.URL + "/available"
+
+	post := &Post{}
+	markdown := "![a](" + server.URL + "/gone.jpg)"
+	got, err := h.DownloadAndCacheImages("100", []byte(markdown), post)
+	if err != nil {
+		t.Fatalf("DownloadAndCacheImages returned error: %v", err)
+	}
+	if string(got) != markdown || len(post.Images) != 0 {
+		t.Fatalf("expected no fallback while disabled, got %q and %+v", got, post.Images)
+	}
+
+	h.SetWaybackFallback(true)
+	got, err = h.DownloadAndCacheImages("100", []byte(markdown), post)
+	if err != nil {
+		t.Fatalf("DownloadAndCacheImages returned error: %v", err)
+	}
+	if !strings.HasPrefix(string(got), "![a](images/") {
+		t.Fatalf("expected the archived copy to be linked, got %q", got)
+	}
+	if len(post.Images) != 1 || post.Images[0].Source != ImageSourceWayback || post.Images[0].URL != server.URL+"/gone.jpg" {
+		t.Fatalf("unexpected image records: %+v", post.Images)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "100", "images", post.Images[0].Local))
+	if err != nil || string(data) != "archived-bytes" {
+		t.Fatalf("expected archived bytes on disk, got %q, %v", data, err)
+	}
+}
+
+func TestWaybackRawURL(t *testing.T) {
+	got := waybackRawURL("http://web.archive.org/web/20200101000000/https://img.example.com/a.jpg", "20200101000000")
+	if want := "http://web.archive.org/web/20200101000000id_/https://img.example.com/a.jpg"; got != want {
+		t.Fatalf("waybackRawURL = %q, want %q", got, want)
+	}
+}
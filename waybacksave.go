@@ -0,0 +1,155 @@
+package south2md
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// waybackSaveEndpoint is the Wayback Machine "Save Page Now" endpoint; the
+// page URL is appended to it.
+const waybackSaveEndpoint = "https://web.archive.org/save/"
+
+// StageWaybackSave is the name of the stage submitting pages to archive.org.
+const StageWaybackSave = "wayback_save"
+
+var waybackSnapshotPath = regexp.MustCompile(`/web/\d{14}/`)
+
+// WaybackSaver submits page URLs to archive.org's save API, at most one
+// request per interval. Saving is best-effort: failures are logged by
+// WaybackSaveStage and never fail the archive.
+type WaybackSaver struct {
+	client   HTTPDoer
+	endpoint string
+	limiter  *tokenBucket
+	now      func() time.Time
+}
+
+// NewWaybackSaver creates a saver sending requests through client, spaced at
+// least interval apart; interval <= 0 means no spacing.
+func NewWaybackSaver(client HTTPDoer, interval time.Duration) *WaybackSaver {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	saver := &WaybackSaver{client: client, endpoint: waybackSaveEndpoint, now: time.Now}
+	if interval > 0 {
+		saver.limiter = newTokenBucket(float64(time.Second)/float64(interval), 1)
+	}
+	return saver
+}
+
+// Save asks archive.org to capture pageURL and returns the snapshot URL.
+func (s *WaybackSaver) Save(ctx context.Context, pageURL string) (string, error) {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.endpoint+pageURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create save request: %w", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("save request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), s.now()); ok {
+			s.limiter.pause(retryAfter)
+		}
+	}
+	if resp.StatusCode >= 400 {
+		return "", &httpStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	// The snapshot is named by Content-Location, or by the URL the save
+	// request was redirected to.
+	base, _ := url.Parse(s.endpoint)
+	if location := resp.Header.Get("Content-Location"); location != "" {
+		if ref, err := url.Parse(location); err == nil {
+			return base.ResolveReference(ref).String(), nil
+		}
+	}
+	if resp.Request != nil && waybackSnapshotPath.MatchString(resp.Request.URL.Path) {
+		return resp.Request.URL.String(), nil
+	}
+	return "", fmt.Errorf("save response names no snapshot")
+}
+
+// WaybackSaveStage submits every fetched page of state.Post to saver and
+// records the snapshots in the post's metadata. Pages listed as missing are
+// skipped. Failures are logged and never stop the pipeline.
+func WaybackSaveStage(fetcher *Fetcher, saver *WaybackSaver) Stage {
+	return NewStage(StageWaybackSave, func(ctx context.Context, state *PipelineState) error {
+		post := state.Post
+		if post == nil || saver == nil {
+			return nil
+		}
+		tid := post.TID
+		if tid == "" {
+			tid = state.TID
+		}
+		missing := make(map[int]bool, len(post.MissingPages))
+		for _, page := range post.MissingPages {
+			missing[page] = true
+		}
+
+		saved := 0
+		pages := max(1, post.TotalPages)
+		for page := 1; page <= pages; page++ {
+			if missing[page] {
+				continue
+			}
+			pageURL := fetcher.buildPostURL(tid, page)
+			snapshot, err := saver.Save(ctx, pageURL)
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				slog.Warn("Wayback save failed", "tid", tid, "page", page, "error", err)
+				continue
+			}
+			post.WaybackSnapshots = append(post.WaybackSnapshots, WaybackSnapshot{
+				Page:     page,
+				URL:      pageURL,
+				Snapshot: snapshot,
+				SavedAt:  saver.now(),
+			})
+			saved++
+		}
+		slog.Info("Wayback snapshots saved", "tid", tid, "saved", saved, "pages", pages)
+		return nil
+	})
+}
+
+// mergeWaybackSnapshots returns the snapshots of existing followed by the
+// ones in add that it doesn't hold yet. Snapshots are keyed by page and
+// snapshot link, or the submitted page link when there is no snapshot link,
+// so re-storing a post loaded from the store doesn't duplicate them.
+func mergeWaybackSnapshots(existing, add []WaybackSnapshot) []WaybackSnapshot {
+	type key struct {
+		page int
+		link string
+	}
+	keyOf := func(s WaybackSnapshot) key {
+		if s.Snapshot != "" {
+			return key{s.Page, s.Snapshot}
+		}
+		return key{s.Page, s.URL}
+	}
+	seen := make(map[key]bool, len(existing)+len(add))
+	var merged []WaybackSnapshot
+	for _, s := range append(append([]WaybackSnapshot(nil), existing...), add...) {
+		if k := keyOf(s); !seen[k] {
+			seen[k] = true
+			merged = append(merged, s)
+		}
+	}
+	return merged
+}
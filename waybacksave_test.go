@@ -0,0 +1,85 @@
+package south2md
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaybackSaveStageRecordsSnapshots(t *testing.T) {
+	var saved []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := strings.TrimPrefix(r.URL.RequestURI(), "/save/")
+		saved = append(saved, target)
+		if strings.Contains(target, "page-3") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Location", "/web/20240101000000/"+target)
+	}))
+	defer srv.Close()
+
+	saver := NewWaybackSaver(srv.Client(), 0)
+	saver.endpoint = srv.URL + "/save/"
+	fetcher := NewFetcher(srv.Client(), &HTTPOptions{}, "https://south-plus.net/")
+	state := &PipelineState{TID: "42", Post: &Post{TID: "42", TotalPages: 4, MissingPages: []int{2}}}
+
+	if err := WaybackSaveStage(fetcher, saver).Run(context.Background(), state); err != nil {
+		t.Fatalf("WaybackSaveStage returned error: %v", err)
+	}
+	if len(saved) != 3 {
+		t.Fatalf("expected pages 1, 3 and 4 to be submitted, got %v", saved)
+	}
+	snapshots := state.Post.WaybackSnapshots
+	if len(snapshots) != 2 || snapshots[0].Page != 1 || snapshots[1].Page != 4 {
+		t.Fatalf("expected snapshots for pages 1 and 4, got %+v", snapshots)
+	}
+	want := srv.URL + "/web/20240101000000/https://south-plus.net/read.php?tid-42.html"
+	if snapshots[0].Snapshot != want || snapshots[0].URL != "https://south-plus.net/read.php?tid-42.html" {
+		t.Fatalf("unexpected snapshot %+v, want %s", snapshots[0], want)
+	}
+}
+
+func TestStorePostKeepsWaybackSnapshotsStable(t *testing.T) {
+	root := t.TempDir()
+	store := NewPostStore(root)
+	g := NewMarkdownGenerator(&MarkdownOptions{}, nil)
+	g.SetDownloadEnabled(false)
+
+	saved := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	post := &Post{TID: "100", MainPost: PostEntry{Floor: "GF", HTMLContent: "<p>hi</p>"}, WaybackSnapshots: []WaybackSnapshot{
+		{Page: 1, URL: "https://south-plus.net/read.php?tid-100.html", Snapshot: "https://web.archive.org/web/1/p1", SavedAt: saved},
+		{Page: 2, URL: "https://south-plus.net/read.php?tid-100-page-2.html", Snapshot: "https://web.archive.org/web/1/p2", SavedAt: saved},
+	}}
+	if err := g.StorePost(post, root); err != nil {
+		t.Fatalf("StorePost returned error: %v", err)
+	}
+	for run := 0; run < 2; run++ {
+		// Retry, regen and offline export re-store the post they loaded.
+		loaded, err := store.LoadPostFromStore("100")
+		if err != nil {
+			t.Fatalf("LoadPostFromStore: %v", err)
+		}
+		if err := g.StorePost(loaded, root); err != nil {
+			t.Fatalf("StorePost returned error: %v", err)
+		}
+	}
+
+	// A new save of page 1 is kept next to the earlier one.
+	refetched := &Post{TID: "100", MainPost: PostEntry{Floor: "GF", HTMLContent: "<p>hi</p>"}, WaybackSnapshots: []WaybackSnapshot{
+		{Page: 1, URL: "https://south-plus.net/read.php?tid-100.html", Snapshot: "https://web.archive.org/web/2/p1", SavedAt: saved},
+	}}
+	if err := g.StorePost(refetched, root); err != nil {
+		t.Fatalf("StorePost returned error: %v", err)
+	}
+	stored, err := store.LoadPostFromStore("100")
+	if err != nil {
+		t.Fatalf("LoadPostFromStore: %v", err)
+	}
+	if len(stored.WaybackSnapshots) != 3 {
+		t.Fatalf("expected 3 distinct snapshots, got %+v", stored.WaybackSnapshots)
+	}
+}
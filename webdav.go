@@ -0,0 +1,251 @@
+package south2md
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+// WebDAVKeyringService is the OS keyring service the WebDAV password is
+// looked up under when neither the URL nor the config holds one. The account
+// is "<username>@<host>", with host as written in the URL.
+const WebDAVKeyringService = "south2md-webdav"
+
+// WebDAVExporter uploads exported post directories to a WebDAV collection
+// (e.g. Nextcloud's remote.php/dav/files/<user>/...).
+type WebDAVExporter struct {
+	baseURL    *url.URL
+	username   string
+	password   string
+	httpClient HTTPDoer
+	maxRetries int
+	retryDelay time.Duration
+	created    map[string]struct{}
+}
+
+// IsWebDAVTarget reports whether an export target refers to a WebDAV URL
+// instead of a local directory.
+func IsWebDAVTarget(target string) bool {
+	u, err := url.Parse(strings.TrimSpace(target))
+	if err != nil || u.Host == "" {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "webdav", "webdavs":
+		return true
+	}
+	return false
+}
+
+// NewWebDAVExporter creates an exporter for target. Credentials embedded in the
+// URL take precedence over the configured WebDAV username/password, which in
+// turn take precedence over the OS keyring.
+func NewWebDAVExporter(target string, config *Config) (*WebDAVExporter, error) {
+	if config == nil {
+		return nil, NewValidationError("config is nil")
+	}
+	u, err := url.Parse(strings.TrimSpace(target))
+	if err != nil {
+		return nil, NewValidationError(fmt.Sprintf("invalid WebDAV url %q: %v", target, err))
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "webdav":
+		u.Scheme = "http"
+	case "webdavs":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return nil, NewValidationError(fmt.Sprintf("unsupported WebDAV scheme %q", u.Scheme))
+	}
+
+	username, password := config.WebDAVUsername, config.WebDAVPassword
+	if u.User != nil {
+		username = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			password = p
+		}
+		u.User = nil
+	}
+	if password == "" && username != "" {
+		password = webdavKeyringPassword(username, u.Host)
+	}
+
+	return &WebDAVExporter{
+		baseURL:    u,
+		username:   username,
+		password:   password,
+		httpClient: &http.Client{Timeout: config.HTTPTimeout},
+		maxRetries: max(0, config.HTTPMaxRetries),
+		retryDelay: config.HTTPRetryDelay,
+		created:    make(map[string]struct{}),
+	}, nil
+}
+
+// webdavKeyringPassword returns the password of username on host stored in
+// the OS keyring. A missing entry or an unavailable keyring yields "".
+func webdavKeyringPassword(username, host string) string {
+	password, err := keyring.Get(WebDAVKeyringService, username+"@"+host)
+	if err != nil {
+		if !errors.Is(err, keyring.ErrNotFound) {
+			slog.Debug("WebDAV keyring lookup failed", "error", err)
+		}
+		return ""
+	}
+	return password
+}
+
+// SetHTTPDoer replaces the client used for WebDAV requests; nil is ignored.
+func (w *WebDAVExporter) SetHTTPDoer(doer HTTPDoer) {
+	if doer == nil {
+		return
+	}
+	w.httpClient = doer
+}
+
+// RemoteURL returns the absolute URL of remotePath under the base collection.
+func (w *WebDAVExporter) RemoteURL(remotePath string) string {
+	return w.baseURL.JoinPath(splitRemotePath(remotePath)...).String()
+}
+
+// UploadDir uploads every file under localDir to remoteDir, creating
+// collections as needed.
+func (w *WebDAVExporter) UploadDir(localDir, remoteDir string) error {
+	if err := w.ensureCollection(remoteDir); err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(localDir, func(localPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, localPath)
+		if err != nil {
+			return fmt.Errorf("failed to build relative path: %w", err)
+		}
+		if rel == "." {
+			return nil
+		}
+
+		remotePath := path.Join(remoteDir, filepath.ToSlash(rel))
+		if d.IsDir() {
+			return w.ensureCollection(remotePath)
+		}
+		return w.putFile(localPath, remotePath)
+	})
+}
+
+// ensureCollection creates remotePath and all its parents with MKCOL.
+func (w *WebDAVExporter) ensureCollection(remotePath string) error {
+	current := ""
+	for _, segment := range splitRemotePath(remotePath) {
+		current = path.Join(current, segment)
+		if _, ok := w.created[current]; ok {
+			continue
+		}
+
+		resp, err := w.do("MKCOL", current, nil)
+		if err != nil {
+			return NewNetworkError(fmt.Sprintf("WebDAV MKCOL %s failed", current), err)
+		}
+		resp.Body.Close()
+
+		// 405 means the collection already exists.
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed &&
+			(resp.StatusCode < 200 || resp.StatusCode >= 300) {
+			return NewNetworkError(fmt.Sprintf("WebDAV MKCOL %s failed", current), fmt.Errorf("unexpected status %s", resp.Status))
+		}
+		w.created[current] = struct{}{}
+	}
+	return nil
+}
+
+func (w *WebDAVExporter) putFile(localPath, remotePath string) error {
+	resp, err := w.do(http.MethodPut, remotePath, func() (io.ReadCloser, int64, error) {
+		f, err := os.Open(localPath)
+		if err != nil {
+			return nil, 0, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		return f, info.Size(), nil
+	})
+	if err != nil {
+		return NewNetworkError(fmt.Sprintf("WebDAV PUT %s failed", remotePath), err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return NewNetworkError(fmt.Sprintf("WebDAV PUT %s failed", remotePath), fmt.Errorf("unexpected status %s", resp.Status))
+	}
+	slog.Debug("Uploaded file to WebDAV", "path", remotePath)
+	return nil
+}
+
+// do sends one WebDAV request, retrying network errors and 5xx responses.
+// body is re-opened for every attempt so uploads can be replayed.
+func (w *WebDAVExporter) do(method, remotePath string, body func() (io.ReadCloser, int64, error)) (*http.Response, error) {
+	target := w.RemoteURL(remotePath)
+	var lastErr error
+
+	for attempt := 0; attempt <= w.maxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(w.retryDelay)
+			slog.Info("Retrying WebDAV request", "method", method, "url", target, "attempt", attempt)
+		}
+
+		req, err := http.NewRequest(method, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			reader, size, err := body()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = reader
+			req.ContentLength = size
+		}
+		if w.username != "" || w.password != "" {
+			req.SetBasicAuth(w.username, w.password)
+		}
+
+		resp, err := w.httpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode >= 500 {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("server error %s", resp.Status)
+			continue
+		}
+		return resp, nil
+	}
+
+	return nil, fmt.Errorf("request failed after %d retries: %w", w.maxRetries, lastErr)
+}
+
+func splitRemotePath(remotePath string) []string {
+	parts := strings.Split(strings.Trim(path.Clean("/"+filepath.ToSlash(remotePath)), "/"), "/")
+	segments := parts[:0]
+	for _, part := range parts {
+		if part != "" {
+			segments = append(segments, part)
+		}
+	}
+	return segments
+}
@@ -0,0 +1,142 @@
+package south2md
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestIsWebDAVTarget(t *testing.T) {
+	tests := map[string]bool{
+		"./exports":                        false,
+		"/tmp/exports":                     false,
+		"https://cloud.example.com/dav":    true,
+		"webdavs://cloud.example.com/dav":  true,
+		"webdav://nas.local/share":         true,
+		"ftp://example.com/files":          false,
+		"C:\\Users\\me\\exports":           false,
+		"https:/missing-host-is-not-valid": false,
+	}
+	for target, want := range tests {
+		if got := IsWebDAVTarget(target); got != want {
+			t.Errorf("IsWebDAVTarget(%q) = %v, want %v", target, got, want)
+		}
+	}
+}
+
+func TestWebDAVExporterUploadDir(t *testing.T) {
+	var mu sync.Mutex
+	collections := map[string]bool{}
+	files := map[string]string{}
+	putFailures := 1
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "alice" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case "MKCOL":
+			if collections[r.URL.Path] {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			collections[r.URL.Path] = true
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodPut:
+			if putFailures > 0 {
+				putFailures--
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			files[r.URL.Path] = string(body)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+
+	localDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(localDir, "images"), 0755); err != nil {
+		t.Fatalf("mkdir images: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(localDir, "post.md"), []byte("# post"), 0644); err != nil {
+		t.Fatalf("write post: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(localDir, "images", "a.png"), []byte("png"), 0644); err != nil {
+		t.Fatalf("write image: %v", err)
+	}
+
+	config := NewDefaultConfig()
+	config.WebDAVPassword = "secret"
+	config.HTTPRetryDelay = 0
+	exporter, err := NewWebDAVExporter("http://alice@"+server.Listener.Addr().String()+"/dav/files/alice", config)
+	if err != nil {
+		t.Fatalf("NewWebDAVExporter failed: %v", err)
+	}
+
+	if err := exporter.UploadDir(localDir, "2636739"); err != nil {
+		t.Fatalf("UploadDir failed: %v", err)
+	}
+
+	for _, want := range []string{"/dav/files/alice/2636739", "/dav/files/alice/2636739/images"} {
+		if !collections[want] {
+			t.Errorf("expected collection %s to be created", want)
+		}
+	}
+	if files["/dav/files/alice/2636739/post.md"] != "# post" {
+		t.Errorf("unexpected post.md upload: %q", files["/dav/files/alice/2636739/post.md"])
+	}
+	if files["/dav/files/alice/2636739/images/a.png"] != "png" {
+		t.Errorf("unexpected image upload: %q", files["/dav/files/alice/2636739/images/a.png"])
+	}
+	if got := exporter.RemoteURL("2636739"); got != server.URL+"/dav/files/alice/2636739" {
+		t.Errorf("unexpected remote url: %s", got)
+	}
+}
+
+func TestWebDAVExporterReadsPasswordFromKeyring(t *testing.T) {
+	keyring.MockInit()
+	if err := keyring.Set(WebDAVKeyringService, "alice@cloud.example.com", "from-keyring"); err != nil {
+		t.Fatalf("keyring.Set: %v", err)
+	}
+
+	config := NewDefaultConfig()
+	exporter, err := NewWebDAVExporter("https://alice@cloud.example.com/dav", config)
+	if err != nil {
+		t.Fatalf("NewWebDAVExporter failed: %v", err)
+	}
+	if exporter.password != "from-keyring" {
+		t.Fatalf("expected the keyring password, got %q", exporter.password)
+	}
+
+	config.WebDAVPassword = "from-env"
+	exporter, err = NewWebDAVExporter("https://alice@cloud.example.com/dav", config)
+	if err != nil {
+		t.Fatalf("NewWebDAVExporter failed: %v", err)
+	}
+	if exporter.password != "from-env" {
+		t.Fatalf("expected the configured password to take precedence, got %q", exporter.password)
+	}
+
+	exporter, err = NewWebDAVExporter("https://bob@cloud.example.com/dav", NewDefaultConfig())
+	if err != nil {
+		t.Fatalf("NewWebDAVExporter failed: %v", err)
+	}
+	if exporter.password != "" {
+		t.Fatalf("expected no password without a keyring entry, got %q", exporter.password)
+	}
+}